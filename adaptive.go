@@ -0,0 +1,69 @@
+package main
+
+import (
+	"math"
+	"slices"
+)
+
+// adaptiveAlpha is the weight of the latest invocation in the EWMAs
+const adaptiveAlpha = 0.2
+
+// adaptiveMinFactor keeps a trickle of traffic on the degraded workers, so
+// their EWMAs can recover
+const adaptiveMinFactor = 0.01
+
+// adaptiveScale keeps the precision of the factors in the integer weights
+const adaptiveScale = 100
+
+var lambdaAdaptiveWeight = NewGaugeVec(
+	"orchestrator_lambda_adaptive_weight",
+	"Factor, from 0.01 to 1, applied to the registry weight of each worker by its latency and error EWMAs.",
+	"lambda_arn",
+)
+
+// updateEWMA folds an invocation into the EWMAs of stats
+func updateEWMA(stats *LambdaRoutingStats, durationMs float64, failed bool) {
+	errorValue := 0.0
+	if failed {
+		errorValue = 1
+	}
+	if stats.Invocations == 1 {
+		stats.LatencyEWMAMs, stats.ErrorEWMA = durationMs, errorValue
+		return
+	}
+	stats.LatencyEWMAMs += adaptiveAlpha * (durationMs - stats.LatencyEWMAMs)
+	stats.ErrorEWMA += adaptiveAlpha * (errorValue - stats.ErrorEWMA)
+}
+
+// adaptiveWeights scales the registry weights of the candidates by their
+// recent behaviour: the share of successes times the latency of the fastest
+// candidate over their own. Traffic shifts away from a degrading worker
+// before it is marked unhealthy. Workers without invocations keep their
+// weight.
+func (r *routingStats) adaptiveWeights(lambdas []Lambda) []Lambda {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	fastest := math.Inf(1)
+	for _, lambda := range lambdas {
+		if stats, ok := r.stats[lambda.ARN]; ok && stats.LatencyEWMAMs > 0 {
+			fastest = min(fastest, stats.LatencyEWMAMs)
+		}
+	}
+
+	weighted := slices.Clone(lambdas)
+	for i, lambda := range weighted {
+		factor := 1.0
+		if stats, ok := r.stats[lambda.ARN]; ok {
+			factor = 1 - stats.ErrorEWMA
+			if stats.LatencyEWMAMs > 0 {
+				factor *= fastest / stats.LatencyEWMAMs
+			}
+			factor = max(factor, adaptiveMinFactor)
+		}
+		lambdaAdaptiveWeight.Set(factor, lambda.ARN)
+		weight := max(int(math.Round(float64(lambda.EffectiveWeight())*adaptiveScale*factor)), 1)
+		weighted[i].Weight = &weight
+	}
+	return weighted
+}
@@ -0,0 +1,286 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net/http"
+	"strings"
+	"time"
+
+	"challenge-4-orchestrator/config"
+)
+
+// AdminAPI exposes registry management endpoints under /admin/lambdas
+type AdminAPI struct {
+	registry   *LambdaRegistry
+	reconciler *Reconciler // nil when reconciliation is disabled
+	events     *EventStream
+	auth       AdminAuth
+}
+
+func NewAdminAPI(registry *LambdaRegistry, reconciler *Reconciler, events *EventStream, auth AdminAuth) *AdminAPI {
+	return &AdminAPI{
+		registry:   registry,
+		reconciler: reconciler,
+		events:     events,
+		auth:       auth,
+	}
+}
+
+type logLevelRequest struct {
+	Level       string `json:"level"`
+	RevertAfter string `json:"revertAfter"` // optional duration, e.g. "15m"
+}
+
+type logLevelResponse struct {
+	Level    string     `json:"level"`
+	RevertAt *time.Time `json:"revertAt,omitempty"`
+}
+
+type lambdaUpdateRequest struct {
+	Status *Status `json:"status"`
+	Weight *int    `json:"weight"`
+}
+
+// Register mounts the admin routes on the mux, each group behind its own
+// authentication
+func (a *AdminAPI) Register(mux *http.ServeMux) {
+	a.handle(mux, config.AuthGroupRegistry, "GET /admin/lambdas", a.listLambdas)
+	a.handle(mux, config.AuthGroupRegistry, "POST /admin/lambdas", a.createLambda)
+	a.handle(mux, config.AuthGroupRegistry, "GET /admin/lambdas/{id}", a.getLambda)
+	a.handle(mux, config.AuthGroupRegistry, "PATCH /admin/lambdas/{id}", a.updateLambda)
+	a.handle(mux, config.AuthGroupRegistry, "DELETE /admin/lambdas/{id}", a.deleteLambda)
+	a.handle(mux, config.AuthGroupRegistry, "GET /admin/registry/export", a.exportRegistry)
+	a.handle(mux, config.AuthGroupRegistry, "POST /admin/registry/import", a.importRegistry)
+	a.handle(mux, config.AuthGroupOperations, "GET /admin/reconciliation", a.reconciliationReport)
+	a.handle(mux, config.AuthGroupOperations, "GET /admin/loglevel", a.getLogLevel)
+	a.handle(mux, config.AuthGroupOperations, "PUT /admin/loglevel", a.putLogLevel)
+	a.handle(mux, config.AuthGroupOperations, "GET /admin/events", a.events.ServeHTTP)
+}
+
+// handle mounts a route behind the authenticator of its group, skipping it
+// when the group has none
+func (a *AdminAPI) handle(mux *http.ServeMux, group, pattern string, handler http.HandlerFunc) {
+	auth := a.auth[group]
+	if auth == nil {
+		return
+	}
+	mux.Handle(pattern, requireAuth(auth, handler))
+}
+
+func (a *AdminAPI) listLambdas(w http.ResponseWriter, r *http.Request) {
+	lambdas, err := a.registry.List(r.Context())
+	if err != nil {
+		slog.Error("Admin: error listing lambdas", errAttr(err))
+		writeError(w, http.StatusInternalServerError, "error listing lambdas")
+		return
+	}
+
+	writeJSON(w, http.StatusOK, lambdas)
+}
+
+func (a *AdminAPI) getLambda(w http.ResponseWriter, r *http.Request) {
+	lambda, err := a.registry.Get(r.Context(), r.PathValue("id"))
+	if err != nil {
+		slog.Error("Admin: error getting lambda", "lambda_id", r.PathValue("id"), errAttr(err))
+		writeError(w, http.StatusInternalServerError, "error getting lambda")
+		return
+	}
+	if lambda == nil {
+		writeError(w, http.StatusNotFound, ErrLambdaNotFound.Error())
+		return
+	}
+
+	writeJSON(w, http.StatusOK, lambda)
+}
+
+func (a *AdminAPI) createLambda(w http.ResponseWriter, r *http.Request) {
+	var lambda Lambda
+	if err := json.NewDecoder(r.Body).Decode(&lambda); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid JSON body: "+err.Error())
+		return
+	}
+
+	if lambda.ID == "" || lambda.ARN == "" {
+		writeError(w, http.StatusBadRequest, "id and arn are required")
+		return
+	}
+	if lambda.Status == "" {
+		lambda.Status = Healthy
+	}
+	if !lambda.Status.Valid() {
+		writeError(w, http.StatusBadRequest, "invalid status: "+string(lambda.Status))
+		return
+	}
+	if lambda.Weight != nil && *lambda.Weight < 0 {
+		writeError(w, http.StatusBadRequest, "weight must not be negative")
+		return
+	}
+	if lambda.MaxRate < 0 {
+		writeError(w, http.StatusBadRequest, "maxRate must not be negative")
+		return
+	}
+	if !lambda.Type.Valid() {
+		writeError(w, http.StatusBadRequest, "invalid type: "+string(lambda.Type))
+		return
+	}
+
+	if err := a.registry.Create(r.Context(), lambda); err != nil {
+		if errors.Is(err, ErrLambdaExists) {
+			writeError(w, http.StatusConflict, err.Error())
+			return
+		}
+		slog.Error("Admin: error creating lambda", "lambda_id", lambda.ID, errAttr(err))
+		writeError(w, http.StatusInternalServerError, "error creating lambda")
+		return
+	}
+
+	slog.Info("Admin: registered lambda", "lambda_id", lambda.ID, "lambda_arn", lambda.ARN)
+	writeJSON(w, http.StatusCreated, lambda)
+}
+
+func (a *AdminAPI) updateLambda(w http.ResponseWriter, r *http.Request) {
+	id := r.PathValue("id")
+
+	var req lambdaUpdateRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid JSON body: "+err.Error())
+		return
+	}
+
+	if req.Status == nil && req.Weight == nil {
+		writeError(w, http.StatusBadRequest, "status or weight is required")
+		return
+	}
+	if req.Status != nil && !req.Status.Valid() {
+		writeError(w, http.StatusBadRequest, "invalid status: "+string(*req.Status))
+		return
+	}
+	if req.Weight != nil && *req.Weight < 0 {
+		writeError(w, http.StatusBadRequest, "weight must not be negative")
+		return
+	}
+
+	lambda, err := a.registry.Update(r.Context(), id, req.Status, req.Weight)
+	if err != nil {
+		if errors.Is(err, ErrLambdaNotFound) {
+			writeError(w, http.StatusNotFound, err.Error())
+			return
+		}
+		slog.Error("Admin: error updating lambda", "lambda_id", id, errAttr(err))
+		writeError(w, http.StatusInternalServerError, "error updating lambda")
+		return
+	}
+
+	slog.Info("Admin: updated lambda", "lambda_id", id, "status", lambda.Status, "weight", lambda.EffectiveWeight())
+	writeJSON(w, http.StatusOK, lambda)
+}
+
+func (a *AdminAPI) deleteLambda(w http.ResponseWriter, r *http.Request) {
+	id := r.PathValue("id")
+
+	if err := a.registry.Delete(r.Context(), id); err != nil {
+		slog.Error("Admin: error deleting lambda", "lambda_id", id, errAttr(err))
+		writeError(w, http.StatusInternalServerError, "error deleting lambda")
+		return
+	}
+
+	slog.Info("Admin: deleted lambda", "lambda_id", id)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (a *AdminAPI) exportRegistry(w http.ResponseWriter, r *http.Request) {
+	snapshot, err := a.registry.Export(r.Context())
+	if err != nil {
+		slog.Error("Admin: error exporting registry", errAttr(err))
+		writeError(w, http.StatusInternalServerError, "error exporting registry")
+		return
+	}
+
+	writeJSON(w, http.StatusOK, snapshot)
+}
+
+// importRegistry accepts ?mode=merge|replace (default merge) and ?dryRun=true
+func (a *AdminAPI) importRegistry(w http.ResponseWriter, r *http.Request) {
+	var snapshot RegistrySnapshot
+	if err := json.NewDecoder(r.Body).Decode(&snapshot); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid JSON body: "+err.Error())
+		return
+	}
+
+	mode := ImportMode(r.URL.Query().Get("mode"))
+	if mode == "" {
+		mode = ImportMerge
+	}
+	dryRun := r.URL.Query().Get("dryRun") == "true"
+
+	if mode != ImportMerge && mode != ImportReplace {
+		writeError(w, http.StatusBadRequest, "invalid mode: "+string(mode))
+		return
+	}
+
+	report, err := a.registry.Import(r.Context(), &snapshot, mode, dryRun)
+	if err != nil {
+		slog.Error("Admin: error importing registry", errAttr(err))
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	slog.Info("Admin: registry import", "mode", mode, "dry_run", dryRun,
+		"created", len(report.Created), "updated", len(report.Updated), "deleted", len(report.Deleted))
+	writeJSON(w, http.StatusOK, report)
+}
+
+func (a *AdminAPI) reconciliationReport(w http.ResponseWriter, r *http.Request) {
+	if a.reconciler == nil {
+		writeError(w, http.StatusNotFound, "reconciliation is disabled")
+		return
+	}
+
+	report := a.reconciler.LastReport()
+	if report == nil {
+		writeError(w, http.StatusNotFound, "no reconciliation has run yet")
+		return
+	}
+
+	writeJSON(w, http.StatusOK, report)
+}
+
+func (a *AdminAPI) getLogLevel(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, currentLogLevel())
+}
+
+func (a *AdminAPI) putLogLevel(w http.ResponseWriter, r *http.Request) {
+	var req logLevelRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid JSON body: "+err.Error())
+		return
+	}
+
+	level, err := parseLogLevel(req.Level)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "invalid level: "+req.Level)
+		return
+	}
+
+	var revertAfter time.Duration
+	if req.RevertAfter != "" {
+		revertAfter, err = time.ParseDuration(req.RevertAfter)
+		if err != nil || revertAfter <= 0 {
+			writeError(w, http.StatusBadRequest, "invalid revertAfter: "+req.RevertAfter)
+			return
+		}
+	}
+
+	setLogLevel(level, revertAfter)
+	writeJSON(w, http.StatusOK, currentLogLevel())
+}
+
+func currentLogLevel() logLevelResponse {
+	response := logLevelResponse{Level: strings.ToLower(logLevel.Level().String())}
+	if revertAt := revertLogLevelAt(); !revertAt.IsZero() {
+		response.RevertAt = &revertAt
+	}
+	return response
+}
@@ -0,0 +1,241 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/sns"
+	snstypes "github.com/aws/aws-sdk-go-v2/service/sns/types"
+	"github.com/aws/aws-sdk-go-v2/service/sqs"
+	sqstypes "github.com/aws/aws-sdk-go-v2/service/sqs/types"
+)
+
+var integrityFailures = NewCounterVec(
+	"orchestrator_integrity_failures_total",
+	"Messages rejected by the integrity Lambda or whose check failed.",
+)
+
+// Alert types, also used as the deduplication key
+const (
+	alertNoHealthyLambdas    = "no_healthy_lambdas"
+	alertRegistryUnavailable = "registry_unavailable"
+	alertDLQBacklog          = "dlq_backlog"
+	alertIntegritySpike      = "integrity_failure_spike"
+	alertLatencySLO          = "latency_slo_breach"
+	alertBudgetExceeded      = "budget_exceeded"
+	alertIntegrityBypass     = "integrity_bypass"
+)
+
+type AlertSeverity string
+
+const (
+	SeverityCritical AlertSeverity = "critical"
+	SeverityWarning  AlertSeverity = "warning"
+)
+
+type Alert struct {
+	Type       string         `json:"type"`
+	Severity   AlertSeverity  `json:"severity"`
+	Summary    string         `json:"summary"`
+	Details    map[string]any `json:"details,omitempty"`
+	InstanceID string         `json:"instanceId"`
+	Timestamp  time.Time      `json:"timestamp"`
+	Suppressed int            `json:"suppressedSinceLast"`
+}
+
+// SNSAlerter publishes alerts to an SNS topic, sending each alert type at
+// most once per cooldown and counting the ones it suppressed in between
+type SNSAlerter struct {
+	client     *sns.Client
+	topicARN   string
+	instanceID string
+	cooldown   time.Duration
+
+	mu         sync.Mutex
+	lastSent   map[string]time.Time
+	suppressed map[string]int
+}
+
+func NewSNSAlerter(topicARN string, cfg aws.Config, instanceID string, cooldown time.Duration) *SNSAlerter {
+	return &SNSAlerter{
+		client:     sns.NewFromConfig(cfg),
+		topicARN:   topicARN,
+		instanceID: instanceID,
+		cooldown:   cooldown,
+		lastSent:   make(map[string]time.Time),
+		suppressed: make(map[string]int),
+	}
+}
+
+// SetCooldown changes the per-type cooldown, e.g. on configuration reload
+func (a *SNSAlerter) SetCooldown(cooldown time.Duration) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.cooldown = cooldown
+}
+
+// Alert publishes the alert unless the same type was sent within the
+// cooldown. It is a no-op on a nil alerter.
+func (a *SNSAlerter) Alert(ctx context.Context, alert Alert) {
+	if a == nil {
+		return
+	}
+
+	a.mu.Lock()
+	if last, ok := a.lastSent[alert.Type]; ok && time.Since(last) < a.cooldown {
+		a.suppressed[alert.Type]++
+		a.mu.Unlock()
+		return
+	}
+	alert.Suppressed = a.suppressed[alert.Type]
+	a.lastSent[alert.Type] = time.Now()
+	a.suppressed[alert.Type] = 0
+	a.mu.Unlock()
+
+	alert.InstanceID = a.instanceID
+	alert.Timestamp = time.Now()
+
+	if err := a.publish(ctx, alert); err != nil {
+		slog.Error("Error publishing alert", "alert", alert.Type, errAttr(err))
+		return
+	}
+	slog.Warn("Alert published", "alert", alert.Type, "severity", alert.Severity, "summary", alert.Summary)
+}
+
+func (a *SNSAlerter) publish(ctx context.Context, alert Alert) error {
+	body, err := json.Marshal(alert)
+	if err != nil {
+		return fmt.Errorf("error marshaling alert: %w", err)
+	}
+
+	// SNS subjects are limited to 100 characters
+	subject := fmt.Sprintf("[%s] %s", alert.Severity, alert.Summary)
+	if len(subject) > 100 {
+		subject = subject[:100]
+	}
+
+	_, err = a.client.Publish(ctx, &sns.PublishInput{
+		TopicArn: aws.String(a.topicARN),
+		Subject:  aws.String(subject),
+		Message:  aws.String(string(body)),
+		MessageAttributes: map[string]snstypes.MessageAttributeValue{
+			"severity":  {DataType: aws.String("String"), StringValue: aws.String(string(alert.Severity))},
+			"alertType": {DataType: aws.String("String"), StringValue: aws.String(alert.Type)},
+		},
+	})
+	if err != nil {
+		return fmt.Errorf("error publishing to %s: %w", a.topicARN, err)
+	}
+	return nil
+}
+
+// AlertMonitor periodically checks the dead-letter queue depth, the rate
+// of integrity failures and the latency of the workers. The DLQ is shared,
+// so CheckDLQ runs on one replica; the failures and latencies are counted
+// by each replica, so CheckReplica runs on all of them.
+type AlertMonitor struct {
+	alerter            *SNSAlerter
+	sqsClient          QueueAttributesGetter
+	consumer           *SQSConsumer
+	dlqURL             string // empty disables the DLQ check
+	dlqThreshold       int64
+	integrityThreshold float64       // failures between checks, 0 disables the check
+	latencySLO         time.Duration // p99 of each worker, 0 disables the check
+
+	lastIntegrity float64
+	lastCheck     time.Time
+}
+
+func NewAlertMonitor(alerter *SNSAlerter, consumer *SQSConsumer, dlqURL string, dlqThreshold int64, integrityThreshold float64, latencySLO time.Duration) *AlertMonitor {
+	return &AlertMonitor{
+		alerter:            alerter,
+		sqsClient:          consumer.sqsClient,
+		consumer:           consumer,
+		dlqURL:             dlqURL,
+		dlqThreshold:       dlqThreshold,
+		integrityThreshold: integrityThreshold,
+		latencySLO:         latencySLO,
+		lastIntegrity:      integrityFailures.Value(),
+		lastCheck:          time.Now(),
+	}
+}
+
+// CheckReplica runs the checks of the integrity failures and latencies of
+// this replica once
+func (m *AlertMonitor) CheckReplica(ctx context.Context) error {
+	m.checkIntegrity(ctx)
+	m.checkLatency(ctx)
+	return nil
+}
+
+// CheckDLQ checks the depth of the dead-letter queue once
+func (m *AlertMonitor) CheckDLQ(ctx context.Context) error {
+	if m.dlqURL == "" {
+		return nil
+	}
+
+	result, err := m.sqsClient.GetQueueAttributes(ctx, &sqs.GetQueueAttributesInput{
+		QueueUrl:       aws.String(m.dlqURL),
+		AttributeNames: []sqstypes.QueueAttributeName{sqstypes.QueueAttributeNameApproximateNumberOfMessages},
+	})
+	if err != nil {
+		return fmt.Errorf("error reading DLQ depth of %s: %w", m.dlqURL, err)
+	}
+
+	depth, _ := strconv.ParseInt(result.Attributes[string(sqstypes.QueueAttributeNameApproximateNumberOfMessages)], 10, 64)
+	if depth >= m.dlqThreshold {
+		m.alerter.Alert(ctx, Alert{
+			Type:     alertDLQBacklog,
+			Severity: SeverityCritical,
+			Summary:  fmt.Sprintf("Dead-letter queue has %d messages", depth),
+			Details:  map[string]any{"queueUrl": m.dlqURL, "depth": depth, "threshold": m.dlqThreshold},
+		})
+	}
+	return nil
+}
+
+func (m *AlertMonitor) checkIntegrity(ctx context.Context) {
+	current := integrityFailures.Value()
+	failures := current - m.lastIntegrity
+	window := time.Since(m.lastCheck).Round(time.Second)
+	m.lastIntegrity = current
+	m.lastCheck = time.Now()
+
+	if m.integrityThreshold > 0 && failures >= m.integrityThreshold {
+		m.alerter.Alert(ctx, Alert{
+			Type:     alertIntegritySpike,
+			Severity: SeverityWarning,
+			Summary:  fmt.Sprintf("%.0f integrity failures in %s", failures, window),
+			Details:  map[string]any{"failures": failures, "threshold": m.integrityThreshold, "window": window.String()},
+		})
+	}
+}
+
+// checkLatency alerts once for every worker whose p99 is over the SLO
+func (m *AlertMonitor) checkLatency(ctx context.Context) {
+	if m.latencySLO <= 0 {
+		return
+	}
+	slo := milliseconds(m.latencySLO)
+	breaches := make(map[string]float64)
+	for arn, stats := range m.consumer.RoutingStats() {
+		if stats.Samples >= latencyMinSamples && stats.P99Ms > slo {
+			breaches[arn] = stats.P99Ms
+		}
+	}
+	if len(breaches) == 0 {
+		return
+	}
+	m.alerter.Alert(ctx, Alert{
+		Type:     alertLatencySLO,
+		Severity: SeverityWarning,
+		Summary:  fmt.Sprintf("%d workers over the p99 latency SLO of %s", len(breaches), m.latencySLO),
+		Details:  map[string]any{"p99Ms": breaches, "sloMs": slo},
+	})
+}
@@ -0,0 +1,255 @@
+package main
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"path"
+	"time"
+	"unicode/utf8"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+)
+
+// Outcomes recorded in the archive
+const (
+	archiveProcessed   = "processed"
+	archiveFailed      = "failed"
+	archiveUnparseable = "unparseable"
+	archiveQuarantined = "quarantined"
+)
+
+// archiveRetries is how many times a batch upload is attempted before it is
+// kept for the next flush
+const archiveRetries = 3
+
+// archiveMaxPending bounds the failed batches kept in memory for retry
+const archiveMaxPending = 20
+
+var archivedMessages = NewCounterVec(
+	"orchestrator_archived_messages_total",
+	"Messages written to the S3 archive, by result (success, dropped).",
+	"result",
+)
+
+// ArchiveRecord is one line of an archive object
+type ArchiveRecord struct {
+	MessageID     string            `json:"messageId"`
+	CorrelationID string            `json:"correlationId,omitempty"`
+	Source        string            `json:"source"`
+	InstanceID    string            `json:"instanceId"`
+	Attempt       string            `json:"attempt,omitempty"`
+	Attributes    map[string]string `json:"attributes,omitempty"`
+	// Body is the raw payload, base64-encoded when it is not valid UTF-8
+	Body         string    `json:"body"`
+	BodyEncoding string    `json:"bodyEncoding,omitempty"`
+	Outcome      string    `json:"outcome"`
+	LambdaARN    string    `json:"lambdaArn,omitempty"`
+	Error        string    `json:"error,omitempty"`
+	DurationMs   int64     `json:"durationMs"`
+	Timestamp    time.Time `json:"timestamp"`
+}
+
+// ArchiveOptions configures the S3 archiver
+type ArchiveOptions struct {
+	Bucket string
+	Prefix string
+	// A batch is written once it has BatchSize records or FlushInterval
+	// passed since its first record
+	BatchSize     int
+	FlushInterval time.Duration
+}
+
+// S3Archiver writes every processed message to S3 as gzip-compressed JSON
+// lines under <prefix>/year=/month=/day=/hour=, partitioned by processing
+// time in UTC. Archiving never blocks processing: records are dropped when
+// the buffer is full, and batches that cannot be written are retried on the
+// next flush. Retention is left to a lifecycle rule on the bucket. A nil
+// *S3Archiver archives nothing.
+type S3Archiver struct {
+	client     *s3.Client
+	instanceID string
+	opts       ArchiveOptions
+	records    chan ArchiveRecord
+	done       chan struct{}
+
+	// Only used by Start
+	sequence uint64
+	pending  [][]ArchiveRecord // failed batches, oldest first
+}
+
+func NewS3Archiver(cfg aws.Config, instanceID string, opts ArchiveOptions) *S3Archiver {
+	return &S3Archiver{
+		client: s3.NewFromConfig(cfg, func(o *s3.Options) {
+			if endpoint := awsEndpoint("S3"); endpoint != "" {
+				o.BaseEndpoint = aws.String(endpoint)
+				o.UsePathStyle = true
+			}
+		}),
+		instanceID: instanceID,
+		opts:       opts,
+		records:    make(chan ArchiveRecord, 10*opts.BatchSize),
+		done:       make(chan struct{}),
+	}
+}
+
+// Archive queues the record of a message, stamping it with the message in
+// ctx
+func (a *S3Archiver) Archive(ctx context.Context, record ArchiveRecord) {
+	if a == nil {
+		return
+	}
+
+	record.MessageID = messageIDFrom(ctx)
+	record.CorrelationID = correlationIDFrom(ctx)
+	record.InstanceID = a.instanceID
+	record.Timestamp = time.Now().UTC()
+
+	select {
+	case a.records <- record:
+	default:
+		archivedMessages.Inc("dropped")
+		slog.Error("Archive buffer full, dropping record", "message_id", record.MessageID)
+	}
+}
+
+// Start writes batches until ctx is done, then writes what is left
+func (a *S3Archiver) Start(ctx context.Context) {
+	defer close(a.done)
+	slog.Info("Starting message archive", "bucket", a.opts.Bucket, "prefix", a.opts.Prefix)
+
+	var batch []ArchiveRecord
+	timer := time.NewTimer(a.opts.FlushInterval)
+	timer.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+		drain:
+			for {
+				select {
+				case record := <-a.records:
+					batch = append(batch, record)
+				default:
+					break drain
+				}
+			}
+			// The process is shutting down, give the last uploads their own
+			// deadline
+			flushCtx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+			a.flush(flushCtx, batch)
+			cancel()
+			return
+		case record := <-a.records:
+			if len(batch) == 0 {
+				timer.Reset(a.opts.FlushInterval)
+			}
+			batch = append(batch, record)
+			if len(batch) < a.opts.BatchSize {
+				continue
+			}
+			timer.Stop()
+		case <-timer.C:
+		}
+		a.flush(ctx, batch)
+		batch = nil
+		if len(a.pending) > 0 {
+			timer.Reset(a.opts.FlushInterval)
+		}
+	}
+}
+
+// Wait blocks until Start has written the last batch
+func (a *S3Archiver) Wait() {
+	if a == nil {
+		return
+	}
+	<-a.done
+}
+
+// flush writes the batch after the pending ones, keeping whatever fails
+func (a *S3Archiver) flush(ctx context.Context, batch []ArchiveRecord) {
+	if len(batch) > 0 {
+		a.pending = append(a.pending, batch)
+	}
+
+	var failed [][]ArchiveRecord
+	for _, pending := range a.pending {
+		if err := a.write(ctx, pending); err != nil {
+			slog.Error("Error archiving messages, keeping the batch for the next flush",
+				"bucket", a.opts.Bucket, "records", len(pending), errAttr(err))
+			failed = append(failed, pending)
+			continue
+		}
+		archivedMessages.Add(float64(len(pending)), "success")
+	}
+
+	for len(failed) > archiveMaxPending {
+		archivedMessages.Add(float64(len(failed[0])), "dropped")
+		slog.Error("Too many failed archive batches, dropping the oldest", "records", len(failed[0]))
+		failed = failed[1:]
+	}
+	a.pending = failed
+}
+
+func (a *S3Archiver) write(ctx context.Context, batch []ArchiveRecord) error {
+	var buf bytes.Buffer
+	gz := gzip.NewWriter(&buf)
+	encoder := json.NewEncoder(gz)
+	for _, record := range batch {
+		if err := encoder.Encode(record); err != nil {
+			return fmt.Errorf("error encoding archive record: %w", err)
+		}
+	}
+	if err := gz.Close(); err != nil {
+		return fmt.Errorf("error compressing archive batch: %w", err)
+	}
+
+	key := a.objectKey(batch[0].Timestamp)
+	var err error
+	for attempt := 1; attempt <= archiveRetries; attempt++ {
+		_, err = a.client.PutObject(ctx, &s3.PutObjectInput{
+			Bucket:          aws.String(a.opts.Bucket),
+			Key:             aws.String(key),
+			Body:            bytes.NewReader(buf.Bytes()),
+			ContentType:     aws.String("application/x-ndjson"),
+			ContentEncoding: aws.String("gzip"),
+		})
+		if err == nil {
+			return nil
+		}
+		if attempt < archiveRetries && sleepContext(ctx, time.Duration(attempt)*time.Second) != nil {
+			break
+		}
+	}
+	return fmt.Errorf("error writing s3://%s/%s: %w", a.opts.Bucket, key, err)
+}
+
+// objectKey partitions by the time of the first record; the instance ID and
+// sequence keep keys unique across replicas
+func (a *S3Archiver) objectKey(at time.Time) string {
+	a.sequence++
+	name := fmt.Sprintf("%s-%d-%d.jsonl.gz", a.instanceID, at.UnixNano(), a.sequence)
+	return path.Join(a.opts.Prefix, at.Format("year=2006/month=01/day=02/hour=15"), name)
+}
+
+// CheckBucket verifies the bucket is reachable with the current credentials
+func (a *S3Archiver) CheckBucket(ctx context.Context) error {
+	_, err := a.client.HeadBucket(ctx, &s3.HeadBucketInput{Bucket: aws.String(a.opts.Bucket)})
+	if err != nil {
+		return fmt.Errorf("error reaching bucket %s: %w", a.opts.Bucket, err)
+	}
+	return nil
+}
+
+// archiveBody stores the payload as text when possible
+func archiveBody(body []byte) (string, string) {
+	if utf8.Valid(body) {
+		return string(body), ""
+	}
+	return base64.StdEncoding.EncodeToString(body), "base64"
+}
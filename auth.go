@@ -0,0 +1,265 @@
+package main
+
+import (
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"path"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"challenge-4-orchestrator/config"
+)
+
+// iamTokenHeader carries a base64url-encoded presigned sts:GetCallerIdentity
+// URL, as produced by `aws sts get-caller-identity` signing helpers
+const iamTokenHeader = "X-Aws-Iam-Token"
+
+// iamServerIDHeader must be signed into the presigned request with the
+// server ID (server.adminIamServerId), so a token made for another service
+// is rejected here. The server sends it on the STS call.
+const iamServerIDHeader = "X-Orchestrator-Server-Id"
+
+// maxIAMTokenExpiry bounds X-Amz-Expires, how long a captured token can be
+// replayed
+const maxIAMTokenExpiry = 5 * time.Minute
+
+var (
+	errNoCredentials  = errors.New("no credentials")
+	errNotAuthorized  = errors.New("principal not authorized")
+	stsHostPattern    = regexp.MustCompile(`^sts(\.[a-z0-9-]+)?\.amazonaws\.com(\.cn)?$`)
+	stsRequestTimeout = 5 * time.Second
+)
+
+// Authenticator verifies a request and returns the caller identity
+type Authenticator interface {
+	Authenticate(r *http.Request) (string, error)
+}
+
+// APIKeyAuth accepts the key as "Authorization: Bearer <key>" or "X-API-Key".
+// The key can be rotated while serving.
+type APIKeyAuth struct {
+	key atomic.Pointer[string]
+}
+
+func NewAPIKeyAuth(key string) *APIKeyAuth {
+	a := &APIKeyAuth{}
+	a.SetKey(key)
+	return a
+}
+
+func (a *APIKeyAuth) SetKey(key string) {
+	a.key.Store(&key)
+}
+
+func (a *APIKeyAuth) Authenticate(r *http.Request) (string, error) {
+	key := r.Header.Get("X-API-Key")
+	if key == "" {
+		key = strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+	}
+	if key == "" {
+		return "", errNoCredentials
+	}
+
+	if subtle.ConstantTimeCompare([]byte(key), []byte(*a.key.Load())) != 1 {
+		return "", errors.New("invalid API key")
+	}
+	return "api-key", nil
+}
+
+// IAMAuth verifies SigV4 credentials without sharing secrets: the caller
+// presigns sts:GetCallerIdentity and the server executes it, trusting the ARN
+// STS returns. Allowed principals are ARN patterns matched with path.Match.
+type IAMAuth struct {
+	allowed  []string
+	serverID string
+	client   *http.Client
+}
+
+func NewIAMAuth(allowed []string, serverID string) *IAMAuth {
+	return &IAMAuth{
+		allowed:  allowed,
+		serverID: serverID,
+		client:   &http.Client{Timeout: stsRequestTimeout},
+	}
+}
+
+func (a *IAMAuth) Authenticate(r *http.Request) (string, error) {
+	token := r.Header.Get(iamTokenHeader)
+	if token == "" {
+		return "", errNoCredentials
+	}
+
+	presigned, err := parseIAMToken(token)
+	if err != nil {
+		return "", err
+	}
+
+	req, err := http.NewRequestWithContext(r.Context(), http.MethodGet, presigned.String(), nil)
+	if err != nil {
+		return "", fmt.Errorf("error building STS request: %w", err)
+	}
+	req.Header.Set("Accept", "application/json")
+	// Signed by the caller: STS rejects the signature unless the caller
+	// signed this server's ID
+	req.Header.Set(iamServerIDHeader, a.serverID)
+
+	resp, err := a.client.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("error calling STS: %w", err)
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(io.LimitReader(resp.Body, 64*1024))
+	if err != nil {
+		return "", fmt.Errorf("error reading STS response: %w", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("STS rejected the signature: %s", resp.Status)
+	}
+
+	var identity struct {
+		GetCallerIdentityResponse struct {
+			GetCallerIdentityResult struct {
+				Arn string
+			}
+		}
+	}
+	if err := json.Unmarshal(body, &identity); err != nil {
+		return "", fmt.Errorf("error decoding STS response: %w", err)
+	}
+
+	arn := identity.GetCallerIdentityResponse.GetCallerIdentityResult.Arn
+	for _, pattern := range a.allowed {
+		if ok, _ := path.Match(pattern, arn); ok {
+			return arn, nil
+		}
+	}
+	return "", fmt.Errorf("%w: %s", errNotAuthorized, arn)
+}
+
+// parseIAMToken only accepts short-lived presigned GetCallerIdentity calls to
+// STS that sign the server ID header, so the server cannot be used to issue
+// arbitrary signed requests nor accept tokens made for another service
+func parseIAMToken(token string) (*url.URL, error) {
+	raw, err := base64.RawURLEncoding.DecodeString(strings.TrimRight(token, "="))
+	if err != nil {
+		return nil, fmt.Errorf("invalid IAM token encoding: %w", err)
+	}
+
+	presigned, err := url.Parse(string(raw))
+	if err != nil {
+		return nil, fmt.Errorf("invalid IAM token URL: %w", err)
+	}
+	if presigned.Scheme != "https" || !stsHostPattern.MatchString(presigned.Hostname()) {
+		return nil, fmt.Errorf("IAM token does not target STS: %s", presigned.Host)
+	}
+
+	query := presigned.Query()
+	if query.Get("Action") != "GetCallerIdentity" || query.Get("X-Amz-Signature") == "" {
+		return nil, errors.New("IAM token is not a presigned GetCallerIdentity request")
+	}
+	expires, err := strconv.Atoi(query.Get("X-Amz-Expires"))
+	if err != nil || expires <= 0 || time.Duration(expires)*time.Second > maxIAMTokenExpiry {
+		return nil, fmt.Errorf("IAM token X-Amz-Expires must be between 1 and %d seconds", int(maxIAMTokenExpiry.Seconds()))
+	}
+	signed := strings.Split(query.Get("X-Amz-SignedHeaders"), ";")
+	if !slices.Contains(signed, strings.ToLower(iamServerIDHeader)) {
+		return nil, fmt.Errorf("IAM token does not sign the %s header", iamServerIDHeader)
+	}
+	return presigned, nil
+}
+
+// anyAuth accepts the request when one of the authenticators does
+type anyAuth []Authenticator
+
+func (a anyAuth) Authenticate(r *http.Request) (string, error) {
+	var errs []error
+	for _, auth := range a {
+		principal, err := auth.Authenticate(r)
+		if err == nil {
+			return principal, nil
+		}
+		if !errors.Is(err, errNoCredentials) {
+			errs = append(errs, err)
+		}
+	}
+	if len(errs) == 0 {
+		return "", errNoCredentials
+	}
+	return "", errors.Join(errs...)
+}
+
+// requireAuth rejects unauthenticated requests with 401 and unauthorized
+// principals with 403
+func requireAuth(auth Authenticator, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		principal, err := auth.Authenticate(r)
+		if err != nil {
+			slog.Warn("Admin: authentication failed", "path", r.URL.Path, "remote_addr", r.RemoteAddr, errAttr(err))
+			if errors.Is(err, errNotAuthorized) {
+				writeError(w, http.StatusForbidden, "forbidden")
+				return
+			}
+			writeError(w, http.StatusUnauthorized, "unauthorized")
+			return
+		}
+
+		slog.Debug("Admin: request authenticated", "path", r.URL.Path, "principal", principal)
+		next.ServeHTTP(w, r)
+	})
+}
+
+// AdminAuth holds the authenticator of each endpoint group; a nil entry
+// leaves the group unmounted
+type AdminAuth map[string]Authenticator
+
+// adminAuthFromConfig builds the per-group authenticators. AdminAuth lists
+// the methods ("apikey", "iam") accepted by each group and defaults to every
+// configured method. It returns nil when no method is configured, and the
+// API key authenticator, if any, so the key can be rotated.
+func adminAuthFromConfig(cfg config.ServerConfig) (AdminAuth, *APIKeyAuth, error) {
+	methods := map[string]Authenticator{}
+	var apiKey *APIKeyAuth
+	if cfg.AdminAPIKey != "" {
+		apiKey = NewAPIKeyAuth(cfg.AdminAPIKey)
+		methods["apikey"] = apiKey
+	}
+	if len(cfg.AdminIAMPrincipals) > 0 {
+		methods["iam"] = NewIAMAuth(cfg.AdminIAMPrincipals, cfg.AdminIAMServerID)
+	}
+	if len(methods) == 0 {
+		return nil, nil, nil
+	}
+
+	auth := AdminAuth{}
+	for _, group := range []string{config.AuthGroupRegistry, config.AuthGroupOperations, config.AuthGroupDebug, config.AuthGroupProcess} {
+		names := cfg.AdminAuth[group]
+		if len(names) == 0 {
+			for name := range methods {
+				names = append(names, name)
+			}
+		}
+
+		var chain anyAuth
+		for _, name := range names {
+			method, ok := methods[name]
+			if !ok {
+				return nil, nil, fmt.Errorf("auth method %q for group %s is unknown or not configured", name, group)
+			}
+			chain = append(chain, method)
+		}
+		auth[group] = chain
+	}
+	return auth, apiKey, nil
+}
@@ -0,0 +1,29 @@
+package main
+
+import (
+	"encoding/base64"
+	"testing"
+)
+
+func TestParseIAMTokenRequiresServerIDAndShortExpiry(t *testing.T) {
+	const base = "https://sts.amazonaws.com/?Action=GetCallerIdentity&Version=2011-06-15&X-Amz-Signature=abc"
+	tests := []struct {
+		name  string
+		query string
+		valid bool
+	}{
+		{"signed server ID", "&X-Amz-Expires=60&X-Amz-SignedHeaders=host%3Bx-orchestrator-server-id", true},
+		{"server ID not signed", "&X-Amz-Expires=60&X-Amz-SignedHeaders=host", false},
+		{"expiry too long", "&X-Amz-Expires=3600&X-Amz-SignedHeaders=host%3Bx-orchestrator-server-id", false},
+		{"no expiry", "&X-Amz-SignedHeaders=host%3Bx-orchestrator-server-id", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			token := base64.RawURLEncoding.EncodeToString([]byte(base + tt.query))
+			_, err := parseIAMToken(token)
+			if (err == nil) != tt.valid {
+				t.Fatalf("parseIAMToken error = %v, want valid %v", err, tt.valid)
+			}
+		})
+	}
+}
@@ -0,0 +1,33 @@
+package main
+
+import (
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/credentials/stscreds"
+	"github.com/aws/aws-sdk-go-v2/service/sts"
+)
+
+// roleSessionName identifies the orchestrator in the target account's
+// CloudTrail
+const roleSessionName = "orchestrator"
+
+// withAssumedRole returns a copy of cfg that assumes roleARN, e.g. in the
+// account that owns the registry table or the worker Lambdas. An empty
+// roleARN keeps the base credentials.
+func withAssumedRole(cfg aws.Config, roleARN, externalID string) aws.Config {
+	if roleARN == "" {
+		return cfg
+	}
+
+	// The base credentials sign the AssumeRole calls; the cache refreshes
+	// the temporary credentials before they expire
+	provider := stscreds.NewAssumeRoleProvider(sts.NewFromConfig(cfg), roleARN, func(p *stscreds.AssumeRoleOptions) {
+		p.RoleSessionName = roleSessionName
+		if externalID != "" {
+			p.ExternalID = aws.String(externalID)
+		}
+	})
+
+	assumed := cfg.Copy()
+	assumed.Credentials = aws.NewCredentialsCache(provider)
+	return assumed
+}
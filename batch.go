@@ -0,0 +1,217 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"slices"
+	"strconv"
+	"sync"
+	"time"
+)
+
+var lambdaBatchSize = NewHistogramVec(
+	"orchestrator_lambda_batch_size",
+	"Messages aggregated into each worker invocation, by worker.",
+	[]float64{1, 2, 5, 10, 25, 50, 100},
+	"lambda_arn",
+)
+
+// batchRequest is the payload of a batched invocation
+type batchRequest struct {
+	Records []batchRecord `json:"records"`
+}
+
+type batchRecord struct {
+	ID      string `json:"id"`
+	Payload any    `json:"payload"`
+}
+
+// batchResponse is what a worker returns for a batch. As with the partial
+// batch responses of the SQS event source, the items not listed in
+// batchItemFailures succeeded; results optionally carries their responses.
+type batchResponse struct {
+	Results []struct {
+		ID       string          `json:"id"`
+		Response json.RawMessage `json:"response"`
+	} `json:"results"`
+	BatchItemFailures []struct {
+		ItemIdentifier string `json:"itemIdentifier"`
+		Error          string `json:"error"`
+	} `json:"batchItemFailures"`
+}
+
+type batchResult struct {
+	body []byte
+	err  error
+}
+
+type batchItem struct {
+	ctx         context.Context
+	id          string
+	messageType string // for the cost estimate
+	payload     any
+	done        chan batchResult
+}
+
+// pendingBatch collects the items for a worker until it is full or its
+// window ends
+type pendingBatch struct {
+	worker Lambda
+	items  []*batchItem
+	timer  *time.Timer
+}
+
+// Batcher aggregates the invocations of a worker into one, of up to size
+// messages or those arriving within window of the first, as
+// {"records": [{"id": ..., "payload": ...}]}. Each message gets its own
+// result from the batch response, so it is deleted or retried on its own;
+// a failed invocation fails every message of the batch. A batch takes one
+// token of the maxRate of its worker, and leaves out the messages whose
+// caller gave up before it was sent.
+type Batcher struct {
+	invoke func(ctx context.Context, worker Lambda, payload any) ([]byte, error)
+	costs  *CostTracker
+	rates  *WorkerRateLimits
+	size   int
+	window time.Duration
+
+	mu      sync.Mutex
+	pending map[string]*pendingBatch // by worker ARN
+}
+
+func NewBatcher(invoker Invoker, costs *CostTracker, size int, window time.Duration) *Batcher {
+	return &Batcher{
+		invoke:  invoker.InvokeWorker,
+		costs:   costs,
+		size:    size,
+		window:  window,
+		pending: make(map[string]*pendingBatch),
+	}
+}
+
+// SetRateLimits sets the maxRate limits of the workers
+func (b *Batcher) SetRateLimits(rates *WorkerRateLimits) {
+	b.rates = rates
+}
+
+type batchableKey struct{}
+
+// withBatchable marks messages processed concurrently with others, whose
+// invocations can be aggregated; a message processed alone would only wait
+// for the window
+func withBatchable(ctx context.Context) context.Context {
+	return context.WithValue(ctx, batchableKey{}, true)
+}
+
+func batchable(ctx context.Context) bool {
+	ok, _ := ctx.Value(batchableKey{}).(bool)
+	return ok
+}
+
+// Invoke adds the payload to the pending batch of the worker and waits for
+// its result
+func (b *Batcher) Invoke(ctx context.Context, worker Lambda, messageType string, payload any) ([]byte, error) {
+	item := &batchItem{ctx: ctx, id: messageIDFrom(ctx), messageType: messageType, payload: payload, done: make(chan batchResult, 1)}
+
+	b.mu.Lock()
+	batch := b.pending[worker.ARN]
+	if batch == nil {
+		batch = &pendingBatch{worker: worker}
+		b.pending[worker.ARN] = batch
+		batch.timer = time.AfterFunc(b.window, func() { b.flush(batch) })
+	}
+	batch.items = append(batch.items, item)
+	full := len(batch.items) >= b.size
+	if full {
+		delete(b.pending, worker.ARN)
+		batch.timer.Stop()
+	}
+	b.mu.Unlock()
+	if full {
+		go b.send(batch)
+	}
+
+	select {
+	case result := <-item.done:
+		return result.body, result.err
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+// flush sends a batch whose window ended, unless it was sent full
+func (b *Batcher) flush(batch *pendingBatch) {
+	b.mu.Lock()
+	if b.pending[batch.worker.ARN] != batch {
+		b.mu.Unlock()
+		return
+	}
+	delete(b.pending, batch.worker.ARN)
+	b.mu.Unlock()
+	b.send(batch)
+}
+
+func (b *Batcher) send(batch *pendingBatch) {
+	// The batch carries the trace of its first message, and is not cancelled
+	// with it
+	ctx := context.WithoutCancel(batch.items[0].ctx)
+	if err := b.rates.Wait(ctx, batch.worker); err != nil {
+		for _, item := range batch.items {
+			item.done <- batchResult{err: err}
+		}
+		return
+	}
+
+	// Callers that gave up already returned; their messages are delivered
+	// again, so invoking them would process them twice
+	batch.items = slices.DeleteFunc(batch.items, func(item *batchItem) bool { return item.ctx.Err() != nil })
+	if len(batch.items) == 0 {
+		return
+	}
+
+	request := batchRequest{Records: make([]batchRecord, 0, len(batch.items))}
+	seen := make(map[string]bool, len(batch.items))
+	for i, item := range batch.items {
+		// The IDs key the results, so they must be unique in the batch
+		if item.id == "" || seen[item.id] {
+			item.id = "#" + strconv.Itoa(i)
+		}
+		seen[item.id] = true
+		request.Records = append(request.Records, batchRecord{ID: item.id, Payload: item.payload})
+	}
+	lambdaBatchSize.Observe(float64(len(batch.items)), batch.worker.ARN)
+
+	started := time.Now()
+	body, err := b.invoke(ctx, batch.worker, request)
+	for _, item := range batch.items {
+		b.costs.Record(ctx, batch.worker, item.messageType, time.Since(started), len(batch.items), err)
+	}
+	var response batchResponse
+	if err == nil {
+		if err = json.Unmarshal(body, &response); err != nil {
+			err = fmt.Errorf("error parsing batch response of %s: %w", batch.worker.ARN, err)
+		}
+	}
+	if err != nil {
+		for _, item := range batch.items {
+			item.done <- batchResult{err: err}
+		}
+		return
+	}
+
+	results := make(map[string]batchResult, len(batch.items))
+	for _, result := range response.Results {
+		results[result.ID] = batchResult{body: result.Response}
+	}
+	for _, failure := range response.BatchItemFailures {
+		err := ErrBatchItemFailed
+		if failure.Error != "" {
+			err = fmt.Errorf("%w: %s", ErrBatchItemFailed, failure.Error)
+		}
+		results[failure.ItemIdentifier] = batchResult{err: err}
+	}
+	for _, item := range batch.items {
+		item.done <- results[item.id]
+	}
+}
@@ -0,0 +1,139 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"slices"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+// budgetPollDelayReason keys the poll delay of the spend guard
+const budgetPollDelayReason = "budget"
+
+var (
+	budgetExceededGauge = NewGaugeVec(
+		"orchestrator_budget_exceeded",
+		"1 while the estimated spend or the invocations of this replica are over a budget.",
+	)
+	budgetDeferred = NewCounterVec(
+		"orchestrator_budget_deferred_total",
+		"Messages of non-critical types deferred while over a budget, by message type.",
+		"message_type",
+	)
+)
+
+// BudgetOptions caps the estimated spend and the invocations of the replica
+// per hour and per day; 0 disables a cap
+type BudgetOptions struct {
+	HourlyUSD         float64
+	DailyUSD          float64
+	HourlyInvocations float64
+	DailyInvocations  float64
+	// CriticalTypes are still processed while over a budget; when set, the
+	// other types are left in the source instead of only polling slower
+	CriticalTypes []string
+	// PollDelay is waited before each fetch while over a budget
+	PollDelay time.Duration
+	// CheckInterval is how often the budgets are checked, and how long a
+	// deferred message waits to be delivered again
+	CheckInterval time.Duration
+}
+
+// SpendGuard compares the spend estimated by the CostTracker with the
+// budgets. While one is exceeded it slows the polling, defers the messages
+// of non-critical types and alerts, until the rolling window is back under
+// it. The budgets apply to each replica. A nil *SpendGuard does nothing.
+type SpendGuard struct {
+	costs    *CostTracker
+	alerter  *SNSAlerter
+	consumer *SQSConsumer
+	opts     BudgetOptions
+	exceeded atomic.Bool
+}
+
+func NewSpendGuard(costs *CostTracker, alerter *SNSAlerter, opts BudgetOptions) *SpendGuard {
+	return &SpendGuard{costs: costs, alerter: alerter, opts: opts}
+}
+
+// SetConsumer sets the consumer whose polling is slowed
+func (g *SpendGuard) SetConsumer(consumer *SQSConsumer) {
+	g.consumer = consumer
+}
+
+// Exceeded reports whether a budget is exceeded
+func (g *SpendGuard) Exceeded() bool {
+	return g != nil && g.exceeded.Load()
+}
+
+// Check compares the spend of the last hour and day with the budgets
+func (g *SpendGuard) Check(ctx context.Context) error {
+	hourUSD, hourInvocations := g.costs.Spend(time.Hour)
+	dayUSD, dayInvocations := g.costs.Spend(24 * time.Hour)
+
+	var exceeded []string
+	over := func(name string, value, budget float64, format string) {
+		if budget > 0 && value >= budget {
+			exceeded = append(exceeded, fmt.Sprintf("%s "+format+" of "+format, name, value, budget))
+		}
+	}
+	over("hourly spend", hourUSD, g.opts.HourlyUSD, "$%.2f")
+	over("daily spend", dayUSD, g.opts.DailyUSD, "$%.2f")
+	over("hourly invocations", hourInvocations, g.opts.HourlyInvocations, "%.0f")
+	over("daily invocations", dayInvocations, g.opts.DailyInvocations, "%.0f")
+
+	if len(exceeded) == 0 {
+		if g.exceeded.Swap(false) {
+			g.consumer.SetPollDelay(budgetPollDelayReason, 0)
+			budgetExceededGauge.Set(0)
+			slog.Info("Back under the budgets, polling at the normal rate", "hourly_usd", hourUSD, "daily_usd", dayUSD)
+		}
+		return nil
+	}
+
+	if !g.exceeded.Swap(true) {
+		g.consumer.SetPollDelay(budgetPollDelayReason, g.opts.PollDelay)
+		budgetExceededGauge.Set(1)
+		slog.Warn("Budget exceeded, slowing the polling", "exceeded", exceeded, "poll_delay", g.opts.PollDelay, "critical_types", g.opts.CriticalTypes)
+	}
+	// Raised on every check while over; the alerter cooldown spaces them
+	g.alerter.Alert(ctx, Alert{
+		Type:     alertBudgetExceeded,
+		Severity: SeverityWarning,
+		Summary:  "Budget exceeded: " + strings.Join(exceeded, ", "),
+		Details: map[string]any{
+			"hourlyUsd":         hourUSD,
+			"dailyUsd":          dayUSD,
+			"hourlyInvocations": hourInvocations,
+			"dailyInvocations":  dayInvocations,
+			"hourlyUsdBudget":   g.opts.HourlyUSD,
+			"dailyUsdBudget":    g.opts.DailyUSD,
+		},
+	})
+	return nil
+}
+
+// budgetMiddleware defers the messages of non-critical types while a budget
+// is exceeded: the source delivers them again after the next check, without
+// using a delivery attempt. Without critical types every message is
+// processed, only slower. A nil guard does nothing.
+func budgetMiddleware(guard *SpendGuard) Middleware {
+	if guard == nil || len(guard.opts.CriticalTypes) == 0 {
+		return func(next Handler) Handler { return next }
+	}
+	return func(next Handler) Handler {
+		return HandlerFunc(func(ctx context.Context, msg any) (*workerResponse, error) {
+			if guard.Exceeded() {
+				messageType := guard.costs.MessageType(msg)
+				if !slices.Contains(guard.opts.CriticalTypes, messageType) {
+					budgetDeferred.Inc(messageType)
+					loggerFrom(ctx).Debug("Budget exceeded, deferring the non-critical message", "message_type", messageType, "retry_after", guard.opts.CheckInterval)
+					return nil, &skipError{reason: "budget exceeded", retryAfter: guard.opts.CheckInterval}
+				}
+			}
+			return next.Handle(ctx, msg)
+		})
+	}
+}
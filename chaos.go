@@ -0,0 +1,102 @@
+package main
+
+import (
+	"context"
+	"log/slog"
+	"math/rand"
+	"net/http"
+	"time"
+
+	"challenge-4-orchestrator/config"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	awsmiddleware "github.com/aws/aws-sdk-go-v2/aws/middleware"
+	awshttp "github.com/aws/aws-sdk-go-v2/aws/transport/http"
+	"github.com/aws/smithy-go"
+	"github.com/aws/smithy-go/middleware"
+	smithyhttp "github.com/aws/smithy-go/transport/http"
+)
+
+// Faults injected by chaos mode
+const (
+	chaosLatency = "latency"
+	chaosError   = "error"
+)
+
+var chaosFaults = NewCounterVec(
+	"orchestrator_chaos_faults_total",
+	"Faults injected by chaos mode, by AWS service and fault (latency, error).",
+	"service", "fault",
+)
+
+// Chaos injects faults into the AWS calls of the orchestrator to exercise
+// its retries, failover and circuit breakers: random latency and errors on
+// Lambda invocations, and errors on DynamoDB calls. Injected errors are
+// HTTP 500 responses, which the failover treats as regional errors. They
+// are injected before the SDK retries, so the configured rates are the
+// rates the orchestrator sees. Only enabled with run -chaos.
+type Chaos struct {
+	config config.ChaosConfig
+}
+
+func NewChaos(settings config.ChaosConfig) *Chaos {
+	return &Chaos{config: settings}
+}
+
+// Apply adds the fault injection to every client created from cfg
+func (c *Chaos) Apply(cfg *aws.Config) {
+	cfg.APIOptions = append(cfg.APIOptions, func(stack *middleware.Stack) error {
+		// After the service metadata is registered and before the retries
+		return stack.Initialize.Add(middleware.InitializeMiddlewareFunc("ChaosInjection", c.inject), middleware.After)
+	})
+}
+
+func (c *Chaos) inject(ctx context.Context, in middleware.InitializeInput, next middleware.InitializeHandler) (middleware.InitializeOutput, middleware.Metadata, error) {
+	service := awsmiddleware.GetServiceID(ctx)
+	operation := awsmiddleware.GetOperationName(ctx)
+
+	errorRate := 0.0
+	switch {
+	case service == "Lambda" && operation == "Invoke":
+		if c.config.MaxLatency > 0 && rand.Float64() < c.config.LatencyRate {
+			delay := time.Duration(rand.Int63n(int64(c.config.MaxLatency)))
+			chaosFaults.Inc(service, chaosLatency)
+			slog.Warn("Chaos: delaying call", "chaos", true, "service", service, "operation", operation, "delay_ms", delay.Milliseconds())
+			if err := sleepContext(ctx, delay); err != nil {
+				return middleware.InitializeOutput{}, middleware.Metadata{}, err
+			}
+		}
+		errorRate = c.config.LambdaErrorRate
+	case service == "DynamoDB":
+		errorRate = c.config.DynamoDBErrorRate
+	}
+
+	if rand.Float64() < errorRate {
+		chaosFaults.Inc(service, chaosError)
+		slog.Warn("Chaos: failing call", "chaos", true, "service", service, "operation", operation)
+		return middleware.InitializeOutput{}, middleware.Metadata{}, chaosFault(service, operation)
+	}
+	return next.HandleInitialize(ctx, in)
+}
+
+// chaosFault builds the error the SDK returns for an HTTP 500 response
+func chaosFault(service, operation string) error {
+	return &smithy.OperationError{
+		ServiceID:     service,
+		OperationName: operation,
+		Err: &awshttp.ResponseError{
+			RequestID: "chaos",
+			ResponseError: &smithyhttp.ResponseError{
+				Response: &smithyhttp.Response{Response: &http.Response{
+					StatusCode: http.StatusInternalServerError,
+					Header:     http.Header{},
+				}},
+				Err: &smithy.GenericAPIError{
+					Code:    "ChaosInjectedFault",
+					Message: "chaos: injected fault",
+					Fault:   smithy.FaultServer,
+				},
+			},
+		},
+	}
+}
@@ -0,0 +1,106 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"runtime"
+	"strings"
+
+	"challenge-4-orchestrator/config"
+)
+
+type cliCommand struct {
+	name    string
+	summary string
+	run     func(args []string) error
+}
+
+func cliCommands() []cliCommand {
+	return []cliCommand{
+		{"run", "consume the queue and route messages (default)", runOrchestrator},
+		{"seed", "create the registry table and load Lambda entries from a file", runSeed},
+		{"registry", "list, export, import or edit registry entries", runRegistryCommand},
+		{"dlq", "list dead-lettered messages by failure type, or re-drive them", runDLQ},
+		{"replay", "send archived messages of a time range back to a queue", runReplay},
+		{"loadgen", "send synthetic messages to the queue to load-test the pipeline", runLoadgen},
+		{"simulate", "process messages from a file against in-memory fakes, without AWS", runSimulate},
+		{"validate-config", "load and validate the configuration, then exit", runValidateConfig},
+		{"version", "print the build version", runVersion},
+	}
+}
+
+// runCLI dispatches `orchestrator <command> [flags]`. Without a command, or
+// when the first argument is a flag, it runs the orchestrator so existing
+// deployments keep working.
+func runCLI(args []string) error {
+	if len(args) > 0 && isHelpArg(args[0]) {
+		printUsage()
+		return nil
+	}
+	if len(args) == 0 || strings.HasPrefix(args[0], "-") {
+		return runOrchestrator(args)
+	}
+
+	for _, command := range cliCommands() {
+		if command.name == args[0] {
+			return command.run(args[1:])
+		}
+	}
+
+	printUsage()
+	return fmt.Errorf("unknown command %q", args[0])
+}
+
+func isHelpArg(arg string) bool {
+	switch arg {
+	case "help", "-h", "-help", "--help":
+		return true
+	}
+	return false
+}
+
+func printUsage() {
+	fmt.Fprintln(os.Stderr, "Usage: orchestrator <command> [flags]")
+	fmt.Fprintln(os.Stderr)
+	fmt.Fprintln(os.Stderr, "Commands:")
+	for _, command := range cliCommands() {
+		fmt.Fprintf(os.Stderr, "  %-16s %s\n", command.name, command.summary)
+	}
+	fmt.Fprintln(os.Stderr)
+	fmt.Fprintln(os.Stderr, "Run 'orchestrator <command> -h' for the flags of a command.")
+}
+
+// runValidateConfig implements `orchestrator validate-config`
+func runValidateConfig(args []string) error {
+	flags := flag.NewFlagSet("validate-config", flag.ExitOnError)
+	configFile := flags.String("config", os.Getenv("CONFIG_FILE"), "YAML or JSON configuration file")
+	flags.Parse(args)
+
+	cfg, err := config.Load(*configFile, checkSettings)
+	if err != nil {
+		// One problem per line, so every fix can be made in one pass
+		fmt.Fprintln(os.Stderr, err)
+		return errors.New("configuration is invalid")
+	}
+
+	for _, line := range cfg.Summary() {
+		fmt.Println(line)
+	}
+	fmt.Println("configuration is valid")
+	return nil
+}
+
+// runVersion implements `orchestrator version`
+func runVersion(args []string) error {
+	fmt.Printf("orchestrator %s (commit %s, built %s, %s)\n", Version, orUnknown(Commit), orUnknown(BuildDate), runtime.Version())
+	return nil
+}
+
+func orUnknown(value string) string {
+	if value == "" {
+		return "unknown"
+	}
+	return value
+}
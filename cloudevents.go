@@ -0,0 +1,215 @@
+package main
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"mime"
+	"net/http"
+	"strings"
+	"time"
+
+	"go.opentelemetry.io/otel/propagation"
+)
+
+// cloudEventsSpecVersion is the only CloudEvents version accepted and emitted
+const cloudEventsSpecVersion = "1.0"
+
+var cloudEventsReceived = NewCounterVec(
+	"orchestrator_cloudevents_received_total",
+	"CloudEvents received, by content mode (binary, structured) or invalid.",
+	"mode",
+)
+
+// CloudEvent is the envelope of a CloudEvents 1.0 event in structured mode.
+// Extension attributes are ignored.
+type CloudEvent struct {
+	SpecVersion     string          `json:"specversion"`
+	ID              string          `json:"id"`
+	Source          string          `json:"source"`
+	Type            string          `json:"type"`
+	Subject         string          `json:"subject,omitempty"`
+	Time            string          `json:"time,omitempty"` // RFC 3339
+	DataContentType string          `json:"datacontenttype,omitempty"`
+	Data            json.RawMessage `json:"data,omitempty"`
+	DataBase64      string          `json:"data_base64,omitempty"`
+}
+
+// validate checks the required attributes
+func (e *CloudEvent) validate() error {
+	var missing []string
+	for _, attribute := range [][2]string{{"id", e.ID}, {"source", e.Source}, {"type", e.Type}} {
+		if attribute[1] == "" {
+			missing = append(missing, attribute[0])
+		}
+	}
+	switch {
+	case e.SpecVersion != cloudEventsSpecVersion:
+		return fmt.Errorf("unsupported CloudEvents specversion %q", e.SpecVersion)
+	case len(missing) > 0:
+		return fmt.Errorf("CloudEvent is missing required attributes: %s", strings.Join(missing, ", "))
+	}
+	if e.Time != "" {
+		if _, err := time.Parse(time.RFC3339Nano, e.Time); err != nil {
+			return fmt.Errorf("CloudEvent time %q is not RFC 3339", e.Time)
+		}
+	}
+	return nil
+}
+
+// CloudEventsOptions configures the CloudEvents support
+type CloudEventsOptions struct {
+	Accept bool // unwrap the CloudEvents received
+	Emit   bool // wrap the output queue messages and webhook notifications
+	Source string
+	// TypePrefix prefixes the types of the emitted events, e.g.
+	// orchestrator.response
+	TypePrefix string
+	// TypeField is the payload field with the message type; the type of a
+	// received event is copied there when the data has none, so handlers
+	// and workflows route on it
+	TypeField string
+}
+
+// CloudEvents unwraps the CloudEvents received in binary mode (ce-* message
+// attributes) or structured mode (a JSON envelope), and wraps the messages
+// the orchestrator sends. A nil *CloudEvents passes everything through.
+type CloudEvents struct {
+	opts CloudEventsOptions
+}
+
+func NewCloudEvents(opts CloudEventsOptions) *CloudEvents {
+	return &CloudEvents{opts: opts}
+}
+
+// Decode parses the body of a message. A CloudEvent is validated and
+// replaced by its data; other bodies are parsed as JSON. The event is nil
+// when the message is not one.
+func (c *CloudEvents) Decode(body []byte, headers propagation.TextMapCarrier) (any, *CloudEvent, error) {
+	accept := c != nil && c.opts.Accept
+	if accept && headers != nil && ceHeader(headers, "specversion") != "" {
+		event := &CloudEvent{
+			SpecVersion:     ceHeader(headers, "specversion"),
+			ID:              ceHeader(headers, "id"),
+			Source:          ceHeader(headers, "source"),
+			Type:            ceHeader(headers, "type"),
+			Subject:         ceHeader(headers, "subject"),
+			Time:            ceHeader(headers, "time"),
+			DataContentType: headers.Get("content-type"),
+			Data:            body,
+		}
+		return c.unwrap(event, "binary")
+	}
+
+	var msg any
+	if err := json.Unmarshal(body, &msg); err != nil {
+		return nil, nil, err
+	}
+	fields, ok := msg.(map[string]any)
+	if !accept || !ok || fields["specversion"] == nil {
+		return msg, nil, nil
+	}
+	var event CloudEvent
+	if err := json.Unmarshal(body, &event); err != nil {
+		cloudEventsReceived.Inc("invalid")
+		return nil, nil, fmt.Errorf("invalid CloudEvent: %w", err)
+	}
+	return c.unwrap(&event, "structured")
+}
+
+func (c *CloudEvents) unwrap(event *CloudEvent, mode string) (any, *CloudEvent, error) {
+	msg, err := c.data(event)
+	if err != nil {
+		cloudEventsReceived.Inc("invalid")
+		return nil, nil, err
+	}
+	if fields, ok := msg.(map[string]any); ok && c.opts.TypeField != "" {
+		if _, ok := fields[c.opts.TypeField]; !ok {
+			fields[c.opts.TypeField] = event.Type
+		}
+	}
+	cloudEventsReceived.Inc(mode)
+	return msg, event, nil
+}
+
+// data validates the event and parses its data, which must be JSON
+func (c *CloudEvents) data(event *CloudEvent) (any, error) {
+	if err := event.validate(); err != nil {
+		return nil, err
+	}
+	if event.DataContentType != "" {
+		mediaType, _, err := mime.ParseMediaType(event.DataContentType)
+		if err != nil || (mediaType != "application/json" && !strings.HasSuffix(mediaType, "+json")) {
+			return nil, fmt.Errorf("CloudEvent %s: unsupported datacontenttype %q", event.ID, event.DataContentType)
+		}
+	}
+
+	data := []byte(event.Data)
+	if event.DataBase64 != "" {
+		decoded, err := base64.StdEncoding.DecodeString(event.DataBase64)
+		if err != nil {
+			return nil, fmt.Errorf("CloudEvent %s: invalid data_base64: %w", event.ID, err)
+		}
+		data = decoded
+	}
+	if len(data) == 0 {
+		return nil, fmt.Errorf("CloudEvent %s has no data", event.ID)
+	}
+
+	var msg any
+	if err := json.Unmarshal(data, &msg); err != nil {
+		return nil, fmt.Errorf("CloudEvent %s: error parsing data: %w", event.ID, err)
+	}
+	return msg, nil
+}
+
+// ceHeader reads a CloudEvents attribute in binary mode, named ce-<name> as
+// in HTTP or ce_<name> as in Kafka
+func ceHeader(headers propagation.TextMapCarrier, name string) string {
+	if value := headers.Get("ce-" + name); value != "" {
+		return value
+	}
+	return headers.Get("ce_" + name)
+}
+
+// emits reports whether the outputs are wrapped in CloudEvents
+func (c *CloudEvents) emits() bool {
+	return c != nil && c.opts.Emit
+}
+
+// eventType is the type of an emitted event, e.g. orchestrator.response
+func (c *CloudEvents) eventType(name string) string {
+	return c.opts.TypePrefix + "." + name
+}
+
+// Envelope wraps data in a structured-mode CloudEvent
+func (c *CloudEvents) Envelope(name, id, subject string, data any) ([]byte, error) {
+	payload, err := json.Marshal(data)
+	if err != nil {
+		return nil, fmt.Errorf("error marshaling CloudEvent data: %w", err)
+	}
+	envelope, err := json.Marshal(CloudEvent{
+		SpecVersion:     cloudEventsSpecVersion,
+		ID:              id,
+		Source:          c.opts.Source,
+		Type:            c.eventType(name),
+		Subject:         subject,
+		Time:            time.Now().UTC().Format(time.RFC3339Nano),
+		DataContentType: "application/json",
+		Data:            payload,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("error marshaling CloudEvent: %w", err)
+	}
+	return envelope, nil
+}
+
+// SetHeaders sets the attributes of a binary-mode CloudEvent on an HTTP
+// request, whose body is the event data
+func (c *CloudEvents) SetHeaders(header http.Header, name, id string) {
+	header.Set("ce-specversion", cloudEventsSpecVersion)
+	header.Set("ce-id", id)
+	header.Set("ce-source", c.opts.Source)
+	header.Set("ce-type", c.eventType(name))
+	header.Set("ce-time", time.Now().UTC().Format(time.RFC3339Nano))
+}
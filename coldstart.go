@@ -0,0 +1,144 @@
+package main
+
+import (
+	"encoding/base64"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Detection of a cold start
+const (
+	coldStartReport  = "report"  // Init Duration in the REPORT line of the log tail
+	coldStartOutlier = "outlier" // invocation far slower than the warm ones
+)
+
+// coldStartWarmup is the warm invocations averaged before outliers count
+const coldStartWarmup = 5
+
+var (
+	lambdaColdStarts = NewCounterVec(
+		"orchestrator_lambda_cold_starts_total",
+		"Worker invocations detected as cold starts, by worker and detection (report, outlier).",
+		"lambda_arn", "detection",
+	)
+	lambdaColdStartRate = NewGaugeVec(
+		"orchestrator_lambda_cold_start_rate",
+		"Fraction of the worker invocations of this instance that were cold starts, by worker.",
+		"lambda_arn",
+	)
+	lambdaInitDuration = NewHistogramVec(
+		"orchestrator_lambda_init_duration_seconds",
+		"Init duration of the cold starts reported in the worker logs, by worker.",
+		[]float64{0.1, 0.25, 0.5, 1, 2, 5, 10},
+		"lambda_arn",
+	)
+)
+
+var initDurationPattern = regexp.MustCompile(`Init Duration: ([0-9.]+) ms`)
+
+// ColdStartOptions configures the cold-start detection
+type ColdStartOptions struct {
+	// LogTail requests the last 4 KB of the logs of every worker invocation
+	// and reads the Init Duration of its REPORT line, which only cold
+	// starts have. Otherwise cold starts are inferred from the durations.
+	LogTail bool
+	// An invocation is an outlier when it takes Factor times the warm
+	// average and at least MinExtra more
+	Factor   float64
+	MinExtra time.Duration
+}
+
+// coldStartStats are the invocations of one worker
+type coldStartStats struct {
+	invocations int64
+	coldStarts  int64
+	warm        int64   // invocations in the average
+	average     float64 // of the warm invocations, in seconds
+}
+
+// ColdStartTracker detects the cold starts of each worker, to size its
+// provisioned concurrency. A nil *ColdStartTracker tracks nothing.
+type ColdStartTracker struct {
+	opts ColdStartOptions
+
+	mu    sync.Mutex
+	stats map[string]*coldStartStats // by ARN
+}
+
+func NewColdStartTracker(opts ColdStartOptions) *ColdStartTracker {
+	return &ColdStartTracker{opts: opts, stats: make(map[string]*coldStartStats)}
+}
+
+// logTail reports whether the invocations must return their log tail
+func (t *ColdStartTracker) logTail() bool {
+	return t != nil && t.opts.LogTail
+}
+
+// Observe records a successful invocation of arn. logResult is the base64
+// log tail, empty when it was not requested.
+func (t *ColdStartTracker) Observe(arn string, elapsed time.Duration, logResult string) {
+	if t == nil {
+		return
+	}
+	initDuration, reported := parseInitDuration(logResult)
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	stats, ok := t.stats[arn]
+	if !ok {
+		stats = &coldStartStats{}
+		t.stats[arn] = stats
+	}
+	stats.invocations++
+
+	seconds := elapsed.Seconds()
+	detection := ""
+	switch {
+	case reported:
+		detection = coldStartReport
+		lambdaInitDuration.Observe(initDuration.Seconds(), arn)
+	case logResult == "" && stats.warm >= coldStartWarmup &&
+		seconds > t.opts.Factor*stats.average && elapsed-time.Duration(stats.average*float64(time.Second)) > t.opts.MinExtra:
+		detection = coldStartOutlier
+	}
+
+	if detection != "" {
+		stats.coldStarts++
+		lambdaColdStarts.Inc(arn, detection)
+	} else {
+		// Running mean for the warm-up, then exponentially weighted
+		stats.warm++
+		weight := max(1/float64(stats.warm), 0.1)
+		stats.average += weight * (seconds - stats.average)
+	}
+	lambdaColdStartRate.Set(float64(stats.coldStarts)/float64(stats.invocations), arn)
+}
+
+// parseInitDuration reads the Init Duration of the REPORT line of a log tail
+func parseInitDuration(logResult string) (time.Duration, bool) {
+	if logResult == "" {
+		return 0, false
+	}
+	logs, err := base64.StdEncoding.DecodeString(logResult)
+	if err != nil {
+		return 0, false
+	}
+	for line := range strings.Lines(string(logs)) {
+		if !strings.HasPrefix(line, "REPORT ") {
+			continue
+		}
+		match := initDurationPattern.FindStringSubmatch(line)
+		if match == nil {
+			return 0, false
+		}
+		ms, err := strconv.ParseFloat(match[1], 64)
+		if err != nil {
+			return 0, false
+		}
+		return time.Duration(ms * float64(time.Millisecond)), true
+	}
+	return 0, false
+}
@@ -0,0 +1,37 @@
+package config
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/aws/retry"
+	awshttp "github.com/aws/aws-sdk-go-v2/aws/transport/http"
+	awsconfig "github.com/aws/aws-sdk-go-v2/config"
+)
+
+// NewAWSConfig loads the AWS config shared by every client, so credentials
+// and IMDS are resolved once and all clients use the same retry and HTTP
+// settings
+func NewAWSConfig(ctx context.Context, region string, settings AWSConfig) (aws.Config, error) {
+	httpClient := awshttp.NewBuildableClient().
+		WithTimeout(settings.HTTPTimeout).
+		WithTransportOptions(func(t *http.Transport) {
+			t.MaxIdleConnsPerHost = settings.MaxIdleConns
+		})
+
+	cfg, err := awsconfig.LoadDefaultConfig(ctx,
+		awsconfig.WithRegion(region),
+		awsconfig.WithHTTPClient(httpClient),
+		awsconfig.WithRetryer(func() aws.Retryer {
+			return retry.NewStandard(func(o *retry.StandardOptions) {
+				o.MaxAttempts = settings.MaxAttempts
+			})
+		}),
+	)
+	if err != nil {
+		return aws.Config{}, fmt.Errorf("error loading AWS config: %w", err)
+	}
+	return cfg, nil
+}
@@ -0,0 +1,109 @@
+package config
+
+import (
+	"fmt"
+	"net/url"
+	"os"
+	"reflect"
+	"regexp"
+	"strconv"
+
+	"github.com/aws/aws-sdk-go-v2/aws/arn"
+)
+
+var (
+	tableNamePattern    = regexp.MustCompile(`^[A-Za-z0-9_.-]{3,255}$`)
+	functionNamePattern = regexp.MustCompile(`^[A-Za-z0-9_-]{1,64}$`)
+	streamNamePattern   = regexp.MustCompile(`^[A-Za-z0-9_.-]{1,128}$`)
+	regionPattern       = regexp.MustCompile(`^[a-z]{2}(-[a-z]+)+-\d$`)
+	eventBusPattern     = regexp.MustCompile(`^[A-Za-z0-9/_.-]{1,256}$`)
+	bucketNamePattern   = regexp.MustCompile(`^[a-z0-9][a-z0-9.-]{1,61}[a-z0-9]$`)
+	leaseNamePattern    = regexp.MustCompile(`^[a-z0-9]([-a-z0-9.]{0,251}[a-z0-9])?$`) // Kubernetes DNS subdomain
+)
+
+// redactedSettings are never printed in the configuration summary
+var redactedSettings = map[string]bool{
+	"server.adminApiKey": true,
+	"alerts.webhookUrl":  true,
+	"kafka.password":     true,
+	"rabbitmq.url":       true,
+}
+
+func isHTTPURL(value string) bool {
+	u, err := url.Parse(value)
+	return err == nil && (u.Scheme == "http" || u.Scheme == "https") && u.Host != ""
+}
+
+// isARN reports whether value is an ARN of the given service, e.g. "iam"
+func isARN(value, service string) bool {
+	parsed, err := arn.Parse(value)
+	return err == nil && parsed.Service == service
+}
+
+// isFunctionRef accepts a Lambda function name or ARN
+func isFunctionRef(value string) bool {
+	return functionNamePattern.MatchString(value) || isARN(value, "lambda")
+}
+
+func isPort(value string) bool {
+	port, err := strconv.Atoi(value)
+	return err == nil && port > 0 && port <= 65535
+}
+
+func isReadableFile(path string) bool {
+	f, err := os.Open(path)
+	if err != nil {
+		return false
+	}
+	f.Close()
+	return true
+}
+
+// Setting is an effective setting by its dotted YAML path
+type Setting struct {
+	Path  string
+	Value string
+}
+
+// Settings lists every effective setting, masking the sensitive ones and
+// showing the Secrets Manager reference of resolved secrets
+func (c *Config) Settings() []Setting {
+	var settings []Setting
+	eachSetting(reflect.ValueOf(c).Elem(), "", func(path string, v reflect.Value) {
+		value := fmt.Sprint(v.Interface())
+		switch {
+		case c.secretRefs[path] != "":
+			value = c.secretRefs[path]
+		case redactedSettings[path] && value != "":
+			value = "<redacted>"
+		}
+		settings = append(settings, Setting{Path: path, Value: value})
+	})
+	return settings
+}
+
+// Summary lists every effective setting as "path = value"
+func (c *Config) Summary() []string {
+	var lines []string
+	for _, setting := range c.Settings() {
+		lines = append(lines, setting.Path+" = "+setting.Value)
+	}
+	return lines
+}
+
+// eachSetting calls fn with the dotted YAML path of every leaf setting
+func eachSetting(v reflect.Value, prefix string, fn func(path string, v reflect.Value)) {
+	for i := 0; i < v.NumField(); i++ {
+		field := v.Type().Field(i)
+		if !field.IsExported() {
+			continue
+		}
+		name := prefix + yamlName(field)
+
+		if field.Type.Kind() == reflect.Struct {
+			eachSetting(v.Field(i), name+".", fn)
+			continue
+		}
+		fn(name, v.Field(i))
+	}
+}
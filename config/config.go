@@ -0,0 +1,1216 @@
+// Package config loads and validates the orchestrator configuration: the
+// YAML/JSON file, SSM Parameter Store, the environment and Secrets Manager.
+package config
+
+import (
+	"bytes"
+	"cmp"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"maps"
+	"net"
+	"net/url"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Admin endpoint groups, each with its own authentication methods
+const (
+	AuthGroupRegistry   = "registry"   // /admin/lambdas, /admin/registry
+	AuthGroupOperations = "operations" // reconciliation report, log level, /status
+	AuthGroupDebug      = "debug"      // /debug/pprof
+	AuthGroupProcess    = "process"    // POST /v1/process
+)
+
+// Leader election backends
+const (
+	LeaderBackendDynamoDB   = "dynamodb"
+	LeaderBackendKubernetes = "kubernetes"
+)
+
+// Strategies of consumer.routingStrategy
+const (
+	RoutingWeighted = "weighted"
+	RoutingUniform  = "uniform"
+	RoutingLatency  = "latency"
+)
+
+// How protobuf messages are forwarded to the workers
+const (
+	ProtobufForwardJSON  = "json"     // the JSON mapping of the message
+	ProtobufForwardBytes = "protobuf" // {"messageType": ..., "data": <base64 bytes>}
+)
+
+// Config is the orchestrator configuration. It is built from the defaults,
+// then the optional YAML/JSON file and its APP_ENV profile, then SSM
+// Parameter Store, then the environment variables, which always win so
+// deployments can override single values, even with an empty one. Keys
+// that match no setting are rejected. Any string setting can reference a
+// Secrets Manager secret with a secretsmanager:// URI.
+type Config struct {
+	Region                 string            `yaml:"region"`
+	SSMPath                string            `yaml:"ssmPath"`                // Parameter Store path with per-environment settings
+	SecretsRefreshInterval time.Duration     `yaml:"secretsRefreshInterval"` // 0 disables secret rotation
+	AWS                    AWSConfig         `yaml:"aws"`
+	Failover               FailoverConfig    `yaml:"failover"`
+	Consumer               ConsumerConfig    `yaml:"consumer"`
+	Router                 RouterConfig      `yaml:"router"`
+	Registry               RegistryConfig    `yaml:"registry"`
+	Server                 ServerConfig      `yaml:"server"`
+	Alerts                 AlertsConfig      `yaml:"alerts"`
+	Metrics                MetricsConfig     `yaml:"metrics"`
+	Flags                  FlagsConfig       `yaml:"flags"`
+	Scheduler              SchedulerConfig   `yaml:"scheduler"`
+	Events                 EventsConfig      `yaml:"events"`
+	Kafka                  KafkaConfig       `yaml:"kafka"`
+	Kinesis                KinesisConfig     `yaml:"kinesis"`
+	RabbitMQ               RabbitMQConfig    `yaml:"rabbitmq"`
+	NATS                   NATSConfig        `yaml:"nats"`
+	Outbox                 OutboxConfig      `yaml:"outbox"`
+	Tenants                TenantsConfig     `yaml:"tenants"`
+	CloudEvents            CloudEventsConfig `yaml:"cloudEvents"`
+	Protobuf               ProtobufConfig    `yaml:"protobuf"`
+	Schemas                SchemasConfig     `yaml:"schemas"`
+	Archive                ArchiveConfig     `yaml:"archive"`
+	Chaos                  ChaosConfig       `yaml:"chaos"`
+	Workflows              WorkflowsConfig   `yaml:"workflows"`
+	Transforms             TransformsConfig  `yaml:"transforms"`
+	Costs                  CostsConfig       `yaml:"costs"`
+	Budget                 BudgetConfig      `yaml:"budget"`
+
+	secretRefs map[string]string // setting -> secretsmanager:// URI
+}
+
+// AWSConfig holds the retry and HTTP settings shared by every AWS client
+type AWSConfig struct {
+	MaxAttempts  int           `yaml:"maxAttempts"`
+	HTTPTimeout  time.Duration `yaml:"httpTimeout"`  // must exceed the 20s SQS long poll
+	MaxIdleConns int           `yaml:"maxIdleConns"` // per host
+}
+
+// FailoverConfig controls the failover of the worker Lambdas to their
+// replicas and of the registry table to registry.secondaryRegion
+type FailoverConfig struct {
+	Threshold     int           `yaml:"threshold"`     // consecutive regional errors
+	FailbackAfter time.Duration `yaml:"failbackAfter"` // time before probing the primary
+}
+
+type ConsumerConfig struct {
+	QueueURL             string        `yaml:"queueUrl"`
+	OutputQueueURL       string        `yaml:"outputQueueUrl"` // worker responses, empty disables forwarding
+	IntegrityLambda      string        `yaml:"integrityLambda"`
+	ExactlyOnceTable     string        `yaml:"exactlyOnceTable"` // empty disables exactly-once mode
+	StateTable           string        `yaml:"stateTable"`
+	HeartbeatInterval    time.Duration `yaml:"heartbeatInterval"` // 0 disables the heartbeat items in stateTable
+	LivenessThreshold    time.Duration `yaml:"livenessThreshold"`
+	QueueMonitorInterval time.Duration `yaml:"queueMonitorInterval"` // 0 disables it
+	LeaderLease          time.Duration `yaml:"leaderLease"`          // 0 runs the singleton jobs on every replica
+	LeaderBackend        string        `yaml:"leaderBackend"`        // dynamodb (stateTable) or kubernetes (a Lease)
+	LeaderLeaseName      string        `yaml:"leaderLeaseName"`      // Kubernetes Lease in the pod namespace
+	MaxRate              float64       `yaml:"maxRate"`              // messages per second across every source, 0 for no limit
+	RoutingStrategy      string        `yaml:"routingStrategy"`      // weighted, uniform or latency, unless the routingStrategy flag is set
+	FailureRetention     time.Duration `yaml:"failureRetention"`     // failure records in stateTable, 0 disables them
+	HandoffDuration      time.Duration `yaml:"handoffDuration"`      // ramp-down before a newer version, 0 disables the handoff
+	// TaskProtection protects the ECS task from scale-in while messages are
+	// in flight, for TaskProtectionExpiry at most without a renewal
+	TaskProtection       bool          `yaml:"taskProtection"`
+	TaskProtectionExpiry time.Duration `yaml:"taskProtectionExpiry"`
+	// CorrelationPayload also adds the correlation ID to the JSON worker
+	// payloads; it always travels in the Lambda ClientContext
+	CorrelationPayload bool `yaml:"correlationPayload"`
+	// Queues are polled by weight instead of queueUrl, e.g. high and low
+	// priority queues with weights 80 and 20
+	Queues            []SQSQueue    `yaml:"queues"`
+	StarvationTimeout time.Duration `yaml:"starvationTimeout"` // longest a queue waits to be polled first
+	// Sharding splits the queues between the live replicas instead of all
+	// of them polling every queue
+	Sharding bool `yaml:"sharding"`
+	// The SQS poll loops scale between MinPollers and MaxPollers to drain
+	// the visible messages within PollerDrainTarget
+	MinPollers        int           `yaml:"minPollers"`
+	MaxPollers        int           `yaml:"maxPollers"`
+	PollerDrainTarget time.Duration `yaml:"pollerDrainTarget"`
+}
+
+// SQSQueues returns the queues to consume: queues, or queueUrl with weight 1
+func (c ConsumerConfig) SQSQueues() []SQSQueue {
+	if len(c.Queues) > 0 {
+		return c.Queues
+	}
+	if c.QueueURL != "" {
+		return []SQSQueue{{URL: c.QueueURL, Weight: 1}}
+	}
+	return nil
+}
+
+// SQSQueue is a queue of the consumer and its share of the polls, e.g. 80
+// for the high-priority queue and 20 for the low-priority one
+type SQSQueue struct {
+	URL    string `yaml:"url"`
+	Weight int    `yaml:"weight"`
+}
+
+type RouterConfig struct {
+	AuditStream      string `yaml:"auditStream"`      // Kinesis stream for routing decisions
+	LambdaRoleARN    string `yaml:"lambdaRoleArn"`    // role assumed to invoke and discover the Lambdas
+	LambdaExternalID string `yaml:"lambdaExternalId"` // external ID for lambdaRoleArn
+	// How often executions of Step Functions entries with waitForResult are polled
+	StepFunctionsPollInterval time.Duration `yaml:"stepFunctionsPollInterval"`
+	RulesTable                string        `yaml:"rulesTable"`        // routing rules, empty disables them
+	RulesPollInterval         time.Duration `yaml:"rulesPollInterval"` // how often the rules table is read
+	// Message types sent to every healthy worker, and the fraction of them
+	// that must succeed
+	FanOutTypes            []string `yaml:"fanOutTypes"`
+	FanOutSuccessThreshold float64  `yaml:"fanOutSuccessThreshold"`
+	// Workers that must agree on the response, by message type
+	Quorum   map[string]int `yaml:"quorum"`
+	Eviction EvictionConfig `yaml:"eviction"`
+	// Scale the weights by the latency and error EWMAs of the workers
+	AdaptiveWeights bool `yaml:"adaptiveWeights"`
+	// Aggregate up to BatchSize messages, or those within BatchWindow, into
+	// one worker invocation; 0 disables batching
+	BatchSize   int           `yaml:"batchSize"`
+	BatchWindow time.Duration `yaml:"batchWindow"`
+}
+
+// EvictionConfig takes the workers failing too often out of routing
+type EvictionConfig struct {
+	ErrorRate      float64       `yaml:"errorRate"` // 0 disables eviction
+	Window         time.Duration `yaml:"window"`
+	MinRequests    int           `yaml:"minRequests"` // in the window, before evicting
+	Probation      time.Duration `yaml:"probation"`   // before the probe traffic
+	ProbeRate      float64       `yaml:"probeRate"`   // fraction of the messages probing a worker
+	ProbeSuccesses int           `yaml:"probeSuccesses"`
+}
+
+type RegistryConfig struct {
+	Table                  string        `yaml:"table"`
+	StatusIndex            string        `yaml:"statusIndex"`
+	TTLGrace               time.Duration `yaml:"ttlGrace"`
+	ConsistentReads        bool          `yaml:"consistentReads"`
+	DAXEndpoint            string        `yaml:"daxEndpoint"`
+	ReconcileInterval      time.Duration `yaml:"reconcileInterval"` // 0 disables it
+	DiscoveryTag           string        `yaml:"discoveryTag"`      // key=value, empty disables discovery
+	DiscoveryInterval      time.Duration `yaml:"discoveryInterval"`
+	SecondaryRegion        string        `yaml:"secondaryRegion"`    // global table replica, empty disables failover
+	HeartbeatFreshness     time.Duration `yaml:"heartbeatFreshness"` // 0 disables the heartbeat monitor
+	HeartbeatSweepInterval time.Duration `yaml:"heartbeatSweepInterval"`
+	RoleARN                string        `yaml:"roleArn"`    // role assumed to access the table
+	ExternalID             string        `yaml:"externalId"` // external ID for roleArn
+}
+
+type ServerConfig struct {
+	Port               string              `yaml:"port"`
+	TLSCert            string              `yaml:"tlsCert"`
+	TLSKey             string              `yaml:"tlsKey"`
+	AdminAPIKey        string              `yaml:"adminApiKey"`
+	AdminIAMPrincipals []string            `yaml:"adminIamPrincipals"`
+	AdminIAMServerID   string              `yaml:"adminIamServerId"` // signed into the IAM tokens, required with adminIamPrincipals
+	AdminAuth          map[string][]string `yaml:"adminAuth"`        // endpoint group -> methods
+	Pprof              bool                `yaml:"pprof"`
+	ProcessTimeout     time.Duration       `yaml:"processTimeout"`
+	ProcessConcurrency int                 `yaml:"processConcurrency"` // 0 disables POST /v1/process
+	GRPCPort           string              `yaml:"grpcPort"`           // empty disables the gRPC control plane
+	StateDumpDir       string              `yaml:"stateDumpDir"`       // SIGUSR1 dumps there, or to the log when empty
+}
+
+type AlertsConfig struct {
+	SNSTopicARN          string        `yaml:"snsTopicArn"`
+	Cooldown             time.Duration `yaml:"cooldown"`
+	DLQURL               string        `yaml:"dlqUrl"`
+	DLQThreshold         int64         `yaml:"dlqThreshold"`
+	IntegrityThreshold   float64       `yaml:"integrityThreshold"`
+	LatencySLO           time.Duration `yaml:"latencySlo"` // p99 of each worker, 0 disables the check
+	CheckInterval        time.Duration `yaml:"checkInterval"`
+	WebhookURL           string        `yaml:"webhookUrl"`
+	WebhookRateLimit     int           `yaml:"webhookRateLimit"` // per minute
+	WebhookTemplatesFile string        `yaml:"webhookTemplatesFile"`
+}
+
+type MetricsConfig struct {
+	EMF              bool          `yaml:"emf"`
+	EMFNamespace     string        `yaml:"emfNamespace"`
+	EMFFlushInterval time.Duration `yaml:"emfFlushInterval"`
+	// Cold starts of the workers: read from their log tail, or inferred
+	// from invocations ColdStartFactor times slower than the warm average
+	// and at least ColdStartMinExtra slower
+	ColdStartLogTail  bool          `yaml:"coldStartLogTail"`
+	ColdStartFactor   float64       `yaml:"coldStartFactor"`
+	ColdStartMinExtra time.Duration `yaml:"coldStartMinExtra"`
+}
+
+type FlagsConfig struct {
+	Table        string        `yaml:"table"` // DynamoDB flags table, empty disables the flags
+	PollInterval time.Duration `yaml:"pollInterval"`
+	// AllowIntegrityBypass honours the integrityBypass flag. It has no
+	// environment variable, so only the configuration file can allow it.
+	AllowIntegrityBypass bool `yaml:"allowIntegrityBypass"`
+}
+
+// KafkaConfig enables a Kafka (MSK) source next to the SQS queue
+type KafkaConfig struct {
+	Brokers      []string      `yaml:"brokers"` // host:port, empty disables the source
+	Topics       []string      `yaml:"topics"`
+	GroupID      string        `yaml:"groupId"`
+	TLS          bool          `yaml:"tls"`
+	Username     string        `yaml:"username"` // SASL/SCRAM-SHA-512, empty disables SASL
+	Password     string        `yaml:"password"`
+	MaxAttempts  int           `yaml:"maxAttempts"`
+	RetryBackoff time.Duration `yaml:"retryBackoff"`
+}
+
+// KinesisConfig enables a Kinesis Data Streams source next to the SQS queue
+type KinesisConfig struct {
+	Stream        string        `yaml:"stream"`     // empty disables the source
+	LeaseTable    string        `yaml:"leaseTable"` // shard leases and checkpoints, defaults to consumer.stateTable
+	BatchSize     int           `yaml:"batchSize"`
+	PollInterval  time.Duration `yaml:"pollInterval"`
+	LeaseDuration time.Duration `yaml:"leaseDuration"`
+	MaxAttempts   int           `yaml:"maxAttempts"`
+	RetryBackoff  time.Duration `yaml:"retryBackoff"`
+}
+
+// RabbitMQConfig enables an AMQP source next to the SQS queue
+type RabbitMQConfig struct {
+	URL            string        `yaml:"url"` // amqp(s)://user:password@host/vhost, empty disables the source
+	Queue          string        `yaml:"queue"`
+	Prefetch       int           `yaml:"prefetch"`
+	ReconnectDelay time.Duration `yaml:"reconnectDelay"`
+	MaxAttempts    int           `yaml:"maxAttempts"`
+	RetryBackoff   time.Duration `yaml:"retryBackoff"`
+}
+
+// NATSConfig enables a JetStream source, next to or instead of the SQS queue
+type NATSConfig struct {
+	URL             string        `yaml:"url"` // empty disables the source
+	CredentialsFile string        `yaml:"credentialsFile"`
+	Stream          string        `yaml:"stream"`
+	Consumer        string        `yaml:"consumer"` // durable pull consumer
+	Subject         string        `yaml:"subject"`  // filter, empty for the whole stream
+	BatchSize       int           `yaml:"batchSize"`
+	AckWait         time.Duration `yaml:"ackWait"`
+	MaxDeliver      int           `yaml:"maxDeliver"`
+	RetryBackoff    time.Duration `yaml:"retryBackoff"`
+}
+
+// ArchiveConfig enables the S3 archive of processed messages
+type ArchiveConfig struct {
+	Bucket        string        `yaml:"bucket"` // empty disables the archive
+	Prefix        string        `yaml:"prefix"`
+	BatchSize     int           `yaml:"batchSize"`
+	FlushInterval time.Duration `yaml:"flushInterval"`
+}
+
+// ChaosConfig sets the rates, from 0 to 1, of the faults injected when the
+// orchestrator runs with -chaos. It is ignored without the flag.
+type ChaosConfig struct {
+	LatencyRate       float64       `yaml:"latencyRate"`       // Lambda invocations delayed
+	MaxLatency        time.Duration `yaml:"maxLatency"`        // the delay is random up to this
+	LambdaErrorRate   float64       `yaml:"lambdaErrorRate"`   // Lambda invocations failed
+	DynamoDBErrorRate float64       `yaml:"dynamodbErrorRate"` // registry calls failed
+}
+
+// Enabled reports whether the settings inject any fault
+func (c ChaosConfig) Enabled() bool {
+	return c.LatencyRate > 0 || c.LambdaErrorRate > 0 || c.DynamoDBErrorRate > 0
+}
+
+// WorkflowsConfig enables multi-step workflows per message type
+type WorkflowsConfig struct {
+	Table       string                    `yaml:"table"`     // state and stored definitions; empty disables workflows
+	TypeField   string                    `yaml:"typeField"` // payload field with the message type
+	StateTTL    time.Duration             `yaml:"stateTTL"`
+	Definitions map[string][]WorkflowStep `yaml:"definitions"` // steps by message type
+}
+
+// WorkflowStep is one Lambda of a workflow. It receives the output of the
+// previous step, or the message for the first one.
+type WorkflowStep struct {
+	Name     string        `yaml:"name" json:"name"`
+	Function string        `yaml:"function" json:"function"` // name or ARN
+	Timeout  time.Duration `yaml:"timeout" json:"timeout"`   // per attempt, 0 for none
+	Retries  int           `yaml:"retries" json:"retries"`   // attempts after the first
+}
+
+// TransformsConfig reshapes the worker responses before they are forwarded
+type TransformsConfig struct {
+	Types map[string][]TransformStep `yaml:"types"` // steps by message type, "*" for the types not listed
+}
+
+// TransformStep is one change to a worker response; exactly one of its
+// fields is set. Paths are dotted, e.g. customer.email, and only walk
+// objects.
+type TransformStep struct {
+	Rename  map[string]string `yaml:"rename" json:"rename,omitempty"`   // path -> new path
+	Redact  []string          `yaml:"redact" json:"redact,omitempty"`   // values replaced with [REDACTED]
+	Remove  []string          `yaml:"remove" json:"remove,omitempty"`   // fields dropped
+	Flatten string            `yaml:"flatten" json:"flatten,omitempty"` // separator of the keys of nested objects
+	// Template is a Go template rendering the new response, which must be
+	// JSON. It sees .Response, the decoded response, .Message, the request
+	// payload, .MessageID, .CorrelationID and .Lambda, the worker name; the
+	// json function marshals a value.
+	Template string `yaml:"template" json:"template,omitempty"`
+}
+
+// CostsConfig estimates the spend on the worker Lambdas, by worker and
+// message type (workflows.typeField)
+type CostsConfig struct {
+	Enabled          bool    `yaml:"enabled"`
+	PricePerGBSecond float64 `yaml:"pricePerGbSecond"`
+	PricePerRequest  float64 `yaml:"pricePerRequest"`
+}
+
+// BudgetConfig caps the estimated spend and the invocations of each
+// replica; 0 disables a cap. Any cap enables the cost estimation.
+type BudgetConfig struct {
+	HourlyUSD         float64       `yaml:"hourlyUsd"`
+	DailyUSD          float64       `yaml:"dailyUsd"`
+	HourlyInvocations float64       `yaml:"hourlyInvocations"`
+	DailyInvocations  float64       `yaml:"dailyInvocations"`
+	CriticalTypes     []string      `yaml:"criticalTypes"` // still processed while over a budget
+	PollDelay         time.Duration `yaml:"pollDelay"`     // before each fetch while over a budget
+	CheckInterval     time.Duration `yaml:"checkInterval"`
+}
+
+// Enabled reports whether any cap is set
+func (b BudgetConfig) Enabled() bool {
+	return b.HourlyUSD > 0 || b.DailyUSD > 0 || b.HourlyInvocations > 0 || b.DailyInvocations > 0
+}
+
+// OutboxConfig enables the relay of a DynamoDB outbox table, next to or
+// instead of the SQS queue
+type OutboxConfig struct {
+	Table        string        `yaml:"table"`       // empty disables the source
+	StatusIndex  string        `yaml:"statusIndex"` // GSI keyed by status
+	BatchSize    int           `yaml:"batchSize"`
+	PollInterval time.Duration `yaml:"pollInterval"`
+	ClaimTimeout time.Duration `yaml:"claimTimeout"`
+	MaxAttempts  int           `yaml:"maxAttempts"`
+}
+
+// TenantsConfig enables the per-tenant limits and metrics
+type TenantsConfig struct {
+	Field       string                  `yaml:"field"`       // payload field or message attribute, empty disables it
+	MaxInFlight int                     `yaml:"maxInFlight"` // per tenant without an override
+	MaxRate     float64                 `yaml:"maxRate"`     // messages per second, per tenant without an override
+	Overrides   map[string]TenantLimits `yaml:"overrides"`
+}
+
+// TenantLimits caps the messages of a tenant; zero fields do not limit
+type TenantLimits struct {
+	MaxInFlight int     `yaml:"maxInFlight"`
+	MaxRate     float64 `yaml:"maxRate"` // messages per second
+}
+
+// CloudEventsConfig enables the CloudEvents envelope on the sources and the
+// outputs
+type CloudEventsConfig struct {
+	Accept     bool   `yaml:"accept"`     // unwrap CloudEvents message bodies
+	Emit       bool   `yaml:"emit"`       // wrap the output queue messages and set the webhook ce-* headers
+	Source     string `yaml:"source"`     // source attribute of the emitted events
+	TypePrefix string `yaml:"typePrefix"` // of the emitted event types, e.g. <prefix>.response
+}
+
+// ProtobufConfig enables the protobuf payloads
+type ProtobufConfig struct {
+	DescriptorSet string `yaml:"descriptorSet"` // FileDescriptorSet file, empty disables it
+	TypeAttribute string `yaml:"typeAttribute"` // message attribute with the full message name
+	DefaultType   string `yaml:"defaultType"`   // for messages without the attribute
+	Forward       string `yaml:"forward"`       // json or protobuf
+}
+
+// SchemasConfig enables the JSON Schema validation per message type
+type SchemasConfig struct {
+	Location           string        `yaml:"location"`           // directory or s3://bucket/prefix, empty disables it
+	RefreshInterval    time.Duration `yaml:"refreshInterval"`    // 0 loads the schemas once
+	QuarantineQueueURL string        `yaml:"quarantineQueueUrl"` // empty leaves invalid messages to the retries
+}
+
+// hasOtherSource reports whether a source other than SQS is configured
+func (c *Config) hasOtherSource() bool {
+	return len(c.Kafka.Brokers) > 0 || c.Kinesis.Stream != "" || c.RabbitMQ.URL != "" || c.NATS.URL != "" || c.Outbox.Table != ""
+}
+
+// EventsConfig selects the EventBridge bus receiving the lifecycle events
+type EventsConfig struct {
+	BusName string `yaml:"busName"` // name or ARN, empty disables the events
+	Source  string `yaml:"source"`
+}
+
+// SchedulerConfig tunes the periodic jobs. Jobs overrides the schedule of a
+// job by name with a duration or a five-field cron expression; jobs without
+// an entry run every interval configured for their subsystem.
+type SchedulerConfig struct {
+	Jitter time.Duration     `yaml:"jitter"` // random delay added to every run
+	Jobs   map[string]string `yaml:"jobs"`
+}
+
+// Default returns the configuration used for the settings that the file,
+// SSM and the environment leave unset
+func Default() *Config {
+	return &Config{
+		Region: "us-east-1",
+		AWS: AWSConfig{
+			MaxAttempts:  3,
+			HTTPTimeout:  30 * time.Second,
+			MaxIdleConns: 100,
+		},
+		Failover: FailoverConfig{
+			Threshold:     5,
+			FailbackAfter: time.Minute,
+		},
+		Router: RouterConfig{
+			StepFunctionsPollInterval: time.Second,
+			BatchWindow:               50 * time.Millisecond,
+			RulesPollInterval:         30 * time.Second,
+			FanOutSuccessThreshold:    1,
+			Eviction: EvictionConfig{
+				Window:         2 * time.Minute,
+				MinRequests:    10,
+				Probation:      time.Minute,
+				ProbeRate:      0.1,
+				ProbeSuccesses: 3,
+			},
+		},
+		Consumer: ConsumerConfig{
+			IntegrityLambda:      "arn:aws:lambda:us-east-1:652276263254:function:validacionDatos-py",
+			StateTable:           "OrchestratorState",
+			HeartbeatInterval:    15 * time.Second,
+			LivenessThreshold:    2 * time.Minute,
+			QueueMonitorInterval: 30 * time.Second,
+			LeaderLease:          30 * time.Second,
+			LeaderBackend:        LeaderBackendDynamoDB,
+			LeaderLeaseName:      "orchestrator-leader",
+			TaskProtectionExpiry: time.Hour,
+			CorrelationPayload:   true,
+			RoutingStrategy:      RoutingWeighted,
+			FailureRetention:     14 * 24 * time.Hour,
+			StarvationTimeout:    30 * time.Second,
+			MinPollers:           1,
+			MaxPollers:           1,
+			PollerDrainTarget:    30 * time.Second,
+		},
+		Registry: RegistryConfig{
+			Table:                  "ServiceState",
+			StatusIndex:            "estadoSalud-index",
+			TTLGrace:               10 * time.Minute,
+			ReconcileInterval:      5 * time.Minute,
+			DiscoveryInterval:      5 * time.Minute,
+			HeartbeatFreshness:     2 * time.Minute,
+			HeartbeatSweepInterval: 30 * time.Second,
+		},
+		Server: ServerConfig{
+			Port:               "8080",
+			ProcessTimeout:     30 * time.Second,
+			ProcessConcurrency: 16,
+		},
+		Alerts: AlertsConfig{
+			Cooldown:           15 * time.Minute,
+			DLQThreshold:       10,
+			IntegrityThreshold: 10,
+			CheckInterval:      time.Minute,
+			WebhookRateLimit:   10,
+		},
+		Metrics: MetricsConfig{
+			EMFNamespace:      "Orchestrator",
+			EMFFlushInterval:  time.Minute,
+			ColdStartFactor:   3,
+			ColdStartMinExtra: 100 * time.Millisecond,
+		},
+		Flags: FlagsConfig{
+			PollInterval: 30 * time.Second,
+		},
+		Scheduler: SchedulerConfig{
+			Jitter: 5 * time.Second,
+		},
+		Events: EventsConfig{
+			Source: "orchestrator",
+		},
+		Kafka: KafkaConfig{
+			GroupID:      "orchestrator",
+			TLS:          true,
+			MaxAttempts:  5,
+			RetryBackoff: time.Second,
+		},
+		NATS: NATSConfig{
+			Consumer:     "orchestrator",
+			BatchSize:    10,
+			AckWait:      time.Minute,
+			MaxDeliver:   5,
+			RetryBackoff: time.Second,
+		},
+		Outbox: OutboxConfig{
+			StatusIndex:  "status-index",
+			BatchSize:    25,
+			PollInterval: 2 * time.Second,
+			ClaimTimeout: time.Minute,
+			MaxAttempts:  5,
+		},
+		Schemas: SchemasConfig{
+			RefreshInterval: 5 * time.Minute,
+		},
+		Protobuf: ProtobufConfig{
+			TypeAttribute: "protoMessageType",
+			Forward:       ProtobufForwardJSON,
+		},
+		CloudEvents: CloudEventsConfig{
+			Source:     "/orchestrator",
+			TypePrefix: "orchestrator",
+		},
+		Archive: ArchiveConfig{
+			Prefix:        "messages",
+			BatchSize:     500,
+			FlushInterval: time.Minute,
+		},
+		Workflows: WorkflowsConfig{
+			TypeField: "type",
+			StateTTL:  7 * 24 * time.Hour,
+		},
+		Chaos: ChaosConfig{
+			MaxLatency: 2 * time.Second,
+		},
+		Costs: CostsConfig{
+			PricePerGBSecond: 0.0000166667,
+			PricePerRequest:  0.0000002,
+		},
+		Budget: BudgetConfig{
+			PollDelay:     5 * time.Second,
+			CheckInterval: time.Minute,
+		},
+		RabbitMQ: RabbitMQConfig{
+			Prefetch:       10,
+			ReconnectDelay: 5 * time.Second,
+			MaxAttempts:    5,
+			RetryBackoff:   time.Second,
+		},
+		Kinesis: KinesisConfig{
+			BatchSize:     100,
+			PollInterval:  time.Second,
+			LeaseDuration: 30 * time.Second,
+			MaxAttempts:   5,
+			RetryBackoff:  time.Second,
+		},
+	}
+}
+
+// Load reads the configuration file (optional when path is empty) and the
+// SSM parameters, applies the environment overrides, resolves the secret
+// references and validates the result with Validate and checks, which
+// validate the settings parsed by other packages, e.g. the job schedules
+func Load(path string, checks ...func(*Config) error) (*Config, error) {
+	cfg := Default()
+
+	if path != "" {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("error reading config file: %w", err)
+		}
+		// JSON is valid YAML, so both formats go through the YAML decoder
+		file := configFile{Config: cfg}
+		if err := decodeStrict(data, &file); err != nil {
+			return nil, fmt.Errorf("error parsing config file %s: %w", path, err)
+		}
+		if err := cfg.applyProfile(file.Profiles); err != nil {
+			return nil, fmt.Errorf("error in config file %s: %w", path, err)
+		}
+	}
+
+	if ssmPath := cmp.Or(os.Getenv("SSM_CONFIG_PATH"), cfg.SSMPath); ssmPath != "" {
+		cfg.SSMPath = ssmPath
+		region := cmp.Or(os.Getenv("AWS_REGION"), cfg.Region)
+		if err := cfg.applySSM(context.Background(), ssmPath, region); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := cfg.applyEnv(); err != nil {
+		return nil, err
+	}
+
+	if err := cfg.resolveSecrets(context.Background()); err != nil {
+		return nil, err
+	}
+
+	errs := []error{cfg.Validate()}
+	for _, check := range checks {
+		errs = append(errs, check(cfg))
+	}
+	if err := errors.Join(errs...); err != nil {
+		return nil, err
+	}
+	return cfg, nil
+}
+
+// configFile is the layout of the configuration file: the settings and the
+// environment profiles
+type configFile struct {
+	*Config  `yaml:",inline"`
+	Profiles map[string]yaml.Node `yaml:"profiles"`
+}
+
+// decodeStrict decodes YAML into out, rejecting the keys that match no
+// field, e.g. a misspelled setting
+func decodeStrict(data []byte, out any) error {
+	decoder := yaml.NewDecoder(bytes.NewReader(data))
+	decoder.KnownFields(true)
+	if err := decoder.Decode(out); err != nil && !errors.Is(err, io.EOF) {
+		return err
+	}
+	return nil
+}
+
+type envOverride struct {
+	name  string
+	apply func(value string) error
+}
+
+func (c *Config) envOverrides() []envOverride {
+	return []envOverride{
+		{"AWS_REGION", setString(&c.Region)},
+		{"SSM_CONFIG_PATH", setString(&c.SSMPath)},
+		{"SECRETS_REFRESH_INTERVAL", setDuration(&c.SecretsRefreshInterval)},
+
+		{"AWS_MAX_ATTEMPTS", setInt(&c.AWS.MaxAttempts)},
+		{"AWS_HTTP_TIMEOUT", setDuration(&c.AWS.HTTPTimeout)},
+		{"AWS_MAX_IDLE_CONNS", setInt(&c.AWS.MaxIdleConns)},
+		{"FAILOVER_THRESHOLD", setInt(&c.Failover.Threshold)},
+		{"FAILOVER_FAILBACK_AFTER", setDuration(&c.Failover.FailbackAfter)},
+
+		{"SQS_QUEUE_URL", setString(&c.Consumer.QueueURL)},
+		{"OUTPUT_QUEUE_URL", setString(&c.Consumer.OutputQueueURL)},
+		{"INTEGRITY_LAMBDA_ARN", setString(&c.Consumer.IntegrityLambda)},
+		{"EXACTLY_ONCE_TABLE", setString(&c.Consumer.ExactlyOnceTable)},
+		{"ORCHESTRATOR_TABLE", setString(&c.Consumer.StateTable)},
+		{"ORCHESTRATOR_HEARTBEAT_INTERVAL", setDuration(&c.Consumer.HeartbeatInterval)},
+		{"LIVENESS_THRESHOLD", setDuration(&c.Consumer.LivenessThreshold)},
+		{"QUEUE_MONITOR_INTERVAL", setDuration(&c.Consumer.QueueMonitorInterval)},
+		{"LEADER_LEASE", setDuration(&c.Consumer.LeaderLease)},
+		{"LEADER_BACKEND", setString(&c.Consumer.LeaderBackend)},
+		{"LEADER_LEASE_NAME", setString(&c.Consumer.LeaderLeaseName)},
+		{"HANDOFF_DURATION", setDuration(&c.Consumer.HandoffDuration)},
+		{"QUEUE_SHARDING", setBool(&c.Consumer.Sharding)},
+		{"ECS_TASK_PROTECTION", setBool(&c.Consumer.TaskProtection)},
+		{"CORRELATION_PAYLOAD", setBool(&c.Consumer.CorrelationPayload)},
+		{"CONSUMER_MAX_RATE", setFloat(&c.Consumer.MaxRate)},
+		{"ROUTING_STRATEGY", setString(&c.Consumer.RoutingStrategy)},
+		{"FAILURE_RETENTION", setDuration(&c.Consumer.FailureRetention)},
+		{"STARVATION_TIMEOUT", setDuration(&c.Consumer.StarvationTimeout)},
+		{"MIN_POLLERS", setInt(&c.Consumer.MinPollers)},
+		{"MAX_POLLERS", setInt(&c.Consumer.MaxPollers)},
+		{"POLLER_DRAIN_TARGET", setDuration(&c.Consumer.PollerDrainTarget)},
+
+		{"ROUTING_AUDIT_STREAM", setString(&c.Router.AuditStream)},
+		{"LAMBDA_ROLE_ARN", setString(&c.Router.LambdaRoleARN)},
+		{"LAMBDA_EXTERNAL_ID", setString(&c.Router.LambdaExternalID)},
+		{"STEP_FUNCTIONS_POLL_INTERVAL", setDuration(&c.Router.StepFunctionsPollInterval)},
+		{"ROUTING_RULES_TABLE", setString(&c.Router.RulesTable)},
+		{"FAN_OUT_TYPES", setList(&c.Router.FanOutTypes)},
+		{"FAN_OUT_SUCCESS_THRESHOLD", setFloat(&c.Router.FanOutSuccessThreshold)},
+		{"EVICTION_ERROR_RATE", setFloat(&c.Router.Eviction.ErrorRate)},
+		{"ADAPTIVE_WEIGHTS", setBool(&c.Router.AdaptiveWeights)},
+		{"BATCH_SIZE", setInt(&c.Router.BatchSize)},
+		{"BATCH_WINDOW", setDuration(&c.Router.BatchWindow)},
+
+		{"REGISTRY_TABLE", setString(&c.Registry.Table)},
+		{"REGISTRY_STATUS_INDEX", setString(&c.Registry.StatusIndex)},
+		{"REGISTRY_TTL_GRACE", setDuration(&c.Registry.TTLGrace)},
+		{"REGISTRY_CONSISTENT_READS", setBool(&c.Registry.ConsistentReads)},
+		{"DAX_ENDPOINT", setString(&c.Registry.DAXEndpoint)},
+		{"RECONCILE_INTERVAL", setDuration(&c.Registry.ReconcileInterval)},
+		{"DISCOVERY_TAG", setString(&c.Registry.DiscoveryTag)},
+		{"DISCOVERY_INTERVAL", setDuration(&c.Registry.DiscoveryInterval)},
+		{"REGISTRY_SECONDARY_REGION", setString(&c.Registry.SecondaryRegion)},
+		{"HEARTBEAT_FRESHNESS", setDuration(&c.Registry.HeartbeatFreshness)},
+		{"HEARTBEAT_SWEEP_INTERVAL", setDuration(&c.Registry.HeartbeatSweepInterval)},
+		{"REGISTRY_ROLE_ARN", setString(&c.Registry.RoleARN)},
+		{"REGISTRY_EXTERNAL_ID", setString(&c.Registry.ExternalID)},
+
+		{"HEALTH_PORT", setString(&c.Server.Port)},
+		{"HEALTH_TLS_CERT", setString(&c.Server.TLSCert)},
+		{"HEALTH_TLS_KEY", setString(&c.Server.TLSKey)},
+		{"ADMIN_API_KEY", setString(&c.Server.AdminAPIKey)},
+		{"ADMIN_IAM_PRINCIPALS", setList(&c.Server.AdminIAMPrincipals)},
+		{"ADMIN_IAM_SERVER_ID", setString(&c.Server.AdminIAMServerID)},
+		{"ADMIN_AUTH_REGISTRY", c.setAdminAuth(AuthGroupRegistry)},
+		{"ADMIN_AUTH_OPERATIONS", c.setAdminAuth(AuthGroupOperations)},
+		{"ADMIN_AUTH_DEBUG", c.setAdminAuth(AuthGroupDebug)},
+		{"ADMIN_AUTH_PROCESS", c.setAdminAuth(AuthGroupProcess)},
+		{"PPROF_ENABLED", setBool(&c.Server.Pprof)},
+		{"PROCESS_TIMEOUT", setDuration(&c.Server.ProcessTimeout)},
+		{"PROCESS_CONCURRENCY", setInt(&c.Server.ProcessConcurrency)},
+		{"GRPC_PORT", setString(&c.Server.GRPCPort)},
+		{"STATE_DUMP_DIR", setString(&c.Server.StateDumpDir)},
+
+		{"ALERT_SNS_TOPIC_ARN", setString(&c.Alerts.SNSTopicARN)},
+		{"ALERT_COOLDOWN", setDuration(&c.Alerts.Cooldown)},
+		{"ALERT_DLQ_URL", setString(&c.Alerts.DLQURL)},
+		{"ALERT_DLQ_THRESHOLD", setInt64(&c.Alerts.DLQThreshold)},
+		{"ALERT_INTEGRITY_THRESHOLD", setFloat(&c.Alerts.IntegrityThreshold)},
+		{"ALERT_LATENCY_SLO", setDuration(&c.Alerts.LatencySLO)},
+		{"ALERT_CHECK_INTERVAL", setDuration(&c.Alerts.CheckInterval)},
+		{"WEBHOOK_URL", setString(&c.Alerts.WebhookURL)},
+		{"WEBHOOK_RATE_LIMIT", setInt(&c.Alerts.WebhookRateLimit)},
+		{"WEBHOOK_TEMPLATES_FILE", setString(&c.Alerts.WebhookTemplatesFile)},
+
+		{"EMF_METRICS", setBool(&c.Metrics.EMF)},
+		{"EMF_NAMESPACE", setString(&c.Metrics.EMFNamespace)},
+		{"EMF_FLUSH_INTERVAL", setDuration(&c.Metrics.EMFFlushInterval)},
+		{"COLD_START_LOG_TAIL", setBool(&c.Metrics.ColdStartLogTail)},
+
+		{"FLAGS_TABLE", setString(&c.Flags.Table)},
+		{"FLAGS_POLL_INTERVAL", setDuration(&c.Flags.PollInterval)},
+		{"SCHEDULER_JITTER", setDuration(&c.Scheduler.Jitter)},
+		{"EVENT_BUS_NAME", setString(&c.Events.BusName)},
+		{"EVENT_SOURCE", setString(&c.Events.Source)},
+		{"KAFKA_BROKERS", setList(&c.Kafka.Brokers)},
+		{"KAFKA_TOPICS", setList(&c.Kafka.Topics)},
+		{"KAFKA_GROUP_ID", setString(&c.Kafka.GroupID)},
+		{"KAFKA_TLS", setBool(&c.Kafka.TLS)},
+		{"KAFKA_USERNAME", setString(&c.Kafka.Username)},
+		{"KAFKA_PASSWORD", setString(&c.Kafka.Password)},
+		{"KAFKA_MAX_ATTEMPTS", setInt(&c.Kafka.MaxAttempts)},
+		{"KAFKA_RETRY_BACKOFF", setDuration(&c.Kafka.RetryBackoff)},
+		{"KINESIS_STREAM", setString(&c.Kinesis.Stream)},
+		{"KINESIS_LEASE_TABLE", setString(&c.Kinesis.LeaseTable)},
+		{"KINESIS_BATCH_SIZE", setInt(&c.Kinesis.BatchSize)},
+		{"KINESIS_POLL_INTERVAL", setDuration(&c.Kinesis.PollInterval)},
+		{"KINESIS_LEASE_DURATION", setDuration(&c.Kinesis.LeaseDuration)},
+		{"KINESIS_MAX_ATTEMPTS", setInt(&c.Kinesis.MaxAttempts)},
+		{"KINESIS_RETRY_BACKOFF", setDuration(&c.Kinesis.RetryBackoff)},
+		{"RABBITMQ_URL", setString(&c.RabbitMQ.URL)},
+		{"RABBITMQ_QUEUE", setString(&c.RabbitMQ.Queue)},
+		{"RABBITMQ_PREFETCH", setInt(&c.RabbitMQ.Prefetch)},
+		{"RABBITMQ_RECONNECT_DELAY", setDuration(&c.RabbitMQ.ReconnectDelay)},
+		{"RABBITMQ_MAX_ATTEMPTS", setInt(&c.RabbitMQ.MaxAttempts)},
+		{"RABBITMQ_RETRY_BACKOFF", setDuration(&c.RabbitMQ.RetryBackoff)},
+		{"NATS_URL", setString(&c.NATS.URL)},
+		{"NATS_CREDENTIALS_FILE", setString(&c.NATS.CredentialsFile)},
+		{"NATS_STREAM", setString(&c.NATS.Stream)},
+		{"NATS_CONSUMER", setString(&c.NATS.Consumer)},
+		{"NATS_SUBJECT", setString(&c.NATS.Subject)},
+		{"NATS_BATCH_SIZE", setInt(&c.NATS.BatchSize)},
+		{"NATS_ACK_WAIT", setDuration(&c.NATS.AckWait)},
+		{"NATS_MAX_DELIVER", setInt(&c.NATS.MaxDeliver)},
+		{"NATS_RETRY_BACKOFF", setDuration(&c.NATS.RetryBackoff)},
+
+		{"TENANT_FIELD", setString(&c.Tenants.Field)},
+		{"TENANT_MAX_IN_FLIGHT", setInt(&c.Tenants.MaxInFlight)},
+		{"TENANT_MAX_RATE", setFloat(&c.Tenants.MaxRate)},
+		{"SCHEMAS_LOCATION", setString(&c.Schemas.Location)},
+		{"QUARANTINE_QUEUE_URL", setString(&c.Schemas.QuarantineQueueURL)},
+		{"PROTOBUF_DESCRIPTOR_SET", setString(&c.Protobuf.DescriptorSet)},
+		{"PROTOBUF_FORWARD", setString(&c.Protobuf.Forward)},
+		{"CLOUDEVENTS_ACCEPT", setBool(&c.CloudEvents.Accept)},
+		{"CLOUDEVENTS_EMIT", setBool(&c.CloudEvents.Emit)},
+		{"CLOUDEVENTS_SOURCE", setString(&c.CloudEvents.Source)},
+
+		{"OUTBOX_TABLE", setString(&c.Outbox.Table)},
+		{"OUTBOX_STATUS_INDEX", setString(&c.Outbox.StatusIndex)},
+		{"OUTBOX_BATCH_SIZE", setInt(&c.Outbox.BatchSize)},
+		{"OUTBOX_POLL_INTERVAL", setDuration(&c.Outbox.PollInterval)},
+		{"OUTBOX_CLAIM_TIMEOUT", setDuration(&c.Outbox.ClaimTimeout)},
+		{"OUTBOX_MAX_ATTEMPTS", setInt(&c.Outbox.MaxAttempts)},
+		{"ARCHIVE_BUCKET", setString(&c.Archive.Bucket)},
+		{"ARCHIVE_PREFIX", setString(&c.Archive.Prefix)},
+		{"ARCHIVE_BATCH_SIZE", setInt(&c.Archive.BatchSize)},
+		{"ARCHIVE_FLUSH_INTERVAL", setDuration(&c.Archive.FlushInterval)},
+		{"WORKFLOWS_TABLE", setString(&c.Workflows.Table)},
+		{"WORKFLOWS_TYPE_FIELD", setString(&c.Workflows.TypeField)},
+		{"WORKFLOWS_STATE_TTL", setDuration(&c.Workflows.StateTTL)},
+		{"CHAOS_LATENCY_RATE", setFloat(&c.Chaos.LatencyRate)},
+		{"CHAOS_MAX_LATENCY", setDuration(&c.Chaos.MaxLatency)},
+		{"CHAOS_LAMBDA_ERROR_RATE", setFloat(&c.Chaos.LambdaErrorRate)},
+		{"CHAOS_DYNAMODB_ERROR_RATE", setFloat(&c.Chaos.DynamoDBErrorRate)},
+		{"COST_ESTIMATION", setBool(&c.Costs.Enabled)},
+		{"LAMBDA_PRICE_PER_GB_SECOND", setFloat(&c.Costs.PricePerGBSecond)},
+		{"LAMBDA_PRICE_PER_REQUEST", setFloat(&c.Costs.PricePerRequest)},
+		{"BUDGET_HOURLY_USD", setFloat(&c.Budget.HourlyUSD)},
+		{"BUDGET_DAILY_USD", setFloat(&c.Budget.DailyUSD)},
+		{"BUDGET_HOURLY_INVOCATIONS", setFloat(&c.Budget.HourlyInvocations)},
+		{"BUDGET_DAILY_INVOCATIONS", setFloat(&c.Budget.DailyInvocations)},
+		{"BUDGET_CRITICAL_TYPES", setList(&c.Budget.CriticalTypes)},
+		{"BUDGET_POLL_DELAY", setDuration(&c.Budget.PollDelay)},
+		{"BUDGET_CHECK_INTERVAL", setDuration(&c.Budget.CheckInterval)},
+	}
+}
+
+func (c *Config) applyEnv() error {
+	for _, override := range c.envOverrides() {
+		value, ok := os.LookupEnv(override.name)
+		if !ok {
+			continue
+		}
+		if err := override.apply(value); err != nil {
+			return fmt.Errorf("invalid %s %q: %w", override.name, value, err)
+		}
+	}
+	return nil
+}
+
+func (c *Config) setAdminAuth(group string) func(string) error {
+	return func(value string) error {
+		if c.Server.AdminAuth == nil {
+			c.Server.AdminAuth = make(map[string][]string)
+		}
+		c.Server.AdminAuth[group] = SplitList(value)
+		return nil
+	}
+}
+
+// Validate reports every invalid setting at once
+func (c *Config) Validate() error {
+	var errs []error
+	check := func(ok bool, format string, args ...any) {
+		if !ok {
+			errs = append(errs, fmt.Errorf(format, args...))
+		}
+	}
+
+	check(regionPattern.MatchString(c.Region), "region %q is not an AWS region, e.g. us-east-1", c.Region)
+	check(c.SSMPath == "" || strings.HasPrefix(c.SSMPath, "/"), "ssmPath must start with /")
+	check(c.SecretsRefreshInterval >= 0, "secretsRefreshInterval must not be negative")
+	check(c.AWS.MaxAttempts > 0, "aws.maxAttempts must be positive")
+	check(c.AWS.HTTPTimeout > 20*time.Second, "aws.httpTimeout must exceed the 20s SQS long poll")
+	check(c.AWS.MaxIdleConns > 0, "aws.maxIdleConns must be positive")
+	check(c.Failover.Threshold > 0, "failover.threshold must be positive")
+	check(c.Failover.FailbackAfter > 0, "failover.failbackAfter must be positive")
+	check(len(c.Consumer.SQSQueues()) > 0 || c.hasOtherSource(),
+		"consumer.queueUrl (SQS_QUEUE_URL) is required unless consumer.queues, kafka, kinesis, rabbitmq, nats or outbox is configured")
+	check(c.Consumer.QueueURL == "" || len(c.Consumer.Queues) == 0, "consumer.queueUrl and consumer.queues are mutually exclusive")
+	check(!c.Consumer.Sharding || len(c.Consumer.SQSQueues()) > 0, "consumer.sharding splits SQS queues and none is configured")
+	check(c.Consumer.QueueURL == "" || isHTTPURL(c.Consumer.QueueURL),
+		"consumer.queueUrl %q must be an https:// queue URL", c.Consumer.QueueURL)
+	seenQueues := make(map[string]bool)
+	for i, queue := range c.Consumer.Queues {
+		check(isHTTPURL(queue.URL), "consumer.queues[%d].url %q must be an https:// queue URL", i, queue.URL)
+		check(queue.Weight >= 1, "consumer.queues[%d].weight must be at least 1", i)
+		check(!seenQueues[queue.URL], "consumer.queues[%d]: duplicate queue %s", i, queue.URL)
+		seenQueues[queue.URL] = true
+	}
+	check(c.Consumer.StarvationTimeout > 0, "consumer.starvationTimeout must be positive")
+	check(c.Consumer.MinPollers >= 1 && c.Consumer.MaxPollers >= c.Consumer.MinPollers && c.Consumer.MaxPollers <= 100,
+		"consumer.minPollers must be at least 1 and consumer.maxPollers between it and 100")
+	check(c.Consumer.PollerDrainTarget > 0, "consumer.pollerDrainTarget must be positive")
+	check(c.Consumer.MaxPollers == c.Consumer.MinPollers || c.Consumer.QueueMonitorInterval > 0,
+		"consumer.maxPollers scales on the queue depth and needs consumer.queueMonitorInterval")
+	check(c.Consumer.OutputQueueURL == "" || isHTTPURL(c.Consumer.OutputQueueURL),
+		"consumer.outputQueueUrl %q must be an https:// queue URL", c.Consumer.OutputQueueURL)
+	for _, queue := range c.Consumer.SQSQueues() {
+		check(c.Consumer.OutputQueueURL != queue.URL, "consumer.outputQueueUrl must differ from the consumed queues")
+	}
+	check(isFunctionRef(c.Consumer.IntegrityLambda),
+		"consumer.integrityLambda %q must be a Lambda function name or ARN", c.Consumer.IntegrityLambda)
+	check(c.Consumer.ExactlyOnceTable == "" || tableNamePattern.MatchString(c.Consumer.ExactlyOnceTable),
+		"consumer.exactlyOnceTable %q is not a valid DynamoDB table name", c.Consumer.ExactlyOnceTable)
+	check(tableNamePattern.MatchString(c.Consumer.StateTable),
+		"consumer.stateTable %q is not a valid DynamoDB table name (3-255 of A-Z a-z 0-9 _ . -)", c.Consumer.StateTable)
+	check(c.Consumer.HeartbeatInterval >= 0, "consumer.heartbeatInterval must not be negative")
+	check(c.Consumer.HeartbeatInterval > 0 || (!c.Consumer.Sharding && c.Consumer.HandoffDuration == 0),
+		"consumer.sharding and consumer.handoffDuration need the heartbeats, set consumer.heartbeatInterval")
+	check(c.Consumer.LivenessThreshold > 0, "consumer.livenessThreshold must be positive")
+	check(c.Consumer.QueueMonitorInterval >= 0, "consumer.queueMonitorInterval must not be negative")
+	check(c.Consumer.LeaderLease == 0 || c.Consumer.LeaderLease >= 3*time.Second,
+		"consumer.leaderLease must be 0 (disabled) or at least 3s")
+	check(c.Consumer.LeaderBackend == LeaderBackendDynamoDB || c.Consumer.LeaderBackend == LeaderBackendKubernetes,
+		"consumer.leaderBackend %q must be %s or %s", c.Consumer.LeaderBackend, LeaderBackendDynamoDB, LeaderBackendKubernetes)
+	check(c.Consumer.LeaderBackend != LeaderBackendKubernetes || leaseNamePattern.MatchString(c.Consumer.LeaderLeaseName),
+		"consumer.leaderLeaseName %q is not a valid Kubernetes name (lowercase alphanumerics, - and ., at most 253)", c.Consumer.LeaderLeaseName)
+	check(c.Consumer.MaxRate >= 0, "consumer.maxRate must not be negative")
+	check(slices.Contains([]string{RoutingWeighted, RoutingUniform, RoutingLatency}, c.Consumer.RoutingStrategy),
+		"consumer.routingStrategy must be weighted, uniform or latency, got %q", c.Consumer.RoutingStrategy)
+	check(c.Consumer.FailureRetention >= 0, "consumer.failureRetention must not be negative")
+	check(c.Consumer.HandoffDuration >= 0, "consumer.handoffDuration must not be negative")
+	check(!c.Consumer.TaskProtection || (c.Consumer.TaskProtectionExpiry >= time.Minute && c.Consumer.TaskProtectionExpiry <= 48*time.Hour),
+		"consumer.taskProtectionExpiry must be between 1m and 48h")
+
+	check(c.Router.AuditStream == "" || streamNamePattern.MatchString(c.Router.AuditStream),
+		"router.auditStream %q is not a valid Kinesis stream name", c.Router.AuditStream)
+
+	check(tableNamePattern.MatchString(c.Registry.Table),
+		"registry.table %q is not a valid DynamoDB table name (3-255 of A-Z a-z 0-9 _ . -)", c.Registry.Table)
+	check(c.Registry.StatusIndex == "" || tableNamePattern.MatchString(c.Registry.StatusIndex),
+		"registry.statusIndex %q is not a valid DynamoDB index name", c.Registry.StatusIndex)
+	check(c.Registry.SecondaryRegion == "" || regionPattern.MatchString(c.Registry.SecondaryRegion),
+		"registry.secondaryRegion %q is not an AWS region", c.Registry.SecondaryRegion)
+	check(c.Registry.SecondaryRegion != c.Region, "registry.secondaryRegion must differ from region")
+	check(c.Registry.TTLGrace >= 0, "registry.ttlGrace must not be negative")
+	check(c.Registry.HeartbeatFreshness >= 0, "registry.heartbeatFreshness must not be negative")
+	check(c.Registry.HeartbeatFreshness == 0 || c.Registry.TTLGrace == 0 || c.Registry.HeartbeatFreshness < c.Registry.TTLGrace,
+		"registry.heartbeatFreshness must be shorter than registry.ttlGrace, or silent Lambdas expire before being demoted")
+	check(c.Registry.HeartbeatSweepInterval > 0, "registry.heartbeatSweepInterval must be positive")
+	check(c.Registry.DAXEndpoint == "" || strings.HasPrefix(c.Registry.DAXEndpoint, "dax://") || strings.HasPrefix(c.Registry.DAXEndpoint, "daxs://"),
+		"registry.daxEndpoint %q must start with dax:// or daxs://", c.Registry.DAXEndpoint)
+	check(c.Registry.ReconcileInterval >= 0, "registry.reconcileInterval must not be negative")
+	check(c.Registry.DiscoveryInterval > 0, "registry.discoveryInterval must be positive")
+	if c.Registry.DiscoveryTag != "" {
+		key, value, ok := strings.Cut(c.Registry.DiscoveryTag, "=")
+		check(ok && key != "" && value != "", "registry.discoveryTag must be key=value")
+	}
+
+	checkRole := func(setting, roleARN, externalID string) {
+		check(roleARN == "" || isARN(roleARN, "iam"), "%s %q must be an IAM role ARN", setting, roleARN)
+		check(externalID == "" || roleARN != "", "%s requires %s", strings.Replace(setting, "RoleArn", "ExternalId", 1), setting)
+	}
+	checkRole("registry.roleArn", c.Registry.RoleARN, c.Registry.ExternalID)
+	checkRole("router.lambdaRoleArn", c.Router.LambdaRoleARN, c.Router.LambdaExternalID)
+	check(c.Router.StepFunctionsPollInterval > 0, "router.stepFunctionsPollInterval must be positive")
+	check(c.Router.RulesTable == "" || tableNamePattern.MatchString(c.Router.RulesTable),
+		"router.rulesTable %q is not a valid DynamoDB table name", c.Router.RulesTable)
+	check(c.Router.RulesTable == "" || c.Router.RulesPollInterval > 0, "router.rulesPollInterval must be positive")
+	check(c.Router.FanOutSuccessThreshold > 0 && c.Router.FanOutSuccessThreshold <= 1,
+		"router.fanOutSuccessThreshold must be greater than 0 and at most 1")
+	check(c.Router.BatchSize == 0 || (c.Router.BatchSize >= 2 && c.Router.BatchSize <= 100),
+		"router.batchSize must be 0 (disabled) or between 2 and 100")
+	check(c.Router.BatchSize == 0 || (c.Router.BatchWindow > 0 && c.Router.BatchWindow <= 10*time.Second),
+		"router.batchWindow must be between 1ms and 10s")
+	if eviction := c.Router.Eviction; eviction.ErrorRate != 0 {
+		check(eviction.ErrorRate > 0 && eviction.ErrorRate < 1, "router.eviction.errorRate must be between 0 and 1")
+		check(eviction.MinRequests > 0, "router.eviction.minRequests must be positive")
+		check(eviction.Probation > 0, "router.eviction.probation must be positive")
+		check(eviction.ProbeRate > 0 && eviction.ProbeRate <= 1, "router.eviction.probeRate must be greater than 0 and at most 1")
+		check(eviction.ProbeSuccesses > 0, "router.eviction.probeSuccesses must be positive")
+	}
+	for _, messageType := range slices.Sorted(maps.Keys(c.Router.Quorum)) {
+		check(c.Router.Quorum[messageType] >= 2, "router.quorum of %s must be at least 2 workers", messageType)
+		check(!slices.Contains(c.Router.FanOutTypes, messageType), "router.quorum type %s is also in router.fanOutTypes", messageType)
+	}
+
+	check(isPort(c.Server.Port), "server.port %q must be a port number between 1 and 65535", c.Server.Port)
+	check((c.Server.TLSCert == "") == (c.Server.TLSKey == ""), "server.tlsCert and server.tlsKey must be set together")
+	for setting, path := range map[string]string{"server.tlsCert": c.Server.TLSCert, "server.tlsKey": c.Server.TLSKey} {
+		check(path == "" || isReadableFile(path), "%s %q cannot be read", setting, path)
+	}
+	check(len(c.Server.AdminIAMPrincipals) == 0 || c.Server.AdminIAMServerID != "",
+		"server.adminIamServerId is required with server.adminIamPrincipals")
+	for _, principal := range c.Server.AdminIAMPrincipals {
+		check(strings.HasPrefix(principal, "arn:"), "server.adminIamPrincipals: %q must be an ARN pattern", principal)
+	}
+	for group, methods := range c.Server.AdminAuth {
+		check(group == AuthGroupRegistry || group == AuthGroupOperations || group == AuthGroupDebug || group == AuthGroupProcess,
+			"server.adminAuth: unknown endpoint group %q", group)
+		for _, method := range methods {
+			check(method == "apikey" || method == "iam", "server.adminAuth.%s: unknown method %q", group, method)
+		}
+	}
+	check(c.Server.ProcessTimeout > 0, "server.processTimeout must be positive")
+	check(c.Server.ProcessConcurrency >= 0, "server.processConcurrency must not be negative")
+	check(c.Server.GRPCPort == "" || isPort(c.Server.GRPCPort), "server.grpcPort %q must be a port number between 1 and 65535", c.Server.GRPCPort)
+	check(c.Server.GRPCPort == "" || c.Server.GRPCPort != c.Server.Port, "server.grpcPort must differ from server.port")
+
+	check(c.Alerts.SNSTopicARN == "" || isARN(c.Alerts.SNSTopicARN, "sns"),
+		"alerts.snsTopicArn %q must be an SNS topic ARN", c.Alerts.SNSTopicARN)
+	check(c.Alerts.DLQURL == "" || isHTTPURL(c.Alerts.DLQURL), "alerts.dlqUrl %q must be an https:// queue URL", c.Alerts.DLQURL)
+	check(c.Alerts.WebhookURL == "" || isHTTPURL(c.Alerts.WebhookURL), "alerts.webhookUrl must be an http(s) URL")
+	check(c.Alerts.WebhookTemplatesFile == "" || isReadableFile(c.Alerts.WebhookTemplatesFile),
+		"alerts.webhookTemplatesFile %q cannot be read", c.Alerts.WebhookTemplatesFile)
+	check(c.Alerts.Cooldown >= 0, "alerts.cooldown must not be negative")
+	check(c.Alerts.DLQThreshold > 0, "alerts.dlqThreshold must be positive")
+	check(c.Alerts.IntegrityThreshold >= 0, "alerts.integrityThreshold must not be negative")
+	check(c.Alerts.LatencySLO >= 0, "alerts.latencySlo must not be negative")
+	check(c.Alerts.CheckInterval > 0, "alerts.checkInterval must be positive")
+	check(c.Alerts.WebhookRateLimit > 0, "alerts.webhookRateLimit must be positive")
+
+	check(c.Metrics.EMFNamespace != "", "metrics.emfNamespace is required")
+	check(c.Metrics.EMFFlushInterval > 0, "metrics.emfFlushInterval must be positive")
+	check(c.Metrics.ColdStartFactor > 1, "metrics.coldStartFactor must be greater than 1")
+	check(c.Metrics.ColdStartMinExtra >= 0, "metrics.coldStartMinExtra must not be negative")
+
+	check(c.Flags.Table == "" || tableNamePattern.MatchString(c.Flags.Table),
+		"flags.table %q is not a valid DynamoDB table name", c.Flags.Table)
+	check(c.Flags.PollInterval > 0, "flags.pollInterval must be positive")
+
+	check(c.Events.BusName == "" || eventBusPattern.MatchString(c.Events.BusName) || isARN(c.Events.BusName, "events"),
+		"events.busName %q is not an EventBridge bus name or ARN", c.Events.BusName)
+	check(c.Events.Source != "" && !strings.HasPrefix(c.Events.Source, "aws."),
+		"events.source %q must be set and must not start with aws.", c.Events.Source)
+
+	if len(c.Kafka.Brokers) > 0 {
+		for _, broker := range c.Kafka.Brokers {
+			_, port, err := net.SplitHostPort(broker)
+			check(err == nil && isPort(port), "kafka.brokers entry %q must be host:port", broker)
+		}
+		check(len(c.Kafka.Topics) > 0, "kafka.topics is required with kafka.brokers")
+		check(c.Kafka.GroupID != "", "kafka.groupId is required with kafka.brokers")
+		check(c.Kafka.Password == "" || c.Kafka.Username != "", "kafka.password requires kafka.username")
+		check(c.Kafka.MaxAttempts >= 1, "kafka.maxAttempts must be at least 1")
+		check(c.Kafka.RetryBackoff > 0, "kafka.retryBackoff must be positive")
+	}
+
+	if c.Kinesis.Stream != "" {
+		check(streamNamePattern.MatchString(c.Kinesis.Stream), "kinesis.stream %q is not a valid stream name", c.Kinesis.Stream)
+		check(c.Kinesis.LeaseTable == "" || tableNamePattern.MatchString(c.Kinesis.LeaseTable),
+			"kinesis.leaseTable %q is not a valid DynamoDB table name", c.Kinesis.LeaseTable)
+		check(c.Kinesis.BatchSize >= 1 && c.Kinesis.BatchSize <= 10000, "kinesis.batchSize must be between 1 and 10000")
+		check(c.Kinesis.PollInterval > 0, "kinesis.pollInterval must be positive")
+		check(c.Kinesis.LeaseDuration >= 3*time.Second, "kinesis.leaseDuration must be at least 3s")
+		check(c.Kinesis.MaxAttempts >= 1, "kinesis.maxAttempts must be at least 1")
+		check(c.Kinesis.RetryBackoff > 0, "kinesis.retryBackoff must be positive")
+	}
+
+	if c.RabbitMQ.URL != "" {
+		u, err := url.Parse(c.RabbitMQ.URL)
+		check(err == nil && (u.Scheme == "amqp" || u.Scheme == "amqps") && u.Host != "",
+			"rabbitmq.url must be an amqp:// or amqps:// URL")
+		check(c.RabbitMQ.Queue != "", "rabbitmq.queue is required with rabbitmq.url")
+		check(c.RabbitMQ.Prefetch >= 1 && c.RabbitMQ.Prefetch <= 65535, "rabbitmq.prefetch must be between 1 and 65535")
+		check(c.RabbitMQ.ReconnectDelay > 0, "rabbitmq.reconnectDelay must be positive")
+		check(c.RabbitMQ.MaxAttempts >= 1, "rabbitmq.maxAttempts must be at least 1")
+		check(c.RabbitMQ.RetryBackoff > 0, "rabbitmq.retryBackoff must be positive")
+	}
+
+	if c.NATS.URL != "" {
+		u, err := url.Parse(c.NATS.URL)
+		check(err == nil && (u.Scheme == "nats" || u.Scheme == "tls") && u.Host != "",
+			"nats.url %q must be a nats:// or tls:// URL", c.NATS.URL)
+		check(c.NATS.CredentialsFile == "" || isReadableFile(c.NATS.CredentialsFile),
+			"nats.credentialsFile %q is not readable", c.NATS.CredentialsFile)
+		check(c.NATS.Stream != "", "nats.stream is required with nats.url")
+		check(c.NATS.Consumer != "", "nats.consumer is required with nats.url")
+		check(c.NATS.BatchSize >= 1, "nats.batchSize must be at least 1")
+		check(c.NATS.AckWait > 0, "nats.ackWait must be positive")
+		check(c.NATS.MaxDeliver >= 1, "nats.maxDeliver must be at least 1")
+		check(c.NATS.RetryBackoff > 0, "nats.retryBackoff must be positive")
+	}
+
+	check(c.Tenants.MaxInFlight >= 0 && c.Tenants.MaxRate >= 0, "tenants.maxInFlight and tenants.maxRate must not be negative")
+	for _, tenant := range slices.Sorted(maps.Keys(c.Tenants.Overrides)) {
+		limits := c.Tenants.Overrides[tenant]
+		check(limits.MaxInFlight >= 0 && limits.MaxRate >= 0,
+			"tenants.overrides.%s: maxInFlight and maxRate must not be negative", tenant)
+	}
+
+	if c.Protobuf.DescriptorSet != "" {
+		check(isReadableFile(c.Protobuf.DescriptorSet), "protobuf.descriptorSet %q is not readable", c.Protobuf.DescriptorSet)
+		check(c.Protobuf.TypeAttribute != "" || c.Protobuf.DefaultType != "",
+			"protobuf.typeAttribute or protobuf.defaultType is required with protobuf.descriptorSet")
+		check(c.Protobuf.Forward == ProtobufForwardJSON || c.Protobuf.Forward == ProtobufForwardBytes,
+			"protobuf.forward must be %s or %s", ProtobufForwardJSON, ProtobufForwardBytes)
+	}
+
+	if c.Schemas.Location != "" {
+		location := c.Schemas.Location
+		if bucket, ok := strings.CutPrefix(location, "s3://"); ok {
+			bucket, _, _ = strings.Cut(bucket, "/")
+			check(bucket != "", "schemas.location %q has no bucket", location)
+		} else {
+			info, err := os.Stat(location)
+			check(err == nil && info.IsDir(), "schemas.location %q is not a directory", location)
+		}
+		check(c.Schemas.RefreshInterval >= 0, "schemas.refreshInterval must not be negative")
+	}
+	check(c.Schemas.QuarantineQueueURL == "" || c.Schemas.Location != "", "schemas.quarantineQueueUrl requires schemas.location")
+	check(c.Schemas.QuarantineQueueURL == "" || isHTTPURL(c.Schemas.QuarantineQueueURL),
+		"schemas.quarantineQueueUrl %q must be an https:// queue URL", c.Schemas.QuarantineQueueURL)
+
+	if c.CloudEvents.Emit {
+		check(c.CloudEvents.Source != "", "cloudEvents.source is required with cloudEvents.emit")
+		check(c.CloudEvents.TypePrefix != "", "cloudEvents.typePrefix is required with cloudEvents.emit")
+	}
+
+	if c.Outbox.Table != "" {
+		check(tableNamePattern.MatchString(c.Outbox.Table), "outbox.table %q is not a valid DynamoDB table name", c.Outbox.Table)
+		check(tableNamePattern.MatchString(c.Outbox.StatusIndex), "outbox.statusIndex %q is not a valid DynamoDB index name", c.Outbox.StatusIndex)
+		check(c.Outbox.BatchSize >= 1, "outbox.batchSize must be at least 1")
+		check(c.Outbox.PollInterval > 0, "outbox.pollInterval must be positive")
+		check(c.Outbox.ClaimTimeout > 0, "outbox.claimTimeout must be positive")
+		check(c.Outbox.MaxAttempts >= 1, "outbox.maxAttempts must be at least 1")
+	}
+
+	if c.Archive.Bucket != "" {
+		check(bucketNamePattern.MatchString(c.Archive.Bucket), "archive.bucket %q is not a valid S3 bucket name", c.Archive.Bucket)
+		check(!strings.HasPrefix(c.Archive.Prefix, "/") && !strings.HasSuffix(c.Archive.Prefix, "/"),
+			"archive.prefix %q must not start or end with /", c.Archive.Prefix)
+		check(c.Archive.BatchSize >= 1, "archive.batchSize must be at least 1")
+		check(c.Archive.FlushInterval > 0, "archive.flushInterval must be positive")
+	}
+
+	if c.Workflows.Table != "" {
+		check(c.Workflows.TypeField != "", "workflows.typeField is required with workflows.table")
+		check(c.Workflows.StateTTL > 0, "workflows.stateTTL must be positive")
+	}
+	check(c.Workflows.Table != "" || len(c.Workflows.Definitions) == 0, "workflows.definitions need workflows.table to keep their state")
+
+	check(c.Chaos.LatencyRate >= 0 && c.Chaos.LatencyRate <= 1, "chaos.latencyRate must be between 0 and 1")
+	check(c.Chaos.LambdaErrorRate >= 0 && c.Chaos.LambdaErrorRate <= 1, "chaos.lambdaErrorRate must be between 0 and 1")
+	check(c.Chaos.DynamoDBErrorRate >= 0 && c.Chaos.DynamoDBErrorRate <= 1, "chaos.dynamodbErrorRate must be between 0 and 1")
+	check(c.Chaos.MaxLatency >= 0, "chaos.maxLatency must not be negative")
+
+	check(c.Costs.PricePerGBSecond >= 0 && c.Costs.PricePerRequest >= 0, "costs prices must not be negative")
+	check(c.Budget.HourlyUSD >= 0 && c.Budget.DailyUSD >= 0, "budget spend caps must not be negative")
+	check(c.Budget.HourlyInvocations >= 0 && c.Budget.DailyInvocations >= 0, "budget invocation caps must not be negative")
+	if c.Budget.Enabled() {
+		check(c.Budget.PollDelay >= 0, "budget.pollDelay must not be negative")
+		check(c.Budget.CheckInterval > 0, "budget.checkInterval must be positive")
+	}
+
+	check(c.Scheduler.Jitter >= 0, "scheduler.jitter must not be negative")
+
+	return errors.Join(errs...)
+}
+
+func setString(target *string) func(string) error {
+	return func(value string) error {
+		*target = value
+		return nil
+	}
+}
+
+func setDuration(target *time.Duration) func(string) error {
+	return func(value string) (err error) {
+		*target, err = time.ParseDuration(value)
+		return err
+	}
+}
+
+func setBool(target *bool) func(string) error {
+	return func(value string) (err error) {
+		*target, err = strconv.ParseBool(value)
+		return err
+	}
+}
+
+func setInt(target *int) func(string) error {
+	return func(value string) (err error) {
+		*target, err = strconv.Atoi(value)
+		return err
+	}
+}
+
+func setInt64(target *int64) func(string) error {
+	return func(value string) (err error) {
+		*target, err = strconv.ParseInt(value, 10, 64)
+		return err
+	}
+}
+
+func setFloat(target *float64) func(string) error {
+	return func(value string) (err error) {
+		*target, err = strconv.ParseFloat(value, 64)
+		return err
+	}
+}
+
+func setList(target *[]string) func(string) error {
+	return func(value string) error {
+		*target = SplitList(value)
+		return nil
+	}
+}
+
+// SplitList splits a comma-separated list, dropping empty items
+func SplitList(value string) []string {
+	var items []string
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
@@ -0,0 +1,75 @@
+package config
+
+import (
+	"fmt"
+	"log/slog"
+	"os"
+	"slices"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// profile is a named environment profile of a configuration file. It
+// overrides any subset of the settings and may extend another profile,
+// whose overrides are applied first.
+type profile struct {
+	*Config `yaml:",inline"`
+	Extends string `yaml:"extends"`
+}
+
+// applyProfile applies the profile named by APP_ENV, with its ancestors, on
+// top of the base settings of the file. Files without profiles ignore
+// APP_ENV.
+func (c *Config) applyProfile(profiles map[string]yaml.Node) error {
+	name := os.Getenv("APP_ENV")
+	if name == "" || len(profiles) == 0 {
+		return nil
+	}
+
+	// Walk up the extends chain, then apply from the root down
+	var chain []string
+	for current := name; current != ""; {
+		if slices.Contains(chain, current) {
+			return fmt.Errorf("profile %s extends itself: %s", name, strings.Join(append(chain, current), " -> "))
+		}
+		node, ok := profiles[current]
+		if !ok {
+			return fmt.Errorf("unknown profile %q (APP_ENV), available: %s", current, strings.Join(profileNames(profiles), ", "))
+		}
+		chain = append(chain, current)
+
+		var meta struct {
+			Extends string `yaml:"extends"`
+		}
+		if err := node.Decode(&meta); err != nil {
+			return fmt.Errorf("invalid profile %s: %w", current, err)
+		}
+		current = meta.Extends
+	}
+
+	for i := len(chain) - 1; i >= 0; i-- {
+		// Re-encoded so the settings are decoded strictly, as in the file
+		node := profiles[chain[i]]
+		data, err := yaml.Marshal(&node)
+		if err != nil {
+			return fmt.Errorf("invalid profile %s: %w", chain[i], err)
+		}
+		if err := decodeStrict(data, &profile{Config: c}); err != nil {
+			return fmt.Errorf("invalid profile %s: %w", chain[i], err)
+		}
+	}
+
+	slices.Reverse(chain)
+	slog.Info("Configuration profile applied", "profile", name, "chain", chain)
+	return nil
+}
+
+func profileNames(profiles map[string]yaml.Node) []string {
+	names := make([]string, 0, len(profiles))
+	for name := range profiles {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+	return names
+}
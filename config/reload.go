@@ -0,0 +1,161 @@
+package config
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"os"
+	"os/signal"
+	"reflect"
+	"strings"
+	"sync"
+	"syscall"
+)
+
+// Reloader re-reads the configuration file on SIGHUP. Settings with a
+// registered applier change live; any other change is logged as requiring
+// a restart and otherwise ignored.
+type Reloader struct {
+	path   string
+	checks []func(*Config) error
+
+	mu       sync.Mutex
+	current  *Config
+	appliers map[string]func(*Config)
+}
+
+// NewReloader validates every reload with the same checks as Load
+func NewReloader(path string, current *Config, checks ...func(*Config) error) *Reloader {
+	return &Reloader{
+		path:     path,
+		checks:   checks,
+		current:  current,
+		appliers: make(map[string]func(*Config)),
+	}
+}
+
+// OnChange registers how to apply a setting live. The field is the dotted
+// YAML path, e.g. "alerts.cooldown".
+func (r *Reloader) OnChange(field string, apply func(*Config)) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.appliers[field] = apply
+}
+
+// Start reloads the configuration on every SIGHUP until the context is done
+func (r *Reloader) Start(ctx context.Context) {
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+	defer signal.Stop(hup)
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-hup:
+			if err := r.Reload(); err != nil {
+				slog.Error("Configuration reload failed, keeping the current configuration", "error", err.Error())
+			}
+		}
+	}
+}
+
+// Current returns the configuration in effect, including the settings
+// applied live
+func (r *Reloader) Current() *Config {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.current
+}
+
+// Reload loads and validates the file, then applies the changed settings
+func (r *Reloader) Reload() error {
+	next, err := Load(r.path, r.checks...)
+	if err != nil {
+		return err
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	changed := configDiff(r.current, next)
+	if len(changed) == 0 {
+		slog.Info("Configuration reloaded, no changes")
+		return nil
+	}
+
+	var applied, restart []string
+	for _, field := range changed {
+		if apply, ok := r.appliers[field]; ok {
+			apply(next)
+			applied = append(applied, field)
+		} else {
+			restart = append(restart, field)
+		}
+	}
+
+	// Keep the live values of settings that were not applied, so they are
+	// reported again on the next reload until the process restarts
+	for _, field := range restart {
+		copyConfigField(next, r.current, field)
+	}
+	r.current = next
+
+	slog.Info("Configuration reloaded", "applied", applied, "requires_restart", restart)
+	return nil
+}
+
+// configDiff returns the dotted YAML paths of the settings that differ
+func configDiff(a, b *Config) []string {
+	var changed []string
+	walkConfig(reflect.ValueOf(a).Elem(), reflect.ValueOf(b).Elem(), "", &changed)
+	return changed
+}
+
+func walkConfig(a, b reflect.Value, prefix string, changed *[]string) {
+	for i := 0; i < a.NumField(); i++ {
+		field := a.Type().Field(i)
+		if !field.IsExported() {
+			continue
+		}
+		name := prefix + yamlName(field)
+
+		if field.Type.Kind() == reflect.Struct {
+			walkConfig(a.Field(i), b.Field(i), name+".", changed)
+			continue
+		}
+		if !reflect.DeepEqual(a.Field(i).Interface(), b.Field(i).Interface()) {
+			*changed = append(*changed, name)
+		}
+	}
+}
+
+// copyConfigField sets the field at the dotted path of dst from src
+func copyConfigField(dst, src *Config, path string) {
+	d, s := reflect.ValueOf(dst).Elem(), reflect.ValueOf(src).Elem()
+	for _, part := range strings.Split(path, ".") {
+		index := fieldIndex(d.Type(), part)
+		if index < 0 {
+			panic(fmt.Sprintf("config: unknown field %q", path))
+		}
+		d, s = d.Field(index), s.Field(index)
+	}
+	d.Set(s)
+}
+
+func fieldIndex(t reflect.Type, name string) int {
+	for i := 0; i < t.NumField(); i++ {
+		if yamlName(t.Field(i)) == name {
+			return i
+		}
+	}
+	return -1
+}
+
+func yamlName(field reflect.StructField) string {
+	name, _, _ := strings.Cut(field.Tag.Get("yaml"), ",")
+	if name == "" {
+		return field.Name
+	}
+	return name
+}
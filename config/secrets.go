@@ -0,0 +1,164 @@
+package config
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"reflect"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/secretsmanager"
+)
+
+// secretURIScheme marks a string setting whose value lives in Secrets
+// Manager: secretsmanager://<secret-id>[#<json-key>]. Without a key the
+// whole SecretString is used.
+const secretURIScheme = "secretsmanager://"
+
+type secretResolver struct {
+	client *secretsmanager.Client
+	cache  map[string]string // secret id -> SecretString, per resolution
+}
+
+func newSecretResolver(client *secretsmanager.Client) *secretResolver {
+	return &secretResolver{
+		client: client,
+		cache:  make(map[string]string),
+	}
+}
+
+// resolve fetches the value referenced by a secretsmanager:// URI
+func (r *secretResolver) resolve(ctx context.Context, uri string) (string, error) {
+	secretID, key, _ := strings.Cut(strings.TrimPrefix(uri, secretURIScheme), "#")
+	if secretID == "" {
+		return "", fmt.Errorf("invalid secret reference %q", uri)
+	}
+
+	secret, ok := r.cache[secretID]
+	if !ok {
+		out, err := r.client.GetSecretValue(ctx, &secretsmanager.GetSecretValueInput{
+			SecretId: aws.String(secretID),
+		})
+		if err != nil {
+			return "", fmt.Errorf("error reading secret %s: %w", secretID, err)
+		}
+		secret = aws.ToString(out.SecretString)
+		r.cache[secretID] = secret
+	}
+
+	if key == "" {
+		return secret, nil
+	}
+	var fields map[string]any
+	if err := json.Unmarshal([]byte(secret), &fields); err != nil {
+		return "", fmt.Errorf("secret %s is not a JSON object: %w", secretID, err)
+	}
+	value, ok := fields[key]
+	if !ok {
+		return "", fmt.Errorf("secret %s has no key %q", secretID, key)
+	}
+	if s, ok := value.(string); ok {
+		return s, nil
+	}
+	return fmt.Sprint(value), nil
+}
+
+// resolveSecrets replaces every string setting holding a secretsmanager://
+// URI with the secret value and remembers the reference for refreshes
+func (c *Config) resolveSecrets(ctx context.Context) error {
+	refs := map[string]string{}
+	eachStringSetting(reflect.ValueOf(c).Elem(), "", func(path string, v reflect.Value) {
+		if strings.HasPrefix(v.String(), secretURIScheme) {
+			refs[path] = v.String()
+		}
+	})
+	if len(refs) == 0 {
+		return nil
+	}
+
+	awsCfg, err := NewAWSConfig(ctx, c.Region, c.AWS)
+	if err != nil {
+		return err
+	}
+	resolver := newSecretResolver(secretsmanager.NewFromConfig(awsCfg))
+	for path, uri := range refs {
+		value, err := resolver.resolve(ctx, uri)
+		if err != nil {
+			return fmt.Errorf("error resolving %s: %w", path, err)
+		}
+		if err := setConfigField(c, path, value); err != nil {
+			return fmt.Errorf("error resolving %s: %w", path, err)
+		}
+	}
+	c.secretRefs = refs
+
+	slog.Info("Settings resolved from Secrets Manager", "settings", len(refs))
+	return nil
+}
+
+// eachStringSetting calls fn with the dotted YAML path of every string
+// setting
+func eachStringSetting(v reflect.Value, prefix string, fn func(path string, v reflect.Value)) {
+	eachSetting(v, prefix, func(path string, v reflect.Value) {
+		if v.Kind() == reflect.String {
+			fn(path, v)
+		}
+	})
+}
+
+// SecretRefresher periodically re-reads the secrets referenced by the
+// configuration and hands rotated values to the registered callbacks
+type SecretRefresher struct {
+	client   *secretsmanager.Client
+	refs     map[string]string // setting -> secretsmanager:// URI
+	values   map[string]string
+	onRotate map[string]func(value string)
+}
+
+func NewSecretRefresher(cfg *Config, awsCfg aws.Config) *SecretRefresher {
+	values := make(map[string]string, len(cfg.secretRefs))
+	v := reflect.ValueOf(cfg).Elem()
+	eachStringSetting(v, "", func(path string, field reflect.Value) {
+		if _, ok := cfg.secretRefs[path]; ok {
+			values[path] = field.String()
+		}
+	})
+
+	return &SecretRefresher{
+		client:   secretsmanager.NewFromConfig(awsCfg),
+		refs:     cfg.secretRefs,
+		values:   values,
+		onRotate: make(map[string]func(string)),
+	}
+}
+
+// OnRotate registers the callback that applies a new value of setting
+func (s *SecretRefresher) OnRotate(setting string, fn func(value string)) {
+	s.onRotate[setting] = fn
+}
+
+// Refresh re-reads the referenced secrets once
+func (s *SecretRefresher) Refresh(ctx context.Context) error {
+	resolver := newSecretResolver(s.client)
+	for path, uri := range s.refs {
+		value, err := resolver.resolve(ctx, uri)
+		if err != nil {
+			return fmt.Errorf("error resolving %s: %w", path, err)
+		}
+		if value == s.values[path] {
+			continue
+		}
+		s.values[path] = value
+
+		apply, ok := s.onRotate[path]
+		if !ok {
+			slog.Warn("Secret rotated for a setting that requires a restart", "setting", path)
+			continue
+		}
+		apply(value)
+		slog.Info("Rotated secret applied", "setting", path)
+	}
+	return nil
+}
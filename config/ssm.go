@@ -0,0 +1,113 @@
+package config
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/ssm"
+)
+
+var (
+	durationType      = reflect.TypeOf(time.Duration(0))
+	errUnknownSetting = errors.New("unknown setting")
+)
+
+// applySSM loads every parameter under path, decrypting SecureStrings, and
+// sets the setting named by the rest of the parameter name, e.g.
+// <path>/consumer/queueUrl sets consumer.queueUrl. Unknown names are skipped.
+func (c *Config) applySSM(ctx context.Context, path, region string) error {
+	awsCfg, err := NewAWSConfig(ctx, region, c.AWS)
+	if err != nil {
+		return err
+	}
+	client := ssm.NewFromConfig(awsCfg)
+
+	prefix := strings.TrimSuffix(path, "/") + "/"
+	paginator := ssm.NewGetParametersByPathPaginator(client, &ssm.GetParametersByPathInput{
+		Path:           aws.String(prefix),
+		Recursive:      aws.Bool(true),
+		WithDecryption: aws.Bool(true),
+	})
+
+	loaded := 0
+	for paginator.HasMorePages() {
+		page, err := paginator.NextPage(ctx)
+		if err != nil {
+			return fmt.Errorf("error reading SSM parameters under %s: %w", prefix, err)
+		}
+
+		for _, parameter := range page.Parameters {
+			name := aws.ToString(parameter.Name)
+			field := strings.ReplaceAll(strings.TrimPrefix(name, prefix), "/", ".")
+
+			if err := setConfigField(c, field, aws.ToString(parameter.Value)); err != nil {
+				if errors.Is(err, errUnknownSetting) {
+					slog.Warn("Ignoring SSM parameter that matches no setting", "parameter", name)
+					continue
+				}
+				return fmt.Errorf("invalid SSM parameter %s: %w", name, err)
+			}
+			loaded++
+		}
+	}
+
+	slog.Info("Configuration loaded from SSM Parameter Store", "path", prefix, "parameters", loaded)
+	return nil
+}
+
+// setConfigField parses value into the setting at the dotted YAML path.
+// Lists are comma-separated.
+func setConfigField(cfg *Config, path, value string) error {
+	v := reflect.ValueOf(cfg).Elem()
+	for _, part := range strings.Split(path, ".") {
+		if v.Kind() != reflect.Struct {
+			return fmt.Errorf("%w %q", errUnknownSetting, path)
+		}
+		index := fieldIndex(v.Type(), part)
+		if index < 0 {
+			return fmt.Errorf("%w %q", errUnknownSetting, path)
+		}
+		v = v.Field(index)
+	}
+
+	switch {
+	case v.Type() == durationType:
+		d, err := time.ParseDuration(value)
+		if err != nil {
+			return err
+		}
+		v.SetInt(int64(d))
+	case v.Kind() == reflect.String:
+		v.SetString(value)
+	case v.Kind() == reflect.Bool:
+		b, err := strconv.ParseBool(value)
+		if err != nil {
+			return err
+		}
+		v.SetBool(b)
+	case v.Kind() == reflect.Int || v.Kind() == reflect.Int64:
+		n, err := strconv.ParseInt(value, 10, 64)
+		if err != nil {
+			return err
+		}
+		v.SetInt(n)
+	case v.Kind() == reflect.Float64:
+		f, err := strconv.ParseFloat(value, 64)
+		if err != nil {
+			return err
+		}
+		v.SetFloat(f)
+	case v.Kind() == reflect.Slice && v.Type().Elem().Kind() == reflect.String:
+		v.Set(reflect.ValueOf(SplitList(value)))
+	default:
+		return fmt.Errorf("setting %q cannot be set from a string", path)
+	}
+	return nil
+}
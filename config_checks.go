@@ -0,0 +1,49 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"maps"
+	"slices"
+	"time"
+
+	"challenge-4-orchestrator/config"
+)
+
+// checkSettings validates the settings whose format belongs to the
+// orchestrator rather than to the config package: the job schedules, the
+// workflow and transform steps and the eviction window. It runs with every
+// load and reload.
+func checkSettings(c *config.Config) error {
+	var errs []error
+	check := func(ok bool, format string, args ...any) {
+		if !ok {
+			errs = append(errs, fmt.Errorf(format, args...))
+		}
+	}
+
+	if eviction := c.Router.Eviction; eviction.ErrorRate != 0 {
+		check(eviction.Window >= evictionBuckets*time.Millisecond, "router.eviction.window must be at least %dms", evictionBuckets)
+	}
+
+	for _, name := range slices.Sorted(maps.Keys(c.Workflows.Definitions)) {
+		if err := validateWorkflow(name, c.Workflows.Definitions[name]); err != nil {
+			check(false, "workflows.definitions: %v", err)
+		}
+	}
+
+	for _, name := range slices.Sorted(maps.Keys(c.Transforms.Types)) {
+		if err := validateTransform(name, c.Transforms.Types[name]); err != nil {
+			check(false, "transforms.types: %v", err)
+		}
+	}
+
+	for _, name := range slices.Sorted(maps.Keys(c.Scheduler.Jobs)) {
+		spec := c.Scheduler.Jobs[name]
+		check(slices.Contains(jobNames, name), "scheduler.jobs has unknown job %q", name)
+		_, err := parseSchedule(spec)
+		check(err == nil, "scheduler.jobs.%s: %v", name, err)
+	}
+
+	return errors.Join(errs...)
+}
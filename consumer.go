@@ -3,189 +3,856 @@ package main
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
-	"log"
+	"log/slog"
 	"math/rand"
+	"slices"
+	"strings"
+	"sync"
+	"sync/atomic"
 	"time"
 
+	"challenge-4-orchestrator/config"
+
 	"github.com/aws/aws-sdk-go-v2/aws"
-	"github.com/aws/aws-sdk-go-v2/config"
-	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue"
 	"github.com/aws/aws-sdk-go-v2/service/sqs"
 	"github.com/aws/aws-sdk-go-v2/service/sqs/types"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
 )
 
-const IntegrityLambda = "arn:aws:lambda:us-east-1:652276263254:function:validacionDatos-py"
-
 type SQSConsumer struct {
-	sqsClient      *sqs.Client
-	dynamoDBClient *DynamoDBClient
-	lambdaClient   *LambdaClient
-	queueURL       string
+	sqsClient       QueueClient
+	registry        Registry
+	lambdaClient    Invoker
+	integrityLambda string
+	dedup           *DedupStore                 // nil unless exactly-once mode is enabled
+	metrics         *EMFEmitter                 // nil unless EMF metrics are enabled
+	audit           *KinesisRoutingAudit        // nil unless a routing audit stream is configured
+	alerts          *SNSAlerter                 // nil unless an alert topic is configured
+	flags           *Flags                      // nil unless a flags table is configured
+	output          *OutputQueue                // nil unless an output queue is configured
+	transforms      *ResponseTransformer        // nil unless response transforms are configured
+	events          *EventPublisher             // nil unless an event bus is configured
+	stream          *EventStream                // nil unless the admin API is enabled
+	archive         *S3Archiver                 // nil unless an archive bucket is configured
+	workflows       *WorkflowEngine             // nil unless a workflow table is configured
+	stateMachines   ExecutionStarter            // nil disables stepfunctions entries
+	handlers        *HandlerRegistry            // custom handlers by message type
+	failures        *FailureLog                 // nil unless failures are recorded
+	tenants         *TenantIsolation            // nil unless a tenant field is configured
+	cloudEvents     *CloudEvents                // nil unless CloudEvents are enabled
+	protobuf        *ProtobufCodec              // nil unless a descriptor set is configured
+	schemas         *SchemaRegistry             // nil unless a schema location is configured
+	quarantine      *QuarantineQueue            // nil unless a quarantine queue is configured
+	rules           *RoutingRules               // nil unless a routing rules table is configured
+	fanout          *FanOut                     // nil fans out only the routing rules that say so
+	quorum          *Quorum                     // nil unless quorum message types are configured
+	eviction        *EvictionTracker            // nil unless error-rate eviction is enabled
+	adaptive        bool                        // weighted selection by the adaptive weights
+	protection      *TaskProtection             // nil unless ECS task protection is enabled
+	barePayloads    bool                        // the correlation ID only goes in the ClientContext
+	batcher         *Batcher                    // nil unless micro-batching is enabled
+	workerRates     *WorkerRateLimits           // the maxRate of the registry entries
+	costs           *CostTracker                // nil unless cost estimation is enabled
+	budget          *SpendGuard                 // nil unless a budget is configured
+	handler         Handler                     // the business logic wrapped in the middlewares
+	maxRate         atomic.Pointer[tokenBucket] // nil for no limit
+	strategy        atomic.Pointer[string]      // used unless the routingStrategy flag is set
+	queues          []*polledQueue
+	starvation      time.Duration // longest a queue may go without leading a round
+	orderMu         sync.Mutex    // the poll loops share the round-robin state
+	pollers         pollerPool
+	minPollers      int
+
+	inFlight atomic.Int64
+	fetching atomic.Int64 // sources between a fetch and the ack of its messages
+	active   sync.Map     // *InFlightMessage by message ID, for diagnostics
+	routing  routingStats
+	lastPoll atomic.Int64 // unix nanoseconds of the last successful receive
+
+	// lastActivity is touched on every loop iteration and after each message,
+	// so a stale value means the poll loop is wedged
+	lastActivity atomic.Int64
+
+	paused     atomic.Pointer[PauseState] // nil while consuming
+	retiring   atomic.Bool                // set by a drain; the pause is final
+	pollDelay  atomic.Int64               // nanoseconds before each fetch
+	delayMu    sync.Mutex
+	pollDelays map[string]time.Duration // by reason; pollDelay is the longest
 }
 
-func NewSQSConsumer(queueURL string, region string, client *DynamoDBClient, lambdaClient *LambdaClient) (*SQSConsumer, error) {
-	// Load AWS configuration with region
-	cfg, err := config.LoadDefaultConfig(context.TODO(),
-		config.WithRegion(region),
-	)
-	if err != nil {
-		return nil, err
+// ConsumerOptions configures the consumer; nil collaborators disable their
+// feature
+type ConsumerOptions struct {
+	IntegrityLambda string
+	// Dedup enables exactly-once mode
+	Dedup *DedupStore
+	// Metrics emits CloudWatch EMF metrics
+	Metrics *EMFEmitter
+	// Audit streams routing decisions
+	Audit *KinesisRoutingAudit
+	// Alerts publishes SNS alerts
+	Alerts *SNSAlerter
+	// Flags toggles integrity bypass, canary routing and the routing strategy
+	Flags *Flags
+	// Output forwards worker responses to the next pipeline stage
+	Output *OutputQueue
+	// Transforms reshapes the responses before they are forwarded
+	Transforms *ResponseTransformer
+	// Events publishes lifecycle events to EventBridge
+	Events *EventPublisher
+	// Stream feeds the same events to GET /admin/events
+	Stream *EventStream
+	// Archive keeps the raw payload and outcome of every message in S3
+	Archive *S3Archiver
+	// Workflows runs message types through a sequence of Lambdas
+	Workflows *WorkflowEngine
+	// StateMachines starts the executions of stepfunctions entries
+	StateMachines ExecutionStarter
+	// Handlers replace the default orchestration for their message types
+	Handlers *HandlerRegistry
+	// Failures keeps the last error of each message for the DLQ tool
+	Failures *FailureLog
+	// CloudEvents unwraps the CloudEvents received
+	CloudEvents *CloudEvents
+	// Protobuf decodes the protobuf payloads
+	Protobuf *ProtobufCodec
+	// Schemas validates the payloads before any Lambda is invoked
+	Schemas *SchemaRegistry
+	// Quarantine receives the payloads that fail validation
+	Quarantine *QuarantineQueue
+	// Rules narrows the workers of the matching messages
+	Rules *RoutingRules
+	// FanOut sends the messages of its types to every healthy worker
+	FanOut *FanOut
+	// Quorum verifies the responses of its message types on several workers
+	Quorum *Quorum
+	// Eviction takes the workers failing too often out of routing
+	Eviction *EvictionTracker
+	// AdaptiveWeights scales the registry weights by the latency and error
+	// EWMAs of the workers
+	AdaptiveWeights bool
+	// Protection keeps ECS from stopping the task while messages are in
+	// flight
+	Protection *TaskProtection
+	// BarePayloads leaves the worker payloads as received; the workers read
+	// the correlation ID from the ClientContext
+	BarePayloads bool
+	// Tenants limits the messages of each tenant and pins tenants to
+	// registry entries
+	Tenants *TenantIsolation
+	// Queues are polled by weight instead of the single queueURL
+	Queues []config.SQSQueue
+	// Pollers is the SQS poll loops run at start, at least one
+	Pollers int
+	// Batcher aggregates the worker invocations of the messages of each
+	// receive, which are then processed concurrently
+	Batcher *Batcher
+	// Costs estimates the spend on the workers
+	Costs *CostTracker
+	// Budget defers the non-critical messages while over a budget
+	Budget *SpendGuard
+	// StarvationTimeout is the longest a queue goes without being polled
+	// first, whatever its weight
+	StarvationTimeout time.Duration
+	// MaxRate caps the messages processed per second, 0 for no limit
+	MaxRate float64
+	// RoutingStrategy selects among several workers unless the
+	// routingStrategy flag is set; empty is weighted
+	RoutingStrategy string
+}
+
+func NewSQSConsumer(queueURL string, cfg aws.Config, registry *LambdaRegistry, lambdaClient *LambdaClient, opts ConsumerOptions) *SQSConsumer {
+	client := sqs.NewFromConfig(cfg, func(o *sqs.Options) {
+		if endpoint := awsEndpoint("SQS"); endpoint != "" {
+			o.BaseEndpoint = aws.String(endpoint)
+		}
+	})
+	return NewConsumer(client, queueURL, registry, lambdaClient, opts)
+}
+
+// NewConsumer builds the consumer over any queue, registry and invoker. It
+// polls queueURL, or opts.Queues when set.
+func NewConsumer(queue QueueClient, queueURL string, registry Registry, invoker Invoker, opts ConsumerOptions) *SQSConsumer {
+	c := &SQSConsumer{
+		sqsClient:       queue,
+		registry:        registry,
+		lambdaClient:    invoker,
+		integrityLambda: opts.IntegrityLambda,
+		dedup:           opts.Dedup,
+		metrics:         opts.Metrics,
+		audit:           opts.Audit,
+		alerts:          opts.Alerts,
+		flags:           opts.Flags,
+		output:          opts.Output,
+		transforms:      opts.Transforms,
+		events:          opts.Events,
+		stream:          opts.Stream,
+		archive:         opts.Archive,
+		workflows:       opts.Workflows,
+		stateMachines:   opts.StateMachines,
+		handlers:        opts.Handlers,
+		failures:        opts.Failures,
+		tenants:         opts.Tenants,
+		cloudEvents:     opts.CloudEvents,
+		protobuf:        opts.Protobuf,
+		schemas:         opts.Schemas,
+		quarantine:      opts.Quarantine,
+		rules:           opts.Rules,
+		fanout:          opts.FanOut,
+		quorum:          opts.Quorum,
+		eviction:        opts.Eviction,
+		adaptive:        opts.AdaptiveWeights,
+		protection:      opts.Protection,
+		barePayloads:    opts.BarePayloads,
+		batcher:         opts.Batcher,
+		workerRates:     NewWorkerRateLimits(),
+		costs:           opts.Costs,
+		budget:          opts.Budget,
+		minPollers:      max(opts.Pollers, 1),
+		starvation:      opts.StarvationTimeout,
 	}
+	queues := opts.Queues
+	if len(queues) == 0 && queueURL != "" {
+		queues = []config.SQSQueue{{URL: queueURL, Weight: 1}}
+	}
+	c.queues = newPolledQueues(queues)
+	if c.batcher != nil {
+		c.batcher.SetRateLimits(c.workerRates)
+	}
+	c.SetMaxRate(opts.MaxRate)
+	c.SetRoutingStrategy(opts.RoutingStrategy)
+	c.handler = c.pipeline()
+	return c
+}
+
+// SetMaxRate changes the messages processed per second across every
+// source; 0 does not limit
+func (c *SQSConsumer) SetMaxRate(rate float64) {
+	if rate <= 0 {
+		c.maxRate.Store(nil)
+		return
+	}
+	if bucket := c.maxRate.Load(); bucket != nil {
+		bucket.SetRate(rate, max(1, int(rate)))
+		return
+	}
+	c.maxRate.Store(newTokenBucket(rate, max(1, int(rate))))
+}
 
-	return &SQSConsumer{
-		sqsClient:      sqs.NewFromConfig(cfg),
-		dynamoDBClient: client,
-		lambdaClient:   lambdaClient,
-		queueURL:       queueURL,
-	}, nil
+// SetRoutingStrategy changes the strategy used unless the routingStrategy
+// flag is set; empty is weighted
+func (c *SQSConsumer) SetRoutingStrategy(strategy string) {
+	if strategy == "" {
+		strategy = strategyWeighted
+	}
+	c.strategy.Store(&strategy)
 }
 
+// Start polls the queues until ctx is done. Without a queue the other
+// sources feed the pipeline and the loop only keeps the liveness probe fresh.
 func (c *SQSConsumer) Start(ctx context.Context) {
-	log.Println("Starting SQS consumer...")
+	if len(c.queues) == 0 {
+		slog.Info("No SQS queue configured, consuming from the other sources only")
+		ticker := time.NewTicker(5 * time.Second)
+		defer ticker.Stop()
+		for {
+			c.touch()
+			select {
+			case <-ctx.Done():
+				slog.Info("Shutting down consumer")
+				return
+			case <-ticker.C:
+			}
+		}
+	}
+
+	for _, queue := range c.queues {
+		slog.Info("Starting SQS consumer", "queue_url", queue.URL, "weight", queue.Weight)
+	}
+
+	c.pollers.start(ctx, c.minPollers, c.pollLoop)
+	<-ctx.Done()
+	slog.Info("Shutting down consumer")
+	c.pollers.wait()
+}
 
+// pollLoop polls until ctx is done or the pool stops it
+func (c *SQSConsumer) pollLoop(ctx context.Context, stop <-chan struct{}) {
 	for {
 		select {
 		case <-ctx.Done():
-			log.Println("Shutting down consumer...")
+			return
+		case <-stop:
 			return
 		default:
+			c.touch()
+			done, err := c.startFetch(ctx)
+			if err != nil {
+				continue
+			}
 			c.pollMessages(ctx)
+			done()
 		}
 	}
 }
 
+// pollMessages processes a batch from the first queue of the round that has
+// messages; see pollOrder. Under sharding only the owned queues are polled.
 func (c *SQSConsumer) pollMessages(ctx context.Context) {
-	result, err := c.sqsClient.ReceiveMessage(ctx, &sqs.ReceiveMessageInput{
-		QueueUrl:            aws.String(c.queueURL),
+	queues := ownedQueues(c.queues)
+	if len(queues) == 0 {
+		sleepContext(ctx, 5*time.Second)
+		return
+	}
+	c.orderMu.Lock()
+	order := pollOrder(queues, c.starvation)
+	c.orderMu.Unlock()
+	failed := 0
+	for i, queue := range order {
+		wait := int32(0)
+		if i == len(order)-1 {
+			wait = multiQueueWait
+			if len(order) == 1 {
+				wait = 20 // Long polling
+			}
+		}
+
+		messages, err := c.receive(ctx, queue, wait)
+		if err != nil {
+			slog.Error("Error receiving messages", "queue_url", queue.URL, errAttr(err))
+			failed++
+			continue
+		}
+		if len(messages) == 0 {
+			continue
+		}
+
+		// FIFO queues keep the order of each message group
+		if c.batcher != nil && !strings.HasSuffix(queue.URL, ".fifo") {
+			c.processConcurrently(ctx, queue, messages)
+			return
+		}
+		for _, message := range messages {
+			started := time.Now()
+			c.processMessage(ctx, queue, message)
+			c.pollers.observe(time.Since(started))
+			c.touch()
+		}
+		return
+	}
+	// Every queue failed: back off, but not past a shutdown
+	if failed == len(order) {
+		sleepContext(ctx, 5*time.Second)
+	}
+}
+
+// processConcurrently processes a batch at once, so the batcher can
+// aggregate the invocations of its messages
+func (c *SQSConsumer) processConcurrently(ctx context.Context, queue *polledQueue, messages []types.Message) {
+	started := time.Now()
+	var wg sync.WaitGroup
+	for _, message := range messages {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			c.processMessage(withBatchable(ctx), queue, message)
+		}()
+	}
+	wg.Wait()
+	c.pollers.observe(time.Since(started) / time.Duration(len(messages)))
+	c.touch()
+}
+
+func (c *SQSConsumer) receive(ctx context.Context, queue *polledQueue, wait int32) ([]types.Message, error) {
+	receiveCtx, span := tracer.Start(ctx, "receive messages", trace.WithSpanKind(trace.SpanKindConsumer))
+	result, err := c.sqsClient.ReceiveMessage(receiveCtx, &sqs.ReceiveMessageInput{
+		QueueUrl:            aws.String(queue.URL),
 		MaxNumberOfMessages: 10,
-		WaitTimeSeconds:     20, // Long polling
+		WaitTimeSeconds:     wait,
 		VisibilityTimeout:   30,
+		MessageSystemAttributeNames: []types.MessageSystemAttributeName{
+			types.MessageSystemAttributeNameMessageDeduplicationId,
+			types.MessageSystemAttributeNameAWSTraceHeader,
+			types.MessageSystemAttributeNameApproximateReceiveCount,
+		},
+		MessageAttributeNames: []string{"All"},
 	})
-
+	if err == nil {
+		span.SetAttributes(attribute.Int("messaging.batch.message_count", len(result.Messages)))
+	}
+	endSpan(span, err)
 	if err != nil {
-		log.Printf("Error receiving messages: %v", err)
-		time.Sleep(5 * time.Second)
-		return
+		return nil, err
 	}
 
-	for _, message := range result.Messages {
-		c.processMessage(ctx, message)
-	}
+	c.lastPoll.Store(time.Now().UnixNano())
+	queueReceivedMessages.Add(float64(len(result.Messages)), queue.name)
+	return result.Messages, nil
 }
 
-func (c *SQSConsumer) processMessage(ctx context.Context, message types.Message) {
-	log.Printf("Processing message: %+v", message)
+// emit publishes a lifecycle event to EventBridge and the live event stream
+func (c *SQSConsumer) emit(ctx context.Context, eventType string, event LifecycleEvent) {
+	c.events.Publish(ctx, eventType, event)
+	c.stream.Publish(ctx, eventType, event)
+}
 
-	if message.Body == nil {
-		log.Printf("Message body is nil")
-		c.deleteMessage(ctx, message)
-		return
+// CheckQueue verifies the queues are reachable with the current credentials
+func (c *SQSConsumer) CheckQueue(ctx context.Context) error {
+	for _, queue := range c.queues {
+		_, err := c.sqsClient.GetQueueAttributes(ctx, &sqs.GetQueueAttributesInput{
+			QueueUrl:       aws.String(queue.URL),
+			AttributeNames: []types.QueueAttributeName{types.QueueAttributeNameQueueArn},
+		})
+		if err != nil {
+			return fmt.Errorf("error getting attributes of %s: %w", queue.name, err)
+		}
 	}
+	return nil
+}
 
-	// Parse your actual message
-	var appMessage any
-	if err := json.Unmarshal([]byte(*message.Body), &appMessage); err != nil {
-		log.Printf("Error parsing app message: %v", err)
-		c.deleteMessage(ctx, message)
-		return
-	}
+func (c *SQSConsumer) touch() {
+	c.lastActivity.Store(time.Now().UnixNano())
+}
 
-	// Process your business logic
-	if err := c.handleBusinessLogic(ctx, appMessage); err != nil {
-		log.Printf("Error processing message: %v", err)
-		// Don't delete on business logic error - let it retry
-		return
+// LastActivity returns when the poll loop last made progress, or the zero
+// time if it has not started yet
+func (c *SQSConsumer) LastActivity() time.Time {
+	nanos := c.lastActivity.Load()
+	if nanos == 0 {
+		return time.Time{}
 	}
-
-	// Delete message after successful processing
-	c.deleteMessage(ctx, message)
+	return time.Unix(0, nanos)
 }
 
-func (c *SQSConsumer) handleBusinessLogic(ctx context.Context, msg any) error {
-	// Implement your business logic here
-	log.Printf("Processing app message: %v", msg)
+// InFlight returns the number of messages currently being processed
+func (c *SQSConsumer) InFlight() int64 {
+	return c.inFlight.Load()
+}
 
-	// TODO: Check hash to verify the message has been not modified.
-	payload, err := c.lambdaClient.InvokeSync(ctx, IntegrityLambda, msg)
-	if err != nil {
-		return fmt.Errorf("error calling the integrity lambda: %v", err)
-	}
+// InFlightMessage is a message being processed
+type InFlightMessage struct {
+	ID        string    `json:"id"`
+	System    string    `json:"system"`
+	Attempt   string    `json:"attempt,omitempty"`
+	StartedAt time.Time `json:"startedAt"`
+}
 
-	var integrity LambdaResponse
+// InFlightMessages returns the messages being processed, oldest first
+func (c *SQSConsumer) InFlightMessages() []InFlightMessage {
+	var messages []InFlightMessage
+	c.active.Range(func(_, value any) bool {
+		messages = append(messages, *value.(*InFlightMessage))
+		return true
+	})
+	slices.SortFunc(messages, func(a, b InFlightMessage) int {
+		return a.StartedAt.Compare(b.StartedAt)
+	})
+	return messages
+}
 
-	if err := json.Unmarshal(payload, &integrity); err != nil {
-		return fmt.Errorf("error unmarshalling json: %v", err)
+// RoutingStats returns the per-ARN invocation counters
+func (c *SQSConsumer) RoutingStats() map[string]LambdaRoutingStats {
+	stats := c.routing.snapshot()
+	for arn, lambda := range stats {
+		if state := c.eviction.State(arn); state != evictionAdmitted {
+			lambda.Eviction = state
+			stats[arn] = lambda
+		}
 	}
+	return stats
+}
 
-	if integrity.StatusCode != 200 {
-		return fmt.Errorf("not matching signatures: %+v", integrity)
+// LastPoll returns when the queue was last polled successfully
+func (c *SQSConsumer) LastPoll() time.Time {
+	nanos := c.lastPoll.Load()
+	if nanos == 0 {
+		return time.Time{}
 	}
+	return time.Unix(0, nanos)
+}
 
-	// Obtener la Lambda activa desde DynamoDB
-	items, err := c.dynamoDBClient.Scan(ctx, nil, nil)
-	if err != nil {
-		return fmt.Errorf("item with id: %s in table: %s not found, error: %v", "lambdaActiva", c.dynamoDBClient.tableName, err)
+func (c *SQSConsumer) processMessage(ctx context.Context, queue *polledQueue, message types.Message) {
+	inbound := InboundMessage{
+		System:     "aws_sqs",
+		ID:         aws.ToString(message.MessageId),
+		Attempt:    message.Attributes[string(types.MessageSystemAttributeNameApproximateReceiveCount)],
+		DedupID:    messageDedupID(message),
+		Headers:    sqsAttributeCarrier(message.MessageAttributes),
+		XRayHeader: message.Attributes[string(types.MessageSystemAttributeNameAWSTraceHeader)],
+	}
+	if message.Body != nil {
+		inbound.Body = []byte(*message.Body)
 	}
+	inbound.Ack = func(ctx context.Context) { c.deleteMessage(ctx, queue, message) }
+	inbound.Defer = func(ctx context.Context, delay time.Duration) { c.deferMessage(ctx, queue, message, delay) }
 
-	var lambdas []Lambda
+	c.process(ctx, inbound)
+}
+
+// workerResponse is the outcome of a successful worker invocation
+type workerResponse struct {
+	Lambda  Lambda
+	Body    []byte
+	Elapsed time.Duration
+}
 
-	for _, item := range items {
+// handleBusinessLogic validates and verifies the message, then hands it to
+// the handler of its type or to the default orchestration
+func (c *SQSConsumer) handleBusinessLogic(ctx context.Context, msg any) (*workerResponse, error) {
+	started := time.Now()
 
-		var lambda Lambda
+	// Custom business logic plugs in as a Handler, see handlers.go
+	logger := loggerFrom(ctx)
 
-		err = attributevalue.UnmarshalMap(item, &lambda)
+	// The schema of the message type, before any Lambda is invoked
+	stageStarted := time.Now()
+	err := c.schemas.Validate(msg)
+	observeStage(ctx, stageSchema, stageStarted)
+	if err != nil {
+		c.metrics.Record("", time.Since(started), err)
+		return nil, err
+	}
+
+	// TODO: Check hash to verify the message has been not modified.
+	stageStarted = time.Now()
+	if c.flags.Enabled(flagIntegrityBypass) {
+		logger.Warn("Integrity check bypassed by feature flag")
+	} else {
+		err := c.checkIntegrity(ctx, msg)
+		observeStage(ctx, stageIntegrity, stageStarted)
 		if err != nil {
-			return fmt.Errorf("failed to unmarshal item: %w", err)
+			integrityFailures.Inc()
+			c.metrics.Record("", time.Since(started), err)
+			c.emit(ctx, EventIntegrityFailed, LifecycleEvent{Error: err.Error()})
+			return nil, err
 		}
+	}
+
+	// The workers receive the correlation ID in the payload too, unless it
+	// only goes in the ClientContext. The integrity Lambda always verifies
+	// the message as received.
+	if !c.barePayloads {
+		msg = withCorrelationPayload(ctx, msg)
+	}
 
-		if lambda.Status == Healthy {
-			lambdas = append(lambdas, lambda)
+	messageType, handler, ok := c.handlers.For(msg)
+	if !ok {
+		return c.orchestrate(ctx, msg)
+	}
+	logger.Debug("Dispatching to custom handler", "message_type", messageType)
+	stageStarted = time.Now()
+	response, err := handler.Handle(ctx, msg)
+	observeStage(ctx, stageInvoke, stageStarted)
+	var arn string
+	if response != nil {
+		arn = response.Lambda.ARN
+	}
+	c.metrics.Record(arn, time.Since(started), err)
+	return response, err
+}
+
+// orchestrate is the default handler: the workflow of the message type, or
+// a healthy worker from the registry
+func (c *SQSConsumer) orchestrate(ctx context.Context, msg any) (response *workerResponse, err error) {
+	var selectedLambda Lambda
+	started := time.Now()
+	defer func() {
+		c.metrics.Record(selectedLambda.ARN, time.Since(started), err)
+		if selectedLambda.ARN != "" {
+			c.routing.record(selectedLambda.ARN, time.Since(started), err)
+			c.eviction.Record(selectedLambda.ARN, err)
 		}
+	}()
+	logger := loggerFrom(ctx)
+
+	// Message types with a workflow go through its steps instead of a worker
+	if workflow, steps, ok := c.workflows.Match(msg); ok {
+		stageStarted := time.Now()
+		response, err = c.workflows.Run(ctx, workflow, steps, msg)
+		observeStage(ctx, stageInvoke, stageStarted)
+		return response, err
+	}
+
+	// Obtener las Lambdas saludables desde el registro
+	stageStarted := time.Now()
+	lookupCtx, lookupSpan := tracer.Start(ctx, "registry lookup")
+	lambdas, err := c.registry.ListHealthy(lookupCtx)
+	lookupSpan.SetAttributes(attribute.Int("registry.healthy_count", len(lambdas)))
+	endSpan(lookupSpan, err)
+	observeStage(ctx, stageRegistry, stageStarted)
+	if err != nil {
+		c.alerts.Alert(ctx, Alert{
+			Type:     alertRegistryUnavailable,
+			Severity: SeverityCritical,
+			Summary:  "The worker registry cannot be read",
+			Details:  map[string]any{"error": err.Error()},
+		})
+		return nil, fmt.Errorf("error fetching healthy lambdas: %w: %w", ErrRegistryUnavailable, err)
 	}
 
 	// Select and invoke Lambda using switch
-	var selectedLambda Lambda
 	var responseBytes []byte
 
+	stageStarted = time.Now()
+	lambdas, rule := c.rules.Apply(ctx, msg, lambdas)
+	if rule != nil {
+		ctx = withRoutingRule(ctx, rule.ID)
+	}
+	lambdas = withoutDrained(c.eviction.Filter(tenantPool(lambdas, tenantFrom(ctx))))
+	// Fanned-out messages go to every healthy worker, canaries included
+	if len(lambdas) > 0 && (c.fanout.Match(msg) || rule != nil && rule.Strategy == strategyFanOut) {
+		c.logRoutingDecision(ctx, newRoutingDecision(ctx, lambdas, Lambda{}, strategyFanOut))
+		observeStage(ctx, stageSelection, stageStarted)
+		stageStarted = time.Now()
+		response, err = c.fanOut(ctx, msg, lambdas)
+		observeStage(ctx, stageInvoke, stageStarted)
+		return response, err
+	}
+	// Critical messages go to several workers that must agree
+	if messageType, size, ok := c.quorum.Match(msg); ok && len(lambdas) > 0 {
+		c.logRoutingDecision(ctx, newRoutingDecision(ctx, lambdas, Lambda{}, strategyQuorum))
+		observeStage(ctx, stageSelection, stageStarted)
+		stageStarted = time.Now()
+		response, err = c.verifyQuorum(ctx, msg, messageType, size, lambdas)
+		observeStage(ctx, stageInvoke, stageStarted)
+		return response, err
+	}
+	lambdas, canary := c.routingPool(lambdas)
+	// Workers at their maxRate only get messages when all of them are
+	lambdas = c.workerRates.Available(lambdas)
 	switch len(lambdas) {
 	case 0:
-		return fmt.Errorf("no healthy lambdas found")
+		c.logRoutingDecision(ctx, newRoutingDecision(ctx, lambdas, Lambda{}, strategyNone))
+		c.alerts.Alert(ctx, Alert{
+			Type:     alertNoHealthyLambdas,
+			Severity: SeverityCritical,
+			Summary:  "No healthy worker Lambdas in the registry",
+		})
+		return nil, ErrNoHealthyLambdas
 	case 1:
 		selectedLambda = lambdas[0]
+		c.logRoutingDecision(ctx, newRoutingDecision(ctx, lambdas, selectedLambda, strategySingle))
 	default:
-		// Random selection of Lambda when there are multiple options
-		selectedLambda = lambdas[rand.Intn(len(lambdas))]
+		strategy := c.flags.Value(flagRoutingStrategy, *c.strategy.Load())
+		if rule != nil && rule.Strategy != "" {
+			strategy = rule.Strategy
+		}
+		switch {
+		case canary:
+			selectedLambda = selectWeighted(lambdas)
+			strategy = strategyCanary
+		case strategy == strategyUniform:
+			selectedLambda = lambdas[rand.Intn(len(lambdas))]
+		case strategy == strategyLatency:
+			selectedLambda = selectLatency(lambdas, &c.routing)
+		case c.adaptive:
+			// The decision shows the adapted weights
+			lambdas = c.routing.adaptiveWeights(lambdas)
+			selectedLambda = selectWeighted(lambdas)
+			strategy = strategyAdaptive
+		default:
+			// Weighted random selection of Lambda when there are multiple options
+			selectedLambda = selectWeighted(lambdas)
+			strategy = strategyWeighted
+		}
+		c.logRoutingDecision(ctx, newRoutingDecision(ctx, lambdas, selectedLambda, strategy))
 	}
+	observeStage(ctx, stageSelection, stageStarted)
 
 	// Invoke the selected Lambda
-	log.Printf("Invoking lambda: %s (ARN: %s)", selectedLambda.Name, selectedLambda.ARN)
-	responseBytes, err = c.lambdaClient.InvokeSync(ctx, selectedLambda.ARN, msg)
+	logger = logger.With("lambda_arn", selectedLambda.ARN)
+	logger.Info("Invoking lambda", "lambda_name", selectedLambda.Name)
+	invokeStarted := time.Now()
+	invokeCtx, invokeSpan := tracer.Start(ctx, "invoke worker",
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(attribute.String("faas.invoked_name", selectedLambda.ARN)),
+	)
+	responseBytes, err = c.invokeTarget(invokeCtx, selectedLambda, msg)
+	endSpan(invokeSpan, err)
+	observeStage(ctx, stageInvoke, invokeStarted)
+	if err != nil {
+		return nil, fmt.Errorf("error invoking lambda %s: %w", selectedLambda.ARN, err)
+	}
+
+	elapsed := time.Since(invokeStarted)
+	logger.Info("Lambda invoked", durationAttr(elapsed))
+	c.emit(ctx, EventLambdaInvoked, LifecycleEvent{
+		LambdaARN:  selectedLambda.ARN,
+		LambdaName: selectedLambda.Name,
+		DurationMs: elapsed.Milliseconds(),
+	})
+	logger.Debug("Lambda response", "response", string(responseBytes))
+
+	return &workerResponse{Lambda: selectedLambda, Body: responseBytes, Elapsed: elapsed}, nil
+}
+
+// invokeTarget invokes a worker Lambda or starts the execution of a state
+// machine entry
+func (c *SQSConsumer) invokeTarget(ctx context.Context, target Lambda, msg any) ([]byte, error) {
+	messageType := c.costs.MessageType(msg)
+	msg, err := c.protobuf.WorkerPayload(ctx, msg)
+	if err != nil {
+		return nil, err
+	}
+	// A batch takes the token of its invocation when it is sent
+	if c.batcher != nil && batchable(ctx) && target.Type != TargetStepFunctions {
+		return c.batcher.Invoke(ctx, target, messageType, msg)
+	}
+	if err := c.workerRates.Wait(ctx, target); err != nil {
+		return nil, err
+	}
+	if target.Type != TargetStepFunctions {
+		started := time.Now()
+		body, err := c.lambdaClient.InvokeWorker(ctx, target, msg)
+		c.costs.Record(ctx, target, messageType, time.Since(started), 1, err)
+		return body, err
+	}
+	if c.stateMachines == nil {
+		return nil, errors.New("step functions entries are not enabled")
+	}
+	return c.stateMachines.StartExecution(ctx, target, msg)
+}
+
+// checkIntegrity asks the integrity Lambda to verify the message signature
+func (c *SQSConsumer) checkIntegrity(ctx context.Context, msg any) (err error) {
+	ctx, span := tracer.Start(ctx, "integrity check", trace.WithSpanKind(trace.SpanKindClient))
+	defer func() { endSpan(span, err) }()
+
+	started := time.Now()
+	payload, err := c.lambdaClient.InvokeSync(ctx, c.integrityLambda, msg)
+	c.costs.Record(ctx, Lambda{ARN: c.integrityLambda}, c.costs.MessageType(msg), time.Since(started), 1, err)
 	if err != nil {
-		return fmt.Errorf("error invoking lambda %s: %w", selectedLambda.ARN, err)
+		return fmt.Errorf("error calling the integrity lambda: %w", err)
 	}
 
-	log.Printf("Lambda selected: %s", string(responseBytes))
+	var integrity LambdaResponse
+
+	if err := json.Unmarshal(payload, &integrity); err != nil {
+		return fmt.Errorf("error unmarshalling json: %v", err)
+	}
+
+	if integrity.StatusCode != 200 {
+		return fmt.Errorf("%w: %+v", ErrIntegrityFailed, integrity)
+	}
 
 	return nil
 }
 
-func (c *SQSConsumer) deleteMessage(ctx context.Context, message types.Message) {
+// messageDedupID prefers the FIFO deduplication ID and falls back to the message ID
+func messageDedupID(message types.Message) string {
+	if id, ok := message.Attributes[string(types.MessageSystemAttributeNameMessageDeduplicationId)]; ok && id != "" {
+		return id
+	}
+	return aws.ToString(message.MessageId)
+}
+
+// routingPool splits off the canary Lambdas: the message goes to them only
+// when canary routing is enabled and picks it, and to the stable ones
+// otherwise. With no stable Lambdas the canaries are used anyway.
+func (c *SQSConsumer) routingPool(lambdas []Lambda) (pool []Lambda, canary bool) {
+	var stable, canaries []Lambda
+	for _, lambda := range lambdas {
+		if lambda.Canary {
+			canaries = append(canaries, lambda)
+		} else {
+			stable = append(stable, lambda)
+		}
+	}
+
+	switch {
+	case len(canaries) == 0:
+		return lambdas, false
+	case len(stable) == 0:
+		return canaries, true
+	case c.flags.Enabled(flagCanaryRouting) && rand.Intn(100) < c.flags.Percent(flagCanaryRouting, defaultCanaryPercent):
+		return canaries, true
+	}
+	return stable, false
+}
+
+// withoutDrained leaves out the Lambdas weighted 0, so an operator drains a
+// worker by setting its weight to 0. With every weight at 0 the pool is empty.
+func withoutDrained(lambdas []Lambda) []Lambda {
+	return slices.DeleteFunc(slices.Clone(lambdas), func(lambda Lambda) bool {
+		return lambda.EffectiveWeight() <= 0
+	})
+}
+
+// selectWeighted picks a Lambda with probability proportional to its weight,
+// treating unset weights as 1; drained Lambdas must be left out first
+func selectWeighted(lambdas []Lambda) Lambda {
+	total := 0
+	for _, lambda := range lambdas {
+		total += lambda.EffectiveWeight()
+	}
+
+	pick := rand.Intn(total)
+	for _, lambda := range lambdas {
+		pick -= lambda.EffectiveWeight()
+		if pick < 0 {
+			return lambda
+		}
+	}
+
+	return lambdas[len(lambdas)-1]
+}
+
+// deferMessage hands a message back to its queue to be received again after
+// delay. On standard queues it is sent again and the received copy deleted,
+// so the deferral does not count toward the maxReceiveCount of the redrive
+// policy; FIFO queues, where that would break the order of the group, keep
+// it hidden for delay instead.
+func (c *SQSConsumer) deferMessage(ctx context.Context, queue *polledQueue, message types.Message, delay time.Duration) {
+	logger := loggerFrom(ctx)
+	if !strings.HasSuffix(queue.URL, ".fifo") {
+		input := &sqs.SendMessageInput{
+			QueueUrl:          aws.String(queue.URL),
+			MessageBody:       message.Body,
+			MessageAttributes: message.MessageAttributes,
+			DelaySeconds:      int32(min(delay, maxSQSDelay) / time.Second),
+		}
+		if header := message.Attributes[string(types.MessageSystemAttributeNameAWSTraceHeader)]; header != "" {
+			input.MessageSystemAttributes = map[string]types.MessageSystemAttributeValue{
+				string(types.MessageSystemAttributeNameForSendsAWSTraceHeader): {DataType: aws.String("String"), StringValue: aws.String(header)},
+			}
+		}
+		_, err := c.sqsClient.SendMessage(ctx, input)
+		if err == nil {
+			c.deleteMessage(ctx, queue, message)
+			return
+		}
+		logger.Warn("Error sending the deferred message again, keeping it hidden instead", errAttr(err))
+	}
+
+	_, err := c.sqsClient.ChangeMessageVisibility(ctx, &sqs.ChangeMessageVisibilityInput{
+		QueueUrl:          aws.String(queue.URL),
+		ReceiptHandle:     message.ReceiptHandle,
+		VisibilityTimeout: int32(min(delay, maxSQSVisibility) / time.Second),
+	})
+	if err != nil {
+		logger.Error("Error extending the visibility of a deferred message", errAttr(err))
+	}
+}
+
+func (c *SQSConsumer) deleteMessage(ctx context.Context, queue *polledQueue, message types.Message) {
 	if message.ReceiptHandle == nil {
-		log.Printf("Message receipt handle is nil, cannot delete")
+		loggerFrom(ctx).Warn("Message receipt handle is nil, cannot delete")
 		return
 	}
 
+	started := time.Now()
 	_, err := c.sqsClient.DeleteMessage(ctx, &sqs.DeleteMessageInput{
-		QueueUrl:      aws.String(c.queueURL),
+		QueueUrl:      aws.String(queue.URL),
 		ReceiptHandle: message.ReceiptHandle,
 	})
+	observeStage(ctx, stageDelete, started)
 
 	if err != nil {
-		log.Printf("Error deleting message: %v", err)
+		loggerFrom(ctx).Error("Error deleting message", errAttr(err))
 	} else {
-		if message.MessageId != nil {
-			log.Printf("Successfully deleted message: %s", *message.MessageId)
-		}
+		loggerFrom(ctx).Debug("Successfully deleted message")
 	}
 }
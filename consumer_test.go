@@ -0,0 +1,205 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"challenge-4-orchestrator/config"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/sqs"
+	"github.com/aws/aws-sdk-go-v2/service/sqs/types"
+	"go.uber.org/mock/gomock"
+)
+
+const (
+	testQueueURL  = "https://sqs.us-east-1.amazonaws.com/000000000000/orders"
+	testIntegrity = "integrity"
+)
+
+var testWorker = Lambda{ID: "worker", ARN: "arn:aws:lambda:us-east-1:000000000000:function:worker", Name: "worker", Status: Healthy, Weight: aws.Int(1)}
+
+// consumerMocks are the collaborators of a consumer under test; the
+// expectations not set by a test fail it when called
+type consumerMocks struct {
+	queue    *MockQueueClient
+	registry *MockRegistry
+	invoker  *MockInvoker
+}
+
+func newTestConsumer(t *testing.T, opts ConsumerOptions) (*SQSConsumer, consumerMocks) {
+	t.Helper()
+	ctrl := gomock.NewController(t)
+	mocks := consumerMocks{
+		queue:    NewMockQueueClient(ctrl),
+		registry: NewMockRegistry(ctrl),
+		invoker:  NewMockInvoker(ctrl),
+	}
+	opts.IntegrityLambda = testIntegrity
+	return NewConsumer(mocks.queue, testQueueURL, mocks.registry, mocks.invoker, opts), mocks
+}
+
+func testMessage(body string) types.Message {
+	return types.Message{
+		MessageId:     aws.String("message-1"),
+		ReceiptHandle: aws.String("receipt-1"),
+		Body:          aws.String(body),
+		Attributes:    map[string]string{string(types.MessageSystemAttributeNameApproximateReceiveCount): "1"},
+	}
+}
+
+func TestConsumerRoutesVerifiedMessage(t *testing.T) {
+	consumer, mocks := newTestConsumer(t, ConsumerOptions{})
+
+	mocks.invoker.EXPECT().InvokeSync(gomock.Any(), testIntegrity, gomock.Any()).Return([]byte(`{"statusCode":200}`), nil)
+	mocks.registry.EXPECT().ListHealthy(gomock.Any()).Return([]Lambda{testWorker}, nil)
+	mocks.invoker.EXPECT().InvokeWorker(gomock.Any(), testWorker, gomock.Any()).Return([]byte(`{"ok":true}`), nil)
+	mocks.queue.EXPECT().DeleteMessage(gomock.Any(), gomock.Any()).DoAndReturn(
+		func(_ context.Context, input *sqs.DeleteMessageInput, _ ...func(*sqs.Options)) (*sqs.DeleteMessageOutput, error) {
+			if aws.ToString(input.QueueUrl) != testQueueURL || aws.ToString(input.ReceiptHandle) != "receipt-1" {
+				t.Errorf("deleted %s from %s, want receipt-1 from the polled queue", aws.ToString(input.ReceiptHandle), aws.ToString(input.QueueUrl))
+			}
+			return &sqs.DeleteMessageOutput{}, nil
+		})
+
+	consumer.processMessage(context.Background(), consumer.queues[0], testMessage(`{"type":"order","data":"a"}`))
+
+	if stats := consumer.RoutingStats()[testWorker.ARN]; stats.Invocations != 1 || stats.Failures != 0 {
+		t.Errorf("worker stats = %+v, want one successful invocation", stats)
+	}
+}
+
+func TestConsumerAddsCorrelationIDToWorkerPayloadOnly(t *testing.T) {
+	consumer, mocks := newTestConsumer(t, ConsumerOptions{})
+
+	// The integrity Lambda verifies the message as sent
+	mocks.invoker.EXPECT().InvokeSync(gomock.Any(), testIntegrity, gomock.Any()).DoAndReturn(
+		func(_ context.Context, _ string, payload any) ([]byte, error) {
+			if _, ok := payload.(map[string]any)[correlationIDField]; ok {
+				t.Errorf("integrity payload has %s", correlationIDField)
+			}
+			return []byte(`{"statusCode":200}`), nil
+		})
+	mocks.registry.EXPECT().ListHealthy(gomock.Any()).Return([]Lambda{testWorker}, nil)
+	mocks.invoker.EXPECT().InvokeWorker(gomock.Any(), testWorker, gomock.Any()).DoAndReturn(
+		func(_ context.Context, _ Lambda, payload any) ([]byte, error) {
+			if _, ok := payload.(map[string]any)[correlationIDField]; !ok {
+				t.Errorf("worker payload has no %s", correlationIDField)
+			}
+			return []byte(`{"ok":true}`), nil
+		})
+	mocks.queue.EXPECT().DeleteMessage(gomock.Any(), gomock.Any()).Return(&sqs.DeleteMessageOutput{}, nil)
+
+	consumer.processMessage(context.Background(), consumer.queues[0], testMessage(`{"type":"order","data":"a"}`))
+}
+
+func TestConsumerKeepsMessageFailingIntegrity(t *testing.T) {
+	consumer, mocks := newTestConsumer(t, ConsumerOptions{})
+
+	// Neither the registry nor the workers are reached, and the message is
+	// left in the queue
+	mocks.invoker.EXPECT().InvokeSync(gomock.Any(), testIntegrity, gomock.Any()).Return([]byte(`{"statusCode":401}`), nil)
+
+	before := integrityFailures.Value()
+	consumer.processMessage(context.Background(), consumer.queues[0], testMessage(`{"type":"order","data":"a"}`))
+
+	if failures := integrityFailures.Value() - before; failures != 1 {
+		t.Errorf("integrity failures = %.0f, want 1", failures)
+	}
+}
+
+func TestConsumerKeepsMessageWithoutHealthyWorkers(t *testing.T) {
+	consumer, mocks := newTestConsumer(t, ConsumerOptions{})
+
+	mocks.invoker.EXPECT().InvokeSync(gomock.Any(), testIntegrity, gomock.Any()).Return([]byte(`{"statusCode":200}`), nil)
+	mocks.registry.EXPECT().ListHealthy(gomock.Any()).Return(nil, nil)
+
+	consumer.processMessage(context.Background(), consumer.queues[0], testMessage(`{"type":"order","data":"a"}`))
+}
+
+func TestConsumerSkipsDrainedWorkers(t *testing.T) {
+	consumer, mocks := newTestConsumer(t, ConsumerOptions{})
+
+	// A worker weighted 0 gets no traffic, so with every worker drained the
+	// message is left in the queue
+	drained := testWorker
+	drained.Weight = aws.Int(0)
+	mocks.invoker.EXPECT().InvokeSync(gomock.Any(), testIntegrity, gomock.Any()).Return([]byte(`{"statusCode":200}`), nil)
+	mocks.registry.EXPECT().ListHealthy(gomock.Any()).Return([]Lambda{drained}, nil)
+
+	consumer.processMessage(context.Background(), consumer.queues[0], testMessage(`{"type":"order","data":"a"}`))
+}
+
+func TestConsumerKeepsMessageWhenWorkerFails(t *testing.T) {
+	consumer, mocks := newTestConsumer(t, ConsumerOptions{})
+
+	mocks.invoker.EXPECT().InvokeSync(gomock.Any(), testIntegrity, gomock.Any()).Return([]byte(`{"statusCode":200}`), nil)
+	mocks.registry.EXPECT().ListHealthy(gomock.Any()).Return([]Lambda{testWorker}, nil)
+	mocks.invoker.EXPECT().InvokeWorker(gomock.Any(), testWorker, gomock.Any()).Return(nil, errors.New("worker error"))
+
+	consumer.processMessage(context.Background(), consumer.queues[0], testMessage(`{"type":"order","data":"a"}`))
+
+	if stats := consumer.RoutingStats()[testWorker.ARN]; stats.Failures != 1 {
+		t.Errorf("worker failures = %d, want 1", stats.Failures)
+	}
+}
+
+func TestConsumerAcknowledgesInvalidJSON(t *testing.T) {
+	consumer, mocks := newTestConsumer(t, ConsumerOptions{})
+
+	// A payload that cannot be parsed is never retried
+	mocks.queue.EXPECT().DeleteMessage(gomock.Any(), gomock.Any()).Return(&sqs.DeleteMessageOutput{}, nil)
+
+	consumer.processMessage(context.Background(), consumer.queues[0], testMessage(`not json`))
+}
+
+func TestConsumerDefersNonCriticalMessagesOverBudget(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	costs := NewCostTracker(NewMockFunctionConfigGetter(ctrl), CostOptions{TypeField: "type"})
+	guard := NewSpendGuard(costs, nil, BudgetOptions{CriticalTypes: []string{"payment"}, CheckInterval: 90 * time.Second})
+	guard.exceeded.Store(true)
+	consumer, mocks := newTestConsumer(t, ConsumerOptions{Costs: costs, Budget: guard})
+
+	// The message is sent again with a delay and the original deleted,
+	// without invoking any Lambda
+	gomock.InOrder(
+		mocks.queue.EXPECT().SendMessage(gomock.Any(), gomock.Any()).DoAndReturn(
+			func(_ context.Context, input *sqs.SendMessageInput, _ ...func(*sqs.Options)) (*sqs.SendMessageOutput, error) {
+				if input.DelaySeconds != 90 {
+					t.Errorf("deferred by %ds, want 90s", input.DelaySeconds)
+				}
+				return &sqs.SendMessageOutput{}, nil
+			}),
+		mocks.queue.EXPECT().DeleteMessage(gomock.Any(), gomock.Any()).Return(&sqs.DeleteMessageOutput{}, nil),
+	)
+
+	consumer.processMessage(context.Background(), consumer.queues[0], testMessage(`{"type":"order","data":"a"}`))
+}
+
+func TestConsumerDefersMessagesOverTenantLimits(t *testing.T) {
+	tenants := NewTenantIsolation("tenant", config.TenantLimits{MaxInFlight: 1}, nil)
+	// Another message of the tenant holds its only slot
+	release, exceeded, _ := tenants.acquire(context.Background(), "acme", false)
+	if exceeded != "" {
+		t.Fatalf("first acquire exceeded %s", exceeded)
+	}
+	defer release()
+	consumer, mocks := newTestConsumer(t, ConsumerOptions{Tenants: tenants})
+
+	// The message is sent again with a delay and the original deleted, so
+	// it does not use up a receive waiting for the visibility timeout
+	gomock.InOrder(
+		mocks.queue.EXPECT().SendMessage(gomock.Any(), gomock.Any()).DoAndReturn(
+			func(_ context.Context, input *sqs.SendMessageInput, _ ...func(*sqs.Options)) (*sqs.SendMessageOutput, error) {
+				if input.DelaySeconds < 1 {
+					t.Errorf("deferred by %ds, want at least 1s", input.DelaySeconds)
+				}
+				return &sqs.SendMessageOutput{}, nil
+			}),
+		mocks.queue.EXPECT().DeleteMessage(gomock.Any(), gomock.Any()).Return(&sqs.DeleteMessageOutput{}, nil),
+	)
+
+	consumer.processMessage(context.Background(), consumer.queues[0], testMessage(`{"tenant":"acme","data":"a"}`))
+}
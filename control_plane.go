@@ -0,0 +1,382 @@
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"log/slog"
+	"net"
+	"net/http"
+	"time"
+
+	"challenge-4-orchestrator/config"
+	"challenge-4-orchestrator/controlpb"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+// registryMethods are the control plane methods in the registry auth group;
+// the others are in the operations group
+var registryMethods = map[string]bool{
+	controlpb.ControlPlane_ListLambdas_FullMethodName:  true,
+	controlpb.ControlPlane_GetLambda_FullMethodName:    true,
+	controlpb.ControlPlane_CreateLambda_FullMethodName: true,
+	controlpb.ControlPlane_UpdateLambda_FullMethodName: true,
+	controlpb.ControlPlane_DeleteLambda_FullMethodName: true,
+}
+
+// ControlPlane serves the gRPC control plane API defined in
+// controlpb/control.proto, with the same authentication groups as the
+// admin HTTP API
+type ControlPlane struct {
+	controlpb.UnimplementedControlPlaneServer
+
+	registry *LambdaRegistry
+	consumer *SQSConsumer
+	status   *StatusHandler
+	config   func() *config.Config
+	auth     AdminAuth
+}
+
+func NewControlPlane(registry *LambdaRegistry, consumer *SQSConsumer, status *StatusHandler, currentConfig func() *config.Config, auth AdminAuth) *ControlPlane {
+	return &ControlPlane{
+		registry: registry,
+		consumer: consumer,
+		status:   status,
+		config:   currentConfig,
+		auth:     auth,
+	}
+}
+
+// startControlPlaneServer serves the control plane on its own port, with TLS
+// when tlsConfig is not nil
+func startControlPlaneServer(port string, tlsConfig *tls.Config, cp *ControlPlane) *grpc.Server {
+	opts := []grpc.ServerOption{
+		grpc.ChainUnaryInterceptor(cp.unaryAuth),
+		grpc.ChainStreamInterceptor(cp.streamAuth),
+	}
+	if tlsConfig != nil {
+		opts = append(opts, grpc.Creds(credentials.NewTLS(tlsConfig)))
+	}
+	server := grpc.NewServer(opts...)
+	controlpb.RegisterControlPlaneServer(server, cp)
+
+	go func() {
+		slog.Info("Control plane server starting", "port", port, "tls", tlsConfig != nil)
+		listener, err := net.Listen("tcp", ":"+port)
+		if err != nil {
+			fatal("Control plane server failed", errAttr(err))
+		}
+		if err := server.Serve(listener); err != nil && !errors.Is(err, grpc.ErrServerStopped) {
+			fatal("Control plane server failed", errAttr(err))
+		}
+	}()
+
+	return server
+}
+
+// stopControlPlaneServer lets unary calls finish within the timeout, then
+// closes the remaining streams
+func stopControlPlaneServer(server *grpc.Server, timeout time.Duration) {
+	done := make(chan struct{})
+	go func() {
+		server.GracefulStop()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(timeout):
+		server.Stop()
+	}
+}
+
+func (cp *ControlPlane) unaryAuth(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+	if err := cp.authenticate(ctx, info.FullMethod); err != nil {
+		return nil, err
+	}
+	return handler(ctx, req)
+}
+
+func (cp *ControlPlane) streamAuth(srv any, stream grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+	if err := cp.authenticate(stream.Context(), info.FullMethod); err != nil {
+		return err
+	}
+	return handler(srv, stream)
+}
+
+// authenticate runs the authenticator of the method group on the incoming
+// metadata, which carries the same headers as the HTTP API
+func (cp *ControlPlane) authenticate(ctx context.Context, method string) error {
+	group := config.AuthGroupOperations
+	if registryMethods[method] {
+		group = config.AuthGroupRegistry
+	}
+	auth := cp.auth[group]
+	if auth == nil {
+		return status.Error(codes.PermissionDenied, "endpoint group "+group+" is disabled")
+	}
+
+	header := http.Header{}
+	md, _ := metadata.FromIncomingContext(ctx)
+	for key, values := range md {
+		for _, value := range values {
+			header.Add(key, value)
+		}
+	}
+	principal, err := auth.Authenticate((&http.Request{Header: header}).WithContext(ctx))
+	if err != nil {
+		slog.Warn("Control plane: authentication failed", "method", method, errAttr(err))
+		if errors.Is(err, errNotAuthorized) {
+			return status.Error(codes.PermissionDenied, "forbidden")
+		}
+		return status.Error(codes.Unauthenticated, "unauthorized")
+	}
+
+	slog.Debug("Control plane: call authenticated", "method", method, "principal", principal)
+	return nil
+}
+
+func (cp *ControlPlane) ListLambdas(ctx context.Context, _ *controlpb.ListLambdasRequest) (*controlpb.ListLambdasResponse, error) {
+	lambdas, err := cp.registry.List(ctx)
+	if err != nil {
+		slog.Error("Control plane: error listing lambdas", errAttr(err))
+		return nil, status.Error(codes.Internal, "error listing lambdas")
+	}
+
+	resp := &controlpb.ListLambdasResponse{}
+	for _, lambda := range lambdas {
+		resp.Lambdas = append(resp.Lambdas, lambdaToProto(lambda))
+	}
+	return resp, nil
+}
+
+func (cp *ControlPlane) GetLambda(ctx context.Context, req *controlpb.GetLambdaRequest) (*controlpb.Lambda, error) {
+	lambda, err := cp.registry.Get(ctx, req.GetId())
+	if err != nil {
+		slog.Error("Control plane: error getting lambda", "lambda_id", req.GetId(), errAttr(err))
+		return nil, status.Error(codes.Internal, "error getting lambda")
+	}
+	if lambda == nil {
+		return nil, status.Error(codes.NotFound, ErrLambdaNotFound.Error())
+	}
+	return lambdaToProto(*lambda), nil
+}
+
+func (cp *ControlPlane) CreateLambda(ctx context.Context, req *controlpb.CreateLambdaRequest) (*controlpb.Lambda, error) {
+	lambda := lambdaFromProto(req.GetLambda())
+	if lambda.ID == "" || lambda.ARN == "" {
+		return nil, status.Error(codes.InvalidArgument, "id and arn are required")
+	}
+	if lambda.Status == "" {
+		lambda.Status = Healthy
+	}
+	if !lambda.Status.Valid() {
+		return nil, status.Error(codes.InvalidArgument, "invalid status: "+string(lambda.Status))
+	}
+	if lambda.Weight != nil && *lambda.Weight < 0 {
+		return nil, status.Error(codes.InvalidArgument, "weight must not be negative")
+	}
+	if !lambda.Type.Valid() {
+		return nil, status.Error(codes.InvalidArgument, "invalid type: "+string(lambda.Type))
+	}
+
+	if err := cp.registry.Create(ctx, lambda); err != nil {
+		if errors.Is(err, ErrLambdaExists) {
+			return nil, status.Error(codes.AlreadyExists, err.Error())
+		}
+		slog.Error("Control plane: error creating lambda", "lambda_id", lambda.ID, errAttr(err))
+		return nil, status.Error(codes.Internal, "error creating lambda")
+	}
+
+	slog.Info("Control plane: registered lambda", "lambda_id", lambda.ID, "lambda_arn", lambda.ARN)
+	return lambdaToProto(lambda), nil
+}
+
+func (cp *ControlPlane) UpdateLambda(ctx context.Context, req *controlpb.UpdateLambdaRequest) (*controlpb.Lambda, error) {
+	var statusUpdate *Status
+	var weight *int
+	if req.Status != nil {
+		s := Status(req.GetStatus())
+		if !s.Valid() {
+			return nil, status.Error(codes.InvalidArgument, "invalid status: "+string(s))
+		}
+		statusUpdate = &s
+	}
+	if req.Weight != nil {
+		w := int(req.GetWeight())
+		if w < 0 {
+			return nil, status.Error(codes.InvalidArgument, "weight must not be negative")
+		}
+		weight = &w
+	}
+	if statusUpdate == nil && weight == nil {
+		return nil, status.Error(codes.InvalidArgument, "status or weight is required")
+	}
+
+	lambda, err := cp.registry.Update(ctx, req.GetId(), statusUpdate, weight)
+	if err != nil {
+		if errors.Is(err, ErrLambdaNotFound) {
+			return nil, status.Error(codes.NotFound, err.Error())
+		}
+		slog.Error("Control plane: error updating lambda", "lambda_id", req.GetId(), errAttr(err))
+		return nil, status.Error(codes.Internal, "error updating lambda")
+	}
+
+	slog.Info("Control plane: updated lambda", "lambda_id", lambda.ID, "status", lambda.Status, "weight", lambda.EffectiveWeight())
+	return lambdaToProto(*lambda), nil
+}
+
+func (cp *ControlPlane) DeleteLambda(ctx context.Context, req *controlpb.DeleteLambdaRequest) (*controlpb.DeleteLambdaResponse, error) {
+	if err := cp.registry.Delete(ctx, req.GetId()); err != nil {
+		slog.Error("Control plane: error deleting lambda", "lambda_id", req.GetId(), errAttr(err))
+		return nil, status.Error(codes.Internal, "error deleting lambda")
+	}
+
+	slog.Info("Control plane: deleted lambda", "lambda_id", req.GetId())
+	return &controlpb.DeleteLambdaResponse{}, nil
+}
+
+func (cp *ControlPlane) Pause(_ context.Context, req *controlpb.PauseRequest) (*controlpb.PauseState, error) {
+	return pauseToProto(cp.consumer.Pause(req.GetReason())), nil
+}
+
+func (cp *ControlPlane) Resume(context.Context, *controlpb.ResumeRequest) (*controlpb.PauseState, error) {
+	if err := cp.consumer.Resume(); err != nil {
+		return nil, status.Error(codes.FailedPrecondition, err.Error())
+	}
+	return pauseToProto(nil), nil
+}
+
+// StreamStats sends the live status of the instance until the caller
+// cancels
+func (cp *ControlPlane) StreamStats(req *controlpb.StreamStatsRequest, stream grpc.ServerStreamingServer[controlpb.Stats]) error {
+	interval := 5 * time.Second
+	if req.GetIntervalMs() > 0 {
+		interval = max(time.Duration(req.GetIntervalMs())*time.Millisecond, time.Second)
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		if err := stream.Send(cp.stats()); err != nil {
+			return err
+		}
+		select {
+		case <-stream.Context().Done():
+			return nil
+		case <-ticker.C:
+		}
+	}
+}
+
+func (cp *ControlPlane) stats() *controlpb.Stats {
+	report := cp.status.Report()
+	stats := &controlpb.Stats{
+		InstanceId:    report.InstanceID,
+		Version:       report.Version,
+		Timestamp:     time.Now().UnixMilli(),
+		UptimeSeconds: int64(time.Since(report.StartedAt).Seconds()),
+		InFlight:      report.InFlight,
+		Pause:         pauseToProto(cp.consumer.Paused()),
+		Routing:       make(map[string]*controlpb.RoutingStats, len(report.Routing)),
+	}
+	if report.LastPoll != nil {
+		stats.LastPoll = report.LastPoll.UnixMilli()
+	}
+	for arn, routing := range report.Routing {
+		entry := &controlpb.RoutingStats{
+			Invocations:    routing.Invocations,
+			Failures:       routing.Failures,
+			LastError:      routing.LastError,
+			LastDurationMs: routing.LastDuration,
+		}
+		if routing.LastInvoked != nil {
+			entry.LastInvoked = routing.LastInvoked.UnixMilli()
+		}
+		stats.Routing[arn] = entry
+	}
+	if report.Queue != nil {
+		stats.Queue = &controlpb.QueueStats{
+			Visible:                 report.Queue.Visible,
+			NotVisible:              report.Queue.NotVisible,
+			Delayed:                 report.Queue.Delayed,
+			OldestMessageAgeSeconds: report.Queue.OldestMessageAgeSec,
+		}
+	}
+	return stats
+}
+
+func (cp *ControlPlane) GetConfig(context.Context, *controlpb.GetConfigRequest) (*controlpb.GetConfigResponse, error) {
+	resp := &controlpb.GetConfigResponse{}
+	for _, setting := range cp.config().Settings() {
+		resp.Settings = append(resp.Settings, &controlpb.Setting{Path: setting.Path, Value: setting.Value})
+	}
+	return resp, nil
+}
+
+func lambdaToProto(lambda Lambda) *controlpb.Lambda {
+	return &controlpb.Lambda{
+		Id:            lambda.ID,
+		Arn:           lambda.ARN,
+		Url:           lambda.URL,
+		Status:        string(lambda.Status),
+		Name:          lambda.Name,
+		LastHeartbeat: lambda.LastHeartBeat,
+		Weight:        int32(lambda.EffectiveWeight()),
+		Source:        lambda.Source,
+		ExpiresAt:     lambda.ExpiresAt,
+		Region:        lambda.Region,
+		ReplicaArn:    lambda.ReplicaARN,
+		Canary:        lambda.Canary,
+		StatusReason:  lambda.StatusReason,
+		Type:          string(lambda.Type),
+		WaitForResult: lambda.WaitForResult,
+		Tenants:       lambda.Tenants,
+	}
+}
+
+func lambdaFromProto(lambda *controlpb.Lambda) Lambda {
+	return Lambda{
+		ID:            lambda.GetId(),
+		ARN:           lambda.GetArn(),
+		URL:           lambda.GetUrl(),
+		Status:        Status(lambda.GetStatus()),
+		Name:          lambda.GetName(),
+		LastHeartBeat: lambda.GetLastHeartbeat(),
+		Weight:        protoWeight(lambda.GetWeight()),
+		Source:        lambda.GetSource(),
+		ExpiresAt:     lambda.GetExpiresAt(),
+		Region:        lambda.GetRegion(),
+		ReplicaARN:    lambda.GetReplicaArn(),
+		Canary:        lambda.GetCanary(),
+		StatusReason:  lambda.GetStatusReason(),
+		Type:          TargetType(lambda.GetType()),
+		WaitForResult: lambda.GetWaitForResult(),
+		Tenants:       lambda.GetTenants(),
+	}
+}
+
+func pauseToProto(state *PauseState) *controlpb.PauseState {
+	if state == nil {
+		return &controlpb.PauseState{}
+	}
+	return &controlpb.PauseState{
+		Paused:   true,
+		Reason:   state.Reason,
+		PausedAt: state.PausedAt.UnixMilli(),
+	}
+}
+
+// protoWeight maps the weight of a registration, where 0 is unset, to the
+// registry weight
+func protoWeight(weight int32) *int {
+	if weight == 0 {
+		return nil
+	}
+	w := int(weight)
+	return &w
+}
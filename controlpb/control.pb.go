@@ -0,0 +1,1272 @@
+// Code generated by protoc-gen-go. DO NOT EDIT.
+// versions:
+// 	protoc-gen-go v1.36.8
+// 	protoc        v5.29.3
+// source: control.proto
+
+// Control plane API of the orchestrator. Every call acts on the instance it
+// is sent to; fleets are managed by calling each instance. Authentication
+// uses the admin credentials as metadata: "authorization: Bearer <key>",
+// "x-api-key" or "x-aws-iam-token".
+
+package controlpb
+
+import (
+	protoreflect "google.golang.org/protobuf/reflect/protoreflect"
+	protoimpl "google.golang.org/protobuf/runtime/protoimpl"
+	reflect "reflect"
+	sync "sync"
+	unsafe "unsafe"
+)
+
+const (
+	// Verify that this generated code is sufficiently up-to-date.
+	_ = protoimpl.EnforceVersion(20 - protoimpl.MinVersion)
+	// Verify that runtime/protoimpl is sufficiently up-to-date.
+	_ = protoimpl.EnforceVersion(protoimpl.MaxVersion - 20)
+)
+
+type Lambda struct {
+	state protoimpl.MessageState `protogen:"open.v1"`
+	Id    string                 `protobuf:"bytes,1,opt,name=id,proto3" json:"id,omitempty"`
+	Arn   string                 `protobuf:"bytes,2,opt,name=arn,proto3" json:"arn,omitempty"`
+	Url   string                 `protobuf:"bytes,3,opt,name=url,proto3" json:"url,omitempty"`
+	// "saludable" or "fallando"
+	Status string `protobuf:"bytes,4,opt,name=status,proto3" json:"status,omitempty"`
+	Name   string `protobuf:"bytes,5,opt,name=name,proto3" json:"name,omitempty"`
+	// RFC 3339
+	LastHeartbeat string `protobuf:"bytes,6,opt,name=last_heartbeat,json=lastHeartbeat,proto3" json:"last_heartbeat,omitempty"`
+	Weight        int32  `protobuf:"varint,7,opt,name=weight,proto3" json:"weight,omitempty"`
+	Source        string `protobuf:"bytes,8,opt,name=source,proto3" json:"source,omitempty"`
+	// Unix seconds, 0 when the entry does not expire
+	ExpiresAt    int64  `protobuf:"varint,9,opt,name=expires_at,json=expiresAt,proto3" json:"expires_at,omitempty"`
+	Region       string `protobuf:"bytes,10,opt,name=region,proto3" json:"region,omitempty"`
+	ReplicaArn   string `protobuf:"bytes,11,opt,name=replica_arn,json=replicaArn,proto3" json:"replica_arn,omitempty"`
+	Canary       bool   `protobuf:"varint,12,opt,name=canary,proto3" json:"canary,omitempty"`
+	StatusReason string `protobuf:"bytes,13,opt,name=status_reason,json=statusReason,proto3" json:"status_reason,omitempty"`
+	// "lambda" (or empty) or "stepfunctions", whose arn is a state machine
+	Type string `protobuf:"bytes,14,opt,name=type,proto3" json:"type,omitempty"`
+	// Step Functions only: wait for the execution and reply with its output
+	WaitForResult bool `protobuf:"varint,15,opt,name=wait_for_result,json=waitForResult,proto3" json:"wait_for_result,omitempty"`
+	// Tenants pinned to this entry; empty leaves it in the shared pool
+	Tenants       []string `protobuf:"bytes,16,rep,name=tenants,proto3" json:"tenants,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *Lambda) Reset() {
+	*x = Lambda{}
+	mi := &file_control_proto_msgTypes[0]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *Lambda) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*Lambda) ProtoMessage() {}
+
+func (x *Lambda) ProtoReflect() protoreflect.Message {
+	mi := &file_control_proto_msgTypes[0]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use Lambda.ProtoReflect.Descriptor instead.
+func (*Lambda) Descriptor() ([]byte, []int) {
+	return file_control_proto_rawDescGZIP(), []int{0}
+}
+
+func (x *Lambda) GetId() string {
+	if x != nil {
+		return x.Id
+	}
+	return ""
+}
+
+func (x *Lambda) GetArn() string {
+	if x != nil {
+		return x.Arn
+	}
+	return ""
+}
+
+func (x *Lambda) GetUrl() string {
+	if x != nil {
+		return x.Url
+	}
+	return ""
+}
+
+func (x *Lambda) GetStatus() string {
+	if x != nil {
+		return x.Status
+	}
+	return ""
+}
+
+func (x *Lambda) GetName() string {
+	if x != nil {
+		return x.Name
+	}
+	return ""
+}
+
+func (x *Lambda) GetLastHeartbeat() string {
+	if x != nil {
+		return x.LastHeartbeat
+	}
+	return ""
+}
+
+func (x *Lambda) GetWeight() int32 {
+	if x != nil {
+		return x.Weight
+	}
+	return 0
+}
+
+func (x *Lambda) GetSource() string {
+	if x != nil {
+		return x.Source
+	}
+	return ""
+}
+
+func (x *Lambda) GetExpiresAt() int64 {
+	if x != nil {
+		return x.ExpiresAt
+	}
+	return 0
+}
+
+func (x *Lambda) GetRegion() string {
+	if x != nil {
+		return x.Region
+	}
+	return ""
+}
+
+func (x *Lambda) GetReplicaArn() string {
+	if x != nil {
+		return x.ReplicaArn
+	}
+	return ""
+}
+
+func (x *Lambda) GetCanary() bool {
+	if x != nil {
+		return x.Canary
+	}
+	return false
+}
+
+func (x *Lambda) GetStatusReason() string {
+	if x != nil {
+		return x.StatusReason
+	}
+	return ""
+}
+
+func (x *Lambda) GetType() string {
+	if x != nil {
+		return x.Type
+	}
+	return ""
+}
+
+func (x *Lambda) GetWaitForResult() bool {
+	if x != nil {
+		return x.WaitForResult
+	}
+	return false
+}
+
+func (x *Lambda) GetTenants() []string {
+	if x != nil {
+		return x.Tenants
+	}
+	return nil
+}
+
+type ListLambdasRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *ListLambdasRequest) Reset() {
+	*x = ListLambdasRequest{}
+	mi := &file_control_proto_msgTypes[1]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *ListLambdasRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*ListLambdasRequest) ProtoMessage() {}
+
+func (x *ListLambdasRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_control_proto_msgTypes[1]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use ListLambdasRequest.ProtoReflect.Descriptor instead.
+func (*ListLambdasRequest) Descriptor() ([]byte, []int) {
+	return file_control_proto_rawDescGZIP(), []int{1}
+}
+
+type ListLambdasResponse struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Lambdas       []*Lambda              `protobuf:"bytes,1,rep,name=lambdas,proto3" json:"lambdas,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *ListLambdasResponse) Reset() {
+	*x = ListLambdasResponse{}
+	mi := &file_control_proto_msgTypes[2]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *ListLambdasResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*ListLambdasResponse) ProtoMessage() {}
+
+func (x *ListLambdasResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_control_proto_msgTypes[2]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use ListLambdasResponse.ProtoReflect.Descriptor instead.
+func (*ListLambdasResponse) Descriptor() ([]byte, []int) {
+	return file_control_proto_rawDescGZIP(), []int{2}
+}
+
+func (x *ListLambdasResponse) GetLambdas() []*Lambda {
+	if x != nil {
+		return x.Lambdas
+	}
+	return nil
+}
+
+type GetLambdaRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Id            string                 `protobuf:"bytes,1,opt,name=id,proto3" json:"id,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *GetLambdaRequest) Reset() {
+	*x = GetLambdaRequest{}
+	mi := &file_control_proto_msgTypes[3]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *GetLambdaRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*GetLambdaRequest) ProtoMessage() {}
+
+func (x *GetLambdaRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_control_proto_msgTypes[3]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use GetLambdaRequest.ProtoReflect.Descriptor instead.
+func (*GetLambdaRequest) Descriptor() ([]byte, []int) {
+	return file_control_proto_rawDescGZIP(), []int{3}
+}
+
+func (x *GetLambdaRequest) GetId() string {
+	if x != nil {
+		return x.Id
+	}
+	return ""
+}
+
+type CreateLambdaRequest struct {
+	state protoimpl.MessageState `protogen:"open.v1"`
+	// id and arn are required; status defaults to "saludable"
+	Lambda        *Lambda `protobuf:"bytes,1,opt,name=lambda,proto3" json:"lambda,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *CreateLambdaRequest) Reset() {
+	*x = CreateLambdaRequest{}
+	mi := &file_control_proto_msgTypes[4]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *CreateLambdaRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*CreateLambdaRequest) ProtoMessage() {}
+
+func (x *CreateLambdaRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_control_proto_msgTypes[4]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use CreateLambdaRequest.ProtoReflect.Descriptor instead.
+func (*CreateLambdaRequest) Descriptor() ([]byte, []int) {
+	return file_control_proto_rawDescGZIP(), []int{4}
+}
+
+func (x *CreateLambdaRequest) GetLambda() *Lambda {
+	if x != nil {
+		return x.Lambda
+	}
+	return nil
+}
+
+type UpdateLambdaRequest struct {
+	state protoimpl.MessageState `protogen:"open.v1"`
+	Id    string                 `protobuf:"bytes,1,opt,name=id,proto3" json:"id,omitempty"`
+	// At least one of status and weight is required
+	Status        *string `protobuf:"bytes,2,opt,name=status,proto3,oneof" json:"status,omitempty"`
+	Weight        *int32  `protobuf:"varint,3,opt,name=weight,proto3,oneof" json:"weight,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *UpdateLambdaRequest) Reset() {
+	*x = UpdateLambdaRequest{}
+	mi := &file_control_proto_msgTypes[5]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *UpdateLambdaRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*UpdateLambdaRequest) ProtoMessage() {}
+
+func (x *UpdateLambdaRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_control_proto_msgTypes[5]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use UpdateLambdaRequest.ProtoReflect.Descriptor instead.
+func (*UpdateLambdaRequest) Descriptor() ([]byte, []int) {
+	return file_control_proto_rawDescGZIP(), []int{5}
+}
+
+func (x *UpdateLambdaRequest) GetId() string {
+	if x != nil {
+		return x.Id
+	}
+	return ""
+}
+
+func (x *UpdateLambdaRequest) GetStatus() string {
+	if x != nil && x.Status != nil {
+		return *x.Status
+	}
+	return ""
+}
+
+func (x *UpdateLambdaRequest) GetWeight() int32 {
+	if x != nil && x.Weight != nil {
+		return *x.Weight
+	}
+	return 0
+}
+
+type DeleteLambdaRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Id            string                 `protobuf:"bytes,1,opt,name=id,proto3" json:"id,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *DeleteLambdaRequest) Reset() {
+	*x = DeleteLambdaRequest{}
+	mi := &file_control_proto_msgTypes[6]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *DeleteLambdaRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*DeleteLambdaRequest) ProtoMessage() {}
+
+func (x *DeleteLambdaRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_control_proto_msgTypes[6]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use DeleteLambdaRequest.ProtoReflect.Descriptor instead.
+func (*DeleteLambdaRequest) Descriptor() ([]byte, []int) {
+	return file_control_proto_rawDescGZIP(), []int{6}
+}
+
+func (x *DeleteLambdaRequest) GetId() string {
+	if x != nil {
+		return x.Id
+	}
+	return ""
+}
+
+type DeleteLambdaResponse struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *DeleteLambdaResponse) Reset() {
+	*x = DeleteLambdaResponse{}
+	mi := &file_control_proto_msgTypes[7]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *DeleteLambdaResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*DeleteLambdaResponse) ProtoMessage() {}
+
+func (x *DeleteLambdaResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_control_proto_msgTypes[7]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use DeleteLambdaResponse.ProtoReflect.Descriptor instead.
+func (*DeleteLambdaResponse) Descriptor() ([]byte, []int) {
+	return file_control_proto_rawDescGZIP(), []int{7}
+}
+
+type PauseRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Reason        string                 `protobuf:"bytes,1,opt,name=reason,proto3" json:"reason,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *PauseRequest) Reset() {
+	*x = PauseRequest{}
+	mi := &file_control_proto_msgTypes[8]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *PauseRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*PauseRequest) ProtoMessage() {}
+
+func (x *PauseRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_control_proto_msgTypes[8]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use PauseRequest.ProtoReflect.Descriptor instead.
+func (*PauseRequest) Descriptor() ([]byte, []int) {
+	return file_control_proto_rawDescGZIP(), []int{8}
+}
+
+func (x *PauseRequest) GetReason() string {
+	if x != nil {
+		return x.Reason
+	}
+	return ""
+}
+
+type ResumeRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *ResumeRequest) Reset() {
+	*x = ResumeRequest{}
+	mi := &file_control_proto_msgTypes[9]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *ResumeRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*ResumeRequest) ProtoMessage() {}
+
+func (x *ResumeRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_control_proto_msgTypes[9]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use ResumeRequest.ProtoReflect.Descriptor instead.
+func (*ResumeRequest) Descriptor() ([]byte, []int) {
+	return file_control_proto_rawDescGZIP(), []int{9}
+}
+
+type PauseState struct {
+	state  protoimpl.MessageState `protogen:"open.v1"`
+	Paused bool                   `protobuf:"varint,1,opt,name=paused,proto3" json:"paused,omitempty"`
+	Reason string                 `protobuf:"bytes,2,opt,name=reason,proto3" json:"reason,omitempty"`
+	// Unix milliseconds, 0 when not paused
+	PausedAt      int64 `protobuf:"varint,3,opt,name=paused_at,json=pausedAt,proto3" json:"paused_at,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *PauseState) Reset() {
+	*x = PauseState{}
+	mi := &file_control_proto_msgTypes[10]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *PauseState) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*PauseState) ProtoMessage() {}
+
+func (x *PauseState) ProtoReflect() protoreflect.Message {
+	mi := &file_control_proto_msgTypes[10]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use PauseState.ProtoReflect.Descriptor instead.
+func (*PauseState) Descriptor() ([]byte, []int) {
+	return file_control_proto_rawDescGZIP(), []int{10}
+}
+
+func (x *PauseState) GetPaused() bool {
+	if x != nil {
+		return x.Paused
+	}
+	return false
+}
+
+func (x *PauseState) GetReason() string {
+	if x != nil {
+		return x.Reason
+	}
+	return ""
+}
+
+func (x *PauseState) GetPausedAt() int64 {
+	if x != nil {
+		return x.PausedAt
+	}
+	return 0
+}
+
+type StreamStatsRequest struct {
+	state protoimpl.MessageState `protogen:"open.v1"`
+	// Milliseconds between updates, at least 1000; defaults to 5000
+	IntervalMs    int64 `protobuf:"varint,1,opt,name=interval_ms,json=intervalMs,proto3" json:"interval_ms,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *StreamStatsRequest) Reset() {
+	*x = StreamStatsRequest{}
+	mi := &file_control_proto_msgTypes[11]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *StreamStatsRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*StreamStatsRequest) ProtoMessage() {}
+
+func (x *StreamStatsRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_control_proto_msgTypes[11]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use StreamStatsRequest.ProtoReflect.Descriptor instead.
+func (*StreamStatsRequest) Descriptor() ([]byte, []int) {
+	return file_control_proto_rawDescGZIP(), []int{11}
+}
+
+func (x *StreamStatsRequest) GetIntervalMs() int64 {
+	if x != nil {
+		return x.IntervalMs
+	}
+	return 0
+}
+
+type Stats struct {
+	state      protoimpl.MessageState `protogen:"open.v1"`
+	InstanceId string                 `protobuf:"bytes,1,opt,name=instance_id,json=instanceId,proto3" json:"instance_id,omitempty"`
+	Version    string                 `protobuf:"bytes,2,opt,name=version,proto3" json:"version,omitempty"`
+	// Unix milliseconds
+	Timestamp     int64       `protobuf:"varint,3,opt,name=timestamp,proto3" json:"timestamp,omitempty"`
+	UptimeSeconds int64       `protobuf:"varint,4,opt,name=uptime_seconds,json=uptimeSeconds,proto3" json:"uptime_seconds,omitempty"`
+	InFlight      int64       `protobuf:"varint,5,opt,name=in_flight,json=inFlight,proto3" json:"in_flight,omitempty"`
+	Pause         *PauseState `protobuf:"bytes,6,opt,name=pause,proto3" json:"pause,omitempty"`
+	// Unix milliseconds, 0 before the first successful poll
+	LastPoll int64                    `protobuf:"varint,7,opt,name=last_poll,json=lastPoll,proto3" json:"last_poll,omitempty"`
+	Routing  map[string]*RoutingStats `protobuf:"bytes,8,rep,name=routing,proto3" json:"routing,omitempty" protobuf_key:"bytes,1,opt,name=key" protobuf_val:"bytes,2,opt,name=value"`
+	// Absent when queue monitoring is disabled
+	Queue         *QueueStats `protobuf:"bytes,9,opt,name=queue,proto3" json:"queue,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *Stats) Reset() {
+	*x = Stats{}
+	mi := &file_control_proto_msgTypes[12]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *Stats) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*Stats) ProtoMessage() {}
+
+func (x *Stats) ProtoReflect() protoreflect.Message {
+	mi := &file_control_proto_msgTypes[12]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use Stats.ProtoReflect.Descriptor instead.
+func (*Stats) Descriptor() ([]byte, []int) {
+	return file_control_proto_rawDescGZIP(), []int{12}
+}
+
+func (x *Stats) GetInstanceId() string {
+	if x != nil {
+		return x.InstanceId
+	}
+	return ""
+}
+
+func (x *Stats) GetVersion() string {
+	if x != nil {
+		return x.Version
+	}
+	return ""
+}
+
+func (x *Stats) GetTimestamp() int64 {
+	if x != nil {
+		return x.Timestamp
+	}
+	return 0
+}
+
+func (x *Stats) GetUptimeSeconds() int64 {
+	if x != nil {
+		return x.UptimeSeconds
+	}
+	return 0
+}
+
+func (x *Stats) GetInFlight() int64 {
+	if x != nil {
+		return x.InFlight
+	}
+	return 0
+}
+
+func (x *Stats) GetPause() *PauseState {
+	if x != nil {
+		return x.Pause
+	}
+	return nil
+}
+
+func (x *Stats) GetLastPoll() int64 {
+	if x != nil {
+		return x.LastPoll
+	}
+	return 0
+}
+
+func (x *Stats) GetRouting() map[string]*RoutingStats {
+	if x != nil {
+		return x.Routing
+	}
+	return nil
+}
+
+func (x *Stats) GetQueue() *QueueStats {
+	if x != nil {
+		return x.Queue
+	}
+	return nil
+}
+
+type RoutingStats struct {
+	state       protoimpl.MessageState `protogen:"open.v1"`
+	Invocations int64                  `protobuf:"varint,1,opt,name=invocations,proto3" json:"invocations,omitempty"`
+	Failures    int64                  `protobuf:"varint,2,opt,name=failures,proto3" json:"failures,omitempty"`
+	// Unix milliseconds
+	LastInvoked    int64  `protobuf:"varint,3,opt,name=last_invoked,json=lastInvoked,proto3" json:"last_invoked,omitempty"`
+	LastError      string `protobuf:"bytes,4,opt,name=last_error,json=lastError,proto3" json:"last_error,omitempty"`
+	LastDurationMs int64  `protobuf:"varint,5,opt,name=last_duration_ms,json=lastDurationMs,proto3" json:"last_duration_ms,omitempty"`
+	unknownFields  protoimpl.UnknownFields
+	sizeCache      protoimpl.SizeCache
+}
+
+func (x *RoutingStats) Reset() {
+	*x = RoutingStats{}
+	mi := &file_control_proto_msgTypes[13]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *RoutingStats) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*RoutingStats) ProtoMessage() {}
+
+func (x *RoutingStats) ProtoReflect() protoreflect.Message {
+	mi := &file_control_proto_msgTypes[13]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use RoutingStats.ProtoReflect.Descriptor instead.
+func (*RoutingStats) Descriptor() ([]byte, []int) {
+	return file_control_proto_rawDescGZIP(), []int{13}
+}
+
+func (x *RoutingStats) GetInvocations() int64 {
+	if x != nil {
+		return x.Invocations
+	}
+	return 0
+}
+
+func (x *RoutingStats) GetFailures() int64 {
+	if x != nil {
+		return x.Failures
+	}
+	return 0
+}
+
+func (x *RoutingStats) GetLastInvoked() int64 {
+	if x != nil {
+		return x.LastInvoked
+	}
+	return 0
+}
+
+func (x *RoutingStats) GetLastError() string {
+	if x != nil {
+		return x.LastError
+	}
+	return ""
+}
+
+func (x *RoutingStats) GetLastDurationMs() int64 {
+	if x != nil {
+		return x.LastDurationMs
+	}
+	return 0
+}
+
+type QueueStats struct {
+	state                   protoimpl.MessageState `protogen:"open.v1"`
+	Visible                 int64                  `protobuf:"varint,1,opt,name=visible,proto3" json:"visible,omitempty"`
+	NotVisible              int64                  `protobuf:"varint,2,opt,name=not_visible,json=notVisible,proto3" json:"not_visible,omitempty"`
+	Delayed                 int64                  `protobuf:"varint,3,opt,name=delayed,proto3" json:"delayed,omitempty"`
+	OldestMessageAgeSeconds float64                `protobuf:"fixed64,4,opt,name=oldest_message_age_seconds,json=oldestMessageAgeSeconds,proto3" json:"oldest_message_age_seconds,omitempty"`
+	unknownFields           protoimpl.UnknownFields
+	sizeCache               protoimpl.SizeCache
+}
+
+func (x *QueueStats) Reset() {
+	*x = QueueStats{}
+	mi := &file_control_proto_msgTypes[14]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *QueueStats) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*QueueStats) ProtoMessage() {}
+
+func (x *QueueStats) ProtoReflect() protoreflect.Message {
+	mi := &file_control_proto_msgTypes[14]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use QueueStats.ProtoReflect.Descriptor instead.
+func (*QueueStats) Descriptor() ([]byte, []int) {
+	return file_control_proto_rawDescGZIP(), []int{14}
+}
+
+func (x *QueueStats) GetVisible() int64 {
+	if x != nil {
+		return x.Visible
+	}
+	return 0
+}
+
+func (x *QueueStats) GetNotVisible() int64 {
+	if x != nil {
+		return x.NotVisible
+	}
+	return 0
+}
+
+func (x *QueueStats) GetDelayed() int64 {
+	if x != nil {
+		return x.Delayed
+	}
+	return 0
+}
+
+func (x *QueueStats) GetOldestMessageAgeSeconds() float64 {
+	if x != nil {
+		return x.OldestMessageAgeSeconds
+	}
+	return 0
+}
+
+type GetConfigRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *GetConfigRequest) Reset() {
+	*x = GetConfigRequest{}
+	mi := &file_control_proto_msgTypes[15]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *GetConfigRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*GetConfigRequest) ProtoMessage() {}
+
+func (x *GetConfigRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_control_proto_msgTypes[15]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use GetConfigRequest.ProtoReflect.Descriptor instead.
+func (*GetConfigRequest) Descriptor() ([]byte, []int) {
+	return file_control_proto_rawDescGZIP(), []int{15}
+}
+
+type GetConfigResponse struct {
+	state protoimpl.MessageState `protogen:"open.v1"`
+	// Effective settings, with secrets redacted
+	Settings      []*Setting `protobuf:"bytes,1,rep,name=settings,proto3" json:"settings,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *GetConfigResponse) Reset() {
+	*x = GetConfigResponse{}
+	mi := &file_control_proto_msgTypes[16]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *GetConfigResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*GetConfigResponse) ProtoMessage() {}
+
+func (x *GetConfigResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_control_proto_msgTypes[16]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use GetConfigResponse.ProtoReflect.Descriptor instead.
+func (*GetConfigResponse) Descriptor() ([]byte, []int) {
+	return file_control_proto_rawDescGZIP(), []int{16}
+}
+
+func (x *GetConfigResponse) GetSettings() []*Setting {
+	if x != nil {
+		return x.Settings
+	}
+	return nil
+}
+
+type Setting struct {
+	state protoimpl.MessageState `protogen:"open.v1"`
+	// Dotted YAML path, e.g. "server.port"
+	Path          string `protobuf:"bytes,1,opt,name=path,proto3" json:"path,omitempty"`
+	Value         string `protobuf:"bytes,2,opt,name=value,proto3" json:"value,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *Setting) Reset() {
+	*x = Setting{}
+	mi := &file_control_proto_msgTypes[17]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *Setting) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*Setting) ProtoMessage() {}
+
+func (x *Setting) ProtoReflect() protoreflect.Message {
+	mi := &file_control_proto_msgTypes[17]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use Setting.ProtoReflect.Descriptor instead.
+func (*Setting) Descriptor() ([]byte, []int) {
+	return file_control_proto_rawDescGZIP(), []int{17}
+}
+
+func (x *Setting) GetPath() string {
+	if x != nil {
+		return x.Path
+	}
+	return ""
+}
+
+func (x *Setting) GetValue() string {
+	if x != nil {
+		return x.Value
+	}
+	return ""
+}
+
+var File_control_proto protoreflect.FileDescriptor
+
+const file_control_proto_rawDesc = "" +
+	"\n" +
+	"\rcontrol.proto\x12\x17orchestrator.control.v1\"\xaa\x03\n" +
+	"\x06Lambda\x12\x0e\n" +
+	"\x02id\x18\x01 \x01(\tR\x02id\x12\x10\n" +
+	"\x03arn\x18\x02 \x01(\tR\x03arn\x12\x10\n" +
+	"\x03url\x18\x03 \x01(\tR\x03url\x12\x16\n" +
+	"\x06status\x18\x04 \x01(\tR\x06status\x12\x12\n" +
+	"\x04name\x18\x05 \x01(\tR\x04name\x12%\n" +
+	"\x0elast_heartbeat\x18\x06 \x01(\tR\rlastHeartbeat\x12\x16\n" +
+	"\x06weight\x18\a \x01(\x05R\x06weight\x12\x16\n" +
+	"\x06source\x18\b \x01(\tR\x06source\x12\x1d\n" +
+	"\n" +
+	"expires_at\x18\t \x01(\x03R\texpiresAt\x12\x16\n" +
+	"\x06region\x18\n" +
+	" \x01(\tR\x06region\x12\x1f\n" +
+	"\vreplica_arn\x18\v \x01(\tR\n" +
+	"replicaArn\x12\x16\n" +
+	"\x06canary\x18\f \x01(\bR\x06canary\x12#\n" +
+	"\rstatus_reason\x18\r \x01(\tR\fstatusReason\x12\x12\n" +
+	"\x04type\x18\x0e \x01(\tR\x04type\x12&\n" +
+	"\x0fwait_for_result\x18\x0f \x01(\bR\rwaitForResult\x12\x18\n" +
+	"\atenants\x18\x10 \x03(\tR\atenants\"\x14\n" +
+	"\x12ListLambdasRequest\"P\n" +
+	"\x13ListLambdasResponse\x129\n" +
+	"\alambdas\x18\x01 \x03(\v2\x1f.orchestrator.control.v1.LambdaR\alambdas\"\"\n" +
+	"\x10GetLambdaRequest\x12\x0e\n" +
+	"\x02id\x18\x01 \x01(\tR\x02id\"N\n" +
+	"\x13CreateLambdaRequest\x127\n" +
+	"\x06lambda\x18\x01 \x01(\v2\x1f.orchestrator.control.v1.LambdaR\x06lambda\"u\n" +
+	"\x13UpdateLambdaRequest\x12\x0e\n" +
+	"\x02id\x18\x01 \x01(\tR\x02id\x12\x1b\n" +
+	"\x06status\x18\x02 \x01(\tH\x00R\x06status\x88\x01\x01\x12\x1b\n" +
+	"\x06weight\x18\x03 \x01(\x05H\x01R\x06weight\x88\x01\x01B\t\n" +
+	"\a_statusB\t\n" +
+	"\a_weight\"%\n" +
+	"\x13DeleteLambdaRequest\x12\x0e\n" +
+	"\x02id\x18\x01 \x01(\tR\x02id\"\x16\n" +
+	"\x14DeleteLambdaResponse\"&\n" +
+	"\fPauseRequest\x12\x16\n" +
+	"\x06reason\x18\x01 \x01(\tR\x06reason\"\x0f\n" +
+	"\rResumeRequest\"Y\n" +
+	"\n" +
+	"PauseState\x12\x16\n" +
+	"\x06paused\x18\x01 \x01(\bR\x06paused\x12\x16\n" +
+	"\x06reason\x18\x02 \x01(\tR\x06reason\x12\x1b\n" +
+	"\tpaused_at\x18\x03 \x01(\x03R\bpausedAt\"5\n" +
+	"\x12StreamStatsRequest\x12\x1f\n" +
+	"\vinterval_ms\x18\x01 \x01(\x03R\n" +
+	"intervalMs\"\xe1\x03\n" +
+	"\x05Stats\x12\x1f\n" +
+	"\vinstance_id\x18\x01 \x01(\tR\n" +
+	"instanceId\x12\x18\n" +
+	"\aversion\x18\x02 \x01(\tR\aversion\x12\x1c\n" +
+	"\ttimestamp\x18\x03 \x01(\x03R\ttimestamp\x12%\n" +
+	"\x0euptime_seconds\x18\x04 \x01(\x03R\ruptimeSeconds\x12\x1b\n" +
+	"\tin_flight\x18\x05 \x01(\x03R\binFlight\x129\n" +
+	"\x05pause\x18\x06 \x01(\v2#.orchestrator.control.v1.PauseStateR\x05pause\x12\x1b\n" +
+	"\tlast_poll\x18\a \x01(\x03R\blastPoll\x12E\n" +
+	"\arouting\x18\b \x03(\v2+.orchestrator.control.v1.Stats.RoutingEntryR\arouting\x129\n" +
+	"\x05queue\x18\t \x01(\v2#.orchestrator.control.v1.QueueStatsR\x05queue\x1aa\n" +
+	"\fRoutingEntry\x12\x10\n" +
+	"\x03key\x18\x01 \x01(\tR\x03key\x12;\n" +
+	"\x05value\x18\x02 \x01(\v2%.orchestrator.control.v1.RoutingStatsR\x05value:\x028\x01\"\xb8\x01\n" +
+	"\fRoutingStats\x12 \n" +
+	"\vinvocations\x18\x01 \x01(\x03R\vinvocations\x12\x1a\n" +
+	"\bfailures\x18\x02 \x01(\x03R\bfailures\x12!\n" +
+	"\flast_invoked\x18\x03 \x01(\x03R\vlastInvoked\x12\x1d\n" +
+	"\n" +
+	"last_error\x18\x04 \x01(\tR\tlastError\x12(\n" +
+	"\x10last_duration_ms\x18\x05 \x01(\x03R\x0elastDurationMs\"\x9e\x01\n" +
+	"\n" +
+	"QueueStats\x12\x18\n" +
+	"\avisible\x18\x01 \x01(\x03R\avisible\x12\x1f\n" +
+	"\vnot_visible\x18\x02 \x01(\x03R\n" +
+	"notVisible\x12\x18\n" +
+	"\adelayed\x18\x03 \x01(\x03R\adelayed\x12;\n" +
+	"\x1aoldest_message_age_seconds\x18\x04 \x01(\x01R\x17oldestMessageAgeSeconds\"\x12\n" +
+	"\x10GetConfigRequest\"Q\n" +
+	"\x11GetConfigResponse\x12<\n" +
+	"\bsettings\x18\x01 \x03(\v2 .orchestrator.control.v1.SettingR\bsettings\"3\n" +
+	"\aSetting\x12\x12\n" +
+	"\x04path\x18\x01 \x01(\tR\x04path\x12\x14\n" +
+	"\x05value\x18\x02 \x01(\tR\x05value2\xea\x06\n" +
+	"\fControlPlane\x12h\n" +
+	"\vListLambdas\x12+.orchestrator.control.v1.ListLambdasRequest\x1a,.orchestrator.control.v1.ListLambdasResponse\x12W\n" +
+	"\tGetLambda\x12).orchestrator.control.v1.GetLambdaRequest\x1a\x1f.orchestrator.control.v1.Lambda\x12]\n" +
+	"\fCreateLambda\x12,.orchestrator.control.v1.CreateLambdaRequest\x1a\x1f.orchestrator.control.v1.Lambda\x12]\n" +
+	"\fUpdateLambda\x12,.orchestrator.control.v1.UpdateLambdaRequest\x1a\x1f.orchestrator.control.v1.Lambda\x12k\n" +
+	"\fDeleteLambda\x12,.orchestrator.control.v1.DeleteLambdaRequest\x1a-.orchestrator.control.v1.DeleteLambdaResponse\x12S\n" +
+	"\x05Pause\x12%.orchestrator.control.v1.PauseRequest\x1a#.orchestrator.control.v1.PauseState\x12U\n" +
+	"\x06Resume\x12&.orchestrator.control.v1.ResumeRequest\x1a#.orchestrator.control.v1.PauseState\x12\\\n" +
+	"\vStreamStats\x12+.orchestrator.control.v1.StreamStatsRequest\x1a\x1e.orchestrator.control.v1.Stats0\x01\x12b\n" +
+	"\tGetConfig\x12).orchestrator.control.v1.GetConfigRequest\x1a*.orchestrator.control.v1.GetConfigResponseB$Z\"challenge-4-orchestrator/controlpbb\x06proto3"
+
+var (
+	file_control_proto_rawDescOnce sync.Once
+	file_control_proto_rawDescData []byte
+)
+
+func file_control_proto_rawDescGZIP() []byte {
+	file_control_proto_rawDescOnce.Do(func() {
+		file_control_proto_rawDescData = protoimpl.X.CompressGZIP(unsafe.Slice(unsafe.StringData(file_control_proto_rawDesc), len(file_control_proto_rawDesc)))
+	})
+	return file_control_proto_rawDescData
+}
+
+var file_control_proto_msgTypes = make([]protoimpl.MessageInfo, 19)
+var file_control_proto_goTypes = []any{
+	(*Lambda)(nil),               // 0: orchestrator.control.v1.Lambda
+	(*ListLambdasRequest)(nil),   // 1: orchestrator.control.v1.ListLambdasRequest
+	(*ListLambdasResponse)(nil),  // 2: orchestrator.control.v1.ListLambdasResponse
+	(*GetLambdaRequest)(nil),     // 3: orchestrator.control.v1.GetLambdaRequest
+	(*CreateLambdaRequest)(nil),  // 4: orchestrator.control.v1.CreateLambdaRequest
+	(*UpdateLambdaRequest)(nil),  // 5: orchestrator.control.v1.UpdateLambdaRequest
+	(*DeleteLambdaRequest)(nil),  // 6: orchestrator.control.v1.DeleteLambdaRequest
+	(*DeleteLambdaResponse)(nil), // 7: orchestrator.control.v1.DeleteLambdaResponse
+	(*PauseRequest)(nil),         // 8: orchestrator.control.v1.PauseRequest
+	(*ResumeRequest)(nil),        // 9: orchestrator.control.v1.ResumeRequest
+	(*PauseState)(nil),           // 10: orchestrator.control.v1.PauseState
+	(*StreamStatsRequest)(nil),   // 11: orchestrator.control.v1.StreamStatsRequest
+	(*Stats)(nil),                // 12: orchestrator.control.v1.Stats
+	(*RoutingStats)(nil),         // 13: orchestrator.control.v1.RoutingStats
+	(*QueueStats)(nil),           // 14: orchestrator.control.v1.QueueStats
+	(*GetConfigRequest)(nil),     // 15: orchestrator.control.v1.GetConfigRequest
+	(*GetConfigResponse)(nil),    // 16: orchestrator.control.v1.GetConfigResponse
+	(*Setting)(nil),              // 17: orchestrator.control.v1.Setting
+	nil,                          // 18: orchestrator.control.v1.Stats.RoutingEntry
+}
+var file_control_proto_depIdxs = []int32{
+	0,  // 0: orchestrator.control.v1.ListLambdasResponse.lambdas:type_name -> orchestrator.control.v1.Lambda
+	0,  // 1: orchestrator.control.v1.CreateLambdaRequest.lambda:type_name -> orchestrator.control.v1.Lambda
+	10, // 2: orchestrator.control.v1.Stats.pause:type_name -> orchestrator.control.v1.PauseState
+	18, // 3: orchestrator.control.v1.Stats.routing:type_name -> orchestrator.control.v1.Stats.RoutingEntry
+	14, // 4: orchestrator.control.v1.Stats.queue:type_name -> orchestrator.control.v1.QueueStats
+	17, // 5: orchestrator.control.v1.GetConfigResponse.settings:type_name -> orchestrator.control.v1.Setting
+	13, // 6: orchestrator.control.v1.Stats.RoutingEntry.value:type_name -> orchestrator.control.v1.RoutingStats
+	1,  // 7: orchestrator.control.v1.ControlPlane.ListLambdas:input_type -> orchestrator.control.v1.ListLambdasRequest
+	3,  // 8: orchestrator.control.v1.ControlPlane.GetLambda:input_type -> orchestrator.control.v1.GetLambdaRequest
+	4,  // 9: orchestrator.control.v1.ControlPlane.CreateLambda:input_type -> orchestrator.control.v1.CreateLambdaRequest
+	5,  // 10: orchestrator.control.v1.ControlPlane.UpdateLambda:input_type -> orchestrator.control.v1.UpdateLambdaRequest
+	6,  // 11: orchestrator.control.v1.ControlPlane.DeleteLambda:input_type -> orchestrator.control.v1.DeleteLambdaRequest
+	8,  // 12: orchestrator.control.v1.ControlPlane.Pause:input_type -> orchestrator.control.v1.PauseRequest
+	9,  // 13: orchestrator.control.v1.ControlPlane.Resume:input_type -> orchestrator.control.v1.ResumeRequest
+	11, // 14: orchestrator.control.v1.ControlPlane.StreamStats:input_type -> orchestrator.control.v1.StreamStatsRequest
+	15, // 15: orchestrator.control.v1.ControlPlane.GetConfig:input_type -> orchestrator.control.v1.GetConfigRequest
+	2,  // 16: orchestrator.control.v1.ControlPlane.ListLambdas:output_type -> orchestrator.control.v1.ListLambdasResponse
+	0,  // 17: orchestrator.control.v1.ControlPlane.GetLambda:output_type -> orchestrator.control.v1.Lambda
+	0,  // 18: orchestrator.control.v1.ControlPlane.CreateLambda:output_type -> orchestrator.control.v1.Lambda
+	0,  // 19: orchestrator.control.v1.ControlPlane.UpdateLambda:output_type -> orchestrator.control.v1.Lambda
+	7,  // 20: orchestrator.control.v1.ControlPlane.DeleteLambda:output_type -> orchestrator.control.v1.DeleteLambdaResponse
+	10, // 21: orchestrator.control.v1.ControlPlane.Pause:output_type -> orchestrator.control.v1.PauseState
+	10, // 22: orchestrator.control.v1.ControlPlane.Resume:output_type -> orchestrator.control.v1.PauseState
+	12, // 23: orchestrator.control.v1.ControlPlane.StreamStats:output_type -> orchestrator.control.v1.Stats
+	16, // 24: orchestrator.control.v1.ControlPlane.GetConfig:output_type -> orchestrator.control.v1.GetConfigResponse
+	16, // [16:25] is the sub-list for method output_type
+	7,  // [7:16] is the sub-list for method input_type
+	7,  // [7:7] is the sub-list for extension type_name
+	7,  // [7:7] is the sub-list for extension extendee
+	0,  // [0:7] is the sub-list for field type_name
+}
+
+func init() { file_control_proto_init() }
+func file_control_proto_init() {
+	if File_control_proto != nil {
+		return
+	}
+	file_control_proto_msgTypes[5].OneofWrappers = []any{}
+	type x struct{}
+	out := protoimpl.TypeBuilder{
+		File: protoimpl.DescBuilder{
+			GoPackagePath: reflect.TypeOf(x{}).PkgPath(),
+			RawDescriptor: unsafe.Slice(unsafe.StringData(file_control_proto_rawDesc), len(file_control_proto_rawDesc)),
+			NumEnums:      0,
+			NumMessages:   19,
+			NumExtensions: 0,
+			NumServices:   1,
+		},
+		GoTypes:           file_control_proto_goTypes,
+		DependencyIndexes: file_control_proto_depIdxs,
+		MessageInfos:      file_control_proto_msgTypes,
+	}.Build()
+	File_control_proto = out.File
+	file_control_proto_goTypes = nil
+	file_control_proto_depIdxs = nil
+}
@@ -0,0 +1,442 @@
+// Code generated by protoc-gen-go-grpc. DO NOT EDIT.
+// versions:
+// - protoc-gen-go-grpc v1.5.1
+// - protoc             v5.29.3
+// source: control.proto
+
+// Control plane API of the orchestrator. Every call acts on the instance it
+// is sent to; fleets are managed by calling each instance. Authentication
+// uses the admin credentials as metadata: "authorization: Bearer <key>",
+// "x-api-key" or "x-aws-iam-token".
+
+package controlpb
+
+import (
+	context "context"
+	grpc "google.golang.org/grpc"
+	codes "google.golang.org/grpc/codes"
+	status "google.golang.org/grpc/status"
+)
+
+// This is a compile-time assertion to ensure that this generated file
+// is compatible with the grpc package it is being compiled against.
+// Requires gRPC-Go v1.64.0 or later.
+const _ = grpc.SupportPackageIsVersion9
+
+const (
+	ControlPlane_ListLambdas_FullMethodName  = "/orchestrator.control.v1.ControlPlane/ListLambdas"
+	ControlPlane_GetLambda_FullMethodName    = "/orchestrator.control.v1.ControlPlane/GetLambda"
+	ControlPlane_CreateLambda_FullMethodName = "/orchestrator.control.v1.ControlPlane/CreateLambda"
+	ControlPlane_UpdateLambda_FullMethodName = "/orchestrator.control.v1.ControlPlane/UpdateLambda"
+	ControlPlane_DeleteLambda_FullMethodName = "/orchestrator.control.v1.ControlPlane/DeleteLambda"
+	ControlPlane_Pause_FullMethodName        = "/orchestrator.control.v1.ControlPlane/Pause"
+	ControlPlane_Resume_FullMethodName       = "/orchestrator.control.v1.ControlPlane/Resume"
+	ControlPlane_StreamStats_FullMethodName  = "/orchestrator.control.v1.ControlPlane/StreamStats"
+	ControlPlane_GetConfig_FullMethodName    = "/orchestrator.control.v1.ControlPlane/GetConfig"
+)
+
+// ControlPlaneClient is the client API for ControlPlane service.
+//
+// For semantics around ctx use and closing/ending streaming RPCs, please refer to https://pkg.go.dev/google.golang.org/grpc/?tab=doc#ClientConn.NewStream.
+type ControlPlaneClient interface {
+	// Registry management, in the registry auth group
+	ListLambdas(ctx context.Context, in *ListLambdasRequest, opts ...grpc.CallOption) (*ListLambdasResponse, error)
+	GetLambda(ctx context.Context, in *GetLambdaRequest, opts ...grpc.CallOption) (*Lambda, error)
+	CreateLambda(ctx context.Context, in *CreateLambdaRequest, opts ...grpc.CallOption) (*Lambda, error)
+	UpdateLambda(ctx context.Context, in *UpdateLambdaRequest, opts ...grpc.CallOption) (*Lambda, error)
+	DeleteLambda(ctx context.Context, in *DeleteLambdaRequest, opts ...grpc.CallOption) (*DeleteLambdaResponse, error)
+	// Consumption control and introspection, in the operations auth group.
+	// Pause stops every source from fetching new messages; messages already
+	// being processed finish.
+	Pause(ctx context.Context, in *PauseRequest, opts ...grpc.CallOption) (*PauseState, error)
+	Resume(ctx context.Context, in *ResumeRequest, opts ...grpc.CallOption) (*PauseState, error)
+	StreamStats(ctx context.Context, in *StreamStatsRequest, opts ...grpc.CallOption) (grpc.ServerStreamingClient[Stats], error)
+	GetConfig(ctx context.Context, in *GetConfigRequest, opts ...grpc.CallOption) (*GetConfigResponse, error)
+}
+
+type controlPlaneClient struct {
+	cc grpc.ClientConnInterface
+}
+
+func NewControlPlaneClient(cc grpc.ClientConnInterface) ControlPlaneClient {
+	return &controlPlaneClient{cc}
+}
+
+func (c *controlPlaneClient) ListLambdas(ctx context.Context, in *ListLambdasRequest, opts ...grpc.CallOption) (*ListLambdasResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(ListLambdasResponse)
+	err := c.cc.Invoke(ctx, ControlPlane_ListLambdas_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *controlPlaneClient) GetLambda(ctx context.Context, in *GetLambdaRequest, opts ...grpc.CallOption) (*Lambda, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(Lambda)
+	err := c.cc.Invoke(ctx, ControlPlane_GetLambda_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *controlPlaneClient) CreateLambda(ctx context.Context, in *CreateLambdaRequest, opts ...grpc.CallOption) (*Lambda, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(Lambda)
+	err := c.cc.Invoke(ctx, ControlPlane_CreateLambda_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *controlPlaneClient) UpdateLambda(ctx context.Context, in *UpdateLambdaRequest, opts ...grpc.CallOption) (*Lambda, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(Lambda)
+	err := c.cc.Invoke(ctx, ControlPlane_UpdateLambda_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *controlPlaneClient) DeleteLambda(ctx context.Context, in *DeleteLambdaRequest, opts ...grpc.CallOption) (*DeleteLambdaResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(DeleteLambdaResponse)
+	err := c.cc.Invoke(ctx, ControlPlane_DeleteLambda_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *controlPlaneClient) Pause(ctx context.Context, in *PauseRequest, opts ...grpc.CallOption) (*PauseState, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(PauseState)
+	err := c.cc.Invoke(ctx, ControlPlane_Pause_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *controlPlaneClient) Resume(ctx context.Context, in *ResumeRequest, opts ...grpc.CallOption) (*PauseState, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(PauseState)
+	err := c.cc.Invoke(ctx, ControlPlane_Resume_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *controlPlaneClient) StreamStats(ctx context.Context, in *StreamStatsRequest, opts ...grpc.CallOption) (grpc.ServerStreamingClient[Stats], error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	stream, err := c.cc.NewStream(ctx, &ControlPlane_ServiceDesc.Streams[0], ControlPlane_StreamStats_FullMethodName, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &grpc.GenericClientStream[StreamStatsRequest, Stats]{ClientStream: stream}
+	if err := x.ClientStream.SendMsg(in); err != nil {
+		return nil, err
+	}
+	if err := x.ClientStream.CloseSend(); err != nil {
+		return nil, err
+	}
+	return x, nil
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type ControlPlane_StreamStatsClient = grpc.ServerStreamingClient[Stats]
+
+func (c *controlPlaneClient) GetConfig(ctx context.Context, in *GetConfigRequest, opts ...grpc.CallOption) (*GetConfigResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(GetConfigResponse)
+	err := c.cc.Invoke(ctx, ControlPlane_GetConfig_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// ControlPlaneServer is the server API for ControlPlane service.
+// All implementations must embed UnimplementedControlPlaneServer
+// for forward compatibility.
+type ControlPlaneServer interface {
+	// Registry management, in the registry auth group
+	ListLambdas(context.Context, *ListLambdasRequest) (*ListLambdasResponse, error)
+	GetLambda(context.Context, *GetLambdaRequest) (*Lambda, error)
+	CreateLambda(context.Context, *CreateLambdaRequest) (*Lambda, error)
+	UpdateLambda(context.Context, *UpdateLambdaRequest) (*Lambda, error)
+	DeleteLambda(context.Context, *DeleteLambdaRequest) (*DeleteLambdaResponse, error)
+	// Consumption control and introspection, in the operations auth group.
+	// Pause stops every source from fetching new messages; messages already
+	// being processed finish.
+	Pause(context.Context, *PauseRequest) (*PauseState, error)
+	Resume(context.Context, *ResumeRequest) (*PauseState, error)
+	StreamStats(*StreamStatsRequest, grpc.ServerStreamingServer[Stats]) error
+	GetConfig(context.Context, *GetConfigRequest) (*GetConfigResponse, error)
+	mustEmbedUnimplementedControlPlaneServer()
+}
+
+// UnimplementedControlPlaneServer must be embedded to have
+// forward compatible implementations.
+//
+// NOTE: this should be embedded by value instead of pointer to avoid a nil
+// pointer dereference when methods are called.
+type UnimplementedControlPlaneServer struct{}
+
+func (UnimplementedControlPlaneServer) ListLambdas(context.Context, *ListLambdasRequest) (*ListLambdasResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method ListLambdas not implemented")
+}
+func (UnimplementedControlPlaneServer) GetLambda(context.Context, *GetLambdaRequest) (*Lambda, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method GetLambda not implemented")
+}
+func (UnimplementedControlPlaneServer) CreateLambda(context.Context, *CreateLambdaRequest) (*Lambda, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method CreateLambda not implemented")
+}
+func (UnimplementedControlPlaneServer) UpdateLambda(context.Context, *UpdateLambdaRequest) (*Lambda, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method UpdateLambda not implemented")
+}
+func (UnimplementedControlPlaneServer) DeleteLambda(context.Context, *DeleteLambdaRequest) (*DeleteLambdaResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method DeleteLambda not implemented")
+}
+func (UnimplementedControlPlaneServer) Pause(context.Context, *PauseRequest) (*PauseState, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method Pause not implemented")
+}
+func (UnimplementedControlPlaneServer) Resume(context.Context, *ResumeRequest) (*PauseState, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method Resume not implemented")
+}
+func (UnimplementedControlPlaneServer) StreamStats(*StreamStatsRequest, grpc.ServerStreamingServer[Stats]) error {
+	return status.Errorf(codes.Unimplemented, "method StreamStats not implemented")
+}
+func (UnimplementedControlPlaneServer) GetConfig(context.Context, *GetConfigRequest) (*GetConfigResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method GetConfig not implemented")
+}
+func (UnimplementedControlPlaneServer) mustEmbedUnimplementedControlPlaneServer() {}
+func (UnimplementedControlPlaneServer) testEmbeddedByValue()                      {}
+
+// UnsafeControlPlaneServer may be embedded to opt out of forward compatibility for this service.
+// Use of this interface is not recommended, as added methods to ControlPlaneServer will
+// result in compilation errors.
+type UnsafeControlPlaneServer interface {
+	mustEmbedUnimplementedControlPlaneServer()
+}
+
+func RegisterControlPlaneServer(s grpc.ServiceRegistrar, srv ControlPlaneServer) {
+	// If the following call pancis, it indicates UnimplementedControlPlaneServer was
+	// embedded by pointer and is nil.  This will cause panics if an
+	// unimplemented method is ever invoked, so we test this at initialization
+	// time to prevent it from happening at runtime later due to I/O.
+	if t, ok := srv.(interface{ testEmbeddedByValue() }); ok {
+		t.testEmbeddedByValue()
+	}
+	s.RegisterService(&ControlPlane_ServiceDesc, srv)
+}
+
+func _ControlPlane_ListLambdas_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ListLambdasRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(ControlPlaneServer).ListLambdas(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: ControlPlane_ListLambdas_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(ControlPlaneServer).ListLambdas(ctx, req.(*ListLambdasRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _ControlPlane_GetLambda_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(GetLambdaRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(ControlPlaneServer).GetLambda(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: ControlPlane_GetLambda_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(ControlPlaneServer).GetLambda(ctx, req.(*GetLambdaRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _ControlPlane_CreateLambda_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(CreateLambdaRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(ControlPlaneServer).CreateLambda(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: ControlPlane_CreateLambda_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(ControlPlaneServer).CreateLambda(ctx, req.(*CreateLambdaRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _ControlPlane_UpdateLambda_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(UpdateLambdaRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(ControlPlaneServer).UpdateLambda(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: ControlPlane_UpdateLambda_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(ControlPlaneServer).UpdateLambda(ctx, req.(*UpdateLambdaRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _ControlPlane_DeleteLambda_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(DeleteLambdaRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(ControlPlaneServer).DeleteLambda(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: ControlPlane_DeleteLambda_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(ControlPlaneServer).DeleteLambda(ctx, req.(*DeleteLambdaRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _ControlPlane_Pause_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(PauseRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(ControlPlaneServer).Pause(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: ControlPlane_Pause_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(ControlPlaneServer).Pause(ctx, req.(*PauseRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _ControlPlane_Resume_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ResumeRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(ControlPlaneServer).Resume(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: ControlPlane_Resume_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(ControlPlaneServer).Resume(ctx, req.(*ResumeRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _ControlPlane_StreamStats_Handler(srv interface{}, stream grpc.ServerStream) error {
+	m := new(StreamStatsRequest)
+	if err := stream.RecvMsg(m); err != nil {
+		return err
+	}
+	return srv.(ControlPlaneServer).StreamStats(m, &grpc.GenericServerStream[StreamStatsRequest, Stats]{ServerStream: stream})
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type ControlPlane_StreamStatsServer = grpc.ServerStreamingServer[Stats]
+
+func _ControlPlane_GetConfig_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(GetConfigRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(ControlPlaneServer).GetConfig(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: ControlPlane_GetConfig_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(ControlPlaneServer).GetConfig(ctx, req.(*GetConfigRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+// ControlPlane_ServiceDesc is the grpc.ServiceDesc for ControlPlane service.
+// It's only intended for direct use with grpc.RegisterService,
+// and not to be introspected or modified (even as a copy)
+var ControlPlane_ServiceDesc = grpc.ServiceDesc{
+	ServiceName: "orchestrator.control.v1.ControlPlane",
+	HandlerType: (*ControlPlaneServer)(nil),
+	Methods: []grpc.MethodDesc{
+		{
+			MethodName: "ListLambdas",
+			Handler:    _ControlPlane_ListLambdas_Handler,
+		},
+		{
+			MethodName: "GetLambda",
+			Handler:    _ControlPlane_GetLambda_Handler,
+		},
+		{
+			MethodName: "CreateLambda",
+			Handler:    _ControlPlane_CreateLambda_Handler,
+		},
+		{
+			MethodName: "UpdateLambda",
+			Handler:    _ControlPlane_UpdateLambda_Handler,
+		},
+		{
+			MethodName: "DeleteLambda",
+			Handler:    _ControlPlane_DeleteLambda_Handler,
+		},
+		{
+			MethodName: "Pause",
+			Handler:    _ControlPlane_Pause_Handler,
+		},
+		{
+			MethodName: "Resume",
+			Handler:    _ControlPlane_Resume_Handler,
+		},
+		{
+			MethodName: "GetConfig",
+			Handler:    _ControlPlane_GetConfig_Handler,
+		},
+	},
+	Streams: []grpc.StreamDesc{
+		{
+			StreamName:    "StreamStats",
+			Handler:       _ControlPlane_StreamStats_Handler,
+			ServerStreams: true,
+		},
+	},
+	Metadata: "control.proto",
+}
@@ -0,0 +1,84 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+)
+
+// correlationIDField is both the SQS message attribute and the payload field
+// that carry the correlation ID between services
+const correlationIDField = "correlationId"
+
+type correlationKey struct{}
+
+type messageIDKey struct{}
+
+func withCorrelationID(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, correlationKey{}, id)
+}
+
+func correlationIDFrom(ctx context.Context) string {
+	id, _ := ctx.Value(correlationKey{}).(string)
+	return id
+}
+
+func withMessageID(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, messageIDKey{}, id)
+}
+
+// messageIDFrom returns the ID of the message being processed
+func messageIDFrom(ctx context.Context) string {
+	id, _ := ctx.Value(messageIDKey{}).(string)
+	return id
+}
+
+// messageCorrelationID takes the ID from the message headers or the body,
+// and generates a new one when the producer did not set any
+func messageCorrelationID(message InboundMessage, body any) string {
+	if message.Headers != nil {
+		if id := message.Headers.Get(correlationIDField); id != "" {
+			return id
+		}
+	}
+	if fields, ok := body.(map[string]any); ok {
+		if id, ok := fields[correlationIDField].(string); ok && id != "" {
+			return id
+		}
+	}
+	return newCorrelationID()
+}
+
+// newCorrelationID returns a random UUIDv4
+func newCorrelationID() string {
+	var b [16]byte
+	if _, err := rand.Read(b[:]); err != nil {
+		panic(fmt.Sprintf("crypto/rand failed: %v", err))
+	}
+	b[6] = b[6]&0x0f | 0x40
+	b[8] = b[8]&0x3f | 0x80
+
+	h := hex.EncodeToString(b[:])
+	return h[0:8] + "-" + h[8:12] + "-" + h[12:16] + "-" + h[16:20] + "-" + h[20:32]
+}
+
+// withCorrelationPayload adds the correlation ID to JSON object payloads sent
+// to Lambdas. Other payload shapes are passed through unchanged.
+func withCorrelationPayload(ctx context.Context, msg any) any {
+	id := correlationIDFrom(ctx)
+	fields, ok := msg.(map[string]any)
+	if id == "" || !ok {
+		return msg
+	}
+	if _, exists := fields[correlationIDField]; exists {
+		return msg
+	}
+
+	payload := make(map[string]any, len(fields)+1)
+	for key, value := range fields {
+		payload[key] = value
+	}
+	payload[correlationIDField] = id
+	return payload
+}
@@ -0,0 +1,258 @@
+package main
+
+import (
+	"cmp"
+	"context"
+	"errors"
+	"log/slog"
+	"math"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// costMemoryRefresh is how long the memory size of a worker is cached
+	costMemoryRefresh = time.Hour
+	// defaultLambdaMemoryMB is assumed until the memory size of a worker is
+	// read, and when it cannot be
+	defaultLambdaMemoryMB = 128
+	// costUnknownType labels the messages without a type field
+	costUnknownType = "unknown"
+)
+
+var lambdaEstimatedCost = NewCounterVec(
+	"orchestrator_lambda_estimated_cost_usd_total",
+	"Estimated Lambda cost in USD (memory size × billed duration × price, plus the request price), by worker and message type.",
+	"lambda_arn", "message_type",
+)
+
+// CostOptions prices the invocations, in USD
+type CostOptions struct {
+	PricePerGBSecond float64
+	PricePerRequest  float64
+	TypeField        string // payload field with the message type
+}
+
+// WorkerCost is the estimated spend on a worker for a message type
+type WorkerCost struct {
+	LambdaARN     string  `json:"lambdaArn"`
+	MessageType   string  `json:"messageType"`
+	MemoryMB      int32   `json:"memoryMb"`
+	Invocations   int64   `json:"invocations"`
+	TotalUSD      float64 `json:"totalUsd"`
+	PerMessageUSD float64 `json:"perMessageUsd"`
+	LastHourUSD   float64 `json:"lastHourUsd"`
+}
+
+// CostReport is the estimated spend since start and over the last hour
+type CostReport struct {
+	TotalUSD    float64      `json:"totalUsd"`
+	LastHourUSD float64      `json:"lastHourUsd"`
+	Workers     []WorkerCost `json:"workers"`
+}
+
+type costKey struct {
+	arn         string
+	messageType string
+}
+
+// costEntry keeps the totals of a key and its spend per minute over the
+// last hour
+type costEntry struct {
+	invocations int64
+	total       float64
+	minutes     [60]float64
+	stamps      [60]int64 // unix minute of each slot
+}
+
+func (e *costEntry) add(cost float64, now time.Time) {
+	minute := now.Unix() / 60
+	slot := minute % 60
+	if e.stamps[slot] != minute {
+		e.stamps[slot], e.minutes[slot] = minute, 0
+	}
+	e.minutes[slot] += cost
+	e.invocations++
+	e.total += cost
+}
+
+func (e *costEntry) lastHour(now time.Time) float64 {
+	minute := now.Unix() / 60
+	sum := 0.0
+	for i, stamp := range e.stamps {
+		if minute-stamp < 60 {
+			sum += e.minutes[i]
+		}
+	}
+	return sum
+}
+
+// spendWindow keeps the spend and invocations of every worker per minute
+// over the last day, for the budgets
+type spendWindow struct {
+	cost        [1440]float64
+	invocations [1440]float64 // a batched message counts its share
+	stamps      [1440]int64   // unix minute of each slot
+}
+
+func (w *spendWindow) add(cost, invocations float64, now time.Time) {
+	minute := now.Unix() / 60
+	slot := minute % int64(len(w.stamps))
+	if w.stamps[slot] != minute {
+		w.stamps[slot], w.cost[slot], w.invocations[slot] = minute, 0, 0
+	}
+	w.cost[slot] += cost
+	w.invocations[slot] += invocations
+}
+
+func (w *spendWindow) sum(window time.Duration, now time.Time) (cost, invocations float64) {
+	minute := now.Unix() / 60
+	minutes := min(int64(window/time.Minute), int64(len(w.stamps)))
+	for i, stamp := range w.stamps {
+		if minute-stamp < minutes {
+			cost += w.cost[i]
+			invocations += w.invocations[i]
+		}
+	}
+	return cost, invocations
+}
+
+type lambdaMemory struct {
+	mb        int32
+	fetchedAt time.Time
+}
+
+// CostTracker estimates what the worker and integrity invocations cost, from
+// the memory size configured on each function and the measured duration
+// rounded up to the millisecond, as Lambda bills it. The duration is
+// measured by the orchestrator, so it includes the network and
+// overestimates slightly; Step Functions entries are not priced. A nil
+// *CostTracker records nothing.
+type CostTracker struct {
+	functions FunctionConfigGetter
+	opts      CostOptions
+
+	mu      sync.Mutex
+	entries map[costKey]*costEntry
+	memory  map[string]lambdaMemory // by worker ARN
+	spend   spendWindow
+}
+
+func NewCostTracker(functions FunctionConfigGetter, opts CostOptions) *CostTracker {
+	return &CostTracker{
+		functions: functions,
+		opts:      opts,
+		entries:   make(map[costKey]*costEntry),
+		memory:    make(map[string]lambdaMemory),
+	}
+}
+
+// MessageType returns the type of msg for the cost breakdown
+func (t *CostTracker) MessageType(msg any) string {
+	if t == nil {
+		return ""
+	}
+	if fields, ok := msg.(map[string]any); ok {
+		if messageType, ok := fields[t.opts.TypeField].(string); ok && messageType != "" {
+			return messageType
+		}
+	}
+	return costUnknownType
+}
+
+// Record adds a message of an invocation of worker lasting duration; the
+// cost of a batched invocation is split evenly between its messages.
+// Throttled invocations are not billed.
+func (t *CostTracker) Record(ctx context.Context, worker Lambda, messageType string, duration time.Duration, batchSize int, err error) {
+	if t == nil || worker.Type == TargetStepFunctions || errors.Is(err, ErrInvokeThrottled) {
+		return
+	}
+	memoryMB := t.memoryMB(ctx, worker.ARN)
+	billedSeconds := math.Ceil(float64(duration)/float64(time.Millisecond)) / 1000
+	cost := (float64(memoryMB)/1024*billedSeconds*t.opts.PricePerGBSecond + t.opts.PricePerRequest) / float64(max(batchSize, 1))
+
+	t.mu.Lock()
+	key := costKey{arn: worker.ARN, messageType: messageType}
+	entry, ok := t.entries[key]
+	if !ok {
+		entry = &costEntry{}
+		t.entries[key] = entry
+	}
+	now := time.Now()
+	entry.add(cost, now)
+	t.spend.add(cost, 1/float64(max(batchSize, 1)), now)
+	t.mu.Unlock()
+	lambdaEstimatedCost.Add(cost, worker.ARN, messageType)
+}
+
+// Spend returns the estimated spend and the invocations over the last
+// window, of up to a day
+func (t *CostTracker) Spend(window time.Duration) (usd, invocations float64) {
+	if t == nil {
+		return 0, 0
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.spend.sum(window, time.Now())
+}
+
+// memoryMB returns the memory size of the function, read again every
+// costMemoryRefresh
+func (t *CostTracker) memoryMB(ctx context.Context, arn string) int32 {
+	t.mu.Lock()
+	memory, ok := t.memory[arn]
+	t.mu.Unlock()
+	if ok && time.Since(memory.fetchedAt) < costMemoryRefresh {
+		return memory.mb
+	}
+
+	// A failed read keeps the previous size, or the default, until the next
+	// refresh
+	mb := memory.mb
+	if mb == 0 {
+		mb = defaultLambdaMemoryMB
+	}
+	config, err := t.functions.GetFunctionConfiguration(ctx, arn)
+	if err == nil && config.MemorySize != nil {
+		mb = *config.MemorySize
+	} else if err != nil {
+		slog.Warn("Error reading the memory size of a worker, estimating its cost with the last known", "lambda_arn", arn, "memory_mb", mb, errAttr(err))
+	}
+	t.mu.Lock()
+	t.memory[arn] = lambdaMemory{mb: mb, fetchedAt: time.Now()}
+	t.mu.Unlock()
+	return mb
+}
+
+// Report returns the spend by worker and message type, most expensive
+// first
+func (t *CostTracker) Report() *CostReport {
+	if t == nil {
+		return nil
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	now := time.Now()
+	report := &CostReport{Workers: make([]WorkerCost, 0, len(t.entries))}
+	for key, entry := range t.entries {
+		cost := WorkerCost{
+			LambdaARN:     key.arn,
+			MessageType:   key.messageType,
+			MemoryMB:      t.memory[key.arn].mb,
+			Invocations:   entry.invocations,
+			TotalUSD:      entry.total,
+			PerMessageUSD: entry.total / float64(entry.invocations),
+			LastHourUSD:   entry.lastHour(now),
+		}
+		report.Workers = append(report.Workers, cost)
+		report.TotalUSD += cost.TotalUSD
+		report.LastHourUSD += cost.LastHourUSD
+	}
+	slices.SortFunc(report.Workers, func(a, b WorkerCost) int {
+		return cmp.Or(cmp.Compare(b.TotalUSD, a.TotalUSD), strings.Compare(a.LambdaARN, b.LambdaARN), strings.Compare(a.MessageType, b.MessageType))
+	})
+	return report
+}
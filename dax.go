@@ -0,0 +1,22 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/aws/aws-dax-go-v2/dax"
+	"github.com/aws/aws-sdk-go-v2/aws"
+)
+
+// NewDynamoDBClientWithDAX crea un cliente que sirve GetItem/Query/Scan desde
+// el clúster DAX indicado y mantiene las escrituras en DynamoDB
+func NewDynamoDBClientWithDAX(tableName, endpoint string, cfg aws.Config) (*DynamoDBClient, error) {
+	client := NewDynamoDBClient(tableName, cfg)
+
+	daxClient, err := dax.NewFromConfig(cfg, endpoint)
+	if err != nil {
+		return nil, fmt.Errorf("error creating DAX client for %s: %w", endpoint, err)
+	}
+
+	client.reader = daxClient
+	return client, nil
+}
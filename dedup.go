@@ -0,0 +1,144 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue"
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/expression"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+)
+
+type MarkerState string
+
+const (
+	MarkerClaimed MarkerState = "claimed"
+	MarkerDone    MarkerState = "done"
+)
+
+type ClaimOutcome int
+
+const (
+	ClaimAcquired ClaimOutcome = iota
+	ClaimAlreadyDone
+	ClaimInProgress
+)
+
+// ProcessingMarker records who claimed a message and whether it finished
+type ProcessingMarker struct {
+	ID           string      `dynamodbav:"id"`
+	State        MarkerState `dynamodbav:"estado"`
+	Instance     string      `dynamodbav:"instancia"`
+	ClaimedUntil int64       `dynamodbav:"reclamadoHasta"`
+	ExpiresAt    int64       `dynamodbav:"expiraEn"`
+	Correlation  string      `dynamodbav:"correlacionId,omitempty"`
+}
+
+// DedupStore implements exactly-once processing with conditional marker
+// writes keyed by the message deduplication ID
+type DedupStore struct {
+	db         *DynamoDBClient
+	instanceID string
+	claimTTL   time.Duration // how long a claim blocks other consumers
+	retention  time.Duration // how long "done" markers are kept
+}
+
+func NewDedupStore(db *DynamoDBClient, instanceID string, claimTTL, retention time.Duration) *DedupStore {
+	return &DedupStore{
+		db:         db,
+		instanceID: instanceID,
+		claimTTL:   claimTTL,
+		retention:  retention,
+	}
+}
+
+// Claim writes a "claimed" marker unless one already exists. Claims whose
+// lease has lapsed (e.g. the owner crashed) can be taken over.
+func (s *DedupStore) Claim(ctx context.Context, id string) (ClaimOutcome, error) {
+	now := time.Now()
+
+	marker := ProcessingMarker{
+		ID:           id,
+		State:        MarkerClaimed,
+		Instance:     s.instanceID,
+		ClaimedUntil: now.Add(s.claimTTL).Unix(),
+		ExpiresAt:    now.Add(s.retention).Unix(),
+		Correlation:  correlationIDFrom(ctx),
+	}
+
+	item, err := attributevalue.MarshalMap(marker)
+	if err != nil {
+		return 0, fmt.Errorf("failed to marshal marker: %w", err)
+	}
+
+	condition := expression.AttributeNotExists(expression.Name("id")).Or(
+		expression.Name("estado").Equal(expression.Value(string(MarkerClaimed))).
+			And(expression.Name("reclamadoHasta").LessThan(expression.Value(now.Unix()))),
+	)
+
+	expr, err := expression.NewBuilder().WithCondition(condition).Build()
+	if err != nil {
+		return 0, fmt.Errorf("error building claim condition: %w", err)
+	}
+
+	err = s.db.PutItemWithCondition(ctx, item, expr)
+	if err == nil {
+		return ClaimAcquired, nil
+	}
+
+	var conditionErr *types.ConditionalCheckFailedException
+	if !errors.As(err, &conditionErr) {
+		return 0, err
+	}
+
+	var existing ProcessingMarker
+	if err := attributevalue.UnmarshalMap(conditionErr.Item, &existing); err != nil {
+		return 0, fmt.Errorf("failed to unmarshal existing marker: %w", err)
+	}
+
+	if existing.State == MarkerDone {
+		return ClaimAlreadyDone, nil
+	}
+	return ClaimInProgress, nil
+}
+
+// ownClaim is the condition that the marker is still claimed by this
+// instance; a claim that lapsed may have been taken over by another one
+func (s *DedupStore) ownClaim() expression.ConditionBuilder {
+	return expression.Name("instancia").Equal(expression.Value(s.instanceID)).
+		And(expression.Name("estado").Equal(expression.Value(string(MarkerClaimed))))
+}
+
+// MarkDone flips the marker to "done" so redeliveries become no-ops. A claim
+// taken over by another instance is left to it.
+func (s *DedupStore) MarkDone(ctx context.Context, id string) error {
+	update := expression.Set(expression.Name("estado"), expression.Value(string(MarkerDone))).
+		Set(expression.Name("expiraEn"), expression.Value(time.Now().Add(s.retention).Unix()))
+
+	expr, err := expression.NewBuilder().WithUpdate(update).WithCondition(s.ownClaim()).Build()
+	if err != nil {
+		return fmt.Errorf("error building done update: %w", err)
+	}
+
+	err = s.db.UpdateItem(ctx, itemKey(id), expr)
+	if isConditionFailed(err) {
+		slog.Warn("Claim was taken over before the message was marked done", "dedup_id", id)
+		return nil
+	}
+	return err
+}
+
+// Release removes a claim after a failure so the redelivery can be
+// processed. A claim taken over by another instance is left to it.
+func (s *DedupStore) Release(ctx context.Context, id string) {
+	expr, err := expression.NewBuilder().WithCondition(s.ownClaim()).Build()
+	if err == nil {
+		err = s.db.DeleteItemWithCondition(ctx, itemKey(id), expr)
+	}
+	if err != nil && !isConditionFailed(err) {
+		slog.Error("Error releasing claim", "dedup_id", id, errAttr(err))
+	}
+}
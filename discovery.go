@@ -0,0 +1,135 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/aws/arn"
+	"github.com/aws/aws-sdk-go-v2/service/resourcegroupstaggingapi"
+	"github.com/aws/aws-sdk-go-v2/service/resourcegroupstaggingapi/types"
+)
+
+// Registry entries created by discovery carry this source so that manual
+// registrations are never removed by it
+const discoverySource = "discovery"
+
+// Discoverer keeps the registry in sync with the Lambda functions carrying a tag
+type Discoverer struct {
+	registry *LambdaRegistry
+	tagging  *resourcegroupstaggingapi.Client
+	tagKey   string
+	tagValue string
+}
+
+// NewDiscoverer builds a discoverer for a "key=value" tag selector
+func NewDiscoverer(registry *LambdaRegistry, cfg aws.Config, tag string) (*Discoverer, error) {
+	key, value, ok := strings.Cut(tag, "=")
+	if !ok || key == "" || value == "" {
+		return nil, fmt.Errorf("invalid discovery tag %q, expected key=value", tag)
+	}
+
+	return &Discoverer{
+		registry: registry,
+		tagging:  resourcegroupstaggingapi.NewFromConfig(cfg),
+		tagKey:   key,
+		tagValue: value,
+	}, nil
+}
+
+// Discover upserts tagged functions and removes discovered entries whose
+// function no longer carries the tag
+func (d *Discoverer) Discover(ctx context.Context) error {
+	arns, err := d.taggedFunctions(ctx)
+	if err != nil {
+		return err
+	}
+
+	lambdas, err := d.registry.List(ctx)
+	if err != nil {
+		return err
+	}
+
+	registered := make(map[string]Lambda, len(lambdas))
+	for _, lambda := range lambdas {
+		registered[lambda.ARN] = lambda
+	}
+
+	for _, functionARN := range arns {
+		if _, ok := registered[functionARN]; ok {
+			continue
+		}
+
+		lambda := Lambda{
+			ID:     functionName(functionARN),
+			ARN:    functionARN,
+			Name:   functionName(functionARN),
+			Status: Healthy,
+			Source: discoverySource,
+		}
+
+		err := d.registry.Create(ctx, lambda)
+		if errors.Is(err, ErrLambdaExists) {
+			slog.Warn("Discovery: id already registered with another ARN, skipping", "lambda_id", lambda.ID, "lambda_arn", functionARN)
+			continue
+		}
+		if err != nil {
+			return fmt.Errorf("error registering %s: %w", functionARN, err)
+		}
+		slog.Info("Discovery: registered lambda", "lambda_id", lambda.ID, "lambda_arn", functionARN)
+	}
+
+	tagged := make(map[string]bool, len(arns))
+	for _, functionARN := range arns {
+		tagged[functionARN] = true
+	}
+
+	for _, lambda := range lambdas {
+		if lambda.Source != discoverySource || tagged[lambda.ARN] {
+			continue
+		}
+
+		if err := d.registry.Delete(ctx, lambda.ID); err != nil {
+			return fmt.Errorf("error removing %s: %w", lambda.ID, err)
+		}
+		slog.Info("Discovery: removed lambda, function no longer tagged", "lambda_id", lambda.ID, "lambda_arn", lambda.ARN)
+	}
+
+	return nil
+}
+
+func (d *Discoverer) taggedFunctions(ctx context.Context) ([]string, error) {
+	paginator := resourcegroupstaggingapi.NewGetResourcesPaginator(d.tagging, &resourcegroupstaggingapi.GetResourcesInput{
+		ResourceTypeFilters: []string{"lambda:function"},
+		TagFilters: []types.TagFilter{
+			{Key: aws.String(d.tagKey), Values: []string{d.tagValue}},
+		},
+	})
+
+	var arns []string
+	for paginator.HasMorePages() {
+		page, err := paginator.NextPage(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("error listing tagged functions: %w", err)
+		}
+
+		for _, resource := range page.ResourceTagMappingList {
+			arns = append(arns, aws.ToString(resource.ResourceARN))
+		}
+	}
+
+	return arns, nil
+}
+
+// functionName extracts the function name from
+// arn:aws:lambda:<region>:<account>:function:<name>
+func functionName(functionARN string) string {
+	parsed, err := arn.Parse(functionARN)
+	if err != nil {
+		return functionARN
+	}
+	return strings.TrimPrefix(parsed.Resource, "function:")
+}
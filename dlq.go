@@ -0,0 +1,402 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"log/slog"
+	"maps"
+	"os"
+	"os/signal"
+	"slices"
+	"strconv"
+	"strings"
+	"syscall"
+	"text/tabwriter"
+	"time"
+
+	"challenge-4-orchestrator/config"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/sqs"
+	"github.com/aws/aws-sdk-go-v2/service/sqs/types"
+)
+
+// DLQMessage is a dead-lettered message with the last failure recorded for
+// it
+type DLQMessage struct {
+	Message  types.Message
+	Age      time.Duration // since the message was first sent
+	Receives int
+	Failure  FailureRecord
+}
+
+// DLQFilter selects dead-lettered messages; zero fields match everything
+type DLQFilter struct {
+	Types  []string
+	MinAge time.Duration
+	MaxAge time.Duration
+}
+
+func (f DLQFilter) Match(m DLQMessage) bool {
+	switch {
+	case len(f.Types) > 0 && !slices.Contains(f.Types, m.Failure.Type):
+		return false
+	case f.MinAge > 0 && m.Age < f.MinAge:
+		return false
+	case f.MaxAge > 0 && m.Age > f.MaxAge:
+		return false
+	}
+	return true
+}
+
+// DLQInspector reads the dead-letter queue and classifies its messages with
+// the failure records of the consumer. Received messages stay hidden for
+// the visibility timeout, so each is seen once per run; those not deleted
+// are made visible again by Release.
+type DLQInspector struct {
+	client     *sqs.Client
+	failures   *FailureLog
+	queueURL   string
+	visibility time.Duration
+
+	received []types.Message // not deleted yet
+}
+
+func NewDLQInspector(cfg aws.Config, failures *FailureLog, queueURL string, visibility time.Duration) *DLQInspector {
+	return &DLQInspector{
+		client: sqs.NewFromConfig(cfg, func(o *sqs.Options) {
+			if endpoint := awsEndpoint("SQS"); endpoint != "" {
+				o.BaseEndpoint = aws.String(endpoint)
+			}
+		}),
+		failures:   failures,
+		queueURL:   queueURL,
+		visibility: visibility,
+	}
+}
+
+// discoverDLQ returns the dead-letter queue of queueURL from its
+// RedrivePolicy, or "" when it has none
+func discoverDLQ(ctx context.Context, cfg aws.Config, queueURL string) (string, error) {
+	client := sqs.NewFromConfig(cfg, func(o *sqs.Options) {
+		if endpoint := awsEndpoint("SQS"); endpoint != "" {
+			o.BaseEndpoint = aws.String(endpoint)
+		}
+	})
+	attrs, err := client.GetQueueAttributes(ctx, &sqs.GetQueueAttributesInput{
+		QueueUrl:       aws.String(queueURL),
+		AttributeNames: []types.QueueAttributeName{types.QueueAttributeNameRedrivePolicy},
+	})
+	if err != nil {
+		return "", fmt.Errorf("error reading redrive policy of %s: %w", queueURL, err)
+	}
+	raw := attrs.Attributes[string(types.QueueAttributeNameRedrivePolicy)]
+	if raw == "" {
+		return "", nil
+	}
+	var policy struct {
+		DeadLetterTargetARN string `json:"deadLetterTargetArn"`
+	}
+	if err := json.Unmarshal([]byte(raw), &policy); err != nil {
+		return "", fmt.Errorf("error parsing redrive policy of %s: %w", queueURL, err)
+	}
+
+	// arn:aws:sqs:<region>:<account>:<name>; the DLQ is in the queue's region
+	parts := strings.Split(policy.DeadLetterTargetARN, ":")
+	if len(parts) != 6 || parts[2] != "sqs" {
+		return "", fmt.Errorf("redrive policy of %s has an invalid target %q", queueURL, policy.DeadLetterTargetARN)
+	}
+	out, err := client.GetQueueUrl(ctx, &sqs.GetQueueUrlInput{
+		QueueName:              aws.String(parts[5]),
+		QueueOwnerAWSAccountId: aws.String(parts[4]),
+	})
+	if err != nil {
+		return "", fmt.Errorf("error resolving DLQ %s: %w", policy.DeadLetterTargetARN, err)
+	}
+	return aws.ToString(out.QueueUrl), nil
+}
+
+// Each receives up to limit messages and calls fn with each batch, until
+// the queue looks empty, fn fails or ctx is done
+func (d *DLQInspector) Each(ctx context.Context, limit int, fn func([]DLQMessage) error) error {
+	for seen := 0; seen < limit; {
+		result, err := d.client.ReceiveMessage(ctx, &sqs.ReceiveMessageInput{
+			QueueUrl:            aws.String(d.queueURL),
+			MaxNumberOfMessages: int32(min(10, limit-seen)),
+			WaitTimeSeconds:     1,
+			VisibilityTimeout:   int32(d.visibility.Seconds()),
+			MessageSystemAttributeNames: []types.MessageSystemAttributeName{
+				types.MessageSystemAttributeNameApproximateReceiveCount,
+				types.MessageSystemAttributeNameSentTimestamp,
+			},
+			MessageAttributeNames: []string{"All"},
+		})
+		if err != nil {
+			return fmt.Errorf("error receiving from %s: %w", d.queueURL, err)
+		}
+		if len(result.Messages) == 0 {
+			return nil
+		}
+		seen += len(result.Messages)
+		d.received = append(d.received, result.Messages...)
+
+		batch, err := d.classify(ctx, result.Messages)
+		if err != nil {
+			return err
+		}
+		if err := fn(batch); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (d *DLQInspector) classify(ctx context.Context, messages []types.Message) ([]DLQMessage, error) {
+	ids := make([]string, 0, len(messages))
+	for _, message := range messages {
+		ids = append(ids, aws.ToString(message.MessageId))
+	}
+	failures, err := d.failures.Lookup(ctx, ids)
+	if err != nil {
+		return nil, fmt.Errorf("error reading failure records: %w", err)
+	}
+
+	now := time.Now()
+	batch := make([]DLQMessage, 0, len(messages))
+	for _, message := range messages {
+		m := DLQMessage{Message: message}
+		if sent, err := strconv.ParseInt(message.Attributes[string(types.MessageSystemAttributeNameSentTimestamp)], 10, 64); err == nil {
+			m.Age = now.Sub(time.UnixMilli(sent))
+		}
+		m.Receives, _ = strconv.Atoi(message.Attributes[string(types.MessageSystemAttributeNameApproximateReceiveCount)])
+		m.Failure = failures[aws.ToString(message.MessageId)]
+		if m.Failure.Type == "" {
+			m.Failure.Type = FailureUnknown
+		}
+		batch = append(batch, m)
+	}
+	return batch, nil
+}
+
+// Delete removes a re-driven message from the dead-letter queue
+func (d *DLQInspector) Delete(ctx context.Context, message types.Message) error {
+	_, err := d.client.DeleteMessage(ctx, &sqs.DeleteMessageInput{
+		QueueUrl:      aws.String(d.queueURL),
+		ReceiptHandle: message.ReceiptHandle,
+	})
+	if err != nil {
+		return fmt.Errorf("error deleting %s: %w", aws.ToString(message.MessageId), err)
+	}
+	d.received = slices.DeleteFunc(d.received, func(m types.Message) bool {
+		return aws.ToString(m.MessageId) == aws.ToString(message.MessageId)
+	})
+	return nil
+}
+
+// Release makes the messages received and not deleted visible again
+func (d *DLQInspector) Release(ctx context.Context) {
+	for batch := range slices.Chunk(d.received, 10) {
+		entries := make([]types.ChangeMessageVisibilityBatchRequestEntry, 0, len(batch))
+		for i, message := range batch {
+			entries = append(entries, types.ChangeMessageVisibilityBatchRequestEntry{
+				Id:                aws.String(strconv.Itoa(i)),
+				ReceiptHandle:     message.ReceiptHandle,
+				VisibilityTimeout: 0,
+			})
+		}
+		result, err := d.client.ChangeMessageVisibilityBatch(ctx, &sqs.ChangeMessageVisibilityBatchInput{
+			QueueUrl: aws.String(d.queueURL),
+			Entries:  entries,
+		})
+		if err == nil && len(result.Failed) > 0 {
+			err = fmt.Errorf("%d messages failed: %s", len(result.Failed), aws.ToString(result.Failed[0].Message))
+		}
+		if err != nil {
+			slog.Warn("Error releasing dead-lettered messages; they become visible after the visibility timeout", errAttr(err))
+		}
+	}
+	d.received = nil
+}
+
+// runDLQ implements `orchestrator dlq`: it lists the dead-lettered messages
+// with their failure type, or re-drives the matching ones to a queue or
+// straight to a Lambda
+func runDLQ(args []string) error {
+	if len(args) == 0 || (args[0] != "list" && args[0] != "redrive") {
+		return errors.New("usage: orchestrator dlq <list|redrive> [flags]")
+	}
+	redrive := args[0] == "redrive"
+
+	flags := flag.NewFlagSet("dlq "+args[0], flag.ExitOnError)
+	configFile := flags.String("config", os.Getenv("CONFIG_FILE"), "YAML or JSON configuration file")
+	dlqURL := flags.String("dlq-url", "", "dead-letter queue; defaults to alerts.dlqUrl, then the redrive policy of the first consumer queue")
+	failureType := flags.String("type", "", "comma-separated failure types to select ("+failureTypes()+"); all when empty")
+	minAge := flags.Duration("min-age", 0, "select messages first sent at least this long ago")
+	maxAge := flags.Duration("max-age", 0, "select messages first sent at most this long ago")
+	limit := flags.Int("limit", 1000, "maximum number of messages to read from the queue")
+	visibility := flags.Duration("visibility", 5*time.Minute, "how long read messages stay hidden while the command runs")
+	toQueue := flags.String("to-queue", "", "redrive: queue receiving the messages; defaults to the first consumer queue")
+	toLambda := flags.String("to-lambda", "", "redrive: invoke this Lambda (name or ARN) with each message instead")
+	rate := flags.Float64("rate", 10, "redrive: messages per second")
+	dryRun := flags.Bool("dry-run", false, "redrive: list the messages that would be re-driven")
+	flags.Parse(args[1:])
+
+	cfg, err := config.Load(*configFile, checkSettings)
+	if err != nil {
+		return err
+	}
+	if *dlqURL == "" {
+		*dlqURL = cfg.Alerts.DLQURL
+	}
+	if *toQueue == "" {
+		if queues := cfg.Consumer.SQSQueues(); len(queues) > 0 {
+			*toQueue = queues[0].URL
+		}
+	}
+	switch {
+	case *limit < 1 || *rate <= 0:
+		return errors.New("-limit and -rate must be positive")
+	case *visibility < time.Second || *visibility > 12*time.Hour:
+		return errors.New("-visibility must be between 1s and 12h")
+	case redrive && *toLambda == "" && *toQueue == "":
+		return errors.New("-to-queue or -to-lambda is required")
+	}
+	filter := DLQFilter{Types: config.SplitList(*failureType), MinAge: *minAge, MaxAge: *maxAge}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	awsCfg, err := config.NewAWSConfig(ctx, cfg.Region, cfg.AWS)
+	if err != nil {
+		return err
+	}
+	// Without a configured DLQ, the one of the first consumer queue
+	if queues := cfg.Consumer.SQSQueues(); *dlqURL == "" && len(queues) > 0 {
+		if *dlqURL, err = discoverDLQ(ctx, awsCfg, queues[0].URL); err != nil {
+			return err
+		}
+	}
+	if *dlqURL == "" {
+		return errors.New("-dlq-url is required when alerts.dlqUrl is not set and the queue has no redrive policy")
+	}
+	failures := NewFailureLog(NewDynamoDBClient(cfg.Consumer.StateTable, awsCfg), "", 0)
+	inspector := NewDLQInspector(awsCfg, failures, *dlqURL, *visibility)
+	// Release with a fresh context, so messages are released after Ctrl-C
+	defer inspector.Release(context.Background())
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "MESSAGE ID\tAGE\tRECEIVES\tTYPE\tERROR")
+	counts := make(map[string]int)
+	show := func(m DLQMessage) {
+		counts[m.Failure.Type]++
+		fmt.Fprintf(w, "%s\t%s\t%d\t%s\t%s\n", aws.ToString(m.Message.MessageId), m.Age.Truncate(time.Second),
+			m.Receives, m.Failure.Type, truncate(m.Failure.Error, 100))
+	}
+
+	var submit func(context.Context, DLQMessage) error
+	if redrive && !*dryRun {
+		submit = redriveToQueue(inspector.client, *toQueue)
+		if *toLambda != "" {
+			lambdaCfg := withAssumedRole(awsCfg, cfg.Router.LambdaRoleARN, cfg.Router.LambdaExternalID)
+			submit = redriveToLambda(NewLambdaClient(lambdaCfg), *toLambda)
+		}
+	}
+	limiter := newTokenBucket(*rate, 1)
+	redriven, failed := 0, 0
+
+	err = inspector.Each(ctx, *limit, func(batch []DLQMessage) error {
+		for _, m := range batch {
+			if !filter.Match(m) {
+				continue
+			}
+			show(m)
+			if submit == nil {
+				continue
+			}
+
+			if err := limiter.Wait(ctx); err != nil {
+				return err
+			}
+			id := aws.ToString(m.Message.MessageId)
+			if err := submit(ctx, m); err != nil {
+				failed++
+				slog.Error("Error re-driving message", "message_id", id, errAttr(err))
+				continue
+			}
+			if err := inspector.Delete(ctx, m.Message); err != nil {
+				// Re-driven but still in the DLQ: a second redrive would
+				// process it twice
+				slog.Error("Message re-driven but not deleted from the DLQ", "message_id", id, errAttr(err))
+			}
+			redriven++
+		}
+		return nil
+	})
+	w.Flush()
+
+	fmt.Println()
+	for _, failureType := range slices.Sorted(maps.Keys(counts)) {
+		fmt.Printf("%s: %d\n", failureType, counts[failureType])
+	}
+	if submit != nil {
+		fmt.Printf("re-driven: %d, failed: %d\n", redriven, failed)
+	}
+	if err != nil {
+		return err
+	}
+	if failed > 0 {
+		return fmt.Errorf("%d messages could not be re-driven", failed)
+	}
+	return nil
+}
+
+// redriveToQueue sends a dead-lettered message back to a queue with its
+// attributes
+func redriveToQueue(client *sqs.Client, queueURL string) func(context.Context, DLQMessage) error {
+	fifo := strings.HasSuffix(queueURL, ".fifo")
+	return func(ctx context.Context, m DLQMessage) error {
+		id := aws.ToString(m.Message.MessageId)
+		attributes := maps.Clone(m.Message.MessageAttributes)
+		if attributes == nil {
+			attributes = make(map[string]types.MessageAttributeValue)
+		}
+		attributes["redriveOf"] = types.MessageAttributeValue{DataType: aws.String("String"), StringValue: aws.String(id)}
+
+		input := &sqs.SendMessageInput{
+			QueueUrl:          aws.String(queueURL),
+			MessageBody:       m.Message.Body,
+			MessageAttributes: attributes,
+		}
+		if fifo {
+			input.MessageGroupId = aws.String(id)
+			input.MessageDeduplicationId = aws.String("redrive-" + id)
+		}
+		if _, err := client.SendMessage(ctx, input); err != nil {
+			return fmt.Errorf("error sending to %s: %w", queueURL, err)
+		}
+		return nil
+	}
+}
+
+// redriveToLambda invokes a Lambda with the message body, bypassing the
+// integrity check and the routing
+func redriveToLambda(client *LambdaClient, function string) func(context.Context, DLQMessage) error {
+	return func(ctx context.Context, m DLQMessage) error {
+		body := json.RawMessage(aws.ToString(m.Message.Body))
+		if !json.Valid(body) {
+			return errors.New("message body is not JSON")
+		}
+		_, err := client.InvokeSync(ctx, function, body)
+		return err
+	}
+}
+
+// truncate shortens s to at most n bytes for table output
+func truncate(s string, n int) string {
+	if len(s) <= n {
+		return s
+	}
+	return s[:n-3] + "..."
+}
@@ -0,0 +1,139 @@
+package main
+
+import (
+	"context"
+	"log/slog"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// Drain phases
+const (
+	drainDraining = "draining"
+	drainDrained  = "drained"
+	drainTimedOut = "timed_out" // messages were still in flight at the deadline
+)
+
+// defaultDrainDeadline bounds a drain requested without a deadline
+const defaultDrainDeadline = 5 * time.Minute
+
+var instanceDraining = NewGaugeVec(
+	"orchestrator_instance_draining",
+	"1 once the instance is draining for retirement.",
+)
+
+// DrainState reports the progress of a drain
+type DrainState struct {
+	Phase      string     `json:"phase"`
+	StartedAt  time.Time  `json:"startedAt"`
+	Deadline   time.Time  `json:"deadline"`
+	InFlight   int64      `json:"inFlight"`
+	FinishedAt *time.Time `json:"finishedAt,omitempty"`
+}
+
+// DrainAPI retires the instance on POST /admin/drain: the sources stop
+// fetching, the fetches in progress and their messages finish or the
+// deadline passes, and then /ready answers 503 so the load balancer or the
+// Auto Scaling group can take the instance out. GET /admin/drain reports the
+// progress. A drain cannot be undone, not even by a resume; the instance has
+// to be replaced.
+type DrainAPI struct {
+	consumer  *SQSConsumer
+	readiness *ReadinessChecker
+	auth      Authenticator
+
+	mu    sync.Mutex
+	state *DrainState // nil until a drain starts
+}
+
+func NewDrainAPI(consumer *SQSConsumer, readiness *ReadinessChecker, auth Authenticator) *DrainAPI {
+	return &DrainAPI{consumer: consumer, readiness: readiness, auth: auth}
+}
+
+func (d *DrainAPI) Register(mux *http.ServeMux) {
+	mux.Handle("POST /admin/drain", requireAuth(d.auth, http.HandlerFunc(d.start)))
+	mux.Handle("GET /admin/drain", requireAuth(d.auth, http.HandlerFunc(d.status)))
+}
+
+// start begins the drain, with the deadline query parameter (e.g. 2m) or
+// defaultDrainDeadline. Draining again reports the drain in progress.
+func (d *DrainAPI) start(w http.ResponseWriter, r *http.Request) {
+	deadline := defaultDrainDeadline
+	if value := r.URL.Query().Get("deadline"); value != "" {
+		parsed, err := time.ParseDuration(value)
+		if err != nil || parsed <= 0 {
+			writeError(w, http.StatusBadRequest, "deadline must be a positive duration, e.g. 2m")
+			return
+		}
+		deadline = parsed
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.state != nil {
+		writeJSON(w, http.StatusOK, d.snapshot())
+		return
+	}
+
+	now := time.Now().UTC()
+	d.state = &DrainState{Phase: drainDraining, StartedAt: now, Deadline: now.Add(deadline)}
+	d.consumer.Retire("drain")
+	instanceDraining.Set(1)
+	slog.Warn("Admin: draining instance", "deadline", deadline, "in_flight", d.consumer.InFlight())
+
+	// The drain outlives the request
+	go d.wait(context.Background(), d.state.Deadline)
+	writeJSON(w, http.StatusAccepted, d.snapshot())
+}
+
+func (d *DrainAPI) status(w http.ResponseWriter, r *http.Request) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.state == nil {
+		writeError(w, http.StatusNotFound, "the instance is not draining")
+		return
+	}
+	writeJSON(w, http.StatusOK, d.snapshot())
+}
+
+// snapshot copies the state with the current in-flight count while the drain
+// runs; d.mu must be held
+func (d *DrainAPI) snapshot() DrainState {
+	state := *d.state
+	if state.Phase == drainDraining {
+		state.InFlight = d.consumer.InFlight()
+	}
+	return state
+}
+
+// wait polls the sources until none is fetching or processing a message, or
+// the deadline passes, then fails the readiness probe
+func (d *DrainAPI) wait(ctx context.Context, deadline time.Time) {
+	ctx, cancel := context.WithDeadline(ctx, deadline)
+	defer cancel()
+
+	phase := drainDrained
+	for !d.consumer.Idle() {
+		if sleepContext(ctx, 250*time.Millisecond) != nil {
+			phase = drainTimedOut
+			break
+		}
+	}
+
+	inFlight := d.consumer.InFlight()
+	d.readiness.SetNotReady("instance " + phase)
+
+	d.mu.Lock()
+	finished := time.Now().UTC()
+	d.state.Phase = phase
+	d.state.InFlight = inFlight
+	d.state.FinishedAt = &finished
+	d.mu.Unlock()
+
+	if phase == drainTimedOut {
+		slog.Warn("Admin: drain deadline passed with messages in flight", "in_flight", inFlight)
+		return
+	}
+	slog.Info("Admin: instance drained, readiness probe failing")
+}
@@ -2,10 +2,12 @@ package main
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"time"
 
 	"github.com/aws/aws-sdk-go-v2/aws"
-	"github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/expression"
 	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
 	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
 )
@@ -17,45 +19,172 @@ const (
 	Unhealthy Status = "fallando"
 )
 
+// Valid indica si el estado es uno de los reconocidos por el registro
+func (s Status) Valid() bool {
+	return s == Healthy || s == Unhealthy
+}
+
+// TargetType distingue las Lambdas de las máquinas de estado de Step
+// Functions; vacío equivale a TargetLambda
+type TargetType string
+
+const (
+	TargetLambda        TargetType = "lambda"
+	TargetStepFunctions TargetType = "stepfunctions"
+)
+
+// Valid indica si el tipo de destino es uno de los soportados
+func (t TargetType) Valid() bool {
+	return t == "" || t == TargetLambda || t == TargetStepFunctions
+}
+
 type Lambda struct {
-	ID            string `dynamodbav:"id"`
-	ARN           string `dynamodbav:"arn"`
-	URL           string `dynamodbav:"direccionLambda"`
-	Status        Status `dynamodbav:"estadoSalud"`
-	Name          string `dynamodbav:"nombreLambda"`
-	LastHeartBeat string `dynamodbav:"ultimoLatido"`
+	ID            string `dynamodbav:"id" json:"id"`
+	ARN           string `dynamodbav:"arn" json:"arn"`
+	URL           string `dynamodbav:"direccionLambda" json:"url,omitempty"`
+	Status        Status `dynamodbav:"estadoSalud" json:"status"`
+	Name          string `dynamodbav:"nombreLambda" json:"name"`
+	LastHeartBeat string `dynamodbav:"ultimoLatido" json:"lastHeartbeat,omitempty"`
+	Weight        *int   `dynamodbav:"peso,omitempty" json:"weight,omitempty"` // sin peso pesa 1; 0 no recibe tráfico
+	Source        string `dynamodbav:"origen,omitempty" json:"source,omitempty"`
+	ExpiresAt     int64  `dynamodbav:"expiraEn,omitempty" json:"expiresAt,omitempty"`
+	Region        string `dynamodbav:"region,omitempty" json:"region,omitempty"`         // vacío: la del ARN
+	ReplicaARN    string `dynamodbav:"arnReplica,omitempty" json:"replicaArn,omitempty"` // réplica en la región secundaria
+	Canary        bool   `dynamodbav:"canario,omitempty" json:"canary,omitempty"`        // solo recibe tráfico con el flag canaryRouting
+	StatusReason  string `dynamodbav:"motivoEstado,omitempty" json:"statusReason,omitempty"`
+	// Con TargetStepFunctions, ARN es el de la máquina de estado
+	Type TargetType `dynamodbav:"tipo,omitempty" json:"type,omitempty"`
+	// Esperar a que termine la ejecución y responder con su salida
+	WaitForResult bool `dynamodbav:"esperarResultado,omitempty" json:"waitForResult,omitempty"`
+	// Inquilinos fijados a esta entrada; vacío la deja en el grupo compartido
+	Tenants []string `dynamodbav:"inquilinos,omitempty" json:"tenants,omitempty"`
+	// Marcada cuando su respuesta discrepó de la mayoría en una verificación
+	// por quórum; sigue recibiendo tráfico
+	Suspect       bool   `dynamodbav:"sospechosa,omitempty" json:"suspect,omitempty"`
+	SuspectReason string `dynamodbav:"motivoSospecha,omitempty" json:"suspectReason,omitempty"`
+	// Invocaciones por segundo como máximo; 0 no limita
+	MaxRate float64 `dynamodbav:"tasaMaxima,omitempty" json:"maxRate,omitempty"`
+}
+
+// EffectiveWeight es el peso de enrutamiento: 1 sin peso; con 0 la Lambda
+// queda drenada
+func (l Lambda) EffectiveWeight() int {
+	if l.Weight == nil {
+		return 1
+	}
+	return *l.Weight
+}
+
+// dynamoDBReader agrupa las lecturas que pueden servirse desde DAX
+type dynamoDBReader interface {
+	GetItem(ctx context.Context, params *dynamodb.GetItemInput, optFns ...func(*dynamodb.Options)) (*dynamodb.GetItemOutput, error)
+	Query(ctx context.Context, params *dynamodb.QueryInput, optFns ...func(*dynamodb.Options)) (*dynamodb.QueryOutput, error)
+	Scan(ctx context.Context, params *dynamodb.ScanInput, optFns ...func(*dynamodb.Options)) (*dynamodb.ScanOutput, error)
 }
 
 type DynamoDBClient struct {
 	tableName string
 	client    *dynamodb.Client
+	reader    dynamoDBReader // GetItem/Query/Scan; es client salvo que se use DAX
+	pacer     *throttlePacer
+	secondary *dynamodb.Client // réplica de la tabla global, con failover activo
+	failover  *regionFailover
 }
 
-// NewDynamoDBClient crea un nuevo cliente de DynamoDB
-func NewDynamoDBClient(tableName, region string) (*DynamoDBClient, error) {
-	cfg, err := config.LoadDefaultConfig(context.TODO(),
-		config.WithRegion(region),
-	)
-	if err != nil {
-		return nil, err
+type readOptions struct {
+	consistent bool
+}
+
+// ReadOption ajusta una lectura de GetItem, Query o Scan
+type ReadOption func(*readOptions)
+
+// ConsistentRead - Solicitar (o no) una lectura fuertemente consistente
+func ConsistentRead(consistent bool) ReadOption {
+	return func(o *readOptions) {
+		o.consistent = consistent
 	}
+}
+
+func applyReadOptions(opts []ReadOption) readOptions {
+	var o readOptions
+	for _, opt := range opts {
+		opt(&o)
+	}
+	return o
+}
+
+// NewDynamoDBClient crea un nuevo cliente de DynamoDB con la configuración
+// AWS compartida
+func NewDynamoDBClient(tableName string, cfg aws.Config) *DynamoDBClient {
+	pacer := &throttlePacer{}
+	client := dynamodb.NewFromConfig(cfg, func(o *dynamodb.Options) {
+		// Endpoint alternativo para desarrollo local (LocalStack)
+		if endpoint := awsEndpoint("DYNAMODB"); endpoint != "" {
+			o.BaseEndpoint = aws.String(endpoint)
+		}
+		o.APIOptions = append(o.APIOptions, pacer.observeAttempts)
+	})
 
 	return &DynamoDBClient{
 		tableName: tableName,
-		client:    dynamodb.NewFromConfig(cfg),
-	}, nil
+		client:    client,
+		reader:    client,
+		pacer:     pacer,
+	}
+}
+
+// EnableFailover envía las lecturas y escrituras a la réplica de la tabla
+// global en region mientras la región primaria esté degradada
+func (d *DynamoDBClient) EnableFailover(cfg aws.Config, region string, opts FailoverOptions) {
+	d.secondary = dynamodb.NewFromConfig(cfg, func(o *dynamodb.Options) {
+		o.Region = region
+		if endpoint := awsEndpoint("DYNAMODB"); endpoint != "" {
+			o.BaseEndpoint = aws.String(endpoint)
+		}
+		o.APIOptions = append(o.APIOptions, d.pacer.observeAttempts)
+	})
+	d.failover = newRegionFailover("dynamodb", cfg.Region, opts)
+}
+
+// FailoverState devuelve el estado del failover, nil si no está activo
+func (d *DynamoDBClient) FailoverState() *FailoverState {
+	if d.failover == nil {
+		return nil
+	}
+	state := d.failover.state()
+	return &state
+}
+
+func (d *DynamoDBClient) writeClient() *dynamodb.Client {
+	if d.failover.useSecondary() {
+		return d.secondary
+	}
+	return d.client
+}
+
+func (d *DynamoDBClient) readClient() dynamoDBReader {
+	if d.failover.useSecondary() {
+		return d.secondary
+	}
+	return d.reader
 }
 
-func (d *DynamoDBClient) GetItem(ctx context.Context, id string) (map[string]types.AttributeValue, error) {
+func (d *DynamoDBClient) GetItem(ctx context.Context, id string, opts ...ReadOption) (map[string]types.AttributeValue, error) {
+	o := applyReadOptions(opts)
 
 	// Construir la clave
 	key := map[string]types.AttributeValue{
 		"id": &types.AttributeValueMemberS{Value: id},
 	}
 
-	result, err := d.client.GetItem(ctx, &dynamodb.GetItemInput{
-		TableName: aws.String(d.tableName),
-		Key:       key,
+	var result *dynamodb.GetItemOutput
+	err := d.withThrottlePacing(ctx, func() (err error) {
+		result, err = d.readClient().GetItem(ctx, &dynamodb.GetItemInput{
+			TableName:      aws.String(d.tableName),
+			Key:            key,
+			ConsistentRead: aws.Bool(o.consistent),
+		})
+		return err
 	})
 
 	if err != nil {
@@ -65,43 +194,112 @@ func (d *DynamoDBClient) GetItem(ctx context.Context, id string) (map[string]typ
 	return result.Item, nil
 }
 
-func (d *DynamoDBClient) Query(ctx context.Context, keyCondition string, expressionValues map[string]types.AttributeValue) ([]map[string]types.AttributeValue, error) {
-	result, err := d.client.Query(ctx, &dynamodb.QueryInput{
+// Query - Consultar la tabla con una expresión construida con expression.NewBuilder,
+// que debe incluir la condición de clave y opcionalmente filtro y proyección
+func (d *DynamoDBClient) Query(ctx context.Context, expr expression.Expression, opts ...ReadOption) ([]map[string]types.AttributeValue, error) {
+	o := applyReadOptions(opts)
+
+	input := &dynamodb.QueryInput{
 		TableName:                 aws.String(d.tableName),
-		KeyConditionExpression:    aws.String(keyCondition),
-		ExpressionAttributeValues: expressionValues,
-	})
+		ConsistentRead:            aws.Bool(o.consistent),
+		KeyConditionExpression:    expr.KeyCondition(),
+		FilterExpression:          expr.Filter(),
+		ProjectionExpression:      expr.Projection(),
+		ExpressionAttributeNames:  expr.Names(),
+		ExpressionAttributeValues: expr.Values(),
+	}
 
-	if err != nil {
-		return nil, fmt.Errorf("error querying: %w", err)
+	// Cada página devuelve como máximo 1 MB
+	var items []map[string]types.AttributeValue
+	paginator := dynamodb.NewQueryPaginator(d.readClient(), input)
+	for paginator.HasMorePages() {
+		var page *dynamodb.QueryOutput
+		err := d.withThrottlePacing(ctx, func() (err error) {
+			page, err = paginator.NextPage(ctx)
+			return err
+		})
+		if err != nil {
+			return nil, fmt.Errorf("error querying: %w", err)
+		}
+		items = append(items, page.Items...)
 	}
 
-	return result.Items, nil
+	return items, nil
 }
 
-func (d *DynamoDBClient) Scan(ctx context.Context, filterExpression *string, expressionValues map[string]types.AttributeValue) ([]map[string]types.AttributeValue, error) {
+// QueryIndex - Consultar un índice secundario, recorriendo todas las páginas.
+// Los GSI solo admiten lecturas eventualmente consistentes
+func (d *DynamoDBClient) QueryIndex(ctx context.Context, indexName string, expr expression.Expression) ([]map[string]types.AttributeValue, error) {
+	input := &dynamodb.QueryInput{
+		TableName:                 aws.String(d.tableName),
+		IndexName:                 aws.String(indexName),
+		KeyConditionExpression:    expr.KeyCondition(),
+		FilterExpression:          expr.Filter(),
+		ProjectionExpression:      expr.Projection(),
+		ExpressionAttributeNames:  expr.Names(),
+		ExpressionAttributeValues: expr.Values(),
+	}
+
+	var items []map[string]types.AttributeValue
+	paginator := dynamodb.NewQueryPaginator(d.readClient(), input)
+
+	for paginator.HasMorePages() {
+		var page *dynamodb.QueryOutput
+		err := d.withThrottlePacing(ctx, func() (err error) {
+			page, err = paginator.NextPage(ctx)
+			return err
+		})
+		if err != nil {
+			return nil, fmt.Errorf("error querying index %s: %w", indexName, err)
+		}
+		items = append(items, page.Items...)
+	}
+
+	return items, nil
+}
+
+// Scan - Recorrer la tabla completa, página a página; expr es opcional y
+// puede aportar filtro y proyección
+func (d *DynamoDBClient) Scan(ctx context.Context, expr *expression.Expression, opts ...ReadOption) ([]map[string]types.AttributeValue, error) {
+	o := applyReadOptions(opts)
+
 	input := &dynamodb.ScanInput{
-		TableName: aws.String(d.tableName),
+		TableName:      aws.String(d.tableName),
+		ConsistentRead: aws.Bool(o.consistent),
 	}
 
-	if filterExpression != nil {
-		input.FilterExpression = filterExpression
-		input.ExpressionAttributeValues = expressionValues
+	if expr != nil {
+		input.FilterExpression = expr.Filter()
+		input.ProjectionExpression = expr.Projection()
+		input.ExpressionAttributeNames = expr.Names()
+		input.ExpressionAttributeValues = expr.Values()
 	}
 
-	result, err := d.client.Scan(ctx, input)
-	if err != nil {
-		return nil, fmt.Errorf("error scanning: %w", err)
+	var items []map[string]types.AttributeValue
+	paginator := dynamodb.NewScanPaginator(d.readClient(), input)
+	for paginator.HasMorePages() {
+		var page *dynamodb.ScanOutput
+		err := d.withThrottlePacing(ctx, func() (err error) {
+			page, err = paginator.NextPage(ctx)
+			return err
+		})
+		if err != nil {
+			return nil, fmt.Errorf("error scanning: %w", err)
+		}
+		items = append(items, page.Items...)
 	}
 
-	return result.Items, nil
+	return items, nil
 }
 
 // PutItem - Insertar o actualizar un ítem
 func (d *DynamoDBClient) PutItem(ctx context.Context, item map[string]types.AttributeValue) error {
-	_, err := d.client.PutItem(ctx, &dynamodb.PutItemInput{
-		TableName: aws.String(d.tableName),
-		Item:      item,
+	err := d.withThrottlePacing(ctx, func() error {
+		_, err := d.writeClient().PutItem(ctx, &dynamodb.PutItemInput{
+			TableName: aws.String(d.tableName),
+			Item:      item,
+		})
+		return err
 	})
 
 	if err != nil {
@@ -111,13 +309,41 @@ func (d *DynamoDBClient) PutItem(ctx context.Context, item map[string]types.Attr
 	return nil
 }
 
-// UpdateItem - Actualizar atributos específicos de un ítem
-func (d *DynamoDBClient) UpdateItem(ctx context.Context, key map[string]types.AttributeValue, updateExpression string, expressionValues map[string]types.AttributeValue) error {
-	_, err := d.client.UpdateItem(ctx, &dynamodb.UpdateItemInput{
-		TableName:                 aws.String(d.tableName),
-		Key:                       key,
-		UpdateExpression:          aws.String(updateExpression),
-		ExpressionAttributeValues: expressionValues,
+// PutItemWithCondition - Insertar un ítem solo si se cumple la condición de expr.
+// Si la condición falla, el ConditionalCheckFailedException incluye el ítem actual
+func (d *DynamoDBClient) PutItemWithCondition(ctx context.Context, item map[string]types.AttributeValue, expr expression.Expression) error {
+	err := d.withThrottlePacing(ctx, func() error {
+		_, err := d.writeClient().PutItem(ctx, &dynamodb.PutItemInput{
+			TableName:                           aws.String(d.tableName),
+			Item:                                item,
+			ConditionExpression:                 expr.Condition(),
+			ExpressionAttributeNames:            expr.Names(),
+			ExpressionAttributeValues:           expr.Values(),
+			ReturnValuesOnConditionCheckFailure: types.ReturnValuesOnConditionCheckFailureAllOld,
+		})
+		return err
+	})
+
+	if err != nil {
+		return fmt.Errorf("error putting item: %w", err)
+	}
+
+	return nil
+}
+
+// UpdateItem - Actualizar atributos específicos de un ítem; expr debe incluir
+// la expresión de actualización y opcionalmente una condición
+func (d *DynamoDBClient) UpdateItem(ctx context.Context, key map[string]types.AttributeValue, expr expression.Expression) error {
+	err := d.withThrottlePacing(ctx, func() error {
+		_, err := d.writeClient().UpdateItem(ctx, &dynamodb.UpdateItemInput{
+			TableName:                 aws.String(d.tableName),
+			Key:                       key,
+			UpdateExpression:          expr.Update(),
+			ConditionExpression:       expr.Condition(),
+			ExpressionAttributeNames:  expr.Names(),
+			ExpressionAttributeValues: expr.Values(),
+		})
+		return err
 	})
 
 	if err != nil {
@@ -127,11 +353,41 @@ func (d *DynamoDBClient) UpdateItem(ctx context.Context, key map[string]types.At
 	return nil
 }
 
+// UpdateItemReturningOld - Igual que UpdateItem, pero devuelve los valores
+// que tenían los atributos modificados antes de la escritura (UPDATED_OLD)
+func (d *DynamoDBClient) UpdateItemReturningOld(ctx context.Context, key map[string]types.AttributeValue, expr expression.Expression) (map[string]types.AttributeValue, error) {
+	var old map[string]types.AttributeValue
+	err := d.withThrottlePacing(ctx, func() error {
+		result, err := d.writeClient().UpdateItem(ctx, &dynamodb.UpdateItemInput{
+			TableName:                 aws.String(d.tableName),
+			Key:                       key,
+			UpdateExpression:          expr.Update(),
+			ConditionExpression:       expr.Condition(),
+			ExpressionAttributeNames:  expr.Names(),
+			ExpressionAttributeValues: expr.Values(),
+			ReturnValues:              types.ReturnValueUpdatedOld,
+		})
+		if err == nil {
+			old = result.Attributes
+		}
+		return err
+	})
+
+	if err != nil {
+		return nil, fmt.Errorf("error updating item: %w", err)
+	}
+
+	return old, nil
+}
+
 // DeleteItem - Eliminar un ítem
 func (d *DynamoDBClient) DeleteItem(ctx context.Context, key map[string]types.AttributeValue) error {
-	_, err := d.client.DeleteItem(ctx, &dynamodb.DeleteItemInput{
-		TableName: aws.String(d.tableName),
-		Key:       key,
+	err := d.withThrottlePacing(ctx, func() error {
+		_, err := d.writeClient().DeleteItem(ctx, &dynamodb.DeleteItemInput{
+			TableName: aws.String(d.tableName),
+			Key:       key,
+		})
+		return err
 	})
 
 	if err != nil {
@@ -140,3 +396,269 @@ func (d *DynamoDBClient) DeleteItem(ctx context.Context, key map[string]types.At
 
 	return nil
 }
+
+// DeleteItemWithCondition - Eliminar un ítem solo si se cumple la condición de expr
+func (d *DynamoDBClient) DeleteItemWithCondition(ctx context.Context, key map[string]types.AttributeValue, expr expression.Expression) error {
+	err := d.withThrottlePacing(ctx, func() error {
+		_, err := d.writeClient().DeleteItem(ctx, &dynamodb.DeleteItemInput{
+			TableName:                 aws.String(d.tableName),
+			Key:                       key,
+			ConditionExpression:       expr.Condition(),
+			ExpressionAttributeNames:  expr.Names(),
+			ExpressionAttributeValues: expr.Values(),
+		})
+		return err
+	})
+
+	if err != nil {
+		return fmt.Errorf("error deleting item: %w", err)
+	}
+
+	return nil
+}
+
+// DescribeTable - Verificar que la tabla existe y está accesible
+func (d *DynamoDBClient) DescribeTable(ctx context.Context) (*types.TableDescription, error) {
+	result, err := d.client.DescribeTable(ctx, &dynamodb.DescribeTableInput{
+		TableName: aws.String(d.tableName),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("error describing table: %w", err)
+	}
+	return result.Table, nil
+}
+
+// CheckKeySchema - Verificar que la tabla existe con la clave de partición
+// "id" de tipo cadena, sin clave de ordenación, y con el GSI statusIndex si
+// se indica
+func (d *DynamoDBClient) CheckKeySchema(ctx context.Context, statusIndex string) error {
+	table, err := d.DescribeTable(ctx)
+	if err != nil {
+		return err
+	}
+
+	if len(table.KeySchema) != 1 || aws.ToString(table.KeySchema[0].AttributeName) != "id" ||
+		table.KeySchema[0].KeyType != types.KeyTypeHash {
+		return fmt.Errorf("table %s must have the partition key id and no sort key", d.tableName)
+	}
+	for _, attribute := range table.AttributeDefinitions {
+		if aws.ToString(attribute.AttributeName) == "id" && attribute.AttributeType != types.ScalarAttributeTypeS {
+			return fmt.Errorf("table %s: the key id must be a string, not %s", d.tableName, attribute.AttributeType)
+		}
+	}
+
+	if statusIndex == "" {
+		return nil
+	}
+	for _, index := range table.GlobalSecondaryIndexes {
+		if aws.ToString(index.IndexName) == statusIndex {
+			return nil
+		}
+	}
+	return fmt.Errorf("table %s has no index %s: %w", d.tableName, statusIndex, errMissingIndex)
+}
+
+// errMissingIndex - La tabla existe pero sin el GSI indicado; las lecturas
+// por estado recurren a Scan
+var errMissingIndex = errors.New("status index not found")
+
+// EnsureTable - Crear la tabla (clave "id" y, si se indica, GSI de
+// estadoSalud) si no existe; devuelve true si la creó
+func (d *DynamoDBClient) EnsureTable(ctx context.Context, statusIndex string) (bool, error) {
+	_, err := d.client.DescribeTable(ctx, &dynamodb.DescribeTableInput{
+		TableName: aws.String(d.tableName),
+	})
+	if err == nil {
+		return false, nil
+	}
+
+	var notFound *types.ResourceNotFoundException
+	if !errors.As(err, &notFound) {
+		return false, fmt.Errorf("error describing table: %w", err)
+	}
+
+	input := &dynamodb.CreateTableInput{
+		TableName:   aws.String(d.tableName),
+		BillingMode: types.BillingModePayPerRequest,
+		AttributeDefinitions: []types.AttributeDefinition{
+			{AttributeName: aws.String("id"), AttributeType: types.ScalarAttributeTypeS},
+		},
+		KeySchema: []types.KeySchemaElement{
+			{AttributeName: aws.String("id"), KeyType: types.KeyTypeHash},
+		},
+	}
+
+	if statusIndex != "" {
+		input.AttributeDefinitions = append(input.AttributeDefinitions, types.AttributeDefinition{
+			AttributeName: aws.String("estadoSalud"), AttributeType: types.ScalarAttributeTypeS,
+		})
+		input.GlobalSecondaryIndexes = []types.GlobalSecondaryIndex{{
+			IndexName: aws.String(statusIndex),
+			KeySchema: []types.KeySchemaElement{
+				{AttributeName: aws.String("estadoSalud"), KeyType: types.KeyTypeHash},
+			},
+			Projection: &types.Projection{ProjectionType: types.ProjectionTypeAll},
+		}}
+	}
+
+	if _, err := d.client.CreateTable(ctx, input); err != nil {
+		return false, fmt.Errorf("error creating table: %w", err)
+	}
+
+	waiter := dynamodb.NewTableExistsWaiter(d.client)
+	if err := waiter.Wait(ctx, &dynamodb.DescribeTableInput{TableName: aws.String(d.tableName)}, 5*time.Minute); err != nil {
+		return true, fmt.Errorf("error waiting for table: %w", err)
+	}
+
+	return true, nil
+}
+
+// TTLEnabled - Indicar si el TTL de la tabla está activo (o activándose)
+// sobre el atributo indicado
+func (d *DynamoDBClient) TTLEnabled(ctx context.Context, attribute string) (bool, error) {
+	current, err := d.client.DescribeTimeToLive(ctx, &dynamodb.DescribeTimeToLiveInput{
+		TableName: aws.String(d.tableName),
+	})
+	if err != nil {
+		return false, fmt.Errorf("error describing ttl: %w", err)
+	}
+
+	desc := current.TimeToLiveDescription
+	return desc != nil && aws.ToString(desc.AttributeName) == attribute &&
+		(desc.TimeToLiveStatus == types.TimeToLiveStatusEnabled || desc.TimeToLiveStatus == types.TimeToLiveStatusEnabling), nil
+}
+
+// EnableTTL - Activar el TTL de la tabla sobre el atributo indicado si aún no lo está
+func (d *DynamoDBClient) EnableTTL(ctx context.Context, attribute string) error {
+	enabled, err := d.TTLEnabled(ctx, attribute)
+	if err != nil || enabled {
+		return err
+	}
+
+	_, err = d.client.UpdateTimeToLive(ctx, &dynamodb.UpdateTimeToLiveInput{
+		TableName: aws.String(d.tableName),
+		TimeToLiveSpecification: &types.TimeToLiveSpecification{
+			AttributeName: aws.String(attribute),
+			Enabled:       aws.Bool(true),
+		},
+	})
+	if err != nil {
+		return fmt.Errorf("error enabling ttl: %w", err)
+	}
+
+	return nil
+}
+
+const (
+	// DynamoDB limita BatchWriteItem a 25 solicitudes y BatchGetItem a 100 claves
+	maxBatchWriteSize = 25
+	maxBatchGetSize   = 100
+	maxBatchRetries   = 5
+	batchRetryBase    = 50 * time.Millisecond
+)
+
+// BatchGetItem - Obtener varios ítems por clave, reintentando las claves no procesadas
+func (d *DynamoDBClient) BatchGetItem(ctx context.Context, keys []map[string]types.AttributeValue) ([]map[string]types.AttributeValue, error) {
+	var items []map[string]types.AttributeValue
+
+	for start := 0; start < len(keys); start += maxBatchGetSize {
+		end := min(start+maxBatchGetSize, len(keys))
+
+		pending := map[string]types.KeysAndAttributes{
+			d.tableName: {Keys: keys[start:end]},
+		}
+
+		for attempt := 0; len(pending) > 0; attempt++ {
+			if attempt > maxBatchRetries {
+				return items, fmt.Errorf("error batch getting items: %d keys still unprocessed after %d retries", len(pending[d.tableName].Keys), maxBatchRetries)
+			}
+			if attempt > 0 {
+				if err := batchBackoff(ctx, attempt); err != nil {
+					return items, err
+				}
+			}
+
+			var result *dynamodb.BatchGetItemOutput
+			err := d.withThrottlePacing(ctx, func() (err error) {
+				result, err = d.writeClient().BatchGetItem(ctx, &dynamodb.BatchGetItemInput{
+					RequestItems: pending,
+				})
+				return err
+			})
+			if err != nil {
+				return items, fmt.Errorf("error batch getting items: %w", err)
+			}
+
+			items = append(items, result.Responses[d.tableName]...)
+			pending = result.UnprocessedKeys
+		}
+	}
+
+	return items, nil
+}
+
+// BatchWriteItem - Insertar o eliminar varios ítems en lotes, reintentando las solicitudes no procesadas
+func (d *DynamoDBClient) BatchWriteItem(ctx context.Context, requests []types.WriteRequest) error {
+	for start := 0; start < len(requests); start += maxBatchWriteSize {
+		end := min(start+maxBatchWriteSize, len(requests))
+
+		pending := map[string][]types.WriteRequest{
+			d.tableName: requests[start:end],
+		}
+
+		for attempt := 0; len(pending) > 0; attempt++ {
+			if attempt > maxBatchRetries {
+				return fmt.Errorf("error batch writing items: %d requests still unprocessed after %d retries", len(pending[d.tableName]), maxBatchRetries)
+			}
+			if attempt > 0 {
+				if err := batchBackoff(ctx, attempt); err != nil {
+					return err
+				}
+			}
+
+			var result *dynamodb.BatchWriteItemOutput
+			err := d.withThrottlePacing(ctx, func() (err error) {
+				result, err = d.writeClient().BatchWriteItem(ctx, &dynamodb.BatchWriteItemInput{
+					RequestItems: pending,
+				})
+				return err
+			})
+			if err != nil {
+				return fmt.Errorf("error batch writing items: %w", err)
+			}
+
+			pending = result.UnprocessedItems
+		}
+	}
+
+	return nil
+}
+
+// BatchPutItems - Insertar o actualizar varios ítems usando BatchWriteItem
+func (d *DynamoDBClient) BatchPutItems(ctx context.Context, items []map[string]types.AttributeValue) error {
+	requests := make([]types.WriteRequest, 0, len(items))
+	for _, item := range items {
+		requests = append(requests, types.WriteRequest{
+			PutRequest: &types.PutRequest{Item: item},
+		})
+	}
+
+	return d.BatchWriteItem(ctx, requests)
+}
+
+// BatchDeleteItems - Eliminar varios ítems por clave usando BatchWriteItem
+func (d *DynamoDBClient) BatchDeleteItems(ctx context.Context, keys []map[string]types.AttributeValue) error {
+	requests := make([]types.WriteRequest, 0, len(keys))
+	for _, key := range keys {
+		requests = append(requests, types.WriteRequest{
+			DeleteRequest: &types.DeleteRequest{Key: key},
+		})
+	}
+
+	return d.BatchWriteItem(ctx, requests)
+}
+
+// batchBackoff espera de forma exponencial entre reintentos de un lote
+func batchBackoff(ctx context.Context, attempt int) error {
+	return sleepContext(ctx, batchRetryBase<<(attempt-1))
+}
@@ -0,0 +1,153 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"log/slog"
+	"sort"
+	"sync"
+	"time"
+)
+
+// emfMaxValues is the CloudWatch limit of values per metric in one EMF document
+const emfMaxValues = 100
+
+// EMFEmitter aggregates processing metrics and periodically writes them as
+// CloudWatch Embedded Metric Format log lines, which CloudWatch Logs turns
+// into metrics without a Prometheus server
+type EMFEmitter struct {
+	namespace string
+	out       io.Writer
+	interval  time.Duration
+
+	mu    sync.Mutex
+	stats map[string]*emfStats // keyed by Lambda ARN, "" when none was selected
+}
+
+type emfStats struct {
+	processed int
+	failed    int
+	latencies []float64 // milliseconds
+}
+
+func NewEMFEmitter(namespace string, out io.Writer, interval time.Duration) *EMFEmitter {
+	return &EMFEmitter{
+		namespace: namespace,
+		out:       out,
+		interval:  interval,
+		stats:     make(map[string]*emfStats),
+	}
+}
+
+// Record adds one processed message. It is a no-op on a nil emitter so
+// callers do not need to check whether EMF is enabled.
+func (e *EMFEmitter) Record(lambdaARN string, duration time.Duration, err error) {
+	if e == nil {
+		return
+	}
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	stats, ok := e.stats[lambdaARN]
+	if !ok {
+		stats = &emfStats{}
+		e.stats[lambdaARN] = stats
+	}
+	stats.processed++
+	if err != nil {
+		stats.failed++
+	}
+	stats.latencies = append(stats.latencies, float64(duration.Microseconds())/1000)
+}
+
+// Start flushes the aggregated metrics every interval until the context is done
+func (e *EMFEmitter) Start(ctx context.Context) {
+	ticker := time.NewTicker(e.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			e.Flush()
+		}
+	}
+}
+
+// Flush writes one EMF document per Lambda ARN and resets the aggregates
+func (e *EMFEmitter) Flush() {
+	if e == nil {
+		return
+	}
+
+	e.mu.Lock()
+	stats := e.stats
+	e.stats = make(map[string]*emfStats)
+	e.mu.Unlock()
+
+	arns := make([]string, 0, len(stats))
+	for arn := range stats {
+		arns = append(arns, arn)
+	}
+	sort.Strings(arns)
+
+	timestamp := time.Now().UnixMilli()
+	for _, arn := range arns {
+		for _, doc := range e.documents(timestamp, arn, stats[arn]) {
+			line, err := json.Marshal(doc)
+			if err != nil {
+				slog.Error("Error encoding EMF document", errAttr(err))
+				continue
+			}
+			if _, err := e.out.Write(append(line, '\n')); err != nil {
+				slog.Error("Error writing EMF document", errAttr(err))
+				return
+			}
+		}
+	}
+}
+
+// documents splits the latency samples into chunks of emfMaxValues; the
+// counters are only reported in the first document
+func (e *EMFEmitter) documents(timestamp int64, arn string, stats *emfStats) []map[string]any {
+	dimensions := [][]string{{"Service"}}
+	if arn != "" {
+		dimensions = append(dimensions, []string{"Service", "LambdaArn"})
+	}
+
+	var docs []map[string]any
+	for start := 0; start < len(stats.latencies); start += emfMaxValues {
+		end := min(start+emfMaxValues, len(stats.latencies))
+
+		metrics := []map[string]string{{"Name": "Latency", "Unit": "Milliseconds"}}
+		doc := map[string]any{
+			"Service": serviceName,
+			"Latency": stats.latencies[start:end],
+		}
+		if arn != "" {
+			doc["LambdaArn"] = arn
+		}
+		if start == 0 {
+			metrics = append(metrics,
+				map[string]string{"Name": "Processed", "Unit": "Count"},
+				map[string]string{"Name": "Failed", "Unit": "Count"},
+			)
+			doc["Processed"] = stats.processed
+			doc["Failed"] = stats.failed
+		}
+
+		doc["_aws"] = map[string]any{
+			"Timestamp": timestamp,
+			"CloudWatchMetrics": []map[string]any{{
+				"Namespace":  e.namespace,
+				"Dimensions": dimensions,
+				"Metrics":    metrics,
+			}},
+		}
+		docs = append(docs, doc)
+	}
+	return docs
+}
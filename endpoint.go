@@ -0,0 +1,20 @@
+package main
+
+import (
+	"log/slog"
+	"os"
+)
+
+// awsEndpoint returns the endpoint override for a service, e.g. LocalStack
+// at http://localhost:4566. AWS_ENDPOINT_URL_<SERVICE> wins over the global
+// AWS_ENDPOINT_URL; an empty result keeps the default AWS endpoint.
+func awsEndpoint(service string) string {
+	endpoint := os.Getenv("AWS_ENDPOINT_URL_" + service)
+	if endpoint == "" {
+		endpoint = os.Getenv("AWS_ENDPOINT_URL")
+	}
+	if endpoint != "" {
+		slog.Info("Using custom AWS endpoint", "service", service, "endpoint", endpoint)
+	}
+	return endpoint
+}
@@ -0,0 +1,68 @@
+package main
+
+import (
+	"context"
+	"errors"
+)
+
+// Pipeline errors. They are wrapped with context on the way up, so callers
+// branch on them with errors.Is; errorClass maps them to the class used by
+// the metrics, the failure records and the DLQ filters.
+var (
+	// ErrIntegrityFailed is a message the integrity Lambda rejected
+	ErrIntegrityFailed = errors.New("integrity check failed")
+	// ErrNoHealthyLambdas means the registry has no worker to route to
+	ErrNoHealthyLambdas = errors.New("no healthy lambdas found")
+	// ErrInvokeThrottled is a worker or integrity invocation rejected by the
+	// Lambda concurrency limits
+	ErrInvokeThrottled = errors.New("lambda invocation throttled")
+	// ErrRegistryUnavailable means the registry could not be read
+	ErrRegistryUnavailable = errors.New("registry unavailable")
+	// ErrSchemaInvalid is a payload not matching the JSON Schema of its
+	// message type, see SchemaError
+	ErrSchemaInvalid = errors.New("schema validation failed")
+	// ErrFanOutFailed is a fanned-out message that too few workers handled
+	ErrFanOutFailed = errors.New("fan-out success threshold not met")
+	// ErrQuorumNotReached is a verified message whose workers did not agree
+	// on a majority response
+	ErrQuorumNotReached = errors.New("quorum not reached")
+	// ErrBatchItemFailed is a message a worker reported as failed in the
+	// response to a batched invocation
+	ErrBatchItemFailed = errors.New("batch item failed")
+)
+
+var pipelineErrors = NewCounterVec(
+	"orchestrator_errors_total",
+	"Messages that failed, by error class (integrity, schema, no_worker, registry, throttled, timeout, panic, processing).",
+	"class",
+)
+
+// errorClass maps a processing error to its class, one of the Failure
+// types
+func errorClass(err error) string {
+	switch {
+	case errors.Is(err, ErrIntegrityFailed):
+		return FailureIntegrity
+	case errors.Is(err, ErrSchemaInvalid):
+		return FailureSchema
+	case errors.Is(err, ErrNoHealthyLambdas):
+		return FailureNoWorker
+	case errors.Is(err, ErrRegistryUnavailable):
+		return FailureRegistry
+	case errors.Is(err, errPanic):
+		return FailurePanic
+	case errors.Is(err, context.DeadlineExceeded):
+		return FailureTimeout
+	case errors.Is(err, ErrInvokeThrottled), isThrottleError(err):
+		return FailureThrottled
+	}
+	return FailureProcessing
+}
+
+// isRetryable reports whether another attempt may succeed. A rejected
+// signature or an invalid payload is rejected again, so ordered sources
+// skip the message at once instead of holding their partition for every
+// attempt.
+func isRetryable(err error) bool {
+	return !errors.Is(err, ErrIntegrityFailed) && !errors.Is(err, ErrSchemaInvalid)
+}
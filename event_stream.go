@@ -0,0 +1,196 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"challenge-4-orchestrator/config"
+)
+
+// streamHealthChanged is streamed when a worker Lambda changes health status
+const streamHealthChanged = "HealthChanged"
+
+// streamBuffer is how many events a slow subscriber can fall behind before
+// events are dropped for it
+const streamBuffer = 256
+
+// streamKeepAlive keeps idle connections open through proxies
+const streamKeepAlive = 15 * time.Second
+
+// streamEventTypes are the event types a subscriber can filter on
+var streamEventTypes = map[string]bool{
+	EventMessageReceived:  true,
+	EventIntegrityFailed:  true,
+	EventLambdaInvoked:    true,
+	EventProcessingFailed: true,
+	EventMessageProcessed: true,
+	streamHealthChanged:   true,
+}
+
+var streamEventsDropped = NewCounterVec(
+	"orchestrator_event_stream_dropped_total",
+	"Events not delivered to a live stream subscriber that fell behind.",
+)
+
+var streamSubscribers = NewGaugeVec(
+	"orchestrator_event_stream_subscribers",
+	"Connected GET /admin/events subscribers.",
+)
+
+// HealthChange is the data of a HealthChanged event
+type HealthChange struct {
+	ID         string    `json:"id"`
+	ARN        string    `json:"arn"`
+	Status     Status    `json:"status"`
+	Previous   Status    `json:"previous"`
+	Reason     string    `json:"reason,omitempty"`
+	InstanceID string    `json:"instanceId"`
+	Timestamp  time.Time `json:"timestamp"`
+}
+
+type streamEvent struct {
+	id        uint64
+	eventType string
+	data      []byte
+}
+
+// EventStream fans processing events out to the operators connected to
+// GET /admin/events, as server-sent events. Like the EventBridge publisher
+// it never blocks processing: a subscriber that falls behind misses events.
+// A nil *EventStream drops every event.
+type EventStream struct {
+	instanceID string
+	nextID     atomic.Uint64
+
+	mu          sync.Mutex
+	subscribers map[chan streamEvent]struct{}
+}
+
+func NewEventStream(instanceID string) *EventStream {
+	return &EventStream{
+		instanceID:  instanceID,
+		subscribers: make(map[chan streamEvent]struct{}),
+	}
+}
+
+// Publish streams a lifecycle event of the message in ctx
+func (s *EventStream) Publish(ctx context.Context, eventType string, event LifecycleEvent) {
+	if s == nil {
+		return
+	}
+	event.stamp(ctx, eventType, s.instanceID)
+	s.broadcast(eventType, event)
+}
+
+// PublishHealthChange streams a health status change of a worker Lambda
+func (s *EventStream) PublishHealthChange(lambda Lambda, previous Status) {
+	if s == nil {
+		return
+	}
+	s.broadcast(streamHealthChanged, HealthChange{
+		ID:         lambda.ID,
+		ARN:        lambda.ARN,
+		Status:     lambda.Status,
+		Previous:   previous,
+		Reason:     lambda.StatusReason,
+		InstanceID: s.instanceID,
+		Timestamp:  time.Now().UTC(),
+	})
+}
+
+func (s *EventStream) broadcast(eventType string, data any) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if len(s.subscribers) == 0 {
+		return
+	}
+
+	payload, err := json.Marshal(data)
+	if err != nil {
+		slog.Error("Error marshaling streamed event", "event", eventType, errAttr(err))
+		return
+	}
+	event := streamEvent{id: s.nextID.Add(1), eventType: eventType, data: payload}
+	for ch := range s.subscribers {
+		select {
+		case ch <- event:
+		default:
+			streamEventsDropped.Inc()
+		}
+	}
+}
+
+func (s *EventStream) subscribe() chan streamEvent {
+	ch := make(chan streamEvent, streamBuffer)
+	s.mu.Lock()
+	s.subscribers[ch] = struct{}{}
+	streamSubscribers.Set(float64(len(s.subscribers)))
+	s.mu.Unlock()
+	return ch
+}
+
+func (s *EventStream) unsubscribe(ch chan streamEvent) {
+	s.mu.Lock()
+	delete(s.subscribers, ch)
+	streamSubscribers.Set(float64(len(s.subscribers)))
+	s.mu.Unlock()
+}
+
+// ServeHTTP streams events until the client disconnects. ?types= takes a
+// comma-separated list of event types to receive; the default is all.
+func (s *EventStream) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	var types map[string]bool
+	if list := config.SplitList(r.URL.Query().Get("types")); len(list) > 0 {
+		types = make(map[string]bool, len(list))
+		for _, eventType := range list {
+			if !streamEventTypes[eventType] {
+				writeError(w, http.StatusBadRequest, "unknown event type: "+eventType)
+				return
+			}
+			types[eventType] = true
+		}
+	}
+
+	events := s.subscribe()
+	defer s.unsubscribe(events)
+
+	rc := http.NewResponseController(w)
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("X-Accel-Buffering", "no")
+	w.WriteHeader(http.StatusOK)
+	if err := rc.Flush(); err != nil {
+		slog.Error("Event stream: response cannot be streamed", errAttr(err))
+		return
+	}
+
+	keepAlive := time.NewTicker(streamKeepAlive)
+	defer keepAlive.Stop()
+	for {
+		var err error
+		select {
+		case <-r.Context().Done():
+			return
+		case <-keepAlive.C:
+			_, err = fmt.Fprint(w, ": keep-alive\n\n")
+		case event := <-events:
+			if types != nil && !types[event.eventType] {
+				continue
+			}
+			_, err = fmt.Fprintf(w, "id: %d\nevent: %s\ndata: %s\n\n", event.id, event.eventType, event.data)
+		}
+		if err == nil {
+			err = rc.Flush()
+		}
+		if err != nil {
+			slog.Debug("Event stream: subscriber gone", "remote_addr", r.RemoteAddr, errAttr(err))
+			return
+		}
+	}
+}
@@ -0,0 +1,181 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/eventbridge"
+	"github.com/aws/aws-sdk-go-v2/service/eventbridge/types"
+)
+
+// Lifecycle events, used as the EventBridge detail-type
+const (
+	EventMessageReceived  = "MessageReceived"
+	EventIntegrityFailed  = "IntegrityFailed"
+	EventLambdaInvoked    = "LambdaInvoked"
+	EventProcessingFailed = "ProcessingFailed"
+	EventMessageProcessed = "MessageProcessed"
+)
+
+// lifecycleSchemaVersion is bumped on incompatible changes to LifecycleEvent
+const lifecycleSchemaVersion = "1"
+
+// maxPutEntries is the PutEvents batch limit
+const maxPutEntries = 10
+
+var lifecycleEvents = NewCounterVec(
+	"orchestrator_lifecycle_events_total",
+	"Lifecycle events sent to EventBridge, by event and result.",
+	"event", "result",
+)
+
+// LifecycleEvent is the detail of every lifecycle event. Rules match on
+// source, detail-type and these fields:
+//
+//	schemaVersion  always set, "1"
+//	messageId      SQS message ID, always set
+//	correlationId  set once the message is parsed
+//	instanceId     orchestrator instance, always set
+//	timestamp      RFC 3339, always set
+//	receiveCount   MessageReceived: SQS receive count
+//	lambdaArn      LambdaInvoked, MessageProcessed: the worker that handled
+//	               the message
+//	lambdaName     LambdaInvoked, MessageProcessed: its registry name
+//	durationMs     LambdaInvoked: invocation time; ProcessingFailed: time
+//	               until the failure; MessageProcessed: processing time
+//	error          IntegrityFailed, ProcessingFailed: the failure
+type LifecycleEvent struct {
+	SchemaVersion string    `json:"schemaVersion"`
+	MessageID     string    `json:"messageId"`
+	CorrelationID string    `json:"correlationId,omitempty"`
+	InstanceID    string    `json:"instanceId"`
+	Timestamp     time.Time `json:"timestamp"`
+	ReceiveCount  string    `json:"receiveCount,omitempty"`
+	LambdaARN     string    `json:"lambdaArn,omitempty"`
+	LambdaName    string    `json:"lambdaName,omitempty"`
+	DurationMs    int64     `json:"durationMs,omitempty"`
+	Error         string    `json:"error,omitempty"`
+
+	detailType string
+}
+
+// stamp sets the fields common to every event from the message in ctx
+func (e *LifecycleEvent) stamp(ctx context.Context, detailType, instanceID string) {
+	e.detailType = detailType
+	e.SchemaVersion = lifecycleSchemaVersion
+	e.MessageID = messageIDFrom(ctx)
+	e.CorrelationID = correlationIDFrom(ctx)
+	e.InstanceID = instanceID
+	e.Timestamp = time.Now().UTC()
+}
+
+// EventPublisher sends lifecycle events to an EventBridge bus. Like the
+// routing audit it never blocks message processing: events are dropped when
+// the buffer is full. A nil *EventPublisher drops every event.
+type EventPublisher struct {
+	client     *eventbridge.Client
+	busName    string
+	source     string
+	instanceID string
+	events     chan LifecycleEvent
+}
+
+func NewEventPublisher(busName, source string, cfg aws.Config, instanceID string) *EventPublisher {
+	return &EventPublisher{
+		client: eventbridge.NewFromConfig(cfg, func(o *eventbridge.Options) {
+			if endpoint := awsEndpoint("EVENTBRIDGE"); endpoint != "" {
+				o.BaseEndpoint = aws.String(endpoint)
+			}
+		}),
+		busName:    busName,
+		source:     source,
+		instanceID: instanceID,
+		events:     make(chan LifecycleEvent, 1000),
+	}
+}
+
+// Publish queues an event of type detailType for the message in ctx
+func (p *EventPublisher) Publish(ctx context.Context, detailType string, event LifecycleEvent) {
+	if p == nil {
+		return
+	}
+
+	event.stamp(ctx, detailType, p.instanceID)
+	select {
+	case p.events <- event:
+	default:
+		lifecycleEvents.Inc(detailType, "dropped")
+		slog.Warn("Lifecycle event buffer full, dropping event", "event", detailType, "message_id", event.MessageID)
+	}
+}
+
+// Start sends buffered events, batching the ones already queued, until the
+// context is done
+func (p *EventPublisher) Start(ctx context.Context) {
+	slog.Info("Starting lifecycle events", "event_bus", p.busName, "source", p.source)
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case event := <-p.events:
+			batch := []LifecycleEvent{event}
+		drain:
+			for len(batch) < maxPutEntries {
+				select {
+				case event := <-p.events:
+					batch = append(batch, event)
+				default:
+					break drain
+				}
+			}
+			if err := p.put(ctx, batch); err != nil {
+				slog.Error("Error publishing lifecycle events", "event_bus", p.busName, "events", len(batch), errAttr(err))
+			}
+		}
+	}
+}
+
+func (p *EventPublisher) put(ctx context.Context, batch []LifecycleEvent) error {
+	entries := make([]types.PutEventsRequestEntry, 0, len(batch))
+	for _, event := range batch {
+		detail, err := json.Marshal(event)
+		if err != nil {
+			return fmt.Errorf("error marshaling %s event: %w", event.detailType, err)
+		}
+		entries = append(entries, types.PutEventsRequestEntry{
+			EventBusName: aws.String(p.busName),
+			Source:       aws.String(p.source),
+			DetailType:   aws.String(event.detailType),
+			Detail:       aws.String(string(detail)),
+			Time:         aws.Time(event.Timestamp),
+		})
+	}
+
+	out, err := p.client.PutEvents(ctx, &eventbridge.PutEventsInput{Entries: entries})
+	if err != nil {
+		for _, event := range batch {
+			lifecycleEvents.Inc(event.detailType, "failure")
+		}
+		return fmt.Errorf("error putting events: %w", err)
+	}
+
+	// Entries fail individually; the results are in request order
+	for i, result := range out.Entries {
+		if i >= len(batch) {
+			break
+		}
+		if result.ErrorCode != nil {
+			lifecycleEvents.Inc(batch[i].detailType, "failure")
+			slog.Warn("Lifecycle event rejected", "event", batch[i].detailType, "message_id", batch[i].MessageID,
+				"error_code", aws.ToString(result.ErrorCode), "error_message", aws.ToString(result.ErrorMessage))
+			continue
+		}
+		lifecycleEvents.Inc(batch[i].detailType, "success")
+	}
+	return nil
+}
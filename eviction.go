@@ -0,0 +1,221 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"math/rand"
+	"sync"
+	"time"
+)
+
+// Eviction states of a worker
+const (
+	evictionAdmitted  = "admitted"
+	evictionEvicted   = "evicted"
+	evictionProbation = "probation" // receives probe traffic
+)
+
+// evictionBuckets is the number of buckets of the sliding window
+const evictionBuckets = 12
+
+var (
+	lambdaErrorRate = NewGaugeVec(
+		"orchestrator_lambda_error_rate",
+		"Error rate of each worker over the eviction window.",
+		"lambda_arn",
+	)
+	lambdaEvicted = NewGaugeVec(
+		"orchestrator_lambda_evicted",
+		"1 while a worker is evicted or on probation for its error rate.",
+		"lambda_arn",
+	)
+	lambdaEvictions = NewCounterVec(
+		"orchestrator_lambda_evictions_total",
+		"Workers evicted for their error rate, by worker.",
+		"lambda_arn",
+	)
+)
+
+// EvictionOptions configures the error-rate eviction
+type EvictionOptions struct {
+	ErrorRate   float64       // evicts over this fraction of failed invocations
+	Window      time.Duration // sliding window of the error rate
+	MinRequests int           // invocations in the window before evicting
+	Probation   time.Duration // eviction time before the probe traffic
+	// ProbeRate is the fraction of the messages a worker on probation is a
+	// candidate for; ProbeSuccesses successful probes in a row re-admit it
+	ProbeRate      float64
+	ProbeSuccesses int
+}
+
+// evictionBucket counts the invocations of a slice of the window
+type evictionBucket struct {
+	start         time.Time
+	total, failed int
+}
+
+// workerHealth is the sliding window and eviction state of a worker
+type workerHealth struct {
+	buckets   [evictionBuckets]evictionBucket
+	state     string
+	evictedAt time.Time
+	probes    int // successful probes in a row
+}
+
+// rate returns the error rate and the invocations of the window
+func (h *workerHealth) rate(now time.Time, window time.Duration) (float64, int) {
+	total, failed := 0, 0
+	for _, bucket := range h.buckets {
+		if now.Sub(bucket.start) < window {
+			total += bucket.total
+			failed += bucket.failed
+		}
+	}
+	if total == 0 {
+		return 0, 0
+	}
+	return float64(failed) / float64(total), total
+}
+
+// EvictionTracker takes the workers with a high recent error rate out of
+// routing for a probation period, then sends them a fraction of the
+// traffic until enough probes succeed. It complements the registry health,
+// which only the heartbeats and operators change, with what this instance
+// sees. A nil *EvictionTracker evicts nothing.
+type EvictionTracker struct {
+	opts EvictionOptions
+
+	mu      sync.Mutex
+	workers map[string]*workerHealth // by ARN
+	onEvict []func(arn, reason string)
+}
+
+func NewEvictionTracker(opts EvictionOptions) *EvictionTracker {
+	return &EvictionTracker{opts: opts, workers: make(map[string]*workerHealth)}
+}
+
+// OnEvict registers fn to be called when a worker is evicted
+func (t *EvictionTracker) OnEvict(fn func(arn, reason string)) {
+	t.onEvict = append(t.onEvict, fn)
+}
+
+func (t *EvictionTracker) worker(arn string) *workerHealth {
+	health, ok := t.workers[arn]
+	if !ok {
+		health = &workerHealth{state: evictionAdmitted}
+		t.workers[arn] = health
+	}
+	return health
+}
+
+// Record counts an invocation of arn. Cancelled invocations say nothing
+// about the worker and are ignored.
+func (t *EvictionTracker) Record(arn string, err error) {
+	if t == nil || arn == "" || errors.Is(err, context.Canceled) {
+		return
+	}
+	now := time.Now()
+	t.mu.Lock()
+	health := t.worker(arn)
+
+	width := int64(t.opts.Window / evictionBuckets)
+	slot := now.UnixNano() / width
+	bucket := &health.buckets[slot%evictionBuckets]
+	if start := time.Unix(0, slot*width); !bucket.start.Equal(start) {
+		*bucket = evictionBucket{start: start}
+	}
+	bucket.total++
+	if err != nil {
+		bucket.failed++
+	}
+	rate, total := health.rate(now, t.opts.Window)
+	lambdaErrorRate.Set(rate, arn)
+
+	var reason string
+	switch health.state {
+	case evictionProbation:
+		if err != nil {
+			reason = fmt.Sprintf("probe failed: %v", err)
+			break
+		}
+		health.probes++
+		if health.probes >= t.opts.ProbeSuccesses {
+			health.state = evictionAdmitted
+			health.buckets = [evictionBuckets]evictionBucket{}
+			lambdaEvicted.Set(0, arn)
+			slog.Info("Worker re-admitted after probation", "lambda_arn", arn, "probes", health.probes)
+		}
+	case evictionAdmitted:
+		if total >= t.opts.MinRequests && rate > t.opts.ErrorRate {
+			reason = fmt.Sprintf("error rate %.0f%% over %s", rate*100, t.opts.Window)
+		}
+	}
+	if reason != "" {
+		health.state = evictionEvicted
+		health.evictedAt = now
+		health.probes = 0
+		lambdaEvicted.Set(1, arn)
+		lambdaEvictions.Inc(arn)
+	}
+	callbacks := t.onEvict
+	t.mu.Unlock()
+
+	if reason != "" {
+		slog.Warn("Worker evicted", "lambda_arn", arn, "reason", reason, "probation", t.opts.Probation)
+		for _, fn := range callbacks {
+			fn(arn, reason)
+		}
+	}
+}
+
+// Filter removes the evicted workers from the candidates, and the workers
+// on probation except for a ProbeRate of the messages. When every
+// candidate is evicted they are all kept: an eviction never stops routing.
+func (t *EvictionTracker) Filter(lambdas []Lambda) []Lambda {
+	if t == nil {
+		return lambdas
+	}
+	now := time.Now()
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	admitted := make([]Lambda, 0, len(lambdas))
+	for _, lambda := range lambdas {
+		health, ok := t.workers[lambda.ARN]
+		if !ok {
+			admitted = append(admitted, lambda)
+			continue
+		}
+		if health.state == evictionEvicted && now.Sub(health.evictedAt) >= t.opts.Probation {
+			health.state = evictionProbation
+			slog.Info("Worker on probation", "lambda_arn", lambda.ARN)
+		}
+		switch health.state {
+		case evictionAdmitted:
+			admitted = append(admitted, lambda)
+		case evictionProbation:
+			if rand.Float64() < t.opts.ProbeRate {
+				admitted = append(admitted, lambda)
+			}
+		}
+	}
+	if len(admitted) == 0 {
+		return lambdas
+	}
+	return admitted
+}
+
+// State returns the eviction state of arn
+func (t *EvictionTracker) State(arn string) string {
+	if t == nil {
+		return evictionAdmitted
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if health, ok := t.workers[arn]; ok {
+		return health.state
+	}
+	return evictionAdmitted
+}
@@ -0,0 +1,129 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"net"
+	"sync"
+	"time"
+
+	awshttp "github.com/aws/aws-sdk-go-v2/aws/transport/http"
+)
+
+var regionFailoverActive = NewGaugeVec(
+	"orchestrator_region_failover_active",
+	"1 while calls to a service are failed over from the region to its secondary.",
+	"service", "region",
+)
+
+// FailoverOptions controls when a service fails over to its secondary region
+type FailoverOptions struct {
+	// Threshold is the number of consecutive regional errors that trigger
+	// the failover
+	Threshold int
+	// FailbackAfter is how long to stay on the secondary region before
+	// probing the primary again
+	FailbackAfter time.Duration
+}
+
+// isRegionalError reports errors that point at a degraded region rather than
+// at the request: 5xx responses and network failures. A cancelled or timed
+// out context is the caller's, not the region's.
+func isRegionalError(err error) bool {
+	if isContextError(err) {
+		return false
+	}
+	var respErr *awshttp.ResponseError
+	if errors.As(err, &respErr) {
+		return respErr.HTTPStatusCode() >= 500
+	}
+	var netErr net.Error
+	return errors.As(err, &netErr)
+}
+
+func isContextError(err error) bool {
+	return errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded)
+}
+
+// regionFailover is a per-region breaker: after Threshold consecutive
+// regional errors calls go to the secondary region, and once FailbackAfter
+// has passed they probe the primary again, failing back on the first
+// success. A nil regionFailover never fails over.
+type regionFailover struct {
+	service string
+	region  string
+	opts    FailoverOptions
+
+	mu           sync.Mutex
+	failures     int
+	failedOverAt time.Time // zero while on the primary region
+}
+
+func newRegionFailover(service, region string, opts FailoverOptions) *regionFailover {
+	regionFailoverActive.Set(0, service, region)
+	return &regionFailover{service: service, region: region, opts: opts}
+}
+
+// useSecondary reports whether the next call should go to the secondary region
+func (f *regionFailover) useSecondary() bool {
+	if f == nil {
+		return false
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return !f.failedOverAt.IsZero() && time.Since(f.failedOverAt) < f.opts.FailbackAfter
+}
+
+// record updates the breaker with the outcome of a call to the primary region
+func (f *regionFailover) record(err error) {
+	if f == nil {
+		return
+	}
+	// A call the caller gave up on says nothing about the region
+	if isContextError(err) {
+		return
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if err == nil || !isRegionalError(err) {
+		if !f.failedOverAt.IsZero() {
+			slog.Info("Primary region recovered, failing back", "service", f.service, "region", f.region)
+			regionFailoverActive.Set(0, f.service, f.region)
+		}
+		f.failures = 0
+		f.failedOverAt = time.Time{}
+		return
+	}
+
+	f.failures++
+	switch {
+	case !f.failedOverAt.IsZero():
+		// The probe failed: stay on the secondary region
+		f.failedOverAt = time.Now()
+	case f.failures >= f.opts.Threshold:
+		slog.Warn("Primary region degraded, failing over", "service", f.service, "region", f.region, "failures", f.failures, errAttr(err))
+		regionFailoverActive.Set(1, f.service, f.region)
+		f.failedOverAt = time.Now()
+	}
+}
+
+// FailoverState is the breaker of a service in a region, for diagnostics
+type FailoverState struct {
+	Service      string     `json:"service"`
+	Region       string     `json:"region"`
+	Failures     int        `json:"consecutiveFailures"`
+	FailedOverAt *time.Time `json:"failedOverAt,omitempty"` // set while on the secondary region
+}
+
+func (f *regionFailover) state() FailoverState {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	state := FailoverState{Service: f.service, Region: f.region, Failures: f.failures}
+	if !f.failedOverAt.IsZero() {
+		at := f.failedOverAt
+		state.FailedOverAt = &at
+	}
+	return state
+}
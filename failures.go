@@ -0,0 +1,108 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+)
+
+// failurePrefix prefixes the failure records in the state table
+const failurePrefix = "fallo#"
+
+// Failure types, the error classes of errorClass
+const (
+	FailureIntegrity  = "integrity"
+	FailureSchema     = "schema"
+	FailureNoWorker   = "no_worker"
+	FailureRegistry   = "registry"
+	FailureTimeout    = "timeout"
+	FailureThrottled  = "throttled"
+	FailurePanic      = "panic"
+	FailureProcessing = "processing" // the worker or handler returned an error
+	FailureUnknown    = "unknown"    // no record, e.g. it expired
+)
+
+// FailureRecord is the last failure of a message, kept so the messages that
+// reach the dead-letter queue can be classified
+type FailureRecord struct {
+	ID        string `dynamodbav:"id"`
+	MessageID string `dynamodbav:"mensajeId"`
+	Source    string `dynamodbav:"origen"`
+	Type      string `dynamodbav:"tipoError"`
+	Error     string `dynamodbav:"error"`
+	Attempt   string `dynamodbav:"intento,omitempty"`
+	Instance  string `dynamodbav:"instancia"`
+	FailedAt  string `dynamodbav:"fecha"` // RFC 3339
+	ExpiresAt int64  `dynamodbav:"expiraEn"`
+}
+
+// FailureLog records the last failure of each message in the state table.
+// A nil *FailureLog records nothing.
+type FailureLog struct {
+	db         *DynamoDBClient
+	instanceID string
+	retention  time.Duration
+}
+
+func NewFailureLog(db *DynamoDBClient, instanceID string, retention time.Duration) *FailureLog {
+	return &FailureLog{db: db, instanceID: instanceID, retention: retention}
+}
+
+// Record overwrites the failure of the message with err
+func (f *FailureLog) Record(ctx context.Context, message InboundMessage, err error) {
+	if f == nil {
+		return
+	}
+	now := time.Now()
+	record := FailureRecord{
+		ID:        failurePrefix + message.ID,
+		MessageID: message.ID,
+		Source:    message.System,
+		Type:      errorClass(err),
+		Error:     err.Error(),
+		Attempt:   message.Attempt,
+		Instance:  f.instanceID,
+		FailedAt:  now.UTC().Format(time.RFC3339),
+		ExpiresAt: now.Add(f.retention).Unix(),
+	}
+
+	item, err := attributevalue.MarshalMap(record)
+	if err == nil {
+		err = f.db.PutItem(ctx, item)
+	}
+	if err != nil {
+		loggerFrom(ctx).Error("Error recording message failure", errAttr(err))
+	}
+}
+
+// Lookup returns the failures of the messages that have one, by message ID
+func (f *FailureLog) Lookup(ctx context.Context, messageIDs []string) (map[string]FailureRecord, error) {
+	keys := make([]map[string]types.AttributeValue, 0, len(messageIDs))
+	for _, id := range messageIDs {
+		keys = append(keys, itemKey(failurePrefix+id))
+	}
+	items, err := f.db.BatchGetItem(ctx, keys)
+	if err != nil {
+		return nil, err
+	}
+
+	var records []FailureRecord
+	if err := attributevalue.UnmarshalListOfMaps(items, &records); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal failure records: %w", err)
+	}
+	failures := make(map[string]FailureRecord, len(records))
+	for _, record := range records {
+		failures[record.MessageID] = record
+	}
+	return failures, nil
+}
+
+// failureTypes lists the types accepted by the DLQ filters
+func failureTypes() string {
+	return strings.Join([]string{FailureIntegrity, FailureSchema, FailureNoWorker, FailureRegistry, FailureTimeout, FailureThrottled,
+		FailurePanic, FailureProcessing, FailureUnknown}, ", ")
+}
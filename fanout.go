@@ -0,0 +1,155 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"slices"
+	"sync"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+var fanOutInvocations = NewCounterVec(
+	"orchestrator_fanout_invocations_total",
+	"Worker invocations of fanned-out messages, by result (success, failure).",
+	"result",
+)
+
+// FanOut sends the messages of some types to every healthy worker instead
+// of one, e.g. cache invalidations. A nil *FanOut fans out nothing.
+type FanOut struct {
+	typeField string
+	types     []string
+	threshold float64 // fraction of the workers that must succeed
+}
+
+func NewFanOut(types []string, typeField string, threshold float64) *FanOut {
+	return &FanOut{typeField: typeField, types: types, threshold: threshold}
+}
+
+// Match reports whether msg is of a fanned-out type
+func (f *FanOut) Match(msg any) bool {
+	if f == nil {
+		return false
+	}
+	fields, _ := msg.(map[string]any)
+	messageType, ok := fields[f.typeField].(string)
+	return ok && slices.Contains(f.types, messageType)
+}
+
+// succeeded reports whether enough of the invoked workers succeeded
+func (f *FanOut) succeeded(ok, invoked int) bool {
+	threshold := 1.0
+	if f != nil {
+		threshold = f.threshold
+	}
+	return float64(ok) >= threshold*float64(invoked)
+}
+
+// FanOutResult is the outcome of one worker of a fanned-out message
+type FanOutResult struct {
+	LambdaARN  string          `json:"lambdaArn"`
+	LambdaName string          `json:"lambdaName,omitempty"`
+	DurationMs int64           `json:"durationMs"`
+	Response   json.RawMessage `json:"response,omitempty"`
+	Error      string          `json:"error,omitempty"`
+}
+
+// FanOutResponse aggregates the results, forwarded as the response of a
+// fanned-out message
+type FanOutResponse struct {
+	Invoked   int            `json:"invoked"`
+	Succeeded int            `json:"succeeded"`
+	Results   []FanOutResult `json:"results"`
+}
+
+// invocation is the outcome of one of the concurrent worker invocations
+type invocation struct {
+	lambda   Lambda
+	response []byte
+	elapsed  time.Duration
+	err      error
+}
+
+// invokeAll invokes every worker concurrently and returns their outcomes in
+// the same order
+func (c *SQSConsumer) invokeAll(ctx context.Context, msg any, lambdas []Lambda) []invocation {
+	invocations := make([]invocation, len(lambdas))
+	var wg sync.WaitGroup
+	for i, lambda := range lambdas {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			started := time.Now()
+			invokeCtx, invokeSpan := tracer.Start(ctx, "invoke worker",
+				trace.WithSpanKind(trace.SpanKindClient),
+				trace.WithAttributes(attribute.String("faas.invoked_name", lambda.ARN)),
+			)
+			response, err := c.invokeTarget(invokeCtx, lambda, msg)
+			endSpan(invokeSpan, err)
+			elapsed := time.Since(started)
+			c.routing.record(lambda.ARN, elapsed, err)
+			c.eviction.Record(lambda.ARN, err)
+			if err != nil {
+				err = fmt.Errorf("error invoking lambda %s: %w", lambda.ARN, err)
+				loggerFrom(ctx).Warn("Worker invocation failed", "lambda_arn", lambda.ARN, errAttr(err))
+			} else {
+				c.emit(ctx, EventLambdaInvoked, LifecycleEvent{
+					LambdaARN:  lambda.ARN,
+					LambdaName: lambda.Name,
+					DurationMs: elapsed.Milliseconds(),
+				})
+			}
+			invocations[i] = invocation{lambda: lambda, response: response, elapsed: elapsed, err: err}
+		}()
+	}
+	wg.Wait()
+	return invocations
+}
+
+// fanOut invokes every worker concurrently. It fails with ErrFanOutFailed
+// when fewer succeed than the threshold; the message is then retried on
+// all of them, so fanned-out work must be idempotent.
+func (c *SQSConsumer) fanOut(ctx context.Context, msg any, lambdas []Lambda) (*workerResponse, error) {
+	logger := loggerFrom(ctx)
+	logger.Info("Fanning out message", "workers", len(lambdas))
+	started := time.Now()
+
+	aggregate := FanOutResponse{Invoked: len(lambdas), Results: make([]FanOutResult, 0, len(lambdas))}
+	var errs []error
+	for _, invoked := range c.invokeAll(ctx, msg, lambdas) {
+		result := FanOutResult{
+			LambdaARN:  invoked.lambda.ARN,
+			LambdaName: invoked.lambda.Name,
+			DurationMs: invoked.elapsed.Milliseconds(),
+		}
+		if invoked.err != nil {
+			fanOutInvocations.Inc("failure")
+			result.Error = invoked.err.Error()
+			errs = append(errs, invoked.err)
+		} else {
+			fanOutInvocations.Inc("success")
+			aggregate.Succeeded++
+			result.Response = invoked.response
+			if !json.Valid(invoked.response) {
+				result.Response, _ = json.Marshal(string(invoked.response))
+			}
+		}
+		aggregate.Results = append(aggregate.Results, result)
+	}
+	elapsed := time.Since(started)
+	logger.Info("Fan-out finished", "invoked", aggregate.Invoked, "succeeded", aggregate.Succeeded, durationAttr(elapsed))
+	if !c.fanout.succeeded(aggregate.Succeeded, aggregate.Invoked) {
+		return nil, fmt.Errorf("%w: %d of %d workers succeeded: %w", ErrFanOutFailed, aggregate.Succeeded, aggregate.Invoked, errors.Join(errs...))
+	}
+
+	body, err := json.Marshal(aggregate)
+	if err != nil {
+		return nil, fmt.Errorf("error marshaling fan-out response: %w", err)
+	}
+	return &workerResponse{Lambda: Lambda{Name: strategyFanOut}, Body: body, Elapsed: elapsed}, nil
+}
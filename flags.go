@@ -0,0 +1,161 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"strconv"
+	"sync"
+
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue"
+)
+
+// Feature flags consulted while processing messages
+const (
+	// flagIntegrityBypass skips the integrity Lambda; it is ignored unless
+	// the configuration file allows it
+	flagIntegrityBypass = "integrityBypass"
+	// flagCanaryRouting sends valor percent (default 10) of the messages to
+	// the canary Lambdas; while disabled canaries receive no traffic
+	flagCanaryRouting = "canaryRouting"
+	// flagRoutingStrategy selects the strategy named by valor: weighted,
+	// uniform or latency; consumer.routingStrategy applies while it is unset
+	flagRoutingStrategy = "routingStrategy"
+)
+
+const defaultCanaryPercent = 10
+
+var featureFlagEnabled = NewGaugeVec(
+	"orchestrator_feature_flag_enabled",
+	"1 when the feature flag is enabled.",
+	"flag",
+)
+
+// Flag is one item of the flags table
+type Flag struct {
+	Name    string `dynamodbav:"id" json:"name"`
+	Enabled bool   `dynamodbav:"habilitado" json:"enabled"`
+	Value   string `dynamodbav:"valor,omitempty" json:"value,omitempty"`
+}
+
+// FlagsOptions guards the flags that weaken the processing
+type FlagsOptions struct {
+	// AllowIntegrityBypass lets the integrityBypass flag skip the integrity
+	// Lambda; otherwise the flag is ignored
+	AllowIntegrityBypass bool
+}
+
+// Flags polls a DynamoDB flags table so behavior can be toggled without a
+// redeploy. While the integrity bypass is on, every refresh logs it for the
+// audit trail and raises an alert. A nil *Flags has every flag disabled.
+type Flags struct {
+	db      *DynamoDBClient
+	alerter *SNSAlerter
+	opts    FlagsOptions
+
+	mu    sync.RWMutex
+	flags map[string]Flag
+}
+
+func NewFlags(db *DynamoDBClient, alerter *SNSAlerter, opts FlagsOptions) *Flags {
+	return &Flags{
+		db:      db,
+		alerter: alerter,
+		opts:    opts,
+		flags:   make(map[string]Flag),
+	}
+}
+
+// Enabled reports whether the flag exists and is enabled
+func (f *Flags) Enabled(name string) bool {
+	if f == nil {
+		return false
+	}
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+	return f.flags[name].Enabled
+}
+
+// Value returns the value of an enabled flag, or fallback
+func (f *Flags) Value(name, fallback string) string {
+	if f == nil {
+		return fallback
+	}
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+	if flag := f.flags[name]; flag.Enabled && flag.Value != "" {
+		return flag.Value
+	}
+	return fallback
+}
+
+// Percent returns the value of an enabled flag as a percentage in [0, 100]
+func (f *Flags) Percent(name string, fallback int) int {
+	percent, err := strconv.Atoi(f.Value(name, strconv.Itoa(fallback)))
+	if err != nil {
+		return fallback
+	}
+	return min(max(percent, 0), 100)
+}
+
+// Refresh reads the whole flags table
+func (f *Flags) Refresh(ctx context.Context) error {
+	items, err := f.db.Scan(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("error scanning flags: %w", err)
+	}
+
+	var list []Flag
+	if err := attributevalue.UnmarshalListOfMaps(items, &list); err != nil {
+		return fmt.Errorf("error unmarshaling flags: %w", err)
+	}
+	next := make(map[string]Flag, len(list))
+	for _, flag := range list {
+		next[flag.Name] = flag
+	}
+	if bypass := next[flagIntegrityBypass]; bypass.Enabled {
+		if !f.opts.AllowIntegrityBypass {
+			slog.Warn("Ignoring the integrityBypass flag, flags.allowIntegrityBypass is off")
+			bypass.Enabled = false
+			next[flagIntegrityBypass] = bypass
+		} else {
+			f.alertIntegrityBypass(ctx)
+		}
+	}
+
+	f.mu.Lock()
+	previous := f.flags
+	f.flags = next
+	f.mu.Unlock()
+
+	for name, flag := range next {
+		if old, ok := previous[name]; !ok || old != flag {
+			slog.Info("Feature flag changed", "flag", name, "enabled", flag.Enabled, "value", flag.Value)
+		}
+		enabled := 0.0
+		if flag.Enabled {
+			enabled = 1
+		}
+		featureFlagEnabled.Set(enabled, name)
+	}
+	for name := range previous {
+		if _, ok := next[name]; !ok {
+			slog.Info("Feature flag removed", "flag", name)
+			featureFlagEnabled.Set(0, name)
+		}
+	}
+	return nil
+}
+
+// alertIntegrityBypass records that messages reach the workers unverified;
+// the alerter cooldown spaces the alerts
+func (f *Flags) alertIntegrityBypass(ctx context.Context) {
+	slog.Warn("Integrity check bypassed by feature flag, messages reach the workers unverified",
+		"audit", true, "flag", flagIntegrityBypass, "table", f.db.tableName)
+	f.alerter.Alert(ctx, Alert{
+		Type:     alertIntegrityBypass,
+		Severity: SeverityCritical,
+		Summary:  "Integrity check bypassed by the " + flagIntegrityBypass + " feature flag",
+		Details:  map[string]any{"flagsTable": f.db.tableName},
+	})
+}
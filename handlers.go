@@ -0,0 +1,88 @@
+package main
+
+import (
+	"context"
+	"sync"
+)
+
+// Handler runs the business logic of a message type. It receives the
+// parsed message once its integrity is verified; the response is forwarded
+// to the output queue and archived like a worker response.
+type Handler interface {
+	Handle(ctx context.Context, msg any) (*workerResponse, error)
+}
+
+// HandlerFunc adapts a function to Handler
+type HandlerFunc func(ctx context.Context, msg any) (*workerResponse, error)
+
+func (f HandlerFunc) Handle(ctx context.Context, msg any) (*workerResponse, error) {
+	return f(ctx, msg)
+}
+
+// HandlerRegistry maps message types to custom handlers. Messages of other
+// types, and those without a type, get the default orchestration: their
+// workflow or a worker from the registry. A nil *HandlerRegistry has no
+// handlers.
+type HandlerRegistry struct {
+	typeField string
+
+	mu       sync.RWMutex
+	handlers map[string]Handler
+}
+
+// NewHandlerRegistry reads the message type from typeField
+func NewHandlerRegistry(typeField string) *HandlerRegistry {
+	return &HandlerRegistry{
+		typeField: typeField,
+		handlers:  make(map[string]Handler),
+	}
+}
+
+// Register sets the handler of a message type, replacing any previous one
+func (r *HandlerRegistry) Register(messageType string, handler Handler) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.handlers[messageType] = handler
+}
+
+// For returns the handler of the message type, if one is registered
+func (r *HandlerRegistry) For(msg any) (string, Handler, bool) {
+	if r == nil {
+		return "", nil, false
+	}
+	fields, ok := msg.(map[string]any)
+	if !ok {
+		return "", nil, false
+	}
+	messageType, ok := fields[r.typeField].(string)
+	if !ok {
+		return "", nil, false
+	}
+
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	handler, ok := r.handlers[messageType]
+	return messageType, handler, ok
+}
+
+// Types lists the message types with a custom handler
+func (r *HandlerRegistry) Types() []string {
+	if r == nil {
+		return nil
+	}
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	types := make([]string, 0, len(r.handlers))
+	for messageType := range r.handlers {
+		types = append(types, messageType)
+	}
+	return types
+}
+
+// registerHandlers plugs in the custom handlers of this deployment, e.g.
+//
+//	handlers.Register("audit-log", HandlerFunc(func(ctx context.Context, msg any) (*workerResponse, error) {
+//		loggerFrom(ctx).Info("Audit entry", "entry", msg)
+//		return &workerResponse{Lambda: Lambda{Name: "audit-log"}}, nil
+//	}))
+func registerHandlers(handlers *HandlerRegistry) {}
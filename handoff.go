@@ -0,0 +1,114 @@
+package main
+
+import (
+	"context"
+	"log/slog"
+	"strings"
+	"sync"
+	"time"
+)
+
+// handoffMaxPollDelay is the wait before each fetch just before the
+// outgoing instance stops polling
+const handoffMaxPollDelay = 10 * time.Second
+
+// handoffPauseReason prefixes the pause of a finished handoff, so only the
+// handoff resumes it
+const handoffPauseReason = "handoff to "
+
+var handoffProgress = NewGaugeVec(
+	"orchestrator_handoff_progress",
+	"Progress, from 0 to 1, of the handoff of this instance to a newer version; 1 once it stopped polling.",
+)
+
+// Handoff hands the traffic of this instance over to a newer version during
+// a deploy. Once an instance of another version that started later reports
+// ready in the orchestrator table, this one waits longer and longer before
+// each fetch, up to handoffMaxPollDelay, and stops polling after duration, so
+// the old and new instances together stay within the downstream
+// concurrency. If the newer instances disappear the handoff is undone.
+type Handoff struct {
+	db         *DynamoDBClient
+	consumer   *SQSConsumer
+	instanceID string
+	startedAt  time.Time
+	duration   time.Duration
+	freshness  time.Duration // heartbeats older than this are ignored
+
+	mu        sync.Mutex
+	since     time.Time // zero while no newer instance is ready
+	successor string
+}
+
+func NewHandoff(db *DynamoDBClient, consumer *SQSConsumer, heartbeat *Heartbeater, duration time.Duration) *Handoff {
+	handoffProgress.Set(0)
+	return &Handoff{
+		db:         db,
+		consumer:   consumer,
+		instanceID: heartbeat.InstanceID(),
+		startedAt:  heartbeat.startedAt,
+		duration:   duration,
+		freshness:  3 * heartbeat.interval,
+	}
+}
+
+// Check looks for a ready successor and adjusts the poll rate. It runs on
+// every instance.
+func (h *Handoff) Check(ctx context.Context) error {
+	successor, err := h.findSuccessor(ctx)
+	if err != nil {
+		return err
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if successor == nil {
+		if !h.since.IsZero() {
+			slog.Warn("Handoff cancelled, no newer instance is ready", "successor", h.successor)
+			h.since, h.successor = time.Time{}, ""
+			h.consumer.SetPollDelay("handoff", 0)
+			if paused := h.consumer.Paused(); paused != nil && strings.HasPrefix(paused.Reason, handoffPauseReason) {
+				if err := h.consumer.Resume(); err != nil {
+					slog.Info("Handoff cancelled, staying paused", errAttr(err))
+				}
+			}
+			handoffProgress.Set(0)
+		}
+		return nil
+	}
+
+	if h.since.IsZero() {
+		h.since, h.successor = time.Now(), successor.InstanceID
+		slog.Info("Handing off to a newer instance", "successor", successor.InstanceID, "version", successor.Version, "duration", h.duration)
+	}
+	progress := min(float64(time.Since(h.since))/float64(h.duration), 1)
+	handoffProgress.Set(progress)
+	if progress >= 1 {
+		h.consumer.SetPollDelay("handoff", 0)
+		h.consumer.Pause(handoffPauseReason + h.successor)
+		return nil
+	}
+	h.consumer.SetPollDelay("handoff", time.Duration(progress*float64(handoffMaxPollDelay)))
+	return nil
+}
+
+// findSuccessor returns a ready instance of another version that started
+// after this one, or nil
+func (h *Handoff) findSuccessor(ctx context.Context) (*OrchestratorHeartbeat, error) {
+	heartbeats, err := liveHeartbeats(ctx, h.db, h.freshness)
+	if err != nil {
+		return nil, err
+	}
+	for _, heartbeat := range heartbeats {
+		if !heartbeat.Ready || heartbeat.InstanceID == h.instanceID || heartbeat.Version == Version {
+			continue
+		}
+		startedAt, err := time.Parse(time.RFC3339, heartbeat.StartedAt)
+		if err != nil || !startedAt.After(h.startedAt.Truncate(time.Second)) {
+			continue
+		}
+		return &heartbeat, nil
+	}
+	return nil, nil
+}
@@ -1,43 +1,101 @@
 package main
 
 import (
+	"crypto/tls"
 	"encoding/json"
-	"log"
+	"log/slog"
 	"net/http"
+	"sync/atomic"
 	"time"
 )
 
 type HealthResponse struct {
-	Status    string    `json:"status"`
-	Timestamp time.Time `json:"timestamp"`
-	Service   string    `json:"service"`
+	Status       string     `json:"status"`
+	Timestamp    time.Time  `json:"timestamp"`
+	Service      string     `json:"service"`
+	LastActivity *time.Time `json:"lastActivity,omitempty"`
 }
 
-func healthHandler(w http.ResponseWriter, r *http.Request) {
+// LivenessProbe reports the process as dead when the consumer loop has not
+// made progress within the threshold, so the orchestrator restarts it
+type LivenessProbe struct {
+	lastActivity func() time.Time
+	threshold    atomic.Int64 // nanoseconds
+}
+
+func NewLivenessProbe(lastActivity func() time.Time, threshold time.Duration) *LivenessProbe {
+	p := &LivenessProbe{lastActivity: lastActivity}
+	p.SetThreshold(threshold)
+	return p
+}
+
+// SetThreshold changes the stall threshold, e.g. on configuration reload
+func (p *LivenessProbe) SetThreshold(threshold time.Duration) {
+	p.threshold.Store(int64(threshold))
+}
+
+func (p *LivenessProbe) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	response := HealthResponse{
 		Status:    "healthy",
 		Timestamp: time.Now(),
 		Service:   "challenge-4-orchestrator",
 	}
+	status := http.StatusOK
+
+	// A zero timestamp means the loop hasn't started yet, which is still alive
+	if last := p.lastActivity(); !last.IsZero() {
+		response.LastActivity = &last
+		if time.Since(last) > time.Duration(p.threshold.Load()) {
+			response.Status = "stalled"
+			status = http.StatusServiceUnavailable
+		}
+	}
 
+	writeJSON(w, status, response)
+}
+
+func writeJSON(w http.ResponseWriter, status int, body any) {
 	w.Header().Set("Content-Type", "application/json")
-	w.WriteHeader(http.StatusOK)
-	json.NewEncoder(w).Encode(response)
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(body); err != nil {
+		slog.Error("Error encoding response", errAttr(err))
+	}
+}
+
+func writeError(w http.ResponseWriter, status int, message string) {
+	writeJSON(w, status, map[string]string{"error": message})
 }
 
-func startHealthServer(port string) *http.Server {
+// startHealthServer serves /live (and /health, kept for existing probes)
+// plus any extra routes registered by the given functions (readiness, admin
+// API, diagnostics, ...). It uses TLS when tlsConfig is not nil.
+func startHealthServer(port string, tlsConfig *tls.Config, liveness *LivenessProbe, routes ...func(*http.ServeMux)) *http.Server {
 	mux := http.NewServeMux()
-	mux.HandleFunc("/health", healthHandler)
+	mux.Handle("/live", liveness)
+	mux.Handle("/health", liveness)
+	mux.HandleFunc("/metrics", metricsHandler)
+
+	for _, register := range routes {
+		register(mux)
+	}
 
 	server := &http.Server{
-		Addr:    ":" + port,
-		Handler: mux,
+		Addr:      ":" + port,
+		Handler:   mux,
+		TLSConfig: tlsConfig,
 	}
 
 	go func() {
-		log.Printf("Health check server starting on port %s", port)
-		if err := server.ListenAndServe(); err != nil && err != http.ErrServerClosed {
-			log.Fatalf("Health server failed: %v", err)
+		slog.Info("Health check server starting", "port", port, "tls", tlsConfig != nil)
+		var err error
+		if tlsConfig != nil {
+			// Certificates come from TLSConfig.GetCertificate
+			err = server.ListenAndServeTLS("", "")
+		} else {
+			err = server.ListenAndServe()
+		}
+		if err != nil && err != http.ErrServerClosed {
+			fatal("Health server failed", errAttr(err))
 		}
 	}()
 
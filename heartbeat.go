@@ -0,0 +1,173 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"log/slog"
+	"os"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue"
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/expression"
+)
+
+// OrchestratorHeartbeat is the item each orchestrator replica writes about itself
+type OrchestratorHeartbeat struct {
+	InstanceID    string `dynamodbav:"id" json:"instanceId"`
+	Version       string `dynamodbav:"version" json:"version"`
+	InFlight      int64  `dynamodbav:"mensajesEnVuelo" json:"inFlight"`
+	Ready         bool   `dynamodbav:"listo" json:"ready"` // passes its readiness checks
+	Paused        bool   `dynamodbav:"pausado" json:"paused"`
+	LastPoll      string `dynamodbav:"ultimoSondeo,omitempty" json:"lastPoll,omitempty"`
+	LastHeartBeat string `dynamodbav:"ultimoLatido" json:"lastHeartbeat"`
+	StartedAt     string `dynamodbav:"iniciadoEn" json:"startedAt"`
+	ExpiresAt     int64  `dynamodbav:"expiraEn" json:"expiresAt"`
+}
+
+// Heartbeater periodically records this instance in the orchestrator table so
+// dashboards and peers can detect dead replicas. A nil *Heartbeater does
+// nothing.
+type Heartbeater struct {
+	db         *DynamoDBClient
+	consumer   *SQSConsumer
+	interval   time.Duration
+	instanceID string
+	startedAt  time.Time
+	ready      func(ctx context.Context) bool // nil reports ready
+}
+
+func NewHeartbeater(db *DynamoDBClient, consumer *SQSConsumer, instanceID string, interval time.Duration) *Heartbeater {
+	return &Heartbeater{
+		db:         db,
+		consumer:   consumer,
+		interval:   interval,
+		instanceID: instanceID,
+		startedAt:  time.Now(),
+	}
+}
+
+// SetReadiness reports the readiness checks in the heartbeats, for the
+// handoff between versions
+func (h *Heartbeater) SetReadiness(readiness *ReadinessChecker) {
+	if h == nil {
+		return
+	}
+	h.ready = func(ctx context.Context) bool {
+		return readiness.Check(ctx).Ready
+	}
+}
+
+// InstanceID identifies this replica in the orchestrator table
+func (h *Heartbeater) InstanceID() string {
+	return h.instanceID
+}
+
+func (h *Heartbeater) Start(ctx context.Context) {
+	if h == nil {
+		return
+	}
+	slog.Info("Starting orchestrator heartbeat", "instance_id", h.instanceID, "interval", h.interval.String())
+
+	ticker := time.NewTicker(h.interval)
+	defer ticker.Stop()
+
+	for {
+		if err := h.beat(ctx); err != nil && ctx.Err() == nil {
+			slog.Error("Error writing orchestrator heartbeat", errAttr(err))
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (h *Heartbeater) beat(ctx context.Context) error {
+	now := time.Now().UTC()
+
+	heartbeat := OrchestratorHeartbeat{
+		InstanceID:    h.instanceID,
+		Version:       Version,
+		InFlight:      h.consumer.InFlight(),
+		Ready:         h.ready == nil || h.ready(ctx),
+		Paused:        h.consumer.Paused() != nil,
+		LastHeartBeat: now.Format(time.RFC3339),
+		StartedAt:     h.startedAt.UTC().Format(time.RFC3339),
+		// Missing three beats in a row lets DynamoDB TTL remove the entry
+		ExpiresAt: now.Add(3 * h.interval).Unix(),
+	}
+	if lastPoll := h.consumer.LastPoll(); !lastPoll.IsZero() {
+		heartbeat.LastPoll = lastPoll.UTC().Format(time.RFC3339)
+	}
+
+	item, err := attributevalue.MarshalMap(heartbeat)
+	if err != nil {
+		return fmt.Errorf("failed to marshal heartbeat: %w", err)
+	}
+
+	return h.db.PutItem(ctx, item)
+}
+
+// liveHeartbeats returns the heartbeats of the replicas that beat within
+// freshness
+func liveHeartbeats(ctx context.Context, db *DynamoDBClient, freshness time.Duration) ([]OrchestratorHeartbeat, error) {
+	expr, err := expression.NewBuilder().
+		WithFilter(expression.AttributeExists(expression.Name("ultimoLatido"))).
+		Build()
+	if err != nil {
+		return nil, fmt.Errorf("error building heartbeat filter: %w", err)
+	}
+	items, err := db.Scan(ctx, &expr)
+	if err != nil {
+		return nil, fmt.Errorf("error reading orchestrator heartbeats: %w", err)
+	}
+
+	heartbeats := make([]OrchestratorHeartbeat, 0, len(items))
+	for _, item := range items {
+		var heartbeat OrchestratorHeartbeat
+		if err := attributevalue.UnmarshalMap(item, &heartbeat); err != nil {
+			return nil, fmt.Errorf("error unmarshaling orchestrator heartbeat: %w", err)
+		}
+		lastBeat, err := time.Parse(time.RFC3339, heartbeat.LastHeartBeat)
+		if err != nil || time.Since(lastBeat) > freshness {
+			continue
+		}
+		heartbeats = append(heartbeats, heartbeat)
+	}
+	return heartbeats, nil
+}
+
+// Deregister removes this instance's heartbeat on graceful shutdown
+func (h *Heartbeater) Deregister(ctx context.Context) {
+	if h == nil {
+		return
+	}
+	if err := h.db.DeleteItem(ctx, itemKey(h.instanceID)); err != nil {
+		slog.Error("Error removing orchestrator heartbeat", errAttr(err))
+		return
+	}
+	slog.Info("Removed orchestrator heartbeat", "instance_id", h.instanceID)
+}
+
+// newInstanceID uses INSTANCE_ID when set, otherwise hostname plus a random suffix
+func newInstanceID() string {
+	if id := os.Getenv("INSTANCE_ID"); id != "" {
+		return id
+	}
+
+	hostname, err := os.Hostname()
+	if err != nil {
+		hostname = "orchestrator"
+	}
+
+	suffix := make([]byte, 4)
+	if _, err := rand.Read(suffix); err != nil {
+		return hostname
+	}
+
+	return hostname + "-" + hex.EncodeToString(suffix)
+}
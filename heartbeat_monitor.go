@@ -0,0 +1,80 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"time"
+)
+
+var heartbeatTransitions = NewCounterVec(
+	"orchestrator_heartbeat_transitions_total",
+	"Lambdas demoted for missing heartbeats or promoted when they resumed.",
+	"transition",
+)
+
+// HeartbeatMonitor sweeps the registry and demotes healthy Lambdas whose
+// ultimoLatido is older than the freshness threshold. Lambdas it demoted are
+// promoted back once their heartbeats are fresh again; Lambdas marked down
+// by an operator or the reconciler are left alone.
+type HeartbeatMonitor struct {
+	registry  *LambdaRegistry
+	threshold time.Duration
+}
+
+func NewHeartbeatMonitor(registry *LambdaRegistry, threshold time.Duration) *HeartbeatMonitor {
+	return &HeartbeatMonitor{
+		registry:  registry,
+		threshold: threshold,
+	}
+}
+
+// Sweep runs one pass over the registry
+func (m *HeartbeatMonitor) Sweep(ctx context.Context) error {
+	lambdas, err := m.registry.List(ctx)
+	if err != nil {
+		return fmt.Errorf("error listing registry: %w", err)
+	}
+
+	now := time.Now()
+	for _, lambda := range lambdas {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+
+		// Lambdas that never report heartbeats are not managed here
+		heartbeat, ok := parseHeartbeat(lambda.LastHeartBeat)
+		if !ok {
+			continue
+		}
+		silentFor := now.Sub(heartbeat)
+		silent := silentFor > m.threshold
+
+		var to Status
+		var reason, transition string
+		switch {
+		case lambda.Status == Healthy && silent:
+			to, reason, transition = Unhealthy, statusReasonSilent, "demoted"
+		case lambda.Status == Unhealthy && !silent && lambda.StatusReason == statusReasonSilent:
+			to, reason, transition = Healthy, "", "promoted"
+		default:
+			continue
+		}
+
+		changed, err := m.registry.TransitionStatus(ctx, lambda, to, reason)
+		if err != nil {
+			slog.Error("Heartbeat monitor: error updating lambda", "lambda_id", lambda.ID, errAttr(err))
+			continue
+		}
+		if !changed {
+			// A heartbeat or another update landed since the read
+			slog.Debug("Heartbeat monitor: lambda changed concurrently, skipped", "lambda_id", lambda.ID)
+			continue
+		}
+
+		heartbeatTransitions.Inc(transition)
+		slog.Warn("Heartbeat monitor: lambda "+transition, "lambda_id", lambda.ID, "lambda_arn", lambda.ARN,
+			"last_heartbeat", lambda.LastHeartBeat, "silent_for_ms", silentFor.Milliseconds())
+	}
+	return nil
+}
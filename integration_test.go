@@ -0,0 +1,241 @@
+//go:build integration
+
+package main
+
+// The integration suite runs the receive → verify → route → delete path
+// against LocalStack, started with testcontainers-go, so it needs Docker:
+//
+//	go test -tags integration -run Integration -timeout 10m .
+//
+// The queue, the registry table and the integrity and worker Lambdas are
+// created in LocalStack; the Lambdas are stubs in Python.
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"strconv"
+	"testing"
+	"time"
+
+	"challenge-4-orchestrator/config"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/lambda"
+	lambdatypes "github.com/aws/aws-sdk-go-v2/service/lambda/types"
+	"github.com/aws/aws-sdk-go-v2/service/sqs"
+	sqstypes "github.com/aws/aws-sdk-go-v2/service/sqs/types"
+	"github.com/testcontainers/testcontainers-go"
+	"github.com/testcontainers/testcontainers-go/modules/localstack"
+)
+
+const (
+	localStackImage       = "localstack/localstack:3.8"
+	integrationRole       = "arn:aws:iam::000000000000:role/orchestrator-integration"
+	integrationTable      = "integration-registry"
+	integrationIndex      = "estadoSalud-index"
+	integrationQueue      = "integration-messages"
+	integrationIntegrity  = "integration-integrity"
+	integrationMessages   = 6
+	integrationWaitPeriod = 3 * time.Minute
+)
+
+// integrityStub accepts the messages whose hash is the SHA-256 of their
+// data, like the hash set by loadgen
+const integrityStub = `import hashlib
+
+def handler(event, context):
+    data = event.get("data", "")
+    ok = hashlib.sha256(data.encode()).hexdigest() == event.get("hash")
+    return {"statusCode": 200 if ok else 401}
+`
+
+const workerStub = `def handler(event, context):
+    return {"statusCode": 200, "body": {"data": event.get("data")}}
+`
+
+func TestIntegrationProcessingPath(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 8*time.Minute)
+	defer cancel()
+
+	awsCfg := startLocalStack(ctx, t)
+	lambdaClient := NewLambdaClient(awsCfg)
+	sqsClient := sqs.NewFromConfig(awsCfg, func(o *sqs.Options) {
+		o.BaseEndpoint = aws.String(awsEndpoint("SQS"))
+	})
+
+	queue, err := sqsClient.CreateQueue(ctx, &sqs.CreateQueueInput{QueueName: aws.String(integrationQueue)})
+	if err != nil {
+		t.Fatalf("creating queue: %v", err)
+	}
+	queueURL := aws.ToString(queue.QueueUrl)
+
+	db := NewDynamoDBClient(integrationTable, awsCfg)
+	if _, err := db.EnsureTable(ctx, integrationIndex); err != nil {
+		t.Fatalf("creating registry table: %v", err)
+	}
+	registry := NewLambdaRegistry(db, RegistryOptions{StatusIndex: integrationIndex})
+
+	createFunction(ctx, t, awsCfg, integrationIntegrity, integrityStub)
+	workers := map[string]Status{
+		"integration-worker-a": Healthy,
+		"integration-worker-b": Healthy,
+		"integration-worker-c": Unhealthy,
+	}
+	arns := make(map[string]string, len(workers))
+	for name, status := range workers {
+		arns[name] = createFunction(ctx, t, awsCfg, name, workerStub)
+		err := registry.Create(ctx, Lambda{ID: name, ARN: arns[name], Name: name, Status: status, Weight: aws.Int(1)})
+		if err != nil {
+			t.Fatalf("registering %s: %v", name, err)
+		}
+	}
+
+	// Every message but the last is signed
+	for i := range integrationMessages {
+		data := "order-" + strconv.Itoa(i)
+		hash := sha256.Sum256([]byte(data))
+		signature := hex.EncodeToString(hash[:])
+		if i == integrationMessages-1 {
+			signature = "tampered"
+		}
+		body, _ := json.Marshal(map[string]string{"type": "order", "data": data, "hash": signature})
+		_, err := sqsClient.SendMessage(ctx, &sqs.SendMessageInput{QueueUrl: aws.String(queueURL), MessageBody: aws.String(string(body))})
+		if err != nil {
+			t.Fatalf("sending message: %v", err)
+		}
+	}
+
+	failuresBefore := integrityFailures.Value()
+	consumer := NewConsumer(sqsClient, queueURL, registry, lambdaClient, ConsumerOptions{IntegrityLambda: integrationIntegrity})
+	consumerCtx, stop := context.WithCancel(ctx)
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		consumer.Start(consumerCtx)
+	}()
+	defer func() {
+		stop()
+		<-done
+	}()
+
+	// Wait until the signed messages reached a worker and the tampered one
+	// was rejected
+	deadline := time.Now().Add(integrationWaitPeriod)
+	for {
+		if routed(consumer) == integrationMessages-1 && integrityFailures.Value()-failuresBefore >= 1 {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("timed out: %d messages routed, %.0f integrity failures", routed(consumer), integrityFailures.Value()-failuresBefore)
+		}
+		time.Sleep(time.Second)
+	}
+
+	stats := consumer.RoutingStats()
+	if n := stats[arns["integration-worker-c"]].Invocations; n != 0 {
+		t.Errorf("unhealthy worker invoked %d times", n)
+	}
+	for arn, lambda := range stats {
+		if lambda.Failures != 0 {
+			t.Errorf("worker %s failed %d invocations: %s", arn, lambda.Failures, lambda.LastError)
+		}
+	}
+
+	// The routed messages are deleted after their invocation; the tampered
+	// one waits for its visibility timeout to be received again
+	var visible, notVisible string
+	for range 30 {
+		attributes, err := sqsClient.GetQueueAttributes(ctx, &sqs.GetQueueAttributesInput{
+			QueueUrl: aws.String(queueURL),
+			AttributeNames: []sqstypes.QueueAttributeName{
+				sqstypes.QueueAttributeNameApproximateNumberOfMessages,
+				sqstypes.QueueAttributeNameApproximateNumberOfMessagesNotVisible,
+			},
+		})
+		if err != nil {
+			t.Fatalf("reading queue attributes: %v", err)
+		}
+		visible = attributes.Attributes[string(sqstypes.QueueAttributeNameApproximateNumberOfMessages)]
+		notVisible = attributes.Attributes[string(sqstypes.QueueAttributeNameApproximateNumberOfMessagesNotVisible)]
+		if visible == "0" && notVisible == "1" {
+			return
+		}
+		time.Sleep(time.Second)
+	}
+	t.Errorf("queue has %s visible and %s in-flight messages, want only the tampered one in flight", visible, notVisible)
+}
+
+// startLocalStack runs LocalStack for the test and points the AWS clients
+// at it
+func startLocalStack(ctx context.Context, t *testing.T) aws.Config {
+	t.Helper()
+	container, err := localstack.Run(ctx, localStackImage,
+		testcontainers.WithEnv(map[string]string{"SERVICES": "sqs,dynamodb,lambda"}),
+	)
+	testcontainers.CleanupContainer(t, container)
+	if err != nil {
+		t.Fatalf("starting LocalStack: %v", err)
+	}
+	endpoint, err := container.PortEndpoint(ctx, "4566/tcp", "http")
+	if err != nil {
+		t.Fatalf("reading LocalStack endpoint: %v", err)
+	}
+
+	t.Setenv("AWS_ENDPOINT_URL", endpoint)
+	t.Setenv("AWS_ACCESS_KEY_ID", "test")
+	t.Setenv("AWS_SECRET_ACCESS_KEY", "test")
+	awsCfg, err := config.NewAWSConfig(ctx, "us-east-1", config.AWSConfig{MaxAttempts: 3, HTTPTimeout: 30 * time.Second, MaxIdleConns: 10})
+	if err != nil {
+		t.Fatalf("loading AWS config: %v", err)
+	}
+	return awsCfg
+}
+
+// createFunction deploys a Python stub and waits until it can be invoked
+func createFunction(ctx context.Context, t *testing.T, awsCfg aws.Config, name, code string) string {
+	t.Helper()
+	var archive bytes.Buffer
+	zipWriter := zip.NewWriter(&archive)
+	file, err := zipWriter.Create("handler.py")
+	if err == nil {
+		_, err = file.Write([]byte(code))
+	}
+	if err == nil {
+		err = zipWriter.Close()
+	}
+	if err != nil {
+		t.Fatalf("packaging %s: %v", name, err)
+	}
+
+	client := lambda.NewFromConfig(awsCfg, func(o *lambda.Options) {
+		o.BaseEndpoint = aws.String(awsEndpoint("LAMBDA"))
+	})
+	function, err := client.CreateFunction(ctx, &lambda.CreateFunctionInput{
+		FunctionName: aws.String(name),
+		Runtime:      lambdatypes.RuntimePython312,
+		Handler:      aws.String("handler.handler"),
+		Role:         aws.String(integrationRole),
+		Code:         &lambdatypes.FunctionCode{ZipFile: archive.Bytes()},
+	})
+	if err != nil {
+		t.Fatalf("creating %s: %v", name, err)
+	}
+	waiter := lambda.NewFunctionActiveV2Waiter(client)
+	if err := waiter.Wait(ctx, &lambda.GetFunctionInput{FunctionName: aws.String(name)}, 2*time.Minute); err != nil {
+		t.Fatalf("waiting for %s: %v", name, err)
+	}
+	return aws.ToString(function.FunctionArn)
+}
+
+// routed returns the worker invocations of the consumer
+func routed(consumer *SQSConsumer) int64 {
+	var total int64
+	for _, lambda := range consumer.RoutingStats() {
+		total += lambda.Invocations
+	}
+	return total
+}
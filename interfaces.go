@@ -0,0 +1,80 @@
+package main
+
+import (
+	"context"
+
+	"github.com/aws/aws-sdk-go-v2/service/lambda"
+	"github.com/aws/aws-sdk-go-v2/service/sqs"
+)
+
+//go:generate mockgen -source=interfaces.go -destination=mocks_test.go -package=main
+
+// The consumer depends on these narrow interfaces rather than on the AWS
+// clients, so the orchestration logic can run against the generated mocks
+// in mocks_test.go. *sqs.Client, *LambdaClient, *StepFunctionsClient and
+// *LambdaRegistry implement them.
+
+// MessageReceiver polls a queue
+type MessageReceiver interface {
+	ReceiveMessage(ctx context.Context, params *sqs.ReceiveMessageInput, optFns ...func(*sqs.Options)) (*sqs.ReceiveMessageOutput, error)
+}
+
+// MessageDeleter acknowledges processed messages
+type MessageDeleter interface {
+	DeleteMessage(ctx context.Context, params *sqs.DeleteMessageInput, optFns ...func(*sqs.Options)) (*sqs.DeleteMessageOutput, error)
+}
+
+// MessageSender sends a deferred message back to its queue
+type MessageSender interface {
+	SendMessage(ctx context.Context, params *sqs.SendMessageInput, optFns ...func(*sqs.Options)) (*sqs.SendMessageOutput, error)
+}
+
+// VisibilityChanger keeps a deferred message hidden on FIFO queues
+type VisibilityChanger interface {
+	ChangeMessageVisibility(ctx context.Context, params *sqs.ChangeMessageVisibilityInput, optFns ...func(*sqs.Options)) (*sqs.ChangeMessageVisibilityOutput, error)
+}
+
+// QueueAttributesGetter reads queue depths for the readiness check and the
+// monitors
+type QueueAttributesGetter interface {
+	GetQueueAttributes(ctx context.Context, params *sqs.GetQueueAttributesInput, optFns ...func(*sqs.Options)) (*sqs.GetQueueAttributesOutput, error)
+}
+
+// QueueClient is the queue API used by the consumer
+type QueueClient interface {
+	MessageReceiver
+	MessageDeleter
+	MessageSender
+	VisibilityChanger
+	QueueAttributesGetter
+}
+
+// Invoker invokes the integrity Lambda and the workers
+type Invoker interface {
+	InvokeSync(ctx context.Context, functionName string, payload any) ([]byte, error)
+	InvokeWorker(ctx context.Context, worker Lambda, payload any) ([]byte, error)
+}
+
+// FunctionConfigGetter reads the memory size of the workers for the cost
+// estimates
+type FunctionConfigGetter interface {
+	GetFunctionConfiguration(ctx context.Context, functionName string) (*lambda.GetFunctionConfigurationOutput, error)
+}
+
+// ExecutionStarter hands messages off to Step Functions state machines
+type ExecutionStarter interface {
+	StartExecution(ctx context.Context, target Lambda, payload any) ([]byte, error)
+}
+
+// Registry lists the workers messages can be routed to
+type Registry interface {
+	ListHealthy(ctx context.Context) ([]Lambda, error)
+}
+
+var (
+	_ QueueClient          = (*sqs.Client)(nil)
+	_ Invoker              = (*LambdaClient)(nil)
+	_ FunctionConfigGetter = (*LambdaClient)(nil)
+	_ ExecutionStarter     = (*StepFunctionsClient)(nil)
+	_ Registry             = (*LambdaRegistry)(nil)
+)
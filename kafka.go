@@ -0,0 +1,194 @@
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"github.com/segmentio/kafka-go"
+	"github.com/segmentio/kafka-go/sasl/scram"
+	"go.opentelemetry.io/otel/propagation"
+)
+
+// KafkaOptions configures the Kafka source
+type KafkaOptions struct {
+	Brokers []string
+	Topics  []string
+	GroupID string
+	TLS     bool
+	// Username and Password enable SASL/SCRAM-SHA-512, as used by MSK
+	Username string
+	Password string
+	// MaxAttempts is how many times a message is processed before it is
+	// skipped; RetryBackoff is the first delay between attempts, doubled on
+	// every retry
+	MaxAttempts  int
+	RetryBackoff time.Duration
+}
+
+// KafkaSource feeds messages from a Kafka consumer group (e.g. MSK) into the
+// same pipeline as the SQS queue. Each assigned partition is read by its own
+// worker, one message at a time, so the order within each partition is kept,
+// and an offset is committed only after its message was processed. A failing
+// message is retried in place, blocking only its partition, until
+// MaxAttempts is reached.
+type KafkaSource struct {
+	dialer   *kafka.Dialer
+	consumer *SQSConsumer
+	opts     KafkaOptions
+}
+
+func NewKafkaSource(consumer *SQSConsumer, opts KafkaOptions) (*KafkaSource, error) {
+	dialer := &kafka.Dialer{
+		Timeout:   10 * time.Second,
+		DualStack: true,
+	}
+	if opts.TLS {
+		dialer.TLS = &tls.Config{MinVersion: tls.VersionTLS12}
+	}
+	if opts.Username != "" {
+		mechanism, err := scram.Mechanism(scram.SHA512, opts.Username, opts.Password)
+		if err != nil {
+			return nil, fmt.Errorf("error configuring SASL/SCRAM: %w", err)
+		}
+		dialer.SASLMechanism = mechanism
+	}
+
+	return &KafkaSource{
+		dialer:   dialer,
+		consumer: consumer,
+		opts:     opts,
+	}, nil
+}
+
+// Start consumes until ctx is done, then leaves the consumer group
+func (k *KafkaSource) Start(ctx context.Context) {
+	slog.Info("Starting Kafka consumer", "topics", k.opts.Topics, "group_id", k.opts.GroupID)
+	group, err := kafka.NewConsumerGroup(kafka.ConsumerGroupConfig{
+		ID:          k.opts.GroupID,
+		Brokers:     k.opts.Brokers,
+		Topics:      k.opts.Topics,
+		Dialer:      k.dialer,
+		StartOffset: kafka.FirstOffset,
+	})
+	if err != nil {
+		slog.Error("Error joining Kafka consumer group", errAttr(err))
+		return
+	}
+	// Closing the group ends the generation and waits for its workers
+	defer func() {
+		if err := group.Close(); err != nil {
+			slog.Error("Error closing Kafka consumer", errAttr(err))
+		}
+	}()
+
+	for {
+		// Blocks until the group rebalances, which ends the workers of the
+		// previous generation
+		generation, err := group.Next(ctx)
+		if err != nil {
+			if ctx.Err() != nil {
+				slog.Info("Shutting down Kafka consumer")
+				return
+			}
+			slog.Error("Error joining Kafka consumer group", errAttr(err))
+			if sleepContext(ctx, 5*time.Second) != nil {
+				return
+			}
+			continue
+		}
+		for topic, partitions := range generation.Assignments {
+			for _, partition := range partitions {
+				generation.Start(func(ctx context.Context) {
+					k.consumePartition(ctx, generation, topic, partition)
+				})
+			}
+		}
+	}
+}
+
+// consumePartition processes the messages of a partition in order until the
+// generation ends
+func (k *KafkaSource) consumePartition(ctx context.Context, generation *kafka.Generation, topic string, partition kafka.PartitionAssignment) {
+	reader := kafka.NewReader(kafka.ReaderConfig{
+		Brokers:   k.opts.Brokers,
+		Topic:     topic,
+		Partition: partition.ID,
+		Dialer:    k.dialer,
+		MaxBytes:  10e6,
+	})
+	defer func() {
+		if err := reader.Close(); err != nil {
+			slog.Error("Error closing Kafka partition reader", "topic", topic, "partition", partition.ID, errAttr(err))
+		}
+	}()
+	if err := reader.SetOffset(partition.Offset); err != nil {
+		slog.Error("Error seeking Kafka partition", "topic", topic, "partition", partition.ID, errAttr(err))
+		return
+	}
+
+	for {
+		done, err := k.consumer.startFetch(ctx)
+		if err != nil {
+			return
+		}
+		message, err := reader.FetchMessage(ctx)
+		if err != nil {
+			done()
+			if ctx.Err() != nil {
+				return
+			}
+			slog.Error("Error fetching Kafka message", "topic", topic, "partition", partition.ID, errAttr(err))
+			if sleepContext(ctx, 5*time.Second) != nil {
+				return
+			}
+			continue
+		}
+		k.handle(ctx, generation, message)
+		done()
+	}
+}
+
+// handle processes a message, retrying it until it is acknowledged or runs
+// out of attempts
+func (k *KafkaSource) handle(ctx context.Context, generation *kafka.Generation, message kafka.Message) {
+	id := fmt.Sprintf("%s/%d/%d", message.Topic, message.Partition, message.Offset)
+	headers := propagation.MapCarrier{}
+	for _, header := range message.Headers {
+		headers[header.Key] = string(header.Value)
+	}
+
+	k.consumer.processInOrder(ctx, InboundMessage{
+		System:  "kafka",
+		ID:      id,
+		Body:    message.Value,
+		DedupID: id,
+		Headers: headers,
+		Ack:     func(ctx context.Context) { k.commit(ctx, generation, message) },
+	}, k.opts.MaxAttempts, k.opts.RetryBackoff)
+}
+
+func (k *KafkaSource) commit(ctx context.Context, generation *kafka.Generation, message kafka.Message) {
+	offsets := map[string]map[int]int64{message.Topic: {message.Partition: message.Offset + 1}}
+	if err := generation.CommitOffsets(offsets); err != nil {
+		// The message will be delivered again after a rebalance
+		loggerFrom(ctx).Error("Error committing Kafka offset", errAttr(err))
+	}
+}
+
+// CheckBrokers verifies a broker is reachable with the configured
+// credentials
+func (k *KafkaSource) CheckBrokers(ctx context.Context) error {
+	var errs []error
+	for _, broker := range k.opts.Brokers {
+		conn, err := k.dialer.DialContext(ctx, "tcp", broker)
+		if err == nil {
+			return conn.Close()
+		}
+		errs = append(errs, err)
+	}
+	return errors.Join(errs...)
+}
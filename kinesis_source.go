@@ -0,0 +1,443 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue"
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/expression"
+	"github.com/aws/aws-sdk-go-v2/service/kinesis"
+	"github.com/aws/aws-sdk-go-v2/service/kinesis/types"
+)
+
+// shardEnd is the checkpoint of a closed shard whose records were all
+// processed; its children may start
+const shardEnd = "SHARD_END"
+
+var kinesisShardsOwned = NewGaugeVec(
+	"orchestrator_kinesis_shards_owned",
+	"Kinesis shards whose lease this instance holds.",
+	"stream",
+)
+
+// ShardLease is the lease item of a shard; the holder renews vigenciaHasta
+// before it passes and stores in secuencia the last processed record
+type ShardLease struct {
+	ID         string `dynamodbav:"id"`
+	Owner      string `dynamodbav:"propietario"`
+	LeaseUntil int64  `dynamodbav:"vigenciaHasta"` // unix milliseconds
+	Checkpoint string `dynamodbav:"secuencia,omitempty"`
+}
+
+// KinesisOptions configures the Kinesis source
+type KinesisOptions struct {
+	Stream string
+	// BatchSize is the GetRecords limit; the checkpoint is written after
+	// every batch
+	BatchSize int
+	// PollInterval is the wait after an empty batch
+	PollInterval  time.Duration
+	LeaseDuration time.Duration
+	MaxAttempts   int
+	RetryBackoff  time.Duration
+}
+
+// KinesisSource feeds the records of a Kinesis stream into the same pipeline
+// as the SQS queue. Shards are spread across replicas through lease items in
+// a DynamoDB table: each replica takes at most one free or expired shard per
+// renewal, so replicas starting together share the stream. The records of a
+// shard are processed in order and a failing record is retried in place, as
+// with Kafka. Child shards start once their parents reach SHARD_END.
+type KinesisSource struct {
+	client     *kinesis.Client
+	leases     *DynamoDBClient
+	consumer   *SQSConsumer
+	instanceID string
+	opts       KinesisOptions
+
+	mu    sync.Mutex
+	owned map[string]context.CancelFunc // shard id -> cancels its reader
+	wg    sync.WaitGroup
+}
+
+func NewKinesisSource(consumer *SQSConsumer, cfg aws.Config, leases *DynamoDBClient, instanceID string, opts KinesisOptions) *KinesisSource {
+	kinesisShardsOwned.Set(0, opts.Stream)
+	return &KinesisSource{
+		client: kinesis.NewFromConfig(cfg, func(o *kinesis.Options) {
+			if endpoint := awsEndpoint("KINESIS"); endpoint != "" {
+				o.BaseEndpoint = aws.String(endpoint)
+			}
+		}),
+		leases:     leases,
+		consumer:   consumer,
+		instanceID: instanceID,
+		opts:       opts,
+		owned:      make(map[string]context.CancelFunc),
+	}
+}
+
+// Start balances the shard leases until ctx is done, then stops the readers
+// and releases the leases
+func (k *KinesisSource) Start(ctx context.Context) {
+	slog.Info("Starting Kinesis consumer", "stream", k.opts.Stream, "lease_duration", k.opts.LeaseDuration.String())
+
+	ticker := time.NewTicker(k.opts.LeaseDuration / 3)
+	defer ticker.Stop()
+
+	for {
+		if err := k.balance(ctx); err != nil && ctx.Err() == nil {
+			slog.Error("Kinesis consumer: error balancing shard leases", "stream", k.opts.Stream, errAttr(err))
+		}
+
+		select {
+		case <-ctx.Done():
+			k.shutdown()
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// balance renews the owned leases and takes at most one new shard. The
+// renewals come first, so a failure listing the shards does not let the
+// owned leases lapse.
+func (k *KinesisSource) balance(ctx context.Context) error {
+	owned := k.renewOwned(ctx)
+
+	shards, err := k.listShards(ctx)
+	if err != nil {
+		return err
+	}
+
+	leases := make(map[string]*ShardLease, len(shards))
+	for _, shard := range shards {
+		lease, err := k.getLease(ctx, aws.ToString(shard.ShardId))
+		if err != nil {
+			return err
+		}
+		leases[aws.ToString(shard.ShardId)] = lease
+	}
+
+	now := time.Now().UnixMilli()
+	for _, shard := range shards {
+		shardID := aws.ToString(shard.ShardId)
+		lease := leases[shardID]
+		switch {
+		case owned[shardID]:
+			continue
+		case lease != nil && lease.Checkpoint == shardEnd:
+			continue
+		case lease != nil && lease.LeaseUntil >= now && lease.Owner != k.instanceID:
+			continue
+		case !parentsDone(shard, leases):
+			continue
+		}
+
+		acquired, err := k.acquire(ctx, shardID)
+		if err != nil {
+			return err
+		}
+		if acquired {
+			checkpoint := ""
+			if lease != nil {
+				checkpoint = lease.Checkpoint
+			}
+			k.startReader(ctx, shardID, checkpoint)
+			// One new shard per renewal leaves the rest to other replicas
+			return nil
+		}
+	}
+	return nil
+}
+
+// renewOwned renews the leases this instance holds, stops the readers of
+// the ones it lost and returns the shards still owned
+func (k *KinesisSource) renewOwned(ctx context.Context) map[string]bool {
+	k.mu.Lock()
+	owned := make(map[string]bool, len(k.owned))
+	for shardID := range k.owned {
+		owned[shardID] = true
+	}
+	k.mu.Unlock()
+
+	for shardID := range owned {
+		if ok, err := k.renew(ctx, shardID); err != nil || !ok {
+			slog.Warn("Lost Kinesis shard lease", "stream", k.opts.Stream, "shard_id", shardID, errAttr(err))
+			k.stopReader(shardID)
+			delete(owned, shardID)
+		}
+	}
+	return owned
+}
+
+// parentsDone reports whether the parents of shard still in the stream were
+// processed to their end
+func parentsDone(shard types.Shard, leases map[string]*ShardLease) bool {
+	for _, parent := range []*string{shard.ParentShardId, shard.AdjacentParentShardId} {
+		if parent == nil {
+			continue
+		}
+		lease, inStream := leases[*parent]
+		if inStream && (lease == nil || lease.Checkpoint != shardEnd) {
+			return false
+		}
+	}
+	return true
+}
+
+func (k *KinesisSource) listShards(ctx context.Context) ([]types.Shard, error) {
+	var shards []types.Shard
+	input := &kinesis.ListShardsInput{StreamName: aws.String(k.opts.Stream)}
+	for {
+		out, err := k.client.ListShards(ctx, input)
+		if err != nil {
+			return nil, fmt.Errorf("error listing shards of %s: %w", k.opts.Stream, err)
+		}
+		shards = append(shards, out.Shards...)
+		if out.NextToken == nil {
+			return shards, nil
+		}
+		input = &kinesis.ListShardsInput{NextToken: out.NextToken}
+	}
+}
+
+func (k *KinesisSource) leaseID(shardID string) string {
+	return "shard#" + k.opts.Stream + "#" + shardID
+}
+
+// getLease returns the lease of the shard, or nil when it was never taken
+func (k *KinesisSource) getLease(ctx context.Context, shardID string) (*ShardLease, error) {
+	item, err := k.leases.GetItem(ctx, k.leaseID(shardID), ConsistentRead(true))
+	if err != nil {
+		return nil, fmt.Errorf("error reading lease of shard %s: %w", shardID, err)
+	}
+	if item == nil {
+		return nil, nil
+	}
+	var lease ShardLease
+	if err := attributevalue.UnmarshalMap(item, &lease); err != nil {
+		return nil, fmt.Errorf("error unmarshaling lease of shard %s: %w", shardID, err)
+	}
+	return &lease, nil
+}
+
+// acquire takes the lease when it is free or expired, keeping its checkpoint
+func (k *KinesisSource) acquire(ctx context.Context, shardID string) (bool, error) {
+	now := time.Now()
+	condition := expression.AttributeNotExists(expression.Name("id")).
+		Or(expression.Name("vigenciaHasta").LessThan(expression.Value(now.UnixMilli()))).
+		Or(expression.Name("propietario").Equal(expression.Value(k.instanceID)))
+	return k.updateLease(ctx, shardID, condition, expression.
+		Set(expression.Name("propietario"), expression.Value(k.instanceID)).
+		Set(expression.Name("vigenciaHasta"), expression.Value(now.Add(k.opts.LeaseDuration).UnixMilli())))
+}
+
+// renew extends a lease this instance holds
+func (k *KinesisSource) renew(ctx context.Context, shardID string) (bool, error) {
+	return k.updateLease(ctx, shardID, k.ownerCondition(), expression.
+		Set(expression.Name("vigenciaHasta"), expression.Value(time.Now().Add(k.opts.LeaseDuration).UnixMilli())))
+}
+
+// checkpoint stores the last processed sequence number, or shardEnd
+func (k *KinesisSource) checkpoint(ctx context.Context, shardID, sequence string) (bool, error) {
+	return k.updateLease(ctx, shardID, k.ownerCondition(), expression.
+		Set(expression.Name("secuencia"), expression.Value(sequence)))
+}
+
+func (k *KinesisSource) ownerCondition() expression.ConditionBuilder {
+	return expression.Name("propietario").Equal(expression.Value(k.instanceID))
+}
+
+// updateLease applies update under condition and reports false when the
+// condition failed
+func (k *KinesisSource) updateLease(ctx context.Context, shardID string, condition expression.ConditionBuilder, update expression.UpdateBuilder) (bool, error) {
+	expr, err := expression.NewBuilder().WithCondition(condition).WithUpdate(update).Build()
+	if err != nil {
+		return false, fmt.Errorf("error building lease update: %w", err)
+	}
+	if err := k.leases.UpdateItem(ctx, itemKey(k.leaseID(shardID)), expr); err != nil {
+		if isConditionFailed(err) {
+			return false, nil
+		}
+		return false, err
+	}
+	return true, nil
+}
+
+func (k *KinesisSource) startReader(ctx context.Context, shardID, checkpoint string) {
+	readerCtx, cancel := context.WithCancel(ctx)
+
+	k.mu.Lock()
+	k.owned[shardID] = cancel
+	kinesisShardsOwned.Set(float64(len(k.owned)), k.opts.Stream)
+	k.mu.Unlock()
+
+	slog.Info("Acquired Kinesis shard lease", "stream", k.opts.Stream, "shard_id", shardID, "checkpoint", checkpoint)
+	k.wg.Add(1)
+	go func() {
+		defer k.wg.Done()
+		if err := k.readShard(readerCtx, shardID, checkpoint); err != nil && readerCtx.Err() == nil {
+			slog.Error("Kinesis consumer: shard reader stopped", "stream", k.opts.Stream, "shard_id", shardID, errAttr(err))
+		}
+		// A stopped reader gives the shard up; its lease lapses unless it
+		// was released
+		k.stopReader(shardID)
+	}()
+}
+
+func (k *KinesisSource) stopReader(shardID string) {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	if cancel, ok := k.owned[shardID]; ok {
+		cancel()
+		delete(k.owned, shardID)
+	}
+	kinesisShardsOwned.Set(float64(len(k.owned)), k.opts.Stream)
+}
+
+// shutdown stops the readers and expires their leases, so another replica
+// takes over without waiting for them
+func (k *KinesisSource) shutdown() {
+	k.mu.Lock()
+	shardIDs := make([]string, 0, len(k.owned))
+	for shardID, cancel := range k.owned {
+		cancel()
+		shardIDs = append(shardIDs, shardID)
+	}
+	k.mu.Unlock()
+	k.wg.Wait()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	for _, shardID := range shardIDs {
+		if _, err := k.updateLease(ctx, shardID, k.ownerCondition(), expression.
+			Set(expression.Name("vigenciaHasta"), expression.Value(0))); err != nil {
+			slog.Error("Kinesis consumer: error releasing shard lease", "shard_id", shardID, errAttr(err))
+		}
+	}
+	slog.Info("Shutting down Kinesis consumer", "released_shards", len(shardIDs))
+}
+
+// readShard processes the shard from its checkpoint, one batch at a time,
+// until it ends, the lease is lost or ctx is done
+func (k *KinesisSource) readShard(ctx context.Context, shardID, checkpoint string) error {
+	iterator, err := k.shardIterator(ctx, shardID, checkpoint)
+	if err != nil {
+		return err
+	}
+
+	for {
+		done, err := k.consumer.startFetch(ctx)
+		if err != nil {
+			return err
+		}
+		out, err := k.readBatch(ctx, shardID, iterator, checkpoint)
+		done()
+		var expired *types.ExpiredIteratorException
+		var throttled *types.ProvisionedThroughputExceededException
+		switch {
+		case errors.As(err, &expired):
+			if iterator, err = k.shardIterator(ctx, shardID, checkpoint); err != nil {
+				return err
+			}
+			continue
+		case errors.As(err, &throttled):
+			if err := sleepContext(ctx, k.opts.PollInterval); err != nil {
+				return err
+			}
+			continue
+		case err != nil:
+			return err
+		}
+
+		if len(out.Records) > 0 {
+			checkpoint = aws.ToString(out.Records[len(out.Records)-1].SequenceNumber)
+		}
+
+		if out.NextShardIterator == nil {
+			if ok, err := k.checkpoint(ctx, shardID, shardEnd); err != nil {
+				return fmt.Errorf("error checkpointing the end of shard %s: %w", shardID, err)
+			} else if !ok {
+				return fmt.Errorf("lost the lease of shard %s before checkpointing its end", shardID)
+			}
+			slog.Info("Kinesis shard closed and fully processed", "stream", k.opts.Stream, "shard_id", shardID)
+			return nil
+		}
+		iterator = out.NextShardIterator
+
+		if len(out.Records) == 0 || aws.ToInt64(out.MillisBehindLatest) == 0 {
+			if err := sleepContext(ctx, k.opts.PollInterval); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+// readBatch fetches the next batch of the shard, processes its records and
+// checkpoints the last one; the source counts as fetching meanwhile
+func (k *KinesisSource) readBatch(ctx context.Context, shardID string, iterator *string, checkpoint string) (*kinesis.GetRecordsOutput, error) {
+	out, err := k.client.GetRecords(ctx, &kinesis.GetRecordsInput{
+		ShardIterator: iterator,
+		Limit:         aws.Int32(int32(k.opts.BatchSize)),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("error reading shard %s: %w", shardID, err)
+	}
+
+	for _, record := range out.Records {
+		sequence := aws.ToString(record.SequenceNumber)
+		id := shardID + "/" + sequence
+		if !k.consumer.processInOrder(ctx, InboundMessage{
+			System:  "aws_kinesis",
+			ID:      id,
+			Body:    record.Data,
+			DedupID: k.opts.Stream + "/" + id,
+			// Records are checkpointed per batch
+			Ack: func(context.Context) {},
+		}, k.opts.MaxAttempts, k.opts.RetryBackoff) {
+			return nil, ctx.Err()
+		}
+	}
+
+	if len(out.Records) > 0 {
+		checkpoint = aws.ToString(out.Records[len(out.Records)-1].SequenceNumber)
+		if ok, err := k.checkpoint(ctx, shardID, checkpoint); err != nil {
+			return nil, fmt.Errorf("error checkpointing shard %s: %w", shardID, err)
+		} else if !ok {
+			return nil, fmt.Errorf("lost the lease of shard %s before its checkpoint", shardID)
+		}
+	}
+	return out, nil
+}
+
+// shardIterator starts after the checkpoint, or at the oldest record
+func (k *KinesisSource) shardIterator(ctx context.Context, shardID, checkpoint string) (*string, error) {
+	input := &kinesis.GetShardIteratorInput{
+		StreamName:        aws.String(k.opts.Stream),
+		ShardId:           aws.String(shardID),
+		ShardIteratorType: types.ShardIteratorTypeTrimHorizon,
+	}
+	if checkpoint != "" {
+		input.ShardIteratorType = types.ShardIteratorTypeAfterSequenceNumber
+		input.StartingSequenceNumber = aws.String(checkpoint)
+	}
+
+	out, err := k.client.GetShardIterator(ctx, input)
+	if err != nil {
+		return nil, fmt.Errorf("error getting iterator of shard %s: %w", shardID, err)
+	}
+	return out.ShardIterator, nil
+}
+
+// CheckStream verifies the stream is reachable with the current credentials
+func (k *KinesisSource) CheckStream(ctx context.Context) error {
+	_, err := k.client.DescribeStreamSummary(ctx, &kinesis.DescribeStreamSummaryInput{
+		StreamName: aws.String(k.opts.Stream),
+	})
+	return err
+}
@@ -3,10 +3,13 @@ package main
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"sync"
+	"time"
 
 	"github.com/aws/aws-sdk-go-v2/aws"
-	"github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/aws/arn"
 	"github.com/aws/aws-sdk-go-v2/service/lambda"
 	"github.com/aws/aws-sdk-go-v2/service/lambda/types"
 )
@@ -17,50 +20,183 @@ type LambdaResponse struct {
 }
 
 type LambdaClient struct {
-	client *lambda.Client
+	cfg    aws.Config
+	client *lambda.Client // región por defecto
+
+	mu       sync.Mutex
+	regional map[string]*lambda.Client
+	failover map[string]*regionFailover // por región primaria
+	failOpts *FailoverOptions           // nil: sin failover
+
+	coldStarts *ColdStartTracker // nil: sin detección de arranques en frío
 }
 
-// NewLambdaClient crea un nuevo cliente de Lambda
-func NewLambdaClient(region string) (*LambdaClient, error) {
-	cfg, err := config.LoadDefaultConfig(context.TODO(),
-		config.WithRegion(region),
-	)
-	if err != nil {
-		return nil, fmt.Errorf("error loading AWS config: %w", err)
+// NewLambdaClient crea un nuevo cliente de Lambda con la configuración AWS
+// compartida
+func NewLambdaClient(cfg aws.Config) *LambdaClient {
+	l := &LambdaClient{
+		cfg:      cfg,
+		regional: make(map[string]*lambda.Client),
+		failover: make(map[string]*regionFailover),
+	}
+	l.client = l.newClient(cfg.Region)
+	l.regional[cfg.Region] = l.client
+	return l
+}
+
+func (l *LambdaClient) newClient(region string) *lambda.Client {
+	return lambda.NewFromConfig(l.cfg, func(o *lambda.Options) {
+		o.Region = region
+		// Propagar la traza de X-Ray en cada invocación
+		o.APIOptions = append(o.APIOptions, addXRayTraceHeader)
+		// Endpoint alternativo para desarrollo local (LocalStack)
+		if endpoint := awsEndpoint("LAMBDA"); endpoint != "" {
+			o.BaseEndpoint = aws.String(endpoint)
+		}
+	})
+}
+
+// EnableFailover activa el failover a la réplica (ReplicaARN) de cada Lambda
+// cuando su región primaria se degrada
+func (l *LambdaClient) EnableFailover(opts FailoverOptions) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.failOpts = &opts
+}
+
+// TrackColdStarts activa la detección de arranques en frío de los trabajadores
+func (l *LambdaClient) TrackColdStarts(tracker *ColdStartTracker) {
+	l.coldStarts = tracker
+}
+
+// clientFor devuelve el cliente de la región de la función (ARN o nombre)
+func (l *LambdaClient) clientFor(function, region string) *lambda.Client {
+	if region == "" {
+		region = functionRegion(function, l.cfg.Region)
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	client, ok := l.regional[region]
+	if !ok {
+		client = l.newClient(region)
+		l.regional[region] = client
+	}
+	return client
+}
+
+func (l *LambdaClient) failoverFor(region string) *regionFailover {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.failOpts == nil {
+		return nil
 	}
+	f, ok := l.failover[region]
+	if !ok {
+		f = newRegionFailover("lambda", region, *l.failOpts)
+		l.failover[region] = f
+	}
+	return f
+}
+
+// FailoverStates devuelve el estado del failover de cada región invocada
+func (l *LambdaClient) FailoverStates() []FailoverState {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	states := make([]FailoverState, 0, len(l.failover))
+	for _, f := range l.failover {
+		states = append(states, f.state())
+	}
+	return states
+}
 
-	return &LambdaClient{
-		client: lambda.NewFromConfig(cfg),
-	}, nil
+// functionRegion extrae la región de un ARN de función, o fallback si es un nombre
+func functionRegion(function, fallback string) string {
+	if parsed, err := arn.Parse(function); err == nil && parsed.Region != "" {
+		return parsed.Region
+	}
+	return fallback
+}
+
+// InvokeWorker invoca sincrónicamente una Lambda del registro en su región.
+// Mientras esa región esté degradada se invoca su réplica en la región
+// secundaria, si la tiene.
+func (l *LambdaClient) InvokeWorker(ctx context.Context, worker Lambda, payload interface{}) ([]byte, error) {
+	region := worker.Region
+	if region == "" {
+		region = functionRegion(worker.ARN, l.cfg.Region)
+	}
+
+	failover := l.failoverFor(region)
+	if worker.ReplicaARN != "" && failover.useSecondary() {
+		loggerFrom(ctx).Info("Invoking replica in secondary region", "replica_arn", worker.ReplicaARN)
+		return l.invokeWorker(ctx, l.clientFor(worker.ReplicaARN, ""), worker.ReplicaARN, payload)
+	}
+
+	result, err := l.invokeWorker(ctx, l.clientFor(worker.ARN, region), worker.ARN, payload)
+	failover.record(err)
+	return result, err
+}
+
+// invokeWorker invoca un trabajador midiendo la duración para detectar los
+// arranques en frío
+func (l *LambdaClient) invokeWorker(ctx context.Context, client *lambda.Client, functionName string, payload interface{}) ([]byte, error) {
+	started := time.Now()
+	result, logResult, err := l.invoke(ctx, client, functionName, payload, l.coldStarts.logTail())
+	if err == nil {
+		l.coldStarts.Observe(functionName, time.Since(started), logResult)
+	}
+	return result, err
 }
 
 // InvokeSync invoca una función Lambda de forma síncrona
 // functionName: nombre o ARN de la función Lambda
 // payload: datos a enviar a la Lambda (se convierte a JSON automáticamente)
 func (l *LambdaClient) InvokeSync(ctx context.Context, functionName string, payload interface{}) ([]byte, error) {
+	return l.invokeSync(ctx, l.clientFor(functionName, ""), functionName, payload)
+}
+
+func (l *LambdaClient) invokeSync(ctx context.Context, client *lambda.Client, functionName string, payload interface{}) ([]byte, error) {
+	result, _, err := l.invoke(ctx, client, functionName, payload, false)
+	return result, err
+}
+
+// invoke invoca la función de forma síncrona; con logTail devuelve también
+// los últimos 4 KB de sus logs en base64
+func (l *LambdaClient) invoke(ctx context.Context, client *lambda.Client, functionName string, payload interface{}, logTail bool) ([]byte, string, error) {
 	// Convertir el payload a JSON
 	payloadBytes, err := json.Marshal(payload)
 	if err != nil {
-		return nil, fmt.Errorf("error marshaling payload: %w", err)
+		return nil, "", fmt.Errorf("error marshaling payload: %w", err)
 	}
 
-	// Invocar la función Lambda
-	result, err := l.client.Invoke(ctx, &lambda.InvokeInput{
+	// Invocar la función Lambda, propagando el contexto de traza en ClientContext
+	input := &lambda.InvokeInput{
 		FunctionName:   aws.String(functionName),
 		InvocationType: types.InvocationTypeRequestResponse, // Síncrono
 		Payload:        payloadBytes,
-	})
+		ClientContext:  traceClientContext(ctx),
+	}
+	if logTail {
+		input.LogType = types.LogTypeTail
+	}
+	result, err := client.Invoke(ctx, input)
 
+	// El límite de concurrencia se distingue para reintentar más tarde
+	var throttled *types.TooManyRequestsException
+	if errors.As(err, &throttled) {
+		return nil, "", fmt.Errorf("error invoking lambda: %w: %w", ErrInvokeThrottled, err)
+	}
 	if err != nil {
-		return nil, fmt.Errorf("error invoking lambda: %w", err)
+		return nil, "", fmt.Errorf("error invoking lambda: %w", err)
 	}
 
 	// Verificar si hubo errores en la función Lambda
 	if result.FunctionError != nil {
-		return nil, fmt.Errorf("lambda function error: %s, payload: %s", *result.FunctionError, string(result.Payload))
+		return nil, "", fmt.Errorf("lambda function error: %s, payload: %s", *result.FunctionError, string(result.Payload))
 	}
 
-	return result.Payload, nil
+	return result.Payload, aws.ToString(result.LogResult), nil
 }
 
 // InvokeAsync invoca una función Lambda de forma asíncrona
@@ -73,7 +209,7 @@ func (l *LambdaClient) InvokeAsync(ctx context.Context, functionName string, pay
 	}
 
 	// Invocar la función Lambda de forma asíncrona
-	_, err = l.client.Invoke(ctx, &lambda.InvokeInput{
+	_, err = l.clientFor(functionName, "").Invoke(ctx, &lambda.InvokeInput{
 		FunctionName:   aws.String(functionName),
 		InvocationType: types.InvocationTypeEvent, // Asíncrono
 		Payload:        payloadBytes,
@@ -93,7 +229,7 @@ func (l *LambdaClient) InvokeDryRun(ctx context.Context, functionName string, pa
 		return fmt.Errorf("error marshaling payload: %w", err)
 	}
 
-	_, err = l.client.Invoke(ctx, &lambda.InvokeInput{
+	_, err = l.clientFor(functionName, "").Invoke(ctx, &lambda.InvokeInput{
 		FunctionName:   aws.String(functionName),
 		InvocationType: types.InvocationTypeDryRun, // Solo validación
 		Payload:        payloadBytes,
@@ -106,6 +242,18 @@ func (l *LambdaClient) InvokeDryRun(ctx context.Context, functionName string, pa
 	return nil
 }
 
+// GetFunctionConfiguration obtiene la configuración publicada de una función Lambda
+func (l *LambdaClient) GetFunctionConfiguration(ctx context.Context, functionName string) (*lambda.GetFunctionConfigurationOutput, error) {
+	result, err := l.clientFor(functionName, "").GetFunctionConfiguration(ctx, &lambda.GetFunctionConfigurationInput{
+		FunctionName: aws.String(functionName),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("error getting function configuration: %w", err)
+	}
+
+	return result, nil
+}
+
 // InvokeSyncWithResponse invoca una Lambda y deserializa la respuesta
 func (l *LambdaClient) InvokeSyncWithResponse(ctx context.Context, functionName string, payload interface{}, response interface{}) error {
 	responseBytes, err := l.InvokeSync(ctx, functionName, payload)
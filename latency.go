@@ -0,0 +1,87 @@
+package main
+
+import (
+	"math/rand"
+	"slices"
+	"time"
+)
+
+// latencyWindowSize is the number of recent invocations the percentiles of
+// a worker are computed from
+const latencyWindowSize = 512
+
+// latencyMinSamples is the invocations a worker needs before its
+// percentiles are used for routing and alerts
+const latencyMinSamples = 20
+
+var lambdaLatency = NewHistogramVec(
+	"orchestrator_lambda_latency_seconds",
+	"Time to handle a message routed to each worker, by worker.",
+	[]float64{0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10, 30},
+	"lambda_arn",
+)
+
+var lambdaLatencyPercentile = NewGaugeVec(
+	"orchestrator_lambda_latency_percentile_seconds",
+	"Latency percentiles of the recent invocations of each worker, by worker and quantile (0.5, 0.95, 0.99).",
+	"lambda_arn", "quantile",
+)
+
+// latencyWindow keeps the latest durations of a worker in a ring
+type latencyWindow struct {
+	samples []time.Duration
+	next    int
+}
+
+func (w *latencyWindow) add(duration time.Duration) {
+	if len(w.samples) < latencyWindowSize {
+		w.samples = append(w.samples, duration)
+		return
+	}
+	w.samples[w.next] = duration
+	w.next = (w.next + 1) % latencyWindowSize
+}
+
+// percentiles returns the p50, p95 and p99 of the window
+func (w *latencyWindow) percentiles() (p50, p95, p99 time.Duration) {
+	if len(w.samples) == 0 {
+		return 0, 0, 0
+	}
+	sorted := slices.Clone(w.samples)
+	slices.Sort(sorted)
+	at := func(q float64) time.Duration {
+		return sorted[min(int(q*float64(len(sorted))), len(sorted)-1)]
+	}
+	return at(0.5), at(0.95), at(0.99)
+}
+
+func milliseconds(d time.Duration) float64 {
+	return float64(d) / float64(time.Millisecond)
+}
+
+// observeLatency exports a duration of arn and its new percentiles
+func observeLatency(arn string, duration, p50, p95, p99 time.Duration) {
+	lambdaLatency.Observe(duration.Seconds(), arn)
+	lambdaLatencyPercentile.Set(p50.Seconds(), arn, "0.5")
+	lambdaLatencyPercentile.Set(p95.Seconds(), arn, "0.95")
+	lambdaLatencyPercentile.Set(p99.Seconds(), arn, "0.99")
+}
+
+// selectLatency picks the faster by p95 of two random candidates, so slow
+// workers get less traffic without starving. Workers with too few samples
+// win, to learn their latency.
+func selectLatency(lambdas []Lambda, stats *routingStats) Lambda {
+	first := lambdas[rand.Intn(len(lambdas))]
+	second := lambdas[rand.Intn(len(lambdas))]
+	p95 := func(lambda Lambda) float64 {
+		p95, samples := stats.p95(lambda.ARN)
+		if samples < latencyMinSamples {
+			return 0
+		}
+		return p95
+	}
+	if p95(second) < p95(first) {
+		return second
+	}
+	return first
+}
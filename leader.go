@@ -0,0 +1,226 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue"
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/expression"
+)
+
+// leaderLockID is the lock item in the orchestrator table
+const leaderLockID = "lock#leader"
+
+var leaderGauge = NewGaugeVec(
+	"orchestrator_leader",
+	"1 while this instance holds the leader lock and runs the singleton jobs.",
+)
+
+// LeaderLock is the lock item; the holder renews vigenciaHasta before it passes
+type LeaderLock struct {
+	ID         string `dynamodbav:"id"`
+	Owner      string `dynamodbav:"propietario"`
+	LeaseUntil int64  `dynamodbav:"vigenciaHasta"` // unix milliseconds
+	ExpiresAt  int64  `dynamodbav:"expiraEn"`
+}
+
+// leaderLock is the store of the leader lease
+type leaderLock interface {
+	// tryAcquire takes the lease when it is free, expired or already ours,
+	// and extends it
+	tryAcquire(ctx context.Context) (bool, error)
+	// release expires our lease
+	release(ctx context.Context) error
+}
+
+// LeaderElector elects one replica through a lease on a lock: a DynamoDB
+// lock item or a Kubernetes Lease. The leader renews the lease every third
+// of its duration; another replica takes over once the lease has passed, so
+// instance clocks must be roughly in sync. A nil *LeaderElector treats this
+// instance as the only one.
+type LeaderElector struct {
+	lock       leaderLock
+	instanceID string
+	lease      time.Duration
+
+	// elected is closed once the first election round has a result
+	elected     chan struct{}
+	electedOnce sync.Once
+
+	mu     sync.Mutex
+	leader bool
+	// term is closed when the leadership it was created with is lost
+	term chan struct{}
+}
+
+// NewLeaderElector elects through the lock item of the orchestrator table
+func NewLeaderElector(db *DynamoDBClient, instanceID string, lease time.Duration) *LeaderElector {
+	return newLeaderElector(&dynamoLeaderLock{db: db, instanceID: instanceID, lease: lease}, instanceID, lease)
+}
+
+func newLeaderElector(lock leaderLock, instanceID string, lease time.Duration) *LeaderElector {
+	leaderGauge.Set(0)
+	return &LeaderElector{
+		lock:       lock,
+		instanceID: instanceID,
+		lease:      lease,
+		elected:    make(chan struct{}),
+	}
+}
+
+// Elected is closed once the first election round has a result, so
+// IsLeader is settled
+func (e *LeaderElector) Elected() <-chan struct{} {
+	if e == nil {
+		elected := make(chan struct{})
+		close(elected)
+		return elected
+	}
+	return e.elected
+}
+
+// LeaderContext returns a context cancelled when this instance loses the
+// leadership, already cancelled when it is not the leader
+func (e *LeaderElector) LeaderContext(ctx context.Context) (context.Context, context.CancelFunc) {
+	ctx, cancel := context.WithCancel(ctx)
+	if e == nil {
+		return ctx, cancel
+	}
+	e.mu.Lock()
+	term := e.term
+	e.mu.Unlock()
+	if term == nil {
+		cancel()
+		return ctx, cancel
+	}
+	go func() {
+		select {
+		case <-term:
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+	return ctx, cancel
+}
+
+// IsLeader reports whether this instance currently holds the lock
+func (e *LeaderElector) IsLeader() bool {
+	if e == nil {
+		return true
+	}
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return e.leader
+}
+
+func (e *LeaderElector) setLeader(leader bool) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	defer e.electedOnce.Do(func() { close(e.elected) })
+	if e.leader == leader {
+		return
+	}
+	e.leader = leader
+
+	if leader {
+		e.term = make(chan struct{})
+		leaderGauge.Set(1)
+		slog.Info("Acquired leadership", "instance_id", e.instanceID)
+	} else {
+		close(e.term)
+		e.term = nil
+		leaderGauge.Set(0)
+		slog.Warn("Lost leadership", "instance_id", e.instanceID)
+	}
+}
+
+// Start campaigns for the lock until ctx is done
+func (e *LeaderElector) Start(ctx context.Context) {
+	slog.Info("Starting leader election", "instance_id", e.instanceID, "lease", e.lease.String())
+
+	ticker := time.NewTicker(e.lease / 3)
+	defer ticker.Stop()
+
+	for {
+		acquired, err := e.lock.tryAcquire(ctx)
+		if err != nil && ctx.Err() == nil {
+			// Without a confirmed renewal the lease may pass, so step down
+			slog.Error("Leader election: error renewing the lock", errAttr(err))
+		}
+		e.setLeader(acquired)
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// dynamoLeaderLock is the lock item of the orchestrator table
+type dynamoLeaderLock struct {
+	db         *DynamoDBClient
+	instanceID string
+	lease      time.Duration
+}
+
+func (l *dynamoLeaderLock) tryAcquire(ctx context.Context) (bool, error) {
+	now := time.Now()
+	item, err := attributevalue.MarshalMap(LeaderLock{
+		ID:         leaderLockID,
+		Owner:      l.instanceID,
+		LeaseUntil: now.Add(l.lease).UnixMilli(),
+		ExpiresAt:  now.Add(24 * time.Hour).Unix(),
+	})
+	if err != nil {
+		return false, fmt.Errorf("error marshaling leader lock: %w", err)
+	}
+
+	condition := expression.AttributeNotExists(expression.Name("id")).
+		Or(expression.Name("propietario").Equal(expression.Value(l.instanceID))).
+		Or(expression.Name("vigenciaHasta").LessThan(expression.Value(now.UnixMilli())))
+	expr, err := expression.NewBuilder().WithCondition(condition).Build()
+	if err != nil {
+		return false, fmt.Errorf("error building leader lock condition: %w", err)
+	}
+
+	if err := l.db.PutItemWithCondition(ctx, item, expr); err != nil {
+		if isConditionFailed(err) {
+			return false, nil
+		}
+		return false, err
+	}
+	return true, nil
+}
+
+func (l *dynamoLeaderLock) release(ctx context.Context) error {
+	expr, err := expression.NewBuilder().
+		WithUpdate(expression.Set(expression.Name("vigenciaHasta"), expression.Value(0))).
+		WithCondition(expression.Name("propietario").Equal(expression.Value(l.instanceID))).
+		Build()
+	if err != nil {
+		return fmt.Errorf("error building release: %w", err)
+	}
+	if err := l.db.UpdateItem(ctx, itemKey(leaderLockID), expr); err != nil && !isConditionFailed(err) {
+		return fmt.Errorf("error releasing the lock: %w", err)
+	}
+	return nil
+}
+
+// Release expires our lease on graceful shutdown, so another replica takes
+// over without waiting for it
+func (e *LeaderElector) Release(ctx context.Context) {
+	if e == nil || !e.IsLeader() {
+		return
+	}
+	e.setLeader(false)
+
+	if err := e.lock.release(ctx); err != nil {
+		slog.Error("Leader election: error releasing the lease", errAttr(err))
+		return
+	}
+	slog.Info("Released leadership", "instance_id", e.instanceID)
+}
@@ -0,0 +1,245 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"net"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+)
+
+// serviceAccountDir holds the credentials Kubernetes mounts in every pod
+const serviceAccountDir = "/var/run/secrets/kubernetes.io/serviceaccount"
+
+// leaseTimeLayout is the MicroTime format of the Lease times
+const leaseTimeLayout = "2006-01-02T15:04:05.000000Z07:00"
+
+// kubernetesLease is the part of a coordination.k8s.io/v1 Lease the election
+// reads and writes
+type kubernetesLease struct {
+	APIVersion string `json:"apiVersion"`
+	Kind       string `json:"kind"`
+	// Metadata is kept as read, with its resourceVersion and labels
+	Metadata map[string]any `json:"metadata"`
+	Spec     struct {
+		HolderIdentity       *string `json:"holderIdentity,omitempty"`
+		LeaseDurationSeconds *int    `json:"leaseDurationSeconds,omitempty"`
+		AcquireTime          string  `json:"acquireTime,omitempty"`
+		RenewTime            string  `json:"renewTime,omitempty"`
+		LeaseTransitions     int     `json:"leaseTransitions,omitempty"`
+	} `json:"spec"`
+}
+
+// expired reports whether the holder let the lease pass
+func (l *kubernetesLease) expired(now time.Time) bool {
+	if l.Spec.HolderIdentity == nil || *l.Spec.HolderIdentity == "" {
+		return true
+	}
+	renewed, err := time.Parse(time.RFC3339Nano, l.Spec.RenewTime)
+	if err != nil || l.Spec.LeaseDurationSeconds == nil {
+		return true
+	}
+	return now.After(renewed.Add(time.Duration(*l.Spec.LeaseDurationSeconds) * time.Second))
+}
+
+// errLeaseConflict is a write that lost against another replica
+var errLeaseConflict = errors.New("lease changed concurrently")
+
+// kubernetesLeaderLock is a coordination.k8s.io/v1 Lease, written through the
+// API server with the in-cluster service account. Updates carry the
+// resourceVersion read, so of two replicas taking an expired lease only one
+// succeeds. The service account needs get, create and update on leases in
+// its namespace.
+type kubernetesLeaderLock struct {
+	client     *http.Client
+	url        string // of the leases of the namespace
+	name       string
+	namespace  string
+	instanceID string
+	lease      time.Duration
+}
+
+// NewKubernetesLeaderElector elects through the Lease name of the pod
+// namespace
+func NewKubernetesLeaderElector(name, instanceID string, lease time.Duration) (*LeaderElector, error) {
+	lock, err := newKubernetesLeaderLock(name, instanceID, lease)
+	if err != nil {
+		return nil, err
+	}
+	return newLeaderElector(lock, instanceID, lease), nil
+}
+
+func newKubernetesLeaderLock(name, instanceID string, lease time.Duration) (*kubernetesLeaderLock, error) {
+	host, port := os.Getenv("KUBERNETES_SERVICE_HOST"), os.Getenv("KUBERNETES_SERVICE_PORT")
+	if host == "" || port == "" {
+		return nil, errors.New("error loading in-cluster config: KUBERNETES_SERVICE_HOST and KUBERNETES_SERVICE_PORT are not set, not running in a pod")
+	}
+	namespace, err := os.ReadFile(serviceAccountDir + "/namespace")
+	if err != nil {
+		return nil, fmt.Errorf("error reading service account namespace: %w", err)
+	}
+	ca, err := os.ReadFile(serviceAccountDir + "/ca.crt")
+	if err != nil {
+		return nil, fmt.Errorf("error reading cluster CA: %w", err)
+	}
+	roots := x509.NewCertPool()
+	if !roots.AppendCertsFromPEM(ca) {
+		return nil, errors.New("error parsing cluster CA: no certificate found")
+	}
+
+	ns := strings.TrimSpace(string(namespace))
+	return &kubernetesLeaderLock{
+		client: &http.Client{
+			Timeout:   5 * time.Second,
+			Transport: &http.Transport{TLSClientConfig: &tls.Config{RootCAs: roots, MinVersion: tls.VersionTLS12}},
+		},
+		url:        "https://" + net.JoinHostPort(host, port) + "/apis/coordination.k8s.io/v1/namespaces/" + ns + "/leases",
+		name:       name,
+		namespace:  ns,
+		instanceID: instanceID,
+		lease:      lease,
+	}, nil
+}
+
+func (l *kubernetesLeaderLock) tryAcquire(ctx context.Context) (bool, error) {
+	now := time.Now()
+	current, err := l.get(ctx)
+	if err != nil {
+		return false, err
+	}
+
+	if current == nil {
+		lease := l.newLease()
+		l.hold(lease, now, true)
+		err = l.write(ctx, http.MethodPost, l.url, lease)
+	} else {
+		held := current.Spec.HolderIdentity != nil && *current.Spec.HolderIdentity == l.instanceID
+		if !held && !current.expired(now) {
+			return false, nil
+		}
+		l.hold(current, now, !held)
+		err = l.write(ctx, http.MethodPut, l.url+"/"+l.name, current)
+	}
+	if errors.Is(err, errLeaseConflict) {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+// release clears the holder when we still hold the lease
+func (l *kubernetesLeaderLock) release(ctx context.Context) error {
+	current, err := l.get(ctx)
+	if err != nil || current == nil {
+		return err
+	}
+	if current.Spec.HolderIdentity == nil || *current.Spec.HolderIdentity != l.instanceID {
+		return nil
+	}
+	empty := ""
+	current.Spec.HolderIdentity = &empty
+	if err := l.write(ctx, http.MethodPut, l.url+"/"+l.name, current); err != nil && !errors.Is(err, errLeaseConflict) {
+		return err
+	}
+	return nil
+}
+
+func (l *kubernetesLeaderLock) newLease() *kubernetesLease {
+	return &kubernetesLease{
+		APIVersion: "coordination.k8s.io/v1",
+		Kind:       "Lease",
+		Metadata:   map[string]any{"name": l.name, "namespace": l.namespace},
+	}
+}
+
+// hold makes us the holder of lease and renews it
+func (l *kubernetesLeaderLock) hold(lease *kubernetesLease, now time.Time, acquire bool) {
+	seconds := int(math.Ceil(l.lease.Seconds()))
+	lease.Spec.HolderIdentity = &l.instanceID
+	lease.Spec.LeaseDurationSeconds = &seconds
+	lease.Spec.RenewTime = now.UTC().Format(leaseTimeLayout)
+	if acquire {
+		lease.Spec.AcquireTime = lease.Spec.RenewTime
+		lease.Spec.LeaseTransitions++
+	}
+}
+
+// get reads the lease, nil when it does not exist yet
+func (l *kubernetesLeaderLock) get(ctx context.Context) (*kubernetesLease, error) {
+	resp, err := l.do(ctx, http.MethodGet, l.url+"/"+l.name, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	switch resp.StatusCode {
+	case http.StatusOK:
+	case http.StatusNotFound:
+		return nil, nil
+	default:
+		return nil, leaseAPIError("getting", l.name, resp)
+	}
+	var lease kubernetesLease
+	if err := json.NewDecoder(resp.Body).Decode(&lease); err != nil {
+		return nil, fmt.Errorf("error decoding lease %s: %w", l.name, err)
+	}
+	return &lease, nil
+}
+
+// write creates or updates the lease; errLeaseConflict when another replica
+// wrote it first
+func (l *kubernetesLeaderLock) write(ctx context.Context, method, url string, lease *kubernetesLease) error {
+	body, err := json.Marshal(lease)
+	if err != nil {
+		return fmt.Errorf("error marshaling lease %s: %w", l.name, err)
+	}
+	resp, err := l.do(ctx, method, url, body)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	switch resp.StatusCode {
+	case http.StatusOK, http.StatusCreated:
+		return nil
+	case http.StatusConflict:
+		return errLeaseConflict
+	default:
+		return leaseAPIError("writing", l.name, resp)
+	}
+}
+
+func (l *kubernetesLeaderLock) do(ctx context.Context, method, url string, body []byte) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, method, url, bytes.NewReader(body))
+	if err != nil {
+		return nil, fmt.Errorf("error building lease request: %w", err)
+	}
+	// The kubelet rotates the projected token in place
+	token, err := os.ReadFile(serviceAccountDir + "/token")
+	if err != nil {
+		return nil, fmt.Errorf("error reading service account token: %w", err)
+	}
+	req.Header.Set("Authorization", "Bearer "+strings.TrimSpace(string(token)))
+	req.Header.Set("Accept", "application/json")
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	resp, err := l.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("error calling the Kubernetes API: %w", err)
+	}
+	return resp, nil
+}
+
+func leaseAPIError(action, name string, resp *http.Response) error {
+	message, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+	return fmt.Errorf("error %s lease %s: %s: %s", action, name, resp.Status, bytes.TrimSpace(message))
+}
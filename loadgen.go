@@ -0,0 +1,207 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"log/slog"
+	"math/rand"
+	"os"
+	"os/signal"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"syscall"
+	"text/template"
+	"time"
+
+	"challenge-4-orchestrator/config"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/sqs"
+	"github.com/aws/aws-sdk-go-v2/service/sqs/types"
+)
+
+// defaultLoadTemplate is the payload sent when no -template is given
+const defaultLoadTemplate = `{"id": "{{.ID}}", "sequence": {{.Sequence}}, "timestamp": "{{.Timestamp}}", "value": {{randInt 1 1000}}, "note": "{{randString 16}}"}`
+
+// LoadMessage is the data of a load generator payload template
+type LoadMessage struct {
+	ID        string
+	Sequence  int64
+	Timestamp string
+}
+
+var loadTemplateFuncs = template.FuncMap{
+	"randInt": func(low, high int) int { return low + rand.Intn(high-low+1) },
+	"randString": func(n int) string {
+		const letters = "abcdefghijklmnopqrstuvwxyz0123456789"
+		b := make([]byte, n)
+		for i := range b {
+			b[i] = letters[rand.Intn(len(letters))]
+		}
+		return string(b)
+	},
+}
+
+// loadPayload renders one message and signs it: hashField is set to the
+// hex SHA-256 of the JSON encoding of the other fields, or to a wrong hash
+// when invalid is set
+func loadPayload(tmpl *template.Template, data LoadMessage, hashField string, invalid bool) ([]byte, error) {
+	var rendered bytes.Buffer
+	if err := tmpl.Execute(&rendered, data); err != nil {
+		return nil, fmt.Errorf("error rendering payload template: %w", err)
+	}
+	var fields map[string]any
+	if err := json.Unmarshal(rendered.Bytes(), &fields); err != nil {
+		return nil, fmt.Errorf("payload template must render a JSON object: %w", err)
+	}
+	delete(fields, hashField)
+
+	hash, err := payloadHash(fields)
+	if err != nil {
+		return nil, err
+	}
+	if invalid {
+		hash = strings.Repeat("0", len(hash))
+	}
+	fields[hashField] = hash
+	return json.Marshal(fields)
+}
+
+// payloadHash is the hex SHA-256 of the JSON encoding of fields. encoding/json
+// sorts the keys, so the hash does not depend on the field order.
+func payloadHash(fields map[string]any) (string, error) {
+	canonical, err := json.Marshal(fields)
+	if err != nil {
+		return "", fmt.Errorf("error encoding payload: %w", err)
+	}
+	sum := sha256.Sum256(canonical)
+	return hex.EncodeToString(sum[:]), nil
+}
+
+// runLoadgen implements `orchestrator loadgen`
+func runLoadgen(args []string) error {
+	flags := flag.NewFlagSet("loadgen", flag.ExitOnError)
+	configFile := flags.String("config", os.Getenv("CONFIG_FILE"), "YAML or JSON configuration file")
+	queueURL := flags.String("queue-url", "", "queue receiving the messages; defaults to the first consumer queue")
+	rate := flags.Float64("rate", 10, "messages sent per second")
+	duration := flags.Duration("duration", time.Minute, "how long to send messages")
+	templateFile := flags.String("template", "", "Go template rendering a JSON object per message; a built-in payload when empty")
+	hashField := flags.String("hash-field", "hash", "field set to the SHA-256 of the other fields")
+	invalidRate := flags.Float64("invalid", 0, "fraction of messages, from 0 to 1, sent with a wrong hash")
+	workers := flags.Int("workers", 8, "concurrent senders")
+	flags.Parse(args)
+
+	if *rate <= 0 || *duration <= 0 || *workers < 1 {
+		return errors.New("-rate and -duration must be positive and -workers at least 1")
+	}
+	if *invalidRate < 0 || *invalidRate > 1 {
+		return errors.New("-invalid must be between 0 and 1")
+	}
+
+	cfg, err := config.Load(*configFile, checkSettings)
+	if err != nil {
+		return err
+	}
+	if *queueURL == "" {
+		if queues := cfg.Consumer.SQSQueues(); len(queues) > 0 {
+			*queueURL = queues[0].URL
+		}
+	}
+
+	source := defaultLoadTemplate
+	if *templateFile != "" {
+		content, err := os.ReadFile(*templateFile)
+		if err != nil {
+			return fmt.Errorf("error reading template: %w", err)
+		}
+		source = string(content)
+	}
+	tmpl, err := template.New("payload").Funcs(loadTemplateFuncs).Parse(source)
+	if err != nil {
+		return fmt.Errorf("error parsing template: %w", err)
+	}
+	// Fail before sending anything when the template is unusable
+	if _, err := loadPayload(tmpl, LoadMessage{ID: newCorrelationID(), Timestamp: time.Now().UTC().Format(time.RFC3339Nano)}, *hashField, false); err != nil {
+		return err
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	ctx, cancel := context.WithTimeout(ctx, *duration)
+	defer cancel()
+
+	awsCfg, err := config.NewAWSConfig(ctx, cfg.Region, cfg.AWS)
+	if err != nil {
+		return err
+	}
+	client := sqs.NewFromConfig(awsCfg, func(o *sqs.Options) {
+		if endpoint := awsEndpoint("SQS"); endpoint != "" {
+			o.BaseEndpoint = aws.String(endpoint)
+		}
+	})
+
+	slog.Info("Generating load", "queue_url", *queueURL, "rate", *rate, "duration", duration.String(), "invalid", *invalidRate)
+	fifo := strings.HasSuffix(*queueURL, ".fifo")
+	limiter := newTokenBucket(*rate, 1)
+	var sequence, sent, invalid, failed atomic.Int64
+	started := time.Now()
+
+	var wg sync.WaitGroup
+	for range *workers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for limiter.Wait(ctx) == nil {
+				data := LoadMessage{
+					ID:        newCorrelationID(),
+					Sequence:  sequence.Add(1),
+					Timestamp: time.Now().UTC().Format(time.RFC3339Nano),
+				}
+				bad := rand.Float64() < *invalidRate
+				body, err := loadPayload(tmpl, data, *hashField, bad)
+				if err == nil {
+					input := &sqs.SendMessageInput{
+						QueueUrl:    queueURL,
+						MessageBody: aws.String(string(body)),
+						MessageAttributes: map[string]types.MessageAttributeValue{
+							"loadgen": {DataType: aws.String("String"), StringValue: aws.String("true")},
+						},
+					}
+					if fifo {
+						input.MessageGroupId = aws.String(data.ID)
+						input.MessageDeduplicationId = aws.String(data.ID)
+					}
+					_, err = client.SendMessage(ctx, input)
+				}
+				switch {
+				case ctx.Err() != nil:
+					return
+				case err != nil:
+					failed.Add(1)
+					slog.Error("Error sending load message", "sequence", data.Sequence, errAttr(err))
+				case bad:
+					invalid.Add(1)
+					sent.Add(1)
+				default:
+					sent.Add(1)
+				}
+			}
+		}()
+	}
+	wg.Wait()
+
+	elapsed := time.Since(started)
+	fmt.Printf("sent: %d (invalid hash: %d), failed: %d, elapsed: %s, rate: %.1f/s\n",
+		sent.Load(), invalid.Load(), failed.Load(), elapsed.Round(time.Millisecond), float64(sent.Load())/elapsed.Seconds())
+	if failed.Load() > 0 {
+		return fmt.Errorf("%d messages could not be sent", failed.Load())
+	}
+	return nil
+}
@@ -0,0 +1,157 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Log field names are kept stable across the codebase so CloudWatch Logs
+// Insights queries can rely on them: message_id, lambda_arn, attempt,
+// duration_ms and error.
+
+var logLevel = new(slog.LevelVar)
+
+// logLevelRevert holds the pending auto-revert of a runtime level change
+var logLevelRevert struct {
+	mu    sync.Mutex
+	timer *time.Timer
+	until time.Time
+	// original is the level restored by the pending revert
+	original slog.Level
+	// generation invalidates a revert whose timer fired while being replaced
+	generation uint64
+}
+
+// initLogging installs the default slog logger, honouring LOG_LEVEL
+// (debug, info, warn, error; info by default) and LOG_FORMAT (text or json)
+func initLogging() {
+	if value := os.Getenv("LOG_LEVEL"); value != "" {
+		level, err := parseLogLevel(value)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Invalid LOG_LEVEL %q, using info\n", value)
+		} else {
+			logLevel.Set(level)
+		}
+	}
+
+	var handler slog.Handler
+	switch format := strings.ToLower(os.Getenv("LOG_FORMAT")); format {
+	case "json":
+		handler = slog.NewJSONHandler(os.Stderr, &slog.HandlerOptions{
+			Level:       logLevel,
+			ReplaceAttr: jsonLogAttr,
+		})
+	case "", "text":
+		handler = slog.NewTextHandler(os.Stderr, &slog.HandlerOptions{Level: logLevel})
+	default:
+		fmt.Fprintf(os.Stderr, "Invalid LOG_FORMAT %q, using text\n", format)
+		handler = slog.NewTextHandler(os.Stderr, &slog.HandlerOptions{Level: logLevel})
+	}
+	slog.SetDefault(slog.New(handler))
+}
+
+// jsonLogAttr renames the built-in keys to timestamp, severity and message,
+// with UTC RFC3339 timestamps, as expected by the log pipeline
+func jsonLogAttr(groups []string, a slog.Attr) slog.Attr {
+	if len(groups) > 0 {
+		return a
+	}
+	switch a.Key {
+	case slog.TimeKey:
+		return slog.String("timestamp", a.Value.Time().UTC().Format(time.RFC3339Nano))
+	case slog.LevelKey:
+		return slog.String("severity", a.Value.String())
+	case slog.MessageKey:
+		return slog.Attr{Key: "message", Value: a.Value}
+	}
+	return a
+}
+
+func parseLogLevel(value string) (slog.Level, error) {
+	var level slog.Level
+	err := level.UnmarshalText([]byte(strings.ToUpper(strings.TrimSpace(value))))
+	return level, err
+}
+
+// setLogLevel changes the level at runtime. With a positive revertAfter the
+// level is restored once it elapses; any pending revert is replaced, but
+// still restores the level from before the first temporary change.
+func setLogLevel(level slog.Level, revertAfter time.Duration) {
+	logLevelRevert.mu.Lock()
+	defer logLevelRevert.mu.Unlock()
+
+	previous := logLevel.Level()
+	original := previous
+	logLevelRevert.generation++
+	if logLevelRevert.timer != nil {
+		logLevelRevert.timer.Stop()
+		logLevelRevert.timer = nil
+		logLevelRevert.until = time.Time{}
+		original = logLevelRevert.original
+	}
+
+	logLevel.Set(level)
+	slog.Info("Log level changed", "level", level.String(), "previous", previous.String())
+
+	if revertAfter > 0 {
+		generation := logLevelRevert.generation
+		logLevelRevert.original = original
+		logLevelRevert.until = time.Now().Add(revertAfter)
+		logLevelRevert.timer = time.AfterFunc(revertAfter, func() {
+			logLevelRevert.mu.Lock()
+			defer logLevelRevert.mu.Unlock()
+			if logLevelRevert.generation != generation {
+				return
+			}
+			logLevel.Set(original)
+			logLevelRevert.timer = nil
+			logLevelRevert.until = time.Time{}
+			slog.Info("Log level reverted", "level", original.String())
+		})
+	}
+}
+
+// revertLogLevelAt returns when the current level will be reverted, or the
+// zero time if the change is permanent
+func revertLogLevelAt() time.Time {
+	logLevelRevert.mu.Lock()
+	defer logLevelRevert.mu.Unlock()
+	return logLevelRevert.until
+}
+
+type loggerKey struct{}
+
+// withLogger stores a logger carrying per-message fields in the context
+func withLogger(ctx context.Context, logger *slog.Logger) context.Context {
+	return context.WithValue(ctx, loggerKey{}, logger)
+}
+
+// loggerFrom returns the context logger, or the default one
+func loggerFrom(ctx context.Context) *slog.Logger {
+	if logger, ok := ctx.Value(loggerKey{}).(*slog.Logger); ok {
+		return logger
+	}
+	return slog.Default()
+}
+
+func errAttr(err error) slog.Attr {
+	if err == nil {
+		return slog.String("error", "")
+	}
+	return slog.String("error", err.Error())
+}
+
+func durationAttr(d time.Duration) slog.Attr {
+	return slog.Int64("duration_ms", d.Milliseconds())
+}
+
+// fatal logs at error level and exits, replacing log.Fatalf
+func fatal(msg string, args ...any) {
+	slog.Error(msg, args...)
+	os.Exit(1)
+}
@@ -2,49 +2,815 @@ package main
 
 import (
 	"context"
-	"log"
+	"crypto/tls"
+	"errors"
+	"flag"
+	"log/slog"
+	"net/http"
 	"os"
 	"os/signal"
+	"sync"
 	"syscall"
 	"time"
+
+	"challenge-4-orchestrator/config"
+
+	"google.golang.org/grpc"
+)
+
+// Build metadata, injected at build time with
+// -ldflags "-X main.Version=... -X main.Commit=... -X main.BuildDate=..."
+var (
+	Version   = "dev"
+	Commit    = ""
+	BuildDate = ""
 )
 
 func main() {
-	// Configuration
-	queueURL := os.Getenv("SQS_QUEUE_URL")
-	if queueURL == "" {
-		log.Fatal("SQS_QUEUE_URL environment variable is required")
-	}
+	initLogging()
 
-	region := os.Getenv("AWS_REGION")
-	if region == "" {
-		region = "us-east-1"
+	if err := runCLI(os.Args[1:]); err != nil {
+		fatal("Command failed", errAttr(err))
 	}
+}
 
-	healthPort := os.Getenv("HEALTH_PORT")
-	if healthPort == "" {
-		healthPort = "8080"
+// runOrchestrator implements `orchestrator run`, the default command
+func runOrchestrator(args []string) error {
+	flags := flag.NewFlagSet("run", flag.ExitOnError)
+	configFile := flags.String("config", os.Getenv("CONFIG_FILE"), "YAML or JSON configuration file")
+	chaos := flags.Bool("chaos", false, "inject the faults configured under chaos, for resilience testing only")
+	provision := flags.Bool("provision", false, "create the missing queues and tables and enable their TTL at startup, for dev environments")
+	flags.Parse(args)
+
+	cfg, err := config.Load(*configFile, checkSettings)
+	if err != nil {
+		fatal("Invalid configuration", errAttr(err))
 	}
+	slog.Info("Effective configuration", "settings", cfg.Summary())
+	instanceID := newInstanceID()
 
-	// Start health check server
-	healthServer := startHealthServer(healthPort)
+	shutdownTracing, err := initTracing(context.Background())
+	if err != nil {
+		fatal("Failed to initialize tracing", errAttr(err))
+	}
 
-	// Start dynamoDB client
-	client, err := NewDynamoDBClient("ServiceState", region)
+	// One AWS config for every client, with cross-account roles for the
+	// registry table and the worker Lambdas
+	awsCfg, err := config.NewAWSConfig(context.Background(), cfg.Region, cfg.AWS)
 	if err != nil {
-		log.Fatalf("Failed to create DynamoDB client: %v", err)
+		fatal("Failed to load AWS config", errAttr(err))
+	}
+	// Chaos mode never turns on from configuration alone
+	switch {
+	case *chaos:
+		NewChaos(cfg.Chaos).Apply(&awsCfg)
+		slog.Warn("CHAOS MODE ENABLED: injecting faults into AWS calls", "chaos", true,
+			"latency_rate", cfg.Chaos.LatencyRate, "max_latency", cfg.Chaos.MaxLatency.String(),
+			"lambda_error_rate", cfg.Chaos.LambdaErrorRate, "dynamodb_error_rate", cfg.Chaos.DynamoDBErrorRate)
+	case cfg.Chaos.Enabled():
+		slog.Info("Chaos settings ignored without the -chaos flag")
+	}
+	registryCfg := withAssumedRole(awsCfg, cfg.Registry.RoleARN, cfg.Registry.ExternalID)
+	lambdaCfg := withAssumedRole(awsCfg, cfg.Router.LambdaRoleARN, cfg.Router.LambdaExternalID)
+
+	// Queues and tables, created with -provision
+	if err := checkResources(context.Background(), cfg, awsCfg, registryCfg, *provision); err != nil {
+		fatal("Startup resource check failed", errAttr(err))
+	}
+
+	// Start dynamoDB client, reading through DAX when a cluster is configured
+	var client *DynamoDBClient
+	if cfg.Registry.DAXEndpoint != "" {
+		slog.Info("Registry reads routed through DAX", "endpoint", cfg.Registry.DAXEndpoint)
+		client, err = NewDynamoDBClientWithDAX(cfg.Registry.Table, cfg.Registry.DAXEndpoint, registryCfg)
+		if err != nil {
+			fatal("Failed to create DynamoDB client", errAttr(err))
+		}
+	} else {
+		client = NewDynamoDBClient(cfg.Registry.Table, registryCfg)
+	}
+
+	failover := FailoverOptions{Threshold: cfg.Failover.Threshold, FailbackAfter: cfg.Failover.FailbackAfter}
+	if cfg.Registry.SecondaryRegion != "" {
+		client.EnableFailover(registryCfg, cfg.Registry.SecondaryRegion, failover)
+		slog.Info("Registry failover enabled", "secondary_region", cfg.Registry.SecondaryRegion)
+	}
+
+	registry := NewLambdaRegistry(client, RegistryOptions{
+		TTLGrace:        cfg.Registry.TTLGrace,
+		StatusIndex:     cfg.Registry.StatusIndex,
+		ConsistentReads: cfg.Registry.ConsistentReads,
+	})
+	if cfg.Registry.TTLGrace > 0 {
+		checkTTL(context.Background(), client, "registry.table", *provision)
+	}
+
+	// CloudEvents envelope of the received and sent messages
+	var cloudEvents *CloudEvents
+	if cfg.CloudEvents.Accept || cfg.CloudEvents.Emit {
+		cloudEvents = NewCloudEvents(CloudEventsOptions{
+			Accept:     cfg.CloudEvents.Accept,
+			Emit:       cfg.CloudEvents.Emit,
+			Source:     cfg.CloudEvents.Source,
+			TypePrefix: cfg.CloudEvents.TypePrefix,
+			TypeField:  cfg.Workflows.TypeField,
+		})
+	}
+
+	// Protobuf payloads decoded with the registered descriptors
+	var protobufCodec *ProtobufCodec
+	if cfg.Protobuf.DescriptorSet != "" {
+		protobufCodec, err = NewProtobufCodec(ProtobufOptions{
+			DescriptorSet: cfg.Protobuf.DescriptorSet,
+			TypeAttribute: cfg.Protobuf.TypeAttribute,
+			DefaultType:   cfg.Protobuf.DefaultType,
+			Forward:       cfg.Protobuf.Forward,
+		})
+		if err != nil {
+			fatal("Failed to load protobuf descriptors", errAttr(err))
+		}
+	}
+
+	// JSON Schema per message type, and the queue of the invalid messages
+	var schemas *SchemaRegistry
+	if cfg.Schemas.Location != "" {
+		schemas, err = NewSchemaRegistry(context.Background(), cfg.Schemas.Location, cfg.Workflows.TypeField, awsCfg)
+		if err != nil {
+			fatal("Failed to load message schemas", errAttr(err))
+		}
+	}
+	var quarantine *QuarantineQueue
+	if cfg.Schemas.QuarantineQueueURL != "" {
+		quarantine = NewQuarantineQueue(cfg.Schemas.QuarantineQueueURL, awsCfg, instanceID)
+	}
+
+	// Slack/webhook notifications for operational events
+	var notifier *WebhookNotifier
+	if cfg.Alerts.WebhookURL != "" {
+		notifier, err = NewWebhookNotifier(cfg.Alerts.WebhookURL, instanceID, cfg.Alerts.WebhookTemplatesFile, cfg.Alerts.WebhookRateLimit, cloudEvents)
+		if err != nil {
+			fatal("Failed to create webhook notifier", errAttr(err))
+		}
+		registry.OnStatusChange(func(lambda Lambda, previous Status) {
+			notifier.Notify(EventHealthChanged, map[string]string{
+				"id":       lambda.ID,
+				"arn":      lambda.ARN,
+				"status":   string(lambda.Status),
+				"previous": string(previous),
+			})
+		})
 	}
 
 	// Start Lambda client
-	lambdaClient, err := NewLambdaClient(region)
+	lambdaClient := NewLambdaClient(lambdaCfg)
+	lambdaClient.EnableFailover(failover)
+	lambdaClient.TrackColdStarts(NewColdStartTracker(ColdStartOptions{
+		LogTail:  cfg.Metrics.ColdStartLogTail,
+		Factor:   cfg.Metrics.ColdStartFactor,
+		MinExtra: cfg.Metrics.ColdStartMinExtra,
+	}))
+
+	// Registry reconciliation against the Lambda control plane
+	var reconciler *Reconciler
+	if cfg.Registry.ReconcileInterval > 0 {
+		reconciler = NewReconciler(registry, lambdaClient)
+	}
+
+	// Demotion of Lambdas that stopped sending heartbeats
+	var heartbeatMonitor *HeartbeatMonitor
+	if cfg.Registry.HeartbeatFreshness > 0 {
+		heartbeatMonitor = NewHeartbeatMonitor(registry, cfg.Registry.HeartbeatFreshness)
+	}
+
+	// Tag-based discovery of worker Lambdas
+	var discoverer *Discoverer
+	if cfg.Registry.DiscoveryTag != "" {
+		discoverer, err = NewDiscoverer(registry, lambdaCfg, cfg.Registry.DiscoveryTag)
+		if err != nil {
+			fatal("Failed to create Lambda discoverer", errAttr(err))
+		}
+	}
+
+	// Admin API, mounted on the health server when a key is configured
+	var routes []func(*http.ServeMux)
+	adminAuth, adminAPIKey, err := adminAuthFromConfig(cfg.Server)
 	if err != nil {
-		log.Fatalf("Failed to create Lambda client: %v", err)
+		fatal("Invalid admin authentication config", errAttr(err))
+	}
+	var eventStream *EventStream
+	if adminAuth != nil {
+		// Live processing events for operators, on /admin/events
+		eventStream = NewEventStream(instanceID)
+		registry.OnStatusChange(eventStream.PublishHealthChange)
+
+		admin := NewAdminAPI(registry, reconciler, eventStream, adminAuth)
+		routes = append(routes, admin.Register)
+		if cfg.Server.Pprof {
+			routes = append(routes, admin.RegisterProfiling)
+			slog.Info("pprof endpoints enabled under /debug/pprof/")
+		}
+	} else {
+		slog.Info("No admin API key or IAM principals configured, admin endpoints disabled")
+	}
+
+	// Exactly-once processing is enabled by configuring the markers table
+	var dedup *DedupStore
+	if cfg.Consumer.ExactlyOnceTable != "" {
+		dedupClient := NewDynamoDBClient(cfg.Consumer.ExactlyOnceTable, awsCfg)
+		dedup = NewDedupStore(dedupClient, instanceID, 5*time.Minute, 24*time.Hour)
+		slog.Info("Exactly-once processing enabled", "table", cfg.Consumer.ExactlyOnceTable)
+	}
+
+	// Multi-step workflows per message type, with their state in DynamoDB
+	var workflows *WorkflowEngine
+	if cfg.Workflows.Table != "" {
+		workflowClient := NewDynamoDBClient(cfg.Workflows.Table, awsCfg)
+		workflows = NewWorkflowEngine(workflowClient, lambdaClient, instanceID, WorkflowOptions{
+			TypeField:   cfg.Workflows.TypeField,
+			StateTTL:    cfg.Workflows.StateTTL,
+			Definitions: cfg.Workflows.Definitions,
+		})
+		if err := workflows.LoadDefinitions(context.Background()); err != nil {
+			fatal("Failed to load workflow definitions", errAttr(err))
+		}
+		checkTTL(context.Background(), workflowClient, "workflows.table", *provision)
+	}
+
+	// CloudWatch Embedded Metric Format, written to stdout next to the logs
+	var emf *EMFEmitter
+	if cfg.Metrics.EMF {
+		emf = NewEMFEmitter(cfg.Metrics.EMFNamespace, os.Stdout, cfg.Metrics.EMFFlushInterval)
+	}
+
+	// Routing decisions are always logged, and also streamed when configured
+	var routingAudit *KinesisRoutingAudit
+	if cfg.Router.AuditStream != "" {
+		routingAudit = NewKinesisRoutingAudit(cfg.Router.AuditStream, awsCfg)
+	}
+
+	// SNS alerts on critical conditions, throttled per alert type
+	var alerter *SNSAlerter
+	if cfg.Alerts.SNSTopicARN != "" {
+		alerter = NewSNSAlerter(cfg.Alerts.SNSTopicARN, awsCfg, instanceID, cfg.Alerts.Cooldown)
+	}
+
+	// Feature flags consulted at the integrity and routing decisions
+	var featureFlags *Flags
+	if cfg.Flags.Table != "" {
+		featureFlags = NewFlags(NewDynamoDBClient(cfg.Flags.Table, awsCfg), alerter, FlagsOptions{
+			AllowIntegrityBypass: cfg.Flags.AllowIntegrityBypass,
+		})
+	}
+
+	// Routing rules changed without a redeploy
+	var routingRules *RoutingRules
+	if cfg.Router.RulesTable != "" {
+		routingRules = NewRoutingRules(NewDynamoDBClient(cfg.Router.RulesTable, awsCfg), cfg.Workflows.TypeField)
+	}
+
+	// Message types every healthy worker receives; routing rules may fan out
+	// other messages with the same threshold
+	fanOut := NewFanOut(cfg.Router.FanOutTypes, cfg.Workflows.TypeField, cfg.Router.FanOutSuccessThreshold)
+
+	// Workers failing too often leave routing for a probation period
+	var eviction *EvictionTracker
+	if cfg.Router.Eviction.ErrorRate > 0 {
+		eviction = NewEvictionTracker(EvictionOptions(cfg.Router.Eviction))
+		if notifier != nil {
+			eviction.OnEvict(func(arn, reason string) {
+				notifier.Notify(EventCircuitOpened, map[string]string{"arn": arn, "reason": reason})
+			})
+		}
+	}
+
+	// Message types verified by the majority of several workers
+	var quorum *Quorum
+	if len(cfg.Router.Quorum) > 0 {
+		quorum = NewQuorum(cfg.Router.Quorum, cfg.Workflows.TypeField, registry)
+	}
+
+	// Forwarding of worker responses to the next pipeline stage
+	var outputQueue *OutputQueue
+	if cfg.Consumer.OutputQueueURL != "" {
+		outputQueue = NewOutputQueue(cfg.Consumer.OutputQueueURL, awsCfg, instanceID, cloudEvents)
+	}
+	var transforms *ResponseTransformer
+	if len(cfg.Transforms.Types) > 0 {
+		transforms, err = NewResponseTransformer(cfg.Transforms.Types, cfg.Workflows.TypeField)
+		if err != nil {
+			fatal("Failed to load response transforms", errAttr(err))
+		}
+	}
+
+	// Lifecycle events for rules and automation in other teams
+	var events *EventPublisher
+	if cfg.Events.BusName != "" {
+		events = NewEventPublisher(cfg.Events.BusName, cfg.Events.Source, awsCfg, instanceID)
+	}
+
+	// Retention of the raw payloads for compliance
+	var archiver *S3Archiver
+	if cfg.Archive.Bucket != "" {
+		archiver = NewS3Archiver(awsCfg, instanceID, ArchiveOptions{
+			Bucket:        cfg.Archive.Bucket,
+			Prefix:        cfg.Archive.Prefix,
+			BatchSize:     cfg.Archive.BatchSize,
+			FlushInterval: cfg.Archive.FlushInterval,
+		})
+	}
+
+	// Custom handlers share the message type field of the workflows
+	handlers := NewHandlerRegistry(cfg.Workflows.TypeField)
+	registerHandlers(handlers)
+	if types := handlers.Types(); len(types) > 0 {
+		slog.Info("Custom message handlers registered", "types", types)
+	}
+
+	// Per-tenant limits and pinning
+	var tenants *TenantIsolation
+	if cfg.Tenants.Field != "" {
+		tenants = NewTenantIsolation(cfg.Tenants.Field, config.TenantLimits{
+			MaxInFlight: cfg.Tenants.MaxInFlight,
+			MaxRate:     cfg.Tenants.MaxRate,
+		}, cfg.Tenants.Overrides)
+	}
+
+	// Last error of each failed message, for `orchestrator dlq`
+	orchestratorClient := NewDynamoDBClient(cfg.Consumer.StateTable, awsCfg)
+	var failures *FailureLog
+	if cfg.Consumer.FailureRetention > 0 {
+		failures = NewFailureLog(orchestratorClient, instanceID, cfg.Consumer.FailureRetention)
+		checkTTL(context.Background(), orchestratorClient, "consumer.stateTable", *provision)
+	}
+
+	// Scale-in protection of the ECS task while messages are in flight
+	var protection *TaskProtection
+	if cfg.Consumer.TaskProtection {
+		protection, err = NewTaskProtection(cfg.Consumer.TaskProtectionExpiry)
+		if err != nil {
+			fatal("Failed to set up ECS task protection", errAttr(err))
+		}
+	}
+
+	// Estimated spend on the workers
+	var costs *CostTracker
+	if cfg.Costs.Enabled || cfg.Budget.Enabled() {
+		costs = NewCostTracker(lambdaClient, CostOptions{
+			PricePerGBSecond: cfg.Costs.PricePerGBSecond,
+			PricePerRequest:  cfg.Costs.PricePerRequest,
+			TypeField:        cfg.Workflows.TypeField,
+		})
+	}
+
+	// Slower polling and only the critical types while over a budget
+	var spendGuard *SpendGuard
+	if cfg.Budget.Enabled() {
+		spendGuard = NewSpendGuard(costs, alerter, BudgetOptions{
+			HourlyUSD:         cfg.Budget.HourlyUSD,
+			DailyUSD:          cfg.Budget.DailyUSD,
+			HourlyInvocations: cfg.Budget.HourlyInvocations,
+			DailyInvocations:  cfg.Budget.DailyInvocations,
+			CriticalTypes:     cfg.Budget.CriticalTypes,
+			PollDelay:         cfg.Budget.PollDelay,
+			CheckInterval:     cfg.Budget.CheckInterval,
+		})
+	}
+
+	// Several messages per worker invocation
+	var batcher *Batcher
+	if cfg.Router.BatchSize > 0 {
+		batcher = NewBatcher(lambdaClient, costs, cfg.Router.BatchSize, cfg.Router.BatchWindow)
 	}
 
 	// Create consumer
-	consumer, err := NewSQSConsumer(queueURL, region, client, lambdaClient)
-	if err != nil {
-		log.Fatalf("Failed to create SQS consumer: %v", err)
+	consumer := NewSQSConsumer(cfg.Consumer.QueueURL, awsCfg, registry, lambdaClient, ConsumerOptions{
+		IntegrityLambda:   cfg.Consumer.IntegrityLambda,
+		Dedup:             dedup,
+		Metrics:           emf,
+		Audit:             routingAudit,
+		Alerts:            alerter,
+		Flags:             featureFlags,
+		Output:            outputQueue,
+		Transforms:        transforms,
+		Events:            events,
+		Stream:            eventStream,
+		Archive:           archiver,
+		Workflows:         workflows,
+		StateMachines:     NewStepFunctionsClient(lambdaCfg, cfg.Router.StepFunctionsPollInterval),
+		Handlers:          handlers,
+		Failures:          failures,
+		Tenants:           tenants,
+		CloudEvents:       cloudEvents,
+		Protobuf:          protobufCodec,
+		Schemas:           schemas,
+		Quarantine:        quarantine,
+		Rules:             routingRules,
+		FanOut:            fanOut,
+		Quorum:            quorum,
+		Eviction:          eviction,
+		AdaptiveWeights:   cfg.Router.AdaptiveWeights,
+		Protection:        protection,
+		BarePayloads:      !cfg.Consumer.CorrelationPayload,
+		Queues:            cfg.Consumer.Queues,
+		StarvationTimeout: cfg.Consumer.StarvationTimeout,
+		Pollers:           cfg.Consumer.MinPollers,
+		Batcher:           batcher,
+		Costs:             costs,
+		Budget:            spendGuard,
+		MaxRate:           cfg.Consumer.MaxRate,
+		RoutingStrategy:   cfg.Consumer.RoutingStrategy,
+	})
+
+	// Orchestrator heartbeat, for dashboards, the handoff and sharding
+	var heartbeat *Heartbeater
+	if cfg.Consumer.HeartbeatInterval > 0 {
+		heartbeat = NewHeartbeater(orchestratorClient, consumer, instanceID, cfg.Consumer.HeartbeatInterval)
+	}
+
+	// Singleton jobs run only on the elected replica
+	var elector *LeaderElector
+	if cfg.Consumer.LeaderLease > 0 {
+		if cfg.Consumer.LeaderBackend == config.LeaderBackendKubernetes {
+			elector, err = NewKubernetesLeaderElector(cfg.Consumer.LeaderLeaseName, instanceID, cfg.Consumer.LeaderLease)
+			if err != nil {
+				fatal("Failed to set up Kubernetes leader election", errAttr(err))
+			}
+		} else {
+			elector = NewLeaderElector(orchestratorClient, instanceID, cfg.Consumer.LeaderLease)
+		}
+	}
+
+	// Kafka (MSK) source next to the SQS queue
+	var kafkaSource *KafkaSource
+	if len(cfg.Kafka.Brokers) > 0 {
+		kafkaSource, err = NewKafkaSource(consumer, KafkaOptions{
+			Brokers:      cfg.Kafka.Brokers,
+			Topics:       cfg.Kafka.Topics,
+			GroupID:      cfg.Kafka.GroupID,
+			TLS:          cfg.Kafka.TLS,
+			Username:     cfg.Kafka.Username,
+			Password:     cfg.Kafka.Password,
+			MaxAttempts:  cfg.Kafka.MaxAttempts,
+			RetryBackoff: cfg.Kafka.RetryBackoff,
+		})
+		if err != nil {
+			fatal("Failed to create Kafka source", errAttr(err))
+		}
+	}
+
+	// Kinesis Data Streams source, with shard leases in the lease table
+	var kinesisSource *KinesisSource
+	if cfg.Kinesis.Stream != "" {
+		leaseTable := cfg.Kinesis.LeaseTable
+		if leaseTable == "" {
+			leaseTable = cfg.Consumer.StateTable
+		}
+		kinesisSource = NewKinesisSource(consumer, awsCfg, NewDynamoDBClient(leaseTable, awsCfg), instanceID, KinesisOptions{
+			Stream:        cfg.Kinesis.Stream,
+			BatchSize:     cfg.Kinesis.BatchSize,
+			PollInterval:  cfg.Kinesis.PollInterval,
+			LeaseDuration: cfg.Kinesis.LeaseDuration,
+			MaxAttempts:   cfg.Kinesis.MaxAttempts,
+			RetryBackoff:  cfg.Kinesis.RetryBackoff,
+		})
+	}
+
+	// RabbitMQ source for the on-prem producers
+	var rabbitSource *RabbitMQSource
+	if cfg.RabbitMQ.URL != "" {
+		rabbitSource = NewRabbitMQSource(consumer, instanceID, RabbitMQOptions{
+			URL:            cfg.RabbitMQ.URL,
+			Queue:          cfg.RabbitMQ.Queue,
+			Prefetch:       cfg.RabbitMQ.Prefetch,
+			ReconnectDelay: cfg.RabbitMQ.ReconnectDelay,
+			MaxAttempts:    cfg.RabbitMQ.MaxAttempts,
+			RetryBackoff:   cfg.RabbitMQ.RetryBackoff,
+		})
+	}
+
+	// NATS JetStream source
+	var natsSource *NATSSource
+	if cfg.NATS.URL != "" {
+		natsSource, err = NewNATSSource(context.Background(), consumer, instanceID, NATSOptions{
+			URL:             cfg.NATS.URL,
+			CredentialsFile: cfg.NATS.CredentialsFile,
+			Stream:          cfg.NATS.Stream,
+			Consumer:        cfg.NATS.Consumer,
+			Subject:         cfg.NATS.Subject,
+			BatchSize:       cfg.NATS.BatchSize,
+			AckWait:         cfg.NATS.AckWait,
+			MaxDeliver:      cfg.NATS.MaxDeliver,
+			RetryBackoff:    cfg.NATS.RetryBackoff,
+		})
+		if err != nil {
+			fatal("Failed to create JetStream source", errAttr(err))
+		}
+	}
+
+	// Relay of the DynamoDB outbox written by other services
+	var outboxSource *OutboxSource
+	if cfg.Outbox.Table != "" {
+		outboxSource = NewOutboxSource(consumer, NewDynamoDBClient(cfg.Outbox.Table, awsCfg), instanceID, OutboxOptions{
+			StatusIndex:  cfg.Outbox.StatusIndex,
+			BatchSize:    cfg.Outbox.BatchSize,
+			PollInterval: cfg.Outbox.PollInterval,
+			ClaimTimeout: cfg.Outbox.ClaimTimeout,
+			MaxAttempts:  cfg.Outbox.MaxAttempts,
+		})
+	}
+
+	// Readiness checks for the sources, registry table and credentials
+	checks := []DependencyCheck{
+		{Name: "dynamodb", Check: func(ctx context.Context) error {
+			_, err := client.DescribeTable(ctx)
+			return err
+		}},
+		newCallerIdentityCheck(awsCfg),
+	}
+	if len(cfg.Consumer.SQSQueues()) > 0 {
+		checks = append(checks, DependencyCheck{Name: "sqs", Check: consumer.CheckQueue})
+	}
+	if kafkaSource != nil {
+		checks = append(checks, DependencyCheck{Name: "kafka", Check: kafkaSource.CheckBrokers})
+	}
+	if kinesisSource != nil {
+		checks = append(checks, DependencyCheck{Name: "kinesis", Check: kinesisSource.CheckStream})
+	}
+	if rabbitSource != nil {
+		checks = append(checks, DependencyCheck{Name: "rabbitmq", Check: rabbitSource.CheckConnection})
+	}
+	if natsSource != nil {
+		checks = append(checks, DependencyCheck{Name: "nats", Check: natsSource.CheckConnection})
+	}
+	if outboxSource != nil {
+		checks = append(checks, DependencyCheck{Name: "outbox", Check: outboxSource.CheckTable})
+	}
+	if archiver != nil {
+		checks = append(checks, DependencyCheck{Name: "archive", Check: archiver.CheckBucket})
+	}
+	readiness := NewReadinessChecker(10*time.Second, checks...)
+	heartbeat.SetReadiness(readiness)
+
+	// Ramp-down before a newer version during deploys
+	var handoff *Handoff
+	if cfg.Consumer.HandoffDuration > 0 {
+		handoff = NewHandoff(orchestratorClient, consumer, heartbeat, cfg.Consumer.HandoffDuration)
+	}
+
+	// Queues split between the replicas
+	var sharding *Sharding
+	if cfg.Consumer.Sharding {
+		sharding = NewSharding(orchestratorClient, consumer, heartbeat)
+	}
+
+	// Queue depth sampling
+	var queueMonitor *QueueMonitor
+	if len(cfg.Consumer.SQSQueues()) > 0 && cfg.Consumer.QueueMonitorInterval > 0 {
+		queueMonitor = NewQueueMonitor(consumer, awsCfg)
+	}
+	var pollerScaler *PollerScaler
+	if queueMonitor != nil && cfg.Consumer.MaxPollers > cfg.Consumer.MinPollers {
+		pollerScaler = NewPollerScaler(consumer, queueMonitor, cfg.Consumer.MinPollers, cfg.Consumer.MaxPollers, cfg.Consumer.PollerDrainTarget)
+	}
+
+	var alertMonitor *AlertMonitor
+	if alerter != nil {
+		// Without alerts.dlqUrl, the DLQ of the redrive policy of the first queue
+		dlqURL := cfg.Alerts.DLQURL
+		if queues := cfg.Consumer.SQSQueues(); dlqURL == "" && len(queues) > 0 {
+			dlqURL, err = discoverDLQ(context.Background(), awsCfg, queues[0].URL)
+			switch {
+			case err != nil:
+				slog.Warn("Could not discover the DLQ, its backlog is not checked", errAttr(err))
+			case dlqURL != "":
+				slog.Info("Discovered DLQ from the redrive policy", "queue_url", queues[0].URL, "dlq_url", dlqURL)
+			}
+		}
+		alertMonitor = NewAlertMonitor(alerter, consumer, dlqURL, cfg.Alerts.DLQThreshold, cfg.Alerts.IntegrityThreshold, cfg.Alerts.LatencySLO)
+	}
+
+	// Periodic jobs
+	scheduler := NewScheduler(elector, cfg.Scheduler.Jitter)
+	addJob := func(name string, interval time.Duration, job Job) {
+		spec := interval.String()
+		if override, ok := cfg.Scheduler.Jobs[name]; ok {
+			spec = override
+		}
+		schedule, err := parseSchedule(spec)
+		if err != nil {
+			fatal("Invalid job schedule", "job", name, errAttr(err))
+		}
+		job.Name = name
+		job.Schedule = schedule
+		scheduler.Add(job)
+	}
+	if reconciler != nil {
+		addJob(jobReconciler, cfg.Registry.ReconcileInterval, Job{Immediate: true, Singleton: true, Run: func(ctx context.Context) error {
+			if report := reconciler.Reconcile(ctx); report.Error != "" {
+				return errors.New(report.Error)
+			}
+			return nil
+		}})
+	}
+	if discoverer != nil {
+		addJob(jobDiscovery, cfg.Registry.DiscoveryInterval, Job{Immediate: true, Singleton: true, Run: discoverer.Discover})
+	}
+	if heartbeatMonitor != nil {
+		addJob(jobHeartbeatMonitor, cfg.Registry.HeartbeatSweepInterval, Job{Immediate: true, Singleton: true, Run: heartbeatMonitor.Sweep})
+	}
+	if alertMonitor != nil {
+		addJob(jobAlertMonitor, cfg.Alerts.CheckInterval, Job{Run: alertMonitor.CheckReplica})
+		if alertMonitor.dlqURL != "" {
+			addJob(jobDLQMonitor, cfg.Alerts.CheckInterval, Job{Singleton: true, Run: alertMonitor.CheckDLQ})
+		}
+	}
+	if queueMonitor != nil {
+		addJob(jobQueueMonitor, cfg.Consumer.QueueMonitorInterval, Job{Immediate: true, Run: queueMonitor.Sample})
+	}
+	if pollerScaler != nil {
+		addJob(jobPollerScaling, cfg.Consumer.QueueMonitorInterval, Job{Run: pollerScaler.Scale})
+	}
+	if spendGuard != nil {
+		spendGuard.SetConsumer(consumer)
+		addJob(jobSpendGuard, cfg.Budget.CheckInterval, Job{Run: spendGuard.Check})
+	}
+	if schemas != nil && cfg.Schemas.RefreshInterval > 0 {
+		addJob(jobSchemas, cfg.Schemas.RefreshInterval, Job{Run: schemas.Reload})
+	}
+	if routingRules != nil {
+		addJob(jobRoutingRules, cfg.Router.RulesPollInterval, Job{Immediate: true, Run: routingRules.Refresh})
+	}
+	if sharding != nil {
+		addJob(jobSharding, cfg.Consumer.HeartbeatInterval, Job{Immediate: true, Run: sharding.Refresh})
+	}
+	if handoff != nil {
+		addJob(jobHandoff, cfg.Consumer.HeartbeatInterval, Job{Run: handoff.Check})
+	}
+	if featureFlags != nil {
+		addJob(jobFlags, cfg.Flags.PollInterval, Job{Immediate: true, Run: featureFlags.Refresh})
+	}
+
+	// Replay of archived messages, through this instance or onto a queue
+	var replayAPI *ReplayAPI
+	if adminAuth != nil && archiver != nil {
+		replayer := NewReplayer(awsCfg, cfg.Archive.Bucket, cfg.Archive.Prefix)
+		replayAPI = NewReplayAPI(replayer, consumer, awsCfg, adminAuth[config.AuthGroupOperations])
+		routes = append(routes, replayAPI.Register)
+	}
+
+	// Synchronous processing shares the admin authentication
+	var processAPI *ProcessAPI
+	if adminAuth != nil && cfg.Server.ProcessConcurrency > 0 {
+		processAPI = NewProcessAPI(consumer, adminAuth[config.AuthGroupProcess], cfg.Server.ProcessTimeout, cfg.Server.ProcessConcurrency)
+		routes = append(routes, processAPI.Register)
+	}
+
+	// Retirement of the instance: stop polling, finish in flight, fail /ready
+	if adminAuth != nil {
+		drainAPI := NewDrainAPI(consumer, readiness, adminAuth[config.AuthGroupOperations])
+		routes = append(routes, drainAPI.Register)
+	}
+
+	features := enabledFeatures(map[string]bool{
+		"tracing":       tracingExportEnabled(),
+		"dax":           cfg.Registry.DAXEndpoint != "",
+		"reconciler":    reconciler != nil,
+		"discovery":     discoverer != nil,
+		"admin-api":     adminAuth != nil,
+		"pprof":         adminAuth != nil && cfg.Server.Pprof,
+		"exactly-once":  dedup != nil,
+		"emf-metrics":   emf != nil,
+		"routing-audit": routingAudit != nil,
+		"queue-monitor": queueMonitor != nil,
+		"sns-alerts":    alerter != nil,
+		"webhooks":      notifier != nil,
+		"output-queue":  outputQueue != nil,
+		"transforms":    transforms != nil,
+		"events":        events != nil,
+		"kafka":         kafkaSource != nil,
+		"kinesis":       kinesisSource != nil,
+		"rabbitmq":      rabbitSource != nil,
+		"nats":          natsSource != nil,
+		"outbox":        outboxSource != nil,
+		"tenants":       tenants != nil,
+		"cloudevents":   cloudEvents != nil,
+		"protobuf":      protobufCodec != nil,
+		"schemas":       schemas != nil,
+		"routing-rules": routingRules != nil,
+		"fan-out":       len(cfg.Router.FanOutTypes) > 0,
+		"quorum":        quorum != nil,
+		"eviction":      eviction != nil,
+		"adaptive":      cfg.Router.AdaptiveWeights,
+		"handoff":       handoff != nil,
+		"sharding":      sharding != nil,
+		"autoscaling":   pollerScaler != nil,
+		"batching":      batcher != nil,
+		"costs":         costs != nil,
+		"budget":        spendGuard != nil,
+		"ecs-scale-in":  protection != nil,
+		"archive":       archiver != nil,
+		"replay":        replayAPI != nil,
+		"process-api":   processAPI != nil,
+		"control-plane": adminAuth != nil && cfg.Server.GRPCPort != "",
+		"chaos":         *chaos,
+		"workflows":     workflows != nil,
+	})
+
+	// /status is served to the operations group of the admin authentication
+	var statusAuth Authenticator
+	if adminAuth != nil {
+		statusAuth = adminAuth[config.AuthGroupOperations]
+	}
+	status := NewStatusHandler(StatusOptions{
+		Consumer:   consumer,
+		Queue:      queueMonitor,
+		Scheduler:  scheduler,
+		Lambda:     lambdaClient,
+		Registry:   registry,
+		DB:         client,
+		InstanceID: instanceID,
+		Auth:       statusAuth,
+	})
+	routes = append(routes,
+		readiness.Register,
+		status.Register,
+		NewVersionHandler(features).Register,
+	)
+
+	// Start health check server
+	liveness := NewLivenessProbe(consumer.LastActivity, cfg.Consumer.LivenessThreshold)
+	var healthTLS *tls.Config
+	if cfg.Server.TLSCert != "" {
+		healthTLS, err = newServerTLSConfig(cfg.Server.TLSCert, cfg.Server.TLSKey)
+		if err != nil {
+			fatal("Failed to load health server TLS certificate", errAttr(err))
+		}
+	}
+	healthServer := startHealthServer(cfg.Server.Port, healthTLS, liveness, routes...)
+
+	// Settings that can change on SIGHUP without a restart
+	reloader := config.NewReloader(*configFile, cfg, checkSettings)
+	reloader.OnChange("registry.consistentReads", func(c *config.Config) {
+		registry.SetConsistentReads(c.Registry.ConsistentReads)
+	})
+	reloader.OnChange("consumer.livenessThreshold", func(c *config.Config) {
+		liveness.SetThreshold(c.Consumer.LivenessThreshold)
+	})
+	reloader.OnChange("consumer.maxRate", func(c *config.Config) {
+		consumer.SetMaxRate(c.Consumer.MaxRate)
+	})
+	reloader.OnChange("consumer.routingStrategy", func(c *config.Config) {
+		consumer.SetRoutingStrategy(c.Consumer.RoutingStrategy)
+	})
+	if alerter != nil {
+		reloader.OnChange("alerts.cooldown", func(c *config.Config) {
+			alerter.SetCooldown(c.Alerts.Cooldown)
+		})
+	}
+	if notifier != nil {
+		reloader.OnChange("alerts.webhookRateLimit", func(c *config.Config) {
+			notifier.SetRateLimit(c.Alerts.WebhookRateLimit)
+		})
+		reloader.OnChange("alerts.webhookUrl", func(c *config.Config) {
+			notifier.SetURL(c.Alerts.WebhookURL)
+		})
+	}
+	if adminAPIKey != nil {
+		reloader.OnChange("server.adminApiKey", func(c *config.Config) {
+			adminAPIKey.SetKey(c.Server.AdminAPIKey)
+		})
+	}
+
+	// Diagnostics of a stuck instance on SIGUSR1
+	stateDumper := NewStateDumper(StateDumperOptions{
+		Status:   status,
+		Consumer: consumer,
+		Registry: registry,
+		Rules:    routingRules,
+		Config:   reloader.Current,
+		Dir:      cfg.Server.StateDumpDir,
+	})
+
+	// gRPC control plane, on its own port with the admin authentication
+	var controlServer *grpc.Server
+	if adminAuth != nil && cfg.Server.GRPCPort != "" {
+		controlPlane := NewControlPlane(registry, consumer, status, reloader.Current, adminAuth)
+		controlServer = startControlPlaneServer(cfg.Server.GRPCPort, healthTLS, controlPlane)
+	} else if cfg.Server.GRPCPort != "" {
+		slog.Info("No admin API key or IAM principals configured, gRPC control plane disabled")
+	}
+
+	// Rotation of settings read from Secrets Manager
+	var secretRefresher *config.SecretRefresher
+	if cfg.SecretsRefreshInterval > 0 {
+		secretRefresher = config.NewSecretRefresher(cfg, awsCfg)
+		if adminAPIKey != nil {
+			secretRefresher.OnRotate("server.adminApiKey", adminAPIKey.SetKey)
+		}
+		if notifier != nil {
+			secretRefresher.OnRotate("alerts.webhookUrl", notifier.SetURL)
+		}
+		addJob(jobSecrets, cfg.SecretsRefreshInterval, Job{Run: secretRefresher.Refresh})
 	}
 
 	// Setup graceful shutdown
@@ -56,19 +822,98 @@ func main() {
 
 	go func() {
 		<-sigChan
-		log.Println("Received shutdown signal")
+		slog.Info("Received shutdown signal")
+		notifier.Notify(EventShutdown, map[string]string{"reason": "signal"})
 
 		// Shutdown health server gracefully
 		shutdownCtx, shutdownCancel := context.WithTimeout(context.Background(), 5*time.Second)
 		defer shutdownCancel()
 
 		if err := healthServer.Shutdown(shutdownCtx); err != nil {
-			log.Printf("Health server shutdown error: %v", err)
+			slog.Error("Health server shutdown error", errAttr(err))
+		}
+		if controlServer != nil {
+			stopControlPlaneServer(controlServer, 5*time.Second)
 		}
 
 		cancel()
 	}()
 
+	go heartbeat.Start(ctx)
+	if elector != nil {
+		go elector.Start(ctx)
+	}
+	go reloader.Start(ctx)
+	if protection != nil {
+		go protection.Start(ctx, consumer.InFlight)
+	}
+	go stateDumper.Start(ctx)
+	go scheduler.Start(ctx)
+	if emf != nil {
+		go emf.Start(ctx)
+	}
+	if routingAudit != nil {
+		go routingAudit.Start(ctx)
+	}
+	if events != nil {
+		go events.Start(ctx)
+	}
+	if archiver != nil {
+		go archiver.Start(ctx)
+	}
+	// The sources are waited for after the consumer stops, so they finish
+	// their checkpoints, commits and lease releases before the exit
+	var sources sync.WaitGroup
+	if kafkaSource != nil {
+		sources.Add(1)
+		go func() {
+			defer sources.Done()
+			kafkaSource.Start(ctx)
+		}()
+	}
+	if kinesisSource != nil {
+		sources.Add(1)
+		go func() {
+			defer sources.Done()
+			kinesisSource.Start(ctx)
+		}()
+	}
+	if rabbitSource != nil {
+		sources.Add(1)
+		go func() {
+			defer sources.Done()
+			rabbitSource.Start(ctx)
+		}()
+	}
+	if natsSource != nil {
+		sources.Add(1)
+		go func() {
+			defer sources.Done()
+			natsSource.Start(ctx)
+		}()
+	}
+	if outboxSource != nil {
+		sources.Add(1)
+		go func() {
+			defer sources.Done()
+			outboxSource.Start(ctx)
+		}()
+	}
+
 	// Start consuming
 	consumer.Start(ctx)
+	sources.Wait()
+
+	deregisterCtx, deregisterCancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer deregisterCancel()
+	heartbeat.Deregister(deregisterCtx)
+	elector.Release(deregisterCtx)
+	emf.Flush()
+	notifier.Wait()
+	archiver.Wait()
+
+	if err := shutdownTracing(deregisterCtx); err != nil {
+		slog.Error("Tracing shutdown error", errAttr(err))
+	}
+	return nil
 }
@@ -0,0 +1,232 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"runtime/debug"
+	"sync/atomic"
+	"time"
+)
+
+var (
+	messagesHandled = NewCounterVec(
+		"orchestrator_messages_handled_total",
+		"Messages run through the processing pipeline, by outcome (processed, failed, skipped).",
+		"outcome",
+	)
+	messageDuration = NewHistogramVec(
+		"orchestrator_message_duration_seconds",
+		"Time spent running a message through the processing pipeline.",
+		DefaultLatencyBuckets,
+		"outcome",
+	)
+	handlerPanics = NewCounterVec(
+		"orchestrator_handler_panics_total",
+		"Panics recovered while processing a message.",
+	)
+)
+
+// errPanic wraps the value of a panic recovered while processing a message
+var errPanic = errors.New("panic processing message")
+
+// Middleware wraps a Handler with a concern shared by every message, such as
+// logging or deduplication
+type Middleware func(next Handler) Handler
+
+// chain wraps h in the middlewares; the first one is the outermost
+func chain(h Handler, middlewares ...Middleware) Handler {
+	for i := len(middlewares) - 1; i >= 0; i-- {
+		h = middlewares[i](h)
+	}
+	return h
+}
+
+// skipError stops a message without failing it. The message is acknowledged
+// when ack is set, e.g. a duplicate, and otherwise left for redelivery; with
+// retryAfter it is deferred, delivered again after it without using an
+// attempt.
+type skipError struct {
+	reason     string
+	ack        bool
+	retryAfter time.Duration
+}
+
+func (e *skipError) Error() string {
+	return e.reason
+}
+
+// isSkipped reports whether err is a skipError
+func isSkipped(err error) bool {
+	var skipped *skipError
+	return errors.As(err, &skipped)
+}
+
+type dedupIDKey struct{}
+
+func withDedupID(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, dedupIDKey{}, id)
+}
+
+func dedupIDFrom(ctx context.Context) string {
+	id, _ := ctx.Value(dedupIDKey{}).(string)
+	return id
+}
+
+// recoverMiddleware turns a panic in the business logic into an error, so
+// the message is retried instead of crashing the consumer. It is the
+// innermost middleware, so the others count, log and release the message as
+// a failure; process recovers the panics outside the pipeline.
+func recoverMiddleware() Middleware {
+	return func(next Handler) Handler {
+		return HandlerFunc(func(ctx context.Context, msg any) (response *workerResponse, err error) {
+			defer func() {
+				if r := recover(); r != nil {
+					handlerPanics.Inc()
+					loggerFrom(ctx).Error("Panic processing message", "panic", r, "stack", string(debug.Stack()))
+					response, err = nil, fmt.Errorf("%w: %v", errPanic, r)
+				}
+			}()
+			return next.Handle(ctx, msg)
+		})
+	}
+}
+
+// loggingMiddleware logs the outcome of each message with its stage timings
+func loggingMiddleware() Middleware {
+	return func(next Handler) Handler {
+		return HandlerFunc(func(ctx context.Context, msg any) (*workerResponse, error) {
+			logger := loggerFrom(ctx)
+			logger.Debug("Processing app message", "body", msg)
+
+			started := time.Now()
+			response, err := next.Handle(ctx, msg)
+			switch {
+			case isSkipped(err):
+			case err != nil:
+				logger.Error("Error processing message", durationAttr(time.Since(started)), stageTimingsFrom(ctx).logAttr(), errAttr(err))
+			default:
+				logger.Info("Message processed", durationAttr(time.Since(started)), stageTimingsFrom(ctx).logAttr())
+			}
+			return response, err
+		})
+	}
+}
+
+// metricsMiddleware counts messages and their duration by outcome
+func metricsMiddleware() Middleware {
+	return func(next Handler) Handler {
+		return HandlerFunc(func(ctx context.Context, msg any) (*workerResponse, error) {
+			started := time.Now()
+			response, err := next.Handle(ctx, msg)
+
+			outcome := "processed"
+			switch {
+			case isSkipped(err):
+				outcome = "skipped"
+			case err != nil:
+				outcome = "failed"
+				pipelineErrors.Inc(errorClass(err))
+			}
+			messagesHandled.Inc(outcome)
+			messageDuration.Observe(time.Since(started).Seconds(), outcome)
+			return response, err
+		})
+	}
+}
+
+// rateLimitMiddleware holds messages back to the rate of the limiter across
+// every source. The limiter may change at any time; while it is nil messages
+// are not limited.
+func rateLimitMiddleware(limiter *atomic.Pointer[tokenBucket]) Middleware {
+	return func(next Handler) Handler {
+		return HandlerFunc(func(ctx context.Context, msg any) (*workerResponse, error) {
+			if bucket := limiter.Load(); bucket != nil {
+				if err := bucket.Wait(ctx); err != nil {
+					return nil, &skipError{reason: "rate limit wait interrupted"}
+				}
+			}
+			return next.Handle(ctx, msg)
+		})
+	}
+}
+
+// dedupMiddleware claims the message before the rest of the pipeline runs, in
+// exactly-once mode. The claim is released when processing fails and marked
+// done when it succeeds. A nil store, or a message without a dedup ID such
+// as a synchronous request, is not deduplicated.
+func dedupMiddleware(store *DedupStore) Middleware {
+	if store == nil {
+		return func(next Handler) Handler { return next }
+	}
+	return func(next Handler) Handler {
+		return HandlerFunc(func(ctx context.Context, msg any) (*workerResponse, error) {
+			logger := loggerFrom(ctx)
+			dedupID := dedupIDFrom(ctx)
+			if dedupID == "" {
+				return next.Handle(ctx, msg)
+			}
+
+			outcome, err := store.Claim(ctx, dedupID)
+			if err != nil {
+				logger.Error("Error claiming message", "dedup_id", dedupID, errAttr(err))
+				return nil, &skipError{reason: "claim failed"}
+			}
+			switch outcome {
+			case ClaimAlreadyDone:
+				logger.Info("Message already processed, skipping", "dedup_id", dedupID)
+				return nil, &skipError{reason: "already processed", ack: true}
+			case ClaimInProgress:
+				logger.Info("Message is being processed by another consumer, skipping", "dedup_id", dedupID)
+				return nil, &skipError{reason: "claimed by another consumer"}
+			}
+
+			response, err := next.Handle(ctx, msg)
+			if err != nil {
+				store.Release(ctx, dedupID)
+				return response, err
+			}
+			if err := store.MarkDone(ctx, dedupID); err != nil {
+				logger.Error("Error marking message as done", "dedup_id", dedupID, errAttr(err))
+			}
+			return response, nil
+		})
+	}
+}
+
+// pipeline builds the message pipeline: the business logic and the output
+// forwarding, wrapped in the shared middlewares
+func (c *SQSConsumer) pipeline() Handler {
+	return chain(HandlerFunc(c.deliver),
+		loggingMiddleware(),
+		metricsMiddleware(),
+		tenantMiddleware(c.tenants),
+		budgetMiddleware(c.budget),
+		rateLimitMiddleware(&c.maxRate),
+		dedupMiddleware(c.dedup),
+		recoverMiddleware(),
+	)
+}
+
+// deliver runs the business logic and forwards the response, reshaped by the
+// transforms of its message type, to the output queue. A failed transform or
+// send leaves the message in the source, so the worker may be invoked again
+// for it; a response is never forwarded unredacted.
+func (c *SQSConsumer) deliver(ctx context.Context, msg any) (*workerResponse, error) {
+	response, err := c.handleBusinessLogic(ctx, msg)
+	if err != nil || c.output == nil {
+		return response, err
+	}
+
+	stageStarted := time.Now()
+	body, err := c.transforms.Transform(ctx, msg, response)
+	if err != nil {
+		return response, fmt.Errorf("error transforming response: %w", err)
+	}
+	err = c.output.Send(ctx, messageIDFrom(ctx), response.Lambda, body, response.Elapsed)
+	observeStage(ctx, stageOutput, stageStarted)
+	if err != nil {
+		return response, fmt.Errorf("error forwarding response: %w", err)
+	}
+	return response, nil
+}
@@ -0,0 +1,534 @@
+// Code generated by MockGen. DO NOT EDIT.
+// Source: interfaces.go
+//
+// Generated by this command:
+//
+//	mockgen -source=interfaces.go -destination=mocks_test.go -package=main
+//
+
+// Package main is a generated GoMock package.
+package main
+
+import (
+	context "context"
+	reflect "reflect"
+
+	lambda "github.com/aws/aws-sdk-go-v2/service/lambda"
+	sqs "github.com/aws/aws-sdk-go-v2/service/sqs"
+	gomock "go.uber.org/mock/gomock"
+)
+
+// MockMessageReceiver is a mock of MessageReceiver interface.
+type MockMessageReceiver struct {
+	ctrl     *gomock.Controller
+	recorder *MockMessageReceiverMockRecorder
+	isgomock struct{}
+}
+
+// MockMessageReceiverMockRecorder is the mock recorder for MockMessageReceiver.
+type MockMessageReceiverMockRecorder struct {
+	mock *MockMessageReceiver
+}
+
+// NewMockMessageReceiver creates a new mock instance.
+func NewMockMessageReceiver(ctrl *gomock.Controller) *MockMessageReceiver {
+	mock := &MockMessageReceiver{ctrl: ctrl}
+	mock.recorder = &MockMessageReceiverMockRecorder{mock}
+	return mock
+}
+
+// EXPECT returns an object that allows the caller to indicate expected use.
+func (m *MockMessageReceiver) EXPECT() *MockMessageReceiverMockRecorder {
+	return m.recorder
+}
+
+// ReceiveMessage mocks base method.
+func (m *MockMessageReceiver) ReceiveMessage(ctx context.Context, params *sqs.ReceiveMessageInput, optFns ...func(*sqs.Options)) (*sqs.ReceiveMessageOutput, error) {
+	m.ctrl.T.Helper()
+	varargs := []any{ctx, params}
+	for _, a := range optFns {
+		varargs = append(varargs, a)
+	}
+	ret := m.ctrl.Call(m, "ReceiveMessage", varargs...)
+	ret0, _ := ret[0].(*sqs.ReceiveMessageOutput)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// ReceiveMessage indicates an expected call of ReceiveMessage.
+func (mr *MockMessageReceiverMockRecorder) ReceiveMessage(ctx, params any, optFns ...any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	varargs := append([]any{ctx, params}, optFns...)
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ReceiveMessage", reflect.TypeOf((*MockMessageReceiver)(nil).ReceiveMessage), varargs...)
+}
+
+// MockMessageDeleter is a mock of MessageDeleter interface.
+type MockMessageDeleter struct {
+	ctrl     *gomock.Controller
+	recorder *MockMessageDeleterMockRecorder
+	isgomock struct{}
+}
+
+// MockMessageDeleterMockRecorder is the mock recorder for MockMessageDeleter.
+type MockMessageDeleterMockRecorder struct {
+	mock *MockMessageDeleter
+}
+
+// NewMockMessageDeleter creates a new mock instance.
+func NewMockMessageDeleter(ctrl *gomock.Controller) *MockMessageDeleter {
+	mock := &MockMessageDeleter{ctrl: ctrl}
+	mock.recorder = &MockMessageDeleterMockRecorder{mock}
+	return mock
+}
+
+// EXPECT returns an object that allows the caller to indicate expected use.
+func (m *MockMessageDeleter) EXPECT() *MockMessageDeleterMockRecorder {
+	return m.recorder
+}
+
+// DeleteMessage mocks base method.
+func (m *MockMessageDeleter) DeleteMessage(ctx context.Context, params *sqs.DeleteMessageInput, optFns ...func(*sqs.Options)) (*sqs.DeleteMessageOutput, error) {
+	m.ctrl.T.Helper()
+	varargs := []any{ctx, params}
+	for _, a := range optFns {
+		varargs = append(varargs, a)
+	}
+	ret := m.ctrl.Call(m, "DeleteMessage", varargs...)
+	ret0, _ := ret[0].(*sqs.DeleteMessageOutput)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// DeleteMessage indicates an expected call of DeleteMessage.
+func (mr *MockMessageDeleterMockRecorder) DeleteMessage(ctx, params any, optFns ...any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	varargs := append([]any{ctx, params}, optFns...)
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "DeleteMessage", reflect.TypeOf((*MockMessageDeleter)(nil).DeleteMessage), varargs...)
+}
+
+// MockMessageSender is a mock of MessageSender interface.
+type MockMessageSender struct {
+	ctrl     *gomock.Controller
+	recorder *MockMessageSenderMockRecorder
+	isgomock struct{}
+}
+
+// MockMessageSenderMockRecorder is the mock recorder for MockMessageSender.
+type MockMessageSenderMockRecorder struct {
+	mock *MockMessageSender
+}
+
+// NewMockMessageSender creates a new mock instance.
+func NewMockMessageSender(ctrl *gomock.Controller) *MockMessageSender {
+	mock := &MockMessageSender{ctrl: ctrl}
+	mock.recorder = &MockMessageSenderMockRecorder{mock}
+	return mock
+}
+
+// EXPECT returns an object that allows the caller to indicate expected use.
+func (m *MockMessageSender) EXPECT() *MockMessageSenderMockRecorder {
+	return m.recorder
+}
+
+// SendMessage mocks base method.
+func (m *MockMessageSender) SendMessage(ctx context.Context, params *sqs.SendMessageInput, optFns ...func(*sqs.Options)) (*sqs.SendMessageOutput, error) {
+	m.ctrl.T.Helper()
+	varargs := []any{ctx, params}
+	for _, a := range optFns {
+		varargs = append(varargs, a)
+	}
+	ret := m.ctrl.Call(m, "SendMessage", varargs...)
+	ret0, _ := ret[0].(*sqs.SendMessageOutput)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// SendMessage indicates an expected call of SendMessage.
+func (mr *MockMessageSenderMockRecorder) SendMessage(ctx, params any, optFns ...any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	varargs := append([]any{ctx, params}, optFns...)
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SendMessage", reflect.TypeOf((*MockMessageSender)(nil).SendMessage), varargs...)
+}
+
+// MockVisibilityChanger is a mock of VisibilityChanger interface.
+type MockVisibilityChanger struct {
+	ctrl     *gomock.Controller
+	recorder *MockVisibilityChangerMockRecorder
+	isgomock struct{}
+}
+
+// MockVisibilityChangerMockRecorder is the mock recorder for MockVisibilityChanger.
+type MockVisibilityChangerMockRecorder struct {
+	mock *MockVisibilityChanger
+}
+
+// NewMockVisibilityChanger creates a new mock instance.
+func NewMockVisibilityChanger(ctrl *gomock.Controller) *MockVisibilityChanger {
+	mock := &MockVisibilityChanger{ctrl: ctrl}
+	mock.recorder = &MockVisibilityChangerMockRecorder{mock}
+	return mock
+}
+
+// EXPECT returns an object that allows the caller to indicate expected use.
+func (m *MockVisibilityChanger) EXPECT() *MockVisibilityChangerMockRecorder {
+	return m.recorder
+}
+
+// ChangeMessageVisibility mocks base method.
+func (m *MockVisibilityChanger) ChangeMessageVisibility(ctx context.Context, params *sqs.ChangeMessageVisibilityInput, optFns ...func(*sqs.Options)) (*sqs.ChangeMessageVisibilityOutput, error) {
+	m.ctrl.T.Helper()
+	varargs := []any{ctx, params}
+	for _, a := range optFns {
+		varargs = append(varargs, a)
+	}
+	ret := m.ctrl.Call(m, "ChangeMessageVisibility", varargs...)
+	ret0, _ := ret[0].(*sqs.ChangeMessageVisibilityOutput)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// ChangeMessageVisibility indicates an expected call of ChangeMessageVisibility.
+func (mr *MockVisibilityChangerMockRecorder) ChangeMessageVisibility(ctx, params any, optFns ...any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	varargs := append([]any{ctx, params}, optFns...)
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ChangeMessageVisibility", reflect.TypeOf((*MockVisibilityChanger)(nil).ChangeMessageVisibility), varargs...)
+}
+
+// MockQueueAttributesGetter is a mock of QueueAttributesGetter interface.
+type MockQueueAttributesGetter struct {
+	ctrl     *gomock.Controller
+	recorder *MockQueueAttributesGetterMockRecorder
+	isgomock struct{}
+}
+
+// MockQueueAttributesGetterMockRecorder is the mock recorder for MockQueueAttributesGetter.
+type MockQueueAttributesGetterMockRecorder struct {
+	mock *MockQueueAttributesGetter
+}
+
+// NewMockQueueAttributesGetter creates a new mock instance.
+func NewMockQueueAttributesGetter(ctrl *gomock.Controller) *MockQueueAttributesGetter {
+	mock := &MockQueueAttributesGetter{ctrl: ctrl}
+	mock.recorder = &MockQueueAttributesGetterMockRecorder{mock}
+	return mock
+}
+
+// EXPECT returns an object that allows the caller to indicate expected use.
+func (m *MockQueueAttributesGetter) EXPECT() *MockQueueAttributesGetterMockRecorder {
+	return m.recorder
+}
+
+// GetQueueAttributes mocks base method.
+func (m *MockQueueAttributesGetter) GetQueueAttributes(ctx context.Context, params *sqs.GetQueueAttributesInput, optFns ...func(*sqs.Options)) (*sqs.GetQueueAttributesOutput, error) {
+	m.ctrl.T.Helper()
+	varargs := []any{ctx, params}
+	for _, a := range optFns {
+		varargs = append(varargs, a)
+	}
+	ret := m.ctrl.Call(m, "GetQueueAttributes", varargs...)
+	ret0, _ := ret[0].(*sqs.GetQueueAttributesOutput)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetQueueAttributes indicates an expected call of GetQueueAttributes.
+func (mr *MockQueueAttributesGetterMockRecorder) GetQueueAttributes(ctx, params any, optFns ...any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	varargs := append([]any{ctx, params}, optFns...)
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetQueueAttributes", reflect.TypeOf((*MockQueueAttributesGetter)(nil).GetQueueAttributes), varargs...)
+}
+
+// MockQueueClient is a mock of QueueClient interface.
+type MockQueueClient struct {
+	ctrl     *gomock.Controller
+	recorder *MockQueueClientMockRecorder
+	isgomock struct{}
+}
+
+// MockQueueClientMockRecorder is the mock recorder for MockQueueClient.
+type MockQueueClientMockRecorder struct {
+	mock *MockQueueClient
+}
+
+// NewMockQueueClient creates a new mock instance.
+func NewMockQueueClient(ctrl *gomock.Controller) *MockQueueClient {
+	mock := &MockQueueClient{ctrl: ctrl}
+	mock.recorder = &MockQueueClientMockRecorder{mock}
+	return mock
+}
+
+// EXPECT returns an object that allows the caller to indicate expected use.
+func (m *MockQueueClient) EXPECT() *MockQueueClientMockRecorder {
+	return m.recorder
+}
+
+// ChangeMessageVisibility mocks base method.
+func (m *MockQueueClient) ChangeMessageVisibility(ctx context.Context, params *sqs.ChangeMessageVisibilityInput, optFns ...func(*sqs.Options)) (*sqs.ChangeMessageVisibilityOutput, error) {
+	m.ctrl.T.Helper()
+	varargs := []any{ctx, params}
+	for _, a := range optFns {
+		varargs = append(varargs, a)
+	}
+	ret := m.ctrl.Call(m, "ChangeMessageVisibility", varargs...)
+	ret0, _ := ret[0].(*sqs.ChangeMessageVisibilityOutput)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// ChangeMessageVisibility indicates an expected call of ChangeMessageVisibility.
+func (mr *MockQueueClientMockRecorder) ChangeMessageVisibility(ctx, params any, optFns ...any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	varargs := append([]any{ctx, params}, optFns...)
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ChangeMessageVisibility", reflect.TypeOf((*MockQueueClient)(nil).ChangeMessageVisibility), varargs...)
+}
+
+// DeleteMessage mocks base method.
+func (m *MockQueueClient) DeleteMessage(ctx context.Context, params *sqs.DeleteMessageInput, optFns ...func(*sqs.Options)) (*sqs.DeleteMessageOutput, error) {
+	m.ctrl.T.Helper()
+	varargs := []any{ctx, params}
+	for _, a := range optFns {
+		varargs = append(varargs, a)
+	}
+	ret := m.ctrl.Call(m, "DeleteMessage", varargs...)
+	ret0, _ := ret[0].(*sqs.DeleteMessageOutput)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// DeleteMessage indicates an expected call of DeleteMessage.
+func (mr *MockQueueClientMockRecorder) DeleteMessage(ctx, params any, optFns ...any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	varargs := append([]any{ctx, params}, optFns...)
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "DeleteMessage", reflect.TypeOf((*MockQueueClient)(nil).DeleteMessage), varargs...)
+}
+
+// GetQueueAttributes mocks base method.
+func (m *MockQueueClient) GetQueueAttributes(ctx context.Context, params *sqs.GetQueueAttributesInput, optFns ...func(*sqs.Options)) (*sqs.GetQueueAttributesOutput, error) {
+	m.ctrl.T.Helper()
+	varargs := []any{ctx, params}
+	for _, a := range optFns {
+		varargs = append(varargs, a)
+	}
+	ret := m.ctrl.Call(m, "GetQueueAttributes", varargs...)
+	ret0, _ := ret[0].(*sqs.GetQueueAttributesOutput)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetQueueAttributes indicates an expected call of GetQueueAttributes.
+func (mr *MockQueueClientMockRecorder) GetQueueAttributes(ctx, params any, optFns ...any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	varargs := append([]any{ctx, params}, optFns...)
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetQueueAttributes", reflect.TypeOf((*MockQueueClient)(nil).GetQueueAttributes), varargs...)
+}
+
+// ReceiveMessage mocks base method.
+func (m *MockQueueClient) ReceiveMessage(ctx context.Context, params *sqs.ReceiveMessageInput, optFns ...func(*sqs.Options)) (*sqs.ReceiveMessageOutput, error) {
+	m.ctrl.T.Helper()
+	varargs := []any{ctx, params}
+	for _, a := range optFns {
+		varargs = append(varargs, a)
+	}
+	ret := m.ctrl.Call(m, "ReceiveMessage", varargs...)
+	ret0, _ := ret[0].(*sqs.ReceiveMessageOutput)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// ReceiveMessage indicates an expected call of ReceiveMessage.
+func (mr *MockQueueClientMockRecorder) ReceiveMessage(ctx, params any, optFns ...any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	varargs := append([]any{ctx, params}, optFns...)
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ReceiveMessage", reflect.TypeOf((*MockQueueClient)(nil).ReceiveMessage), varargs...)
+}
+
+// SendMessage mocks base method.
+func (m *MockQueueClient) SendMessage(ctx context.Context, params *sqs.SendMessageInput, optFns ...func(*sqs.Options)) (*sqs.SendMessageOutput, error) {
+	m.ctrl.T.Helper()
+	varargs := []any{ctx, params}
+	for _, a := range optFns {
+		varargs = append(varargs, a)
+	}
+	ret := m.ctrl.Call(m, "SendMessage", varargs...)
+	ret0, _ := ret[0].(*sqs.SendMessageOutput)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// SendMessage indicates an expected call of SendMessage.
+func (mr *MockQueueClientMockRecorder) SendMessage(ctx, params any, optFns ...any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	varargs := append([]any{ctx, params}, optFns...)
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SendMessage", reflect.TypeOf((*MockQueueClient)(nil).SendMessage), varargs...)
+}
+
+// MockInvoker is a mock of Invoker interface.
+type MockInvoker struct {
+	ctrl     *gomock.Controller
+	recorder *MockInvokerMockRecorder
+	isgomock struct{}
+}
+
+// MockInvokerMockRecorder is the mock recorder for MockInvoker.
+type MockInvokerMockRecorder struct {
+	mock *MockInvoker
+}
+
+// NewMockInvoker creates a new mock instance.
+func NewMockInvoker(ctrl *gomock.Controller) *MockInvoker {
+	mock := &MockInvoker{ctrl: ctrl}
+	mock.recorder = &MockInvokerMockRecorder{mock}
+	return mock
+}
+
+// EXPECT returns an object that allows the caller to indicate expected use.
+func (m *MockInvoker) EXPECT() *MockInvokerMockRecorder {
+	return m.recorder
+}
+
+// InvokeSync mocks base method.
+func (m *MockInvoker) InvokeSync(ctx context.Context, functionName string, payload any) ([]byte, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "InvokeSync", ctx, functionName, payload)
+	ret0, _ := ret[0].([]byte)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// InvokeSync indicates an expected call of InvokeSync.
+func (mr *MockInvokerMockRecorder) InvokeSync(ctx, functionName, payload any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "InvokeSync", reflect.TypeOf((*MockInvoker)(nil).InvokeSync), ctx, functionName, payload)
+}
+
+// InvokeWorker mocks base method.
+func (m *MockInvoker) InvokeWorker(ctx context.Context, worker Lambda, payload any) ([]byte, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "InvokeWorker", ctx, worker, payload)
+	ret0, _ := ret[0].([]byte)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// InvokeWorker indicates an expected call of InvokeWorker.
+func (mr *MockInvokerMockRecorder) InvokeWorker(ctx, worker, payload any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "InvokeWorker", reflect.TypeOf((*MockInvoker)(nil).InvokeWorker), ctx, worker, payload)
+}
+
+// MockFunctionConfigGetter is a mock of FunctionConfigGetter interface.
+type MockFunctionConfigGetter struct {
+	ctrl     *gomock.Controller
+	recorder *MockFunctionConfigGetterMockRecorder
+	isgomock struct{}
+}
+
+// MockFunctionConfigGetterMockRecorder is the mock recorder for MockFunctionConfigGetter.
+type MockFunctionConfigGetterMockRecorder struct {
+	mock *MockFunctionConfigGetter
+}
+
+// NewMockFunctionConfigGetter creates a new mock instance.
+func NewMockFunctionConfigGetter(ctrl *gomock.Controller) *MockFunctionConfigGetter {
+	mock := &MockFunctionConfigGetter{ctrl: ctrl}
+	mock.recorder = &MockFunctionConfigGetterMockRecorder{mock}
+	return mock
+}
+
+// EXPECT returns an object that allows the caller to indicate expected use.
+func (m *MockFunctionConfigGetter) EXPECT() *MockFunctionConfigGetterMockRecorder {
+	return m.recorder
+}
+
+// GetFunctionConfiguration mocks base method.
+func (m *MockFunctionConfigGetter) GetFunctionConfiguration(ctx context.Context, functionName string) (*lambda.GetFunctionConfigurationOutput, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetFunctionConfiguration", ctx, functionName)
+	ret0, _ := ret[0].(*lambda.GetFunctionConfigurationOutput)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetFunctionConfiguration indicates an expected call of GetFunctionConfiguration.
+func (mr *MockFunctionConfigGetterMockRecorder) GetFunctionConfiguration(ctx, functionName any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetFunctionConfiguration", reflect.TypeOf((*MockFunctionConfigGetter)(nil).GetFunctionConfiguration), ctx, functionName)
+}
+
+// MockExecutionStarter is a mock of ExecutionStarter interface.
+type MockExecutionStarter struct {
+	ctrl     *gomock.Controller
+	recorder *MockExecutionStarterMockRecorder
+	isgomock struct{}
+}
+
+// MockExecutionStarterMockRecorder is the mock recorder for MockExecutionStarter.
+type MockExecutionStarterMockRecorder struct {
+	mock *MockExecutionStarter
+}
+
+// NewMockExecutionStarter creates a new mock instance.
+func NewMockExecutionStarter(ctrl *gomock.Controller) *MockExecutionStarter {
+	mock := &MockExecutionStarter{ctrl: ctrl}
+	mock.recorder = &MockExecutionStarterMockRecorder{mock}
+	return mock
+}
+
+// EXPECT returns an object that allows the caller to indicate expected use.
+func (m *MockExecutionStarter) EXPECT() *MockExecutionStarterMockRecorder {
+	return m.recorder
+}
+
+// StartExecution mocks base method.
+func (m *MockExecutionStarter) StartExecution(ctx context.Context, target Lambda, payload any) ([]byte, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "StartExecution", ctx, target, payload)
+	ret0, _ := ret[0].([]byte)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// StartExecution indicates an expected call of StartExecution.
+func (mr *MockExecutionStarterMockRecorder) StartExecution(ctx, target, payload any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "StartExecution", reflect.TypeOf((*MockExecutionStarter)(nil).StartExecution), ctx, target, payload)
+}
+
+// MockRegistry is a mock of Registry interface.
+type MockRegistry struct {
+	ctrl     *gomock.Controller
+	recorder *MockRegistryMockRecorder
+	isgomock struct{}
+}
+
+// MockRegistryMockRecorder is the mock recorder for MockRegistry.
+type MockRegistryMockRecorder struct {
+	mock *MockRegistry
+}
+
+// NewMockRegistry creates a new mock instance.
+func NewMockRegistry(ctrl *gomock.Controller) *MockRegistry {
+	mock := &MockRegistry{ctrl: ctrl}
+	mock.recorder = &MockRegistryMockRecorder{mock}
+	return mock
+}
+
+// EXPECT returns an object that allows the caller to indicate expected use.
+func (m *MockRegistry) EXPECT() *MockRegistryMockRecorder {
+	return m.recorder
+}
+
+// ListHealthy mocks base method.
+func (m *MockRegistry) ListHealthy(ctx context.Context) ([]Lambda, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "ListHealthy", ctx)
+	ret0, _ := ret[0].([]Lambda)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// ListHealthy indicates an expected call of ListHealthy.
+func (mr *MockRegistryMockRecorder) ListHealthy(ctx any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ListHealthy", reflect.TypeOf((*MockRegistry)(nil).ListHealthy), ctx)
+}
@@ -0,0 +1,179 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"strconv"
+	"time"
+
+	"github.com/nats-io/nats.go"
+	"github.com/nats-io/nats.go/jetstream"
+	"go.opentelemetry.io/otel/propagation"
+)
+
+// NATSOptions configures the JetStream source
+type NATSOptions struct {
+	URL             string
+	CredentialsFile string // .creds file, empty connects without credentials
+	Stream          string
+	// Consumer is the durable pull consumer, created or updated on start
+	Consumer string
+	Subject  string // filter subject, empty for the whole stream
+	// BatchSize is how many messages each pull fetches; they are processed
+	// one at a time
+	BatchSize  int
+	AckWait    time.Duration
+	MaxDeliver int
+	// RetryBackoff is the redelivery delay of the first failure, doubled
+	// for each later one up to a minute
+	RetryBackoff time.Duration
+}
+
+// NATSSource feeds a JetStream durable pull consumer into the same pipeline
+// as the SQS queue. Messages are acked explicitly once processed and naked
+// with a backoff on failure, so JetStream redelivers them up to MaxDeliver
+// times.
+type NATSSource struct {
+	conn       *nats.Conn
+	consumer   jetstream.Consumer
+	pipeline   *SQSConsumer
+	instanceID string
+	opts       NATSOptions
+}
+
+// NewNATSSource connects to NATS and creates or updates the durable consumer
+func NewNATSSource(ctx context.Context, pipeline *SQSConsumer, instanceID string, opts NATSOptions) (*NATSSource, error) {
+	natsOpts := []nats.Option{
+		nats.Name(serviceName + "/" + instanceID),
+		nats.MaxReconnects(-1),
+	}
+	if opts.CredentialsFile != "" {
+		natsOpts = append(natsOpts, nats.UserCredentials(opts.CredentialsFile))
+	}
+	conn, err := nats.Connect(opts.URL, natsOpts...)
+	if err != nil {
+		return nil, fmt.Errorf("error connecting to NATS: %w", err)
+	}
+
+	js, err := jetstream.New(conn)
+	if err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("error creating JetStream context: %w", err)
+	}
+	consumer, err := js.CreateOrUpdateConsumer(ctx, opts.Stream, jetstream.ConsumerConfig{
+		Durable:       opts.Consumer,
+		AckPolicy:     jetstream.AckExplicitPolicy,
+		AckWait:       opts.AckWait,
+		MaxDeliver:    opts.MaxDeliver,
+		FilterSubject: opts.Subject,
+	})
+	if err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("error creating consumer %s on stream %s: %w", opts.Consumer, opts.Stream, err)
+	}
+
+	return &NATSSource{
+		conn:       conn,
+		consumer:   consumer,
+		pipeline:   pipeline,
+		instanceID: instanceID,
+		opts:       opts,
+	}, nil
+}
+
+// Start pulls batches until ctx is done, then drains the connection
+func (n *NATSSource) Start(ctx context.Context) {
+	slog.Info("Starting JetStream consumer", "stream", n.opts.Stream, "consumer", n.opts.Consumer, "subject", n.opts.Subject)
+	defer func() {
+		if err := n.conn.Drain(); err != nil {
+			slog.Error("Error draining NATS connection", errAttr(err))
+		}
+	}()
+
+	for {
+		if ctx.Err() != nil {
+			slog.Info("Shutting down JetStream consumer")
+			return
+		}
+		done, err := n.pipeline.startFetch(ctx)
+		if err != nil {
+			continue
+		}
+
+		batch, err := n.consumer.Fetch(n.opts.BatchSize, jetstream.FetchMaxWait(5*time.Second))
+		if err != nil {
+			done()
+			slog.Error("Error fetching JetStream messages", "consumer", n.opts.Consumer, errAttr(err))
+			if sleepContext(ctx, 5*time.Second) != nil {
+				return
+			}
+			continue
+		}
+		for msg := range batch.Messages() {
+			n.handle(ctx, msg)
+		}
+		done()
+		if err := batch.Error(); err != nil && !errors.Is(err, nats.ErrTimeout) && ctx.Err() == nil {
+			slog.Error("Error fetching JetStream messages", "consumer", n.opts.Consumer, errAttr(err))
+		}
+	}
+}
+
+func (n *NATSSource) handle(ctx context.Context, msg jetstream.Msg) {
+	headers := propagation.MapCarrier{}
+	for key, values := range msg.Headers() {
+		if len(values) > 0 {
+			headers[key] = values[0]
+		}
+	}
+
+	id := msg.Subject()
+	attempt := ""
+	delivered := uint64(1)
+	if meta, err := msg.Metadata(); err == nil {
+		id = meta.Stream + "/" + strconv.FormatUint(meta.Sequence.Stream, 10)
+		attempt = strconv.FormatUint(meta.NumDelivered, 10)
+		delivered = max(meta.NumDelivered, 1)
+	}
+	// Publishers deduplicating with Nats-Msg-Id keep that ID across retries
+	dedupID := id
+	if msgID := headers[nats.MsgIdHdr]; msgID != "" {
+		dedupID = msgID
+	}
+
+	acked := n.pipeline.process(ctx, InboundMessage{
+		System:  "nats",
+		ID:      id,
+		Body:    msg.Data(),
+		Attempt: attempt,
+		DedupID: dedupID,
+		Headers: headers,
+		Ack: func(ctx context.Context) {
+			if err := msg.Ack(); err != nil {
+				loggerFrom(ctx).Error("Error acking JetStream message", errAttr(err))
+			}
+		},
+		Defer: func(ctx context.Context, delay time.Duration) {
+			if err := msg.NakWithDelay(delay); err != nil {
+				loggerFrom(ctx).Error("Error deferring JetStream message", errAttr(err))
+			}
+		},
+	})
+	if acked {
+		return
+	}
+	backoff := min(n.opts.RetryBackoff<<min(delivered-1, 16), time.Minute)
+	if err := msg.NakWithDelay(backoff); err != nil {
+		slog.Error("Error naking JetStream message", "message_id", id, errAttr(err))
+	}
+}
+
+// CheckConnection reports whether the NATS connection is up
+func (n *NATSSource) CheckConnection(context.Context) error {
+	if !n.conn.IsConnected() {
+		return fmt.Errorf("NATS connection is %s", n.conn.Status())
+	}
+	return nil
+}
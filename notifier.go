@@ -0,0 +1,264 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"text/template"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+type EventType string
+
+const (
+	EventHealthChanged EventType = "health_changed"
+	EventCircuitOpened EventType = "circuit_opened"
+	EventShutdown      EventType = "shutdown"
+)
+
+// OperationalEvent is rendered through the template of its type
+type OperationalEvent struct {
+	Type       EventType         `json:"type"`
+	InstanceID string            `json:"instanceId"`
+	Timestamp  time.Time         `json:"timestamp"`
+	Fields     map[string]string `json:"fields"`
+}
+
+var defaultEventTemplates = map[EventType]string{
+	EventHealthChanged: `:rotating_light: Lambda *{{.Fields.id}}* is now *{{.Fields.status}}* (was {{.Fields.previous}}) - {{.Fields.arn}}`,
+	EventCircuitOpened: `:zap: Circuit breaker opened for {{.Fields.arn}}: {{.Fields.reason}}`,
+	EventShutdown:      `:wave: Orchestrator {{.InstanceID}} is shutting down ({{.Fields.reason}})`,
+}
+
+// WebhookNotifier posts operational events to a Slack-compatible incoming
+// webhook ({"text": ...}, with the raw event alongside for generic
+// receivers). Events over the rate limit are dropped.
+type WebhookNotifier struct {
+	url        atomic.Pointer[string]
+	instanceID string
+	client     *http.Client
+	templates  map[EventType]*template.Template
+	limiter    *tokenBucket
+	events     *CloudEvents // sets the CloudEvents headers when they are emitted
+
+	wg sync.WaitGroup
+}
+
+// NewWebhookNotifier parses the default templates, overridden by the
+// optional JSON/YAML file mapping event types to Go templates
+func NewWebhookNotifier(url, instanceID, templatesFile string, perMinute int, events *CloudEvents) (*WebhookNotifier, error) {
+	sources := make(map[EventType]string, len(defaultEventTemplates))
+	for eventType, source := range defaultEventTemplates {
+		sources[eventType] = source
+	}
+
+	if templatesFile != "" {
+		data, err := os.ReadFile(templatesFile)
+		if err != nil {
+			return nil, fmt.Errorf("error reading %s: %w", templatesFile, err)
+		}
+		var overrides map[EventType]string
+		if err := yaml.Unmarshal(data, &overrides); err != nil {
+			return nil, fmt.Errorf("error parsing %s: %w", templatesFile, err)
+		}
+		for eventType, source := range overrides {
+			sources[eventType] = source
+		}
+	}
+
+	templates := make(map[EventType]*template.Template, len(sources))
+	for eventType, source := range sources {
+		tmpl, err := template.New(string(eventType)).Option("missingkey=zero").Parse(source)
+		if err != nil {
+			return nil, fmt.Errorf("invalid template for %s: %w", eventType, err)
+		}
+		templates[eventType] = tmpl
+	}
+
+	n := &WebhookNotifier{
+		instanceID: instanceID,
+		client:     &http.Client{Timeout: 5 * time.Second},
+		templates:  templates,
+		limiter:    newTokenBucket(float64(perMinute)/60, perMinute),
+		events:     events,
+	}
+	n.SetURL(url)
+	return n, nil
+}
+
+// SetURL changes the webhook URL, e.g. when its secret is rotated
+func (n *WebhookNotifier) SetURL(url string) {
+	n.url.Store(&url)
+}
+
+// Notify sends the event in the background. It is a no-op on a nil notifier.
+func (n *WebhookNotifier) Notify(eventType EventType, fields map[string]string) {
+	if n == nil {
+		return
+	}
+
+	if !n.limiter.Allow() {
+		slog.Warn("Webhook rate limit reached, dropping event", "event", eventType)
+		return
+	}
+
+	event := OperationalEvent{
+		Type:       eventType,
+		InstanceID: n.instanceID,
+		Timestamp:  time.Now().UTC(),
+		Fields:     fields,
+	}
+
+	n.wg.Add(1)
+	go func() {
+		defer n.wg.Done()
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+		if err := n.post(ctx, event); err != nil {
+			slog.Error("Error posting webhook notification", "event", eventType, errAttr(err))
+		}
+	}()
+}
+
+// SetRateLimit changes the number of notifications allowed per minute
+func (n *WebhookNotifier) SetRateLimit(perMinute int) {
+	n.limiter.SetRate(float64(perMinute)/60, perMinute)
+}
+
+// Wait blocks until the pending notifications are sent
+func (n *WebhookNotifier) Wait() {
+	if n == nil {
+		return
+	}
+	n.wg.Wait()
+}
+
+func (n *WebhookNotifier) post(ctx context.Context, event OperationalEvent) error {
+	var text strings.Builder
+	if tmpl, ok := n.templates[event.Type]; ok {
+		if err := tmpl.Execute(&text, event); err != nil {
+			return fmt.Errorf("error rendering template: %w", err)
+		}
+	} else {
+		fmt.Fprintf(&text, "%s: %v", event.Type, event.Fields)
+	}
+
+	body, err := json.Marshal(map[string]any{"text": text.String(), "event": event})
+	if err != nil {
+		return fmt.Errorf("error marshaling notification: %w", err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, *n.url.Load(), bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("error building request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	// Binary-mode CloudEvent: the body stays readable by Slack
+	if n.events.emits() {
+		n.events.SetHeaders(req.Header, string(event.Type), newCorrelationID())
+	}
+
+	resp, err := n.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("error calling webhook: %w", err)
+	}
+	resp.Body.Close()
+
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("webhook returned %s", resp.Status)
+	}
+	return nil
+}
+
+// tokenBucket is a simple rate limiter refilling rate tokens per second up
+// to burst
+type tokenBucket struct {
+	rate  float64
+	burst float64
+
+	mu     sync.Mutex
+	tokens float64
+	last   time.Time
+}
+
+func newTokenBucket(rate float64, burst int) *tokenBucket {
+	return &tokenBucket{
+		rate:   rate,
+		burst:  float64(burst),
+		tokens: float64(burst),
+		last:   time.Now(),
+	}
+}
+
+// SetRate changes the refill rate and burst, keeping the current tokens
+func (b *tokenBucket) SetRate(rate float64, burst int) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.rate = rate
+	b.burst = float64(burst)
+	b.tokens = min(b.tokens, b.burst)
+}
+
+func (b *tokenBucket) Allow() bool {
+	return b.reserve() == 0
+}
+
+// Wait blocks until a token is available or ctx is done
+func (b *tokenBucket) Wait(ctx context.Context) error {
+	for {
+		wait := b.reserve()
+		if wait == 0 {
+			return nil
+		}
+		if err := sleepContext(ctx, wait); err != nil {
+			return err
+		}
+	}
+}
+
+// Delay returns how long until a token is available, without taking it
+func (b *tokenBucket) Delay() time.Duration {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.refill()
+	if b.tokens >= 1 {
+		return 0
+	}
+	return time.Duration((1 - b.tokens) / b.rate * float64(time.Second))
+}
+
+// Ready reports whether a token is available, without taking it
+func (b *tokenBucket) Ready() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.refill()
+	return b.tokens >= 1
+}
+
+func (b *tokenBucket) refill() {
+	now := time.Now()
+	b.tokens = min(b.burst, b.tokens+now.Sub(b.last).Seconds()*b.rate)
+	b.last = now
+}
+
+// reserve takes a token, or returns how long until one is available
+func (b *tokenBucket) reserve() time.Duration {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.refill()
+	if b.tokens < 1 {
+		return max(time.Duration((1-b.tokens)/b.rate*float64(time.Second)), time.Millisecond)
+	}
+	b.tokens--
+	return 0
+}
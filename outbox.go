@@ -0,0 +1,289 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"strconv"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue"
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/expression"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"go.opentelemetry.io/otel/propagation"
+)
+
+var outboxRows = NewCounterVec(
+	"orchestrator_outbox_rows_total",
+	"Outbox rows handled by this instance, by outcome (dispatched, retried, failed, conflict).",
+	"outcome",
+)
+
+// Outbox row states. Producers write rows as pending; the relay claims them,
+// and marks them dispatched once processed or failed after MaxAttempts.
+const (
+	OutboxPending    = "pending"
+	OutboxClaimed    = "claimed"
+	OutboxDispatched = "dispatched"
+	OutboxFailed     = "failed"
+)
+
+// OutboxRow is a row of the outbox table. The table is shared with the
+// producing services, so its attributes follow their naming.
+type OutboxRow struct {
+	ID string `dynamodbav:"id"`
+	// Payload is the message: a JSON string or a map
+	Payload       any    `dynamodbav:"payload"`
+	Status        string `dynamodbav:"status"`
+	CorrelationID string `dynamodbav:"correlationId,omitempty"`
+	Attempts      int    `dynamodbav:"attempts"`
+	ClaimedBy     string `dynamodbav:"claimedBy,omitempty"`
+	ClaimedUntil  int64  `dynamodbav:"claimedUntil"` // unix seconds
+}
+
+// OutboxOptions configures the outbox relay
+type OutboxOptions struct {
+	// StatusIndex is a GSI keyed by status that projects every attribute
+	StatusIndex  string
+	BatchSize    int
+	PollInterval time.Duration // wait after a poll that found no rows
+	// ClaimTimeout is how long a claim blocks other replicas. A row whose
+	// processing failed is retried once its claim lapses, as with the SQS
+	// visibility timeout.
+	ClaimTimeout time.Duration
+	MaxAttempts  int
+}
+
+// OutboxSource relays the pending rows of a DynamoDB outbox table through
+// the same pipeline as the SQS queue. Each row is claimed with a conditional
+// update, so replicas never process a row at the same time.
+type OutboxSource struct {
+	db         *DynamoDBClient
+	consumer   *SQSConsumer
+	instanceID string
+	opts       OutboxOptions
+}
+
+func NewOutboxSource(consumer *SQSConsumer, db *DynamoDBClient, instanceID string, opts OutboxOptions) *OutboxSource {
+	return &OutboxSource{
+		db:         db,
+		consumer:   consumer,
+		instanceID: instanceID,
+		opts:       opts,
+	}
+}
+
+// Start polls the outbox until ctx is done
+func (o *OutboxSource) Start(ctx context.Context) {
+	slog.Info("Starting outbox relay", "table", o.db.tableName, "status_index", o.opts.StatusIndex)
+
+	for {
+		if ctx.Err() != nil {
+			slog.Info("Shutting down outbox relay")
+			return
+		}
+		done, err := o.consumer.startFetch(ctx)
+		if err != nil {
+			continue
+		}
+
+		rows, err := o.poll(ctx)
+		if err != nil && ctx.Err() == nil {
+			slog.Error("Error polling outbox", "table", o.db.tableName, errAttr(err))
+		}
+		claimed := 0
+		for _, row := range rows {
+			if o.relay(ctx, row) {
+				claimed++
+			}
+		}
+		done()
+		// Rows claimed by other replicas would otherwise be polled again at once
+		if claimed == 0 && sleepContext(ctx, o.opts.PollInterval) != nil {
+			return
+		}
+	}
+}
+
+// poll returns up to BatchSize rows that are pending or whose claim lapsed,
+// alternating between both, so a backlog of pending rows does not starve
+// the retries
+func (o *OutboxSource) poll(ctx context.Context) ([]OutboxRow, error) {
+	pending, err := expression.NewBuilder().
+		WithKeyCondition(expression.Key("status").Equal(expression.Value(OutboxPending))).
+		Build()
+	if err != nil {
+		return nil, fmt.Errorf("error building outbox query: %w", err)
+	}
+	expired, err := expression.NewBuilder().
+		WithKeyCondition(expression.Key("status").Equal(expression.Value(OutboxClaimed))).
+		WithFilter(expression.Name("claimedUntil").LessThan(expression.Value(time.Now().Unix()))).
+		Build()
+	if err != nil {
+		return nil, fmt.Errorf("error building outbox query: %w", err)
+	}
+
+	var found [][]map[string]types.AttributeValue
+	for _, expr := range []expression.Expression{expired, pending} {
+		items, err := o.db.QueryIndex(ctx, o.opts.StatusIndex, expr)
+		if err != nil {
+			return nil, err
+		}
+		found = append(found, items)
+	}
+
+	var items []map[string]types.AttributeValue
+	for i := 0; len(items) < o.opts.BatchSize && i < max(len(found[0]), len(found[1])); i++ {
+		for _, list := range found {
+			if i < len(list) && len(items) < o.opts.BatchSize {
+				items = append(items, list[i])
+			}
+		}
+	}
+	var rows []OutboxRow
+	if err := attributevalue.UnmarshalListOfMaps(items, &rows); err != nil {
+		return nil, fmt.Errorf("error unmarshaling outbox rows: %w", err)
+	}
+	return rows, nil
+}
+
+// relay claims a row and processes it, reporting whether it was claimed. A
+// row left unacknowledged stays claimed until its claim lapses; after
+// MaxAttempts it is marked failed.
+func (o *OutboxSource) relay(ctx context.Context, row OutboxRow) bool {
+	logger := slog.Default().With("outbox_id", row.ID)
+
+	claimed, err := o.claim(ctx, row)
+	if err != nil {
+		logger.Error("Error claiming outbox row", errAttr(err))
+		return false
+	}
+	if !claimed {
+		outboxRows.Inc("conflict")
+		return false
+	}
+	row.Attempts++
+
+	body, err := outboxBody(row.Payload)
+	if err != nil {
+		logger.Error("Outbox row has an invalid payload", errAttr(err))
+		if err := o.finish(ctx, row.ID, OutboxFailed); err != nil {
+			logger.Error("Error marking outbox row as failed", errAttr(err))
+			return true
+		}
+		outboxRows.Inc("failed")
+		return true
+	}
+	headers := propagation.MapCarrier{}
+	if row.CorrelationID != "" {
+		headers[correlationIDField] = row.CorrelationID
+	}
+
+	acked := o.consumer.process(ctx, InboundMessage{
+		System:  "aws_dynamodb",
+		ID:      row.ID,
+		Body:    body,
+		Attempt: strconv.Itoa(row.Attempts),
+		DedupID: row.ID,
+		Headers: headers,
+		Ack: func(ctx context.Context) {
+			if err := o.finish(ctx, row.ID, OutboxDispatched); err != nil {
+				loggerFrom(ctx).Error("Error marking outbox row as dispatched", errAttr(err))
+				return
+			}
+			outboxRows.Inc("dispatched")
+		},
+		Defer: func(ctx context.Context, delay time.Duration) {
+			if err := o.release(ctx, row, delay); err != nil {
+				loggerFrom(ctx).Error("Error deferring outbox row", errAttr(err))
+			}
+		},
+	})
+	if acked {
+		return true
+	}
+
+	if row.Attempts < o.opts.MaxAttempts {
+		outboxRows.Inc("retried")
+		return true
+	}
+	logger.Error("Outbox row failed on every attempt", "attempts", row.Attempts)
+	if err := o.finish(ctx, row.ID, OutboxFailed); err != nil {
+		logger.Error("Error marking outbox row as failed", errAttr(err))
+		return true
+	}
+	outboxRows.Inc("failed")
+	return true
+}
+
+// claim takes the row unless another replica claimed it first
+func (o *OutboxSource) claim(ctx context.Context, row OutboxRow) (bool, error) {
+	now := time.Now()
+	status := expression.Name("status")
+	condition := status.Equal(expression.Value(OutboxPending)).
+		Or(status.Equal(expression.Value(OutboxClaimed)).
+			And(expression.Name("claimedUntil").LessThan(expression.Value(now.Unix()))))
+	update := expression.Set(status, expression.Value(OutboxClaimed)).
+		Set(expression.Name("claimedBy"), expression.Value(o.instanceID)).
+		Set(expression.Name("claimedUntil"), expression.Value(now.Add(o.opts.ClaimTimeout).Unix())).
+		Set(expression.Name("attempts"), expression.Value(row.Attempts+1))
+
+	expr, err := expression.NewBuilder().WithCondition(condition).WithUpdate(update).Build()
+	if err != nil {
+		return false, fmt.Errorf("error building outbox claim: %w", err)
+	}
+	err = o.db.UpdateItem(ctx, itemKey(row.ID), expr)
+	if isConditionFailed(err) {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+// release lets the claim of the row lapse after delay and gives back the
+// attempt it took
+func (o *OutboxSource) release(ctx context.Context, row OutboxRow, delay time.Duration) error {
+	condition := expression.Name("claimedBy").Equal(expression.Value(o.instanceID))
+	update := expression.Set(expression.Name("claimedUntil"), expression.Value(time.Now().Add(delay).Unix())).
+		Set(expression.Name("attempts"), expression.Value(row.Attempts-1))
+
+	expr, err := expression.NewBuilder().WithCondition(condition).WithUpdate(update).Build()
+	if err != nil {
+		return fmt.Errorf("error building outbox release: %w", err)
+	}
+	return o.db.UpdateItem(ctx, itemKey(row.ID), expr)
+}
+
+// finish moves a row claimed by this instance to its final state
+func (o *OutboxSource) finish(ctx context.Context, id, status string) error {
+	condition := expression.Name("claimedBy").Equal(expression.Value(o.instanceID))
+	update := expression.Set(expression.Name("status"), expression.Value(status)).
+		Set(expression.Name("finishedAt"), expression.Value(time.Now().UTC().Format(time.RFC3339))).
+		Remove(expression.Name("claimedBy")).
+		Remove(expression.Name("claimedUntil"))
+
+	expr, err := expression.NewBuilder().WithCondition(condition).WithUpdate(update).Build()
+	if err != nil {
+		return fmt.Errorf("error building outbox update: %w", err)
+	}
+	return o.db.UpdateItem(ctx, itemKey(id), expr)
+}
+
+// CheckTable verifies the outbox table is reachable with the current
+// credentials
+func (o *OutboxSource) CheckTable(ctx context.Context) error {
+	_, err := o.db.DescribeTable(ctx)
+	return err
+}
+
+// outboxBody returns the payload as JSON; nil when the row has none
+func outboxBody(payload any) ([]byte, error) {
+	switch payload := payload.(type) {
+	case nil:
+		return nil, nil
+	case string:
+		return []byte(payload), nil
+	default:
+		return json.Marshal(payload)
+	}
+}
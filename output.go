@@ -0,0 +1,129 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/sqs"
+	"github.com/aws/aws-sdk-go-v2/service/sqs/types"
+)
+
+var outputMessages = NewCounterVec(
+	"orchestrator_output_messages_total",
+	"Worker responses forwarded to the output queue, by result.",
+	"result",
+)
+
+// cloudEventResponse names the CloudEvent type of the output messages, e.g.
+// orchestrator.response
+const cloudEventResponse = "response"
+
+// OutputMessage wraps a worker response with the metadata of the request
+// that produced it
+type OutputMessage struct {
+	SourceMessageID string          `json:"sourceMessageId"`
+	CorrelationID   string          `json:"correlationId,omitempty"`
+	LambdaARN       string          `json:"lambdaArn"`
+	LambdaName      string          `json:"lambdaName,omitempty"`
+	InstanceID      string          `json:"instanceId"`
+	ProcessedAt     time.Time       `json:"processedAt"`
+	DurationMs      int64           `json:"durationMs"`
+	Response        json.RawMessage `json:"response"`
+}
+
+// OutputQueue forwards worker responses to an SQS queue, the next stage of
+// the pipeline. A nil *OutputQueue drops them.
+type OutputQueue struct {
+	client     *sqs.Client
+	queueURL   string
+	instanceID string
+	fifo       bool
+	events     *CloudEvents // wraps the messages when CloudEvents are emitted
+}
+
+func NewOutputQueue(queueURL string, cfg aws.Config, instanceID string, events *CloudEvents) *OutputQueue {
+	return &OutputQueue{
+		client: sqs.NewFromConfig(cfg, func(o *sqs.Options) {
+			if endpoint := awsEndpoint("SQS"); endpoint != "" {
+				o.BaseEndpoint = aws.String(endpoint)
+			}
+		}),
+		queueURL:   queueURL,
+		instanceID: instanceID,
+		fifo:       strings.HasSuffix(queueURL, ".fifo"),
+		events:     events,
+	}
+}
+
+// Send forwards the response of worker to the message with sourceID. A
+// response that is not JSON is sent as a JSON string.
+func (q *OutputQueue) Send(ctx context.Context, sourceID string, worker Lambda, response []byte, elapsed time.Duration) error {
+	if q == nil {
+		return nil
+	}
+
+	payload := json.RawMessage(response)
+	if !json.Valid(response) {
+		quoted, err := json.Marshal(string(response))
+		if err != nil {
+			return fmt.Errorf("error marshaling response: %w", err)
+		}
+		payload = quoted
+	}
+
+	correlationID := correlationIDFrom(ctx)
+	output := OutputMessage{
+		SourceMessageID: sourceID,
+		CorrelationID:   correlationID,
+		LambdaARN:       worker.ARN,
+		LambdaName:      worker.Name,
+		InstanceID:      q.instanceID,
+		ProcessedAt:     time.Now().UTC(),
+		DurationMs:      elapsed.Milliseconds(),
+		Response:        payload,
+	}
+	var body []byte
+	var err error
+	if q.events.emits() {
+		// A structured-mode CloudEvent whose ID is the source message ID, so
+		// the responses of a redelivered message share it
+		body, err = q.events.Envelope(cloudEventResponse, sourceID, worker.Name, output)
+	} else {
+		body, err = json.Marshal(output)
+	}
+	if err != nil {
+		return fmt.Errorf("error marshaling output message: %w", err)
+	}
+
+	input := &sqs.SendMessageInput{
+		QueueUrl:    aws.String(q.queueURL),
+		MessageBody: aws.String(string(body)),
+		MessageAttributes: map[string]types.MessageAttributeValue{
+			"correlationId": {DataType: aws.String("String"), StringValue: aws.String(correlationID)},
+		},
+	}
+	if correlationID == "" {
+		input.MessageAttributes = nil
+	}
+	// FIFO queues keep the responses of a correlation ID in order and drop
+	// the duplicates of a redelivered source message
+	if q.fifo {
+		group := correlationID
+		if group == "" {
+			group = sourceID
+		}
+		input.MessageGroupId = aws.String(group)
+		input.MessageDeduplicationId = aws.String(sourceID)
+	}
+
+	if _, err := q.client.SendMessage(ctx, input); err != nil {
+		outputMessages.Inc("failure")
+		return fmt.Errorf("error sending response to %s: %w", q.queueURL, err)
+	}
+	outputMessages.Inc("success")
+	return nil
+}
@@ -0,0 +1,121 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"sync"
+	"time"
+)
+
+// errRetiring rejects resuming an instance that is draining
+var errRetiring = errors.New("the instance is draining and cannot resume")
+
+var consumerPaused = NewGaugeVec(
+	"orchestrator_consumer_paused",
+	"1 while consumption is paused through the control plane.",
+)
+
+// PauseState describes why and since when consumption is paused
+type PauseState struct {
+	Reason   string    `json:"reason,omitempty"`
+	PausedAt time.Time `json:"pausedAt"`
+}
+
+// Pause stops every source from fetching new messages. Messages already
+// being processed finish, and the liveness probe stays fresh. Pausing again
+// keeps the original state.
+func (c *SQSConsumer) Pause(reason string) *PauseState {
+	state := &PauseState{Reason: reason, PausedAt: time.Now()}
+	if !c.paused.CompareAndSwap(nil, state) {
+		return c.paused.Load()
+	}
+	consumerPaused.Set(1)
+	slog.Warn("Consumption paused", "reason", reason)
+	return state
+}
+
+// Retire pauses consumption for good, replacing any other pause: Resume
+// fails from then on
+func (c *SQSConsumer) Retire(reason string) *PauseState {
+	c.retiring.Store(true)
+	state := &PauseState{Reason: reason, PausedAt: time.Now()}
+	c.paused.Store(state)
+	consumerPaused.Set(1)
+	slog.Warn("Consumption paused for retirement", "reason", reason)
+	return state
+}
+
+// Resume lets the sources fetch again, unless the instance is retiring
+func (c *SQSConsumer) Resume() error {
+	if c.retiring.Load() {
+		return errRetiring
+	}
+	if c.paused.Swap(nil) == nil {
+		return nil
+	}
+	consumerPaused.Set(0)
+	slog.Info("Consumption resumed")
+	return nil
+}
+
+// Paused returns the pause state, or nil while consuming
+func (c *SQSConsumer) Paused() *PauseState {
+	return c.paused.Load()
+}
+
+// SetPollDelay makes every source wait delay before each fetch, to lower the
+// poll rate without pausing; 0 removes the wait. Each reason sets its own
+// delay and the longest applies, so the handoff and the budget do not undo
+// each other.
+func (c *SQSConsumer) SetPollDelay(reason string, delay time.Duration) {
+	c.delayMu.Lock()
+	defer c.delayMu.Unlock()
+	if c.pollDelays == nil {
+		c.pollDelays = make(map[string]time.Duration)
+	}
+	if delay > 0 {
+		c.pollDelays[reason] = delay
+	} else {
+		delete(c.pollDelays, reason)
+	}
+	longest := time.Duration(0)
+	for _, d := range c.pollDelays {
+		longest = max(longest, d)
+	}
+	c.pollDelay.Store(int64(longest))
+}
+
+// startFetch blocks a source before it fetches while consumption is paused,
+// then waits the poll delay. The source counts as fetching until it calls
+// done, once the fetched messages are acknowledged or left, so a drain waits
+// for a long poll in progress and the rest of its batch.
+func (c *SQSConsumer) startFetch(ctx context.Context) (done func(), err error) {
+	for {
+		for c.paused.Load() != nil {
+			c.touch()
+			if err := sleepContext(ctx, time.Second); err != nil {
+				return nil, err
+			}
+		}
+		if delay := time.Duration(c.pollDelay.Load()); delay > 0 {
+			c.touch()
+			if err := sleepContext(ctx, delay); err != nil {
+				return nil, err
+			}
+		}
+
+		// Counted before the pause is checked again, so a drain sees either
+		// this fetch or the source sees the pause
+		c.fetching.Add(1)
+		if c.paused.Load() == nil {
+			return sync.OnceFunc(func() { c.fetching.Add(-1) }), nil
+		}
+		c.fetching.Add(-1)
+	}
+}
+
+// Idle reports whether no source is fetching and no message is in flight
+func (c *SQSConsumer) Idle() bool {
+	return c.fetching.Load() == 0 && c.inFlight.Load() == 0
+}
@@ -0,0 +1,166 @@
+package main
+
+import (
+	"context"
+	"log/slog"
+	"math"
+	"sync"
+	"time"
+)
+
+// pollerLatencyAlpha is the weight of the latest message in the latency EWMA
+const pollerLatencyAlpha = 0.2
+
+var sqsPollers = NewGaugeVec(
+	"orchestrator_sqs_pollers",
+	"Concurrent SQS poll loops of this replica.",
+)
+
+// pollerPool runs the poll loops of the SQS queues. Each loop receives a
+// batch and processes it before receiving the next, so more loops process
+// more messages at a time. A stopped loop finishes its current batch.
+type pollerPool struct {
+	mu    sync.Mutex
+	ctx   context.Context // nil until the consumer starts
+	loop  func(ctx context.Context, stop <-chan struct{})
+	stops []chan struct{}
+	wg    sync.WaitGroup
+
+	latency float64 // EWMA of the seconds to process a message
+}
+
+// start runs n loops until ctx is done
+func (p *pollerPool) start(ctx context.Context, n int, loop func(context.Context, <-chan struct{})) {
+	p.mu.Lock()
+	p.ctx, p.loop = ctx, loop
+	p.mu.Unlock()
+	p.resize(n)
+}
+
+// resize starts or stops loops until n are running
+func (p *pollerPool) resize(n int) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.ctx == nil || p.ctx.Err() != nil {
+		return
+	}
+	for len(p.stops) < n {
+		stop := make(chan struct{})
+		p.stops = append(p.stops, stop)
+		p.wg.Add(1)
+		go func() {
+			defer p.wg.Done()
+			p.loop(p.ctx, stop)
+		}()
+	}
+	for len(p.stops) > n {
+		close(p.stops[len(p.stops)-1])
+		p.stops = p.stops[:len(p.stops)-1]
+	}
+	sqsPollers.Set(float64(n))
+}
+
+func (p *pollerPool) size() int {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return len(p.stops)
+}
+
+// wait blocks until every loop has returned
+func (p *pollerPool) wait() {
+	p.wg.Wait()
+}
+
+func (p *pollerPool) observe(duration time.Duration) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.latency == 0 {
+		p.latency = duration.Seconds()
+		return
+	}
+	p.latency += pollerLatencyAlpha * (duration.Seconds() - p.latency)
+}
+
+func (p *pollerPool) messageLatency() time.Duration {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return time.Duration(p.latency * float64(time.Second))
+}
+
+// Pollers returns the SQS poll loops running
+func (c *SQSConsumer) Pollers() int {
+	return c.pollers.size()
+}
+
+// SetPollers runs n SQS poll loops; it does nothing before Start
+func (c *SQSConsumer) SetPollers(n int) {
+	c.pollers.resize(n)
+}
+
+// MessageLatency returns the EWMA of the time to process an SQS message
+func (c *SQSConsumer) MessageLatency() time.Duration {
+	return c.pollers.messageLatency()
+}
+
+// PollerScaler sizes the SQS poll loops between min and max from the depth
+// of the queues sampled by the QueueMonitor and the processing latency: as
+// many loops as drain the visible messages within target. It scales up at
+// once during a burst and down one loop per run, so a brief lull does not
+// drop them all.
+type PollerScaler struct {
+	consumer *SQSConsumer
+	monitor  *QueueMonitor
+	min, max int
+	target   time.Duration
+}
+
+func NewPollerScaler(consumer *SQSConsumer, monitor *QueueMonitor, minPollers, maxPollers int, target time.Duration) *PollerScaler {
+	return &PollerScaler{
+		consumer: consumer,
+		monitor:  monitor,
+		min:      minPollers,
+		max:      maxPollers,
+		target:   target,
+	}
+}
+
+// Scale adjusts the poll loops to the last queue sample
+func (s *PollerScaler) Scale(ctx context.Context) error {
+	// Under sharding, only the queues this replica polls
+	visible := int64(0)
+	sampled := false
+	owned := ownedQueues(s.consumer.queues)
+	for _, stats := range s.monitor.QueueStats() {
+		for _, queue := range owned {
+			if queue.name == stats.Queue {
+				visible += stats.Visible
+				sampled = true
+			}
+		}
+	}
+	current := s.consumer.Pollers()
+	if !sampled || current == 0 {
+		return nil
+	}
+
+	desired := s.min
+	latency := s.consumer.MessageLatency()
+	switch {
+	case latency > 0:
+		desired = int(math.Ceil(float64(visible) * latency.Seconds() / s.target.Seconds()))
+	case visible > 0:
+		// No message processed yet to estimate from
+		desired = current + 1
+	}
+	desired = min(max(desired, s.min), s.max)
+	if desired < current {
+		desired = current - 1
+	}
+	if desired == current {
+		return nil
+	}
+
+	slog.Info("Scaling SQS pollers", "from", current, "to", desired, "visible", visible, "message_latency", latency)
+	s.consumer.SetPollers(desired)
+	return nil
+}
@@ -0,0 +1,19 @@
+package main
+
+import (
+	"net/http"
+	"net/http/pprof"
+
+	"challenge-4-orchestrator/config"
+)
+
+// RegisterProfiling mounts the net/http/pprof handlers behind the debug
+// group authentication. pprof.Index resolves profiles by name under
+// /debug/pprof/, so the handlers keep their standard paths.
+func (a *AdminAPI) RegisterProfiling(mux *http.ServeMux) {
+	a.handle(mux, config.AuthGroupDebug, "GET /debug/pprof/", pprof.Index)
+	a.handle(mux, config.AuthGroupDebug, "GET /debug/pprof/cmdline", pprof.Cmdline)
+	a.handle(mux, config.AuthGroupDebug, "GET /debug/pprof/profile", pprof.Profile)
+	a.handle(mux, config.AuthGroupDebug, "/debug/pprof/symbol", pprof.Symbol)
+	a.handle(mux, config.AuthGroupDebug, "GET /debug/pprof/trace", pprof.Trace)
+}
@@ -0,0 +1,152 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// maxProcessBody matches the SQS message size limit
+const maxProcessBody = 256 << 10
+
+// correlationIDHeader carries the correlation ID of synchronous requests
+const correlationIDHeader = "X-Correlation-Id"
+
+var processRequests = NewCounterVec(
+	"orchestrator_process_requests_total",
+	"Synchronous POST /v1/process requests, by HTTP status code.",
+	"code",
+)
+
+// ProcessAPI serves POST /v1/process: the payload goes through the same
+// pipeline as a queued message, with its tenant and rate limits, budget
+// guard and output forwarding, and the worker response is returned to the
+// caller. Requests beyond the concurrency cap or a limit are rejected with
+// 429 rather than queued.
+type ProcessAPI struct {
+	consumer *SQSConsumer
+	auth     Authenticator
+	timeout  time.Duration
+	slots    chan struct{}
+}
+
+func NewProcessAPI(consumer *SQSConsumer, auth Authenticator, timeout time.Duration, concurrency int) *ProcessAPI {
+	return &ProcessAPI{
+		consumer: consumer,
+		auth:     auth,
+		timeout:  timeout,
+		slots:    make(chan struct{}, concurrency),
+	}
+}
+
+func (p *ProcessAPI) Register(mux *http.ServeMux) {
+	mux.Handle("POST /v1/process", requireAuth(p.auth, http.HandlerFunc(p.process)))
+}
+
+func (p *ProcessAPI) process(w http.ResponseWriter, r *http.Request) {
+	select {
+	case p.slots <- struct{}{}:
+		defer func() { <-p.slots }()
+	default:
+		w.Header().Set("Retry-After", "1")
+		p.writeError(w, http.StatusTooManyRequests, "too many concurrent requests")
+		return
+	}
+	if p.consumer.Paused() != nil {
+		w.Header().Set("Retry-After", "30")
+		p.writeError(w, http.StatusServiceUnavailable, "processing is paused")
+		return
+	}
+
+	body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxProcessBody))
+	if err != nil {
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			p.writeError(w, http.StatusRequestEntityTooLarge, "payload exceeds 256 KiB")
+			return
+		}
+		p.writeError(w, http.StatusBadRequest, "error reading payload")
+		return
+	}
+	var msg any
+	if err := json.Unmarshal(body, &msg); err != nil {
+		p.writeError(w, http.StatusBadRequest, "payload is not valid JSON")
+		return
+	}
+
+	correlationID := r.Header.Get(correlationIDHeader)
+	if correlationID == "" {
+		correlationID = messageCorrelationID(InboundMessage{}, msg)
+	}
+	requestID := "http-" + newCorrelationID()
+
+	ctx, cancel := context.WithTimeout(r.Context(), p.timeout)
+	defer cancel()
+	ctx, span := tracer.Start(ctx, "process request",
+		trace.WithSpanKind(trace.SpanKindServer),
+		trace.WithAttributes(
+			attribute.String("messaging.message.id", requestID),
+			attribute.String("correlation.id", correlationID),
+		),
+	)
+	logger := slog.Default().With("message_id", requestID, "correlation_id", correlationID)
+	timings := &stageTimings{}
+	ctx = withStageTimings(withLogger(withCorrelationID(withMessageID(ctx, requestID), correlationID), logger), timings)
+	started := time.Now()
+
+	// Without a dedup ID the request is not deduplicated; the middlewares
+	// log and count it
+	ctx = withTenant(ctx, p.consumer.tenants.Tenant(nil, propagation.HeaderCarrier(r.Header)))
+	w.Header().Set(correlationIDHeader, correlationID)
+	response, err := p.consumer.handler.Handle(ctx, msg)
+	endSpan(span, err)
+	if err != nil {
+		var skipped *skipError
+		switch {
+		case errors.As(err, &skipped) && ctx.Err() == nil:
+			retryAfter := max(1, int(skipped.retryAfter.Seconds()))
+			w.Header().Set("Retry-After", strconv.Itoa(retryAfter))
+			p.writeError(w, http.StatusTooManyRequests, skipped.reason)
+		case ctx.Err() != nil, errors.Is(err, context.DeadlineExceeded):
+			p.writeError(w, http.StatusGatewayTimeout, "processing timed out")
+		case errors.Is(err, ErrSchemaInvalid):
+			p.writeError(w, http.StatusUnprocessableEntity, err.Error())
+		case errors.Is(err, ErrIntegrityFailed):
+			p.writeError(w, http.StatusUnprocessableEntity, "integrity check failed")
+		case errors.Is(err, ErrInvokeThrottled):
+			p.writeError(w, http.StatusTooManyRequests, "worker lambda throttled")
+		case errors.Is(err, ErrNoHealthyLambdas), errors.Is(err, ErrRegistryUnavailable):
+			p.writeError(w, http.StatusServiceUnavailable, "no healthy worker lambdas")
+		default:
+			p.writeError(w, http.StatusBadGateway, "error processing payload")
+		}
+		return
+	}
+	logger.Debug("Synchronous request processed", "lambda_arn", response.Lambda.ARN, durationAttr(time.Since(started)))
+
+	// A response that is not JSON is passed through as text
+	w.Header().Set("X-Lambda-Arn", response.Lambda.ARN)
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	if json.Valid(response.Body) {
+		w.Header().Set("Content-Type", "application/json")
+	}
+	w.WriteHeader(http.StatusOK)
+	processRequests.Inc("200")
+	if _, err := w.Write(response.Body); err != nil {
+		logger.Warn("Error writing synchronous response", errAttr(err))
+	}
+}
+
+func (p *ProcessAPI) writeError(w http.ResponseWriter, status int, message string) {
+	processRequests.Inc(http.StatusText(status))
+	writeError(w, status, message)
+}
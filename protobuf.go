@@ -0,0 +1,169 @@
+package main
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"os"
+
+	"challenge-4-orchestrator/config"
+
+	"go.opentelemetry.io/otel/propagation"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protodesc"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/reflect/protoregistry"
+	"google.golang.org/protobuf/types/descriptorpb"
+	"google.golang.org/protobuf/types/dynamicpb"
+)
+
+var protobufMessages = NewCounterVec(
+	"orchestrator_protobuf_messages_total",
+	"Protobuf payloads decoded, by message type and result (decoded, invalid).",
+	"message_type", "result",
+)
+
+// ProtobufOptions configures the protobuf payloads
+type ProtobufOptions struct {
+	// DescriptorSet is a FileDescriptorSet with the message types and their
+	// imports (protoc --descriptor_set_out --include_imports)
+	DescriptorSet string
+	// TypeAttribute is the message attribute with the full message name
+	TypeAttribute string
+	// DefaultType decodes the messages without the attribute; empty leaves
+	// them as JSON
+	DefaultType string
+	Forward     string // ProtobufForwardJSON or ProtobufForwardBytes
+}
+
+// ProtobufCodec decodes protobuf payloads with the registered descriptors.
+// The pipeline sees the JSON mapping of the message, so the integrity check,
+// routing and handlers work unchanged; the workers get it back as protobuf
+// when Forward is ProtobufForwardBytes. A nil *ProtobufCodec decodes
+// nothing.
+type ProtobufCodec struct {
+	files *protoregistry.Files
+	opts  ProtobufOptions
+}
+
+// NewProtobufCodec loads the descriptor set and checks the default type is
+// in it
+func NewProtobufCodec(opts ProtobufOptions) (*ProtobufCodec, error) {
+	data, err := os.ReadFile(opts.DescriptorSet)
+	if err != nil {
+		return nil, fmt.Errorf("error reading %s: %w", opts.DescriptorSet, err)
+	}
+	var set descriptorpb.FileDescriptorSet
+	if err := proto.Unmarshal(data, &set); err != nil {
+		return nil, fmt.Errorf("error parsing descriptor set %s: %w", opts.DescriptorSet, err)
+	}
+	files, err := protodesc.NewFiles(&set)
+	if err != nil {
+		return nil, fmt.Errorf("error loading descriptor set %s: %w", opts.DescriptorSet, err)
+	}
+
+	p := &ProtobufCodec{files: files, opts: opts}
+	if opts.DefaultType != "" {
+		if _, err := p.descriptor(opts.DefaultType); err != nil {
+			return nil, err
+		}
+	}
+	return p, nil
+}
+
+func (p *ProtobufCodec) descriptor(name string) (protoreflect.MessageDescriptor, error) {
+	found, err := p.files.FindDescriptorByName(protoreflect.FullName(name))
+	if err != nil {
+		return nil, fmt.Errorf("unknown protobuf message type %s: %w", name, err)
+	}
+	descriptor, ok := found.(protoreflect.MessageDescriptor)
+	if !ok {
+		return nil, fmt.Errorf("protobuf type %s is not a message", name)
+	}
+	return descriptor, nil
+}
+
+// Decode returns the JSON mapping of a protobuf body and its type. Bodies
+// are base64, as SQS needs, or raw bytes from the other sources. Other
+// messages are returned unchanged with a nil type.
+func (p *ProtobufCodec) Decode(body []byte, headers propagation.TextMapCarrier) ([]byte, protoreflect.MessageDescriptor, error) {
+	if p == nil {
+		return body, nil, nil
+	}
+	name := p.opts.DefaultType
+	if headers != nil {
+		if attribute := headers.Get(p.opts.TypeAttribute); attribute != "" {
+			name = attribute
+		}
+	}
+	if name == "" {
+		return body, nil, nil
+	}
+
+	descriptor, err := p.descriptor(name)
+	if err != nil {
+		protobufMessages.Inc(name, "invalid")
+		return nil, nil, err
+	}
+	raw := body
+	if decoded, err := base64.StdEncoding.DecodeString(string(body)); err == nil {
+		raw = decoded
+	}
+	message := dynamicpb.NewMessage(descriptor)
+	if err := proto.Unmarshal(raw, message); err != nil {
+		protobufMessages.Inc(name, "invalid")
+		return nil, nil, fmt.Errorf("error decoding %s payload: %w", name, err)
+	}
+	decoded, err := protojson.Marshal(message)
+	if err != nil {
+		protobufMessages.Inc(name, "invalid")
+		return nil, nil, fmt.Errorf("error converting %s payload to JSON: %w", name, err)
+	}
+	protobufMessages.Inc(name, "decoded")
+	return decoded, descriptor, nil
+}
+
+// protobufPayload is the worker payload of a message forwarded as protobuf
+type protobufPayload struct {
+	MessageType string `json:"messageType"`
+	Data        []byte `json:"data"` // base64 in JSON
+}
+
+// WorkerPayload returns msg as the worker receives it: unchanged, or
+// encoded back to protobuf when the message was protobuf and Forward says
+// so. Fields the pipeline added that are not in the message type, such as
+// the correlation ID, are dropped.
+func (p *ProtobufCodec) WorkerPayload(ctx context.Context, msg any) (any, error) {
+	descriptor := protobufTypeFrom(ctx)
+	if p == nil || descriptor == nil || p.opts.Forward != config.ProtobufForwardBytes {
+		return msg, nil
+	}
+
+	data, err := json.Marshal(msg)
+	if err != nil {
+		return nil, fmt.Errorf("error marshaling payload: %w", err)
+	}
+	message := dynamicpb.NewMessage(descriptor)
+	if err := (protojson.UnmarshalOptions{DiscardUnknown: true}).Unmarshal(data, message); err != nil {
+		return nil, fmt.Errorf("error converting payload to %s: %w", descriptor.FullName(), err)
+	}
+	encoded, err := proto.Marshal(message)
+	if err != nil {
+		return nil, fmt.Errorf("error encoding %s payload: %w", descriptor.FullName(), err)
+	}
+	return protobufPayload{MessageType: string(descriptor.FullName()), Data: encoded}, nil
+}
+
+type protobufTypeKey struct{}
+
+// withProtobufType marks a message decoded from protobuf
+func withProtobufType(ctx context.Context, descriptor protoreflect.MessageDescriptor) context.Context {
+	return context.WithValue(ctx, protobufTypeKey{}, descriptor)
+}
+
+func protobufTypeFrom(ctx context.Context) protoreflect.MessageDescriptor {
+	descriptor, _ := ctx.Value(protobufTypeKey{}).(protoreflect.MessageDescriptor)
+	return descriptor
+}
@@ -0,0 +1,158 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"path"
+	"strings"
+
+	"challenge-4-orchestrator/config"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/aws/aws-sdk-go-v2/service/sqs"
+	sqstypes "github.com/aws/aws-sdk-go-v2/service/sqs/types"
+	"github.com/aws/smithy-go"
+)
+
+// startupTable is a table of the configuration, keyed by id
+type startupTable struct {
+	setting     string // dotted YAML path, for the errors
+	name        string
+	statusIndex string
+	cfg         aws.Config
+}
+
+// isAccessDenied reports errors of a role not allowed to describe a
+// resource, which does not mean the resource is missing
+func isAccessDenied(err error) bool {
+	var apiErr smithy.APIError
+	return errors.As(err, &apiErr) && strings.HasPrefix(apiErr.ErrorCode(), "AccessDenied")
+}
+
+// checkResources verifies before consuming that the queues exist and the
+// tables exist with the id key, and with provision creates the missing
+// ones, for dev environments. A role not allowed to describe a resource
+// only gets a warning, so least-privilege deployments keep starting.
+func checkResources(ctx context.Context, cfg *config.Config, awsCfg, registryCfg aws.Config, provision bool) error {
+	var errs []error
+
+	queues := make([]string, 0, len(cfg.Consumer.SQSQueues())+1)
+	for _, queue := range cfg.Consumer.SQSQueues() {
+		queues = append(queues, queue.URL)
+	}
+	if cfg.Consumer.OutputQueueURL != "" {
+		queues = append(queues, cfg.Consumer.OutputQueueURL)
+	}
+	client := sqs.NewFromConfig(awsCfg, func(o *sqs.Options) {
+		if endpoint := awsEndpoint("SQS"); endpoint != "" {
+			o.BaseEndpoint = aws.String(endpoint)
+		}
+	})
+	for _, url := range queues {
+		if err := checkQueue(ctx, client, url, provision); err != nil {
+			errs = append(errs, err)
+		}
+	}
+
+	tables := []startupTable{
+		{"registry.table", cfg.Registry.Table, cfg.Registry.StatusIndex, registryCfg},
+		{"consumer.stateTable", cfg.Consumer.StateTable, "", awsCfg},
+		{"consumer.exactlyOnceTable", cfg.Consumer.ExactlyOnceTable, "", awsCfg},
+		{"flags.table", cfg.Flags.Table, "", awsCfg},
+		{"router.rulesTable", cfg.Router.RulesTable, "", awsCfg},
+		{"workflows.table", cfg.Workflows.Table, "", awsCfg},
+	}
+	for _, table := range tables {
+		if table.name == "" {
+			continue
+		}
+		if err := checkTable(ctx, table, provision); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+func checkQueue(ctx context.Context, client *sqs.Client, url string, provision bool) error {
+	_, err := client.GetQueueAttributes(ctx, &sqs.GetQueueAttributesInput{
+		QueueUrl:       aws.String(url),
+		AttributeNames: []sqstypes.QueueAttributeName{sqstypes.QueueAttributeNameQueueArn},
+	})
+	var missing *sqstypes.QueueDoesNotExist
+	switch {
+	case err == nil:
+		return nil
+	case isAccessDenied(err):
+		slog.Warn("Not allowed to verify the queue, skipping", "queue_url", url, errAttr(err))
+		return nil
+	case !errors.As(err, &missing):
+		return fmt.Errorf("error verifying queue %s: %w", url, err)
+	case !provision:
+		return fmt.Errorf("queue %s does not exist; create it or run with -provision", url)
+	}
+
+	name := path.Base(url)
+	input := &sqs.CreateQueueInput{QueueName: aws.String(name)}
+	if strings.HasSuffix(name, ".fifo") {
+		input.Attributes = map[string]string{string(sqstypes.QueueAttributeNameFifoQueue): "true"}
+	}
+	created, err := client.CreateQueue(ctx, input)
+	if err != nil {
+		return fmt.Errorf("error creating queue %s: %w", name, err)
+	}
+	slog.Info("Created queue", "queue_url", aws.ToString(created.QueueUrl))
+	if aws.ToString(created.QueueUrl) != url {
+		slog.Warn("The created queue URL differs from the configured one", "configured", url, "created", aws.ToString(created.QueueUrl))
+	}
+	return nil
+}
+
+// checkTTL verifies that the TTL of a table deletes the expired records,
+// and with provision enables it. The tables may be shared with other
+// services, so their TTL is never changed without the flag.
+func checkTTL(ctx context.Context, db *DynamoDBClient, setting string, provision bool) {
+	if provision {
+		if err := db.EnableTTL(ctx, expiryAttribute); err != nil {
+			slog.Warn("Could not enable the TTL", "setting", setting, "table", db.tableName, errAttr(err))
+		}
+		return
+	}
+	enabled, err := db.TTLEnabled(ctx, expiryAttribute)
+	switch {
+	case isAccessDenied(err):
+	case err != nil:
+		slog.Warn("Could not read the TTL", "setting", setting, "table", db.tableName, errAttr(err))
+	case !enabled:
+		slog.Warn("The TTL of the table is off, so expired records are not deleted; enable it on "+expiryAttribute+" or run with -provision",
+			"setting", setting, "table", db.tableName)
+	}
+}
+
+func checkTable(ctx context.Context, table startupTable, provision bool) error {
+	db := NewDynamoDBClient(table.name, table.cfg)
+	err := db.CheckKeySchema(ctx, table.statusIndex)
+	var missing *types.ResourceNotFoundException
+	switch {
+	case err == nil:
+		return nil
+	case isAccessDenied(err):
+		slog.Warn("Not allowed to verify the table, skipping", "table", table.name, errAttr(err))
+		return nil
+	case errors.Is(err, errMissingIndex):
+		slog.Warn("Table without its status index, reads by status scan the table", "table", table.name, errAttr(err))
+		return nil
+	case !errors.As(err, &missing):
+		return fmt.Errorf("%s: %w", table.setting, err)
+	case !provision:
+		return fmt.Errorf("%s: table %s does not exist; create it or run with -provision", table.setting, table.name)
+	}
+
+	if _, err := db.EnsureTable(ctx, table.statusIndex); err != nil {
+		return fmt.Errorf("%s: %w", table.setting, err)
+	}
+	slog.Info("Created table", "table", table.name, "status_index", table.statusIndex)
+	return nil
+}
@@ -0,0 +1,95 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/sqs"
+)
+
+var quarantinedMessages = NewCounterVec(
+	"orchestrator_quarantined_messages_total",
+	"Messages moved to the quarantine queue, by reason.",
+	"reason",
+)
+
+// Quarantine reasons
+const quarantineSchemaInvalid = "schema_invalid"
+
+// QuarantineMessage is a rejected message with the reasons it was rejected
+type QuarantineMessage struct {
+	SourceMessageID string   `json:"sourceMessageId"`
+	Source          string   `json:"source"` // messaging.system, e.g. aws_sqs
+	CorrelationID   string   `json:"correlationId,omitempty"`
+	MessageType     string   `json:"messageType,omitempty"`
+	Reason          string   `json:"reason"`
+	Errors          []string `json:"errors"`
+	InstanceID      string   `json:"instanceId"`
+	// Body is the original payload, base64-encoded when it is not valid UTF-8
+	Body          string    `json:"body"`
+	BodyEncoding  string    `json:"bodyEncoding,omitempty"`
+	QuarantinedAt time.Time `json:"quarantinedAt"`
+}
+
+// QuarantineQueue keeps the messages that can never be processed, such as
+// those not matching their schema, out of the retries and the dead-letter
+// queue. A nil *QuarantineQueue quarantines nothing.
+type QuarantineQueue struct {
+	client     *sqs.Client
+	queueURL   string
+	instanceID string
+}
+
+func NewQuarantineQueue(queueURL string, cfg aws.Config, instanceID string) *QuarantineQueue {
+	return &QuarantineQueue{
+		client: sqs.NewFromConfig(cfg, func(o *sqs.Options) {
+			if endpoint := awsEndpoint("SQS"); endpoint != "" {
+				o.BaseEndpoint = aws.String(endpoint)
+			}
+		}),
+		queueURL:   queueURL,
+		instanceID: instanceID,
+	}
+}
+
+// Accepts reports whether the failure is quarantined rather than retried
+func (q *QuarantineQueue) Accepts(err error) bool {
+	return q != nil && errors.Is(err, ErrSchemaInvalid)
+}
+
+// Send quarantines the message with the validation errors of err
+func (q *QuarantineQueue) Send(ctx context.Context, message InboundMessage, err error) error {
+	quarantined := QuarantineMessage{
+		SourceMessageID: message.ID,
+		Source:          message.System,
+		CorrelationID:   correlationIDFrom(ctx),
+		Reason:          quarantineSchemaInvalid,
+		Errors:          []string{err.Error()},
+		InstanceID:      q.instanceID,
+		QuarantinedAt:   time.Now().UTC(),
+	}
+	var schemaErr *SchemaError
+	if errors.As(err, &schemaErr) {
+		quarantined.MessageType = schemaErr.MessageType
+		quarantined.Errors = schemaErr.Errors
+	}
+	quarantined.Body, quarantined.BodyEncoding = archiveBody(message.Body)
+
+	body, err := json.Marshal(quarantined)
+	if err != nil {
+		return fmt.Errorf("error marshaling quarantined message: %w", err)
+	}
+	_, err = q.client.SendMessage(ctx, &sqs.SendMessageInput{
+		QueueUrl:    aws.String(q.queueURL),
+		MessageBody: aws.String(string(body)),
+	})
+	if err != nil {
+		return fmt.Errorf("error sending message to %s: %w", q.queueURL, err)
+	}
+	quarantinedMessages.Inc(quarantined.Reason)
+	return nil
+}
@@ -0,0 +1,202 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/cloudwatch"
+	cwtypes "github.com/aws/aws-sdk-go-v2/service/cloudwatch/types"
+	"github.com/aws/aws-sdk-go-v2/service/sqs"
+	"github.com/aws/aws-sdk-go-v2/service/sqs/types"
+)
+
+var (
+	queueMessages = NewGaugeVec(
+		"orchestrator_queue_messages",
+		"Approximate number of messages in each SQS queue, by state.",
+		"queue", "state",
+	)
+	queueOldestMessageAge = NewGaugeVec(
+		"orchestrator_queue_oldest_message_age_seconds",
+		"ApproximateAgeOfOldestMessage of each queue, from CloudWatch.",
+		"queue",
+	)
+)
+
+// QueueStats is the last observed backlog of a queue, or of all of them
+type QueueStats struct {
+	Queue               string    `json:"queue,omitempty"` // empty for the total
+	Visible             int64     `json:"visible"`
+	NotVisible          int64     `json:"notVisible"`
+	Delayed             int64     `json:"delayed"`
+	OldestMessageAgeSec float64   `json:"oldestMessageAgeSeconds"`
+	UpdatedAt           time.Time `json:"updatedAt"`
+}
+
+// QueueMonitor periodically samples the depth of the queues. SQS does not expose the
+// age of the oldest message through GetQueueAttributes, so that value is the
+// ApproximateAgeOfOldestMessage metric SQS publishes to CloudWatch every
+// minute. While it cannot be read the last age is kept.
+type QueueMonitor struct {
+	consumer   *SQSConsumer
+	cloudwatch *cloudwatch.Client
+
+	mu       sync.Mutex
+	stats    QueueStats
+	perQueue []QueueStats
+	ages     map[string]float64 // seconds, by queue name
+}
+
+func NewQueueMonitor(consumer *SQSConsumer, cfg aws.Config) *QueueMonitor {
+	return &QueueMonitor{
+		consumer: consumer,
+		cloudwatch: cloudwatch.NewFromConfig(cfg, func(o *cloudwatch.Options) {
+			if endpoint := awsEndpoint("CLOUDWATCH"); endpoint != "" {
+				o.BaseEndpoint = aws.String(endpoint)
+			}
+		}),
+		ages: make(map[string]float64),
+	}
+}
+
+// Stats returns the last sample, summed over the queues
+func (m *QueueMonitor) Stats() QueueStats {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.stats
+}
+
+// QueueStats returns the last sample of each queue
+func (m *QueueMonitor) QueueStats() []QueueStats {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return slices.Clone(m.perQueue)
+}
+
+// Sample reads the depth of every queue once
+func (m *QueueMonitor) Sample(ctx context.Context) error {
+	if err := m.sampleAges(ctx); err != nil {
+		slog.Warn("Error reading the age of the oldest messages, keeping the last one", errAttr(err))
+	}
+
+	total := QueueStats{UpdatedAt: time.Now()}
+	perQueue := make([]QueueStats, 0, len(m.consumer.queues))
+	for _, queue := range m.consumer.queues {
+		stats, err := m.sample(ctx, queue)
+		if err != nil {
+			return err
+		}
+		perQueue = append(perQueue, stats)
+		total.Visible += stats.Visible
+		total.NotVisible += stats.NotVisible
+		total.Delayed += stats.Delayed
+		total.OldestMessageAgeSec = max(total.OldestMessageAgeSec, stats.OldestMessageAgeSec)
+	}
+
+	m.mu.Lock()
+	m.stats = total
+	m.perQueue = perQueue
+	m.mu.Unlock()
+	return nil
+}
+
+func (m *QueueMonitor) sample(ctx context.Context, queue *polledQueue) (QueueStats, error) {
+	result, err := m.consumer.sqsClient.GetQueueAttributes(ctx, &sqs.GetQueueAttributesInput{
+		QueueUrl: aws.String(queue.URL),
+		AttributeNames: []types.QueueAttributeName{
+			types.QueueAttributeNameApproximateNumberOfMessages,
+			types.QueueAttributeNameApproximateNumberOfMessagesNotVisible,
+			types.QueueAttributeNameApproximateNumberOfMessagesDelayed,
+		},
+	})
+	if err != nil {
+		return QueueStats{}, fmt.Errorf("error getting attributes of %s: %w", queue.name, err)
+	}
+
+	attribute := func(name types.QueueAttributeName) int64 {
+		value, _ := strconv.ParseInt(result.Attributes[string(name)], 10, 64)
+		return value
+	}
+
+	stats := QueueStats{
+		Queue:               queue.name,
+		Visible:             attribute(types.QueueAttributeNameApproximateNumberOfMessages),
+		NotVisible:          attribute(types.QueueAttributeNameApproximateNumberOfMessagesNotVisible),
+		Delayed:             attribute(types.QueueAttributeNameApproximateNumberOfMessagesDelayed),
+		OldestMessageAgeSec: m.age(queue.name),
+		UpdatedAt:           time.Now(),
+	}
+
+	queueMessages.Set(float64(stats.Visible), queue.name, "visible")
+	queueMessages.Set(float64(stats.NotVisible), queue.name, "not_visible")
+	queueMessages.Set(float64(stats.Delayed), queue.name, "delayed")
+	queueOldestMessageAge.Set(stats.OldestMessageAgeSec, queue.name)
+	return stats, nil
+}
+
+// sampleAges reads the latest ApproximateAgeOfOldestMessage of every queue
+// in one request
+func (m *QueueMonitor) sampleAges(ctx context.Context) error {
+	now := time.Now()
+	queries := make([]cwtypes.MetricDataQuery, 0, len(m.consumer.queues))
+	for i, queue := range m.consumer.queues {
+		queries = append(queries, cwtypes.MetricDataQuery{
+			Id: aws.String("q" + strconv.Itoa(i)),
+			MetricStat: &cwtypes.MetricStat{
+				Metric: &cwtypes.Metric{
+					Namespace:  aws.String("AWS/SQS"),
+					MetricName: aws.String("ApproximateAgeOfOldestMessage"),
+					Dimensions: []cwtypes.Dimension{{Name: aws.String("QueueName"), Value: aws.String(queue.name)}},
+				},
+				Period: aws.Int32(60),
+				Stat:   aws.String("Maximum"),
+			},
+		})
+	}
+
+	// SQS publishes the metric every minute, a few minutes late
+	paginator := cloudwatch.NewGetMetricDataPaginator(m.cloudwatch, &cloudwatch.GetMetricDataInput{
+		MetricDataQueries: queries,
+		StartTime:         aws.Time(now.Add(-10 * time.Minute)),
+		EndTime:           aws.Time(now),
+		ScanBy:            cwtypes.ScanByTimestampDescending,
+	})
+	ages := make(map[string]float64)
+	for paginator.HasMorePages() {
+		page, err := paginator.NextPage(ctx)
+		if err != nil {
+			return fmt.Errorf("error getting ApproximateAgeOfOldestMessage: %w", err)
+		}
+		for _, result := range page.MetricDataResults {
+			index, err := strconv.Atoi(strings.TrimPrefix(aws.ToString(result.Id), "q"))
+			if err != nil || index >= len(m.consumer.queues) || len(result.Values) == 0 {
+				continue
+			}
+			// Newest first
+			if _, ok := ages[m.consumer.queues[index].name]; !ok {
+				ages[m.consumer.queues[index].name] = result.Values[0]
+			}
+		}
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for name, age := range ages {
+		m.ages[name] = age
+	}
+	return nil
+}
+
+// age returns the last age of the oldest message of the queue, in seconds
+func (m *QueueMonitor) age(name string) float64 {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.ages[name]
+}
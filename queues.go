@@ -0,0 +1,108 @@
+package main
+
+import (
+	"path"
+	"slices"
+	"sync/atomic"
+	"time"
+
+	"challenge-4-orchestrator/config"
+)
+
+// multiQueueWait is the long poll of the last queue of a round when several
+// are consumed; the others are not waited on, so a message in any queue is
+// picked up within this time
+const multiQueueWait = 2
+
+// SQS limits for deferred messages
+const (
+	maxSQSDelay      = 15 * time.Minute
+	maxSQSVisibility = 12 * time.Hour
+)
+
+var queueReceivedMessages = NewCounterVec(
+	"orchestrator_queue_received_messages_total",
+	"Messages received from each SQS queue.",
+	"queue",
+)
+
+// polledQueue is the polling state of a queue. Only the poll loops touch
+// current and lastFirst, under the consumer orderMu.
+type polledQueue struct {
+	config.SQSQueue
+	name string // metric label, the last segment of the URL
+
+	current   int       // smooth weighted round-robin credit
+	lastFirst time.Time // when the queue was last polled first in a round
+
+	// owned is cleared while sharding assigns the queue to another replica
+	owned atomic.Bool
+}
+
+func newPolledQueues(queues []config.SQSQueue) []*polledQueue {
+	polled := make([]*polledQueue, 0, len(queues))
+	for _, queue := range queues {
+		q := &polledQueue{
+			SQSQueue:  queue,
+			name:      path.Base(queue.URL),
+			lastFirst: time.Now(),
+		}
+		q.owned.Store(true)
+		polled = append(polled, q)
+	}
+	return polled
+}
+
+// ownedQueues returns the queues this replica polls
+func ownedQueues(queues []*polledQueue) []*polledQueue {
+	owned := make([]*polledQueue, 0, len(queues))
+	for _, queue := range queues {
+		if queue.owned.Load() {
+			owned = append(owned, queue)
+		}
+	}
+	return owned
+}
+
+// pollOrder returns the queues in the order to poll them this round. The
+// first is picked by smooth weighted round-robin, so with weights 80/20 the
+// high-priority queue leads four rounds out of five and the low-priority one
+// the fifth. A queue that has not led a round for starvation leads this one
+// whatever its weight. The others follow by weight; they are only polled
+// when the queues before them are empty.
+func pollOrder(queues []*polledQueue, starvation time.Duration) []*polledQueue {
+	if len(queues) < 2 {
+		return queues
+	}
+
+	total := 0
+	var first *polledQueue
+	for _, queue := range queues {
+		queue.current += queue.Weight
+		total += queue.Weight
+		if first == nil || queue.current > first.current {
+			first = queue
+		}
+	}
+	first.current -= total
+
+	now := time.Now()
+	for _, queue := range queues {
+		if now.Sub(queue.lastFirst) > starvation && now.Sub(queue.lastFirst) > now.Sub(first.lastFirst) {
+			first = queue
+		}
+	}
+	first.lastFirst = now
+
+	order := make([]*polledQueue, 0, len(queues))
+	order = append(order, first)
+	for _, queue := range queues {
+		if queue != first {
+			order = append(order, queue)
+		}
+	}
+	slices.SortStableFunc(order[1:], func(a, b *polledQueue) int {
+		return b.Weight - a.Weight
+	})
+	return order
+}
@@ -0,0 +1,158 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"maps"
+	"slices"
+	"time"
+)
+
+var (
+	quorumResults = NewCounterVec(
+		"orchestrator_quorum_results_total",
+		"Messages verified by quorum, by message type and result (unanimous, majority, no_quorum).",
+		"message_type", "result",
+	)
+	// The cost of the verification: every invocation past the first is
+	// one a routed message would not have made
+	quorumExtraInvocations = NewCounterVec(
+		"orchestrator_quorum_extra_invocations_total",
+		"Worker invocations made by quorum verification beyond the one of a routed message, by message type.",
+		"message_type",
+	)
+	quorumSuspects = NewCounterVec(
+		"orchestrator_quorum_suspects_total",
+		"Workers flagged as suspect for disagreeing with the majority, by worker.",
+		"lambda_arn",
+	)
+)
+
+// Quorum verifies the results of critical message types: the message goes
+// to several workers and the majority response wins. Workers answering
+// something else are flagged as suspect in the registry, and unflagged the
+// next time they agree. A nil *Quorum verifies nothing.
+type Quorum struct {
+	typeField string
+	sizes     map[string]int // workers by message type
+	registry  *LambdaRegistry
+}
+
+// NewQuorum warns of the extra invocations of every verified type
+func NewQuorum(sizes map[string]int, typeField string, registry *LambdaRegistry) *Quorum {
+	for _, messageType := range slices.Sorted(maps.Keys(sizes)) {
+		slog.Warn("Quorum verification multiplies the worker invocations", "message_type", messageType, "workers", sizes[messageType])
+	}
+	return &Quorum{typeField: typeField, sizes: sizes, registry: registry}
+}
+
+// Match returns the message type and the number of workers of msg, if its
+// type is verified
+func (q *Quorum) Match(msg any) (string, int, bool) {
+	if q == nil {
+		return "", 0, false
+	}
+	fields, _ := msg.(map[string]any)
+	messageType, _ := fields[q.typeField].(string)
+	size, ok := q.sizes[messageType]
+	return messageType, size, ok
+}
+
+// flag marks or unmarks a worker as suspect, when its flag changes
+func (q *Quorum) flag(ctx context.Context, lambda Lambda, suspect bool, reason string) {
+	if q.registry == nil || lambda.Suspect == suspect {
+		return
+	}
+	if suspect {
+		quorumSuspects.Inc(lambda.ARN)
+	}
+	if err := q.registry.SetSuspect(ctx, lambda.ID, suspect, reason); err != nil {
+		loggerFrom(ctx).Error("Error flagging worker", "lambda_id", lambda.ID, "suspect", suspect, errAttr(err))
+	}
+}
+
+// verifyQuorum invokes size workers picked by weight among the candidates and
+// returns the response of the majority of size. Responses are compared as
+// JSON when they are JSON. It fails with ErrQuorumNotReached when no
+// response has the majority, e.g. with fewer healthy workers than half of
+// size.
+func (c *SQSConsumer) verifyQuorum(ctx context.Context, msg any, messageType string, size int, candidates []Lambda) (*workerResponse, error) {
+	logger := loggerFrom(ctx)
+	started := time.Now()
+
+	pool := slices.Clone(candidates)
+	var lambdas []Lambda
+	for len(lambdas) < size && len(pool) > 0 {
+		selected := selectWeighted(pool)
+		lambdas = append(lambdas, selected)
+		pool = slices.DeleteFunc(pool, func(lambda Lambda) bool { return lambda.ARN == selected.ARN })
+	}
+	if len(lambdas) < size {
+		logger.Warn("Fewer healthy workers than the quorum", "message_type", messageType, "quorum", size, "workers", len(lambdas))
+	}
+	quorumExtraInvocations.Add(float64(max(len(lambdas)-1, 0)), messageType)
+
+	invocations := c.invokeAll(ctx, msg, lambdas)
+	votes := make(map[string][]int) // canonical response -> invocations
+	var errs []error
+	for i, invoked := range invocations {
+		if invoked.err != nil {
+			errs = append(errs, invoked.err)
+			continue
+		}
+		key := canonicalResponse(invoked.response)
+		votes[key] = append(votes[key], i)
+	}
+	var winner string
+	for key, voters := range votes {
+		if len(voters) > len(votes[winner]) {
+			winner = key
+		}
+	}
+	agreed := votes[winner]
+	if len(agreed)*2 <= size {
+		quorumResults.Inc(messageType, "no_quorum")
+		errs = append(errs, fmt.Errorf("%d different responses", len(votes)))
+		return nil, fmt.Errorf("%w: %d of %d workers agreed: %w", ErrQuorumNotReached, len(agreed), size, errors.Join(errs...))
+	}
+
+	result := "unanimous"
+	if len(agreed) < len(lambdas) {
+		result = "majority"
+	}
+	quorumResults.Inc(messageType, result)
+	for key, voters := range votes {
+		for _, i := range voters {
+			lambda := invocations[i].lambda
+			if key == winner {
+				c.quorum.flag(ctx, lambda, false, "")
+				continue
+			}
+			logger.Warn("Worker disagreed with the quorum", "lambda_arn", lambda.ARN, "message_type", messageType)
+			c.quorum.flag(ctx, lambda, true, fmt.Sprintf("disagreed with %d of %d workers on message %s", len(agreed), len(lambdas), messageIDFrom(ctx)))
+		}
+	}
+
+	elapsed := time.Since(started)
+	logger.Info("Quorum reached", "message_type", messageType, "agreed", len(agreed), "invoked", len(lambdas), durationAttr(elapsed))
+	first := invocations[agreed[0]]
+	return &workerResponse{Lambda: first.lambda, Body: first.response, Elapsed: elapsed}, nil
+}
+
+// canonicalResponse is the response with its JSON objects in key order, so
+// equal JSON compares equal
+func canonicalResponse(response []byte) string {
+	var value any
+	if err := json.Unmarshal(response, &value); err != nil {
+		return string(bytes.TrimSpace(response))
+	}
+	canonical, err := json.Marshal(value)
+	if err != nil {
+		return string(response)
+	}
+	return string(canonical)
+}
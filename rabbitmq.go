@@ -0,0 +1,239 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	amqp "github.com/rabbitmq/amqp091-go"
+	"go.opentelemetry.io/otel/propagation"
+)
+
+// rabbitAttemptsHeader counts the failed attempts of a delivery published
+// again for a retry; classic queues have no x-delivery-count
+const rabbitAttemptsHeader = "x-orchestrator-attempts"
+
+// RabbitMQOptions configures the RabbitMQ source
+type RabbitMQOptions struct {
+	URL   string // amqp:// or amqps://, with the credentials and vhost
+	Queue string
+	// Prefetch is how many unacknowledged deliveries the broker sends, and
+	// how many are processed concurrently
+	Prefetch       int
+	ReconnectDelay time.Duration
+	MaxAttempts    int
+	// RetryBackoff is the wait before the second attempt, doubled for each
+	// later one up to a minute
+	RetryBackoff time.Duration
+}
+
+// RabbitMQSource feeds an AMQP queue into the same pipeline as the SQS
+// queue. A delivery is acked once processed. A failed one is held for the
+// backoff, then published again to the queue with its attempts in a header
+// and acked; after MaxAttempts it is nacked without requeue, so the
+// dead-letter exchange of the queue receives it, if it has one.
+type RabbitMQSource struct {
+	consumer   *SQSConsumer
+	instanceID string
+	opts       RabbitMQOptions
+
+	connected atomic.Bool
+}
+
+func NewRabbitMQSource(consumer *SQSConsumer, instanceID string, opts RabbitMQOptions) *RabbitMQSource {
+	return &RabbitMQSource{
+		consumer:   consumer,
+		instanceID: instanceID,
+		opts:       opts,
+	}
+}
+
+// Start consumes until ctx is done, reconnecting when the connection drops
+func (r *RabbitMQSource) Start(ctx context.Context) {
+	slog.Info("Starting RabbitMQ consumer", "queue", r.opts.Queue, "prefetch", r.opts.Prefetch)
+
+	for {
+		err := r.consume(ctx)
+		r.connected.Store(false)
+		if ctx.Err() != nil {
+			slog.Info("Shutting down RabbitMQ consumer")
+			return
+		}
+		slog.Error("RabbitMQ consumer disconnected, reconnecting", "queue", r.opts.Queue,
+			"delay", r.opts.ReconnectDelay.String(), errAttr(err))
+		if sleepContext(ctx, r.opts.ReconnectDelay) != nil {
+			return
+		}
+	}
+}
+
+// consume runs one connection until it closes or ctx is done
+func (r *RabbitMQSource) consume(ctx context.Context) error {
+	conn, err := amqp.DialConfig(r.opts.URL, amqp.Config{
+		Heartbeat:  10 * time.Second,
+		Properties: amqp.Table{"connection_name": serviceName + "/" + r.instanceID},
+	})
+	if err != nil {
+		return fmt.Errorf("error connecting to RabbitMQ: %w", err)
+	}
+	defer conn.Close()
+	closed := conn.NotifyClose(make(chan *amqp.Error, 1))
+
+	ch, err := conn.Channel()
+	if err != nil {
+		return fmt.Errorf("error opening channel: %w", err)
+	}
+	defer ch.Close()
+
+	if err := ch.Qos(r.opts.Prefetch, 0, false); err != nil {
+		return fmt.Errorf("error setting prefetch: %w", err)
+	}
+	deliveries, err := ch.ConsumeWithContext(ctx, r.opts.Queue, r.instanceID, false, false, false, false, nil)
+	if err != nil {
+		return fmt.Errorf("error consuming %s: %w", r.opts.Queue, err)
+	}
+	r.connected.Store(true)
+
+	var wg sync.WaitGroup
+	for range r.opts.Prefetch {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for delivery := range deliveries {
+				// Prefetched deliveries wait unacked while paused
+				done, err := r.consumer.startFetch(ctx)
+				if err != nil {
+					return
+				}
+				r.handle(ctx, ch, delivery)
+				done()
+			}
+		}()
+	}
+	wg.Wait()
+
+	select {
+	case closeErr := <-closed:
+		if closeErr != nil {
+			return closeErr
+		}
+	default:
+	}
+	return errors.New("delivery channel closed")
+}
+
+func (r *RabbitMQSource) handle(ctx context.Context, ch *amqp.Channel, delivery amqp.Delivery) {
+	headers := propagation.MapCarrier{}
+	for key, value := range delivery.Headers {
+		if s, ok := value.(string); ok {
+			headers[key] = s
+		}
+	}
+	if delivery.CorrelationId != "" && headers[correlationIDField] == "" {
+		headers[correlationIDField] = delivery.CorrelationId
+	}
+
+	id := delivery.MessageId
+	if id == "" {
+		id = r.opts.Queue + "/" + strconv.FormatUint(delivery.DeliveryTag, 10)
+	}
+	attempt := deliveryAttempt(delivery)
+
+	acked := r.consumer.process(ctx, InboundMessage{
+		System:  "rabbitmq",
+		ID:      id,
+		Body:    delivery.Body,
+		Attempt: strconv.Itoa(attempt),
+		DedupID: id,
+		Headers: headers,
+		Ack: func(ctx context.Context) {
+			if err := delivery.Ack(false); err != nil {
+				loggerFrom(ctx).Error("Error acking RabbitMQ delivery", errAttr(err))
+			}
+		},
+		// The delivery is held unacked for delay, then published again
+		// without using an attempt; if the channel closes first the broker
+		// requeues it
+		Defer: func(ctx context.Context, delay time.Duration) {
+			time.AfterFunc(delay, func() { r.republish(ch, delivery, attempt-1) })
+		},
+	})
+	if acked {
+		return
+	}
+
+	if attempt >= r.opts.MaxAttempts {
+		slog.Error("RabbitMQ delivery failed on every attempt, dead-lettering it", "message_id", id, "attempts", attempt)
+		sourceMessagesSkipped.Inc("rabbitmq")
+		if err := delivery.Nack(false, false); err != nil {
+			slog.Error("Error nacking RabbitMQ delivery", "message_id", id, errAttr(err))
+		}
+		return
+	}
+	backoff := min(r.opts.RetryBackoff<<(attempt-1), time.Minute)
+	time.AfterFunc(backoff, func() { r.republish(ch, delivery, attempt) })
+}
+
+// deliveryAttempt counts the attempts recorded when the delivery was
+// published again, plus the redeliveries counted by quorum queues
+func deliveryAttempt(delivery amqp.Delivery) int {
+	attempt := 1
+	for _, header := range []string{rabbitAttemptsHeader, "x-delivery-count"} {
+		switch count := delivery.Headers[header].(type) {
+		case int32:
+			attempt += int(count)
+		case int64:
+			attempt += int(count)
+		}
+	}
+	return attempt
+}
+
+// republish publishes the delivery again to the queue with failed attempts,
+// then acks it. When the publish fails it is requeued instead.
+func (r *RabbitMQSource) republish(ch *amqp.Channel, delivery amqp.Delivery, failed int) {
+	headers := amqp.Table{}
+	for key, value := range delivery.Headers {
+		headers[key] = value
+	}
+	delete(headers, "x-delivery-count")
+	headers[rabbitAttemptsHeader] = int32(failed)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	err := ch.PublishWithContext(ctx, "", r.opts.Queue, false, false, amqp.Publishing{
+		Headers:         headers,
+		ContentType:     delivery.ContentType,
+		ContentEncoding: delivery.ContentEncoding,
+		DeliveryMode:    delivery.DeliveryMode,
+		Priority:        delivery.Priority,
+		CorrelationId:   delivery.CorrelationId,
+		ReplyTo:         delivery.ReplyTo,
+		MessageId:       delivery.MessageId,
+		Timestamp:       delivery.Timestamp,
+		Type:            delivery.Type,
+		AppId:           delivery.AppId,
+		Body:            delivery.Body,
+	})
+	if err == nil {
+		err = delivery.Ack(false)
+	} else {
+		err = delivery.Nack(false, true)
+	}
+	if err != nil && !errors.Is(err, amqp.ErrClosed) {
+		slog.Error("Error retrying RabbitMQ delivery", "message_id", delivery.MessageId, errAttr(err))
+	}
+}
+
+// CheckConnection reports whether the consumer is connected to the broker
+func (r *RabbitMQSource) CheckConnection(context.Context) error {
+	if !r.connected.Load() {
+		return errors.New("not connected to RabbitMQ")
+	}
+	return nil
+}
@@ -0,0 +1,146 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/sts"
+)
+
+const readinessCheckTimeout = 3 * time.Second
+
+// DependencyCheck is one lightweight probe run by /ready
+type DependencyCheck struct {
+	Name  string
+	Check func(ctx context.Context) error
+}
+
+type DependencyStatus struct {
+	Name      string `json:"name"`
+	Status    string `json:"status"`
+	Error     string `json:"error,omitempty"`
+	LatencyMS int64  `json:"latencyMs"`
+}
+
+type ReadinessReport struct {
+	Ready     bool               `json:"ready"`
+	CheckedAt time.Time          `json:"checkedAt"`
+	Checks    []DependencyStatus `json:"checks"`
+}
+
+// ReadinessChecker runs dependency checks and caches the result so frequent
+// probes don't turn into a stream of AWS API calls
+type ReadinessChecker struct {
+	checks   []DependencyCheck
+	cacheTTL time.Duration
+
+	mu       sync.Mutex
+	last     *ReadinessReport
+	notReady string // set once the instance is retiring
+}
+
+func NewReadinessChecker(cacheTTL time.Duration, checks ...DependencyCheck) *ReadinessChecker {
+	return &ReadinessChecker{
+		checks:   checks,
+		cacheTTL: cacheTTL,
+	}
+}
+
+func (rc *ReadinessChecker) Register(mux *http.ServeMux) {
+	mux.HandleFunc("/ready", rc.readyHandler)
+}
+
+func (rc *ReadinessChecker) readyHandler(w http.ResponseWriter, r *http.Request) {
+	report := rc.Check(r.Context())
+
+	status := http.StatusOK
+	if !report.Ready {
+		status = http.StatusServiceUnavailable
+	}
+	writeJSON(w, status, report)
+}
+
+// SetNotReady fails every following check with reason, whatever the
+// dependencies say. It is not reversible.
+func (rc *ReadinessChecker) SetNotReady(reason string) {
+	rc.mu.Lock()
+	defer rc.mu.Unlock()
+	rc.notReady = reason
+}
+
+// Check returns the cached report or runs all checks concurrently
+func (rc *ReadinessChecker) Check(ctx context.Context) *ReadinessReport {
+	rc.mu.Lock()
+	defer rc.mu.Unlock()
+
+	if rc.notReady != "" {
+		return &ReadinessReport{
+			CheckedAt: time.Now(),
+			Checks:    []DependencyStatus{{Name: "drain", Status: "down", Error: rc.notReady}},
+		}
+	}
+
+	if rc.last != nil && time.Since(rc.last.CheckedAt) < rc.cacheTTL {
+		return rc.last
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, readinessCheckTimeout)
+	defer cancel()
+
+	report := &ReadinessReport{
+		Ready:     true,
+		CheckedAt: time.Now(),
+		Checks:    make([]DependencyStatus, len(rc.checks)),
+	}
+
+	var wg sync.WaitGroup
+	for i, check := range rc.checks {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			start := time.Now()
+			err := check.Check(ctx)
+
+			result := DependencyStatus{
+				Name:      check.Name,
+				Status:    "up",
+				LatencyMS: time.Since(start).Milliseconds(),
+			}
+			if err != nil {
+				result.Status = "down"
+				result.Error = err.Error()
+			}
+			report.Checks[i] = result
+		}()
+	}
+	wg.Wait()
+
+	for _, result := range report.Checks {
+		if result.Status != "up" {
+			report.Ready = false
+		}
+	}
+
+	rc.last = report
+	return report
+}
+
+// newCallerIdentityCheck verifies the AWS credentials are valid
+func newCallerIdentityCheck(cfg aws.Config) DependencyCheck {
+	client := sts.NewFromConfig(cfg)
+
+	return DependencyCheck{
+		Name: "credentials",
+		Check: func(ctx context.Context) error {
+			if _, err := client.GetCallerIdentity(ctx, &sts.GetCallerIdentityInput{}); err != nil {
+				return fmt.Errorf("error getting caller identity: %w", err)
+			}
+			return nil
+		},
+	}
+}
@@ -0,0 +1,155 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/service/lambda/types"
+)
+
+var reconcileDiscrepancies = NewCounterVec(
+	"orchestrator_registry_discrepancies_total",
+	"Registry entries whose Lambda function is missing or unusable, by reason.",
+	"reason",
+)
+
+// Discrepancy describes a registry entry that does not match the real function
+type Discrepancy struct {
+	LambdaID   string    `json:"lambdaId"`
+	ARN        string    `json:"arn"`
+	Reason     string    `json:"reason"`
+	Detail     string    `json:"detail"`
+	MarkedDown bool      `json:"markedDown"`
+	DetectedAt time.Time `json:"detectedAt"`
+}
+
+// ReconcileReport is the outcome of the last reconciliation pass
+type ReconcileReport struct {
+	StartedAt     time.Time     `json:"startedAt"`
+	FinishedAt    time.Time     `json:"finishedAt"`
+	Checked       int           `json:"checked"`
+	Discrepancies []Discrepancy `json:"discrepancies"`
+	Error         string        `json:"error,omitempty"`
+}
+
+// Reconciler periodically checks every registered ARN against the Lambda
+// control plane and marks missing or disabled functions as unhealthy
+type Reconciler struct {
+	registry     *LambdaRegistry
+	lambdaClient *LambdaClient
+
+	mu   sync.RWMutex
+	last *ReconcileReport
+}
+
+func NewReconciler(registry *LambdaRegistry, lambdaClient *LambdaClient) *Reconciler {
+	return &Reconciler{
+		registry:     registry,
+		lambdaClient: lambdaClient,
+	}
+}
+
+// LastReport returns the most recent reconciliation outcome, or nil
+func (r *Reconciler) LastReport() *ReconcileReport {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.last
+}
+
+// Reconcile runs one pass over the registry
+func (r *Reconciler) Reconcile(ctx context.Context) *ReconcileReport {
+	report := &ReconcileReport{StartedAt: time.Now().UTC()}
+	defer func() {
+		report.FinishedAt = time.Now().UTC()
+		r.mu.Lock()
+		r.last = report
+		r.mu.Unlock()
+	}()
+
+	lambdas, err := r.registry.List(ctx)
+	if err != nil {
+		report.Error = err.Error()
+		slog.Error("Reconciler: error listing registry", errAttr(err))
+		return report
+	}
+
+	for _, lambda := range lambdas {
+		if ctx.Err() != nil {
+			return report
+		}
+		report.Checked++
+
+		reason, detail, err := r.check(ctx, lambda)
+		if err != nil {
+			slog.Warn("Reconciler: could not check lambda", "lambda_arn", lambda.ARN, errAttr(err))
+			continue
+		}
+		if reason == "" {
+			continue
+		}
+
+		discrepancy := Discrepancy{
+			LambdaID:   lambda.ID,
+			ARN:        lambda.ARN,
+			Reason:     reason,
+			Detail:     detail,
+			DetectedAt: time.Now().UTC(),
+		}
+		reconcileDiscrepancies.Inc(reason)
+
+		if lambda.Status == Healthy {
+			status := Unhealthy
+			if _, err := r.registry.Update(ctx, lambda.ID, &status, nil); err != nil {
+				slog.Error("Reconciler: error marking lambda unhealthy", "lambda_id", lambda.ID, errAttr(err))
+			} else {
+				discrepancy.MarkedDown = true
+			}
+		}
+
+		slog.Warn("Reconciler: registry discrepancy", "lambda_id", lambda.ID, "lambda_arn", lambda.ARN,
+			"reason", reason, "detail", detail, "marked_unhealthy", discrepancy.MarkedDown)
+		report.Discrepancies = append(report.Discrepancies, discrepancy)
+	}
+
+	return report
+}
+
+// check returns a non-empty reason when the function is missing or unusable.
+// Errors other than "not found" are returned so transient failures never
+// demote a Lambda.
+func (r *Reconciler) check(ctx context.Context, lambda Lambda) (string, string, error) {
+	// State machines are not Lambda functions
+	if lambda.Type == TargetStepFunctions {
+		return "", "", nil
+	}
+	config, err := r.lambdaClient.GetFunctionConfiguration(ctx, lambda.ARN)
+	if err != nil {
+		var notFound *types.ResourceNotFoundException
+		if errors.As(err, &notFound) {
+			return "missing", "function does not exist", nil
+		}
+		return "", "", err
+	}
+
+	switch config.State {
+	case types.StateFailed, types.StateInactive:
+		return "disabled", fmt.Sprintf("function state is %s: %s", config.State, deref(config.StateReason)), nil
+	}
+
+	if config.LastUpdateStatus == types.LastUpdateStatusFailed {
+		return "update-failed", fmt.Sprintf("last update failed: %s", deref(config.LastUpdateStatusReason)), nil
+	}
+
+	return "", "", nil
+}
+
+func deref(s *string) string {
+	if s == nil {
+		return ""
+	}
+	return *s
+}
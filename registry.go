@@ -0,0 +1,484 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue"
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/expression"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/aws/smithy-go"
+)
+
+// Atributo numérico (epoch en segundos) usado por el TTL de DynamoDB
+const expiryAttribute = "expiraEn"
+
+// Motivo registrado cuando el monitor de latidos degrada una Lambda; sólo
+// esas Lambdas se promueven automáticamente al reanudar los latidos
+const statusReasonSilent = "sinLatido"
+
+var (
+	ErrLambdaNotFound = errors.New("lambda not found")
+	ErrLambdaExists   = errors.New("lambda already registered")
+)
+
+var heartbeatLayouts = []string{
+	time.RFC3339Nano,
+	time.RFC3339,
+	"2006-01-02 15:04:05",
+}
+
+// LambdaRegistry es el repositorio de Lambdas trabajadoras sobre DynamoDB.
+// Los registros cuyo último latido supera el periodo de gracia se consideran
+// ausentes aunque DynamoDB aún no los haya purgado.
+type LambdaRegistry struct {
+	db              *DynamoDBClient
+	grace           time.Duration
+	statusIndex     string
+	consistentReads atomic.Bool
+
+	// indexMissing se activa la primera vez que la tabla no tiene el GSI,
+	// para no repetir una consulta que siempre falla
+	indexMissing atomic.Bool
+
+	// onStatusChange se invocan cuando Update cambia el estado de salud
+	onStatusChange []func(lambda Lambda, previous Status)
+	// lastHealthyRead (unix nanosegundos) y healthyCount describen la última
+	// lectura de ListHealthy, la vista con la que se enruta
+	lastHealthyRead atomic.Int64
+	healthyCount    atomic.Int64
+}
+
+// RegistryReadStatus describe la vista del registro con la que se enruta,
+// para /status
+type RegistryReadStatus struct {
+	LastRead        *time.Time `json:"lastRead,omitempty"`
+	Age             string     `json:"age,omitempty"` // desde la última lectura correcta
+	Healthy         int64      `json:"healthy"`
+	ConsistentReads bool       `json:"consistentReads"`
+	DAX             bool       `json:"dax"` // las lecturas pasan por la caché de DAX
+}
+
+// RegistryOptions configura el comportamiento del repositorio
+type RegistryOptions struct {
+	// TTLGrace <= 0 desactiva la expiración de registros
+	TTLGrace time.Duration
+	// StatusIndex vacío obliga a usar Scan para obtener las Lambdas saludables
+	StatusIndex string
+	// ConsistentReads usa lecturas fuertemente consistentes en las lecturas
+	// que deciden el enrutamiento, a costa del doble de capacidad y de no
+	// poder usar el GSI
+	ConsistentReads bool
+}
+
+// NewLambdaRegistry crea el repositorio
+func NewLambdaRegistry(db *DynamoDBClient, opts RegistryOptions) *LambdaRegistry {
+	r := &LambdaRegistry{
+		db:          db,
+		grace:       opts.TTLGrace,
+		statusIndex: opts.StatusIndex,
+	}
+	r.consistentReads.Store(opts.ConsistentReads)
+	return r
+}
+
+// SetConsistentReads cambia el modo de lectura en caliente (recarga de
+// configuración)
+func (r *LambdaRegistry) SetConsistentReads(enabled bool) {
+	r.consistentReads.Store(enabled)
+}
+
+// List devuelve todas las Lambdas registradas que no han expirado
+func (r *LambdaRegistry) List(ctx context.Context) ([]Lambda, error) {
+	return r.list(ctx, false)
+}
+
+func (r *LambdaRegistry) list(ctx context.Context, consistent bool) ([]Lambda, error) {
+	items, err := r.db.Scan(ctx, nil, ConsistentRead(consistent))
+	if err != nil {
+		return nil, fmt.Errorf("error listing lambdas in table %s: %w", r.db.tableName, err)
+	}
+
+	return r.unmarshalActive(items)
+}
+
+// unmarshalActive convierte los ítems y descarta los registros expirados
+func (r *LambdaRegistry) unmarshalActive(items []map[string]types.AttributeValue) ([]Lambda, error) {
+	now := time.Now()
+	lambdas := make([]Lambda, 0, len(items))
+
+	for _, item := range items {
+		var lambda Lambda
+		if err := attributevalue.UnmarshalMap(item, &lambda); err != nil {
+			return nil, fmt.Errorf("failed to unmarshal item: %w", err)
+		}
+
+		if r.expired(lambda, now) {
+			continue
+		}
+		lambdas = append(lambdas, lambda)
+	}
+
+	return lambdas, nil
+}
+
+// ListHealthy devuelve las Lambdas vigentes en estado saludable, consultando
+// el GSI de estadoSalud y recurriendo a Scan si el índice no existe o si se
+// exigen lecturas consistentes
+func (r *LambdaRegistry) ListHealthy(ctx context.Context) ([]Lambda, error) {
+	lambdas, err := r.listHealthy(ctx)
+	if err == nil {
+		r.lastHealthyRead.Store(time.Now().UnixNano())
+		r.healthyCount.Store(int64(len(lambdas)))
+	}
+	return lambdas, err
+}
+
+// ReadStatus devuelve el estado de la última lectura de ListHealthy
+func (r *LambdaRegistry) ReadStatus() RegistryReadStatus {
+	status := RegistryReadStatus{
+		Healthy:         r.healthyCount.Load(),
+		ConsistentReads: r.consistentReads.Load(),
+		DAX:             r.db.reader != dynamoDBReader(r.db.client),
+	}
+	if last := r.lastHealthyRead.Load(); last != 0 {
+		read := time.Unix(0, last).UTC()
+		status.LastRead = &read
+		status.Age = time.Since(read).Round(time.Millisecond).String()
+	}
+	return status
+}
+
+func (r *LambdaRegistry) listHealthy(ctx context.Context) ([]Lambda, error) {
+	if r.statusIndex != "" && !r.consistentReads.Load() && !r.indexMissing.Load() {
+		lambdas, err := r.queryByStatus(ctx, Healthy)
+		if err == nil {
+			return lambdas, nil
+		}
+		if !isMissingIndex(err) {
+			return nil, err
+		}
+
+		slog.Warn("Status index not found, falling back to scan", "index", r.statusIndex, "table", r.db.tableName)
+		r.indexMissing.Store(true)
+	}
+
+	lambdas, err := r.list(ctx, r.consistentReads.Load())
+	if err != nil {
+		return nil, err
+	}
+
+	var healthy []Lambda
+	for _, lambda := range lambdas {
+		if lambda.Status == Healthy {
+			healthy = append(healthy, lambda)
+		}
+	}
+
+	return healthy, nil
+}
+
+func (r *LambdaRegistry) queryByStatus(ctx context.Context, status Status) ([]Lambda, error) {
+	expr, err := expression.NewBuilder().
+		WithKeyCondition(expression.Key("estadoSalud").Equal(expression.Value(string(status)))).
+		Build()
+	if err != nil {
+		return nil, fmt.Errorf("error building status query: %w", err)
+	}
+
+	items, err := r.db.QueryIndex(ctx, r.statusIndex, expr)
+	if err != nil {
+		return nil, err
+	}
+
+	return r.unmarshalActive(items)
+}
+
+// Get devuelve la Lambda con el id indicado, o nil si no existe o expiró
+func (r *LambdaRegistry) Get(ctx context.Context, id string) (*Lambda, error) {
+	return r.get(ctx, id, r.consistentReads.Load())
+}
+
+func (r *LambdaRegistry) get(ctx context.Context, id string, consistent bool) (*Lambda, error) {
+	item, err := r.db.GetItem(ctx, id, ConsistentRead(consistent))
+	if err != nil {
+		return nil, err
+	}
+	if len(item) == 0 {
+		return nil, nil
+	}
+
+	var lambda Lambda
+	if err := attributevalue.UnmarshalMap(item, &lambda); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal item: %w", err)
+	}
+
+	if r.expired(lambda, time.Now()) {
+		return nil, nil
+	}
+
+	return &lambda, nil
+}
+
+// Put inserta o reemplaza la Lambda, recalculando su expiración
+func (r *LambdaRegistry) Put(ctx context.Context, lambda Lambda) error {
+	item, err := r.marshal(lambda)
+	if err != nil {
+		return err
+	}
+
+	return r.db.PutItem(ctx, item)
+}
+
+// marshal convierte la Lambda en ítem con la expiración recalculada
+func (r *LambdaRegistry) marshal(lambda Lambda) (map[string]types.AttributeValue, error) {
+	if expiry, ok := r.expiryFor(lambda); ok {
+		lambda.ExpiresAt = expiry.Unix()
+	}
+
+	item, err := attributevalue.MarshalMap(lambda)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal lambda %s: %w", lambda.ID, err)
+	}
+
+	return item, nil
+}
+
+// Create registra una Lambda nueva, fallando con ErrLambdaExists si el id ya existe
+func (r *LambdaRegistry) Create(ctx context.Context, lambda Lambda) error {
+	item, err := r.marshal(lambda)
+	if err != nil {
+		return err
+	}
+
+	expr, err := expression.NewBuilder().
+		WithCondition(expression.AttributeNotExists(expression.Name("id"))).
+		Build()
+	if err != nil {
+		return fmt.Errorf("error building create condition: %w", err)
+	}
+
+	if err := r.db.PutItemWithCondition(ctx, item, expr); err != nil {
+		if isConditionFailed(err) {
+			return ErrLambdaExists
+		}
+		return err
+	}
+
+	return nil
+}
+
+// OnStatusChange registra una función a la que se notifica cada cambio de
+// estado de salud hecho con Update; se pueden registrar varias
+func (r *LambdaRegistry) OnStatusChange(fn func(lambda Lambda, previous Status)) {
+	r.onStatusChange = append(r.onStatusChange, fn)
+}
+
+func (r *LambdaRegistry) notifyStatusChange(lambda Lambda, previous Status) {
+	for _, fn := range r.onStatusChange {
+		fn(lambda, previous)
+	}
+}
+
+// Update modifica el estado y/o el peso de una Lambda existente; los
+// parámetros nil se dejan sin cambios
+func (r *LambdaRegistry) Update(ctx context.Context, id string, status *Status, weight *int) (*Lambda, error) {
+	var update expression.UpdateBuilder
+	if status != nil {
+		// Un cambio manual de estado reemplaza el motivo automático
+		update = update.Set(expression.Name("estadoSalud"), expression.Value(string(*status))).
+			Remove(expression.Name("motivoEstado"))
+	}
+	if weight != nil {
+		update = update.Set(expression.Name("peso"), expression.Value(*weight))
+	}
+
+	expr, err := expression.NewBuilder().
+		WithUpdate(update).
+		WithCondition(expression.AttributeExists(expression.Name("id"))).
+		Build()
+	if err != nil {
+		return nil, fmt.Errorf("error building update for lambda %s: %w", id, err)
+	}
+
+	// El estado previo sale de la propia escritura (UPDATED_OLD), así dos
+	// Update concurrentes no notifican el mismo cambio ni uno invertido
+	old, err := r.db.UpdateItemReturningOld(ctx, itemKey(id), expr)
+	if err != nil {
+		if isConditionFailed(err) {
+			return nil, ErrLambdaNotFound
+		}
+		return nil, err
+	}
+	var previous Lambda
+	if err := attributevalue.UnmarshalMap(old, &previous); err != nil {
+		return nil, fmt.Errorf("error unmarshaling previous state of lambda %s: %w", id, err)
+	}
+
+	// Releer de forma consistente para devolver el estado recién escrito
+	lambda, err := r.get(ctx, id, true)
+	if err != nil {
+		return nil, err
+	}
+	if lambda == nil {
+		return nil, ErrLambdaNotFound
+	}
+
+	if status != nil && previous.Status != *status {
+		// Se notifica el estado escrito aquí, aunque la relectura ya vea otro
+		changed := *lambda
+		changed.Status = *status
+		changed.StatusReason = ""
+		r.notifyStatusChange(changed, previous.Status)
+	}
+
+	return lambda, nil
+}
+
+// TransitionStatus cambia el estado de la Lambda sólo si sigue con el estado
+// y el ultimoLatido leídos, para no pisar un latido o un cambio concurrente.
+// reason se guarda en motivoEstado (vacío lo elimina). Devuelve false si la
+// condición falló.
+func (r *LambdaRegistry) TransitionStatus(ctx context.Context, lambda Lambda, to Status, reason string) (bool, error) {
+	update := expression.Set(expression.Name("estadoSalud"), expression.Value(string(to)))
+	if reason != "" {
+		update = update.Set(expression.Name("motivoEstado"), expression.Value(reason))
+	} else {
+		update = update.Remove(expression.Name("motivoEstado"))
+	}
+
+	condition := expression.Name("estadoSalud").Equal(expression.Value(string(lambda.Status)))
+	if lambda.LastHeartBeat != "" {
+		condition = condition.And(expression.Name("ultimoLatido").Equal(expression.Value(lambda.LastHeartBeat)))
+	} else {
+		condition = condition.And(expression.AttributeNotExists(expression.Name("ultimoLatido")))
+	}
+
+	expr, err := expression.NewBuilder().WithUpdate(update).WithCondition(condition).Build()
+	if err != nil {
+		return false, fmt.Errorf("error building status transition for lambda %s: %w", lambda.ID, err)
+	}
+
+	if err := r.db.UpdateItem(ctx, itemKey(lambda.ID), expr); err != nil {
+		if isConditionFailed(err) {
+			return false, nil
+		}
+		return false, err
+	}
+
+	if len(r.onStatusChange) > 0 {
+		previous := lambda.Status
+		lambda.Status = to
+		lambda.StatusReason = reason
+		r.notifyStatusChange(lambda, previous)
+	}
+	return true, nil
+}
+
+// SetSuspect marca o desmarca la Lambda como sospechosa; reason se guarda en
+// motivoSospecha al marcarla
+func (r *LambdaRegistry) SetSuspect(ctx context.Context, id string, suspect bool, reason string) error {
+	var update expression.UpdateBuilder
+	if suspect {
+		update = update.Set(expression.Name("sospechosa"), expression.Value(true)).
+			Set(expression.Name("motivoSospecha"), expression.Value(reason))
+	} else {
+		update = update.Remove(expression.Name("sospechosa")).Remove(expression.Name("motivoSospecha"))
+	}
+
+	expr, err := expression.NewBuilder().
+		WithUpdate(update).
+		WithCondition(expression.AttributeExists(expression.Name("id"))).
+		Build()
+	if err != nil {
+		return fmt.Errorf("error building suspect update for lambda %s: %w", id, err)
+	}
+
+	if err := r.db.UpdateItem(ctx, itemKey(id), expr); err != nil {
+		if isConditionFailed(err) {
+			return ErrLambdaNotFound
+		}
+		return err
+	}
+	return nil
+}
+
+// Delete elimina la Lambda del registro
+func (r *LambdaRegistry) Delete(ctx context.Context, id string) error {
+	return r.db.DeleteItem(ctx, itemKey(id))
+}
+
+// expiryFor deriva la expiración a partir de ultimoLatido + periodo de gracia
+func (r *LambdaRegistry) expiryFor(lambda Lambda) (time.Time, bool) {
+	if r.grace <= 0 {
+		return time.Time{}, false
+	}
+
+	heartbeat, ok := parseHeartbeat(lambda.LastHeartBeat)
+	if !ok {
+		return time.Time{}, false
+	}
+
+	return heartbeat.Add(r.grace), true
+}
+
+// expired considera el latido más reciente, ya que los trabajadores pueden
+// actualizar ultimoLatido sin recalcular el atributo de expiración
+func (r *LambdaRegistry) expired(lambda Lambda, now time.Time) bool {
+	if r.grace <= 0 {
+		return false
+	}
+
+	if expiry, ok := r.expiryFor(lambda); ok {
+		return !now.Before(expiry)
+	}
+
+	return lambda.ExpiresAt > 0 && now.Unix() >= lambda.ExpiresAt
+}
+
+func itemKey(id string) map[string]types.AttributeValue {
+	return map[string]types.AttributeValue{
+		"id": &types.AttributeValueMemberS{Value: id},
+	}
+}
+
+// isMissingIndex detecta el ValidationException que DynamoDB devuelve al
+// consultar un índice inexistente
+func isMissingIndex(err error) bool {
+	var apiErr smithy.APIError
+	if !errors.As(err, &apiErr) {
+		return false
+	}
+	return apiErr.ErrorCode() == "ValidationException" &&
+		strings.Contains(apiErr.ErrorMessage(), "specified index")
+}
+
+func isConditionFailed(err error) bool {
+	var conditionErr *types.ConditionalCheckFailedException
+	return errors.As(err, &conditionErr)
+}
+
+// parseHeartbeat acepta fechas RFC3339 o epoch en segundos
+func parseHeartbeat(value string) (time.Time, bool) {
+	if value == "" {
+		return time.Time{}, false
+	}
+
+	if seconds, err := strconv.ParseInt(value, 10, 64); err == nil {
+		return time.Unix(seconds, 0), true
+	}
+
+	for _, layout := range heartbeatLayouts {
+		if t, err := time.Parse(layout, value); err == nil {
+			return t, true
+		}
+	}
+
+	return time.Time{}, false
+}
@@ -0,0 +1,59 @@
+package main
+
+import (
+	"context"
+	"slices"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	awsmiddleware "github.com/aws/aws-sdk-go-v2/aws/middleware"
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/aws/smithy-go/middleware"
+)
+
+func TestRegistryListHealthyReadsSecondaryAfterFailover(t *testing.T) {
+	item, err := attributevalue.MarshalMap(testWorker)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Every Query is answered in place, recording the region it went to
+	var mu sync.Mutex
+	var regions []string
+	cfg := aws.Config{
+		Region:      "us-east-1",
+		Credentials: aws.AnonymousCredentials{},
+		APIOptions: []func(*middleware.Stack) error{
+			func(stack *middleware.Stack) error {
+				return stack.Initialize.Add(middleware.InitializeMiddlewareFunc("StubQuery",
+					func(ctx context.Context, in middleware.InitializeInput, next middleware.InitializeHandler) (middleware.InitializeOutput, middleware.Metadata, error) {
+						mu.Lock()
+						regions = append(regions, awsmiddleware.GetRegion(ctx))
+						mu.Unlock()
+						result := &dynamodb.QueryOutput{Items: []map[string]types.AttributeValue{item}}
+						return middleware.InitializeOutput{Result: result}, middleware.Metadata{}, nil
+					}), middleware.After)
+			},
+		},
+	}
+
+	db := NewDynamoDBClient("ServiceState", cfg)
+	db.EnableFailover(cfg, "us-west-2", FailoverOptions{Threshold: 1, FailbackAfter: time.Hour})
+	db.failover.failedOverAt = time.Now()
+	registry := NewLambdaRegistry(db, RegistryOptions{StatusIndex: "estadoSalud-index"})
+
+	lambdas, err := registry.ListHealthy(context.Background())
+	if err != nil {
+		t.Fatalf("ListHealthy: %v", err)
+	}
+	if len(lambdas) == 0 {
+		t.Fatal("ListHealthy returned no workers")
+	}
+	if len(regions) == 0 || slices.ContainsFunc(regions, func(region string) bool { return region != "us-west-2" }) {
+		t.Fatalf("queries went to regions %v, want only the secondary us-west-2", regions)
+	}
+}
@@ -0,0 +1,357 @@
+package main
+
+import (
+	"bufio"
+	"compress/gzip"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"path"
+	"slices"
+	"strings"
+	"time"
+
+	"challenge-4-orchestrator/config"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/sqs"
+	"github.com/aws/aws-sdk-go-v2/service/sqs/types"
+	"go.opentelemetry.io/otel/propagation"
+)
+
+// Replay targets
+const (
+	replayPipeline = "pipeline" // processed in this instance
+	replayQueue    = "queue"    // sent to an SQS queue
+)
+
+var replayedMessages = NewCounterVec(
+	"orchestrator_replayed_messages_total",
+	"Archived messages replayed, by target and result.",
+	"target", "result",
+)
+
+// ReplayRequest selects the archived messages to replay and where to
+type ReplayRequest struct {
+	From time.Time `json:"from"`
+	To   time.Time `json:"to"`
+	// Outcomes filters on the archived outcome, e.g. ["failed"]; empty
+	// replays every message
+	Outcomes []string `json:"outcomes,omitempty"`
+	Target   string   `json:"target"`
+	QueueURL string   `json:"queueUrl,omitempty"` // queue target
+	Rate     float64  `json:"rate"`               // messages per second
+	DryRun   bool     `json:"dryRun"`
+}
+
+// Validate checks the request, defaulting the rate
+func (r *ReplayRequest) Validate() error {
+	if r.Rate == 0 {
+		r.Rate = 10
+	}
+	switch {
+	case r.From.IsZero() || r.To.IsZero():
+		return errors.New("from and to are required")
+	case !r.From.Before(r.To):
+		return errors.New("from must be before to")
+	case r.Target != replayPipeline && r.Target != replayQueue:
+		return fmt.Errorf("target must be %s or %s", replayPipeline, replayQueue)
+	case r.Target == replayQueue && r.QueueURL == "" && !r.DryRun:
+		return errors.New("queueUrl is required with the queue target")
+	case r.Rate < 0:
+		return errors.New("rate must be positive")
+	}
+	return nil
+}
+
+// runReplay implements `orchestrator replay`: it sends archived messages of
+// a time range back to a queue. Replays through the pipeline of a running
+// instance use POST /admin/replay.
+func runReplay(args []string) error {
+	flags := flag.NewFlagSet("replay", flag.ExitOnError)
+	bucket := flags.String("bucket", os.Getenv("ARCHIVE_BUCKET"), "archive bucket (required)")
+	prefix := flags.String("prefix", envOrDefault("ARCHIVE_PREFIX", "messages"), "archive prefix")
+	region := flags.String("region", envOrDefault("AWS_REGION", "us-east-1"), "AWS region")
+	from := flags.String("from", "", "start of the range, RFC 3339 (required)")
+	to := flags.String("to", "", "end of the range, RFC 3339; defaults to now")
+	outcomes := flags.String("outcome", "", "comma-separated outcomes to replay (processed, failed, unparseable); all when empty")
+	queueURL := flags.String("queue-url", os.Getenv("QUEUE_URL"), "queue receiving the messages")
+	rate := flags.Float64("rate", 10, "messages sent per second")
+	dryRun := flags.Bool("dry-run", false, "count the matching messages without sending them")
+	flags.Parse(args)
+
+	if *bucket == "" || *from == "" {
+		flags.Usage()
+		return fmt.Errorf("-bucket and -from are required")
+	}
+	req := ReplayRequest{
+		Outcomes: config.SplitList(*outcomes),
+		Target:   replayQueue,
+		QueueURL: *queueURL,
+		Rate:     *rate,
+		DryRun:   *dryRun,
+	}
+	var err error
+	if req.From, err = time.Parse(time.RFC3339, *from); err != nil {
+		return fmt.Errorf("invalid -from: %w", err)
+	}
+	req.To = time.Now()
+	if *to != "" {
+		if req.To, err = time.Parse(time.RFC3339, *to); err != nil {
+			return fmt.Errorf("invalid -to: %w", err)
+		}
+	}
+	if err := req.Validate(); err != nil {
+		return err
+	}
+
+	ctx := context.Background()
+	awsCfg, err := config.NewAWSConfig(ctx, *region, config.Default().AWS)
+	if err != nil {
+		return err
+	}
+	client := sqs.NewFromConfig(awsCfg, func(o *sqs.Options) {
+		if endpoint := awsEndpoint("SQS"); endpoint != "" {
+			o.BaseEndpoint = aws.String(endpoint)
+		}
+	})
+
+	report, err := NewReplayer(awsCfg, *bucket, *prefix).Replay(ctx, req, replayToQueue(client, *queueURL), func(progress ReplayReport) {
+		slog.Info("Replay progress", "objects", progress.Objects, "matched", progress.Matched, "replayed", progress.Replayed, "failed", progress.Failed)
+	})
+	if err != nil {
+		return err
+	}
+	fmt.Printf("objects: %d, matched: %d, replayed: %d, failed: %d\n", report.Objects, report.Matched, report.Replayed, report.Failed)
+	if report.Failed > 0 {
+		return fmt.Errorf("%d messages could not be replayed", report.Failed)
+	}
+	return nil
+}
+
+// ReplayReport tracks a replay. Matched counts the archived messages in the
+// range; in dry-run mode none is replayed.
+type ReplayReport struct {
+	Request    ReplayRequest `json:"request"`
+	Running    bool          `json:"running"`
+	StartedAt  time.Time     `json:"startedAt"`
+	FinishedAt *time.Time    `json:"finishedAt,omitempty"`
+	Objects    int           `json:"objects"`
+	Matched    int           `json:"matched"`
+	Replayed   int           `json:"replayed"`
+	Failed     int           `json:"failed"`
+	Error      string        `json:"error,omitempty"`
+}
+
+// Replayer reads archived messages back from the S3 archive written by
+// S3Archiver
+type Replayer struct {
+	client *s3.Client
+	bucket string
+	prefix string
+}
+
+func NewReplayer(cfg aws.Config, bucket, prefix string) *Replayer {
+	return &Replayer{
+		client: s3.NewFromConfig(cfg, func(o *s3.Options) {
+			if endpoint := awsEndpoint("S3"); endpoint != "" {
+				o.BaseEndpoint = aws.String(endpoint)
+				o.UsePathStyle = true
+			}
+		}),
+		bucket: bucket,
+		prefix: prefix,
+	}
+}
+
+// Replay submits every archived message of the range that matches the
+// request, at most req.Rate per second. progress is called after each
+// object with the report so far.
+func (r *Replayer) Replay(ctx context.Context, req ReplayRequest, submit func(context.Context, ArchiveRecord) error, progress func(ReplayReport)) (ReplayReport, error) {
+	report := ReplayReport{Request: req, StartedAt: time.Now().UTC()}
+	limiter := newTokenBucket(req.Rate, 1)
+
+	keys, err := r.objectKeys(ctx, req.From, req.To)
+	if err != nil {
+		return report, err
+	}
+	for _, key := range keys {
+		records, err := r.readObject(ctx, key)
+		if err != nil {
+			return report, err
+		}
+		report.Objects++
+
+		for _, record := range records {
+			if record.Timestamp.Before(req.From) || !record.Timestamp.Before(req.To) {
+				continue
+			}
+			if len(req.Outcomes) > 0 && !slices.Contains(req.Outcomes, record.Outcome) {
+				continue
+			}
+			report.Matched++
+			if req.DryRun {
+				continue
+			}
+
+			if err := limiter.Wait(ctx); err != nil {
+				return report, err
+			}
+			if err := submit(ctx, record); err != nil {
+				report.Failed++
+				replayedMessages.Inc(req.Target, "failure")
+				slog.Error("Error replaying message", "message_id", record.MessageID, "target", req.Target, errAttr(err))
+				continue
+			}
+			report.Replayed++
+			replayedMessages.Inc(req.Target, "success")
+		}
+		if progress != nil {
+			progress(report)
+		}
+	}
+	return report, nil
+}
+
+// objectKeys lists the archive objects of the hourly partitions covering
+// the range. A batch is partitioned by its first record, so the partition
+// before the range is read too.
+func (r *Replayer) objectKeys(ctx context.Context, from, to time.Time) ([]string, error) {
+	var keys []string
+	for hour := from.UTC().Truncate(time.Hour).Add(-time.Hour); hour.Before(to); hour = hour.Add(time.Hour) {
+		prefix := path.Join(r.prefix, hour.Format("year=2006/month=01/day=02/hour=15")) + "/"
+		paginator := s3.NewListObjectsV2Paginator(r.client, &s3.ListObjectsV2Input{
+			Bucket: aws.String(r.bucket),
+			Prefix: aws.String(prefix),
+		})
+		for paginator.HasMorePages() {
+			page, err := paginator.NextPage(ctx)
+			if err != nil {
+				return nil, fmt.Errorf("error listing s3://%s/%s: %w", r.bucket, prefix, err)
+			}
+			for _, object := range page.Contents {
+				keys = append(keys, aws.ToString(object.Key))
+			}
+		}
+	}
+	return keys, nil
+}
+
+func (r *Replayer) readObject(ctx context.Context, key string) ([]ArchiveRecord, error) {
+	out, err := r.client.GetObject(ctx, &s3.GetObjectInput{
+		Bucket: aws.String(r.bucket),
+		Key:    aws.String(key),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("error reading s3://%s/%s: %w", r.bucket, key, err)
+	}
+	defer out.Body.Close()
+
+	// Objects are gzip-compressed unless a client decompressed them already
+	body := bufio.NewReader(out.Body)
+	var reader io.Reader = body
+	if magic, err := body.Peek(2); err == nil && magic[0] == 0x1f && magic[1] == 0x8b {
+		gz, err := gzip.NewReader(body)
+		if err != nil {
+			return nil, fmt.Errorf("error decompressing s3://%s/%s: %w", r.bucket, key, err)
+		}
+		defer gz.Close()
+		reader = gz
+	}
+
+	var records []ArchiveRecord
+	decoder := json.NewDecoder(reader)
+	for {
+		var record ArchiveRecord
+		if err := decoder.Decode(&record); err == io.EOF {
+			return records, nil
+		} else if err != nil {
+			return nil, fmt.Errorf("error decoding s3://%s/%s: %w", r.bucket, key, err)
+		}
+		records = append(records, record)
+	}
+}
+
+// replayBody returns the original payload of an archived message
+func replayBody(record ArchiveRecord) ([]byte, error) {
+	if record.BodyEncoding == "base64" {
+		return base64.StdEncoding.DecodeString(record.Body)
+	}
+	return []byte(record.Body), nil
+}
+
+// replayToPipeline processes an archived message in this instance. The
+// replay gets its own dedup ID, so exactly-once mode does not skip it.
+func replayToPipeline(consumer *SQSConsumer) func(context.Context, ArchiveRecord) error {
+	return func(ctx context.Context, record ArchiveRecord) error {
+		body, err := replayBody(record)
+		if err != nil {
+			return fmt.Errorf("error decoding archived body: %w", err)
+		}
+		headers := propagation.MapCarrier{}
+		for key, value := range record.Attributes {
+			headers[key] = value
+		}
+		if record.CorrelationID != "" {
+			headers[correlationIDField] = record.CorrelationID
+		}
+
+		id := "replay-" + record.MessageID
+		if !consumer.process(ctx, InboundMessage{
+			System:  "replay",
+			ID:      id,
+			Body:    body,
+			DedupID: id + "-" + newCorrelationID(),
+			Headers: headers,
+			Ack:     func(context.Context) {},
+		}) {
+			return errors.New("processing failed")
+		}
+		return nil
+	}
+}
+
+// replayToQueue sends archived messages to an SQS queue, keeping the
+// correlation ID as a message attribute
+func replayToQueue(client *sqs.Client, queueURL string) func(context.Context, ArchiveRecord) error {
+	fifo := strings.HasSuffix(queueURL, ".fifo")
+	return func(ctx context.Context, record ArchiveRecord) error {
+		body, err := replayBody(record)
+		if err != nil {
+			return fmt.Errorf("error decoding archived body: %w", err)
+		}
+
+		input := &sqs.SendMessageInput{
+			QueueUrl:    aws.String(queueURL),
+			MessageBody: aws.String(string(body)),
+			MessageAttributes: map[string]types.MessageAttributeValue{
+				"replayOf": {DataType: aws.String("String"), StringValue: aws.String(record.MessageID)},
+			},
+		}
+		if record.CorrelationID != "" {
+			input.MessageAttributes[correlationIDField] = types.MessageAttributeValue{
+				DataType: aws.String("String"), StringValue: aws.String(record.CorrelationID),
+			}
+		}
+		if fifo {
+			group := record.CorrelationID
+			if group == "" {
+				group = record.MessageID
+			}
+			input.MessageGroupId = aws.String(group)
+			input.MessageDeduplicationId = aws.String("replay-" + newCorrelationID())
+		}
+
+		if _, err := client.SendMessage(ctx, input); err != nil {
+			return fmt.Errorf("error sending to %s: %w", queueURL, err)
+		}
+		return nil
+	}
+}
@@ -0,0 +1,123 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/sqs"
+)
+
+// ReplayAPI runs one replay at a time in the background:
+// POST /admin/replay starts it, GET reports its progress and DELETE cancels
+// it. The pipeline target processes the messages in this instance.
+type ReplayAPI struct {
+	replayer *Replayer
+	consumer *SQSConsumer
+	sqs      *sqs.Client
+	auth     Authenticator
+
+	mu     sync.Mutex
+	report *ReplayReport // last or running replay
+	cancel context.CancelFunc
+}
+
+func NewReplayAPI(replayer *Replayer, consumer *SQSConsumer, cfg aws.Config, auth Authenticator) *ReplayAPI {
+	return &ReplayAPI{
+		replayer: replayer,
+		consumer: consumer,
+		sqs: sqs.NewFromConfig(cfg, func(o *sqs.Options) {
+			if endpoint := awsEndpoint("SQS"); endpoint != "" {
+				o.BaseEndpoint = aws.String(endpoint)
+			}
+		}),
+		auth: auth,
+	}
+}
+
+func (a *ReplayAPI) Register(mux *http.ServeMux) {
+	mux.Handle("POST /admin/replay", requireAuth(a.auth, http.HandlerFunc(a.start)))
+	mux.Handle("GET /admin/replay", requireAuth(a.auth, http.HandlerFunc(a.status)))
+	mux.Handle("DELETE /admin/replay", requireAuth(a.auth, http.HandlerFunc(a.stop)))
+}
+
+func (a *ReplayAPI) start(w http.ResponseWriter, r *http.Request) {
+	var req ReplayRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid JSON body: "+err.Error())
+		return
+	}
+	if err := req.Validate(); err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	submit := replayToPipeline(a.consumer)
+	if req.Target == replayQueue {
+		submit = replayToQueue(a.sqs, req.QueueURL)
+	}
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if a.report != nil && a.report.Running {
+		writeError(w, http.StatusConflict, "a replay is already running")
+		return
+	}
+
+	// The replay outlives the request
+	ctx, cancel := context.WithCancel(context.Background())
+	a.cancel = cancel
+	a.report = &ReplayReport{Request: req, Running: true, StartedAt: time.Now().UTC()}
+	go a.run(ctx, req, submit)
+
+	slog.Info("Admin: replay started", "from", req.From, "to", req.To, "target", req.Target, "dry_run", req.DryRun)
+	writeJSON(w, http.StatusAccepted, a.report)
+}
+
+func (a *ReplayAPI) run(ctx context.Context, req ReplayRequest, submit func(context.Context, ArchiveRecord) error) {
+	report, err := a.replayer.Replay(ctx, req, submit, func(progress ReplayReport) {
+		progress.Running = true
+		a.setReport(progress)
+	})
+	finished := time.Now().UTC()
+	report.FinishedAt = &finished
+	if err != nil {
+		report.Error = err.Error()
+		slog.Error("Admin: replay failed", "matched", report.Matched, "replayed", report.Replayed, errAttr(err))
+	} else {
+		slog.Info("Admin: replay finished", "matched", report.Matched, "replayed", report.Replayed, "failed", report.Failed)
+	}
+	a.setReport(report)
+}
+
+func (a *ReplayAPI) setReport(report ReplayReport) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.report = &report
+}
+
+func (a *ReplayAPI) status(w http.ResponseWriter, r *http.Request) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if a.report == nil {
+		writeError(w, http.StatusNotFound, "no replay has run")
+		return
+	}
+	writeJSON(w, http.StatusOK, a.report)
+}
+
+func (a *ReplayAPI) stop(w http.ResponseWriter, r *http.Request) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if a.report == nil || !a.report.Running {
+		writeError(w, http.StatusNotFound, "no replay is running")
+		return
+	}
+	a.cancel()
+	slog.Info("Admin: replay cancelled")
+	w.WriteHeader(http.StatusNoContent)
+}
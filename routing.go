@@ -0,0 +1,180 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"challenge-4-orchestrator/config"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/kinesis"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// Routing strategies recorded in routing decisions
+const (
+	strategyNone     = "none"
+	strategySingle   = "single"
+	strategyWeighted = config.RoutingWeighted
+	strategyAdaptive = "adaptive" // weighted by the registry and adaptive weights
+	strategyUniform  = config.RoutingUniform
+	strategyLatency  = config.RoutingLatency
+	strategyCanary   = "canary"
+	strategyFanOut   = "fanout"
+	strategyQuorum   = "quorum"
+)
+
+// RoutingCandidate is a Lambda considered for a message
+type RoutingCandidate struct {
+	ID     string `json:"id"`
+	ARN    string `json:"arn"`
+	Status Status `json:"status"`
+	Weight int    `json:"weight"`
+}
+
+// RoutingDecision explains why a message was sent to a Lambda
+type RoutingDecision struct {
+	Timestamp     time.Time          `json:"timestamp"`
+	CorrelationID string             `json:"correlationId,omitempty"`
+	Tenant        string             `json:"tenant,omitempty"`
+	Rule          string             `json:"rule,omitempty"` // routing rule that narrowed the candidates
+	TraceID       string             `json:"traceId,omitempty"`
+	Strategy      string             `json:"strategy"`
+	Candidates    []RoutingCandidate `json:"candidates"`
+	ChosenARN     string             `json:"chosenArn,omitempty"`
+	Reason        string             `json:"reason"`
+}
+
+// newRoutingDecision describes the choice of selected among the candidates
+func newRoutingDecision(ctx context.Context, candidates []Lambda, selected Lambda, strategy string) RoutingDecision {
+	decision := RoutingDecision{
+		Timestamp:     time.Now(),
+		CorrelationID: correlationIDFrom(ctx),
+		Tenant:        tenantFrom(ctx),
+		Rule:          routingRuleFrom(ctx),
+		Strategy:      strategy,
+		ChosenARN:     selected.ARN,
+		Candidates:    make([]RoutingCandidate, 0, len(candidates)),
+	}
+	if spanContext := trace.SpanContextFromContext(ctx); spanContext.HasTraceID() {
+		decision.TraceID = spanContext.TraceID().String()
+	}
+
+	total := 0
+	for _, lambda := range candidates {
+		decision.Candidates = append(decision.Candidates, RoutingCandidate{
+			ID:     lambda.ID,
+			ARN:    lambda.ARN,
+			Status: lambda.Status,
+			Weight: lambda.EffectiveWeight(),
+		})
+		total += lambda.EffectiveWeight()
+	}
+
+	switch strategy {
+	case strategyNone:
+		decision.Reason = "no healthy lambdas"
+	case strategySingle:
+		decision.Reason = "only healthy lambda"
+	case strategyWeighted:
+		decision.Reason = fmt.Sprintf("weighted random pick, weight %d of %d", selected.EffectiveWeight(), total)
+	case strategyUniform:
+		decision.Reason = fmt.Sprintf("uniform random pick among %d", len(candidates))
+	case strategyLatency:
+		decision.Reason = fmt.Sprintf("faster of two random picks by p95 among %d", len(candidates))
+	case strategyAdaptive:
+		decision.Reason = fmt.Sprintf("adaptive weighted pick, weight %d of %d", selected.EffectiveWeight(), total)
+	case strategyCanary:
+		decision.Reason = fmt.Sprintf("canary pick, weight %d of %d", selected.EffectiveWeight(), total)
+	case strategyFanOut:
+		decision.Reason = fmt.Sprintf("fan-out to all %d", len(candidates))
+	case strategyQuorum:
+		decision.Reason = fmt.Sprintf("quorum verification among %d", len(candidates))
+	}
+	return decision
+}
+
+// logRoutingDecision writes the decision to the logs and the audit sink
+func (c *SQSConsumer) logRoutingDecision(ctx context.Context, decision RoutingDecision) {
+	arns := make([]string, 0, len(decision.Candidates))
+	for _, candidate := range decision.Candidates {
+		arns = append(arns, candidate.ARN)
+	}
+	loggerFrom(ctx).Info("Routing decision",
+		"strategy", decision.Strategy,
+		"candidates", arns,
+		"chosen_arn", decision.ChosenARN,
+		"rule", decision.Rule,
+		"reason", decision.Reason,
+	)
+
+	if c.audit != nil {
+		c.audit.Publish(decision)
+	}
+}
+
+// KinesisRoutingAudit ships routing decisions to a Kinesis stream (typically
+// delivered to S3 through Firehose). Publishing never blocks message
+// processing: decisions are dropped when the buffer is full.
+type KinesisRoutingAudit struct {
+	client *kinesis.Client
+	stream string
+	events chan RoutingDecision
+}
+
+func NewKinesisRoutingAudit(stream string, cfg aws.Config) *KinesisRoutingAudit {
+	return &KinesisRoutingAudit{
+		client: kinesis.NewFromConfig(cfg),
+		stream: stream,
+		events: make(chan RoutingDecision, 1000),
+	}
+}
+
+func (k *KinesisRoutingAudit) Publish(decision RoutingDecision) {
+	select {
+	case k.events <- decision:
+	default:
+		slog.Warn("Routing audit buffer full, dropping decision", "correlation_id", decision.CorrelationID)
+	}
+}
+
+// Start sends buffered decisions until the context is done
+func (k *KinesisRoutingAudit) Start(ctx context.Context) {
+	slog.Info("Starting routing audit stream", "stream", k.stream)
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case decision := <-k.events:
+			if err := k.put(ctx, decision); err != nil {
+				slog.Error("Error publishing routing decision", "stream", k.stream, errAttr(err))
+			}
+		}
+	}
+}
+
+func (k *KinesisRoutingAudit) put(ctx context.Context, decision RoutingDecision) error {
+	data, err := json.Marshal(decision)
+	if err != nil {
+		return fmt.Errorf("error marshaling routing decision: %w", err)
+	}
+
+	partitionKey := decision.CorrelationID
+	if partitionKey == "" {
+		partitionKey = decision.Timestamp.Format(time.RFC3339Nano)
+	}
+
+	_, err = k.client.PutRecord(ctx, &kinesis.PutRecordInput{
+		StreamName:   aws.String(k.stream),
+		Data:         append(data, '\n'),
+		PartitionKey: aws.String(partitionKey),
+	})
+	if err != nil {
+		return fmt.Errorf("error putting record: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,190 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"reflect"
+	"slices"
+	"strings"
+	"sync/atomic"
+
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue"
+)
+
+var (
+	routingRuleMatches = NewCounterVec(
+		"orchestrator_routing_rule_matches_total",
+		"Messages routed by each routing rule.",
+		"rule",
+	)
+	routingRulesLoaded = NewGaugeVec(
+		"orchestrator_routing_rules",
+		"Routing rules currently loaded.",
+	)
+)
+
+// RoutingRule sends the matching messages to some of the registry entries.
+// It is one item of the routing rules table.
+type RoutingRule struct {
+	ID       string `dynamodbav:"id" json:"id"`
+	Enabled  bool   `dynamodbav:"habilitada" json:"enabled"`
+	Priority int    `dynamodbav:"prioridad" json:"priority"` // lowest first
+	// Conditions; empty ones match every message
+	MessageType string            `dynamodbav:"tipoMensaje,omitempty" json:"messageType,omitempty"`
+	Tenant      string            `dynamodbav:"inquilino,omitempty" json:"tenant,omitempty"`
+	Fields      map[string]string `dynamodbav:"campos,omitempty" json:"fields,omitempty"` // payload field -> value
+	// Targets are the IDs or names of the registry entries to route to
+	Targets []string `dynamodbav:"destinos" json:"targets"`
+	// Strategy overrides the routingStrategy flag: weighted or uniform
+	Strategy string `dynamodbav:"estrategia,omitempty" json:"strategy,omitempty"`
+}
+
+// matches reports whether the message satisfies every condition
+func (r RoutingRule) matches(fields map[string]any, messageType, tenant string) bool {
+	if r.MessageType != "" && r.MessageType != messageType {
+		return false
+	}
+	if r.Tenant != "" && r.Tenant != tenant {
+		return false
+	}
+	for field, want := range r.Fields {
+		if fmt.Sprint(fields[field]) != want {
+			return false
+		}
+	}
+	return true
+}
+
+// routingRuleSet is an immutable version of the rules, swapped as a whole
+type routingRuleSet struct {
+	version string
+	rules   []RoutingRule // enabled, by priority
+}
+
+// RoutingRules polls a DynamoDB table of routing rules and swaps the rule
+// set in memory when it changes, so routing changes need no redeploy. The
+// first enabled rule matching a message, by priority, narrows the workers it
+// can go to. A nil *RoutingRules routes every message to the whole
+// registry.
+type RoutingRules struct {
+	db        *DynamoDBClient
+	typeField string
+
+	current atomic.Pointer[routingRuleSet]
+}
+
+func NewRoutingRules(db *DynamoDBClient, typeField string) *RoutingRules {
+	r := &RoutingRules{db: db, typeField: typeField}
+	r.current.Store(&routingRuleSet{})
+	return r
+}
+
+// Version identifies the rule set in use: a hash of its rules, empty
+// before the first refresh
+func (r *RoutingRules) Version() string {
+	if r == nil {
+		return ""
+	}
+	return r.current.Load().version
+}
+
+// Refresh reads the whole rules table and swaps the rule set if it changed
+func (r *RoutingRules) Refresh(ctx context.Context) error {
+	items, err := r.db.Scan(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("error scanning routing rules: %w", err)
+	}
+	var list []RoutingRule
+	if err := attributevalue.UnmarshalListOfMaps(items, &list); err != nil {
+		return fmt.Errorf("error unmarshaling routing rules: %w", err)
+	}
+
+	var rules []RoutingRule
+	for _, rule := range list {
+		if rule.Enabled {
+			rules = append(rules, rule)
+		}
+	}
+	slices.SortFunc(rules, func(a, b RoutingRule) int {
+		if a.Priority != b.Priority {
+			return a.Priority - b.Priority
+		}
+		return strings.Compare(a.ID, b.ID)
+	})
+	data, err := json.Marshal(rules)
+	if err != nil {
+		return fmt.Errorf("error hashing routing rules: %w", err)
+	}
+	sum := sha256.Sum256(data)
+	next := &routingRuleSet{version: hex.EncodeToString(sum[:6]), rules: rules}
+
+	previous := r.current.Load()
+	if previous.version == next.version {
+		return nil
+	}
+	r.current.Store(next)
+	routingRulesLoaded.Set(float64(len(rules)))
+
+	slog.Info("Routing rules changed", "version", next.version, "previous_version", previous.version, "rules", len(rules))
+	old := make(map[string]RoutingRule, len(previous.rules))
+	for _, rule := range previous.rules {
+		old[rule.ID] = rule
+	}
+	for _, rule := range rules {
+		if before, ok := old[rule.ID]; !ok {
+			slog.Info("Routing rule added", "rule", rule.ID, "priority", rule.Priority, "targets", rule.Targets)
+		} else if !reflect.DeepEqual(before, rule) {
+			slog.Info("Routing rule updated", "rule", rule.ID, "priority", rule.Priority, "targets", rule.Targets)
+		}
+		delete(old, rule.ID)
+	}
+	for id := range old {
+		slog.Info("Routing rule removed", "rule", id)
+	}
+	return nil
+}
+
+type routingRuleKey struct{}
+
+func withRoutingRule(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, routingRuleKey{}, id)
+}
+
+// routingRuleFrom returns the rule routing the message, if any
+func routingRuleFrom(ctx context.Context) string {
+	id, _ := ctx.Value(routingRuleKey{}).(string)
+	return id
+}
+
+// Apply narrows the candidates to the targets of the first rule matching
+// the message. It returns the rule, or nil when none matches and every
+// candidate stays. A matching rule whose targets are all unhealthy leaves no
+// candidates.
+func (r *RoutingRules) Apply(ctx context.Context, msg any, lambdas []Lambda) ([]Lambda, *RoutingRule) {
+	if r == nil {
+		return lambdas, nil
+	}
+	fields, _ := msg.(map[string]any)
+	messageType, _ := fields[r.typeField].(string)
+	tenant := tenantFrom(ctx)
+
+	set := r.current.Load()
+	for i, rule := range set.rules {
+		if !rule.matches(fields, messageType, tenant) {
+			continue
+		}
+		routingRuleMatches.Inc(rule.ID)
+		var targets []Lambda
+		for _, lambda := range lambdas {
+			if slices.Contains(rule.Targets, lambda.ID) || slices.Contains(rule.Targets, lambda.Name) {
+				targets = append(targets, lambda)
+			}
+		}
+		return targets, &set.rules[i]
+	}
+	return lambdas, nil
+}
@@ -0,0 +1,377 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"math/rand"
+	"runtime/debug"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+var (
+	jobRuns = NewCounterVec(
+		"orchestrator_job_runs_total",
+		"Scheduled job runs, by job and result.",
+		"job", "result",
+	)
+	jobDuration = NewHistogramVec(
+		"orchestrator_job_duration_seconds",
+		"Duration of scheduled job runs.",
+		[]float64{0.1, 0.5, 1, 5, 15, 60, 300},
+		"job",
+	)
+)
+
+// Names of the periodic jobs, used as keys of scheduler.jobs
+const (
+	jobReconciler       = "reconciler"
+	jobDiscovery        = "discovery"
+	jobHeartbeatMonitor = "heartbeat-monitor"
+	jobAlertMonitor     = "alert-monitor"
+	jobDLQMonitor       = "dlq-monitor"
+	jobQueueMonitor     = "queue-monitor"
+	jobFlags            = "flags"
+	jobSecrets          = "secrets"
+	jobSchemas          = "schemas"
+	jobRoutingRules     = "routing-rules"
+	jobHandoff          = "handoff"
+	jobSharding         = "sharding"
+	jobPollerScaling    = "poller-scaling"
+	jobSpendGuard       = "spend-guard"
+)
+
+var jobNames = []string{jobReconciler, jobDiscovery, jobHeartbeatMonitor, jobAlertMonitor, jobDLQMonitor, jobQueueMonitor, jobFlags, jobSecrets, jobSchemas, jobRoutingRules, jobHandoff, jobSharding, jobPollerScaling, jobSpendGuard}
+
+// Schedule returns the next run time strictly after the given time
+type Schedule interface {
+	Next(after time.Time) time.Time
+	String() string
+}
+
+// parseSchedule accepts a Go duration ("30s", "@every 5m") or a five-field
+// cron expression ("*/5 * * * *") evaluated in UTC
+func parseSchedule(spec string) (Schedule, error) {
+	spec = strings.TrimSpace(strings.TrimPrefix(strings.TrimSpace(spec), "@every"))
+	if d, err := time.ParseDuration(spec); err == nil {
+		if d <= 0 {
+			return nil, fmt.Errorf("interval %q must be positive", spec)
+		}
+		return everySchedule(d), nil
+	}
+	return parseCron(spec)
+}
+
+type everySchedule time.Duration
+
+func (s everySchedule) Next(after time.Time) time.Time { return after.Add(time.Duration(s)) }
+func (s everySchedule) String() string                 { return "@every " + time.Duration(s).String() }
+
+// cronSchedule holds one bit per allowed value of each field
+type cronSchedule struct {
+	spec                         string
+	minute, hour, dom, month     uint64
+	dow                          uint64
+	domRestricted, dowRestricted bool
+}
+
+var cronFields = []struct {
+	name     string
+	min, max int
+}{
+	{"minute", 0, 59},
+	{"hour", 0, 23},
+	{"day of month", 1, 31},
+	{"month", 1, 12},
+	{"day of week", 0, 7},
+}
+
+func parseCron(spec string) (*cronSchedule, error) {
+	fields := strings.Fields(spec)
+	if len(fields) != len(cronFields) {
+		return nil, fmt.Errorf("schedule %q is neither a duration nor a five-field cron expression", spec)
+	}
+
+	bits := make([]uint64, len(fields))
+	for i, field := range fields {
+		var err error
+		if bits[i], err = parseCronField(field, cronFields[i].min, cronFields[i].max); err != nil {
+			return nil, fmt.Errorf("invalid %s in %q: %w", cronFields[i].name, spec, err)
+		}
+	}
+
+	// Sunday is both 0 and 7
+	if bits[4]&(1<<7) != 0 {
+		bits[4] |= 1
+	}
+	return &cronSchedule{
+		spec:          spec,
+		minute:        bits[0],
+		hour:          bits[1],
+		dom:           bits[2],
+		month:         bits[3],
+		dow:           bits[4],
+		domRestricted: fields[2] != "*",
+		dowRestricted: fields[4] != "*",
+	}, nil
+}
+
+// parseCronField parses lists of "*", "n", "a-b", each optionally "/step"
+func parseCronField(field string, min, max int) (uint64, error) {
+	var bits uint64
+	for _, part := range strings.Split(field, ",") {
+		rangePart, stepPart, hasStep := strings.Cut(part, "/")
+		step := 1
+		if hasStep {
+			var err error
+			if step, err = strconv.Atoi(stepPart); err != nil || step <= 0 {
+				return 0, fmt.Errorf("bad step %q", stepPart)
+			}
+		}
+
+		low, high := min, max
+		if rangePart != "*" {
+			lowPart, highPart, isRange := strings.Cut(rangePart, "-")
+			var err error
+			if low, err = strconv.Atoi(lowPart); err != nil {
+				return 0, fmt.Errorf("bad value %q", lowPart)
+			}
+			high = low
+			if isRange {
+				if high, err = strconv.Atoi(highPart); err != nil {
+					return 0, fmt.Errorf("bad value %q", highPart)
+				}
+			} else if hasStep {
+				high = max
+			}
+		}
+		if low < min || high > max || low > high {
+			return 0, fmt.Errorf("%q is out of range %d-%d", part, min, max)
+		}
+
+		for v := low; v <= high; v += step {
+			bits |= 1 << v
+		}
+	}
+	return bits, nil
+}
+
+func (s *cronSchedule) String() string { return s.spec }
+
+func (s *cronSchedule) Next(after time.Time) time.Time {
+	t := after.UTC().Truncate(time.Minute).Add(time.Minute)
+
+	// Every valid expression matches at least once within a few years
+	limit := t.AddDate(5, 0, 0)
+	for t.Before(limit) {
+		switch {
+		case s.month&(1<<uint(t.Month())) == 0:
+			t = time.Date(t.Year(), t.Month()+1, 1, 0, 0, 0, 0, time.UTC)
+		case !s.dayMatches(t):
+			t = time.Date(t.Year(), t.Month(), t.Day()+1, 0, 0, 0, 0, time.UTC)
+		case s.hour&(1<<uint(t.Hour())) == 0:
+			t = t.Truncate(time.Hour).Add(time.Hour)
+		case s.minute&(1<<uint(t.Minute())) == 0:
+			t = t.Add(time.Minute)
+		default:
+			return t
+		}
+	}
+	return time.Time{}
+}
+
+// dayMatches follows cron: when both day fields are restricted either one
+// may match
+func (s *cronSchedule) dayMatches(t time.Time) bool {
+	dom := s.dom&(1<<uint(t.Day())) != 0
+	dow := s.dow&(1<<uint(t.Weekday())) != 0
+	if s.domRestricted && s.dowRestricted {
+		return dom || dow
+	}
+	return dom && dow
+}
+
+// Job is a named periodic task
+type Job struct {
+	Name     string
+	Schedule Schedule
+	// Immediate runs the job once at start, before its first scheduled time
+	Immediate bool
+	// Singleton jobs only run on the leader replica, and are cancelled when
+	// it loses the leadership
+	Singleton bool
+	Run       func(ctx context.Context) error
+}
+
+// JobStatus is the last-run status of a job, reported on /status
+type JobStatus struct {
+	Name         string     `json:"name"`
+	Schedule     string     `json:"schedule"`
+	Singleton    bool       `json:"singleton,omitempty"`
+	Running      bool       `json:"running"`
+	Runs         int64      `json:"runs"`
+	Failures     int64      `json:"failures"`
+	Skipped      int64      `json:"skipped,omitempty"` // runs skipped while not the leader
+	LastRun      *time.Time `json:"lastRun,omitempty"`
+	LastDuration string     `json:"lastDuration,omitempty"`
+	LastError    string     `json:"lastError,omitempty"`
+	NextRun      *time.Time `json:"nextRun,omitempty"`
+}
+
+// Scheduler runs jobs on their schedules, one goroutine per job. Each run is
+// delayed by a random jitter so replicas and jobs do not fire in lockstep,
+// and a panicking run is recorded as a failure without affecting other jobs.
+type Scheduler struct {
+	elector *LeaderElector
+	jitter  time.Duration
+
+	mu     sync.Mutex
+	jobs   []Job
+	status map[string]*JobStatus
+}
+
+func NewScheduler(elector *LeaderElector, jitter time.Duration) *Scheduler {
+	return &Scheduler{
+		elector: elector,
+		jitter:  jitter,
+		status:  make(map[string]*JobStatus),
+	}
+}
+
+// Add registers a job; it must be called before Start
+func (s *Scheduler) Add(job Job) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.jobs = append(s.jobs, job)
+	s.status[job.Name] = &JobStatus{Name: job.Name, Schedule: job.Schedule.String(), Singleton: job.Singleton}
+}
+
+// Status returns the status of every job, in registration order
+func (s *Scheduler) Status() []JobStatus {
+	if s == nil {
+		return nil
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	statuses := make([]JobStatus, 0, len(s.jobs))
+	for _, job := range s.jobs {
+		statuses = append(statuses, *s.status[job.Name])
+	}
+	return statuses
+}
+
+// Start runs every job until ctx is done
+func (s *Scheduler) Start(ctx context.Context) {
+	s.mu.Lock()
+	jobs := slices.Clone(s.jobs)
+	s.mu.Unlock()
+
+	var wg sync.WaitGroup
+	for _, job := range jobs {
+		slog.Info("Scheduling job", "job", job.Name, "schedule", job.Schedule.String(), "singleton", job.Singleton)
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			s.loop(ctx, job)
+		}()
+	}
+	wg.Wait()
+}
+
+func (s *Scheduler) loop(ctx context.Context, job Job) {
+	if job.Immediate {
+		// The first run waits for the election, or it would be skipped on
+		// every replica
+		if job.Singleton {
+			select {
+			case <-ctx.Done():
+				return
+			case <-s.elector.Elected():
+			}
+		}
+		s.run(ctx, job)
+	}
+
+	for {
+		next := job.Schedule.Next(time.Now())
+		if next.IsZero() {
+			slog.Error("Job has no next run, stopping it", "job", job.Name)
+			return
+		}
+		if s.jitter > 0 {
+			next = next.Add(time.Duration(rand.Int63n(int64(s.jitter))))
+		}
+		s.update(job.Name, func(st *JobStatus) { st.NextRun = &next })
+
+		timer := time.NewTimer(time.Until(next))
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return
+		case <-timer.C:
+		}
+		s.run(ctx, job)
+	}
+}
+
+func (s *Scheduler) run(ctx context.Context, job Job) {
+	if job.Singleton {
+		var cancel context.CancelFunc
+		ctx, cancel = s.elector.LeaderContext(ctx)
+		defer cancel()
+		if ctx.Err() != nil {
+			s.update(job.Name, func(st *JobStatus) { st.Skipped++ })
+			return
+		}
+	}
+
+	s.update(job.Name, func(st *JobStatus) { st.Running = true })
+	started := time.Now()
+	err := runIsolated(ctx, job)
+	elapsed := time.Since(started)
+
+	result := "success"
+	if err != nil {
+		result = "failure"
+		if ctx.Err() == nil {
+			slog.Error("Scheduled job failed", "job", job.Name, durationAttr(elapsed), errAttr(err))
+		}
+	}
+	jobRuns.Inc(job.Name, result)
+	jobDuration.Observe(elapsed.Seconds(), job.Name)
+
+	s.update(job.Name, func(st *JobStatus) {
+		st.Running = false
+		st.Runs++
+		startedUTC := started.UTC()
+		st.LastRun = &startedUTC
+		st.LastDuration = elapsed.String()
+		st.LastError = ""
+		if err != nil {
+			st.Failures++
+			st.LastError = err.Error()
+		}
+	})
+}
+
+// runIsolated turns a panic in the job into an error
+func runIsolated(ctx context.Context, job Job) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("panic: %v", r)
+			slog.Error("Scheduled job panicked", "job", job.Name, "panic", fmt.Sprint(r), "stack", string(debug.Stack()))
+		}
+	}()
+	return job.Run(ctx)
+}
+
+func (s *Scheduler) update(name string, fn func(*JobStatus)) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	fn(s.status[name])
+}
@@ -0,0 +1,221 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"path"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync/atomic"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/santhosh-tekuri/jsonschema/v6"
+	"golang.org/x/text/language"
+	"golang.org/x/text/message"
+)
+
+var schemaValidations = NewCounterVec(
+	"orchestrator_schema_validations_total",
+	"Payloads validated against the schema of their message type, by type and result (valid, invalid).",
+	"message_type", "result",
+)
+
+// SchemaError lists why a payload does not match the schema of its message
+// type. It wraps ErrSchemaInvalid.
+type SchemaError struct {
+	MessageType string
+	Errors      []string // "<instance location>: <error>"
+}
+
+func (e *SchemaError) Error() string {
+	return fmt.Sprintf("%s: %s payload: %s", ErrSchemaInvalid, e.MessageType, strings.Join(e.Errors, "; "))
+}
+
+func (e *SchemaError) Unwrap() error {
+	return ErrSchemaInvalid
+}
+
+// SchemaRegistry validates payloads against the JSON Schema of their message
+// type. Schemas are <message type>.json files in a local directory or under
+// an S3 prefix (s3://bucket/prefix); they may $ref each other by file name.
+// Types without a schema are not validated. A nil *SchemaRegistry
+// validates nothing.
+type SchemaRegistry struct {
+	location  string
+	typeField string
+	s3        *s3.Client // nil for a local directory
+
+	schemas atomic.Pointer[map[string]*jsonschema.Schema]
+}
+
+// NewSchemaRegistry loads the schemas of location
+func NewSchemaRegistry(ctx context.Context, location, typeField string, cfg aws.Config) (*SchemaRegistry, error) {
+	r := &SchemaRegistry{location: location, typeField: typeField}
+	if strings.HasPrefix(location, "s3://") {
+		r.s3 = s3.NewFromConfig(cfg, func(o *s3.Options) {
+			if endpoint := awsEndpoint("S3"); endpoint != "" {
+				o.BaseEndpoint = aws.String(endpoint)
+				o.UsePathStyle = true
+			}
+		})
+	}
+	if err := r.Reload(ctx); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// Reload compiles the schemas again; on error the current ones are kept
+func (r *SchemaRegistry) Reload(ctx context.Context) error {
+	files, err := r.read(ctx)
+	if err != nil {
+		return err
+	}
+
+	compiler := jsonschema.NewCompiler()
+	for name, data := range files {
+		doc, err := jsonschema.UnmarshalJSON(bytes.NewReader(data))
+		if err != nil {
+			return fmt.Errorf("error parsing schema %s: %w", name, err)
+		}
+		if err := compiler.AddResource(schemaURL(name), doc); err != nil {
+			return fmt.Errorf("error adding schema %s: %w", name, err)
+		}
+	}
+	schemas := make(map[string]*jsonschema.Schema, len(files))
+	for name := range files {
+		schema, err := compiler.Compile(schemaURL(name))
+		if err != nil {
+			return fmt.Errorf("error compiling schema %s: %w", name, err)
+		}
+		schemas[strings.TrimSuffix(name, ".json")] = schema
+	}
+
+	r.schemas.Store(&schemas)
+	slog.Info("Message schemas loaded", "location", r.location, "count", len(schemas))
+	return nil
+}
+
+// schemaURL is the URL of a schema file, the base of its relative $refs
+func schemaURL(name string) string {
+	return "schemas:///" + name
+}
+
+// read returns the .json files of the location by file name
+func (r *SchemaRegistry) read(ctx context.Context) (map[string][]byte, error) {
+	files := make(map[string][]byte)
+	if r.s3 == nil {
+		entries, err := os.ReadDir(r.location)
+		if err != nil {
+			return nil, fmt.Errorf("error listing schemas in %s: %w", r.location, err)
+		}
+		for _, entry := range entries {
+			if entry.IsDir() || filepath.Ext(entry.Name()) != ".json" {
+				continue
+			}
+			data, err := os.ReadFile(filepath.Join(r.location, entry.Name()))
+			if err != nil {
+				return nil, fmt.Errorf("error reading schema %s: %w", entry.Name(), err)
+			}
+			files[entry.Name()] = data
+		}
+		return files, nil
+	}
+
+	bucket, prefix, _ := strings.Cut(strings.TrimPrefix(r.location, "s3://"), "/")
+	if prefix != "" && !strings.HasSuffix(prefix, "/") {
+		prefix += "/"
+	}
+	pages := s3.NewListObjectsV2Paginator(r.s3, &s3.ListObjectsV2Input{
+		Bucket: aws.String(bucket),
+		Prefix: aws.String(prefix),
+	})
+	for pages.HasMorePages() {
+		page, err := pages.NextPage(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("error listing schemas in %s: %w", r.location, err)
+		}
+		for _, object := range page.Contents {
+			key := aws.ToString(object.Key)
+			// Only the files directly under the prefix
+			if path.Ext(key) != ".json" || strings.Contains(strings.TrimPrefix(key, prefix), "/") {
+				continue
+			}
+			result, err := r.s3.GetObject(ctx, &s3.GetObjectInput{Bucket: aws.String(bucket), Key: aws.String(key)})
+			if err != nil {
+				return nil, fmt.Errorf("error reading schema %s: %w", key, err)
+			}
+			data, err := io.ReadAll(result.Body)
+			result.Body.Close()
+			if err != nil {
+				return nil, fmt.Errorf("error reading schema %s: %w", key, err)
+			}
+			files[path.Base(key)] = data
+		}
+	}
+	return files, nil
+}
+
+// Types lists the message types with a schema
+func (r *SchemaRegistry) Types() []string {
+	if r == nil {
+		return nil
+	}
+	var types []string
+	for messageType := range *r.schemas.Load() {
+		types = append(types, messageType)
+	}
+	slices.Sort(types)
+	return types
+}
+
+// Validate checks msg against the schema of its message type. It returns a
+// *SchemaError when the payload does not match.
+func (r *SchemaRegistry) Validate(msg any) error {
+	if r == nil {
+		return nil
+	}
+	fields, ok := msg.(map[string]any)
+	if !ok {
+		return nil
+	}
+	messageType, ok := fields[r.typeField].(string)
+	if !ok {
+		return nil
+	}
+	schema, ok := (*r.schemas.Load())[messageType]
+	if !ok {
+		return nil
+	}
+
+	err := schema.Validate(msg)
+	var invalid *jsonschema.ValidationError
+	if !errors.As(err, &invalid) {
+		schemaValidations.Inc(messageType, "valid")
+		return err
+	}
+	schemaValidations.Inc(messageType, "invalid")
+	return &SchemaError{MessageType: messageType, Errors: schemaErrors(invalid, nil)}
+}
+
+var schemaPrinter = message.NewPrinter(language.English)
+
+// schemaErrors flattens a validation error to its causes, which name the
+// failed keywords, e.g. "/amount: minimum: got -3, want 0"
+func schemaErrors(err *jsonschema.ValidationError, errs []string) []string {
+	if len(err.Causes) == 0 {
+		location := "/" + strings.Join(err.InstanceLocation, "/")
+		return append(errs, location+": "+err.ErrorKind.LocalizedString(schemaPrinter))
+	}
+	for _, cause := range err.Causes {
+		errs = schemaErrors(cause, errs)
+	}
+	return errs
+}
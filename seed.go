@@ -0,0 +1,120 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"challenge-4-orchestrator/config"
+
+	"gopkg.in/yaml.v3"
+)
+
+// runSeed implements `orchestrator seed`: it creates the registry table when
+// missing and upserts the Lambda entries listed in a JSON or YAML file.
+func runSeed(args []string) error {
+	flags := flag.NewFlagSet("seed", flag.ExitOnError)
+	file := flags.String("file", "", "JSON or YAML file with the Lambda entries to load (required)")
+	table := flags.String("table", "ServiceState", "registry table name")
+	region := flags.String("region", envOrDefault("AWS_REGION", "us-east-1"), "AWS region")
+	statusIndex := flags.String("status-index", envOrDefault("REGISTRY_STATUS_INDEX", "estadoSalud-index"), "status GSI created with the table")
+	flags.Parse(args)
+
+	if *file == "" {
+		flags.Usage()
+		return fmt.Errorf("-file is required")
+	}
+
+	lambdas, err := loadSeedFile(*file)
+	if err != nil {
+		return err
+	}
+
+	ctx := context.Background()
+
+	awsCfg, err := config.NewAWSConfig(ctx, *region, config.Default().AWS)
+	if err != nil {
+		return err
+	}
+	client := NewDynamoDBClient(*table, awsCfg)
+
+	created, err := client.EnsureTable(ctx, *statusIndex)
+	if err != nil {
+		return err
+	}
+	if created {
+		slog.Info("Created registry table", "table", *table)
+	}
+
+	registry := NewLambdaRegistry(client, RegistryOptions{})
+	now := time.Now().UTC().Format(time.RFC3339)
+
+	for _, lambda := range lambdas {
+		if lambda.Status == "" {
+			lambda.Status = Healthy
+		}
+		if lambda.LastHeartBeat == "" {
+			lambda.LastHeartBeat = now
+		}
+
+		if err := registry.Put(ctx, lambda); err != nil {
+			return fmt.Errorf("error seeding lambda %s: %w", lambda.ID, err)
+		}
+		slog.Info("Seeded lambda", "lambda_id", lambda.ID, "lambda_arn", lambda.ARN, "status", lambda.Status)
+	}
+
+	slog.Info("Seed complete", "count", len(lambdas), "table", *table)
+	return nil
+}
+
+// loadSeedFile reads a list of Lambda entries. YAML is converted to JSON so
+// both formats share the json field names of Lambda.
+func loadSeedFile(path string) ([]Lambda, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("error reading seed file: %w", err)
+	}
+
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".yaml", ".yml":
+		var entries []map[string]any
+		if err := yaml.Unmarshal(data, &entries); err != nil {
+			return nil, fmt.Errorf("error parsing YAML seed file: %w", err)
+		}
+		if data, err = json.Marshal(entries); err != nil {
+			return nil, fmt.Errorf("error converting YAML seed file: %w", err)
+		}
+	}
+
+	var lambdas []Lambda
+	if err := json.Unmarshal(data, &lambdas); err != nil {
+		return nil, fmt.Errorf("error parsing seed file: %w", err)
+	}
+
+	for i, lambda := range lambdas {
+		if lambda.ID == "" || lambda.ARN == "" {
+			return nil, fmt.Errorf("seed entry %d: id and arn are required", i)
+		}
+		if lambda.Status != "" && !lambda.Status.Valid() {
+			return nil, fmt.Errorf("seed entry %d: invalid status %q", i, lambda.Status)
+		}
+		if !lambda.Type.Valid() {
+			return nil, fmt.Errorf("seed entry %d: invalid type %q", i, lambda.Type)
+		}
+	}
+
+	return lambdas, nil
+}
+
+func envOrDefault(key, fallback string) string {
+	if value := os.Getenv(key); value != "" {
+		return value
+	}
+	return fallback
+}
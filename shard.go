@@ -0,0 +1,130 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/binary"
+	"log/slog"
+	"slices"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// shardVirtualNodes is the points of each replica on the hash ring, so the
+// queues spread evenly and a membership change moves few of them
+const shardVirtualNodes = 256
+
+var queueShardOwned = NewGaugeVec(
+	"orchestrator_queue_shard_owned",
+	"1 while this replica polls the queue under sharding.",
+	"queue",
+)
+
+// hashRing places the replicas on a consistent-hash ring
+type hashRing struct {
+	points []uint64
+	owners map[uint64]string
+}
+
+// shardHash spreads keys with long common prefixes, such as queue URLs,
+// which FNV leaves clustered
+func shardHash(key string) uint64 {
+	sum := sha256.Sum256([]byte(key))
+	return binary.BigEndian.Uint64(sum[:8])
+}
+
+func newHashRing(members []string) *hashRing {
+	ring := &hashRing{owners: make(map[uint64]string, len(members)*shardVirtualNodes)}
+	for _, member := range members {
+		for i := range shardVirtualNodes {
+			point := shardHash(member + "#" + strconv.Itoa(i))
+			ring.points = append(ring.points, point)
+			ring.owners[point] = member
+		}
+	}
+	slices.Sort(ring.points)
+	return ring
+}
+
+// owner returns the member owning key: the first point after its hash
+func (r *hashRing) owner(key string) string {
+	hash := shardHash(key)
+	i, _ := slices.BinarySearch(r.points, hash)
+	if i == len(r.points) {
+		i = 0
+	}
+	return r.owners[r.points[i]]
+}
+
+// Sharding splits the SQS queues between the replicas instead of all of
+// them polling every queue. The live replicas, those with a fresh heartbeat
+// in the orchestrator table that are ready and not paused, form a
+// consistent-hash ring and each queue URL goes to one of them; when a
+// replica joins or leaves only its share of the queues moves. Tenants with
+// their own queue are split with them. Until the first refresh, and when the
+// table cannot be read, the assignment is kept as it was, polling every
+// queue at startup.
+type Sharding struct {
+	db         *DynamoDBClient
+	consumer   *SQSConsumer
+	instanceID string
+	freshness  time.Duration // heartbeats older than this are not members
+
+	mu      sync.Mutex
+	members []string
+}
+
+func NewSharding(db *DynamoDBClient, consumer *SQSConsumer, heartbeat *Heartbeater) *Sharding {
+	for _, queue := range consumer.queues {
+		queueShardOwned.Set(1, queue.name)
+	}
+	return &Sharding{
+		db:         db,
+		consumer:   consumer,
+		instanceID: heartbeat.InstanceID(),
+		freshness:  3 * heartbeat.interval,
+	}
+}
+
+// Refresh reads the live replicas and rebalances the queues when they
+// changed
+func (s *Sharding) Refresh(ctx context.Context) error {
+	heartbeats, err := liveHeartbeats(ctx, s.db, s.freshness)
+	if err != nil {
+		return err
+	}
+	var members []string
+	for _, heartbeat := range heartbeats {
+		if heartbeat.Ready && !heartbeat.Paused && heartbeat.InstanceID != s.instanceID {
+			members = append(members, heartbeat.InstanceID)
+		}
+	}
+	// This replica polls as soon as it consumes, before its heartbeat says so
+	if s.consumer.Paused() == nil {
+		members = append(members, s.instanceID)
+	}
+	slices.Sort(members)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if slices.Equal(members, s.members) {
+		return nil
+	}
+	s.members = members
+
+	ring := newHashRing(members)
+	var owned []string
+	for _, queue := range s.consumer.queues {
+		mine := len(members) > 0 && ring.owner(queue.URL) == s.instanceID
+		queue.owned.Store(mine)
+		if mine {
+			owned = append(owned, queue.name)
+			queueShardOwned.Set(1, queue.name)
+		} else {
+			queueShardOwned.Set(0, queue.name)
+		}
+	}
+	slog.Info("Queues rebalanced across replicas", "replicas", len(members), "owned", owned)
+	return nil
+}
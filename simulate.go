@@ -0,0 +1,426 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"log/slog"
+	"maps"
+	"math/rand"
+	"os"
+	"os/signal"
+	"slices"
+	"strconv"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	awsmiddleware "github.com/aws/aws-sdk-go-v2/aws/middleware"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	dynamotypes "github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/aws/aws-sdk-go-v2/service/lambda"
+	lambdatypes "github.com/aws/aws-sdk-go-v2/service/lambda/types"
+	"github.com/aws/aws-sdk-go-v2/service/sqs"
+	sqstypes "github.com/aws/aws-sdk-go-v2/service/sqs/types"
+	"github.com/aws/smithy-go/middleware"
+)
+
+// Names of the simulated resources
+const (
+	simulatedQueueURL  = "https://sqs.us-east-1.amazonaws.com/000000000000/simulated"
+	simulatedTable     = "simulated-registry"
+	simulatedIntegrity = "simulated-integrity"
+)
+
+// simulatedWorkers are registered when no -registry file is given
+var simulatedWorkers = []Lambda{
+	{ID: "worker-a", ARN: "arn:aws:lambda:us-east-1:000000000000:function:worker-a", Name: "worker-a", Status: Healthy, Weight: aws.Int(2)},
+	{ID: "worker-b", ARN: "arn:aws:lambda:us-east-1:000000000000:function:worker-b", Name: "worker-b", Status: Healthy, Weight: aws.Int(1)},
+}
+
+// SimulationOptions configures the stub Lambdas and the fake queue
+type SimulationOptions struct {
+	// HashField is verified by the stub integrity Lambda like the hash set
+	// by loadgen; payloads without it pass
+	HashField string
+	// WorkerLatency delays every worker invocation
+	WorkerLatency time.Duration
+	// WorkerErrorRate, from 0 to 1, fails worker invocations
+	WorkerErrorRate float64
+	// Visibility is how long a received message stays hidden before it is
+	// received again; after MaxReceives it is dead-lettered
+	Visibility  time.Duration
+	MaxReceives int
+}
+
+// Simulation answers the SQS, DynamoDB and Lambda calls of the processing
+// path in memory, so it runs without AWS credentials: a queue loaded from a
+// file, the registry table, and stub integrity and worker Lambdas. Calls
+// are answered before they reach the network, so the real clients and
+// everything built on them run unchanged.
+type Simulation struct {
+	opts SimulationOptions
+
+	mu           sync.Mutex
+	queue        []*simulatedMessage
+	inFlight     map[string]*simulatedMessage // by receipt handle
+	acked        int
+	deadLettered int
+	items        map[string]map[string]dynamotypes.AttributeValue // registry by id
+	invocations  map[string]int                                   // by function
+}
+
+type simulatedMessage struct {
+	id        string
+	body      string
+	sent      time.Time
+	receives  int
+	visibleAt time.Time
+}
+
+func NewSimulation(opts SimulationOptions) *Simulation {
+	return &Simulation{
+		opts:        opts,
+		inFlight:    make(map[string]*simulatedMessage),
+		items:       make(map[string]map[string]dynamotypes.AttributeValue),
+		invocations: make(map[string]int),
+	}
+}
+
+// Config returns an AWS config whose clients talk to the simulation
+func (s *Simulation) Config() aws.Config {
+	return aws.Config{
+		Region:      "us-east-1",
+		Credentials: aws.AnonymousCredentials{},
+		APIOptions: []func(*middleware.Stack) error{
+			func(stack *middleware.Stack) error {
+				return stack.Initialize.Add(middleware.InitializeMiddlewareFunc("Simulation", s.handle), middleware.After)
+			},
+		},
+	}
+}
+
+// Enqueue adds message bodies to the fake queue. Each element of a JSON
+// array is a message; strings are sent as they are, so unparseable bodies
+// can be simulated too.
+func (s *Simulation) Enqueue(data []byte) error {
+	var bodies []json.RawMessage
+	if err := json.Unmarshal(data, &bodies); err != nil {
+		return fmt.Errorf("messages must be a JSON array: %w", err)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, raw := range bodies {
+		body := string(raw)
+		var text string
+		if json.Unmarshal(raw, &text) == nil {
+			body = text
+		}
+		s.queue = append(s.queue, &simulatedMessage{id: newCorrelationID(), body: body, sent: time.Now()})
+	}
+	return nil
+}
+
+// Drained reports whether every message was acknowledged or dead-lettered
+func (s *Simulation) Drained() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return len(s.queue) == 0 && len(s.inFlight) == 0
+}
+
+func (s *Simulation) handle(ctx context.Context, in middleware.InitializeInput, next middleware.InitializeHandler) (middleware.InitializeOutput, middleware.Metadata, error) {
+	service := awsmiddleware.GetServiceID(ctx)
+	operation := awsmiddleware.GetOperationName(ctx)
+
+	var result any
+	var err error
+	switch params := in.Parameters.(type) {
+	case *sqs.ReceiveMessageInput:
+		result = s.receive(ctx, params)
+	case *sqs.DeleteMessageInput:
+		result, err = s.delete(params)
+	case *sqs.GetQueueAttributesInput:
+		result = s.queueAttributes()
+	case *dynamodb.ScanInput:
+		result = s.scan()
+	case *dynamodb.GetItemInput:
+		result = s.getItem(params)
+	case *dynamodb.PutItemInput:
+		result = s.putItem(params)
+	case *lambda.InvokeInput:
+		result, err = s.invoke(ctx, params)
+	default:
+		err = fmt.Errorf("simulation: %s %s is not supported", service, operation)
+	}
+	return middleware.InitializeOutput{Result: result}, middleware.Metadata{}, err
+}
+
+func (s *Simulation) receive(ctx context.Context, input *sqs.ReceiveMessageInput) *sqs.ReceiveMessageOutput {
+	for {
+		if messages := s.take(int(input.MaxNumberOfMessages)); len(messages) > 0 {
+			return &sqs.ReceiveMessageOutput{Messages: messages}
+		}
+		// Long poll, waking up for messages whose visibility timed out. Like
+		// an empty poll, a cancelled one returns no messages.
+		if sleepContext(ctx, 200*time.Millisecond) != nil || s.Drained() {
+			return &sqs.ReceiveMessageOutput{}
+		}
+	}
+}
+
+// take receives up to limit visible messages, first returning to the queue
+// those not deleted before their visibility timed out
+func (s *Simulation) take(limit int) []sqstypes.Message {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	for receipt, message := range s.inFlight {
+		if now.Before(message.visibleAt) {
+			continue
+		}
+		delete(s.inFlight, receipt)
+		if message.receives >= s.opts.MaxReceives {
+			s.deadLettered++
+			slog.Warn("Simulation: message dead-lettered", "message_id", message.id, "receives", message.receives)
+			continue
+		}
+		s.queue = append(s.queue, message)
+	}
+
+	var messages []sqstypes.Message
+	for len(s.queue) > 0 && len(messages) < max(limit, 1) {
+		message := s.queue[0]
+		s.queue = s.queue[1:]
+		message.receives++
+		message.visibleAt = now.Add(s.opts.Visibility)
+		receipt := newCorrelationID()
+		s.inFlight[receipt] = message
+		messages = append(messages, sqstypes.Message{
+			MessageId:     aws.String(message.id),
+			ReceiptHandle: aws.String(receipt),
+			Body:          aws.String(message.body),
+			Attributes: map[string]string{
+				string(sqstypes.MessageSystemAttributeNameApproximateReceiveCount): strconv.Itoa(message.receives),
+				string(sqstypes.MessageSystemAttributeNameSentTimestamp):           strconv.FormatInt(message.sent.UnixMilli(), 10),
+			},
+		})
+	}
+	return messages
+}
+
+func (s *Simulation) delete(input *sqs.DeleteMessageInput) (*sqs.DeleteMessageOutput, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	receipt := aws.ToString(input.ReceiptHandle)
+	if _, ok := s.inFlight[receipt]; !ok {
+		return nil, &sqstypes.ReceiptHandleIsInvalid{Message: aws.String("simulation: unknown or expired receipt handle")}
+	}
+	delete(s.inFlight, receipt)
+	s.acked++
+	return &sqs.DeleteMessageOutput{}, nil
+}
+
+func (s *Simulation) queueAttributes() *sqs.GetQueueAttributesOutput {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return &sqs.GetQueueAttributesOutput{Attributes: map[string]string{
+		string(sqstypes.QueueAttributeNameApproximateNumberOfMessages):           strconv.Itoa(len(s.queue)),
+		string(sqstypes.QueueAttributeNameApproximateNumberOfMessagesNotVisible): strconv.Itoa(len(s.inFlight)),
+	}}
+}
+
+func (s *Simulation) scan() *dynamodb.ScanOutput {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	items := make([]map[string]dynamotypes.AttributeValue, 0, len(s.items))
+	for _, id := range slices.Sorted(maps.Keys(s.items)) {
+		items = append(items, s.items[id])
+	}
+	return &dynamodb.ScanOutput{Items: items, Count: int32(len(items))}
+}
+
+func (s *Simulation) getItem(input *dynamodb.GetItemInput) *dynamodb.GetItemOutput {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return &dynamodb.GetItemOutput{Item: s.items[itemID(input.Key)]}
+}
+
+func (s *Simulation) putItem(input *dynamodb.PutItemInput) *dynamodb.PutItemOutput {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.items[itemID(input.Item)] = input.Item
+	return &dynamodb.PutItemOutput{}
+}
+
+func itemID(item map[string]dynamotypes.AttributeValue) string {
+	if id, ok := item["id"].(*dynamotypes.AttributeValueMemberS); ok {
+		return id.Value
+	}
+	return ""
+}
+
+// invoke runs the stub integrity Lambda or echoes the payload from a stub
+// worker of the registry
+func (s *Simulation) invoke(ctx context.Context, input *lambda.InvokeInput) (*lambda.InvokeOutput, error) {
+	function := aws.ToString(input.FunctionName)
+	s.mu.Lock()
+	s.invocations[function]++
+	s.mu.Unlock()
+
+	if function == simulatedIntegrity {
+		response := LambdaResponse{StatusCode: 200}
+		if err := s.verifyHash(input.Payload); err != nil {
+			response = LambdaResponse{StatusCode: 400, Body: err.Error()}
+		}
+		payload, err := json.Marshal(response)
+		return &lambda.InvokeOutput{StatusCode: 200, Payload: payload}, err
+	}
+
+	if !s.isWorker(function) {
+		return nil, &lambdatypes.ResourceNotFoundException{Message: aws.String("simulation: function not found: " + function)}
+	}
+	if err := sleepContext(ctx, s.opts.WorkerLatency); err != nil {
+		return nil, err
+	}
+	if rand.Float64() < s.opts.WorkerErrorRate {
+		return &lambda.InvokeOutput{
+			StatusCode:    200,
+			FunctionError: aws.String("Unhandled"),
+			Payload:       []byte(`{"errorMessage":"simulated worker failure"}`),
+		}, nil
+	}
+	payload, err := json.Marshal(LambdaResponse{
+		StatusCode: 200,
+		Body:       map[string]any{"worker": function, "received": json.RawMessage(input.Payload)},
+	})
+	return &lambda.InvokeOutput{StatusCode: 200, Payload: payload}, err
+}
+
+// verifyHash checks the hash of an object payload the way loadgen signs it,
+// leaving out the correlation ID added by the orchestrator
+func (s *Simulation) verifyHash(payload []byte) error {
+	var fields map[string]any
+	if json.Unmarshal(payload, &fields) != nil {
+		return nil
+	}
+	hash, ok := fields[s.opts.HashField].(string)
+	if !ok {
+		return nil
+	}
+	delete(fields, s.opts.HashField)
+	delete(fields, correlationIDField)
+	expected, err := payloadHash(fields)
+	if err != nil {
+		return err
+	}
+	if hash != expected {
+		return errors.New("hash mismatch")
+	}
+	return nil
+}
+
+func (s *Simulation) isWorker(function string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, item := range s.items {
+		if arn, ok := item["arn"].(*dynamotypes.AttributeValueMemberS); ok && arn.Value == function {
+			return true
+		}
+	}
+	return false
+}
+
+// Summary prints the outcome of the simulation
+func (s *Simulation) Summary() string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	summary := fmt.Sprintf("acknowledged: %d, dead-lettered: %d, pending: %d\n", s.acked, s.deadLettered, len(s.queue)+len(s.inFlight))
+	for _, function := range slices.Sorted(maps.Keys(s.invocations)) {
+		summary += fmt.Sprintf("  %s: %d invocations\n", function, s.invocations[function])
+	}
+	return summary
+}
+
+// runSimulate implements `orchestrator simulate`
+func runSimulate(args []string) error {
+	flags := flag.NewFlagSet("simulate", flag.ExitOnError)
+	messagesFile := flags.String("messages", "", "JSON array of message bodies to process (required)")
+	registryFile := flags.String("registry", "", "JSON or YAML worker entries, as for seed; two stub workers when empty")
+	hashField := flags.String("hash-field", "hash", "field verified by the stub integrity Lambda")
+	latency := flags.Duration("worker-latency", 10*time.Millisecond, "latency of the stub workers")
+	errorRate := flags.Float64("worker-error-rate", 0, "fraction of worker invocations, from 0 to 1, that fail")
+	visibility := flags.Duration("visibility", 2*time.Second, "visibility timeout of the fake queue")
+	maxReceives := flags.Int("max-receives", 3, "receives before a message is dead-lettered")
+	flags.Parse(args)
+
+	if *messagesFile == "" {
+		flags.Usage()
+		return errors.New("-messages is required")
+	}
+	data, err := os.ReadFile(*messagesFile)
+	if err != nil {
+		return fmt.Errorf("error reading messages: %w", err)
+	}
+	workers := simulatedWorkers
+	if *registryFile != "" {
+		if workers, err = loadSeedFile(*registryFile); err != nil {
+			return err
+		}
+	}
+
+	simulation := NewSimulation(SimulationOptions{
+		HashField:       *hashField,
+		WorkerLatency:   *latency,
+		WorkerErrorRate: *errorRate,
+		Visibility:      *visibility,
+		MaxReceives:     *maxReceives,
+	})
+	if err := simulation.Enqueue(data); err != nil {
+		return err
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	// The real registry and clients, over the simulation
+	awsCfg := simulation.Config()
+	registry := NewLambdaRegistry(NewDynamoDBClient(simulatedTable, awsCfg), RegistryOptions{})
+	for _, worker := range workers {
+		if worker.Status == "" {
+			worker.Status = Healthy
+		}
+		if err := registry.Put(ctx, worker); err != nil {
+			return fmt.Errorf("error registering %s: %w", worker.ID, err)
+		}
+	}
+	consumer := NewSQSConsumer(simulatedQueueURL, awsCfg, registry, NewLambdaClient(awsCfg), ConsumerOptions{
+		IntegrityLambda: simulatedIntegrity,
+	})
+
+	slog.Info("Starting simulation", "messages_file", *messagesFile, "workers", len(workers))
+	consumerCtx, cancel := context.WithCancel(ctx)
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		consumer.Start(consumerCtx)
+	}()
+
+	ticker := time.NewTicker(100 * time.Millisecond)
+	defer ticker.Stop()
+	for !simulation.Drained() && ctx.Err() == nil {
+		select {
+		case <-ctx.Done():
+		case <-ticker.C:
+		}
+	}
+	cancel()
+	<-done
+
+	fmt.Print(simulation.Summary())
+	return nil
+}
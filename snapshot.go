@@ -0,0 +1,292 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"log/slog"
+	"os"
+	"reflect"
+	"slices"
+	"text/tabwriter"
+	"time"
+
+	"challenge-4-orchestrator/config"
+
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+)
+
+type ImportMode string
+
+const (
+	// ImportMerge inserta o actualiza las entradas del documento y conserva el resto
+	ImportMerge ImportMode = "merge"
+	// ImportReplace deja el registro igual al documento, eliminando lo que sobra
+	ImportReplace ImportMode = "replace"
+)
+
+// RegistrySnapshot es el documento JSON de exportación/importación del registro
+type RegistrySnapshot struct {
+	ExportedAt time.Time `json:"exportedAt"`
+	Table      string    `json:"table"`
+	Lambdas    []Lambda  `json:"lambdas"`
+}
+
+// ImportReport resume los cambios aplicados (o que se aplicarían en dry-run)
+type ImportReport struct {
+	Mode      ImportMode `json:"mode"`
+	DryRun    bool       `json:"dryRun"`
+	Created   []string   `json:"created"`
+	Updated   []string   `json:"updated"`
+	Unchanged []string   `json:"unchanged"`
+	Deleted   []string   `json:"deleted"`
+}
+
+// Export devuelve todas las entradas del registro, incluidas las expiradas
+// que DynamoDB aún no ha purgado
+func (r *LambdaRegistry) Export(ctx context.Context) (*RegistrySnapshot, error) {
+	lambdas, err := r.all(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	return &RegistrySnapshot{
+		ExportedAt: time.Now().UTC(),
+		Table:      r.db.tableName,
+		Lambdas:    lambdas,
+	}, nil
+}
+
+// Import aplica el documento en modo merge o replace usando escrituras por lotes
+func (r *LambdaRegistry) Import(ctx context.Context, snapshot *RegistrySnapshot, mode ImportMode, dryRun bool) (*ImportReport, error) {
+	if mode != ImportMerge && mode != ImportReplace {
+		return nil, fmt.Errorf("invalid import mode %q", mode)
+	}
+
+	incoming := make(map[string]bool, len(snapshot.Lambdas))
+	for i, lambda := range snapshot.Lambdas {
+		if lambda.ID == "" || lambda.ARN == "" {
+			return nil, fmt.Errorf("entry %d: id and arn are required", i)
+		}
+		if !lambda.Status.Valid() {
+			return nil, fmt.Errorf("entry %d: invalid status %q", i, lambda.Status)
+		}
+		if !lambda.Type.Valid() {
+			return nil, fmt.Errorf("entry %d: invalid type %q", i, lambda.Type)
+		}
+		if incoming[lambda.ID] {
+			return nil, fmt.Errorf("entry %d: duplicate id %s", i, lambda.ID)
+		}
+		incoming[lambda.ID] = true
+	}
+
+	current, err := r.all(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	existing := make(map[string]Lambda, len(current))
+	for _, lambda := range current {
+		existing[lambda.ID] = lambda
+	}
+
+	report := &ImportReport{Mode: mode, DryRun: dryRun}
+	var puts []map[string]types.AttributeValue
+
+	for _, lambda := range snapshot.Lambdas {
+		previous, found := existing[lambda.ID]
+		switch {
+		case !found:
+			report.Created = append(report.Created, lambda.ID)
+		case sameEntry(previous, lambda):
+			report.Unchanged = append(report.Unchanged, lambda.ID)
+			continue
+		default:
+			report.Updated = append(report.Updated, lambda.ID)
+		}
+
+		item, err := r.marshal(lambda)
+		if err != nil {
+			return nil, err
+		}
+		puts = append(puts, item)
+	}
+
+	var deletes []map[string]types.AttributeValue
+	if mode == ImportReplace {
+		for _, lambda := range current {
+			if !incoming[lambda.ID] {
+				report.Deleted = append(report.Deleted, lambda.ID)
+				deletes = append(deletes, itemKey(lambda.ID))
+			}
+		}
+	}
+
+	if dryRun {
+		return report, nil
+	}
+
+	if err := r.db.BatchPutItems(ctx, puts); err != nil {
+		return report, err
+	}
+	if err := r.db.BatchDeleteItems(ctx, deletes); err != nil {
+		return report, err
+	}
+
+	return report, nil
+}
+
+func (r *LambdaRegistry) all(ctx context.Context) ([]Lambda, error) {
+	items, err := r.db.Scan(ctx, nil)
+	if err != nil {
+		return nil, fmt.Errorf("error scanning table %s: %w", r.db.tableName, err)
+	}
+
+	var lambdas []Lambda
+	if err := attributevalue.UnmarshalListOfMaps(items, &lambdas); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal items: %w", err)
+	}
+
+	return lambdas, nil
+}
+
+// sameEntry compara dos entradas ignorando la expiración, que se recalcula al escribir
+func sameEntry(a, b Lambda) bool {
+	if !slices.Equal(a.Tenants, b.Tenants) {
+		return false
+	}
+	a.ExpiresAt, b.ExpiresAt = 0, 0
+	a.Tenants, b.Tenants = nil, nil
+	return reflect.DeepEqual(a, b)
+}
+
+// runRegistryCommand implementa `orchestrator registry list|export|import|set|delete`
+func runRegistryCommand(args []string) error {
+	if len(args) == 0 {
+		return fmt.Errorf("usage: orchestrator registry <list|export|import|set|delete> [flags]")
+	}
+
+	flags := flag.NewFlagSet("registry "+args[0], flag.ExitOnError)
+	file := flags.String("file", "", "JSON document to write (export) or read (import); stdout/stdin when empty")
+	table := flags.String("table", "ServiceState", "registry table name")
+	region := flags.String("region", envOrDefault("AWS_REGION", "us-east-1"), "AWS region")
+	mode := flags.String("mode", string(ImportMerge), "import mode: merge or replace")
+	dryRun := flags.Bool("dry-run", false, "report the import changes without writing them")
+	id := flags.String("id", "", "lambda id (set, delete)")
+	status := flags.String("status", "", "new health status (set)")
+	weight := flags.Int("weight", -1, "new routing weight, 0 drains the Lambda (set)")
+	flags.Parse(args[1:])
+
+	ctx := context.Background()
+
+	awsCfg, err := config.NewAWSConfig(ctx, *region, config.Default().AWS)
+	if err != nil {
+		return err
+	}
+	client := NewDynamoDBClient(*table, awsCfg)
+	registry := NewLambdaRegistry(client, RegistryOptions{})
+
+	switch args[0] {
+	case "list":
+		lambdas, err := registry.List(ctx)
+		if err != nil {
+			return err
+		}
+
+		w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+		fmt.Fprintln(w, "ID\tSTATUS\tWEIGHT\tSOURCE\tLAST HEARTBEAT\tARN")
+		for _, lambda := range lambdas {
+			fmt.Fprintf(w, "%s\t%s\t%d\t%s\t%s\t%s\n", lambda.ID, lambda.Status, lambda.EffectiveWeight(),
+				lambda.Source, lambda.LastHeartBeat, lambda.ARN)
+		}
+		return w.Flush()
+
+	case "set":
+		if *id == "" {
+			return fmt.Errorf("-id is required")
+		}
+		var newStatus *Status
+		if *status != "" {
+			s := Status(*status)
+			if !s.Valid() {
+				return fmt.Errorf("invalid status %q", *status)
+			}
+			newStatus = &s
+		}
+		var newWeight *int
+		if *weight >= 0 {
+			newWeight = weight
+		}
+		if newStatus == nil && newWeight == nil {
+			return fmt.Errorf("-status or -weight is required")
+		}
+
+		lambda, err := registry.Update(ctx, *id, newStatus, newWeight)
+		if err != nil {
+			return err
+		}
+		slog.Info("Registry entry updated", "lambda_id", lambda.ID, "status", lambda.Status, "weight", lambda.EffectiveWeight())
+		return nil
+
+	case "delete":
+		if *id == "" {
+			return fmt.Errorf("-id is required")
+		}
+		if err := registry.Delete(ctx, *id); err != nil {
+			return err
+		}
+		slog.Info("Registry entry deleted", "lambda_id", *id)
+		return nil
+
+	case "export":
+		snapshot, err := registry.Export(ctx)
+		if err != nil {
+			return err
+		}
+
+		output := os.Stdout
+		if *file != "" {
+			if output, err = os.Create(*file); err != nil {
+				return fmt.Errorf("error creating export file: %w", err)
+			}
+			defer output.Close()
+		}
+
+		encoder := json.NewEncoder(output)
+		encoder.SetIndent("", "  ")
+		if err := encoder.Encode(snapshot); err != nil {
+			return fmt.Errorf("error writing export: %w", err)
+		}
+
+		slog.Info("Registry exported", "count", len(snapshot.Lambdas), "table", *table)
+		return nil
+
+	case "import":
+		input := os.Stdin
+		if *file != "" {
+			if input, err = os.Open(*file); err != nil {
+				return fmt.Errorf("error opening import file: %w", err)
+			}
+			defer input.Close()
+		}
+
+		var snapshot RegistrySnapshot
+		if err := json.NewDecoder(input).Decode(&snapshot); err != nil {
+			return fmt.Errorf("error parsing import file: %w", err)
+		}
+
+		report, err := registry.Import(ctx, &snapshot, ImportMode(*mode), *dryRun)
+		if err != nil {
+			return err
+		}
+
+		slog.Info("Registry imported", "mode", report.Mode, "dry_run", report.DryRun, "created", len(report.Created),
+			"updated", len(report.Updated), "unchanged", len(report.Unchanged), "deleted", len(report.Deleted))
+		return nil
+
+	default:
+		return fmt.Errorf("unknown registry command %q", args[0])
+	}
+}
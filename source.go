@@ -0,0 +1,255 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"runtime/debug"
+	"strconv"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+)
+
+var sourceMessagesSkipped = NewCounterVec(
+	"orchestrator_source_messages_skipped_total",
+	"Messages of ordered sources acknowledged without being processed after the last attempt or a non-retryable error.",
+	"source",
+)
+
+// InboundMessage is a message from any source (SQS, Kafka, ...) in the shape
+// the integrity and routing pipeline works with
+type InboundMessage struct {
+	System  string // messaging.system of the source, e.g. aws_sqs
+	ID      string
+	Body    []byte // nil when the message has no body
+	Attempt string // delivery attempt, when the source tracks it
+	// DedupID identifies the message across redeliveries in exactly-once mode
+	DedupID string
+	// Headers carry the correlation ID and the trace context; may be nil
+	Headers    propagation.TextMapCarrier
+	XRayHeader string
+	// Ack removes the message from the source once it needs no more work
+	Ack func(ctx context.Context)
+	// Defer hands the message back to the source to be delivered again after
+	// delay, without counting a delivery attempt; nil when the source cannot
+	Defer func(ctx context.Context, delay time.Duration)
+}
+
+// process runs a message through the pipeline and acknowledges it when it
+// was processed, skipped as a duplicate or cannot be parsed. It reports
+// whether the message was acknowledged, or deferred with Defer; otherwise
+// the source must deliver it again. A panic is recovered and counted as a
+// failure, so it never stops the poll loop of the source.
+func (c *SQSConsumer) process(ctx context.Context, message InboundMessage) bool {
+	acked, _ := c.run(ctx, message)
+	return acked
+}
+
+// run is process, also returning the error of a failed message
+func (c *SQSConsumer) run(ctx context.Context, message InboundMessage) (acked bool, err error) {
+	if c.inFlight.Add(1) == 1 {
+		c.protection.Busy()
+	}
+	defer c.inFlight.Add(-1)
+	c.active.Store(message.ID, &InFlightMessage{ID: message.ID, System: message.System, Attempt: message.Attempt, StartedAt: time.Now()})
+	defer c.active.Delete(message.ID)
+
+	ctx, span := startMessageSpan(ctx, message)
+	defer span.End()
+
+	logger := slog.Default().With(
+		"message_id", message.ID,
+		"attempt", message.Attempt,
+	)
+	ctx = withStageTimings(withLogger(withMessageID(ctx, message.ID), logger), &stageTimings{})
+	started := time.Now()
+
+	// acked stays set when the panic comes after the acknowledgement
+	ack := message.Ack
+	message.Ack = func(ctx context.Context) {
+		acked = true
+		ack(ctx)
+	}
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("%w: %v", errPanic, r)
+			handlerPanics.Inc()
+			pipelineErrors.Inc(FailurePanic)
+			logger.Error("Panic processing message", "panic", r, "stack", string(debug.Stack()))
+			span.RecordError(err)
+			span.SetStatus(codes.Error, err.Error())
+			if !acked {
+				c.failures.Record(ctx, message, err)
+			}
+		}
+	}()
+
+	logger.Info("Processing message")
+	c.emit(ctx, EventMessageReceived, LifecycleEvent{
+		ReceiveCount: message.Attempt,
+	})
+
+	if message.Body == nil {
+		logger.Warn("Message body is nil")
+		message.Ack(ctx)
+		return true, nil
+	}
+
+	// Parse your actual message, decoding it when it is protobuf and
+	// unwrapping it when it is a CloudEvent
+	body, protobufType, err := c.protobuf.Decode(message.Body, message.Headers)
+	var appMessage any
+	var event *CloudEvent
+	if err == nil {
+		appMessage, event, err = c.cloudEvents.Decode(body, message.Headers)
+	}
+	observeStage(ctx, stageParse, started)
+	if err != nil {
+		logger.Error("Error parsing app message", errAttr(err))
+		c.emit(ctx, EventProcessingFailed, LifecycleEvent{
+			DurationMs: time.Since(started).Milliseconds(),
+			Error:      err.Error(),
+		})
+		c.archiveMessage(ctx, message, archiveUnparseable, nil, started, err)
+		message.Ack(ctx)
+		return true, nil
+	}
+
+	if protobufType != nil {
+		ctx = withProtobufType(ctx, protobufType)
+		logger = logger.With("protobuf_type", protobufType.FullName())
+	}
+	if event != nil {
+		span.SetAttributes(
+			attribute.String("cloudevents.event_id", event.ID),
+			attribute.String("cloudevents.event_source", event.Source),
+			attribute.String("cloudevents.event_type", event.Type),
+		)
+		logger = logger.With("event_type", event.Type, "event_source", event.Source)
+	}
+
+	correlationID := messageCorrelationID(message, appMessage)
+	span.SetAttributes(attribute.String("correlation.id", correlationID))
+	logger = logger.With("correlation_id", correlationID)
+	ctx = withLogger(withCorrelationID(ctx, correlationID), logger)
+
+	// Dedup, rate limiting, logging and metrics are middlewares around the
+	// business logic, see middleware.go
+	ctx = withTenant(ctx, c.tenants.Tenant(nil, message.Headers))
+	response, err := c.handler.Handle(withDedupID(ctx, message.DedupID), appMessage)
+	var skipped *skipError
+	if errors.As(err, &skipped) {
+		if skipped.ack {
+			message.Ack(ctx)
+		}
+		if !skipped.ack && skipped.retryAfter > 0 {
+			if message.Defer == nil {
+				return false, skipped
+			}
+			message.Defer(ctx, skipped.retryAfter)
+			return true, nil
+		}
+		return skipped.ack, nil
+	}
+	// Invalid payloads go to the quarantine queue instead of being retried
+	if c.quarantine.Accepts(err) {
+		qerr := c.quarantine.Send(ctx, message, err)
+		if qerr == nil {
+			logger.Warn("Message quarantined", errAttr(err))
+			message.Ack(ctx)
+			c.archiveMessage(ctx, message, archiveQuarantined, nil, started, err)
+			return true, nil
+		}
+		logger.Error("Error quarantining message", errAttr(qerr))
+	}
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		c.emit(ctx, EventProcessingFailed, LifecycleEvent{
+			DurationMs: time.Since(started).Milliseconds(),
+			Error:      err.Error(),
+		})
+		c.archiveMessage(ctx, message, archiveFailed, response, started, err)
+		c.failures.Record(ctx, message, err)
+		// Don't acknowledge on business logic error - let it retry
+		return false, err
+	}
+
+	// Acknowledge after successful processing
+	message.Ack(ctx)
+	c.emit(ctx, EventMessageProcessed, LifecycleEvent{
+		LambdaARN:  response.Lambda.ARN,
+		LambdaName: response.Lambda.Name,
+		DurationMs: time.Since(started).Milliseconds(),
+	})
+	c.archiveMessage(ctx, message, archiveProcessed, response, started, nil)
+	return true, nil
+}
+
+// archiveMessage records the message and its outcome in the S3 archive
+func (c *SQSConsumer) archiveMessage(ctx context.Context, message InboundMessage, outcome string, response *workerResponse, started time.Time, err error) {
+	if c.archive == nil {
+		return
+	}
+
+	record := ArchiveRecord{
+		Source:     message.System,
+		Attempt:    message.Attempt,
+		Outcome:    outcome,
+		DurationMs: time.Since(started).Milliseconds(),
+	}
+	record.Body, record.BodyEncoding = archiveBody(message.Body)
+	if message.Headers != nil {
+		record.Attributes = make(map[string]string)
+		for _, key := range message.Headers.Keys() {
+			record.Attributes[key] = message.Headers.Get(key)
+		}
+	}
+	if response != nil {
+		record.LambdaARN = response.Lambda.ARN
+	}
+	if err != nil {
+		record.Error = err.Error()
+	}
+	c.archive.Archive(ctx, record)
+}
+
+// processInOrder processes a message of an ordered source (Kafka, Kinesis),
+// retrying it in place so later messages of its partition wait. After
+// maxAttempts, or an error that is not retryable, the message is acknowledged
+// anyway so the partition moves on.
+// It reports false when ctx was done first.
+func (c *SQSConsumer) processInOrder(ctx context.Context, message InboundMessage, maxAttempts int, backoff time.Duration) bool {
+	ctx = withOrdered(ctx)
+	for attempt := 1; ; attempt++ {
+		message.Attempt = strconv.Itoa(attempt)
+		acked, err := c.run(ctx, message)
+		if acked {
+			return true
+		}
+		// A deferred message waits in place without using an attempt
+		var skipped *skipError
+		if errors.As(err, &skipped) {
+			attempt--
+			if sleepContext(ctx, skipped.retryAfter) != nil {
+				return false
+			}
+			continue
+		}
+
+		if attempt >= maxAttempts || (err != nil && !isRetryable(err)) {
+			slog.Error("Message failed, skipping it", "source", message.System, "message_id", message.ID, "attempts", attempt, "error_class", errorClass(err))
+			sourceMessagesSkipped.Inc(message.System)
+			message.Ack(ctx)
+			return true
+		}
+		if sleepContext(ctx, backoff) != nil {
+			return false
+		}
+		backoff = min(2*backoff, time.Minute)
+	}
+}
@@ -0,0 +1,68 @@
+package main
+
+import (
+	"context"
+	"log/slog"
+	"time"
+)
+
+var messageStageDuration = NewHistogramVec(
+	"orchestrator_message_stage_duration_seconds",
+	"Time spent in each processing stage of a message.",
+	DefaultLatencyBuckets,
+	"stage",
+)
+
+// Processing stages, in pipeline order
+const (
+	stageParse     = "parse"
+	stageSchema    = "schema"
+	stageIntegrity = "integrity"
+	stageRegistry  = "registry_fetch"
+	stageSelection = "selection"
+	stageInvoke    = "invoke"
+	stageOutput    = "output"
+	stageDelete    = "delete"
+)
+
+// stageTimings collects the per-stage durations of one message. A message is
+// handled by a single goroutine, so no locking is needed.
+type stageTimings struct {
+	stages    []string
+	durations []time.Duration
+}
+
+type stageTimingsKey struct{}
+
+func withStageTimings(ctx context.Context, timings *stageTimings) context.Context {
+	return context.WithValue(ctx, stageTimingsKey{}, timings)
+}
+
+// stageTimingsFrom returns the timings of the message in ctx, or empty ones
+func stageTimingsFrom(ctx context.Context) *stageTimings {
+	if timings, ok := ctx.Value(stageTimingsKey{}).(*stageTimings); ok {
+		return timings
+	}
+	return &stageTimings{}
+}
+
+// observeStage records the time elapsed since started for the message in ctx
+// and in the aggregate histogram
+func observeStage(ctx context.Context, stage string, started time.Time) {
+	duration := time.Since(started)
+	messageStageDuration.Observe(duration.Seconds(), stage)
+
+	if timings, ok := ctx.Value(stageTimingsKey{}).(*stageTimings); ok {
+		timings.stages = append(timings.stages, stage)
+		timings.durations = append(timings.durations, duration)
+	}
+}
+
+// logAttr renders the breakdown as a stages_ms group
+func (t *stageTimings) logAttr() slog.Attr {
+	attrs := make([]any, 0, len(t.stages))
+	for i, stage := range t.stages {
+		attrs = append(attrs, slog.Int64(stage, t.durations[i].Milliseconds()))
+	}
+	return slog.Group("stages_ms", attrs...)
+}
@@ -0,0 +1,126 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"os"
+	"os/signal"
+	"runtime"
+	"runtime/pprof"
+	"syscall"
+	"time"
+
+	"challenge-4-orchestrator/config"
+)
+
+// stateDumpRegistryTimeout bounds the registry read of a dump, so a dump of
+// a stuck instance does not hang on the same dependency
+const stateDumpRegistryTimeout = 2 * time.Second
+
+// StateDump is the internal state of the instance at a point in time
+type StateDump struct {
+	DumpedAt time.Time `json:"dumpedAt"`
+	// Status is what /status serves: counters, routing, breakers and jobs
+	Status        StatusReport      `json:"status"`
+	Paused        *PauseState       `json:"paused,omitempty"`
+	InFlight      []InFlightMessage `json:"inFlight"`
+	Registry      []Lambda          `json:"registry"`
+	RegistryError string            `json:"registryError,omitempty"`
+	RulesVersion  string            `json:"routingRulesVersion,omitempty"`
+	Goroutines    int               `json:"goroutines"`
+	// GoroutineStacks groups the goroutines by stack, with their count
+	GoroutineStacks string           `json:"goroutineStacks"`
+	Config          []config.Setting `json:"config"` // sensitive settings masked
+}
+
+// StateDumperOptions wires the subsystems a dump reads
+type StateDumperOptions struct {
+	Status   *StatusHandler
+	Consumer *SQSConsumer
+	Registry *LambdaRegistry
+	Rules    *RoutingRules // nil unless a routing rules table is configured
+	Config   func() *config.Config
+	// Dir receives a JSON file per dump; empty writes the dump to the log
+	Dir string
+}
+
+// StateDumper writes the internal state on SIGUSR1, to diagnose a stuck
+// instance without restarting it
+type StateDumper struct {
+	opts StateDumperOptions
+}
+
+func NewStateDumper(opts StateDumperOptions) *StateDumper {
+	return &StateDumper{opts: opts}
+}
+
+// Start dumps the state on every SIGUSR1 until the context is done
+func (d *StateDumper) Start(ctx context.Context) {
+	usr1 := make(chan os.Signal, 1)
+	signal.Notify(usr1, syscall.SIGUSR1)
+	defer signal.Stop(usr1)
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-usr1:
+			if err := d.Dump(ctx); err != nil {
+				slog.Error("State dump failed", errAttr(err))
+			}
+		}
+	}
+}
+
+// Snapshot collects the state
+func (d *StateDumper) Snapshot(ctx context.Context) StateDump {
+	dump := StateDump{
+		DumpedAt:     time.Now().UTC(),
+		Status:       d.opts.Status.Report(),
+		Paused:       d.opts.Consumer.Paused(),
+		InFlight:     d.opts.Consumer.InFlightMessages(),
+		RulesVersion: d.opts.Rules.Version(),
+		Goroutines:   runtime.NumGoroutine(),
+		Config:       d.opts.Config().Settings(),
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, stateDumpRegistryTimeout)
+	defer cancel()
+	lambdas, err := d.opts.Registry.List(ctx)
+	if err != nil {
+		dump.RegistryError = err.Error()
+	}
+	dump.Registry = lambdas
+
+	var stacks bytes.Buffer
+	if err := pprof.Lookup("goroutine").WriteTo(&stacks, 1); err == nil {
+		dump.GoroutineStacks = stacks.String()
+	}
+	return dump
+}
+
+// Dump writes a snapshot to a new file in Dir, or to the log
+func (d *StateDumper) Dump(ctx context.Context) error {
+	dump := d.Snapshot(ctx)
+	if d.opts.Dir == "" {
+		slog.Warn("State dump", "state", dump)
+		return nil
+	}
+
+	file, err := os.CreateTemp(d.opts.Dir, "orchestrator-state-*.json")
+	if err != nil {
+		return fmt.Errorf("error creating state dump file: %w", err)
+	}
+	defer file.Close()
+
+	encoder := json.NewEncoder(file)
+	encoder.SetIndent("", "  ")
+	if err := encoder.Encode(dump); err != nil {
+		return fmt.Errorf("error writing state dump %s: %w", file.Name(), err)
+	}
+	slog.Warn("State dumped", "path", file.Name(), "in_flight", len(dump.InFlight), "goroutines", dump.Goroutines)
+	return nil
+}
@@ -0,0 +1,180 @@
+package main
+
+import (
+	"net/http"
+	"sync"
+	"time"
+)
+
+// LambdaRoutingStats counts the invocations routed to one worker Lambda
+type LambdaRoutingStats struct {
+	Invocations  int64      `json:"invocations"`
+	Failures     int64      `json:"failures"`
+	LastInvoked  *time.Time `json:"lastInvoked,omitempty"`
+	LastError    string     `json:"lastError,omitempty"`
+	LastDuration int64      `json:"lastDurationMs"`
+	// Percentiles of the latest invocations, at most latencyWindowSize
+	Samples int     `json:"samples"`
+	P50Ms   float64 `json:"p50Ms"`
+	P95Ms   float64 `json:"p95Ms"`
+	P99Ms   float64 `json:"p99Ms"`
+	// Eviction is evicted or probation while the error rate keeps the
+	// worker out of routing
+	Eviction string `json:"eviction,omitempty"`
+	// Recent behaviour behind the adaptive weights
+	LatencyEWMAMs float64 `json:"latencyEwmaMs"`
+	ErrorEWMA     float64 `json:"errorEwma"`
+}
+
+// routingStats tracks per-ARN routing outcomes for /status
+type routingStats struct {
+	mu      sync.Mutex
+	stats   map[string]*LambdaRoutingStats
+	windows map[string]*latencyWindow
+}
+
+func (r *routingStats) record(arn string, duration time.Duration, err error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.stats == nil {
+		r.stats = make(map[string]*LambdaRoutingStats)
+		r.windows = make(map[string]*latencyWindow)
+	}
+	stats, ok := r.stats[arn]
+	if !ok {
+		stats = &LambdaRoutingStats{}
+		r.stats[arn] = stats
+		r.windows[arn] = &latencyWindow{}
+	}
+
+	now := time.Now()
+	stats.Invocations++
+	stats.LastInvoked = &now
+	stats.LastDuration = duration.Milliseconds()
+
+	window := r.windows[arn]
+	window.add(duration)
+	p50, p95, p99 := window.percentiles()
+	stats.Samples = len(window.samples)
+	stats.P50Ms, stats.P95Ms, stats.P99Ms = milliseconds(p50), milliseconds(p95), milliseconds(p99)
+	observeLatency(arn, duration, p50, p95, p99)
+	if err != nil {
+		stats.Failures++
+		stats.LastError = err.Error()
+	}
+	updateEWMA(stats, milliseconds(duration), err != nil)
+}
+
+// p95 returns the p95 of arn in milliseconds, and its samples
+func (r *routingStats) p95(arn string) (float64, int) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	stats, ok := r.stats[arn]
+	if !ok {
+		return 0, 0
+	}
+	return stats.P95Ms, stats.Samples
+}
+
+func (r *routingStats) snapshot() map[string]LambdaRoutingStats {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	snapshot := make(map[string]LambdaRoutingStats, len(r.stats))
+	for arn, stats := range r.stats {
+		snapshot[arn] = *stats
+	}
+	return snapshot
+}
+
+type StatusReport struct {
+	InstanceID   string                        `json:"instanceId"`
+	Version      string                        `json:"version"`
+	StartedAt    time.Time                     `json:"startedAt"`
+	Uptime       string                        `json:"uptime"`
+	InFlight     int64                         `json:"inFlight"`
+	LastPoll     *time.Time                    `json:"lastPoll,omitempty"`
+	LastActivity *time.Time                    `json:"lastActivity,omitempty"`
+	Routing      map[string]LambdaRoutingStats `json:"routing"`
+	Queue        *QueueStats                   `json:"queue,omitempty"`
+	Queues       []QueueStats                  `json:"queues,omitempty"` // with several queues
+	Jobs         []JobStatus                   `json:"jobs,omitempty"`
+	Costs        *CostReport                   `json:"costs,omitempty"`
+	// Breakers are the failover breakers of the Lambda and registry clients;
+	// the eviction of each worker is in its routing stats
+	Breakers []FailoverState    `json:"breakers"`
+	Registry RegistryReadStatus `json:"registry"`
+}
+
+// StatusOptions wires the subsystems /status reports on
+type StatusOptions struct {
+	Consumer   *SQSConsumer
+	Queue      *QueueMonitor // nil when queue monitoring is disabled
+	Scheduler  *Scheduler
+	Lambda     *LambdaClient
+	Registry   *LambdaRegistry
+	DB         *DynamoDBClient // the registry table
+	InstanceID string
+	// Auth guards /status; nil leaves it unregistered
+	Auth Authenticator
+}
+
+// StatusHandler serves /status with the live state of the consumer, to
+// the operations auth group
+type StatusHandler struct {
+	opts      StatusOptions
+	startedAt time.Time
+}
+
+func NewStatusHandler(opts StatusOptions) *StatusHandler {
+	return &StatusHandler{
+		opts:      opts,
+		startedAt: time.Now(),
+	}
+}
+
+func (s *StatusHandler) Register(mux *http.ServeMux) {
+	if s.opts.Auth == nil {
+		return
+	}
+	mux.Handle("GET /status", requireAuth(s.opts.Auth, http.HandlerFunc(s.statusHandler)))
+}
+
+func (s *StatusHandler) statusHandler(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, s.Report())
+}
+
+func (s *StatusHandler) Report() StatusReport {
+	consumer := s.opts.Consumer
+	report := StatusReport{
+		InstanceID: s.opts.InstanceID,
+		Version:    Version,
+		StartedAt:  s.startedAt,
+		Uptime:     time.Since(s.startedAt).Round(time.Second).String(),
+		InFlight:   consumer.InFlight(),
+		Routing:    consumer.RoutingStats(),
+		Jobs:       s.opts.Scheduler.Status(),
+		Costs:      consumer.costs.Report(),
+		Breakers:   s.opts.Lambda.FailoverStates(),
+		Registry:   s.opts.Registry.ReadStatus(),
+	}
+	if state := s.opts.DB.FailoverState(); state != nil {
+		report.Breakers = append(report.Breakers, *state)
+	}
+	if last := consumer.LastPoll(); !last.IsZero() {
+		report.LastPoll = &last
+	}
+	if last := consumer.LastActivity(); !last.IsZero() {
+		report.LastActivity = &last
+	}
+	if s.opts.Queue != nil {
+		if stats := s.opts.Queue.Stats(); !stats.UpdatedAt.IsZero() {
+			report.Queue = &stats
+		}
+		if queues := s.opts.Queue.QueueStats(); len(queues) > 1 {
+			report.Queues = queues
+		}
+	}
+	return report
+}
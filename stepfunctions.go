@@ -0,0 +1,126 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/aws/arn"
+	"github.com/aws/aws-sdk-go-v2/service/sfn"
+	"github.com/aws/aws-sdk-go-v2/service/sfn/types"
+)
+
+// invalidExecutionChars are replaced in execution names, which allow
+// letters, digits, - and _ only
+var invalidExecutionChars = regexp.MustCompile(`[^A-Za-z0-9_-]`)
+
+// StartedExecution is the response for entries that do not wait for the
+// result
+type StartedExecution struct {
+	ExecutionARN string    `json:"executionArn"`
+	StartDate    time.Time `json:"startDate"`
+}
+
+// StepFunctionsClient hands messages off to the Step Functions state
+// machines registered as stepfunctions entries
+type StepFunctionsClient struct {
+	client       *sfn.Client
+	pollInterval time.Duration
+}
+
+func NewStepFunctionsClient(cfg aws.Config, pollInterval time.Duration) *StepFunctionsClient {
+	return &StepFunctionsClient{
+		client: sfn.NewFromConfig(cfg, func(o *sfn.Options) {
+			if endpoint := awsEndpoint("SFN"); endpoint != "" {
+				o.BaseEndpoint = aws.String(endpoint)
+			}
+		}),
+		pollInterval: pollInterval,
+	}
+}
+
+// StartExecution starts the state machine of target with the payload. The
+// execution is named after the message in ctx, so a redelivered message
+// finds its execution instead of starting another. With WaitForResult the
+// execution is polled until it ends and its output returned; standard
+// state machines only, as express executions cannot be described.
+func (s *StepFunctionsClient) StartExecution(ctx context.Context, target Lambda, payload any) ([]byte, error) {
+	input, err := json.Marshal(payload)
+	if err != nil {
+		return nil, fmt.Errorf("error marshaling payload: %w", err)
+	}
+
+	name := executionName(messageIDFrom(ctx))
+	var started StartedExecution
+	result, err := s.client.StartExecution(ctx, &sfn.StartExecutionInput{
+		StateMachineArn: aws.String(target.ARN),
+		Name:            name,
+		Input:           aws.String(string(input)),
+	})
+	var exists *types.ExecutionAlreadyExists
+	switch {
+	case errors.As(err, &exists) && name != nil:
+		started.ExecutionARN = executionARN(target.ARN, *name)
+		loggerFrom(ctx).Info("Step Functions execution already started for this message", "execution_arn", started.ExecutionARN)
+	case err != nil:
+		return nil, fmt.Errorf("error starting execution of %s: %w", target.ARN, err)
+	default:
+		started = StartedExecution{ExecutionARN: aws.ToString(result.ExecutionArn), StartDate: aws.ToTime(result.StartDate)}
+	}
+
+	if !target.WaitForResult {
+		return json.Marshal(started)
+	}
+	return s.waitForResult(ctx, started.ExecutionARN)
+}
+
+// waitForResult polls the execution until it ends or ctx is done
+func (s *StepFunctionsClient) waitForResult(ctx context.Context, executionARN string) ([]byte, error) {
+	for {
+		execution, err := s.client.DescribeExecution(ctx, &sfn.DescribeExecutionInput{
+			ExecutionArn: aws.String(executionARN),
+		})
+		if err != nil {
+			return nil, fmt.Errorf("error describing execution %s: %w", executionARN, err)
+		}
+
+		switch execution.Status {
+		case types.ExecutionStatusSucceeded:
+			return []byte(aws.ToString(execution.Output)), nil
+		case types.ExecutionStatusRunning, types.ExecutionStatusPendingRedrive:
+		default:
+			return nil, fmt.Errorf("execution %s %s: %s: %s", executionARN, strings.ToLower(string(execution.Status)),
+				aws.ToString(execution.Error), aws.ToString(execution.Cause))
+		}
+
+		if err := sleepContext(ctx, s.pollInterval); err != nil {
+			return nil, fmt.Errorf("execution %s still running: %w", executionARN, err)
+		}
+	}
+}
+
+// executionName derives a valid execution name from a message ID; nil lets
+// Step Functions generate one
+func executionName(messageID string) *string {
+	if messageID == "" {
+		return nil
+	}
+	name := invalidExecutionChars.ReplaceAllString(messageID, "-")
+	return aws.String(name[:min(len(name), 80)])
+}
+
+// executionARN builds arn:...:execution:<machine>:<name> from the state
+// machine ARN
+func executionARN(stateMachineARN, name string) string {
+	parsed, err := arn.Parse(stateMachineARN)
+	if err != nil {
+		return ""
+	}
+	parsed.Resource = strings.Replace(parsed.Resource, "stateMachine:", "execution:", 1) + ":" + name
+	return parsed.String()
+}
@@ -0,0 +1,170 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"os"
+	"time"
+)
+
+// taskProtectionIdle is how long the task stays protected after the last
+// message, so a steady stream does not toggle it on every message
+const taskProtectionIdle = 10 * time.Second
+
+var taskProtected = NewGaugeVec(
+	"orchestrator_ecs_task_protected",
+	"1 while the ECS task is protected from scale-in.",
+)
+
+// TaskProtection keeps the ECS service from stopping the task on scale-in
+// while it processes messages, through the task protection endpoint of the
+// ECS agent (Fargate platform 1.4 and the EC2 agent). Protection is set when
+// the first message starts, renewed before it expires and released once no
+// message has been in flight for taskProtectionIdle. A nil *TaskProtection
+// does nothing.
+type TaskProtection struct {
+	url      string // of the task protection state
+	expiry   time.Duration
+	inFlight func() int64
+	client   *http.Client
+	busy     chan struct{}
+
+	protectedUntil time.Time // zero while unprotected; only the loop touches it
+	idleSince      time.Time
+}
+
+// NewTaskProtection reads the agent endpoint from ECS_AGENT_URI
+func NewTaskProtection(expiry time.Duration) (*TaskProtection, error) {
+	agent := os.Getenv("ECS_AGENT_URI")
+	if agent == "" {
+		return nil, errors.New("ECS_AGENT_URI is not set, not running as an ECS task")
+	}
+	taskProtected.Set(0)
+	return &TaskProtection{
+		url:    agent + "/task-protection/v1/state",
+		expiry: expiry,
+		client: &http.Client{Timeout: 5 * time.Second},
+		busy:   make(chan struct{}, 1),
+	}, nil
+}
+
+// Busy reports that a message started while none was in flight
+func (p *TaskProtection) Busy() {
+	if p == nil {
+		return
+	}
+	select {
+	case p.busy <- struct{}{}:
+	default:
+	}
+}
+
+// Start keeps the protection in line with the messages in flight until ctx
+// is done, then releases it
+func (p *TaskProtection) Start(ctx context.Context, inFlight func() int64) {
+	p.inFlight = inFlight
+	ticker := time.NewTicker(time.Second)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			if !p.protectedUntil.IsZero() {
+				releaseCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+				p.update(releaseCtx, false)
+				cancel()
+			}
+			return
+		case <-p.busy:
+		case <-ticker.C:
+		}
+		p.reconcile(ctx)
+	}
+}
+
+func (p *TaskProtection) reconcile(ctx context.Context) {
+	now := time.Now()
+	if p.inFlight() > 0 {
+		p.idleSince = time.Time{}
+		// Renew at half the expiry, so a failed call can be retried in time
+		if p.protectedUntil.IsZero() || now.After(p.protectedUntil.Add(-p.expiry/2)) {
+			p.update(ctx, true)
+		}
+		return
+	}
+	if p.protectedUntil.IsZero() {
+		return
+	}
+	if p.idleSince.IsZero() {
+		p.idleSince = now
+	}
+	if now.Sub(p.idleSince) >= taskProtectionIdle {
+		p.update(ctx, false)
+	}
+}
+
+// update sets or releases the protection; errors are logged and retried on
+// the next tick
+func (p *TaskProtection) update(ctx context.Context, enabled bool) {
+	if err := p.put(ctx, enabled); err != nil {
+		slog.Error("Error updating ECS task protection", "enabled", enabled, errAttr(err))
+		return
+	}
+	if enabled {
+		if p.protectedUntil.IsZero() {
+			slog.Info("ECS task protected from scale-in", "expires_in", p.expiry)
+		}
+		p.protectedUntil = time.Now().Add(p.expiry)
+		taskProtected.Set(1)
+		return
+	}
+	p.protectedUntil, p.idleSince = time.Time{}, time.Time{}
+	taskProtected.Set(0)
+	slog.Info("ECS task protection released")
+}
+
+func (p *TaskProtection) put(ctx context.Context, enabled bool) error {
+	request := map[string]any{"ProtectionEnabled": enabled}
+	if enabled {
+		request["ExpiresInMinutes"] = int(p.expiry.Minutes())
+	}
+	body, err := json.Marshal(request)
+	if err != nil {
+		return fmt.Errorf("error marshaling task protection: %w", err)
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPut, p.url, bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("error building task protection request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("error calling the ECS agent: %w", err)
+	}
+	defer resp.Body.Close()
+
+	// The agent answers 200 with a failure or error object when the ECS API
+	// rejected the change
+	var result struct {
+		Failure *struct{ Reason, Detail string } `json:"failure"`
+		Error   *struct{ Code, Message string }  `json:"error"`
+	}
+	payload, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+	_ = json.Unmarshal(payload, &result)
+	switch {
+	case resp.StatusCode != http.StatusOK:
+		return fmt.Errorf("error from the ECS agent: %s: %s", resp.Status, bytes.TrimSpace(payload))
+	case result.Failure != nil:
+		return fmt.Errorf("task protection failed: %s %s", result.Failure.Reason, result.Failure.Detail)
+	case result.Error != nil:
+		return fmt.Errorf("task protection failed: %s: %s", result.Error.Code, result.Error.Message)
+	}
+	return nil
+}
@@ -0,0 +1,241 @@
+package main
+
+import (
+	"context"
+	"slices"
+	"strconv"
+	"sync"
+	"time"
+
+	"challenge-4-orchestrator/config"
+
+	"go.opentelemetry.io/otel/propagation"
+)
+
+// noTenant labels the metrics of messages without a tenant ID
+const noTenant = "none"
+
+// tenantRetryDelay is the shortest deferral of a message over its tenant
+// limits, and the deferral when the tenant has no free in-flight slot
+const tenantRetryDelay = time.Second
+
+var (
+	tenantMessages = NewCounterVec(
+		"orchestrator_tenant_messages_total",
+		"Messages processed per tenant, by outcome (processed, failed).",
+		"tenant", "outcome",
+	)
+	tenantThrottled = NewCounterVec(
+		"orchestrator_tenant_throttled_total",
+		"Messages of a tenant held back by its limits, by limit (in_flight, rate).",
+		"tenant", "limit",
+	)
+	tenantInFlight = NewGaugeVec(
+		"orchestrator_tenant_in_flight",
+		"Messages of a tenant being processed.",
+		"tenant",
+	)
+)
+
+// TenantIsolation keeps noisy tenants from starving the others. Each tenant
+// gets its own in-flight and rate limits; a message over them is deferred
+// instead of blocking the source, except on ordered sources, whose
+// partitions wait anyway. A nil *TenantIsolation does nothing.
+type TenantIsolation struct {
+	field     string
+	defaults  config.TenantLimits
+	overrides map[string]config.TenantLimits
+
+	mu      sync.Mutex
+	tenants map[string]*tenantState
+}
+
+type tenantState struct {
+	slots   chan struct{} // nil without an in-flight limit
+	limiter *tokenBucket  // nil without a rate limit
+}
+
+// NewTenantIsolation reads the tenant ID from the field of the payload, or
+// from the message attribute of the same name
+func NewTenantIsolation(field string, defaults config.TenantLimits, overrides map[string]config.TenantLimits) *TenantIsolation {
+	return &TenantIsolation{
+		field:     field,
+		defaults:  defaults,
+		overrides: overrides,
+		tenants:   make(map[string]*tenantState),
+	}
+}
+
+// Tenant returns the tenant of a message, or "" when it has none
+func (t *TenantIsolation) Tenant(msg any, headers propagation.TextMapCarrier) string {
+	if t == nil {
+		return ""
+	}
+	if headers != nil {
+		if tenant := headers.Get(t.field); tenant != "" {
+			return tenant
+		}
+	}
+	if fields, ok := msg.(map[string]any); ok {
+		switch tenant := fields[t.field].(type) {
+		case string:
+			return tenant
+		case float64:
+			return strconv.FormatFloat(tenant, 'f', -1, 64)
+		}
+	}
+	return ""
+}
+
+func (t *TenantIsolation) state(tenant string) *tenantState {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	state, ok := t.tenants[tenant]
+	if !ok {
+		limits, ok := t.overrides[tenant]
+		if !ok {
+			limits = t.defaults
+		}
+		state = &tenantState{}
+		if limits.MaxInFlight > 0 {
+			state.slots = make(chan struct{}, limits.MaxInFlight)
+		}
+		if limits.MaxRate > 0 {
+			state.limiter = newTokenBucket(limits.MaxRate, max(1, int(limits.MaxRate)))
+		}
+		t.tenants[tenant] = state
+	}
+	return state
+}
+
+// acquire takes an in-flight slot and a rate token of the tenant. It waits
+// for them when wait is set, and otherwise returns the exceeded limit and
+// how long to defer the message. The returned release frees the slot.
+func (t *TenantIsolation) acquire(ctx context.Context, tenant string, wait bool) (release func(), exceeded string, retryAfter time.Duration) {
+	state := t.state(tenant)
+
+	if state.slots != nil {
+		if wait {
+			select {
+			case state.slots <- struct{}{}:
+			case <-ctx.Done():
+				return nil, "in_flight", tenantRetryDelay
+			}
+		} else {
+			select {
+			case state.slots <- struct{}{}:
+			default:
+				return nil, "in_flight", tenantRetryDelay
+			}
+		}
+	}
+	release = func() {
+		if state.slots != nil {
+			<-state.slots
+		}
+	}
+
+	if state.limiter != nil {
+		allowed := state.limiter.Allow()
+		if !allowed && wait {
+			allowed = state.limiter.Wait(ctx) == nil
+		}
+		if !allowed {
+			release()
+			return nil, "rate", max(state.limiter.Delay(), tenantRetryDelay)
+		}
+	}
+	return release, "", 0
+}
+
+type tenantKey struct{}
+
+func withTenant(ctx context.Context, tenant string) context.Context {
+	return context.WithValue(ctx, tenantKey{}, tenant)
+}
+
+// tenantFrom returns the tenant of the message being processed
+func tenantFrom(ctx context.Context) string {
+	tenant, _ := ctx.Value(tenantKey{}).(string)
+	return tenant
+}
+
+type orderedKey struct{}
+
+// withOrdered marks a message of an ordered source, whose partition waits
+// for it
+func withOrdered(ctx context.Context) context.Context {
+	return context.WithValue(ctx, orderedKey{}, true)
+}
+
+func isOrdered(ctx context.Context) bool {
+	ordered, _ := ctx.Value(orderedKey{}).(bool)
+	return ordered
+}
+
+// tenantMiddleware applies the limits of the message tenant and counts its
+// messages. A nil isolation does nothing.
+func tenantMiddleware(isolation *TenantIsolation) Middleware {
+	if isolation == nil {
+		return func(next Handler) Handler { return next }
+	}
+	return func(next Handler) Handler {
+		return HandlerFunc(func(ctx context.Context, msg any) (*workerResponse, error) {
+			tenant := tenantFrom(ctx)
+			if tenant == "" {
+				tenant = isolation.Tenant(msg, nil)
+			}
+			label := tenant
+			if label == "" {
+				label = noTenant
+			}
+			logger := loggerFrom(ctx).With("tenant", label)
+			ctx = withLogger(withTenant(ctx, tenant), logger)
+
+			// Messages without a tenant are not limited
+			if tenant != "" {
+				release, exceeded, retryAfter := isolation.acquire(ctx, tenant, isOrdered(ctx))
+				if exceeded != "" {
+					// Deferred rather than left to the visibility timeout, so
+					// the tenant's messages do not use up their receives
+					tenantThrottled.Inc(label, exceeded)
+					logger.Debug("Tenant limit reached, deferring the message", "limit", exceeded, "retry_after", retryAfter)
+					return nil, &skipError{reason: "tenant " + exceeded + " limit reached", retryAfter: retryAfter}
+				}
+				defer release()
+			}
+			tenantInFlight.Add(1, label)
+			defer tenantInFlight.Add(-1, label)
+
+			response, err := next.Handle(ctx, msg)
+			outcome := "processed"
+			if err != nil {
+				outcome = "failed"
+			}
+			if !isSkipped(err) {
+				tenantMessages.Inc(label, outcome)
+			}
+			return response, err
+		})
+	}
+}
+
+// tenantPool narrows the candidates to the entries pinned to the tenant.
+// Entries without tenants form the shared pool, which serves the other
+// tenants and the pinned ones whose entries are all unhealthy.
+func tenantPool(lambdas []Lambda, tenant string) []Lambda {
+	var pinned, shared []Lambda
+	for _, lambda := range lambdas {
+		switch {
+		case len(lambda.Tenants) == 0:
+			shared = append(shared, lambda)
+		case tenant != "" && slices.Contains(lambda.Tenants, tenant):
+			pinned = append(pinned, lambda)
+		}
+	}
+	if len(pinned) > 0 {
+		return pinned
+	}
+	return shared
+}
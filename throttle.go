@@ -0,0 +1,117 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"sync"
+	"time"
+
+	awsmiddleware "github.com/aws/aws-sdk-go-v2/aws/middleware"
+	"github.com/aws/smithy-go"
+	"github.com/aws/smithy-go/middleware"
+)
+
+const (
+	throttleBackoff = 50 * time.Millisecond
+	maxPacingDelay  = time.Second
+)
+
+var dynamoThrottles = NewCounterVec(
+	"orchestrator_dynamodb_throttles_total",
+	"DynamoDB requests rejected with a throttling error, by operation.",
+	"operation",
+)
+
+// Códigos que DynamoDB devuelve cuando se supera la capacidad o la cuota
+var throttleErrorCodes = map[string]bool{
+	"ProvisionedThroughputExceededException": true,
+	"ThrottlingException":                    true,
+	"RequestLimitExceeded":                   true,
+}
+
+func isThrottleError(err error) bool {
+	var apiErr smithy.APIError
+	return errors.As(err, &apiErr) && throttleErrorCodes[apiErr.ErrorCode()]
+}
+
+// throttlePacer reparte una pausa adaptativa entre todas las operaciones del
+// cliente: crece con cada throttle y se reduce a la mitad con cada éxito
+type throttlePacer struct {
+	mu    sync.Mutex
+	delay time.Duration
+}
+
+func (p *throttlePacer) wait(ctx context.Context) error {
+	p.mu.Lock()
+	delay := p.delay
+	p.mu.Unlock()
+
+	if delay == 0 {
+		return nil
+	}
+	return sleepContext(ctx, delay)
+}
+
+func (p *throttlePacer) onThrottle() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.delay = min(max(p.delay*2, throttleBackoff), maxPacingDelay)
+}
+
+func (p *throttlePacer) onSuccess() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.delay /= 2
+	if p.delay < throttleBackoff/4 {
+		p.delay = 0
+	}
+}
+
+// withThrottlePacing ejecuta call tras la pausa del pacer. Los throttles los
+// reintenta el retryer del SDK, con los intentos de aws.maxAttempts; aquí no
+// se reintenta para no multiplicarlos.
+func (d *DynamoDBClient) withThrottlePacing(ctx context.Context, call func() error) error {
+	if err := d.pacer.wait(ctx); err != nil {
+		return err
+	}
+
+	primary := !d.failover.useSecondary()
+	err := call()
+	if primary {
+		d.failover.record(err)
+	}
+	if err == nil {
+		d.pacer.onSuccess()
+	}
+	return err
+}
+
+// observeAttempts añade a la pila del cliente un middleware posterior al
+// retryer del SDK, que ve cada intento: cuenta los throttles por operación
+// y alarga la pausa del pacer
+func (p *throttlePacer) observeAttempts(stack *middleware.Stack) error {
+	return stack.Finalize.Insert(middleware.FinalizeMiddlewareFunc("ThrottlePacer",
+		func(ctx context.Context, in middleware.FinalizeInput, next middleware.FinalizeHandler) (middleware.FinalizeOutput, middleware.Metadata, error) {
+			out, metadata, err := next.HandleFinalize(ctx, in)
+			if isThrottleError(err) {
+				operation := awsmiddleware.GetOperationName(ctx)
+				dynamoThrottles.Inc(operation)
+				p.onThrottle()
+				slog.Warn("DynamoDB request throttled", "operation", operation)
+			}
+			return out, metadata, err
+		}), "Retry", middleware.After)
+}
+
+func sleepContext(ctx context.Context, delay time.Duration) error {
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
@@ -0,0 +1,172 @@
+package main
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"log/slog"
+	"os"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/sqs/types"
+	"github.com/aws/smithy-go/middleware"
+	smithyhttp "github.com/aws/smithy-go/transport/http"
+	"go.opentelemetry.io/contrib/propagators/aws/xray"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const (
+	serviceName     = "challenge-4-orchestrator"
+	xrayTraceHeader = "X-Amzn-Trace-Id"
+)
+
+// tracer delegates to the global provider, so spans are no-ops until
+// initTracing installs an exporter
+var tracer = otel.Tracer(serviceName)
+
+func tracingExportEnabled() bool {
+	return os.Getenv("OTEL_EXPORTER_OTLP_ENDPOINT") != "" || os.Getenv("OTEL_EXPORTER_OTLP_TRACES_ENDPOINT") != ""
+}
+
+// initTracing exports spans over OTLP/HTTP when an OTLP endpoint is configured
+// (OTEL_EXPORTER_OTLP_ENDPOINT or OTEL_EXPORTER_OTLP_TRACES_ENDPOINT). The
+// W3C and X-Ray propagators are always installed so incoming trace context is
+// forwarded even when this process does not export spans. Trace IDs are
+// generated in the X-Ray format so an ADOT collector can ship them to X-Ray.
+func initTracing(ctx context.Context) (func(context.Context) error, error) {
+	otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator(
+		propagation.TraceContext{},
+		propagation.Baggage{},
+		xray.Propagator{},
+	))
+
+	if !tracingExportEnabled() {
+		return func(context.Context) error { return nil }, nil
+	}
+
+	exporter, err := otlptracehttp.New(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	provider := sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exporter),
+		sdktrace.WithIDGenerator(xray.NewIDGenerator()),
+		sdktrace.WithResource(resource.NewSchemaless(
+			attribute.String("service.name", serviceName),
+			attribute.String("service.version", Version),
+		)),
+	)
+	otel.SetTracerProvider(provider)
+
+	slog.Info("OpenTelemetry tracing enabled")
+	return provider.Shutdown, nil
+}
+
+// endSpan records err on the span (if any) and ends it
+func endSpan(span trace.Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
+
+// startMessageSpan continues the producer's trace, carried either in the
+// message headers or in the X-Ray trace header (the AWSTraceHeader system
+// attribute that SQS sets for X-Ray instrumented producers), and starts the
+// per-message consumer span
+func startMessageSpan(ctx context.Context, message InboundMessage) (context.Context, trace.Span) {
+	if message.Headers != nil {
+		ctx = otel.GetTextMapPropagator().Extract(ctx, message.Headers)
+	}
+
+	if !trace.SpanContextFromContext(ctx).IsValid() && message.XRayHeader != "" {
+		ctx = xray.Propagator{}.Extract(ctx, propagation.MapCarrier{xrayTraceHeader: message.XRayHeader})
+	}
+
+	return tracer.Start(ctx, "process message",
+		trace.WithSpanKind(trace.SpanKindConsumer),
+		trace.WithAttributes(
+			attribute.String("messaging.system", message.System),
+			attribute.String("messaging.message.id", message.ID),
+		),
+	)
+}
+
+// sqsAttributeCarrier adapts SQS string message attributes to the propagator
+type sqsAttributeCarrier map[string]types.MessageAttributeValue
+
+func (c sqsAttributeCarrier) Get(key string) string {
+	if value, ok := c[key]; ok {
+		return aws.ToString(value.StringValue)
+	}
+	return ""
+}
+
+func (c sqsAttributeCarrier) Set(key, value string) {
+	c[key] = types.MessageAttributeValue{
+		DataType:    aws.String("String"),
+		StringValue: aws.String(value),
+	}
+}
+
+func (c sqsAttributeCarrier) Keys() []string {
+	keys := make([]string, 0, len(c))
+	for key := range c {
+		keys = append(keys, key)
+	}
+	return keys
+}
+
+// maxClientContext is the largest base64 ClientContext Lambda accepts
+const maxClientContext = 3583
+
+// traceClientContext encodes the current trace context and correlation ID as
+// the Lambda ClientContext ({"custom": {"traceparent": ..., "correlationId":
+// ...}}), readable by the worker through context.client_context.custom.
+// Lambda rejects a larger ClientContext, so the optional baggage and
+// tracestate are dropped, in that order, until it fits.
+func traceClientContext(ctx context.Context) *string {
+	carrier := propagation.MapCarrier{}
+	otel.GetTextMapPropagator().Inject(ctx, carrier)
+	if id := correlationIDFrom(ctx); id != "" {
+		carrier[correlationIDField] = id
+	}
+
+	for _, optional := range []string{"", "baggage", "tracestate"} {
+		delete(carrier, optional)
+		if len(carrier) == 0 {
+			return nil
+		}
+		data, err := json.Marshal(map[string]any{"custom": carrier})
+		if err != nil {
+			return nil
+		}
+		if encoded := base64.StdEncoding.EncodeToString(data); len(encoded) <= maxClientContext {
+			return aws.String(encoded)
+		}
+	}
+	slog.Warn("Trace context too large for the Lambda ClientContext, not propagated", "correlation_id", carrier[correlationIDField])
+	return nil
+}
+
+// addXRayTraceHeader is an AWS SDK API option that sets X-Amzn-Trace-Id on
+// outgoing requests, so Lambda continues the X-Ray trace of the current span
+func addXRayTraceHeader(stack *middleware.Stack) error {
+	return stack.Build.Add(middleware.BuildMiddlewareFunc("XRayTraceHeader",
+		func(ctx context.Context, in middleware.BuildInput, next middleware.BuildHandler) (middleware.BuildOutput, middleware.Metadata, error) {
+			if req, ok := in.Request.(*smithyhttp.Request); ok {
+				xray.Propagator{}.Inject(ctx, propagation.HeaderCarrier(req.Header))
+			}
+			return next.HandleBuild(ctx, in)
+		},
+	), middleware.After)
+}
@@ -0,0 +1,176 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/expression"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+)
+
+// DynamoDB acepta como máximo 100 operaciones por transacción
+const maxTransactItems = 100
+
+// TransactWriteBuilder acumula operaciones para una escritura transaccional
+// que puede abarcar varios ítems y tablas
+type TransactWriteBuilder struct {
+	items []types.TransactWriteItem
+}
+
+// NewTransactWriteBuilder crea un constructor de transacciones vacío
+func NewTransactWriteBuilder() *TransactWriteBuilder {
+	return &TransactWriteBuilder{}
+}
+
+// Put - Insertar o reemplazar un ítem; expr es opcional y aporta la condición
+func (b *TransactWriteBuilder) Put(tableName string, item map[string]types.AttributeValue, expr *expression.Expression) *TransactWriteBuilder {
+	put := &types.Put{
+		TableName: aws.String(tableName),
+		Item:      item,
+	}
+	if expr != nil {
+		put.ConditionExpression = expr.Condition()
+		put.ExpressionAttributeNames = expr.Names()
+		put.ExpressionAttributeValues = expr.Values()
+	}
+
+	b.items = append(b.items, types.TransactWriteItem{Put: put})
+	return b
+}
+
+// Update - Actualizar atributos de un ítem; expr incluye la actualización y
+// opcionalmente una condición
+func (b *TransactWriteBuilder) Update(tableName string, key map[string]types.AttributeValue, expr expression.Expression) *TransactWriteBuilder {
+	b.items = append(b.items, types.TransactWriteItem{
+		Update: &types.Update{
+			TableName:                 aws.String(tableName),
+			Key:                       key,
+			UpdateExpression:          expr.Update(),
+			ConditionExpression:       expr.Condition(),
+			ExpressionAttributeNames:  expr.Names(),
+			ExpressionAttributeValues: expr.Values(),
+		},
+	})
+	return b
+}
+
+// Delete - Eliminar un ítem; expr es opcional y aporta la condición
+func (b *TransactWriteBuilder) Delete(tableName string, key map[string]types.AttributeValue, expr *expression.Expression) *TransactWriteBuilder {
+	del := &types.Delete{
+		TableName: aws.String(tableName),
+		Key:       key,
+	}
+	if expr != nil {
+		del.ConditionExpression = expr.Condition()
+		del.ExpressionAttributeNames = expr.Names()
+		del.ExpressionAttributeValues = expr.Values()
+	}
+
+	b.items = append(b.items, types.TransactWriteItem{Delete: del})
+	return b
+}
+
+// ConditionCheck - Verificar una condición sobre un ítem sin modificarlo
+func (b *TransactWriteBuilder) ConditionCheck(tableName string, key map[string]types.AttributeValue, expr expression.Expression) *TransactWriteBuilder {
+	b.items = append(b.items, types.TransactWriteItem{
+		ConditionCheck: &types.ConditionCheck{
+			TableName:                 aws.String(tableName),
+			Key:                       key,
+			ConditionExpression:       expr.Condition(),
+			ExpressionAttributeNames:  expr.Names(),
+			ExpressionAttributeValues: expr.Values(),
+		},
+	})
+	return b
+}
+
+// Items devuelve las operaciones acumuladas
+func (b *TransactWriteBuilder) Items() []types.TransactWriteItem {
+	return b.items
+}
+
+// CancellationReason describe por qué falló una operación dentro de la transacción
+type CancellationReason struct {
+	Index   int
+	Code    string
+	Message string
+}
+
+// TransactionCanceledError indica que DynamoDB canceló la transacción,
+// con el motivo de cada operación en el mismo orden del constructor
+type TransactionCanceledError struct {
+	Reasons []CancellationReason
+	Err     error
+}
+
+func (e *TransactionCanceledError) Error() string {
+	var parts []string
+	for _, reason := range e.Reasons {
+		parts = append(parts, fmt.Sprintf("[%d] %s: %s", reason.Index, reason.Code, reason.Message))
+	}
+	return fmt.Sprintf("transaction canceled: %s", strings.Join(parts, "; "))
+}
+
+func (e *TransactionCanceledError) Unwrap() error {
+	return e.Err
+}
+
+// ConditionFailed indica si alguna operación falló por su ConditionExpression
+func (e *TransactionCanceledError) ConditionFailed() bool {
+	for _, reason := range e.Reasons {
+		if reason.Code == "ConditionalCheckFailed" {
+			return true
+		}
+	}
+	return false
+}
+
+// TransactWriteItems - Ejecutar de forma atómica las operaciones del constructor
+func (d *DynamoDBClient) TransactWriteItems(ctx context.Context, builder *TransactWriteBuilder) error {
+	items := builder.Items()
+	if len(items) == 0 {
+		return nil
+	}
+	if len(items) > maxTransactItems {
+		return fmt.Errorf("error in transaction: %d operations exceed the limit of %d", len(items), maxTransactItems)
+	}
+
+	err := d.withThrottlePacing(ctx, func() error {
+		_, err := d.writeClient().TransactWriteItems(ctx, &dynamodb.TransactWriteItemsInput{
+			TransactItems: items,
+		})
+		return err
+	})
+	if err != nil {
+		var canceled *types.TransactionCanceledException
+		if errors.As(err, &canceled) {
+			return decodeCancellationReasons(canceled)
+		}
+		return fmt.Errorf("error in transaction: %w", err)
+	}
+
+	return nil
+}
+
+// decodeCancellationReasons conserva solo los motivos relevantes, omitiendo los "None"
+func decodeCancellationReasons(canceled *types.TransactionCanceledException) *TransactionCanceledError {
+	txErr := &TransactionCanceledError{Err: canceled}
+
+	for i, reason := range canceled.CancellationReasons {
+		code := aws.ToString(reason.Code)
+		if code == "" || code == "None" {
+			continue
+		}
+		txErr.Reasons = append(txErr.Reasons, CancellationReason{
+			Index:   i,
+			Code:    code,
+			Message: aws.ToString(reason.Message),
+		})
+	}
+
+	return txErr
+}
@@ -0,0 +1,248 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"text/template"
+
+	"challenge-4-orchestrator/config"
+)
+
+// transformAnyType holds the steps of the message types without their own
+const transformAnyType = "*"
+
+// redacted replaces the values of the redacted fields
+const redacted = "[REDACTED]"
+
+var responseTransforms = NewCounterVec(
+	"orchestrator_response_transforms_total",
+	"Worker responses reshaped before forwarding, by message type and result (success, failure).",
+	"message_type", "result",
+)
+
+// transformInput is the data of the step templates
+type transformInput struct {
+	Response      any
+	Message       any
+	MessageID     string
+	CorrelationID string
+	Lambda        string
+}
+
+var transformFuncs = template.FuncMap{
+	"json": func(v any) (string, error) {
+		data, err := json.Marshal(v)
+		return string(data), err
+	},
+}
+
+// compiledStep is a step with its template parsed
+type compiledStep struct {
+	config.TransformStep
+	template *template.Template
+}
+
+// ResponseTransformer reshapes the worker responses before they are
+// forwarded, with the steps of their message type in order. Responses that
+// are not JSON are forwarded unchanged. A nil *ResponseTransformer changes
+// nothing.
+type ResponseTransformer struct {
+	typeField string
+	steps     map[string][]compiledStep // by message type
+}
+
+// NewResponseTransformer parses the steps by message type
+func NewResponseTransformer(types map[string][]config.TransformStep, typeField string) (*ResponseTransformer, error) {
+	t := &ResponseTransformer{typeField: typeField, steps: make(map[string][]compiledStep, len(types))}
+	for messageType, steps := range types {
+		if err := validateTransform(messageType, steps); err != nil {
+			return nil, err
+		}
+		compiled := make([]compiledStep, len(steps))
+		for i, step := range steps {
+			compiled[i].TransformStep = step
+			if step.Template != "" {
+				// Parsed by validateTransform already
+				compiled[i].template = template.Must(parseTransformTemplate(messageType, step.Template))
+			}
+		}
+		t.steps[messageType] = compiled
+	}
+	return t, nil
+}
+
+func parseTransformTemplate(messageType, source string) (*template.Template, error) {
+	return template.New(messageType).Funcs(transformFuncs).Option("missingkey=zero").Parse(source)
+}
+
+// validateTransform checks the steps of a message type
+func validateTransform(messageType string, steps []config.TransformStep) error {
+	if messageType == "" {
+		return errors.New("transform message type must not be empty")
+	}
+	for i, step := range steps {
+		set := 0
+		for _, ok := range []bool{len(step.Rename) > 0, len(step.Redact) > 0, len(step.Remove) > 0, step.Flatten != "", step.Template != ""} {
+			if ok {
+				set++
+			}
+		}
+		if set != 1 {
+			return fmt.Errorf("transform %s step %d must set exactly one of rename, redact, remove, flatten and template", messageType, i)
+		}
+		for from, to := range step.Rename {
+			if from == "" || to == "" {
+				return fmt.Errorf("transform %s step %d renames an empty path", messageType, i)
+			}
+		}
+		if step.Template != "" {
+			if _, err := parseTransformTemplate(messageType, step.Template); err != nil {
+				return fmt.Errorf("transform %s step %d: invalid template: %w", messageType, i, err)
+			}
+		}
+	}
+	return nil
+}
+
+// Transform returns the response to forward for msg
+func (t *ResponseTransformer) Transform(ctx context.Context, msg any, response *workerResponse) ([]byte, error) {
+	if t == nil || !json.Valid(response.Body) {
+		return response.Body, nil
+	}
+	fields, _ := msg.(map[string]any)
+	messageType, _ := fields[t.typeField].(string)
+	steps, ok := t.steps[messageType]
+	if !ok {
+		steps, ok = t.steps[transformAnyType]
+	}
+	if !ok {
+		return response.Body, nil
+	}
+
+	var value any
+	if err := json.Unmarshal(response.Body, &value); err != nil {
+		return nil, fmt.Errorf("error decoding response: %w", err)
+	}
+	for i, step := range steps {
+		var err error
+		if value, err = step.apply(ctx, value, msg, response.Lambda); err != nil {
+			responseTransforms.Inc(messageType, "failure")
+			return nil, fmt.Errorf("error in transform step %d: %w", i, err)
+		}
+	}
+	body, err := json.Marshal(value)
+	if err != nil {
+		responseTransforms.Inc(messageType, "failure")
+		return nil, fmt.Errorf("error marshaling transformed response: %w", err)
+	}
+	responseTransforms.Inc(messageType, "success")
+	return body, nil
+}
+
+func (s compiledStep) apply(ctx context.Context, value, msg any, worker Lambda) (any, error) {
+	if s.template != nil {
+		var out bytes.Buffer
+		err := s.template.Execute(&out, transformInput{
+			Response:      value,
+			Message:       msg,
+			MessageID:     messageIDFrom(ctx),
+			CorrelationID: correlationIDFrom(ctx),
+			Lambda:        worker.Name,
+		})
+		if err != nil {
+			return nil, fmt.Errorf("error rendering template: %w", err)
+		}
+		var rendered any
+		if err := json.Unmarshal(out.Bytes(), &rendered); err != nil {
+			return nil, fmt.Errorf("template did not render JSON: %w", err)
+		}
+		return rendered, nil
+	}
+
+	object, ok := value.(map[string]any)
+	if !ok {
+		// The field steps only apply to objects
+		return value, nil
+	}
+	for from, to := range s.Rename {
+		if field, ok := removePath(object, from); ok {
+			setPath(object, to, field)
+		}
+	}
+	for _, path := range s.Redact {
+		if _, ok := lookupPath(object, path); ok {
+			setPath(object, path, redacted)
+		}
+	}
+	for _, path := range s.Remove {
+		removePath(object, path)
+	}
+	if s.Flatten != "" {
+		flat := make(map[string]any)
+		flatten(flat, "", s.Flatten, object)
+		return flat, nil
+	}
+	return object, nil
+}
+
+// lookupPath returns the value at a dotted path
+func lookupPath(object map[string]any, path string) (any, bool) {
+	keys := strings.Split(path, ".")
+	for _, key := range keys[:len(keys)-1] {
+		next, ok := object[key].(map[string]any)
+		if !ok {
+			return nil, false
+		}
+		object = next
+	}
+	value, ok := object[keys[len(keys)-1]]
+	return value, ok
+}
+
+// setPath sets the value at a dotted path, creating the missing objects
+func setPath(object map[string]any, path string, value any) {
+	keys := strings.Split(path, ".")
+	for _, key := range keys[:len(keys)-1] {
+		next, ok := object[key].(map[string]any)
+		if !ok {
+			next = make(map[string]any)
+			object[key] = next
+		}
+		object = next
+	}
+	object[keys[len(keys)-1]] = value
+}
+
+// removePath deletes the value at a dotted path and returns it
+func removePath(object map[string]any, path string) (any, bool) {
+	keys := strings.Split(path, ".")
+	for _, key := range keys[:len(keys)-1] {
+		next, ok := object[key].(map[string]any)
+		if !ok {
+			return nil, false
+		}
+		object = next
+	}
+	last := keys[len(keys)-1]
+	value, ok := object[last]
+	delete(object, last)
+	return value, ok
+}
+
+// flatten copies the leaves of object to flat, joining the keys with sep
+func flatten(flat map[string]any, prefix, sep string, object map[string]any) {
+	for key, value := range object {
+		if prefix != "" {
+			key = prefix + sep + key
+		}
+		if nested, ok := value.(map[string]any); ok && len(nested) > 0 {
+			flatten(flat, key, sep, nested)
+			continue
+		}
+		flat[key] = value
+	}
+}
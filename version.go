@@ -0,0 +1,66 @@
+package main
+
+import (
+	"net/http"
+	"runtime"
+	"runtime/debug"
+	"sort"
+)
+
+type VersionInfo struct {
+	Version   string   `json:"version"`
+	Commit    string   `json:"commit,omitempty"`
+	BuildDate string   `json:"buildDate,omitempty"`
+	GoVersion string   `json:"goVersion"`
+	Features  []string `json:"features"`
+}
+
+// VersionHandler serves /version with the build metadata and the features
+// enabled by the current configuration
+type VersionHandler struct {
+	info VersionInfo
+}
+
+func NewVersionHandler(features []string) *VersionHandler {
+	info := VersionInfo{
+		Version:   Version,
+		Commit:    Commit,
+		BuildDate: BuildDate,
+		GoVersion: runtime.Version(),
+		Features:  features,
+	}
+
+	// Fall back to the VCS stamp of the Go toolchain when not injected
+	if build, ok := debug.ReadBuildInfo(); ok {
+		for _, setting := range build.Settings {
+			switch {
+			case setting.Key == "vcs.revision" && info.Commit == "":
+				info.Commit = setting.Value
+			case setting.Key == "vcs.time" && info.BuildDate == "":
+				info.BuildDate = setting.Value
+			}
+		}
+	}
+
+	return &VersionHandler{info: info}
+}
+
+func (v *VersionHandler) Register(mux *http.ServeMux) {
+	mux.HandleFunc("GET /version", v.versionHandler)
+}
+
+func (v *VersionHandler) versionHandler(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, v.info)
+}
+
+// enabledFeatures returns the sorted names of the enabled features
+func enabledFeatures(flags map[string]bool) []string {
+	features := []string{}
+	for name, enabled := range flags {
+		if enabled {
+			features = append(features, name)
+		}
+	}
+	sort.Strings(features)
+	return features
+}
@@ -0,0 +1,97 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// maxWorkerRateWait is the longest a message waits for a token of its
+// worker; then it fails as throttled and the source delivers it again
+const maxWorkerRateWait = 5 * time.Second
+
+var workerRateLimited = NewCounterVec(
+	"orchestrator_worker_rate_limited_total",
+	"Invocations held back by the maxRate of their registry entry, by worker.",
+	"lambda_arn",
+)
+
+// WorkerRateLimits enforces the maxRate of each registry entry with a token
+// bucket per worker, independently of consumer.maxRate. Routing prefers the
+// workers with a token left; when none has one, the message waits for a
+// token of the selected worker. A batched invocation takes one token for
+// all its messages. A nil *WorkerRateLimits does not limit.
+type WorkerRateLimits struct {
+	mu      sync.Mutex
+	buckets map[string]*workerBucket // by worker ARN
+}
+
+type workerBucket struct {
+	rate   float64
+	bucket *tokenBucket
+}
+
+func NewWorkerRateLimits() *WorkerRateLimits {
+	return &WorkerRateLimits{buckets: make(map[string]*workerBucket)}
+}
+
+// bucket returns the bucket of the worker, following changes of its maxRate
+// in the registry; nil when it has none
+func (w *WorkerRateLimits) bucket(worker Lambda) *tokenBucket {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if worker.MaxRate <= 0 {
+		delete(w.buckets, worker.ARN)
+		return nil
+	}
+	b, ok := w.buckets[worker.ARN]
+	switch {
+	case !ok:
+		b = &workerBucket{rate: worker.MaxRate, bucket: newTokenBucket(worker.MaxRate, max(1, int(worker.MaxRate)))}
+		w.buckets[worker.ARN] = b
+	case b.rate != worker.MaxRate:
+		b.rate = worker.MaxRate
+		b.bucket.SetRate(worker.MaxRate, max(1, int(worker.MaxRate)))
+	}
+	return b.bucket
+}
+
+// Available returns the workers with a token left, or all of them when none
+// has one
+func (w *WorkerRateLimits) Available(lambdas []Lambda) []Lambda {
+	if w == nil {
+		return lambdas
+	}
+	available := make([]Lambda, 0, len(lambdas))
+	for _, lambda := range lambdas {
+		if bucket := w.bucket(lambda); bucket == nil || bucket.Ready() {
+			available = append(available, lambda)
+		}
+	}
+	if len(available) == 0 {
+		return lambdas
+	}
+	return available
+}
+
+// Wait takes a token of the worker, waiting up to maxWorkerRateWait
+func (w *WorkerRateLimits) Wait(ctx context.Context, worker Lambda) error {
+	if w == nil {
+		return nil
+	}
+	bucket := w.bucket(worker)
+	if bucket == nil || bucket.Allow() {
+		return nil
+	}
+
+	workerRateLimited.Inc(worker.ARN)
+	waitCtx, cancel := context.WithTimeout(ctx, maxWorkerRateWait)
+	defer cancel()
+	err := bucket.Wait(waitCtx)
+	if errors.Is(err, context.DeadlineExceeded) && ctx.Err() == nil {
+		return fmt.Errorf("%w: worker %s is over its maxRate of %g/s", ErrInvokeThrottled, worker.ARN, worker.MaxRate)
+	}
+	return err
+}
@@ -0,0 +1,407 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"strings"
+	"sync"
+	"time"
+
+	"challenge-4-orchestrator/config"
+
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue"
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/expression"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// Key prefixes of the workflow table, which holds definitions and the
+// state of running executions
+const (
+	workflowDefinitionPrefix = "definicion#"
+	workflowExecutionPrefix  = "ejecucion#"
+)
+
+// Execution states
+const (
+	workflowRunning   = "en_curso"
+	workflowCompleted = "completado"
+)
+
+var workflowStepAttempts = NewCounterVec(
+	"orchestrator_workflow_step_attempts_total",
+	"Workflow step invocations, by workflow, step and result (success, error, timeout).",
+	"workflow", "step", "result",
+)
+
+// workflowDefinition is a workflow stored in the table, as
+// {id: "definicion#<type>", pasos: [{nombre, funcion, timeout: "10s", reintentos}]}
+type workflowDefinition struct {
+	ID    string `dynamodbav:"id"`
+	Steps []struct {
+		Name     string `dynamodbav:"nombre"`
+		Function string `dynamodbav:"funcion"`
+		Timeout  string `dynamodbav:"timeout,omitempty"`
+		Retries  int    `dynamodbav:"reintentos,omitempty"`
+	} `dynamodbav:"pasos"`
+}
+
+// WorkflowExecution is the persisted progress of a message through its
+// workflow: Payload is the input of Step, or the final output once
+// completed
+type WorkflowExecution struct {
+	ID        string `dynamodbav:"id"`
+	Workflow  string `dynamodbav:"workflow"`
+	Step      int    `dynamodbav:"pasoActual"`
+	Payload   string `dynamodbav:"carga"`
+	Status    string `dynamodbav:"estado"`
+	LastError string `dynamodbav:"ultimoError,omitempty"`
+	Instance  string `dynamodbav:"instancia"`
+	UpdatedAt string `dynamodbav:"actualizado"`
+	ExpiresAt int64  `dynamodbav:"expiraEn"`
+}
+
+// WorkflowOptions configures the workflow engine
+type WorkflowOptions struct {
+	// TypeField is the payload field naming the message type
+	TypeField string
+	// StateTTL is how long executions are kept once last updated
+	StateTTL time.Duration
+	// Definitions are the steps by message type; the table can add more
+	Definitions map[string][]config.WorkflowStep
+}
+
+// WorkflowEngine runs the messages whose type has a workflow through a
+// sequence of Lambdas instead of a single worker. Progress is written to
+// the table after every step, keyed by message ID, so a redelivered message
+// resumes at the step that failed, on any replica. A nil *WorkflowEngine
+// has no workflows.
+type WorkflowEngine struct {
+	db         *DynamoDBClient
+	invoker    Invoker
+	instanceID string
+	opts       WorkflowOptions
+
+	mu        sync.RWMutex
+	workflows map[string][]config.WorkflowStep
+}
+
+func NewWorkflowEngine(db *DynamoDBClient, invoker Invoker, instanceID string, opts WorkflowOptions) *WorkflowEngine {
+	workflows := make(map[string][]config.WorkflowStep, len(opts.Definitions))
+	for name, steps := range opts.Definitions {
+		workflows[name] = steps
+	}
+	return &WorkflowEngine{
+		db:         db,
+		invoker:    invoker,
+		instanceID: instanceID,
+		opts:       opts,
+		workflows:  workflows,
+	}
+}
+
+// LoadDefinitions reads the workflows stored in the table, which replace
+// configured workflows of the same type
+func (e *WorkflowEngine) LoadDefinitions(ctx context.Context) error {
+	expr, err := expression.NewBuilder().
+		WithFilter(expression.Name("id").BeginsWith(workflowDefinitionPrefix)).
+		Build()
+	if err != nil {
+		return fmt.Errorf("error building definitions filter: %w", err)
+	}
+	items, err := e.db.Scan(ctx, &expr)
+	if err != nil {
+		return fmt.Errorf("error reading workflow definitions: %w", err)
+	}
+
+	loaded := make(map[string][]config.WorkflowStep, len(items))
+	for _, item := range items {
+		var definition workflowDefinition
+		if err := attributevalue.UnmarshalMap(item, &definition); err != nil {
+			return fmt.Errorf("error unmarshaling workflow definition: %w", err)
+		}
+		name := strings.TrimPrefix(definition.ID, workflowDefinitionPrefix)
+		steps := make([]config.WorkflowStep, 0, len(definition.Steps))
+		for _, stored := range definition.Steps {
+			step := config.WorkflowStep{Name: stored.Name, Function: stored.Function, Retries: stored.Retries}
+			if stored.Timeout != "" {
+				if step.Timeout, err = time.ParseDuration(stored.Timeout); err != nil {
+					return fmt.Errorf("workflow %s step %s: invalid timeout: %w", name, stored.Name, err)
+				}
+			}
+			steps = append(steps, step)
+		}
+		if err := validateWorkflow(name, steps); err != nil {
+			return err
+		}
+		loaded[name] = steps
+	}
+
+	e.mu.Lock()
+	for name, steps := range loaded {
+		e.workflows[name] = steps
+	}
+	e.mu.Unlock()
+	slog.Info("Workflow definitions loaded", "table", e.db.tableName, "count", len(loaded))
+	return nil
+}
+
+// Match returns the workflow for the type of a message, if it has one
+func (e *WorkflowEngine) Match(msg any) (string, []config.WorkflowStep, bool) {
+	if e == nil {
+		return "", nil, false
+	}
+	fields, ok := msg.(map[string]any)
+	if !ok {
+		return "", nil, false
+	}
+	name, ok := fields[e.opts.TypeField].(string)
+	if !ok {
+		return "", nil, false
+	}
+
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+	steps, ok := e.workflows[name]
+	return name, steps, ok
+}
+
+// Run takes the message in ctx through the steps of its workflow, starting
+// at the step recorded for it. A message whose workflow already completed
+// gets the stored output without invoking anything.
+func (e *WorkflowEngine) Run(ctx context.Context, name string, steps []config.WorkflowStep, msg any) (*workerResponse, error) {
+	logger := loggerFrom(ctx).With("workflow", name)
+	started := time.Now()
+
+	execution, err := e.start(ctx, name, msg)
+	if err != nil {
+		return nil, err
+	}
+	switch {
+	case execution.Workflow != name:
+		return nil, fmt.Errorf("message already has an execution of workflow %s", execution.Workflow)
+	case execution.Status == workflowCompleted:
+		logger.Info("Workflow already completed, returning the stored output")
+	case execution.Step > 0:
+		logger.Info("Resuming workflow", "step", execution.Step, "last_error", execution.LastError)
+	}
+	if execution.Status != workflowCompleted && execution.Step >= len(steps) {
+		return nil, fmt.Errorf("workflow %s has %d steps, the execution is at step %d", name, len(steps), execution.Step)
+	}
+
+	for execution.Status != workflowCompleted {
+		step := steps[execution.Step]
+		output, err := e.runStep(ctx, name, step, json.RawMessage(execution.Payload))
+		if err != nil {
+			e.recordError(ctx, execution, err)
+			return nil, fmt.Errorf("workflow %s step %s: %w", name, step.Name, err)
+		}
+		logger.Info("Workflow step completed", "step", step.Name)
+
+		status := workflowRunning
+		if execution.Step == len(steps)-1 {
+			status = workflowCompleted
+		}
+		if err := e.advance(ctx, execution, string(output), status); err != nil {
+			return nil, err
+		}
+	}
+
+	last := steps[len(steps)-1]
+	return &workerResponse{
+		Lambda:  Lambda{ARN: last.Function, Name: name + "/" + last.Name},
+		Body:    []byte(execution.Payload),
+		Elapsed: time.Since(started),
+	}, nil
+}
+
+// start loads the execution of the message, creating it at the first step
+func (e *WorkflowEngine) start(ctx context.Context, name string, msg any) (*WorkflowExecution, error) {
+	messageID := messageIDFrom(ctx)
+	if messageID == "" {
+		return nil, errors.New("workflow messages need a message ID")
+	}
+	id := workflowExecutionPrefix + messageID
+	if execution, err := e.load(ctx, id); err != nil || execution != nil {
+		return execution, err
+	}
+
+	payload, err := json.Marshal(msg)
+	if err != nil {
+		return nil, fmt.Errorf("error marshaling workflow input: %w", err)
+	}
+	execution := &WorkflowExecution{
+		ID:       id,
+		Workflow: name,
+		Payload:  string(payload),
+		Status:   workflowRunning,
+	}
+	e.stamp(execution)
+
+	item, err := attributevalue.MarshalMap(execution)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal workflow execution: %w", err)
+	}
+	expr, err := expression.NewBuilder().
+		WithCondition(expression.AttributeNotExists(expression.Name("id"))).
+		Build()
+	if err != nil {
+		return nil, fmt.Errorf("error building execution condition: %w", err)
+	}
+	err = e.db.PutItemWithCondition(ctx, item, expr)
+	if isConditionFailed(err) {
+		// Another replica started it first
+		return e.load(ctx, id)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error saving workflow execution: %w", err)
+	}
+	return execution, nil
+}
+
+func (e *WorkflowEngine) load(ctx context.Context, id string) (*WorkflowExecution, error) {
+	item, err := e.db.GetItem(ctx, id, ConsistentRead(true))
+	if err != nil {
+		return nil, fmt.Errorf("error reading workflow execution: %w", err)
+	}
+	if item == nil {
+		return nil, nil
+	}
+	var execution WorkflowExecution
+	if err := attributevalue.UnmarshalMap(item, &execution); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal workflow execution: %w", err)
+	}
+	return &execution, nil
+}
+
+// runStep invokes a step with its timeout, retrying failed attempts
+func (e *WorkflowEngine) runStep(ctx context.Context, workflow string, step config.WorkflowStep, input json.RawMessage) (output []byte, err error) {
+	ctx, span := tracer.Start(ctx, "workflow step",
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(
+			attribute.String("workflow.name", workflow),
+			attribute.String("workflow.step", step.Name),
+			attribute.String("faas.invoked_name", step.Function),
+		),
+	)
+	defer func() { endSpan(span, err) }()
+
+	for attempt := 0; attempt <= step.Retries; attempt++ {
+		if attempt > 0 {
+			loggerFrom(ctx).Warn("Retrying workflow step", "step", step.Name, "attempt", attempt+1, errAttr(err))
+			if sleepErr := sleepContext(ctx, time.Duration(attempt)*time.Second); sleepErr != nil {
+				return nil, err
+			}
+		}
+
+		attemptCtx, cancel := ctx, context.CancelFunc(func() {})
+		if step.Timeout > 0 {
+			attemptCtx, cancel = context.WithTimeout(ctx, step.Timeout)
+		}
+		output, err = e.invoker.InvokeSync(attemptCtx, step.Function, input)
+		timedOut := errors.Is(attemptCtx.Err(), context.DeadlineExceeded) && ctx.Err() == nil
+		cancel()
+
+		switch {
+		case err == nil:
+			workflowStepAttempts.Inc(workflow, step.Name, "success")
+			return output, nil
+		case timedOut:
+			workflowStepAttempts.Inc(workflow, step.Name, "timeout")
+			err = fmt.Errorf("timed out after %s: %w", step.Timeout, err)
+		default:
+			workflowStepAttempts.Inc(workflow, step.Name, "error")
+		}
+		if ctx.Err() != nil {
+			break
+		}
+	}
+	return nil, err
+}
+
+// advance records a completed step, unless another replica moved the
+// execution first
+func (e *WorkflowEngine) advance(ctx context.Context, execution *WorkflowExecution, payload, status string) error {
+	next := *execution
+	next.Step++
+	next.Payload = payload
+	next.Status = status
+	next.LastError = ""
+	e.stamp(&next)
+
+	update := expression.Set(expression.Name("pasoActual"), expression.Value(next.Step)).
+		Set(expression.Name("carga"), expression.Value(next.Payload)).
+		Set(expression.Name("estado"), expression.Value(next.Status)).
+		Set(expression.Name("instancia"), expression.Value(next.Instance)).
+		Set(expression.Name("actualizado"), expression.Value(next.UpdatedAt)).
+		Set(expression.Name("expiraEn"), expression.Value(next.ExpiresAt)).
+		Remove(expression.Name("ultimoError"))
+	expr, err := expression.NewBuilder().
+		WithUpdate(update).
+		WithCondition(expression.Name("pasoActual").Equal(expression.Value(execution.Step))).
+		Build()
+	if err != nil {
+		return fmt.Errorf("error building workflow update: %w", err)
+	}
+
+	if err := e.db.UpdateItem(ctx, itemKey(execution.ID), expr); err != nil {
+		if isConditionFailed(err) {
+			return fmt.Errorf("workflow execution %s was advanced by another consumer", execution.ID)
+		}
+		return fmt.Errorf("error saving workflow progress: %w", err)
+	}
+	*execution = next
+	return nil
+}
+
+// recordError keeps the failure of the current step for operators; the
+// redelivered message retries that step
+func (e *WorkflowEngine) recordError(ctx context.Context, execution *WorkflowExecution, stepErr error) {
+	update := expression.Set(expression.Name("ultimoError"), expression.Value(stepErr.Error())).
+		Set(expression.Name("actualizado"), expression.Value(time.Now().UTC().Format(time.RFC3339)))
+	expr, err := expression.NewBuilder().
+		WithUpdate(update).
+		WithCondition(expression.Name("pasoActual").Equal(expression.Value(execution.Step))).
+		Build()
+	if err == nil {
+		err = e.db.UpdateItem(ctx, itemKey(execution.ID), expr)
+	}
+	if err != nil && !isConditionFailed(err) {
+		loggerFrom(ctx).Warn("Error recording workflow step failure", errAttr(err))
+	}
+}
+
+func (e *WorkflowEngine) stamp(execution *WorkflowExecution) {
+	now := time.Now().UTC()
+	execution.Instance = e.instanceID
+	execution.UpdatedAt = now.Format(time.RFC3339)
+	execution.ExpiresAt = now.Add(e.opts.StateTTL).Unix()
+}
+
+// validateWorkflow checks a definition from the configuration or the table
+func validateWorkflow(name string, steps []config.WorkflowStep) error {
+	if name == "" {
+		return errors.New("workflow type must not be empty")
+	}
+	if len(steps) == 0 {
+		return fmt.Errorf("workflow %s has no steps", name)
+	}
+	seen := make(map[string]bool, len(steps))
+	for i, step := range steps {
+		switch {
+		case step.Name == "":
+			return fmt.Errorf("workflow %s step %d has no name", name, i)
+		case seen[step.Name]:
+			return fmt.Errorf("workflow %s has two steps named %s", name, step.Name)
+		case step.Function == "":
+			return fmt.Errorf("workflow %s step %s has no function", name, step.Name)
+		case step.Timeout < 0 || step.Retries < 0:
+			return fmt.Errorf("workflow %s step %s: timeout and retries must not be negative", name, step.Name)
+		}
+		seen[step.Name] = true
+	}
+	return nil
+}